@@ -0,0 +1,222 @@
+package pixi
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// Returned by AppendTags and AppendLayer when the file changed between reading where to link the
+// appended section and linking it, meaning another writer appended to the file at the same time
+// without taking its lock.
+var ErrConcurrentModification = errors.New("pixi: file was modified concurrently")
+
+// The ends of the chains of a file that appending links new sections from, read when an append begins
+// and read again just before the new section is linked, see checkAppend.
+type appendState struct {
+	header      PixiHeader
+	layers      []*Layer
+	size        int64
+	lastLayer   *Layer // nil if the file has no layers
+	layerOffset int64  // the offset of the header of the last layer
+	lastTags    *chainedTags
+}
+
+func readAppendState(f io.ReadSeeker) (appendState, error) {
+	_, err := f.Seek(0, io.SeekStart)
+	if err != nil {
+		return appendState{}, err
+	}
+	summary, err := ReadPixiLayers(f)
+	if err != nil {
+		return appendState{}, err
+	}
+	state := appendState{header: summary.Header, layers: summary.AllLayers()}
+	if len(state.layers) > 0 {
+		state.lastLayer = state.layers[len(state.layers)-1]
+		state.layerOffset = summary.LayerOffset(state.lastLayer)
+	}
+	chain, err := readTagChain(f, summary.Header, summary.Header.FirstTagsOffset)
+	if err != nil {
+		return appendState{}, err
+	}
+	if len(chain) > 0 {
+		state.lastTags = &chain[len(chain)-1]
+	}
+	state.size, err = f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return appendState{}, err
+	}
+	if state.lastTags != nil && isSeal(state.lastTags.section) && state.lastTags.end == state.size {
+		return appendState{}, UnsupportedError("cannot append to a sealed file, it would no longer match its seal")
+	}
+	return state, nil
+}
+
+// Reads the state of the file for appending as readAppendState does, and finds the named layer.
+func readLayerState(f io.ReadSeeker, layerName string) (appendState, int, error) {
+	state, err := readAppendState(f)
+	if err != nil {
+		return state, 0, err
+	}
+	layerIndex := slices.IndexFunc(state.layers, func(l *Layer) bool { return l.Name == layerName })
+	if layerIndex < 0 {
+		return state, 0, FormatError("the file has no layer named '" + layerName + "'")
+	}
+	return state, layerIndex, nil
+}
+
+// Re-reads the ends of the chains of the file before linking a section appended from start to end, and
+// fails with ErrConcurrentModification if anything else was linked or written since the append began.
+func checkAppend(f io.ReadSeeker, before appendState, end int64) (appendState, error) {
+	after, err := readAppendState(f)
+	if err != nil {
+		return after, err
+	}
+	tagsEnd := func(s appendState) int64 {
+		if s.lastTags == nil {
+			return 0
+		}
+		return s.lastTags.end
+	}
+	switch {
+	case after.size != end:
+		return after, fmt.Errorf("%w: file is %d bytes rather than the %d written", ErrConcurrentModification, after.size, end)
+	case after.header.FirstLayerOffset != before.header.FirstLayerOffset || after.layerOffset != before.layerOffset:
+		return after, fmt.Errorf("%w: a layer was added", ErrConcurrentModification)
+	case after.header.FirstTagsOffset != before.header.FirstTagsOffset || tagsEnd(after) != tagsEnd(before):
+		return after, fmt.Errorf("%w: a tag section was added", ErrConcurrentModification)
+	}
+	return after, nil
+}
+
+// Appends a tag section to the end of the file, after everything else in it, and links it from the end
+// of the chain of file tag sections. Only the new section is written, and the rest of the file is left
+// as it is apart from the link. Sealed files are refused, since appending would break their seal.
+//
+// Appending is safe against other writers that append to the file at the same time, tags or layers,
+// as long as every writer holds the file open exclusively while appending (see OpenFile and
+// AppendTagsFile), since the chains are read afresh once the file is held rather than from an earlier
+// summary. Writers that bypass the lock are detected, but not prevented: if the file changed between
+// the start of the append and linking the section, nothing is linked and ErrConcurrentModification is
+// returned, though the other writer may already have written over the appended bytes or they over its.
+func AppendTags(f io.ReadWriteSeeker, section *TagSection) error {
+	state, err := readAppendState(f)
+	if err != nil {
+		return err
+	}
+	start := state.size
+	_, err = f.Seek(start, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	section.NextTagsStart = 0
+	err = section.Write(f, state.header)
+	if err != nil {
+		return err
+	}
+	end, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	state, err = checkAppend(f, state, end)
+	if err != nil {
+		return err
+	}
+	err = state.header.AddFeatures(f, nil, []*TagSection{section})
+	if err != nil {
+		return err
+	}
+	if state.lastTags == nil {
+		return state.header.OverwriteOffsets(f, state.header.FirstLayerOffset, start)
+	}
+	_, err = f.Seek(state.lastTags.end-int64(state.header.OffsetSize), io.SeekStart)
+	if err != nil {
+		return err
+	}
+	return state.header.WriteOffset(f, start)
+}
+
+// Appends a layer to the end of the file and links it from the last layer of the file, writing its
+// header, then every tile taking the decoded data of each from fill as with Layer.WriteTiles, then its
+// tags if it has any. Other writers are guarded against as with AppendTags.
+func AppendLayer(f io.ReadWriteSeeker, layer *Layer, workers int, fill func(tileIndex int, data []byte) error) error {
+	state, err := readAppendState(f)
+	if err != nil {
+		return err
+	}
+	start := state.size
+	_, err = f.Seek(start, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	layer.NextLayerStart = 0
+	err = layer.WriteHeader(f, state.header)
+	if err != nil {
+		return err
+	}
+	err = layer.WriteTiles(f, state.header, workers, fill)
+	if err != nil {
+		return err
+	}
+	if len(layer.Tags) > 0 {
+		err = layer.WriteTags(f, state.header)
+		if err != nil {
+			return err
+		}
+	}
+	err = layer.OverwriteHeader(f, state.header, start)
+	if err != nil {
+		return err
+	}
+	end, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	state, err = checkAppend(f, state, end)
+	if err != nil {
+		return err
+	}
+	err = state.header.AddFeatures(f, []*Layer{layer}, nil)
+	if err != nil {
+		return err
+	}
+	if state.lastLayer == nil {
+		return state.header.OverwriteOffsets(f, start, state.header.FirstTagsOffset)
+	}
+	state.lastLayer.NextLayerStart = start
+	return state.lastLayer.OverwriteHeader(f, state.header, state.layerOffset)
+}
+
+// Opens the named file exclusively with OpenFile and appends a tag section to it with AppendTags. When
+// another writer holds the file, fails with ErrLocked, or with waitForLock queues behind it.
+func AppendTagsFile(name string, section *TagSection, waitForLock bool) error {
+	file, err := OpenFile(name, OpenOptions{Mode: ReadWrite, WaitForLock: waitForLock})
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	err = AppendTags(file, section)
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// Opens the named file exclusively with OpenFile and appends a layer to it with AppendLayer, waiting for
+// other writers as with AppendTagsFile.
+func AppendLayerFile(name string, layer *Layer, workers int, fill func(tileIndex int, data []byte) error, waitForLock bool) error {
+	file, err := OpenFile(name, OpenOptions{Mode: ReadWrite, WaitForLock: waitForLock})
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	err = AppendLayer(file, layer, workers, fill)
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,146 @@
+package pixi
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/owlpinetech/pixi/internal/buffer"
+)
+
+func appendTestLayer(name string) *Layer {
+	return NewLayer(name, false, CompressionFlate,
+		DimensionSet{{Name: "x", Size: 4, TileSize: 2}},
+		[]Field{{Name: "v", Type: FieldUint16}})
+}
+
+func TestAppendTagsAndLayers(t *testing.T) {
+	header := PixiHeader{Version: Version, OffsetSize: 4, ByteOrder: binary.BigEndian}
+	buf := buffer.NewBuffer(10)
+	first := appendTestLayer("first")
+	writeSingleLayerPixi(t, buf, header, map[string]string{"a": "1"}, first, randomTiles(first))
+
+	err := AppendTags(buf, &TagSection{Tags: map[string]string{"b": "2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := appendTestLayer("second")
+	second.Tags = []*TagSection{{Tags: map[string]string{"band": "second"}}}
+	tiles := randomTiles(second)
+	err = AppendLayer(buf, second, 2, func(tileIndex int, data []byte) error {
+		copy(data, tiles[tileIndex])
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = AppendTags(buf, &TagSection{Tags: map[string]string{"a": "3"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	summary, err := ReadPixi(buffer.NewBufferFrom(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summary.Layers) != 2 || summary.Layers[1].Name != "second" || summary.Layers[1].Tags[0].Tags["band"] != "second" {
+		t.Fatalf("expected the appended layer and its tags to be read back, got %v", summary.Layers)
+	}
+	if len(summary.Tags) != 3 || summary.Tags[1].Tags["b"] != "2" || summary.Tags[2].Tags["a"] != "3" {
+		t.Fatalf("expected three tag sections in the order appended, got %v", summary.Tags)
+	}
+	data := make([]byte, second.DiskTileSize(1))
+	err = summary.Layers[1].ReadTile(buffer.NewBufferFrom(buf.Bytes()), summary.Header, 1, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != string(tiles[1]) {
+		t.Errorf("expected the appended tiles to be read back")
+	}
+}
+
+func TestAppendToEmptyFile(t *testing.T) {
+	header := PixiHeader{Version: Version, OffsetSize: 8, ByteOrder: binary.LittleEndian}
+	buf := buffer.NewBuffer(10)
+	err := header.WriteHeader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	layer := appendTestLayer("only")
+	err = AppendLayer(buf, layer, 1, func(tileIndex int, data []byte) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = AppendTags(buf, &TagSection{Tags: map[string]string{"k": "v"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary, err := ReadPixi(buffer.NewBufferFrom(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summary.Layers) != 1 || len(summary.Tags) != 1 || summary.Tags[0].Tags["k"] != "v" {
+		t.Errorf("expected the first layer and tags to be linked from the header, got %v and %v", summary.Layers, summary.Tags)
+	}
+}
+
+func TestAppendRefusesSealedFile(t *testing.T) {
+	header := PixiHeader{Version: Version, OffsetSize: 4, ByteOrder: binary.LittleEndian}
+	buf := buffer.NewBuffer(10)
+	layer := appendTestLayer("sealed")
+	writeSingleLayerPixi(t, buf, header, nil, layer, randomTiles(layer))
+	_, err := SealContent(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var unsupported UnsupportedError
+	if err = AppendTags(buf, &TagSection{Tags: map[string]string{"late": "tag"}}); !errors.As(err, &unsupported) {
+		t.Errorf("expected appending to a sealed file to be refused, got %v", err)
+	}
+	if _, err = VerifyContent(buf); err != nil {
+		t.Errorf("expected the seal to still hold, got %v", err)
+	}
+}
+
+func TestAppendDetectsConcurrentModification(t *testing.T) {
+	header := PixiHeader{Version: Version, OffsetSize: 4, ByteOrder: binary.LittleEndian}
+	buf := buffer.NewBuffer(10)
+	layer := appendTestLayer("base")
+	writeSingleLayerPixi(t, buf, header, map[string]string{"a": "1"}, layer, randomTiles(layer))
+
+	before, err := readAppendState(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = checkAppend(buf, before, before.size); err != nil {
+		t.Fatalf("expected an unchanged file to pass, got %v", err)
+	}
+
+	// another writer links a tag section while this one is appending
+	err = AppendTags(buf, &TagSection{Tags: map[string]string{"b": "2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := int64(len(buf.Bytes()))
+	if _, err = checkAppend(buf, before, size); !errors.Is(err, ErrConcurrentModification) {
+		t.Errorf("expected a linked tag section to be detected, got %v", err)
+	}
+	if _, err = checkAppend(buf, before, size-1); !errors.Is(err, ErrConcurrentModification) {
+		t.Errorf("expected a grown file to be detected, got %v", err)
+	}
+
+	before, err = readAppendState(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := appendTestLayer("other")
+	err = AppendLayer(buf, other, 1, func(tileIndex int, data []byte) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = checkAppend(buf, before, int64(len(buf.Bytes()))); !errors.Is(err, ErrConcurrentModification) {
+		t.Errorf("expected a linked layer to be detected, got %v", err)
+	}
+}
@@ -0,0 +1,55 @@
+package pixi
+
+import (
+	"io"
+	"math/bits"
+	"sync"
+)
+
+// Pools of chunk buffers lent out by BorrowChunk, one for each power-of-two capacity, so that a buffer is
+// only ever lent for a chunk at least half its size.
+var chunkPools [bits.UintSize]sync.Pool
+
+// Borrows a slice of the given length from a pool shared by the whole process, for callers reading many
+// tiles that only need each for a short while, such as to scan or re-encode them, and would rather not
+// allocate a new slice for each. The contents of the slice are not cleared.
+//
+// The caller has sole use of the slice until it passes it to ReleaseChunk. After that the slice may be
+// lent to another caller at once, so neither it nor any slice of it may be read, written or kept. A slice
+// must be released at most once, and only if it was borrowed; a borrowed slice that is never released is
+// collected as usual, merely missing the chance to be reused.
+func BorrowChunk(size int) []byte {
+	if size <= 0 {
+		return []byte{}
+	}
+	class := bits.Len(uint(size - 1))
+	if pooled, ok := chunkPools[class].Get().(*[]byte); ok {
+		return (*pooled)[:size]
+	}
+	return make([]byte, size, 1<<class)
+}
+
+// Returns a slice given out by BorrowChunk to the pool, ending the caller's use of it. See BorrowChunk for
+// the rules the caller must follow.
+func ReleaseChunk(chunk []byte) {
+	capacity := cap(chunk)
+	// slices of capacities the pool does not hand out cannot have been borrowed
+	if capacity == 0 || capacity&(capacity-1) != 0 {
+		return
+	}
+	chunk = chunk[:capacity]
+	chunkPools[bits.Len(uint(capacity-1))].Put(&chunk)
+}
+
+// Reads the raw tile at the given index as with ReadTileWithOptions, into a slice borrowed with
+// BorrowChunk rather than one given by the caller. The caller owns the slice until it passes it to
+// ReleaseChunk, under the rules of BorrowChunk. If the read fails the slice is released before returning
+// and nil is returned with the error, including when only the checksum fails to match.
+func (l *Layer) ReadTileBorrowed(r io.ReadSeeker, h PixiHeader, tileIndex int, opts TileReadOptions) ([]byte, error) {
+	data := BorrowChunk(l.DiskTileSize(tileIndex))
+	if err := l.ReadTileWithOptions(r, h, tileIndex, data, opts); err != nil {
+		ReleaseChunk(data)
+		return nil, err
+	}
+	return data, nil
+}
@@ -0,0 +1,67 @@
+package pixi
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/owlpinetech/pixi/internal/buffer"
+)
+
+func TestBorrowChunkSizes(t *testing.T) {
+	for _, size := range []int{0, 1, 2, 3, 100, 128, 129, 4096} {
+		chunk := BorrowChunk(size)
+		if len(chunk) != size {
+			t.Errorf("expected a chunk of %d bytes, got %d", size, len(chunk))
+		}
+		if cap(chunk) < size || cap(chunk) > 2*max(size, 1) {
+			t.Errorf("expected the capacity of a %d byte chunk to be within a factor of two, got %d", size, cap(chunk))
+		}
+		ReleaseChunk(chunk)
+	}
+	// slices that were never borrowed are ignored
+	ReleaseChunk(make([]byte, 3))
+	ReleaseChunk(nil)
+}
+
+func TestBorrowChunkReuse(t *testing.T) {
+	chunk := BorrowChunk(100)
+	chunk[0] = 42
+	ReleaseChunk(chunk)
+	// the pool may drop buffers at any time, so reuse can only be checked to keep to the requested length
+	again := BorrowChunk(90)
+	if len(again) != 90 || cap(again) != 128 {
+		t.Errorf("expected a 90 byte chunk with capacity 128, got %d and %d", len(again), cap(again))
+	}
+	ReleaseChunk(again)
+}
+
+func TestLayerReadTileBorrowed(t *testing.T) {
+	header := PixiHeader{Version: Version, OffsetSize: 8, ByteOrder: binary.LittleEndian}
+	layer := NewLayer("borrowed", false, CompressionFlate,
+		DimensionSet{{Name: "x", Size: 8, TileSize: 4}, {Name: "y", Size: 8, TileSize: 4}},
+		[]Field{{Name: "v", Type: FieldUint16}})
+	buf := buffer.NewBuffer(10)
+	chunk := make([]byte, layer.DiskTileSize(0))
+	for i := range chunk {
+		chunk[i] = byte(i)
+	}
+	if err := layer.WriteTile(buf, header, 0, chunk); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := layer.ReadTileBorrowed(buf, header, 0, TileReadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != len(chunk) || data[0] != 0 || data[len(data)-1] != byte(len(chunk)-1) {
+		t.Errorf("expected the tile to be read back, got %v", data)
+	}
+	ReleaseChunk(data)
+
+	buf.Bytes()[layer.TileOffsets[0]+layer.TileBytes[0]] ^= 0xff
+	data, err = layer.ReadTileBorrowed(buf, header, 0, TileReadOptions{})
+	if !errors.As(err, &IntegrityError{}) || data != nil {
+		t.Errorf("expected an integrity error and no data for a corrupted checksum, got %v and %v", err, data)
+	}
+}
@@ -0,0 +1,110 @@
+package pixi
+
+import (
+	"maps"
+	"sync"
+)
+
+// A limit on the memory used for tile data, shared by the caches and buffering writers that are given
+// it, so that several operations running in one process stay within a single bound. Consumers acquire
+// bytes before holding tile data and release them when they drop it; when a consumer cannot acquire
+// more, it evicts or writes out what it already holds instead of growing. Each consumer reports under a
+// name, so current usage can be broken down by what is using it.
+//
+// A nil budget is unlimited, so options that take a budget can leave it unset.
+type MemoryBudget struct {
+	lock  sync.Mutex
+	limit int64
+	used  int64
+	peak  int64
+	usage map[string]int64
+}
+
+// Creates a budget allowing at most limit bytes to be acquired at once.
+func NewMemoryBudget(limit int64) *MemoryBudget {
+	return &MemoryBudget{limit: limit, usage: map[string]int64{}}
+}
+
+// Acquires n bytes for the named consumer if doing so stays within the limit, and reports whether it did.
+func (b *MemoryBudget) TryAcquire(consumer string, n int64) bool {
+	if b == nil {
+		return true
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.used+n > b.limit {
+		return false
+	}
+	b.acquire(consumer, n)
+	return true
+}
+
+// Acquires n bytes for the named consumer even if that exceeds the limit, for data that must be held
+// regardless, such as a single tile larger than the whole budget. Later TryAcquire calls fail until
+// enough is released.
+func (b *MemoryBudget) Acquire(consumer string, n int64) {
+	if b == nil {
+		return
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.acquire(consumer, n)
+}
+
+func (b *MemoryBudget) acquire(consumer string, n int64) {
+	b.used += n
+	b.peak = max(b.peak, b.used)
+	b.usage[consumer] += n
+}
+
+// Returns n bytes previously acquired by the named consumer to the budget.
+func (b *MemoryBudget) Release(consumer string, n int64) {
+	if b == nil {
+		return
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.used -= n
+	b.usage[consumer] -= n
+	if b.usage[consumer] <= 0 {
+		delete(b.usage, consumer)
+	}
+}
+
+// The maximum number of bytes that can be acquired, or -1 for an unlimited (nil) budget.
+func (b *MemoryBudget) Limit() int64 {
+	if b == nil {
+		return -1
+	}
+	return b.limit
+}
+
+// The estimated number of bytes currently held by consumers of the budget.
+func (b *MemoryBudget) Used() int64 {
+	if b == nil {
+		return 0
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.used
+}
+
+// The largest number of bytes held at once since the budget was created.
+func (b *MemoryBudget) Peak() int64 {
+	if b == nil {
+		return 0
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.peak
+}
+
+// The estimated number of bytes currently held by each named consumer.
+func (b *MemoryBudget) Usage() map[string]int64 {
+	if b == nil {
+		return map[string]int64{}
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return maps.Clone(b.usage)
+}
@@ -0,0 +1,47 @@
+package pixi
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestMemoryBudgetAccounting(t *testing.T) {
+	budget := NewMemoryBudget(100)
+	if !budget.TryAcquire("cache", 60) {
+		t.Fatal("expected 60 bytes to fit in an empty budget of 100")
+	}
+	if budget.TryAcquire("writer", 50) {
+		t.Error("expected 50 more bytes not to fit with 60 already used")
+	}
+	if !budget.TryAcquire("writer", 40) {
+		t.Error("expected 40 more bytes to fill the budget exactly")
+	}
+	if want := map[string]int64{"cache": 60, "writer": 40}; !maps.Equal(budget.Usage(), want) {
+		t.Errorf("expected usage %v, got %v", want, budget.Usage())
+	}
+
+	budget.Acquire("cache", 20)
+	if budget.Used() != 120 || budget.Peak() != 120 {
+		t.Errorf("expected forced acquire to exceed the limit, used %d with peak %d", budget.Used(), budget.Peak())
+	}
+	budget.Release("cache", 80)
+	budget.Release("writer", 10)
+	if budget.Used() != 30 || budget.Peak() != 120 {
+		t.Errorf("expected 30 bytes used with peak 120, got %d with peak %d", budget.Used(), budget.Peak())
+	}
+	if want := map[string]int64{"writer": 30}; !maps.Equal(budget.Usage(), want) {
+		t.Errorf("expected released consumers to be dropped from usage, got %v", budget.Usage())
+	}
+}
+
+func TestMemoryBudgetNilIsUnlimited(t *testing.T) {
+	var budget *MemoryBudget
+	if !budget.TryAcquire("cache", 1<<40) {
+		t.Error("expected a nil budget to allow any acquisition")
+	}
+	budget.Acquire("cache", 1)
+	budget.Release("cache", 1)
+	if budget.Limit() != -1 || budget.Used() != 0 || budget.Peak() != 0 || len(budget.Usage()) != 0 {
+		t.Errorf("expected a nil budget to report no limit and no usage")
+	}
+}
@@ -0,0 +1,148 @@
+package pixi
+
+import (
+	"io"
+	"slices"
+)
+
+// Adds a field (channel) to the named separated layer of the file, without rewriting any of the tiles of
+// its other fields, so that a dataset can cheaply grow new attributes. The tiles of the new field are
+// appended to the end of the file, taking the decoded data of each from fill given the tile index as with
+// Layer.WriteTiles, followed by a new header for the layer listing the field last; the new header is then
+// linked in place of the old one, which is left unused in the file until it is compacted. The tags of the
+// layer are kept. Contiguous layers are refused, since every tile holds every field and would have to be
+// rewritten. Other writers are guarded against as with AppendTags, and sealed files are refused.
+func AddChannel(f io.ReadWriteSeeker, layerName string, field Field, workers int, fill func(tileIndex int, data []byte) error) error {
+	state, layerIndex, err := readChannelState(f, layerName)
+	if err != nil {
+		return err
+	}
+	old := state.layers[layerIndex]
+	layer := *old
+	layer.Fields = append(slices.Clone(old.Fields), field)
+	layer.TileBytes = append(slices.Clone(old.TileBytes), make([]int64, old.Dimensions.Tiles())...)
+	layer.TileOffsets = append(slices.Clone(old.TileOffsets), make([]int64, old.Dimensions.Tiles())...)
+	if old.TileRanges != nil {
+		// the ranges of the new field are recorded as its tiles are written
+		layer.TileRanges = make([]TileRange, len(old.TileRanges))
+		for tile, tileRange := range old.TileRanges {
+			layer.TileRanges[tile] = TileRange{Min: append(slices.Clone(tileRange.Min), nil), Max: append(slices.Clone(tileRange.Max), nil)}
+		}
+	}
+	if old.TileCompressions != nil {
+		// likewise the compressions of its tiles
+		layer.TileCompressions = append(slices.Clone(old.TileCompressions), make([]Compression, old.Dimensions.Tiles())...)
+	}
+	err = layer.Fields.Validate()
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Seek(state.size, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	first := len(old.Fields) * old.Dimensions.Tiles()
+	order := func(yield func(int) bool) {
+		for diskTile := first; diskTile < layer.DiskTiles(); diskTile++ {
+			if !yield(diskTile) {
+				return
+			}
+		}
+	}
+	err = layer.WriteTilesInOrder(f, state.header, workers, order, func(diskTile int, data []byte) error {
+		return fill(diskTile-first, data)
+	})
+	if err != nil {
+		return err
+	}
+	return relinkLayer(f, state, layerIndex, &layer)
+}
+
+// Removes the named field (channel) from the named separated layer of the file, without rewriting any of
+// the tiles of its other fields. A new header for the layer without the field is appended to the end of
+// the file and linked in place of the old one, as with AddChannel; the tiles of the removed field are left
+// unused in the file until it is compacted. The last field of a layer cannot be removed, and contiguous
+// layers are refused as with AddChannel.
+func RemoveChannel(f io.ReadWriteSeeker, layerName string, fieldName string) error {
+	state, layerIndex, err := readChannelState(f, layerName)
+	if err != nil {
+		return err
+	}
+	old := state.layers[layerIndex]
+	fieldIndex, ok := old.Fields.ByName(fieldName)
+	if !ok {
+		return FormatError("layer '" + layerName + "' has no field named '" + fieldName + "'")
+	}
+	if len(old.Fields) == 1 {
+		return UnsupportedError("cannot remove the only field of a layer")
+	}
+	tiles := old.Dimensions.Tiles()
+	layer := *old
+	layer.Fields = slices.Delete(slices.Clone(old.Fields), fieldIndex, fieldIndex+1)
+	layer.TileBytes = slices.Delete(slices.Clone(old.TileBytes), fieldIndex*tiles, (fieldIndex+1)*tiles)
+	layer.TileOffsets = slices.Delete(slices.Clone(old.TileOffsets), fieldIndex*tiles, (fieldIndex+1)*tiles)
+	if old.TileRanges != nil {
+		layer.TileRanges = make([]TileRange, len(old.TileRanges))
+		for tile, tileRange := range old.TileRanges {
+			layer.TileRanges[tile] = TileRange{
+				Min: slices.Delete(slices.Clone(tileRange.Min), fieldIndex, fieldIndex+1),
+				Max: slices.Delete(slices.Clone(tileRange.Max), fieldIndex, fieldIndex+1),
+			}
+		}
+	}
+	if old.TileCompressions != nil {
+		layer.TileCompressions = slices.Delete(slices.Clone(old.TileCompressions), fieldIndex*tiles, (fieldIndex+1)*tiles)
+	}
+
+	_, err = f.Seek(state.size, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	return relinkLayer(f, state, layerIndex, &layer)
+}
+
+// Reads the state of the file for appending, and finds the named layer, which must be separated.
+func readChannelState(f io.ReadWriteSeeker, layerName string) (appendState, int, error) {
+	state, layerIndex, err := readLayerState(f, layerName)
+	if err != nil {
+		return state, 0, err
+	}
+	if !state.layers[layerIndex].Separated {
+		return state, 0, UnsupportedError("channels can only be added to or removed from separated layers without rewriting their tiles")
+	}
+	return state, layerIndex, nil
+}
+
+// Writes the header of the changed layer at the current stream position, at the end of the file, then
+// links it from the header of the layer before it (or from the file header) in place of the old layer.
+func relinkLayer(f io.ReadWriteSeeker, state appendState, layerIndex int, layer *Layer) error {
+	start, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	err = layer.WriteHeader(f, state.header)
+	if err != nil {
+		return err
+	}
+	end, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	after, err := checkAppend(f, state, end)
+	if err != nil {
+		return err
+	}
+	err = after.header.AddFeatures(f, []*Layer{layer}, nil)
+	if err != nil {
+		return err
+	}
+	if layerIndex == 0 {
+		return after.header.OverwriteOffsets(f, start, after.header.FirstTagsOffset)
+	}
+	summary := Pixi{Header: after.header, Layers: after.layers}
+	previous := after.layers[layerIndex-1]
+	previous.NextLayerStart = start
+	return previous.OverwriteHeader(f, after.header, summary.LayerOffset(previous))
+}
@@ -0,0 +1,128 @@
+package pixi
+
+import (
+	"encoding/binary"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/owlpinetech/pixi/internal/buffer"
+)
+
+func separatedTestLayer(name string) *Layer {
+	return NewLayer(name, true, CompressionFlate,
+		DimensionSet{{Name: "x", Size: 4, TileSize: 2}},
+		[]Field{{Name: "a", Type: FieldUint16}, {Name: "b", Type: FieldUint8}})
+}
+
+func TestAddAndRemoveChannel(t *testing.T) {
+	header := PixiHeader{Version: Version, OffsetSize: 4, ByteOrder: binary.LittleEndian}
+	buf := buffer.NewBuffer(10)
+	first := separatedTestLayer("first")
+	writeSingleLayerPixi(t, buf, header, nil, first, randomTiles(first))
+	second := separatedTestLayer("second")
+	second.Tags = []*TagSection{{Tags: map[string]string{"band": "second"}}}
+	second.RecordTileRanges()
+	tiles := randomTiles(second)
+	err := AppendLayer(buf, second, 1, func(tileIndex int, data []byte) error {
+		copy(data, tiles[tileIndex])
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := ReadPixi(buffer.NewBufferFrom(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"first", "second"} {
+		err = AddChannel(buf, name, Field{Name: "c", Type: FieldUint32}, 2, func(tileIndex int, data []byte) error {
+			for i := range 2 {
+				binary.LittleEndian.PutUint32(data[i*4:], uint32(100*tileIndex+i))
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	added, err := ReadPixi(buffer.NewBufferFrom(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(added.Layers) != 2 {
+		t.Fatalf("expected both layers to still be linked, got %d", len(added.Layers))
+	}
+	for i, layer := range added.Layers {
+		if len(layer.Fields) != 3 || layer.Fields[2].Name != "c" {
+			t.Fatalf("expected the added field to be last, got %v", layer.Fields)
+		}
+		if !slices.Equal(layer.TileOffsets[:4], before.Layers[i].TileOffsets) {
+			t.Errorf("expected the tiles of the existing fields not to be rewritten")
+		}
+		data := make([]byte, layer.DiskTileSize(5))
+		err = layer.ReadTile(buffer.NewBufferFrom(buf.Bytes()), added.Header, 5, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if binary.LittleEndian.Uint32(data[4:]) != 101 {
+			t.Errorf("expected the second tile of the added field to be filled, got %v", data)
+		}
+	}
+	secondAdded := added.Layers[1]
+	if secondAdded.Tags[0].Tags["band"] != "second" || secondAdded.TileRanges[1].Max[2] != uint32(101) {
+		t.Errorf("expected the tags to be kept and the range of the new field recorded, got %v and %v", secondAdded.Tags, secondAdded.TileRanges)
+	}
+
+	err = RemoveChannel(buf, "second", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	removed, err := ReadPixi(buffer.NewBufferFrom(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	layer := removed.Layers[1]
+	if len(layer.Fields) != 2 || layer.Fields[0].Name != "b" || !slices.Equal(layer.TileOffsets, secondAdded.TileOffsets[2:]) {
+		t.Fatalf("expected the field and its tiles to be dropped, got %v and %v", layer.Fields, layer.TileOffsets)
+	}
+	data := make([]byte, layer.DiskTileSize(0))
+	err = layer.ReadTile(buffer.NewBufferFrom(buf.Bytes()), removed.Header, 0, data)
+	if err != nil || !slices.Equal(data, tiles[2]) {
+		t.Errorf("expected the remaining fields to read back unchanged, got %v %v", data, err)
+	}
+	if len(layer.TileRanges[0].Min) != 2 || layer.Tags[0].Tags["band"] != "second" {
+		t.Errorf("expected the tile ranges and tags to follow the fields, got %v and %v", layer.TileRanges, layer.Tags)
+	}
+}
+
+func TestChannelChangesRefused(t *testing.T) {
+	header := PixiHeader{Version: Version, OffsetSize: 8, ByteOrder: binary.BigEndian}
+	buf := buffer.NewBuffer(10)
+	layer := appendTestLayer("contiguous")
+	writeSingleLayerPixi(t, buf, header, nil, layer, randomTiles(layer))
+	fill := func(tileIndex int, data []byte) error { return nil }
+
+	var unsupported UnsupportedError
+	if err := AddChannel(buf, "contiguous", Field{Name: "w", Type: FieldUint8}, 1, fill); !errors.As(err, &unsupported) {
+		t.Errorf("expected adding a channel to a contiguous layer to be refused, got %v", err)
+	}
+	var format FormatError
+	if err := RemoveChannel(buf, "missing", "v"); !errors.As(err, &format) {
+		t.Errorf("expected a missing layer to be reported, got %v", err)
+	}
+
+	buf = buffer.NewBuffer(10)
+	separated := separatedTestLayer("separated")
+	writeSingleLayerPixi(t, buf, header, nil, separated, randomTiles(separated))
+	if err := AddChannel(buf, "separated", Field{Name: "a", Type: FieldUint8}, 1, fill); err == nil {
+		t.Error("expected a duplicate field name to be refused")
+	}
+	if err := RemoveChannel(buf, "separated", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := RemoveChannel(buf, "separated", "b"); !errors.As(err, &unsupported) {
+		t.Errorf("expected removing the last field to be refused, got %v", err)
+	}
+}
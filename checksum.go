@@ -0,0 +1,65 @@
+package pixi
+
+import (
+	"hash/crc32"
+
+	"github.com/owlpinetech/pixi/internal/xxhash"
+)
+
+// Represents the algorithm used to compute the integrity checksum written after each tile.
+type ChecksumAlgorithm uint8
+
+const (
+	ChecksumCrc32    ChecksumAlgorithm = 0 // 4-byte CRC-32 with the IEEE polynomial, the default.
+	ChecksumCrc32c   ChecksumAlgorithm = 1 // 4-byte CRC-32 with the Castagnoli polynomial, hardware accelerated on most platforms.
+	ChecksumXxHash64 ChecksumAlgorithm = 2 // 8-byte xxHash64, fast and with a very low collision rate.
+	ChecksumNone     ChecksumAlgorithm = 3 // No checksum is written or verified, for throwaway intermediate files.
+)
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+func (c ChecksumAlgorithm) String() string {
+	switch c {
+	case ChecksumCrc32:
+		return "crc32"
+	case ChecksumCrc32c:
+		return "crc32c"
+	case ChecksumXxHash64:
+		return "xxhash64"
+	case ChecksumNone:
+		return "none"
+	default:
+		return "unknown"
+	}
+}
+
+// The number of bytes the checksum occupies on disk after each tile.
+func (c ChecksumAlgorithm) Size() int {
+	switch c {
+	case ChecksumCrc32, ChecksumCrc32c:
+		return 4
+	case ChecksumXxHash64:
+		return 8
+	case ChecksumNone:
+		return 0
+	default:
+		panic("pixi: unsupported checksum algorithm")
+	}
+}
+
+// Computes the checksum of the given data. Checksums smaller than 8 bytes are returned in the
+// low bits of the result. Always returns 0 for ChecksumNone.
+func (c ChecksumAlgorithm) Compute(data []byte) uint64 {
+	switch c {
+	case ChecksumCrc32:
+		return uint64(crc32.ChecksumIEEE(data))
+	case ChecksumCrc32c:
+		return uint64(crc32.Checksum(data, crc32cTable))
+	case ChecksumXxHash64:
+		return xxhash.Sum64(data)
+	case ChecksumNone:
+		return 0
+	default:
+		panic("pixi: unsupported checksum algorithm")
+	}
+}
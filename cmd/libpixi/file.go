@@ -0,0 +1,202 @@
+//go:build cgo
+
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"slices"
+	"sync"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/read"
+)
+
+// The status codes of the C API, matching the PIXI_ERR constants.
+const (
+	statusInvalid  = -1
+	statusNotFound = -2
+	statusFormat   = -3
+	statusBuffer   = -4
+	statusIO       = -5
+)
+
+// The number of decoded tiles of each layer kept in memory between region reads.
+const cacheTiles = 16
+
+// An invalid handle, index, or argument passed to the C API.
+type invalidError string
+
+func (e invalidError) Error() string {
+	return string(e)
+}
+
+func errInvalid(reason string) error {
+	return invalidError(reason)
+}
+
+// A buffer passed to the C API that is too small for what is read into it.
+type bufferError struct {
+	needed, given int
+}
+
+func (e bufferError) Error() string {
+	return fmt.Sprintf("buffer of %d bytes is too small, %d are needed", e.given, e.needed)
+}
+
+var (
+	errorLock sync.Mutex
+	lastErr   error
+)
+
+// Records an error as the most recent failure of the library, returning its status code.
+func setLastError(err error) int {
+	errorLock.Lock()
+	defer errorLock.Unlock()
+	lastErr = err
+	switch {
+	case errors.As(err, new(invalidError)):
+		return statusInvalid
+	case errors.Is(err, fs.ErrNotExist):
+		return statusNotFound
+	case errors.As(err, new(pixi.FormatError)), errors.As(err, new(pixi.IntegrityError)), errors.As(err, new(pixi.UnsupportedError)):
+		return statusFormat
+	case errors.As(err, new(bufferError)):
+		return statusBuffer
+	default:
+		return statusIO
+	}
+}
+
+func lastError() string {
+	errorLock.Lock()
+	defer errorLock.Unlock()
+	if lastErr == nil {
+		return ""
+	}
+	return lastErr.Error()
+}
+
+// A file opened through the C API. Reads are serialized, since the layers share the position of the file.
+type openedFile struct {
+	lock    sync.Mutex
+	file    io.ReadSeekCloser
+	summary pixi.Pixi
+	caches  []*read.LayerReadCache
+}
+
+func openFile(name string) (*openedFile, error) {
+	file, err := pixi.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	summary, err := pixi.ReadPixi(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	opened := &openedFile{file: file, summary: summary}
+	for _, layer := range summary.Layers {
+		opened.caches = append(opened.caches, read.NewLayerReadCache(file, summary.Header, layer, read.NewLfuCacheManager(cacheTiles)))
+	}
+	return opened, nil
+}
+
+func (f *openedFile) close() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.file.Close()
+}
+
+// Returns the number of bytes in the samples of a region of a layer, checking the region lies within it.
+func (f *openedFile) regionBytes(layerIndex int, start pixi.SampleCoordinate, end pixi.SampleCoordinate) (int, error) {
+	layer := f.summary.Layers[layerIndex]
+	samples := 1
+	for i, dim := range layer.Dimensions {
+		if start[i] < 0 || start[i] >= end[i] || end[i] > dim.Size {
+			return 0, errInvalid(fmt.Sprintf("region %v to %v is empty or outside the layer", start, end))
+		}
+		samples *= end[i] - start[i]
+	}
+	return samples * layer.SampleSize(), nil
+}
+
+// Reads the samples of a region of a layer into the buffer, with the first dimension varying fastest and
+// every field in the byte order of the machine.
+func (f *openedFile) readRegion(layerIndex int, start pixi.SampleCoordinate, end pixi.SampleCoordinate, buffer []byte) error {
+	size, err := f.regionBytes(layerIndex, start, end)
+	if err != nil {
+		return err
+	}
+	if len(buffer) < size {
+		return bufferError{needed: size, given: len(buffer)}
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	layer := f.summary.Layers[layerIndex]
+	cache := f.caches[layerIndex]
+	swap := f.summary.Header.ByteOrder.Uint16([]byte{1, 0}) != binary.NativeEndian.Uint16([]byte{1, 0})
+	sampleSize := layer.SampleSize()
+	coord := slices.Clone(start)
+	for offset := 0; offset < size; offset += sampleSize {
+		sample := buffer[offset : offset+sampleSize]
+		err := readSample(layer, cache, coord, sample)
+		if err != nil {
+			return err
+		}
+		if swap {
+			fieldOffset := 0
+			for _, field := range layer.Fields {
+				slices.Reverse(sample[fieldOffset : fieldOffset+field.Size()])
+				fieldOffset += field.Size()
+			}
+		}
+		// advance to the next coordinate, the first dimension fastest
+		for i := range coord {
+			coord[i]++
+			if coord[i] < end[i] {
+				break
+			}
+			coord[i] = start[i]
+		}
+	}
+	return nil
+}
+
+// Copies the raw bytes of the sample at a coordinate, with its fields in order, writing zeros for fields
+// in tiles that were never written.
+func readSample(layer *pixi.Layer, cache *read.LayerReadCache, coord pixi.SampleCoordinate, sample []byte) error {
+	selector := coord.ToTileSelector(layer.Dimensions)
+	if !layer.Separated {
+		if layer.TileBytes[selector.Tile] == 0 {
+			clear(sample)
+			return nil
+		}
+		tile, err := cache.Tile(selector.Tile)
+		if err != nil {
+			return err
+		}
+		copy(sample, tile[selector.InTile*len(sample):])
+		return nil
+	}
+	offset := 0
+	for fieldIndex, field := range layer.Fields {
+		fieldSample := sample[offset : offset+field.Size()]
+		offset += field.Size()
+		tileIndex := selector.Tile + layer.Dimensions.Tiles()*fieldIndex
+		if layer.TileBytes[tileIndex] == 0 {
+			clear(fieldSample)
+			continue
+		}
+		tile, err := cache.Tile(tileIndex)
+		if err != nil {
+			return err
+		}
+		copy(fieldSample, tile[selector.InTile*field.Size():])
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+//go:build cgo
+
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/edit"
+)
+
+func TestReadRegionInNativeOrder(t *testing.T) {
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		path := filepath.Join(t.TempDir(), "region.pixi")
+		file, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		header := pixi.PixiHeader{Version: pixi.Version, OffsetSize: 4, ByteOrder: order}
+		layer := pixi.NewLayer("values", false, pixi.CompressionFlate,
+			pixi.DimensionSet{{Name: "x", Size: 6, TileSize: 4}, {Name: "y", Size: 4, TileSize: 2}},
+			[]pixi.Field{{Name: "index", Type: pixi.FieldUint16}, {Name: "half", Type: pixi.FieldFloat32}})
+		err = edit.WriteContiguousTileOrderPixi(file, header, nil, edit.LayerWriter{
+			Layer: layer,
+			IterFn: func(layer *pixi.Layer, coord pixi.SampleCoordinate) ([]any, map[string]any) {
+				index := coord.ToSampleIndex(layer.Dimensions)
+				return []any{uint16(index), float32(index) / 2}, nil
+			},
+		})
+		file.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		opened, err := openFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		start, end := pixi.SampleCoordinate{3, 1}, pixi.SampleCoordinate{5, 3}
+		size, err := opened.regionBytes(0, start, end)
+		if err != nil || size != 24 {
+			t.Fatalf("expected 4 samples of 6 bytes, got %d, %v", size, err)
+		}
+		if err := opened.readRegion(0, start, end, make([]byte, size-1)); !errors.As(err, new(bufferError)) {
+			t.Errorf("expected a short buffer to be refused, got %v", err)
+		}
+		buffer := make([]byte, size)
+		if err := opened.readRegion(0, start, end, buffer); err != nil {
+			t.Fatal(err)
+		}
+		for i, index := range []int{9, 10, 15, 16} {
+			sample := buffer[i*6:]
+			if binary.NativeEndian.Uint16(sample) != uint16(index) || pixi.FieldFloat32.BytesToValue(sample[2:], binary.NativeEndian) != float32(index)/2 {
+				t.Errorf("%v: expected sample %d to hold index %d, got %v", order, i, index, sample[:6])
+			}
+		}
+		if _, err := opened.regionBytes(0, pixi.SampleCoordinate{0, 0}, pixi.SampleCoordinate{7, 1}); !errors.As(err, new(invalidError)) {
+			t.Errorf("expected a region outside the layer to be invalid, got %v", err)
+		}
+		if err := opened.close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestStatusCodes(t *testing.T) {
+	_, err := openFile(filepath.Join(t.TempDir(), "missing.pixi"))
+	if status := setLastError(err); status != statusNotFound || lastError() != err.Error() {
+		t.Errorf("expected not found status and message, got %d %q", status, lastError())
+	}
+	if status := setLastError(pixi.FormatError("bad")); status != statusFormat {
+		t.Errorf("expected format status, got %d", status)
+	}
+}
@@ -0,0 +1,281 @@
+//go:build cgo
+
+// Libpixi is a C shared library for reading Pixi files, so that other languages (such as Python through
+// ctypes or cffi, with NumPy) can read Pixi without reimplementing the format. Build it with:
+//
+//	go build -buildmode=c-shared -o libpixi.so ./cmd/libpixi
+//
+// which also writes libpixi.h declaring the functions below. The API is deliberately small: open a file,
+// describe its layers, dimensions and fields, read a region of samples into a caller buffer, and close it.
+// PIXI_API_VERSION is incremented whenever a function is changed or removed, and callers should check
+// pixi_api_version before using the library. Functions returning int return PIXI_OK or a negative
+// status code on failure, and pixi_last_error describes the most recent failure.
+//
+// Regions are read in the same layout as the region endpoint of the serve package: the first dimension
+// varies fastest, and each sample holds its fields in order, but converted to the byte order of the
+// machine so that the buffer can be used directly as a NumPy structured array.
+package main
+
+/*
+#include <stddef.h>
+#include <stdint.h>
+
+#define PIXI_API_VERSION 1
+
+#define PIXI_OK 0
+#define PIXI_ERR_INVALID -1    // A handle, index, or argument was invalid.
+#define PIXI_ERR_NOT_FOUND -2  // The file does not exist.
+#define PIXI_ERR_FORMAT -3     // The file is not a valid Pixi file, or its data is corrupt.
+#define PIXI_ERR_BUFFER -4     // The buffer given is too small.
+#define PIXI_ERR_IO -5         // Reading the file failed.
+
+// Field types, with the same values as the field type identifiers of the format.
+#define PIXI_FIELD_INT8 1
+#define PIXI_FIELD_UINT8 2
+#define PIXI_FIELD_INT16 3
+#define PIXI_FIELD_UINT16 4
+#define PIXI_FIELD_INT32 5
+#define PIXI_FIELD_UINT32 6
+#define PIXI_FIELD_INT64 7
+#define PIXI_FIELD_UINT64 8
+#define PIXI_FIELD_FLOAT32 9
+#define PIXI_FIELD_FLOAT64 10
+*/
+import "C"
+
+import (
+	"runtime/cgo"
+	"unsafe"
+
+	"github.com/owlpinetech/pixi"
+)
+
+func main() {}
+
+// Returns PIXI_API_VERSION.
+//
+//export pixi_api_version
+func pixi_api_version() C.int {
+	return C.PIXI_API_VERSION
+}
+
+// Copies the message of the most recent failure into buf, NUL terminated and truncated to size bytes.
+// Returns the length of the full message.
+//
+//export pixi_last_error
+func pixi_last_error(buf *C.char, size C.size_t) C.int {
+	return copyString(lastError(), buf, size)
+}
+
+// Opens the named Pixi file (anything pixi.Open accepts) and stores a handle to it in *handle.
+//
+//export pixi_open
+func pixi_open(name *C.char, handle *C.uintptr_t) C.int {
+	if name == nil || handle == nil {
+		return fail(errInvalid("name and handle must not be NULL"))
+	}
+	file, err := openFile(C.GoString(name))
+	if err != nil {
+		return fail(err)
+	}
+	*handle = C.uintptr_t(cgo.NewHandle(file))
+	return C.PIXI_OK
+}
+
+// Closes a file opened with pixi_open. The handle must not be used afterward: like any handle not
+// returned by pixi_open, passing it to another function is undefined behavior.
+//
+//export pixi_close
+func pixi_close(handle C.uintptr_t) C.int {
+	file, status := lookup(handle)
+	if file == nil {
+		return status
+	}
+	cgo.Handle(handle).Delete()
+	if err := file.close(); err != nil {
+		return fail(err)
+	}
+	return C.PIXI_OK
+}
+
+// Returns the number of layers in the file.
+//
+//export pixi_layer_count
+func pixi_layer_count(handle C.uintptr_t) C.int {
+	file, status := lookup(handle)
+	if file == nil {
+		return status
+	}
+	return C.int(len(file.summary.Layers))
+}
+
+// Copies the name of a layer into buf, NUL terminated and truncated to size bytes. Returns the length of
+// the full name.
+//
+//export pixi_layer_name
+func pixi_layer_name(handle C.uintptr_t, layer C.int, buf *C.char, size C.size_t) C.int {
+	l, status := lookupLayer(handle, layer)
+	if l == nil {
+		return status
+	}
+	return copyString(l.Name, buf, size)
+}
+
+// Returns the number of dimensions of a layer.
+//
+//export pixi_dimension_count
+func pixi_dimension_count(handle C.uintptr_t, layer C.int) C.int {
+	l, status := lookupLayer(handle, layer)
+	if l == nil {
+		return status
+	}
+	return C.int(len(l.Dimensions))
+}
+
+// Describes a dimension of a layer: its name is copied into name as by pixi_layer_name, and its size and
+// tile size are stored in *size and *tileSize. Any of the outputs may be NULL.
+//
+//export pixi_dimension
+func pixi_dimension(handle C.uintptr_t, layer C.int, dim C.int, name *C.char, nameSize C.size_t, size *C.int64_t, tileSize *C.int64_t) C.int {
+	l, status := lookupLayer(handle, layer)
+	if l == nil {
+		return status
+	}
+	if dim < 0 || int(dim) >= len(l.Dimensions) {
+		return fail(errInvalid("dimension index out of range"))
+	}
+	d := l.Dimensions[dim]
+	copyString(d.Name, name, nameSize)
+	if size != nil {
+		*size = C.int64_t(d.Size)
+	}
+	if tileSize != nil {
+		*tileSize = C.int64_t(d.TileSize)
+	}
+	return C.PIXI_OK
+}
+
+// Returns the number of fields in each sample of a layer.
+//
+//export pixi_field_count
+func pixi_field_count(handle C.uintptr_t, layer C.int) C.int {
+	l, status := lookupLayer(handle, layer)
+	if l == nil {
+		return status
+	}
+	return C.int(len(l.Fields))
+}
+
+// Describes a field of a layer: its name is copied into name as by pixi_layer_name, and its type (one of
+// the PIXI_FIELD constants) and size in bytes are stored in *fieldType and *size. Any of the outputs may be NULL.
+//
+//export pixi_field
+func pixi_field(handle C.uintptr_t, layer C.int, field C.int, name *C.char, nameSize C.size_t, fieldType *C.int, size *C.int) C.int {
+	l, status := lookupLayer(handle, layer)
+	if l == nil {
+		return status
+	}
+	if field < 0 || int(field) >= len(l.Fields) {
+		return fail(errInvalid("field index out of range"))
+	}
+	f := l.Fields[field]
+	copyString(f.Name, name, nameSize)
+	if fieldType != nil {
+		*fieldType = C.int(f.Type)
+	}
+	if size != nil {
+		*size = C.int(f.Size())
+	}
+	return C.PIXI_OK
+}
+
+// Returns the number of bytes pixi_read_region needs for a region, or a negative status code. The start
+// and end arrays hold one coordinate per dimension of the layer, with the end exclusive.
+//
+//export pixi_region_bytes
+func pixi_region_bytes(handle C.uintptr_t, layer C.int, start *C.int64_t, end *C.int64_t) C.int64_t {
+	file, status := lookup(handle)
+	if file == nil {
+		return C.int64_t(status)
+	}
+	startCoord, endCoord, ok := coordinates(file, layer, start, end)
+	if !ok {
+		return C.int64_t(fail(errInvalid("layer index out of range, or NULL coordinates")))
+	}
+	size, err := file.regionBytes(int(layer), startCoord, endCoord)
+	if err != nil {
+		return C.int64_t(fail(err))
+	}
+	return C.int64_t(size)
+}
+
+// Reads the samples of a region of a layer into buffer, which must hold at least pixi_region_bytes bytes.
+// Samples in tiles that were never written are zero.
+//
+//export pixi_read_region
+func pixi_read_region(handle C.uintptr_t, layer C.int, start *C.int64_t, end *C.int64_t, buffer unsafe.Pointer, size C.size_t) C.int {
+	file, status := lookup(handle)
+	if file == nil {
+		return status
+	}
+	startCoord, endCoord, ok := coordinates(file, layer, start, end)
+	if !ok || (buffer == nil && size > 0) {
+		return fail(errInvalid("layer index out of range, or NULL coordinates or buffer"))
+	}
+	err := file.readRegion(int(layer), startCoord, endCoord, unsafe.Slice((*byte)(buffer), int(size)))
+	if err != nil {
+		return fail(err)
+	}
+	return C.PIXI_OK
+}
+
+// Returns the file a handle refers to, or nil and a status code if the handle is zero.
+func lookup(handle C.uintptr_t) (*openedFile, C.int) {
+	if handle == 0 {
+		return nil, fail(errInvalid("invalid handle"))
+	}
+	return cgo.Handle(handle).Value().(*openedFile), C.PIXI_OK
+}
+
+func lookupLayer(handle C.uintptr_t, layer C.int) (*pixi.Layer, C.int) {
+	file, status := lookup(handle)
+	if file == nil {
+		return nil, status
+	}
+	if layer < 0 || int(layer) >= len(file.summary.Layers) {
+		return nil, fail(errInvalid("layer index out of range"))
+	}
+	return file.summary.Layers[layer], C.PIXI_OK
+}
+
+// Converts the start and end arrays of a region in a layer to sample coordinates.
+func coordinates(file *openedFile, layer C.int, start *C.int64_t, end *C.int64_t) (pixi.SampleCoordinate, pixi.SampleCoordinate, bool) {
+	if layer < 0 || int(layer) >= len(file.summary.Layers) || start == nil || end == nil {
+		return nil, nil, false
+	}
+	dims := len(file.summary.Layers[layer].Dimensions)
+	startCoord := make(pixi.SampleCoordinate, dims)
+	endCoord := make(pixi.SampleCoordinate, dims)
+	for i, v := range unsafe.Slice(start, dims) {
+		startCoord[i] = int(v)
+	}
+	for i, v := range unsafe.Slice(end, dims) {
+		endCoord[i] = int(v)
+	}
+	return startCoord, endCoord, true
+}
+
+// Copies a string into a C buffer of the given size, truncated and NUL terminated, returning its length.
+func copyString(s string, buf *C.char, size C.size_t) C.int {
+	if buf != nil && size > 0 {
+		dst := unsafe.Slice((*byte)(unsafe.Pointer(buf)), int(size))
+		n := copy(dst[:len(dst)-1], s)
+		dst[n] = 0
+	}
+	return C.int(len(s))
+}
+
+// Records an error as the most recent failure and returns its status code.
+func fail(err error) C.int {
+	return C.int(setLastError(err))
+}
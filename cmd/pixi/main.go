@@ -0,0 +1,12 @@
+// Pixi inspects, converts, and checks Pixi files. Run 'pixi help' for the list of commands.
+package main
+
+import (
+	"os"
+
+	"github.com/owlpinetech/pixi/internal/command"
+)
+
+func main() {
+	command.Main("pixi", os.Args[1:])
+}
@@ -0,0 +1,13 @@
+// Pixifsck checks, and optionally repairs, a Pixi file. It is kept for compatibility with existing
+// scripts and behaves exactly like 'pixi verify'.
+package main
+
+import (
+	"os"
+
+	"github.com/owlpinetech/pixi/internal/command"
+)
+
+func main() {
+	command.Verify.Run("pixifsck", os.Args[1:])
+}
@@ -0,0 +1,13 @@
+// Pixiswab rewrites a Pixi file in a different byte order. It is kept for compatibility with existing
+// scripts and behaves exactly like 'pixi swab'.
+package main
+
+import (
+	"os"
+
+	"github.com/owlpinetech/pixi/internal/command"
+)
+
+func main() {
+	command.Swab.Run("pixiswab", os.Args[1:])
+}
@@ -0,0 +1,69 @@
+package colorext
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestRGBModel(t *testing.T) {
+	cases := []struct {
+		in  color.Color
+		out RGB
+	}{
+		{color.NRGBA{R: 10, G: 20, B: 30, A: 255}, RGB{10, 20, 30}},
+		{color.RGBA{R: 50, G: 0, B: 100, A: 128}, RGB{50, 0, 100}},
+		{color.Gray{Y: 77}, RGB{77, 77, 77}},
+		{RGB{1, 2, 3}, RGB{1, 2, 3}},
+	}
+	for _, c := range cases {
+		if got := RGBModel.Convert(c.in); got != c.out {
+			t.Errorf("expected %v to convert to %v, got %v", c.in, c.out, got)
+		}
+	}
+	if r, g, b, a := (RGB{255, 0, 128}).RGBA(); r != 0xffff || g != 0 || b != 0x8080 || a != 0xffff {
+		t.Errorf("unexpected RGBA values %d %d %d %d", r, g, b, a)
+	}
+}
+
+func TestGray32f(t *testing.T) {
+	cases := []struct {
+		in  Gray32f
+		out uint32
+	}{
+		{Gray32f{0}, 0},
+		{Gray32f{1}, 0xffff},
+		{Gray32f{0.5}, 0x8000},
+		{Gray32f{-3}, 0},
+		{Gray32f{12}, 0xffff},
+		{Gray32f{float32(math.NaN())}, 0},
+	}
+	for _, c := range cases {
+		r, g, b, a := c.in.RGBA()
+		if r != c.out || g != c.out || b != c.out || a != 0xffff {
+			t.Errorf("expected %v to be gray %d, got %d %d %d %d", c.in, c.out, r, g, b, a)
+		}
+	}
+	if got := Gray32fModel.Convert(color.Gray16{Y: 0xffff}); got != (Gray32f{1}) {
+		t.Errorf("expected white to convert to 1, got %v", got)
+	}
+}
+
+func TestImagesSetAt(t *testing.T) {
+	bounds := image.Rect(-2, 3, 4, 7)
+	rgb := NewRGBImage(bounds)
+	rgb.Set(-2, 3, color.NRGBA{R: 9, G: 8, B: 7, A: 255})
+	rgb.SetRGB(3, 6, RGB{1, 2, 3})
+	rgb.SetRGB(4, 6, RGB{4, 5, 6}) // outside, ignored
+	if rgb.RGBAt(-2, 3) != (RGB{9, 8, 7}) || rgb.RGBAt(3, 6) != (RGB{1, 2, 3}) || rgb.RGBAt(4, 6) != (RGB{}) {
+		t.Errorf("unexpected RGB image contents %v", rgb.Pix)
+	}
+
+	gray := NewGray32fImage(bounds)
+	gray.SetGray32f(0, 4, Gray32f{2.5})
+	gray.Set(1, 4, color.Gray16{Y: 0})
+	if gray.Gray32fAt(0, 4) != (Gray32f{2.5}) || gray.Gray32fAt(1, 4) != (Gray32f{0}) || gray.Gray32fAt(10, 10) != (Gray32f{}) {
+		t.Errorf("unexpected Gray32f image contents %v", gray.Pix)
+	}
+}
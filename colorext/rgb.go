@@ -0,0 +1,94 @@
+// Package colorext provides color models and in-memory images missing from the standard library's
+// image and image/color packages, for converting data stored in Pixi files to and from images.
+package colorext
+
+import (
+	"image"
+	"image/color"
+)
+
+// An opaque 24-bit color, with 8 bits for each of red, green, and blue and no alpha channel.
+type RGB struct {
+	R, G, B uint8
+}
+
+func (c RGB) RGBA() (r, g, b, a uint32) {
+	r = uint32(c.R)
+	r |= r << 8
+	g = uint32(c.G)
+	g |= g << 8
+	b = uint32(c.B)
+	b |= b << 8
+	return r, g, b, 0xffff
+}
+
+// The color model for RGB colors. Transparent colors are converted as if composited over black.
+var RGBModel color.Model = color.ModelFunc(rgbModel)
+
+func rgbModel(c color.Color) color.Color {
+	if _, ok := c.(RGB); ok {
+		return c
+	}
+	r, g, b, _ := c.RGBA()
+	return RGB{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8)}
+}
+
+// An in-memory image of RGB colors, with three bytes per pixel.
+type RGBImage struct {
+	// The pixels of the image, in R, G, B order, starting at the top left corner.
+	Pix []uint8
+	// The distance in bytes between vertically adjacent pixels.
+	Stride int
+	// The bounds of the image.
+	Rect image.Rectangle
+}
+
+// Creates an RGB image of the given bounds, with every pixel black.
+func NewRGBImage(r image.Rectangle) *RGBImage {
+	return &RGBImage{
+		Pix:    make([]uint8, 3*r.Dx()*r.Dy()),
+		Stride: 3 * r.Dx(),
+		Rect:   r,
+	}
+}
+
+func (p *RGBImage) ColorModel() color.Model {
+	return RGBModel
+}
+
+func (p *RGBImage) Bounds() image.Rectangle {
+	return p.Rect
+}
+
+func (p *RGBImage) At(x, y int) color.Color {
+	return p.RGBAt(x, y)
+}
+
+// The color of the pixel at the given position, or black if the position is outside the image.
+func (p *RGBImage) RGBAt(x, y int) RGB {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return RGB{}
+	}
+	i := p.PixOffset(x, y)
+	s := p.Pix[i : i+3 : i+3]
+	return RGB{s[0], s[1], s[2]}
+}
+
+// The index of the first byte of the pixel at the given position in Pix.
+func (p *RGBImage) PixOffset(x, y int) int {
+	return (y-p.Rect.Min.Y)*p.Stride + (x-p.Rect.Min.X)*3
+}
+
+func (p *RGBImage) Set(x, y int, c color.Color) {
+	p.SetRGB(x, y, RGBModel.Convert(c).(RGB))
+}
+
+// Sets the color of the pixel at the given position. Positions outside the image are ignored.
+func (p *RGBImage) SetRGB(x, y int, c RGB) {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return
+	}
+	i := p.PixOffset(x, y)
+	s := p.Pix[i : i+3 : i+3]
+	s[0], s[1], s[2] = c.R, c.G, c.B
+}
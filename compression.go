@@ -5,6 +5,11 @@ import (
 	"compress/flate"
 	"compress/lzw"
 	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 )
 
 // Represents the compression method used to shrink the data persisted to a layer in a Pixi file.
@@ -15,8 +20,33 @@ const (
 	CompressionFlate  Compression = 1 // Standard FLATE compression
 	CompressionLzwLsb Compression = 2 // Least-significant-bit Lempel-Ziv-Welch compression from Go standard lib
 	CompressionLzwMsb Compression = 3 // Most-significant-bit Lempel-Ziv-Welch compression from Go standard lib
+	CompressionAuto   Compression = 4 // Each tile chooses its own method, named by a byte before its data
 )
 
+// Chunks smaller than this are stored uncompressed by CompressionAuto, since what little compression
+// could save is outweighed by the cost of decompressing.
+const autoMinBytes = 64
+
+// Chunks whose bytes carry more bits of information each than this are stored uncompressed by
+// CompressionAuto, since compressing them would save next to nothing.
+const autoMaxEntropy = 7.5
+
+// Returns every compression method this version of the library can read and write, in order of
+// their identifiers.
+func SupportedCompressions() []Compression {
+	return []Compression{CompressionNone, CompressionFlate, CompressionLzwLsb, CompressionLzwMsb, CompressionAuto}
+}
+
+// Finds the compression method with the given name (as returned by String) or numeric identifier.
+func ParseCompression(name string) (Compression, error) {
+	for _, c := range SupportedCompressions() {
+		if strings.EqualFold(name, c.String()) || name == strconv.Itoa(int(c)) {
+			return c, nil
+		}
+	}
+	return CompressionNone, UnsupportedError("unknown compression '" + name + "'")
+}
+
 func (c Compression) String() string {
 	switch c {
 	case CompressionNone:
@@ -27,6 +57,8 @@ func (c Compression) String() string {
 		return "lzw_lsb"
 	case CompressionLzwMsb:
 		return "lzw_msb"
+	case CompressionAuto:
+		return "auto"
 	default:
 		return "unknown"
 	}
@@ -83,39 +115,128 @@ func (c Compression) WriteChunk(w io.Writer, chunk []byte) (int, error) {
 		lzwWriter.Close()
 		writeAmt, err := io.Copy(w, buf)
 		return int(writeAmt), err
+	case CompressionAuto:
+		chosen := chooseCompression(chunk)
+		buf := bytes.NewBuffer([]byte{byte(chosen)})
+		_, err := chosen.WriteChunk(buf, chunk)
+		if err != nil {
+			return 0, err
+		}
+		// the estimate can be wrong, and data that did not shrink is better stored as it is
+		if chosen != CompressionNone && buf.Len() > len(chunk) {
+			buf.Reset()
+			buf.WriteByte(byte(CompressionNone))
+			buf.Write(chunk)
+		}
+		writeAmt, err := io.Copy(w, buf)
+		return int(writeAmt), err
 	default:
 		return 0, UnsupportedError("unknown compression")
 	}
 }
 
+// Picks the method a chunk is stored with by CompressionAuto, from a quick estimate of how well its data
+// would compress: the entropy of the distribution of its bytes. Flat or repetitive data, such as tiles
+// of open ocean or of missing values, is compressed with flate, while noisy or already dense data, for
+// which compressing would only slow down reading, is stored uncompressed.
+func chooseCompression(chunk []byte) Compression {
+	if len(chunk) < autoMinBytes {
+		return CompressionNone
+	}
+	var counts [256]int
+	for _, b := range chunk {
+		counts[b]++
+	}
+	entropy := 0.0
+	for _, count := range counts {
+		if count > 0 {
+			p := float64(count) / float64(len(chunk))
+			entropy -= p * math.Log2(p)
+		}
+	}
+	if entropy > autoMaxEntropy {
+		return CompressionNone
+	}
+	return CompressionFlate
+}
+
 // Reads a compressed chunk of data into the given slice which must be the size of the desired
-// uncompressed data. Returns the number of bytes read or and error if the read failed.
+// uncompressed data. The data is decompressed straight into the slice, without passing through an
+// intermediate buffer. Returns the number of bytes the chunk decompressed to, which is more than the
+// length of the slice if the chunk holds more data than it has room for (the rest is discarded), or an
+// error if the read failed.
 func (c Compression) ReadChunk(r io.Reader, chunk []byte) (int, error) {
 	switch c {
 	case CompressionNone:
-		return r.Read(chunk)
+		return io.ReadFull(r, chunk)
 	case CompressionFlate:
-		bufRd := bytes.NewBuffer(chunk[:0])
-		flateRdr := flate.NewReader(r)
-		defer flateRdr.Close()
-		amtRd, err := io.Copy(bufRd, flateRdr)
-		copy(chunk, bufRd.Bytes())
-		return int(amtRd), err
-	case CompressionLzwLsb:
-		bufRd := bytes.NewBuffer(chunk[:0])
-		lzwRdr := lzw.NewReader(r, lzw.LSB, 8)
-		defer lzwRdr.Close()
-		amtRd, err := io.Copy(bufRd, lzwRdr)
-		copy(chunk, bufRd.Bytes())
-		return int(amtRd), err
-	case CompressionLzwMsb:
-		bufRd := bytes.NewBuffer(chunk[:0])
-		lzwRdr := lzw.NewReader(r, lzw.MSB, 8)
-		defer lzwRdr.Close()
-		amtRd, err := io.Copy(bufRd, lzwRdr)
-		copy(chunk, bufRd.Bytes())
-		return int(amtRd), err
+		flateRdr := flateReaders.Get().(io.ReadCloser)
+		if err := flateRdr.(flate.Resetter).Reset(r, nil); err != nil {
+			return 0, err
+		}
+		defer func() {
+			flateRdr.Close()
+			flateReaders.Put(flateRdr)
+		}()
+		return readDecompressed(flateRdr, chunk)
+	case CompressionLzwLsb, CompressionLzwMsb:
+		order := lzw.LSB
+		if c == CompressionLzwMsb {
+			order = lzw.MSB
+		}
+		lzwRdr := lzwReaders.Get().(*lzw.Reader)
+		lzwRdr.Reset(r, order, 8)
+		defer func() {
+			lzwRdr.Close()
+			lzwReaders.Put(lzwRdr)
+		}()
+		return readDecompressed(lzwRdr, chunk)
+	case CompressionAuto:
+		chosen, err := readAutoCompression(r)
+		if err != nil {
+			return 0, err
+		}
+		return chosen.ReadChunk(r, chunk)
 	default:
 		return 0, UnsupportedError("unknown compression")
 	}
 }
+
+// Reads the byte naming the method a chunk stored with CompressionAuto was compressed with.
+func readAutoCompression(r io.Reader) (Compression, error) {
+	var method [1]byte
+	_, err := io.ReadFull(r, method[:])
+	if err != nil {
+		return CompressionNone, err
+	}
+	chosen := Compression(method[0])
+	if chosen == CompressionAuto || !slices.Contains(SupportedCompressions(), chosen) {
+		return CompressionNone, FormatError("unknown compression " + strconv.Itoa(int(chosen)) + " chosen for an automatically compressed chunk")
+	}
+	return chosen, nil
+}
+
+// Decompressors are large enough that allocating a new one for every chunk shows up when reading many
+// small tiles, so they are reset and reused instead.
+var (
+	flateReaders = sync.Pool{New: func() any { return flate.NewReader(bytes.NewReader(nil)) }}
+	lzwReaders   = sync.Pool{New: func() any { return lzw.NewReader(bytes.NewReader(nil), lzw.LSB, 8).(*lzw.Reader) }}
+)
+
+// Fills the chunk from the decompressor, then drains whatever follows it to count the full size of the
+// decompressed data. Data ending before the chunk is full is not an error, only a short count.
+func readDecompressed(rdr io.Reader, chunk []byte) (int, error) {
+	// not io.ReadFull, which would hide the io.ErrUnexpectedEOF decompressors return for truncated data
+	n := 0
+	for n < len(chunk) {
+		amt, err := rdr.Read(chunk[n:])
+		n += amt
+		if err == io.EOF {
+			return n, nil
+		} else if err != nil {
+			return n, err
+		}
+	}
+	extra, err := io.Copy(io.Discard, rdr)
+	return n + int(extra), err
+}
@@ -2,9 +2,15 @@ package pixi
 
 import (
 	"bytes"
+	"encoding/binary"
+	"io"
 	"math/rand/v2"
 	"slices"
+	"strconv"
+	"strings"
 	"testing"
+
+	"github.com/owlpinetech/pixi/internal/buffer"
 )
 
 func TestFlateCompressionWriteRead(t *testing.T) {
@@ -105,3 +111,146 @@ func TestLzwMsbCompressionWriteRead(t *testing.T) {
 		}
 	}
 }
+
+func TestParseCompression(t *testing.T) {
+	for _, c := range SupportedCompressions() {
+		parsed, err := ParseCompression(strings.ToUpper(c.String()))
+		if err != nil || parsed != c {
+			t.Errorf("expected name %s to parse to %v, got %v (%v)", c.String(), c, parsed, err)
+		}
+		parsed, err = ParseCompression(strconv.Itoa(int(c)))
+		if err != nil || parsed != c {
+			t.Errorf("expected id %d to parse to %v, got %v (%v)", c, c, parsed, err)
+		}
+	}
+	if _, err := ParseCompression("zstd"); err == nil {
+		t.Error("expected an error for an unknown compression")
+	}
+}
+
+func TestCompressionReadChunkSizes(t *testing.T) {
+	chunk := make([]byte, 300)
+	for i := range chunk {
+		chunk[i] = byte(i % 7)
+	}
+	// uncompressed chunks have no end of their own, so only compressed chunks can be larger or smaller
+	for _, c := range SupportedCompressions()[1:] {
+		buf := bytes.NewBuffer([]byte{})
+		if _, err := c.WriteChunk(buf, chunk); err != nil {
+			t.Fatal(err)
+		}
+
+		// a chunk with more data than asked for reports its whole size, keeping what fits
+		short := make([]byte, 100)
+		amtRcv, err := c.ReadChunk(bytes.NewReader(buf.Bytes()), short)
+		if err != nil || amtRcv != len(chunk) || !slices.Equal(short, chunk[:100]) {
+			t.Errorf("%v: expected %d bytes with the first 100 kept, got %d (%v)", c, len(chunk), amtRcv, err)
+		}
+
+		// a chunk with less data than asked for reports only what it has
+		long := make([]byte, 400)
+		amtRcv, err = c.ReadChunk(bytes.NewReader(buf.Bytes()), long)
+		if err != nil || amtRcv != len(chunk) || !slices.Equal(long[:len(chunk)], chunk) {
+			t.Errorf("%v: expected %d bytes, got %d (%v)", c, len(chunk), amtRcv, err)
+		}
+
+		// a truncated chunk is an error rather than a short read
+		_, err = c.ReadChunk(bytes.NewReader(buf.Bytes()[:buf.Len()/2]), make([]byte, len(chunk)))
+		if err == nil {
+			t.Errorf("%v: expected an error reading a truncated chunk", c)
+		}
+	}
+}
+
+func BenchmarkCompressionReadChunk(b *testing.B) {
+	chunk := make([]byte, 64<<10)
+	for i := range chunk {
+		chunk[i] = byte(i / 64)
+	}
+	for _, c := range SupportedCompressions() {
+		buf := bytes.NewBuffer([]byte{})
+		if _, err := c.WriteChunk(buf, chunk); err != nil {
+			b.Fatal(err)
+		}
+		b.Run(c.String(), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(chunk)))
+			data := make([]byte, len(chunk))
+			for range b.N {
+				if _, err := c.ReadChunk(bytes.NewReader(buf.Bytes()), data); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestCompressionAutoChoosesPerChunk(t *testing.T) {
+	flat := make([]byte, 4096)
+	noisy := make([]byte, 4096)
+	for i := range noisy {
+		noisy[i] = byte(rand.IntN(256))
+	}
+	cases := []struct {
+		name   string
+		chunk  []byte
+		expect Compression
+	}{
+		{"flat", flat, CompressionFlate},
+		{"noisy", noisy, CompressionNone},
+		{"tiny", []byte{1, 1, 1, 1}, CompressionNone},
+	}
+	for _, tc := range cases {
+		buf := bytes.NewBuffer([]byte{})
+		n, err := CompressionAuto.WriteChunk(buf, tc.chunk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != buf.Len() || Compression(buf.Bytes()[0]) != tc.expect {
+			t.Errorf("%s: expected %v to be chosen, got %v", tc.name, tc.expect, Compression(buf.Bytes()[0]))
+		}
+		data := make([]byte, len(tc.chunk))
+		amtRcv, err := CompressionAuto.ReadChunk(bytes.NewReader(buf.Bytes()), data)
+		if err != nil || amtRcv != len(tc.chunk) || !slices.Equal(data, tc.chunk) {
+			t.Errorf("%s: expected the chunk to read back, got %d bytes (%v)", tc.name, amtRcv, err)
+		}
+	}
+	if n, _ := CompressionAuto.WriteChunk(io.Discard, flat); n > len(flat)/10 {
+		t.Errorf("expected a flat chunk to shrink, got %d bytes", n)
+	}
+
+	if _, err := CompressionAuto.ReadChunk(bytes.NewReader([]byte{byte(CompressionAuto), 0}), make([]byte, 1)); err == nil {
+		t.Error("expected a chunk naming auto compression as its own method to be refused")
+	}
+}
+
+func TestLayerTileCompressionAuto(t *testing.T) {
+	header := PixiHeader{Version: Version, OffsetSize: 4, ByteOrder: binary.LittleEndian}
+	layer := NewLayer("mixed", false, CompressionAuto,
+		DimensionSet{{Name: "x", Size: 64, TileSize: 32}, {Name: "y", Size: 32, TileSize: 32}},
+		[]Field{{Name: "v", Type: FieldUint16}})
+	ocean := make([]byte, layer.DiskTileSize(0))
+	land := make([]byte, layer.DiskTileSize(1))
+	for i := range land {
+		land[i] = byte(rand.IntN(256))
+	}
+	buf := buffer.NewBuffer(10)
+	writeSingleLayerPixi(t, buf, header, nil, layer, [][]byte{ocean, land})
+
+	summary, err := ReadPixi(buffer.NewBufferFrom(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := summary.Layers[0]
+	for tileIndex, want := range []Compression{CompressionFlate, CompressionNone} {
+		got, err := read.TileCompression(buffer.NewBufferFrom(buf.Bytes()), tileIndex)
+		if err != nil || got != want {
+			t.Errorf("expected tile %d to be stored with %v, got %v (%v)", tileIndex, want, got, err)
+		}
+		data := make([]byte, read.DiskTileSize(tileIndex))
+		err = read.ReadTile(buffer.NewBufferFrom(buf.Bytes()), summary.Header, tileIndex, data)
+		if err != nil || !slices.Equal(data, [][]byte{ocean, land}[tileIndex]) {
+			t.Errorf("expected tile %d to read back, got %v", tileIndex, err)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+// Package config loads the defaults shared by the pixi command line tools and by programs that use the
+// library, so that settings like the compression and tile size used for new files do not need to be
+// passed to every invocation.
+//
+// Defaults are read first from a config file and then from environment variables, which take precedence.
+// The config file is found at $PIXI_CONFIG if set, or otherwise at pixi/config under the user
+// configuration directory (usually ~/.config/pixi/config). Each non-blank line of the file is a
+// key = value pair, and lines starting with # are comments:
+//
+//	compression = flate
+//	tile-size = 512
+//	workers = 8
+//
+// Every key can also be set with an environment variable named PIXI_ followed by the key in upper case,
+// with dashes replaced by underscores, such as PIXI_TILE_SIZE.
+package config
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/owlpinetech/pixi"
+)
+
+// The environment variable that overrides the location of the config file.
+const PathEnv = "PIXI_CONFIG"
+
+// Default settings for reading and writing Pixi files.
+type Options struct {
+	Compression      pixi.Compression // The compression used for layers of new files.
+	TileSize         int              // The size of each tile dimension of new layers, or 0 to choose one automatically.
+	CacheTiles       int              // The maximum number of tiles held in memory by each tile cache.
+	CacheBytes       int64            // The maximum number of bytes held in memory by shared tile cache pools.
+	MemoryBudget     int64            // The maximum number of bytes of tile data held by an operation, or 0 for no limit.
+	Workers          int              // The number of goroutines used by operations that work in parallel.
+	WaitForLock      bool             // Whether tools wait for another process to release a file they write, instead of failing.
+	HTTPUser         string           // The user name for basic authentication when reading files over HTTP.
+	HTTPPassword     string           // The password for basic authentication when reading files over HTTP.
+	HTTPToken        string           // The bearer token sent when reading files over HTTP, used instead of basic authentication.
+	HTTPBandwidth    int64            // The most bytes per second read from files over HTTP by a tool, or 0 for no limit.
+	HTTPRequestRate  int              // The most requests per second made to HTTP servers by a tool, or 0 for no limit.
+	ProcessingReport bool             // Whether tools append a tag section to the files they write reporting the throughput of the run.
+}
+
+// Returns the settings used when neither the config file nor the environment sets them.
+func Defaults() Options {
+	return Options{
+		Compression: pixi.CompressionNone,
+		TileSize:    0,
+		CacheTiles:  16,
+		CacheBytes:  256 << 20,
+		Workers:     runtime.GOMAXPROCS(0),
+	}
+}
+
+// An error in a config file or environment variable, identifying where the bad setting came from.
+type Error struct {
+	Source string // The config file and line, or the environment variable, of the setting.
+	Err    error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("config: %s: %v", e.Source, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// The keys that can be set, each with the function that parses its value into the options.
+var settings = map[string]func(o *Options, value string) error{
+	"compression": func(o *Options, value string) error {
+		c, err := pixi.ParseCompression(value)
+		o.Compression = c
+		return err
+	},
+	"tile-size": func(o *Options, value string) error {
+		return parseNonNegative(value, &o.TileSize)
+	},
+	"cache-tiles": func(o *Options, value string) error {
+		return parseNonNegative(value, &o.CacheTiles)
+	},
+	"cache-bytes": func(o *Options, value string) error {
+		return parseNonNegative64(value, &o.CacheBytes)
+	},
+	"memory-budget": func(o *Options, value string) error {
+		return parseNonNegative64(value, &o.MemoryBudget)
+	},
+	"workers": func(o *Options, value string) error {
+		return parseNonNegative(value, &o.Workers)
+	},
+	"wait-for-lock": func(o *Options, value string) error {
+		v, err := strconv.ParseBool(value)
+		o.WaitForLock = v
+		return err
+	},
+	"http-user": func(o *Options, value string) error {
+		o.HTTPUser = value
+		return nil
+	},
+	"http-password": func(o *Options, value string) error {
+		o.HTTPPassword = value
+		return nil
+	},
+	"http-token": func(o *Options, value string) error {
+		o.HTTPToken = value
+		return nil
+	},
+	"http-bandwidth": func(o *Options, value string) error {
+		return parseNonNegative64(value, &o.HTTPBandwidth)
+	},
+	"http-request-rate": func(o *Options, value string) error {
+		return parseNonNegative(value, &o.HTTPRequestRate)
+	},
+	"processing-report": func(o *Options, value string) error {
+		v, err := strconv.ParseBool(value)
+		o.ProcessingReport = v
+		return err
+	},
+}
+
+func parseNonNegative(value string, dst *int) error {
+	v, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+	if v < 0 {
+		return errors.New("must not be negative")
+	}
+	*dst = v
+	return nil
+}
+
+func parseNonNegative64(value string, dst *int64) error {
+	v, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return err
+	}
+	if v < 0 {
+		return errors.New("must not be negative")
+	}
+	*dst = v
+	return nil
+}
+
+// Sets the option with the given key, such as "tile-size", from its textual value.
+func (o *Options) Set(key string, value string) error {
+	set, found := settings[key]
+	if !found {
+		return fmt.Errorf("unknown setting '%s'", key)
+	}
+	return set(o, value)
+}
+
+// Returns the path of the config file: $PIXI_CONFIG if set, or pixi/config in the user configuration
+// directory otherwise.
+func Path() (string, error) {
+	if path := os.Getenv(PathEnv); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "pixi", "config"), nil
+}
+
+// Loads the defaults, then the settings in the config file (if there is one), then the settings in
+// the environment.
+func Load() (Options, error) {
+	opts := Defaults()
+	path, err := Path()
+	if err == nil {
+		err = opts.ReadFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			err = nil
+		}
+	} else {
+		// with no home directory there is no config file to read, but the environment still applies
+		err = nil
+	}
+	if err != nil {
+		return opts, err
+	}
+	return opts, opts.ReadEnv(os.LookupEnv)
+}
+
+// Applies the settings in the config file with the given name.
+func (o *Options) ReadFile(name string) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return o.Read(file, name)
+}
+
+// Applies the settings read from r, in the config file format. The name identifies the source of the
+// settings in errors.
+func (o *Options) Read(r io.Reader, name string) error {
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, found := strings.Cut(line, "=")
+		source := fmt.Sprintf("%s:%d", name, lineNum)
+		if !found {
+			return &Error{Source: source, Err: errors.New("expected key = value")}
+		}
+		err := o.Set(strings.TrimSpace(key), strings.TrimSpace(value))
+		if err != nil {
+			return &Error{Source: source, Err: err}
+		}
+	}
+	return scanner.Err()
+}
+
+// Applies the settings found in environment variables, looked up with the given function (usually
+// os.LookupEnv).
+func (o *Options) ReadEnv(lookup func(string) (string, bool)) error {
+	for _, key := range Keys() {
+		name := EnvName(key)
+		value, found := lookup(name)
+		if !found {
+			continue
+		}
+		err := o.Set(key, strings.TrimSpace(value))
+		if err != nil {
+			return &Error{Source: name, Err: err}
+		}
+	}
+	return nil
+}
+
+// Returns every key that can be set, in the order they are applied from the environment.
+func Keys() []string {
+	return []string{"compression", "tile-size", "cache-tiles", "cache-bytes", "memory-budget", "workers", "wait-for-lock", "http-user", "http-password", "http-token", "http-bandwidth", "http-request-rate", "processing-report"}
+}
+
+// Returns the name of the environment variable that sets the given key.
+func EnvName(key string) string {
+	return "PIXI_" + strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
+}
@@ -0,0 +1,133 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/owlpinetech/pixi"
+)
+
+func TestReadConfigFile(t *testing.T) {
+	file := `
+# defaults shared by every tool
+compression = lzw_msb
+tile-size=256
+  cache-tiles = 4
+cache-bytes = 1048576
+memory-budget = 67108864
+workers = 3
+wait-for-lock = true
+http-user = reader
+http-token = abc=def
+http-bandwidth = 1048576
+http-request-rate = 20
+processing-report = true
+`
+	opts := Defaults()
+	err := opts.Read(strings.NewReader(file), "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Options{
+		Compression:      pixi.CompressionLzwMsb,
+		TileSize:         256,
+		CacheTiles:       4,
+		CacheBytes:       1 << 20,
+		MemoryBudget:     64 << 20,
+		Workers:          3,
+		WaitForLock:      true,
+		HTTPUser:         "reader",
+		HTTPToken:        "abc=def",
+		HTTPBandwidth:    1 << 20,
+		HTTPRequestRate:  20,
+		ProcessingReport: true,
+	}
+	if opts != want {
+		t.Errorf("expected %+v, got %+v", want, opts)
+	}
+}
+
+func TestReadConfigErrors(t *testing.T) {
+	cases := []struct {
+		name   string
+		file   string
+		source string
+	}{
+		{"missing value", "compression = flate\ntile-size\n", "config:2"},
+		{"unknown key", "colour = blue\n", "config:1"},
+		{"bad number", "workers = many\n", "config:1"},
+		{"negative", "\ncache-tiles = -1\n", "config:2"},
+		{"bad compression", "compression = zstd\n", "config:1"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			opts := Defaults()
+			err := opts.Read(strings.NewReader(c.file), "config")
+			var configErr *Error
+			if !errors.As(err, &configErr) {
+				t.Fatalf("expected a config error, got %v", err)
+			}
+			if configErr.Source != c.source {
+				t.Errorf("expected error at %s, got %s", c.source, configErr.Source)
+			}
+		})
+	}
+}
+
+func TestEnvOverridesFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config")
+	err := os.WriteFile(path, []byte("tile-size = 128\nworkers = 2\ncompression = flate\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(PathEnv, path)
+	t.Setenv("PIXI_TILE_SIZE", "64")
+	t.Setenv("PIXI_HTTP_PASSWORD", "secret")
+
+	opts, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.TileSize != 64 {
+		t.Errorf("expected the environment tile size 64, got %d", opts.TileSize)
+	}
+	if opts.Workers != 2 || opts.Compression != pixi.CompressionFlate {
+		t.Errorf("expected the file settings to apply, got %+v", opts)
+	}
+	if opts.HTTPPassword != "secret" {
+		t.Errorf("expected the password from the environment, got %q", opts.HTTPPassword)
+	}
+
+	t.Setenv("PIXI_WORKERS", "lots")
+	_, err = Load()
+	var configErr *Error
+	if !errors.As(err, &configErr) || configErr.Source != "PIXI_WORKERS" {
+		t.Errorf("expected an error naming PIXI_WORKERS, got %v", err)
+	}
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	t.Setenv(PathEnv, filepath.Join(t.TempDir(), "absent"))
+	opts, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts != Defaults() {
+		t.Errorf("expected the defaults without a config file, got %+v", opts)
+	}
+}
+
+func TestKeysMatchSettings(t *testing.T) {
+	if len(Keys()) != len(settings) {
+		t.Fatalf("expected %d keys, got %d", len(settings), len(Keys()))
+	}
+	for _, key := range Keys() {
+		if _, found := settings[key]; !found {
+			t.Errorf("key %s has no setting", key)
+		}
+	}
+}
@@ -0,0 +1,295 @@
+package pixi
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+const (
+	ContainerFileType string = "pixc" // Every multi-dataset container starts with these four bytes.
+	ContainerVersion  int    = 1      // The version of the container directory layout.
+)
+
+// A single logically independent Pixi dataset stored within a container file. The dataset is a complete
+// Pixi stream (header, tags, and layers) whose offsets are relative to the start of the dataset rather
+// than the start of the container.
+type ContainerEntry struct {
+	Name   string // The name used to look up the dataset within the container.
+	Offset int64  // The byte-index offset of the dataset from the start of the container file.
+	Size   int64  // The number of bytes occupied by the dataset.
+}
+
+// A directory of Pixi datasets packed into a single physical file, so that a product made of several
+// independent datasets can be distributed as one file. The directory is found at the start of the file,
+// and each dataset follows it in the order listed.
+type Container struct {
+	OffsetSize int              // The size of offsets in the directory, either 4 or 8 bytes.
+	ByteOrder  binary.ByteOrder // The byte order of multi-byte values in the directory.
+	Entries    []ContainerEntry // The datasets stored in the container.
+}
+
+// A dataset to be packed into a container. The write function is given a stream positioned at the start
+// of the dataset, with offsets relative to that start, and should write a complete Pixi file to it.
+type ContainerDataset struct {
+	Name  string
+	Write func(w io.WriteSeeker) error
+}
+
+func (c *Container) encodingHeader() PixiHeader {
+	return PixiHeader{Version: Version, OffsetSize: c.OffsetSize, ByteOrder: c.ByteOrder}
+}
+
+// Get the total number of bytes that will be occupied in the file by the container directory.
+func (c *Container) DirectorySize() int {
+	size := 4 + 2 + 1 + 1 + 4 // file type, version, offset size, byte order, entry count
+	for _, e := range c.Entries {
+		size += 2 + len([]byte(e.Name)) + 2*c.OffsetSize
+	}
+	return size
+}
+
+// Writes the container directory to the current position in the writer stream.
+func (c *Container) WriteDirectory(w io.Writer) error {
+	if c.OffsetSize != 4 && c.OffsetSize != 8 {
+		return FormatError("container offset size must be 4 or 8 bytes")
+	}
+	h := c.encodingHeader()
+
+	_, err := w.Write([]byte(ContainerFileType))
+	if err != nil {
+		return err
+	}
+	_, err = w.Write([]byte(fmt.Sprintf("%02d", ContainerVersion)))
+	if err != nil {
+		return err
+	}
+	byteOrderEnc := byte(0x00)
+	if c.ByteOrder == binary.BigEndian {
+		byteOrderEnc = byte(0xff)
+	}
+	_, err = w.Write([]byte{byte(c.OffsetSize), byteOrderEnc})
+	if err != nil {
+		return err
+	}
+
+	err = h.Write(w, uint32(len(c.Entries)))
+	if err != nil {
+		return err
+	}
+	for _, e := range c.Entries {
+		err = h.WriteFriendly(w, e.Name)
+		if err != nil {
+			return err
+		}
+		err = h.WriteOffset(w, e.Offset)
+		if err != nil {
+			return err
+		}
+		err = h.WriteOffset(w, e.Size)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reads a container directory from the current position in the reader stream.
+func (c *Container) ReadDirectory(r io.Reader) error {
+	buf := make([]byte, 4)
+	_, err := io.ReadFull(r, buf)
+	if err != nil {
+		return err
+	}
+	if string(buf) != ContainerFileType {
+		return FormatError("pixi container marker not found at start of file")
+	}
+
+	_, err = io.ReadFull(r, buf[0:2])
+	if err != nil {
+		return err
+	}
+	version, err := strconv.ParseInt(string(buf[0:2]), 10, 32)
+	if err != nil {
+		return err
+	}
+	if int(version) > ContainerVersion {
+		return FormatError("reader does not support this version of pixi container")
+	}
+
+	_, err = io.ReadFull(r, buf[0:2])
+	if err != nil {
+		return err
+	}
+	if buf[0] != 4 && buf[0] != 8 {
+		return FormatError("reader only supports offset sizes of 4 or 8 bytes")
+	}
+	c.OffsetSize = int(buf[0])
+	if buf[1] == 0x00 {
+		c.ByteOrder = binary.LittleEndian
+	} else if buf[1] == 0xff {
+		c.ByteOrder = binary.BigEndian
+	} else {
+		return FormatError("unsupported or invalid byte order specified")
+	}
+
+	h := c.encodingHeader()
+	var count uint32
+	err = h.Read(r, &count)
+	if err != nil {
+		return err
+	}
+	c.Entries = make([]ContainerEntry, count)
+	for i := range c.Entries {
+		c.Entries[i].Name, err = h.ReadFriendly(r)
+		if err != nil {
+			return err
+		}
+		c.Entries[i].Offset, err = h.ReadOffset(r)
+		if err != nil {
+			return err
+		}
+		c.Entries[i].Size, err = h.ReadOffset(r)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Writes a container holding the given datasets to the stream, which should be positioned at the
+// start of the file. Each dataset is written after the directory, in order, and the directory is
+// updated with the final offsets and sizes once all datasets have been written.
+func WriteContainer(w io.WriteSeeker, offsetSize int, byteOrder binary.ByteOrder, datasets ...ContainerDataset) (Container, error) {
+	container := Container{OffsetSize: offsetSize, ByteOrder: byteOrder, Entries: make([]ContainerEntry, len(datasets))}
+	for i, d := range datasets {
+		for _, prev := range datasets[:i] {
+			if prev.Name == d.Name {
+				return container, FormatError("duplicate dataset name in container: " + d.Name)
+			}
+		}
+		container.Entries[i].Name = d.Name
+	}
+
+	dirOffset, err := w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return container, err
+	}
+	err = container.WriteDirectory(w)
+	if err != nil {
+		return container, err
+	}
+
+	for i, d := range datasets {
+		start, err := w.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return container, err
+		}
+		err = d.Write(&offsetWriteSeeker{w: w, base: start})
+		if err != nil {
+			return container, err
+		}
+		end, err := w.Seek(0, io.SeekEnd)
+		if err != nil {
+			return container, err
+		}
+		container.Entries[i].Offset = start
+		container.Entries[i].Size = end - start
+	}
+
+	_, err = w.Seek(dirOffset, io.SeekStart)
+	if err != nil {
+		return container, err
+	}
+	err = container.WriteDirectory(w)
+	if err != nil {
+		return container, err
+	}
+	_, err = w.Seek(0, io.SeekEnd)
+	return container, err
+}
+
+// Reads the directory of a container file from the start of the stream.
+func ReadContainer(r io.ReadSeeker) (Container, error) {
+	container := Container{}
+	_, err := r.Seek(0, io.SeekStart)
+	if err != nil {
+		return container, err
+	}
+	err = container.ReadDirectory(r)
+	return container, err
+}
+
+// Opens the dataset with the given name in the container, returning a stream whose offsets are relative
+// to the start of the dataset (suitable for passing to any function expecting a Pixi stream) along with
+// the dataset's metadata.
+func (c *Container) OpenDataset(r io.ReadSeeker, name string) (io.ReadSeeker, Pixi, error) {
+	for _, e := range c.Entries {
+		if e.Name == name {
+			section := &sectionReadSeeker{r: r, base: e.Offset, size: e.Size}
+			pixi, err := ReadPixi(section)
+			return section, pixi, err
+		}
+	}
+	return nil, Pixi{}, FormatError("no dataset named '" + name + "' in container")
+}
+
+// Exposes a window of an underlying stream as if it were a complete stream starting at offset zero.
+type sectionReadSeeker struct {
+	r    io.ReadSeeker
+	base int64
+	size int64
+	pos  int64
+}
+
+func (s *sectionReadSeeker) Read(p []byte) (int, error) {
+	if s.pos >= s.size {
+		return 0, io.EOF
+	}
+	if remain := s.size - s.pos; int64(len(p)) > remain {
+		p = p[:remain]
+	}
+	_, err := s.r.Seek(s.base+s.pos, io.SeekStart)
+	if err != nil {
+		return 0, err
+	}
+	n, err := s.r.Read(p)
+	s.pos += int64(n)
+	return n, err
+}
+
+func (s *sectionReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += s.pos
+	case io.SeekEnd:
+		offset += s.size
+	default:
+		return 0, fmt.Errorf("pixi: invalid whence in section seek")
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("pixi: negative position in section seek")
+	}
+	s.pos = offset
+	return offset, nil
+}
+
+// Shifts all positions of an underlying stream so that the given base offset appears to be offset zero.
+type offsetWriteSeeker struct {
+	w    io.WriteSeeker
+	base int64
+}
+
+func (o *offsetWriteSeeker) Write(p []byte) (int, error) {
+	return o.w.Write(p)
+}
+
+func (o *offsetWriteSeeker) Seek(offset int64, whence int) (int64, error) {
+	if whence == io.SeekStart {
+		offset += o.base
+	}
+	pos, err := o.w.Seek(offset, whence)
+	return pos - o.base, err
+}
@@ -0,0 +1,82 @@
+package pixi
+
+import (
+	"encoding/binary"
+	"io"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/owlpinetech/pixi/internal/buffer"
+)
+
+func TestContainerWriteOpen(t *testing.T) {
+	for _, offsetSize := range []int{4, 8} {
+		demLayer := NewLayer("dem", false, CompressionFlate,
+			DimensionSet{{Name: "x", Size: 10, TileSize: 5}, {Name: "y", Size: 6, TileSize: 3}},
+			[]Field{{Name: "height", Type: FieldFloat32}})
+		demTiles := randomTiles(demLayer)
+		maskLayer := NewLayer("mask", true, CompressionNone,
+			DimensionSet{{Name: "x", Size: 4, TileSize: 4}},
+			[]Field{{Name: "a", Type: FieldUint8}, {Name: "b", Type: FieldUint16}})
+		maskTiles := randomTiles(maskLayer)
+
+		buf := buffer.NewBuffer(10)
+		container, err := WriteContainer(buf, offsetSize, binary.BigEndian,
+			ContainerDataset{Name: "dem", Write: func(w io.WriteSeeker) error {
+				header := PixiHeader{Version: Version, OffsetSize: 4, ByteOrder: binary.LittleEndian}
+				writeSingleLayerPixi(t, w, header, map[string]string{"product": "dem"}, demLayer, demTiles)
+				return nil
+			}},
+			ContainerDataset{Name: "mask", Write: func(w io.WriteSeeker) error {
+				header := PixiHeader{Version: Version, OffsetSize: 8, ByteOrder: binary.BigEndian, Checksum: ChecksumXxHash64}
+				writeSingleLayerPixi(t, w, header, map[string]string{"product": "mask"}, maskLayer, maskTiles)
+				return nil
+			}},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rdr := buffer.NewBufferFrom(buf.Bytes())
+		readContainer, err := ReadContainer(rdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(container, readContainer) {
+			t.Errorf("expected container %v, got %v", container, readContainer)
+		}
+
+		for _, tc := range []struct {
+			name  string
+			layer *Layer
+			tiles [][]byte
+		}{{"dem", demLayer, demTiles}, {"mask", maskLayer, maskTiles}} {
+			dataset, summary, err := readContainer.OpenDataset(rdr, tc.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if summary.Tags[0].Tags["product"] != tc.name {
+				t.Errorf("expected product tag %s, got %v", tc.name, summary.Tags[0].Tags)
+			}
+			if !reflect.DeepEqual(summary.Layers[0], tc.layer) {
+				t.Errorf("expected layer %v, got %v", tc.layer, summary.Layers[0])
+			}
+			for i := range tc.tiles {
+				rdTile := make([]byte, len(tc.tiles[i]))
+				err = summary.Layers[0].ReadTile(dataset, summary.Header, i, rdTile)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !slices.Equal(rdTile, tc.tiles[i]) {
+					t.Errorf("tile %d of dataset %s did not match", i, tc.name)
+				}
+			}
+		}
+
+		_, _, err = readContainer.OpenDataset(rdr, "missing")
+		if err == nil {
+			t.Error("expected error opening missing dataset")
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package pixi
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+)
+
+// The keys of the tags holding the content seal of a file, written by SealContent.
+const (
+	ContentHashTag = "content-sha256" // The hex SHA-256 hash of the sealed content of the file.
+	ContentSizeTag = "content-size"   // The number of bytes of sealed content, which is everything before the seal.
+)
+
+// Returned by VerifyContent for a file without a content seal.
+var ErrUnsealed = errors.New("pixi: file has no content seal")
+
+// Returned by VerifyContent when the content of a file does not match its seal, as for a truncated or
+// corrupted download, or a file modified after it was sealed.
+var ErrContentMismatch = errors.New("pixi: file content does not match its seal")
+
+// The size and SHA-256 hash of a span of bytes at the start of a file.
+type ContentDigest struct {
+	Size   int64
+	SHA256 [sha256.Size]byte
+}
+
+// Returns the hash in hex, as written to the ContentHashTag.
+func (d ContentDigest) String() string {
+	return hex.EncodeToString(d.SHA256[:])
+}
+
+// Returns a line in the format of sha256sum naming the file, so the digest can be published beside the
+// file and checked with standard tools.
+func (d ContentDigest) Sidecar(name string) string {
+	return d.String() + "  " + name + "\n"
+}
+
+// Computes the digest of the first size bytes of the stream, reading them in a single pass.
+func DigestContent(r io.ReadSeeker, size int64) (ContentDigest, error) {
+	_, err := r.Seek(0, io.SeekStart)
+	if err != nil {
+		return ContentDigest{}, err
+	}
+	hash := sha256.New()
+	_, err = io.CopyN(hash, r, size)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return ContentDigest{}, ErrContentMismatch
+		}
+		return ContentDigest{}, err
+	}
+	digest := ContentDigest{Size: size}
+	hash.Sum(digest.SHA256[:0])
+	return digest, nil
+}
+
+// Seals a finished file for publication: appends a tag section holding the size and SHA-256 hash of
+// everything before it, so that mirrors can check a download in one sequential pass with VerifyContent
+// instead of reading and checking every tile. The file must not be modified afterward, except to seal it
+// again, which replaces the seal in place if it is still the last thing in the file.
+//
+// The hash covers the file as it is once sealed: the offset linking the previous tag section (or the
+// header) to the seal is written before hashing, since it is simply the size of the content.
+func SealContent(f io.ReadWriteSeeker) (ContentDigest, error) {
+	var header PixiHeader
+	_, err := f.Seek(0, io.SeekStart)
+	if err != nil {
+		return ContentDigest{}, err
+	}
+	err = header.ReadHeader(f)
+	if err != nil {
+		return ContentDigest{}, err
+	}
+	chain, err := readTagChain(f, header, header.FirstTagsOffset)
+	if err != nil {
+		return ContentDigest{}, err
+	}
+	fileSize, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return ContentDigest{}, err
+	}
+
+	// an existing seal at the very end of the file is replaced rather than sealed over
+	if last := len(chain) - 1; last >= 0 && isSeal(chain[last].section) && chain[last].end == fileSize {
+		fileSize = chain[last].offset
+		chain = chain[:last]
+	}
+	contentSize := fileSize
+
+	// link the seal into the chain before hashing, so the hash covers the file as published
+	if len(chain) == 0 {
+		err = header.OverwriteOffsets(f, header.FirstLayerOffset, contentSize)
+	} else {
+		_, err = f.Seek(chain[len(chain)-1].end-int64(header.OffsetSize), io.SeekStart)
+		if err == nil {
+			err = header.WriteOffset(f, contentSize)
+		}
+	}
+	if err != nil {
+		return ContentDigest{}, err
+	}
+
+	digest, err := DigestContent(f, contentSize)
+	if err != nil {
+		return ContentDigest{}, err
+	}
+	seal := &TagSection{}
+	seal.Set(ContentSizeTag, strconv.FormatInt(contentSize, 10))
+	seal.Set(ContentHashTag, digest.String())
+	_, err = f.Seek(contentSize, io.SeekStart)
+	if err != nil {
+		return ContentDigest{}, err
+	}
+	err = seal.Write(f, header)
+	if err != nil {
+		return ContentDigest{}, err
+	}
+	return digest, nil
+}
+
+// Checks the content seal of a file written by SealContent: that the seal is the last thing in the file
+// and that the size and hash of everything before it match. Returns the sealed digest, ErrUnsealed if the
+// file has no seal, or ErrContentMismatch if it does not match.
+func VerifyContent(r io.ReadSeeker) (ContentDigest, error) {
+	sealed, err := ReadContentSeal(r)
+	if err != nil {
+		return sealed, err
+	}
+	actual, err := DigestContent(r, sealed.Size)
+	if err != nil {
+		return sealed, err
+	}
+	if actual != sealed {
+		return sealed, fmt.Errorf("%w: hash is %s, sealed %s", ErrContentMismatch, actual, sealed)
+	}
+	return sealed, nil
+}
+
+// Reads the digest recorded by the content seal of a file written by SealContent, checking that the seal
+// is the last thing in the file and covers everything before it, but without hashing the content; so
+// that copies of a sealed file can be told apart cheaply, as when reading from one of several mirrors.
+// Returns ErrUnsealed if the file has no seal, or ErrContentMismatch if the seal is not where it should be.
+func ReadContentSeal(r io.ReadSeeker) (ContentDigest, error) {
+	var header PixiHeader
+	_, err := r.Seek(0, io.SeekStart)
+	if err != nil {
+		return ContentDigest{}, err
+	}
+	err = header.ReadHeader(r)
+	if err != nil {
+		return ContentDigest{}, err
+	}
+	chain, err := readTagChain(r, header, header.FirstTagsOffset)
+	if err != nil {
+		return ContentDigest{}, err
+	}
+	if len(chain) == 0 || !isSeal(chain[len(chain)-1].section) {
+		return ContentDigest{}, ErrUnsealed
+	}
+	last := chain[len(chain)-1]
+
+	sealed := ContentDigest{}
+	sealed.Size, err = strconv.ParseInt(last.section.Tags[ContentSizeTag], 10, 64)
+	if err != nil {
+		return ContentDigest{}, FormatError("invalid " + ContentSizeTag + " tag")
+	}
+	hash, err := hex.DecodeString(last.section.Tags[ContentHashTag])
+	if err != nil || len(hash) != sha256.Size {
+		return ContentDigest{}, FormatError("invalid " + ContentHashTag + " tag")
+	}
+	copy(sealed.SHA256[:], hash)
+
+	fileSize, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return ContentDigest{}, err
+	}
+	if last.offset != sealed.Size || last.end != fileSize {
+		return sealed, fmt.Errorf("%w: sealed %d bytes, but the seal spans bytes %d to %d of a %d byte file",
+			ErrContentMismatch, sealed.Size, last.offset, last.end, fileSize)
+	}
+	return sealed, nil
+}
+
+// A tag section of a file and the span of bytes it occupies.
+type chainedTags struct {
+	section *TagSection
+	offset  int64
+	end     int64
+}
+
+// Reads the chain of tag sections starting at the given offset, recording where each is stored.
+func readTagChain(r io.ReadSeeker, header PixiHeader, firstOffset int64) ([]chainedTags, error) {
+	chain := []chainedTags{}
+	offset := firstOffset
+	for offset != 0 {
+		if slices.ContainsFunc(chain, func(c chainedTags) bool { return c.offset == offset }) {
+			return nil, FormatError("loop detected in tag offsets")
+		}
+		_, err := r.Seek(offset, io.SeekStart)
+		if err != nil {
+			return nil, err
+		}
+		section := &TagSection{}
+		err = section.Read(r, header)
+		if err != nil {
+			return nil, err
+		}
+		end, err := r.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, chainedTags{section: section, offset: offset, end: end})
+		offset = section.NextTagsStart
+	}
+	return chain, nil
+}
+
+// Reports whether a tag section is a content seal, holding only the seal tags.
+func isSeal(section *TagSection) bool {
+	_, hasHash := section.Tags[ContentHashTag]
+	_, hasSize := section.Tags[ContentSizeTag]
+	return hasHash && hasSize && len(section.Tags) == 2 && len(section.Binary) == 0
+}
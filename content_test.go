@@ -0,0 +1,67 @@
+package pixi
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/owlpinetech/pixi/internal/buffer"
+)
+
+func TestSealAndVerifyContent(t *testing.T) {
+	for _, tags := range []map[string]string{nil, {"a": "b"}} {
+		header := PixiHeader{Version: Version, OffsetSize: 8, ByteOrder: binary.LittleEndian}
+		layer := NewLayer("dem", false, CompressionNone,
+			DimensionSet{{Name: "x", Size: 8, TileSize: 4}, {Name: "y", Size: 8, TileSize: 4}},
+			[]Field{{Name: "height", Type: FieldInt16}})
+		buf := buffer.NewBuffer(10)
+		writeSingleLayerPixi(t, buf, header, tags, layer, randomTiles(layer))
+		unsealedSize := int64(len(buf.Bytes()))
+
+		if _, err := VerifyContent(buf); !errors.Is(err, ErrUnsealed) {
+			t.Errorf("expected an unsealed file, got %v", err)
+		}
+
+		digest, err := SealContent(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if digest.Size != unsealedSize || digest.SHA256 != sha256.Sum256(buf.Bytes()[:unsealedSize]) {
+			t.Errorf("expected the digest of the %d bytes before the seal, got %+v", unsealedSize, digest)
+		}
+		sealedSize := len(buf.Bytes())
+
+		verified, err := VerifyContent(buf)
+		if err != nil || verified != digest {
+			t.Fatalf("expected the sealed file to verify, got %v", err)
+		}
+		buf.Seek(0, io.SeekStart)
+		summary, err := ReadPixi(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hash, found, _ := summary.LookupTag(buf, ContentHashTag); !found || hash != digest.String() {
+			t.Errorf("expected the hash to be readable as a tag, got %q", hash)
+		}
+		if tags != nil && summary.Tags[0].Tags["a"] != "b" {
+			t.Errorf("expected the existing tags to be kept")
+		}
+
+		// sealing again replaces the seal rather than adding another
+		if again, err := SealContent(buf); err != nil || again != digest || len(buf.Bytes()) != sealedSize {
+			t.Errorf("expected resealing to give the same digest and size, got %+v, %d bytes, %v", again, len(buf.Bytes()), err)
+		}
+
+		corrupt := buffer.NewBufferFrom(append([]byte{}, buf.Bytes()...))
+		corrupt.Bytes()[unsealedSize-1] ^= 0xff
+		if _, err := VerifyContent(corrupt); !errors.Is(err, ErrContentMismatch) {
+			t.Errorf("expected a corrupted file to mismatch, got %v", err)
+		}
+		extended := buffer.NewBufferFrom(append(append([]byte{}, buf.Bytes()...), 0))
+		if _, err := VerifyContent(extended); !errors.Is(err, ErrContentMismatch) {
+			t.Errorf("expected a file with trailing bytes to mismatch, got %v", err)
+		}
+	}
+}
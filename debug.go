@@ -0,0 +1,197 @@
+package pixi
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Writes one line per on-disk field, annotated with the byte offset and size of the field, to help
+// debug files with incorrect offsets and to document the layout for implementers of other readers.
+type dumper struct {
+	w      io.Writer
+	offset int64
+	err    error
+}
+
+func (d *dumper) section(format string, args ...any) {
+	if d.err != nil {
+		return
+	}
+	_, d.err = fmt.Fprintf(d.w, "\n"+format+"\n", args...)
+}
+
+func (d *dumper) field(name string, size int, value any) {
+	if d.err != nil {
+		return
+	}
+	_, d.err = fmt.Fprintf(d.w, "%#010x %6d  %s = %v\n", d.offset, size, name, value)
+	d.offset += int64(size)
+}
+
+func (d *dumper) seek(offset int64) {
+	d.offset = offset
+}
+
+// Returns a listing of every field of the layer header as it is laid out on disk, with the offset of
+// each field relative to the start of the layer header and its size in bytes.
+func (l *Layer) DebugString(h PixiHeader) string {
+	builder := &strings.Builder{}
+	d := &dumper{w: builder}
+	l.dump(d, h)
+	return builder.String()
+}
+
+func (l *Layer) dump(d *dumper, h PixiHeader) {
+	configuration := uint32(0)
+	if l.Separated {
+		configuration |= layerFlagSeparated
+	}
+	if l.TileAlignment > 0 {
+		configuration |= layerFlagAligned
+	}
+	if l.tagged() {
+		configuration |= layerFlagTagged
+	}
+	if l.Dimensions.HasMetadata() {
+		configuration |= layerFlagDimMeta
+	}
+	if l.TileRanges != nil {
+		configuration |= layerFlagRanges
+	}
+	if l.Scratch {
+		configuration |= layerFlagScratch
+	}
+	if l.TileCompressions != nil {
+		configuration |= layerFlagCodecs
+	}
+	d.field("configuration", 4, fmt.Sprintf("%#x (separated: %v, aligned: %v, tagged: %v, dimension metadata: %v, tile ranges: %v, scratch: %v, tile compressions: %v)",
+		configuration, l.Separated, l.TileAlignment > 0, l.tagged(), l.Dimensions.HasMetadata(), l.TileRanges != nil, l.Scratch, l.TileCompressions != nil))
+	d.field("compression", 4, l.Compression)
+	if l.TileAlignment > 0 {
+		d.field("tile alignment", 4, l.TileAlignment)
+	}
+	d.field("name length", 2, len(l.Name))
+	d.field("name", len(l.Name), fmt.Sprintf("%q", l.Name))
+	d.field("dimension count", 4, len(l.Dimensions))
+	for i, dim := range l.Dimensions {
+		d.field(fmt.Sprintf("dimension %d name length", i), 2, len(dim.Name))
+		d.field(fmt.Sprintf("dimension %d name", i), len(dim.Name), fmt.Sprintf("%q", dim.Name))
+		d.field(fmt.Sprintf("dimension %d size", i), h.OffsetSize, dim.Size)
+		d.field(fmt.Sprintf("dimension %d tile size", i), h.OffsetSize, dim.TileSize)
+	}
+	if l.Dimensions.HasMetadata() {
+		for i, dim := range l.Dimensions {
+			d.field(fmt.Sprintf("dimension %d unit length", i), 2, len(dim.Unit))
+			d.field(fmt.Sprintf("dimension %d unit", i), len(dim.Unit), fmt.Sprintf("%q", dim.Unit))
+			d.field(fmt.Sprintf("dimension %d direction", i), 1, dim.Direction)
+			d.field(fmt.Sprintf("dimension %d resolution", i), 8, dim.Resolution)
+		}
+	}
+	d.field("field count", 4, len(l.Fields))
+	for i, field := range l.Fields {
+		d.field(fmt.Sprintf("field %d name length", i), 2, len(field.Name))
+		d.field(fmt.Sprintf("field %d name", i), len(field.Name), fmt.Sprintf("%q", field.Name))
+		d.field(fmt.Sprintf("field %d type", i), 4, field.Type)
+	}
+	for i, bytes := range l.TileBytes {
+		d.field(fmt.Sprintf("tile %d bytes", i), h.OffsetSize, bytes)
+	}
+	for i, offset := range l.TileOffsets {
+		d.field(fmt.Sprintf("tile %d offset", i), h.OffsetSize, offset)
+	}
+	d.field("next layer start", h.OffsetSize, l.NextLayerStart)
+	if l.tagged() {
+		d.field("tags start", h.OffsetSize, l.TagsStart)
+	}
+	for i, tileRange := range l.TileRanges {
+		for j, field := range l.Fields {
+			d.field(fmt.Sprintf("tile %d field %d range known", i, j), 1, tileRange.Min[j] != nil)
+			d.field(fmt.Sprintf("tile %d field %d min", i, j), field.Size(), tileRange.Min[j])
+			d.field(fmt.Sprintf("tile %d field %d max", i, j), field.Size(), tileRange.Max[j])
+		}
+	}
+	for i, compression := range l.TileCompressions {
+		d.field(fmt.Sprintf("tile %d compression", i), 1, compression)
+	}
+}
+
+// Writes a listing of every on-disk field of the file (the header, each layer header and its tiles,
+// and each tag section) with its absolute byte offset and size.
+func (p *Pixi) Dump(w io.Writer) error {
+	d := &dumper{w: w}
+	h := p.Header
+
+	d.section("header")
+	d.field("file type", 4, fmt.Sprintf("%q", FileType))
+	d.field("version", 2, h.Version)
+	d.field("offset size", 1, h.OffsetSize)
+	d.field("byte order", 1, h.ByteOrder)
+	if h.Version >= 2 {
+		d.field("checksum", 1, h.Checksum)
+	}
+	if h.Version >= 3 {
+		d.field("required features", 4, h.RequiredFeatures)
+		d.field("optional features", 4, h.OptionalFeatures)
+	}
+	d.field("first layer offset", h.OffsetSize, h.FirstLayerOffset)
+	d.field("first tags offset", h.OffsetSize, h.FirstTagsOffset)
+
+	for i, layer := range p.AllLayers() {
+		d.section("layer %d", i)
+		d.seek(p.LayerOffset(layer))
+		layer.dump(d, h)
+		for tileIndex := range layer.DiskTiles() {
+			if layer.TileBytes[tileIndex] == 0 {
+				continue
+			}
+			d.seek(layer.TileOffsets[tileIndex])
+			d.field(fmt.Sprintf("tile %d data", tileIndex), int(layer.TileBytes[tileIndex]), fmt.Sprintf("(%v)", layer.tileCompression(tileIndex)))
+			d.field(fmt.Sprintf("tile %d checksum", tileIndex), h.Checksum.Size(), fmt.Sprintf("(%v)", h.Checksum))
+		}
+		tagsOffset := layer.TagsStart
+		for j, section := range layer.Tags {
+			d.section("layer %d tag section %d", i, j)
+			d.seek(tagsOffset)
+			section.dump(d, h)
+			tagsOffset = section.NextTagsStart
+		}
+	}
+
+	tagsOffset := h.FirstTagsOffset
+	for i, section := range p.Tags {
+		d.section("tag section %d", i)
+		d.seek(tagsOffset)
+		section.dump(d, h)
+		tagsOffset = section.NextTagsStart
+	}
+	return d.err
+}
+
+func (t *TagSection) dump(d *dumper, h PixiHeader) {
+	extended := t.extended()
+	count := uint32(len(t.Tags) + len(t.Binary))
+	if extended {
+		d.field("tag count", 4, fmt.Sprintf("%#x (count: %d, extended: true)", count|tagFlagExtended, count))
+	} else {
+		d.field("tag count", 4, count)
+	}
+	for entry := range t.entries() {
+		d.field("key length", 2, len(entry.key))
+		d.field("key", len(entry.key), fmt.Sprintf("%q", entry.key))
+		switch {
+		case !extended:
+			d.field("value length", 2, len(entry.value))
+			d.field("value", len(entry.value), fmt.Sprintf("%q", entry.value))
+		case entry.isBinary:
+			d.field("kind", 1, "binary")
+			d.field("value length", h.OffsetSize, len(entry.payload))
+			d.field("value", len(entry.payload), fmt.Sprintf("(%d bytes)", len(entry.payload)))
+		default:
+			d.field("kind", 1, "string")
+			d.field("value length", h.OffsetSize, len(entry.value))
+			d.field("value", len(entry.value), fmt.Sprintf("%q", entry.value))
+		}
+	}
+	d.field("next tags start", h.OffsetSize, t.NextTagsStart)
+}
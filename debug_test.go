@@ -0,0 +1,65 @@
+package pixi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/owlpinetech/pixi/internal/buffer"
+)
+
+func TestLayerDebugStringOffsets(t *testing.T) {
+	header := PixiHeader{Version: Version, OffsetSize: 8, ByteOrder: binary.BigEndian}
+	layer := NewLayer("debug", true, CompressionFlate,
+		DimensionSet{{Name: "x", Size: 8, TileSize: 4}, {Name: "y", Size: 2, TileSize: 2}},
+		[]Field{{Name: "a", Type: FieldInt16}, {Name: "bb", Type: FieldFloat64}})
+	layer.TileAlignment = 16
+
+	lines := strings.Split(strings.TrimSpace(layer.DebugString(header)), "\n")
+	last := lines[len(lines)-1]
+	wantPrefix := fmt.Sprintf("%#010x %6d  next layer start", layer.HeaderSize(header)-header.OffsetSize, header.OffsetSize)
+	if !strings.HasPrefix(last, wantPrefix) {
+		t.Errorf("expected last line to start with %q, got %q", wantPrefix, last)
+	}
+	if !strings.Contains(lines[2], "tile alignment = 16") {
+		t.Errorf("expected tile alignment on the third line, got %q", lines[2])
+	}
+}
+
+func TestPixiDump(t *testing.T) {
+	header := PixiHeader{Version: Version, OffsetSize: 4, ByteOrder: binary.LittleEndian, Checksum: ChecksumXxHash64}
+	layer := NewLayer("dumped", false, CompressionNone,
+		DimensionSet{{Name: "x", Size: 4, TileSize: 2}},
+		[]Field{{Name: "v", Type: FieldUint8}})
+	buf := buffer.NewBuffer(10)
+	writeSingleLayerPixi(t, buf, header, map[string]string{"b": "2", "a": "1"}, layer, randomTiles(layer))
+
+	summary, err := ReadPixi(buffer.NewBufferFrom(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := &bytes.Buffer{}
+	err = summary.Dump(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dump := out.String()
+
+	layerOffset := summary.LayerOffset(summary.Layers[0])
+	for _, want := range []string{
+		fmt.Sprintf("%#010x %6d  checksum = xxhash64", 8, 1),
+		fmt.Sprintf("%#010x %6d  required features = none", 9, 4),
+		fmt.Sprintf("%#010x %6d  first layer offset = %d", 17, 4, layerOffset),
+		fmt.Sprintf("%#010x %6d  configuration", layerOffset, 4),
+		fmt.Sprintf("%#010x %6d  tile 1 data", summary.Layers[0].TileOffsets[1], 2),
+		fmt.Sprintf("%#010x %6d  tile 1 checksum", summary.Layers[0].TileOffsets[1]+2, 8),
+		fmt.Sprintf("%#010x %6d  tag count = 2", header.HeaderSize(), 4),
+		fmt.Sprintf("%#010x %6d  key = \"a\"", header.HeaderSize()+6, 1),
+	} {
+		if !strings.Contains(dump, want) {
+			t.Errorf("expected dump to contain %q, got:\n%s", want, dump)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package pixi
+
+import (
+	"errors"
+	"io"
+	"unicode/utf8"
+)
+
+// The ID of the extension section holding the description of a dataset: a long-form Markdown document
+// covering what the data is, how it was produced and how it may be used, so that a published file
+// documents itself. See Pixi.Description.
+const ExtensionDescription ExtensionID = 1
+
+func init() {
+	RegisterExtension(ExtensionDescription, ExtensionType{Name: "description", Validate: func(payload []byte) error {
+		if !utf8.Valid(payload) {
+			return errors.New("description is not valid UTF-8")
+		}
+		return nil
+	}})
+}
+
+// The Markdown description of the dataset, from the latest of the tag sections of the file holding one,
+// and whether the file has a description at all.
+func (d *Pixi) Description() (string, bool, error) {
+	sections, err := d.Extensions()
+	if err != nil {
+		return "", false, err
+	}
+	for _, section := range sections {
+		if section.ID == ExtensionDescription {
+			return string(section.Payload), true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// Sets the Markdown description of the dataset in the tag section, for files written with it, replacing
+// any description the section already holds. Returns an error if the extension sections already stored in
+// the section cannot be decoded.
+func (t *TagSection) SetDescription(markdown string) error {
+	return t.SetExtension(Extension{ID: ExtensionDescription, Payload: []byte(markdown)})
+}
+
+// Describes an existing file by appending a tag section holding only the Markdown description, as with
+// AppendTags, which then takes the place of any earlier description of the file.
+func AppendDescription(f io.ReadWriteSeeker, markdown string) error {
+	if !utf8.ValidString(markdown) {
+		return FormatError("description is not valid UTF-8")
+	}
+	section := &TagSection{}
+	err := section.SetDescription(markdown)
+	if err != nil {
+		return err
+	}
+	return AppendTags(f, section)
+}
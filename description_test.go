@@ -0,0 +1,56 @@
+package pixi
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/owlpinetech/pixi/internal/buffer"
+)
+
+func TestDescriptionSetAndAppend(t *testing.T) {
+	header := PixiHeader{Version: Version, OffsetSize: 4, ByteOrder: binary.LittleEndian, OptionalFeatures: FeatureExtensions}
+	buf := buffer.NewBuffer(10)
+	layer := appendTestLayer("elevation")
+	writeSingleLayerPixi(t, buf, header, map[string]string{"title": "terrain"}, layer, randomTiles(layer))
+
+	summary, err := ReadPixi(buffer.NewBufferFrom(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, found, err := summary.Description(); found || err != nil {
+		t.Errorf("expected no description yet, got %v %v", found, err)
+	}
+
+	first := "# Terrain\n\nElevations in metres.\n"
+	if err = AppendDescription(buf, first); err != nil {
+		t.Fatal(err)
+	}
+	second := "# Terrain\n\nElevations in metres, corrected.\n"
+	if err = AppendDescription(buf, second); err != nil {
+		t.Fatal(err)
+	}
+	summary, err = ReadPixi(buffer.NewBufferFrom(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	description, found, err := summary.Description()
+	if err != nil || !found || description != second {
+		t.Errorf("expected the latest description, got %q %v %v", description, found, err)
+	}
+	extensions, err := summary.Extensions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = CheckExtensions(extensions); err != nil {
+		t.Errorf("expected the description to be valid, got %v", err)
+	}
+
+	var format FormatError
+	if err = AppendDescription(buf, "\xff"); !errors.As(err, &format) {
+		t.Errorf("expected a description that is not UTF-8 to be refused, got %v", err)
+	}
+	if err = CheckExtensions([]Extension{{ID: ExtensionDescription, Payload: []byte{0xff}}}); !errors.As(err, &format) {
+		t.Errorf("expected a stored description that is not UTF-8 to be invalid, got %v", err)
+	}
+}
@@ -5,6 +5,29 @@ import (
 	"iter"
 )
 
+// The direction in which the coordinates of a dimension run as sample indices increase, for example
+// whether the rows of a raster run north to south or south to north.
+type AxisDirection uint8
+
+const (
+	AxisUnspecified AxisDirection = 0 // The direction of the axis is not recorded.
+	AxisIncreasing  AxisDirection = 1 // Coordinates increase along with the sample index (e.g. west to east).
+	AxisDecreasing  AxisDirection = 2 // Coordinates decrease as the sample index increases (e.g. north to south).
+)
+
+func (a AxisDirection) String() string {
+	switch a {
+	case AxisUnspecified:
+		return "unspecified"
+	case AxisIncreasing:
+		return "increasing"
+	case AxisDecreasing:
+		return "decreasing"
+	default:
+		return "unknown"
+	}
+}
+
 // Represents an axis along which tiled, gridded data is sstored in a Pixi file. Data sets can have
 // one or more dimensions, but never zero. If a dimension is not tiled, then the TileSize should be
 // the same as a the total Size.
@@ -12,13 +35,31 @@ type Dimension struct {
 	Name     string // Friendly name to refer to the dimension in the layer.
 	Size     int    // The total number of elements in the dimension.
 	TileSize int    // The size of the tiles in the dimension. Does not need to be a factor of Size.
+	// Optional description of what the samples along the dimension measure, so that "x: 3600 samples" can
+	// be read as "0.1 degrees of longitude, west to east". Only stored in version 2 files or later, and only
+	// when some dimension of the layer has any of it set.
+	Unit       string        // The unit of the coordinates along the dimension, such as "degrees_east" or "m". Empty if unknown.
+	Direction  AxisDirection // Whether coordinates increase or decrease along the dimension.
+	Resolution float64       // The nominal spacing between adjacent samples, in Unit. 0 if unknown.
 }
 
-// Get the size in bytes of this dimension description as it is laid out and written to disk.
+// Get the size in bytes of this dimension description as it is laid out and written to disk. Does
+// not include the size of the optional metadata, see MetadataSize.
 func (d Dimension) HeaderSize(h PixiHeader) int {
 	return 2 + len([]byte(d.Name)) + h.OffsetSize + h.OffsetSize
 }
 
+// Get the size in bytes of the optional metadata of this dimension as it is laid out on disk, when the
+// layer it belongs to stores dimension metadata.
+func (d Dimension) MetadataSize() int {
+	return 2 + len([]byte(d.Unit)) + 1 + 8 // unit, direction, and resolution
+}
+
+// Reports whether any of the optional metadata of the dimension is set.
+func (d Dimension) HasMetadata() bool {
+	return d.Unit != "" || d.Direction != AxisUnspecified || d.Resolution != 0
+}
+
 // Returns the number of tiles in this dimension.
 // The number of tiles is calculated by dividing the size of the dimension by the tile size,
 // and then rounding up to the nearest whole number if there are any remaining bytes that do not fit into a full tile.
@@ -72,8 +113,54 @@ func (d *Dimension) Read(r io.Reader, h PixiHeader) error {
 	return nil
 }
 
+// Writes the optional metadata of the dimension to the given stream, according to the specification in
+// the Pixi header h. Written after the descriptions of all dimensions when the layer stores dimension metadata.
+func (d *Dimension) WriteMetadata(w io.Writer, h PixiHeader) error {
+	if d.Direction > AxisDecreasing {
+		return FormatError("unknown dimension axis direction")
+	}
+	err := h.WriteFriendly(w, d.Unit)
+	if err != nil {
+		return err
+	}
+	err = h.Write(w, d.Direction)
+	if err != nil {
+		return err
+	}
+	return h.Write(w, d.Resolution)
+}
+
+// Reads the optional metadata of the dimension from the given binary stream, according to the
+// specification in the Pixi header h.
+func (d *Dimension) ReadMetadata(r io.Reader, h PixiHeader) error {
+	unit, err := h.ReadFriendly(r)
+	if err != nil {
+		return err
+	}
+	d.Unit = unit
+	err = h.Read(r, &d.Direction)
+	if err != nil {
+		return err
+	}
+	if d.Direction > AxisDecreasing {
+		return FormatError("unknown dimension axis direction")
+	}
+	return h.Read(r, &d.Resolution)
+}
+
 type DimensionSet []Dimension
 
+// Reports whether any dimension in the set has optional metadata, in which case the metadata of every
+// dimension is stored in the layer header.
+func (d DimensionSet) HasMetadata() bool {
+	for _, dim := range d {
+		if dim.HasMetadata() {
+			return true
+		}
+	}
+	return false
+}
+
 // Computes the number of non-separated tiles in the data set. This number is the same regardless
 // of how the tiles are laid out on disk; use the DiskTiles() method to determine the number of
 // tiles actually stored on disk. Note that DiskTiles() >= Tiles() by definition.
@@ -111,6 +198,18 @@ func (d DimensionSet) Samples() int {
 	return samples
 }
 
+// The bounds of the samples covered by the tile at the given index: the coordinate of its first sample,
+// and the coordinate one past its last sample in every dimension. The end is clipped to the size of each
+// dimension, so padding samples in partial tiles at the edges of the data set are not included.
+func (set DimensionSet) TileBounds(tileIndex int) (SampleCoordinate, SampleCoordinate) {
+	origin := TileSelector{Tile: tileIndex, InTile: 0}.ToTileCoordinate(set).ToSampleCoordinate(set)
+	end := make(SampleCoordinate, len(set))
+	for i, dim := range set {
+		end[i] = min(origin[i]+dim.TileSize, dim.Size)
+	}
+	return origin, end
+}
+
 // Iterate over the sample indices of the dimensions in the order the dimensions are laid out. That is,
 // the index increments for the size of the first dimension, then the second (nesting the first), then
 // the third (nesting the second (nesting the first)), and so on.
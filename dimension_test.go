@@ -67,6 +67,51 @@ func TestDimensionWriteRead(t *testing.T) {
 	}
 }
 
+func TestDimensionMetadataWriteRead(t *testing.T) {
+	headers := []PixiHeader{
+		{Version: Version, ByteOrder: binary.BigEndian, OffsetSize: 4},
+		{Version: Version, ByteOrder: binary.LittleEndian, OffsetSize: 8},
+	}
+
+	cases := []Dimension{
+		{Name: "lon", Size: 3600, TileSize: 360, Unit: "degrees_east", Direction: AxisIncreasing, Resolution: 0.1},
+		{Name: "lat", Size: 1800, TileSize: 180, Unit: "degrees_north", Direction: AxisDecreasing, Resolution: 0.1},
+		{Name: "band", Size: 4, TileSize: 4},
+	}
+
+	for _, c := range cases {
+		for _, h := range headers {
+			buf := buffer.NewBuffer(10)
+			err := c.Write(buf, h)
+			if err != nil {
+				t.Fatal("write dimension", err)
+			}
+			err = c.WriteMetadata(buf, h)
+			if err != nil {
+				t.Fatal("write dimension metadata", err)
+			}
+			if len(buf.Bytes()) != c.HeaderSize(h)+c.MetadataSize() {
+				t.Errorf("expected %d bytes written, got %d", c.HeaderSize(h)+c.MetadataSize(), len(buf.Bytes()))
+			}
+
+			readBuf := buffer.NewBufferFrom(buf.Bytes())
+			readDim := Dimension{}
+			err = (&readDim).Read(readBuf, h)
+			if err != nil {
+				t.Fatal("read dimension", err)
+			}
+			err = (&readDim).ReadMetadata(readBuf, h)
+			if err != nil {
+				t.Fatal("read dimension metadata", err)
+			}
+
+			if !reflect.DeepEqual(c, readDim) {
+				t.Errorf("expected read dimension to be %v, got %v for header %v", c, readDim, h)
+			}
+		}
+	}
+}
+
 func TestDimensionTiles(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -120,7 +165,7 @@ func TestDimensionIndicesSampleOrder(t *testing.T) {
 }
 
 func TestDimensionIndicesTileOrder(t *testing.T) {
-	dims := DimensionSet{{"", 15, 5}, {"", 60, 30}} //newRandomValidDimensionSet(5, 99, 5)
+	dims := DimensionSet{{Size: 15, TileSize: 5}, {Size: 60, TileSize: 30}} //newRandomValidDimensionSet(5, 99, 5)
 
 	tileInd := TileIndex(0)
 	for coord := range dims.TileCoordinates() {
@@ -130,3 +175,22 @@ func TestDimensionIndicesTileOrder(t *testing.T) {
 		tileInd++
 	}
 }
+
+func TestDimensionSetTileBounds(t *testing.T) {
+	set := DimensionSet{{Name: "x", Size: 10, TileSize: 4}, {Name: "y", Size: 5, TileSize: 5}}
+	tests := []struct {
+		tile      int
+		wantStart SampleCoordinate
+		wantEnd   SampleCoordinate
+	}{
+		{0, SampleCoordinate{0, 0}, SampleCoordinate{4, 5}},
+		{1, SampleCoordinate{4, 0}, SampleCoordinate{8, 5}},
+		{2, SampleCoordinate{8, 0}, SampleCoordinate{10, 5}},
+	}
+	for _, tc := range tests {
+		start, end := set.TileBounds(tc.tile)
+		if !reflect.DeepEqual(start, tc.wantStart) || !reflect.DeepEqual(end, tc.wantEnd) {
+			t.Errorf("tile %d: expected bounds %v to %v, got %v to %v", tc.tile, tc.wantStart, tc.wantEnd, start, end)
+		}
+	}
+}
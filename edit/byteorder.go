@@ -0,0 +1,80 @@
+package edit
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+
+	"github.com/owlpinetech/pixi"
+)
+
+// Copies the Pixi file in src to dst, rewriting every multi-byte value (header offsets, layer
+// descriptions, and the samples in each tile) in the given byte order. Tiles are decoded, swapped
+// in place, and re-encoded one at a time, so memory use is bounded by the largest tile rather than
+// the size of the file. Layers keep their original compression, names, and tiling, and all tag
+// sections are combined into a single section in the output.
+func ConvertByteOrder(dst io.WriteSeeker, src io.ReadSeeker, order binary.ByteOrder) error {
+	srcPixi, err := pixi.ReadPixi(src)
+	if err != nil {
+		return err
+	}
+
+	header := srcPixi.Header
+	header.ByteOrder = order
+	layers := make([]derivedLayer, len(srcPixi.Layers))
+	for i, srcLayer := range srcPixi.Layers {
+		layers[i] = derivedLayer{
+			layer: deriveLayer(srcLayer, srcLayer.Compression, srcLayer.Dimensions),
+			tile: func(tileIndex int, data []byte) error {
+				err := srcLayer.ReadTile(src, srcPixi.Header, tileIndex, data)
+				if err != nil {
+					return err
+				}
+				if srcPixi.Header.ByteOrder != order {
+					swapTileByteOrder(srcLayer, tileIndex, data)
+				}
+				return nil
+			},
+		}
+	}
+	return writeDerivedPixi(context.Background(), dst, header, mergeTagSections(srcPixi.Tags), layers, nil)
+}
+
+// Combines the tags of several sections into a single section, with tags in later sections replacing
+// those with the same key in earlier sections.
+func mergeTagSections(sections []*pixi.TagSection) *pixi.TagSection {
+	merged := &pixi.TagSection{}
+	for _, section := range sections {
+		merged.Merge(section)
+	}
+	return merged
+}
+
+// Reverses the bytes of every field value in the decoded tile, converting it between little
+// and big endian representations.
+func swapTileByteOrder(layer *pixi.Layer, tileIndex int, data []byte) {
+	if layer.Separated {
+		field := layer.Fields[tileIndex/layer.Dimensions.Tiles()]
+		swapValues(data, field.Size())
+		return
+	}
+	sampleSize := layer.SampleSize()
+	for sampleOffset := 0; sampleOffset+sampleSize <= len(data); sampleOffset += sampleSize {
+		fieldOffset := sampleOffset
+		for _, field := range layer.Fields {
+			swapValues(data[fieldOffset:fieldOffset+field.Size()], field.Size())
+			fieldOffset += field.Size()
+		}
+	}
+}
+
+func swapValues(data []byte, size int) {
+	if size <= 1 {
+		return
+	}
+	for start := 0; start+size <= len(data); start += size {
+		for i, j := start, start+size-1; i < j; i, j = i+1, j-1 {
+			data[i], data[j] = data[j], data[i]
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package edit
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/internal/buffer"
+	"github.com/owlpinetech/pixi/read"
+)
+
+func TestConvertByteOrderRoundTrip(t *testing.T) {
+	header := pixi.PixiHeader{Version: pixi.Version, OffsetSize: 4, ByteOrder: binary.BigEndian}
+	xSize, ySize := 12, 9
+	depths := make([]int32, xSize*ySize)
+	lums := make([]float64, xSize*ySize)
+	for i := range depths {
+		depths[i] = rand.Int31()
+		lums[i] = rand.Float64()
+	}
+
+	layerTags := &pixi.TagSection{}
+	layerTags.Set("units", "metres")
+	layer := pixi.NewLayer("swap", false, pixi.CompressionFlate,
+		pixi.DimensionSet{{Name: "x", Size: xSize, TileSize: 4}, {Name: "y", Size: ySize, TileSize: 3}},
+		[]pixi.Field{{Name: "depth", Type: pixi.FieldInt32}, {Name: "lum", Type: pixi.FieldFloat64}})
+	layer.Tags = []*pixi.TagSection{layerTags}
+
+	buf := buffer.NewBuffer(20)
+	err := WriteContiguousTileOrderPixi(buf, header, map[string]string{"source": "test"},
+		LayerWriter{
+			Layer: layer,
+			IterFn: func(layer *pixi.Layer, coord pixi.SampleCoordinate) ([]any, map[string]any) {
+				ind := coord.ToSampleIndex(layer.Dimensions)
+				return []any{depths[ind], lums[ind]}, nil
+			},
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	little := buffer.NewBuffer(20)
+	err = ConvertByteOrder(little, buffer.NewBufferFrom(buf.Bytes()), binary.LittleEndian)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	littleRdr := buffer.NewBufferFrom(little.Bytes())
+	littlePixi, err := pixi.ReadPixi(littleRdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if littlePixi.Header.ByteOrder != binary.LittleEndian {
+		t.Fatalf("expected little endian output, got %v", littlePixi.Header.ByteOrder)
+	}
+	if len(littlePixi.Layers[0].Tags) != 1 || littlePixi.Layers[0].Tags[0].Tags["units"] != "metres" {
+		t.Errorf("expected layer tags to be copied, got %v", littlePixi.Layers[0].Tags)
+	}
+	if littlePixi.Tags[0].Tags["source"] != "test" {
+		t.Errorf("expected tags to be copied, got %v", littlePixi.Tags[0].Tags)
+	}
+
+	for coord, sample := range read.LayerContiguousTileOrder(littleRdr, littlePixi.Header, littlePixi.Layers[0]) {
+		if coord[0] >= xSize || coord[1] >= ySize {
+			continue
+		}
+		ind := coord.ToSampleIndex(littlePixi.Layers[0].Dimensions)
+		if !reflect.DeepEqual(sample, []any{depths[ind], lums[ind]}) {
+			t.Fatalf("expected sample %v at %v, got %v", []any{depths[ind], lums[ind]}, coord, sample)
+		}
+	}
+
+	big := buffer.NewBuffer(20)
+	err = ConvertByteOrder(big, buffer.NewBufferFrom(little.Bytes()), binary.BigEndian)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(big.Bytes(), buf.Bytes()) {
+		t.Error("expected converting back to the original byte order to reproduce the original file")
+	}
+}
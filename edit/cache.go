@@ -0,0 +1,334 @@
+package edit
+
+import (
+	"io"
+	"slices"
+	"sync"
+
+	"github.com/owlpinetech/pixi"
+)
+
+// Determines when modified tiles held by a FifoCacheLayer are written to the backing stream.
+type WriteMode int
+
+const (
+	// Every modification is written to the backing stream (along with the updated layer header)
+	// before the call that made it returns. Slow, but the backing stream is always up to date.
+	WriteThrough WriteMode = 0
+	// Modified tiles are kept in memory and only written when they are evicted from the cache or
+	// when Flush is called. Much faster for localized edits, but modifications are lost if the
+	// cache is discarded without flushing.
+	WriteBack WriteMode = 1
+)
+
+type cachedTile struct {
+	data  []byte
+	dirty bool
+}
+
+// A read-write view of a single layer in a Pixi stream that keeps a bounded number of decoded tiles
+// in memory. Tiles are evicted in first-in first-out order: the tile that was loaded into the cache
+// earliest is always the next one to be evicted, regardless of how recently it was accessed. In
+// WriteBack mode, an evicted tile that has been modified is written to the backing stream before it
+// is dropped, and Flush writes all modified tiles in the order they entered the cache.
+//
+// Uncompressed tiles are overwritten in place. Since compressed tiles can change size when modified,
+// they are instead appended to the end of the stream and the layer's tile offsets are updated, leaving
+// the old tile data unreferenced.
+type FifoCacheLayer struct {
+	lock        sync.Mutex
+	backing     io.ReadWriteSeeker
+	header      pixi.PixiHeader
+	layer       *pixi.Layer
+	layerOffset int64
+	mode        WriteMode
+	maxInCache  int
+	tiles       map[int]*cachedTile
+	order       []int            // tile indices in the order they entered the cache
+	modified    map[int]struct{} // disk tile indices modified since the last flush
+	sync        syncPolicy
+	budget      *pixi.MemoryBudget
+}
+
+// The name under which FifoCacheLayers report their usage to a memory budget.
+const FifoCacheConsumer = "fifo cache"
+
+// Creates a new cached read-write view of the layer, whose header is found at layerOffset in the backing
+// stream. At most maxInCache tiles are held in memory at any one time.
+func NewFifoCacheLayer(backing io.ReadWriteSeeker, header pixi.PixiHeader, layer *pixi.Layer, layerOffset int64, mode WriteMode, maxInCache int) *FifoCacheLayer {
+	return &FifoCacheLayer{
+		backing:     backing,
+		header:      header,
+		layer:       layer,
+		layerOffset: layerOffset,
+		mode:        mode,
+		maxInCache:  max(1, maxInCache),
+		tiles:       make(map[int]*cachedTile),
+		modified:    make(map[int]struct{}),
+	}
+}
+
+// The layer being viewed through the cache.
+func (c *FifoCacheLayer) Layer() *pixi.Layer {
+	return c.layer
+}
+
+// Reads the values of every field of the sample at the given coordinate.
+func (c *FifoCacheLayer) SampleAt(coord pixi.SampleCoordinate) ([]any, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	sample := make([]any, len(c.layer.Fields))
+	for fieldIndex, field := range c.layer.Fields {
+		tileIndex, offset := fieldLocation(c.layer, coord, fieldIndex)
+		tile, err := c.getTile(tileIndex)
+		if err != nil {
+			return nil, err
+		}
+		sample[fieldIndex] = field.BytesToValue(tile.data[offset:], c.header.ByteOrder)
+	}
+	return sample, nil
+}
+
+// Reads the value of a single field of the sample at the given coordinate.
+func (c *FifoCacheLayer) FieldAt(coord pixi.SampleCoordinate, fieldIndex int) (any, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	tileIndex, offset := fieldLocation(c.layer, coord, fieldIndex)
+	tile, err := c.getTile(tileIndex)
+	if err != nil {
+		return nil, err
+	}
+	return c.layer.Fields[fieldIndex].BytesToValue(tile.data[offset:], c.header.ByteOrder), nil
+}
+
+// Sets the values of every field of the sample at the given coordinate. The values must be of the
+// Go types corresponding to each field's type.
+func (c *FifoCacheLayer) SetSampleAt(coord pixi.SampleCoordinate, sample []any) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	touched := make([]int, 0, 1)
+	for fieldIndex, field := range c.layer.Fields {
+		tileIndex, offset := fieldLocation(c.layer, coord, fieldIndex)
+		tile, err := c.getTile(tileIndex)
+		if err != nil {
+			return err
+		}
+		field.ValueToBytes(sample[fieldIndex], tile.data[offset:], c.header.ByteOrder)
+		tile.dirty = true
+		c.modified[tileIndex] = struct{}{}
+		if !slices.Contains(touched, tileIndex) {
+			touched = append(touched, tileIndex)
+		}
+	}
+	return c.afterModify(touched...)
+}
+
+// Sets the value of a single field of the sample at the given coordinate.
+func (c *FifoCacheLayer) SetFieldAt(coord pixi.SampleCoordinate, fieldIndex int, value any) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	tileIndex, offset := fieldLocation(c.layer, coord, fieldIndex)
+	tile, err := c.getTile(tileIndex)
+	if err != nil {
+		return err
+	}
+	c.layer.Fields[fieldIndex].ValueToBytes(value, tile.data[offset:], c.header.ByteOrder)
+	tile.dirty = true
+	c.modified[tileIndex] = struct{}{}
+	return c.afterModify(tileIndex)
+}
+
+// Writes every modified tile in the cache to the backing stream, in the order the tiles entered the
+// cache, then rewrites the layer header so the stream reflects all modifications. Tiles remain cached.
+// Flushing also resets the set of tiles reported by DirtyTiles.
+func (c *FifoCacheLayer) Flush() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, tileIndex := range c.order {
+		tile := c.tiles[tileIndex]
+		if tile.dirty {
+			err := c.writeTile(tileIndex, tile)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	err := c.layer.OverwriteHeader(c.backing, c.header, c.layerOffset)
+	if err != nil {
+		return err
+	}
+	clear(c.modified)
+	return c.sync.finished()
+}
+
+// Sets the options controlling when the backing stream is synced to stable storage. Returns an
+// error if syncing is requested but the backing stream does not implement Syncer.
+func (c *FifoCacheLayer) SetDurability(durability Durability) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	policy, err := newSyncPolicy(c.backing, durability)
+	if err != nil {
+		return err
+	}
+	c.sync = policy
+	return nil
+}
+
+// Makes the cache also stay within the given memory budget, shared with other consumers: when the
+// budget is exhausted, tiles are evicted before a new one is loaded as if the cache were full, down to
+// a single tile. Tiles already cached are moved from any previous budget to the new one.
+func (c *FifoCacheLayer) SetMemoryBudget(budget *pixi.MemoryBudget) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	held := c.heldBytes()
+	c.budget.Release(FifoCacheConsumer, held)
+	c.budget = budget
+	c.budget.Acquire(FifoCacheConsumer, held)
+}
+
+// Flushes the cache, then drops every cached tile, returning their memory to the budget if there is one.
+// The cache can still be used afterwards, reloading tiles as they are needed.
+func (c *FifoCacheLayer) Close() error {
+	err := c.Flush()
+	if err != nil {
+		return err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.budget.Release(FifoCacheConsumer, c.heldBytes())
+	clear(c.tiles)
+	c.order = c.order[:0]
+	return nil
+}
+
+func (c *FifoCacheLayer) heldBytes() int64 {
+	held := int64(0)
+	for _, tile := range c.tiles {
+		held += int64(len(tile.data))
+	}
+	return held
+}
+
+// The tiles modified since the cache was created or last flushed. In WriteThrough mode, these tiles have
+// already been written to the backing stream, but are still reported until Flush is called.
+func (c *FifoCacheLayer) DirtyTiles() []int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	diskTiles := make([]int, 0, len(c.modified))
+	for tileIndex := range c.modified {
+		diskTiles = append(diskTiles, tileIndex)
+	}
+	return diskTilesToTiles(c.layer, diskTiles)
+}
+
+// Returns the disk tile index and the byte offset within that tile of a field of the sample at the coordinate.
+func fieldLocation(layer *pixi.Layer, coord pixi.SampleCoordinate, fieldIndex int) (int, int) {
+	selector := coord.ToTileSelector(layer.Dimensions)
+	if layer.Separated {
+		return selector.Tile + layer.Dimensions.Tiles()*fieldIndex, selector.InTile * layer.Fields[fieldIndex].Size()
+	}
+	offset := selector.InTile * layer.SampleSize()
+	for _, field := range layer.Fields[:fieldIndex] {
+		offset += field.Size()
+	}
+	return selector.Tile, offset
+}
+
+func (c *FifoCacheLayer) getTile(tileIndex int) (*cachedTile, error) {
+	if tile, ok := c.tiles[tileIndex]; ok {
+		return tile, nil
+	}
+
+	for len(c.order) >= c.maxInCache {
+		err := c.evict()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	size := int64(c.layer.DiskTileSize(tileIndex))
+	for !c.budget.TryAcquire(FifoCacheConsumer, size) {
+		if len(c.order) == 0 {
+			// the tile is needed regardless, even if it is larger than the whole budget
+			c.budget.Acquire(FifoCacheConsumer, size)
+			break
+		}
+		err := c.evict()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	tile := &cachedTile{data: make([]byte, size)}
+	// tiles that have never been written are treated as zero-filled
+	if c.layer.TileBytes[tileIndex] != 0 {
+		err := c.layer.ReadTile(c.backing, c.header, tileIndex, tile.data)
+		if err != nil {
+			c.budget.Release(FifoCacheConsumer, size)
+			return nil, err
+		}
+	}
+	c.tiles[tileIndex] = tile
+	c.order = append(c.order, tileIndex)
+	return tile, nil
+}
+
+func (c *FifoCacheLayer) evict() error {
+	tileIndex := c.order[0]
+	tile := c.tiles[tileIndex]
+	if tile.dirty {
+		err := c.writeTile(tileIndex, tile)
+		if err != nil {
+			return err
+		}
+		err = c.layer.OverwriteHeader(c.backing, c.header, c.layerOffset)
+		if err != nil {
+			return err
+		}
+	}
+	c.order = c.order[1:]
+	delete(c.tiles, tileIndex)
+	c.budget.Release(FifoCacheConsumer, int64(len(tile.data)))
+	return nil
+}
+
+func (c *FifoCacheLayer) afterModify(tileIndices ...int) error {
+	if c.mode != WriteThrough {
+		return nil
+	}
+	for _, tileIndex := range tileIndices {
+		tile, ok := c.tiles[tileIndex]
+		if !ok || !tile.dirty {
+			// already written when it was evicted to make room for another touched tile
+			continue
+		}
+		err := c.writeTile(tileIndex, tile)
+		if err != nil {
+			return err
+		}
+	}
+	return c.layer.OverwriteHeader(c.backing, c.header, c.layerOffset)
+}
+
+func (c *FifoCacheLayer) writeTile(tileIndex int, tile *cachedTile) error {
+	err := rewriteTile(c.backing, c.header, c.layer, tileIndex, tile.data)
+	if err != nil {
+		return err
+	}
+	tile.dirty = false
+	return c.sync.tilesWritten(1)
+}
+
+// Writes a modified tile back to the stream. Uncompressed tiles that have already been written are
+// overwritten in place, while compressed tiles (which may have changed size) are appended to the end.
+func rewriteTile(w io.WriteSeeker, h pixi.PixiHeader, layer *pixi.Layer, tileIndex int, data []byte) error {
+	if layer.Compression == pixi.CompressionNone && layer.TileBytes[tileIndex] != 0 &&
+		(layer.TileCompressions == nil || layer.TileCompressions[tileIndex] == pixi.CompressionNone) {
+		return layer.OverwriteTile(w, h, tileIndex, data)
+	}
+	_, err := w.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	return layer.WriteTile(w, h, tileIndex, data)
+}
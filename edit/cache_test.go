@@ -0,0 +1,201 @@
+package edit
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/internal/buffer"
+	"github.com/owlpinetech/pixi/read"
+)
+
+// Writes a two dimensional layer of 10x10 samples in 5x5 tiles, where each sample is its own index.
+func writeIndexedLayer(t *testing.T, compression pixi.Compression) *buffer.Buffer {
+	t.Helper()
+	header := pixi.PixiHeader{Version: pixi.Version, OffsetSize: 4, ByteOrder: binary.LittleEndian}
+	buf := buffer.NewBuffer(20)
+	err := WriteContiguousTileOrderPixi(buf, header, map[string]string{},
+		LayerWriter{
+			Layer: pixi.NewLayer("indexed", false, compression,
+				pixi.DimensionSet{{Name: "x", Size: 10, TileSize: 5}, {Name: "y", Size: 10, TileSize: 5}},
+				[]pixi.Field{{Name: "index", Type: pixi.FieldUint32}, {Name: "half", Type: pixi.FieldFloat32}}),
+			IterFn: func(layer *pixi.Layer, coord pixi.SampleCoordinate) ([]any, map[string]any) {
+				ind := coord.ToSampleIndex(layer.Dimensions)
+				return []any{uint32(ind), float32(ind) / 2}, nil
+			},
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf
+}
+
+// Writes a separated layer of the same shape as writeIndexedLayer, with all samples zero.
+func writeBlankSeparatedLayer(t *testing.T, compression pixi.Compression) *buffer.Buffer {
+	t.Helper()
+	header := pixi.PixiHeader{Version: pixi.Version, OffsetSize: 4, ByteOrder: binary.LittleEndian}
+	layer := pixi.NewLayer("indexed", true, compression,
+		pixi.DimensionSet{{Name: "x", Size: 10, TileSize: 5}, {Name: "y", Size: 10, TileSize: 5}},
+		[]pixi.Field{{Name: "index", Type: pixi.FieldUint32}, {Name: "half", Type: pixi.FieldFloat32}})
+	buf := buffer.NewBuffer(20)
+	err := header.WriteHeader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layerOffset, _ := buf.Seek(0, 1)
+	err = header.OverwriteOffsets(buf, layerOffset, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = layer.WriteHeader(buf, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = layer.WriteBlankTiles(buf, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = layer.OverwriteHeader(buf, header, layerOffset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf
+}
+
+// Reads the sample at the coordinate from a fresh read of the stream, ignoring any cached state.
+func freshSample(t *testing.T, buf *buffer.Buffer, coord pixi.SampleCoordinate) []any {
+	t.Helper()
+	rdr := buffer.NewBufferFrom(buf.Bytes())
+	summary, err := pixi.ReadPixi(rdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := read.NewLayerReadCache(rdr, summary.Header, summary.Layers[0], read.NewLfuCacheManager(4))
+	sample, err := cache.SampleAt(coord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sample
+}
+
+func openFifoCache(t *testing.T, buf *buffer.Buffer, mode WriteMode, maxInCache int) *FifoCacheLayer {
+	t.Helper()
+	_, err := buf.Seek(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary, err := pixi.ReadPixi(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewFifoCacheLayer(buf, summary.Header, summary.Layers[0], summary.LayerOffset(summary.Layers[0]), mode, maxInCache)
+}
+
+func TestFifoCacheLayerWriteThrough(t *testing.T) {
+	for _, compression := range []pixi.Compression{pixi.CompressionNone, pixi.CompressionFlate} {
+		for _, separated := range []bool{false, true} {
+			var buf *buffer.Buffer
+			if separated {
+				buf = writeBlankSeparatedLayer(t, compression)
+			} else {
+				buf = writeIndexedLayer(t, compression)
+			}
+			cache := openFifoCache(t, buf, WriteThrough, 1)
+
+			err := cache.SetSampleAt(pixi.SampleCoordinate{7, 2}, []any{uint32(1000), float32(-1)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := freshSample(t, buf, pixi.SampleCoordinate{7, 2}); got[0] != uint32(1000) || got[1] != float32(-1) {
+				t.Errorf("expected write-through modification to be visible immediately, got %v", got)
+			}
+			if got := freshSample(t, buf, pixi.SampleCoordinate{6, 2}); !separated && got[0] != uint32(26) {
+				t.Errorf("expected neighboring sample to be unchanged, got %v", got)
+			} else if separated && got[0] != uint32(0) {
+				t.Errorf("expected neighboring blank sample to be unchanged, got %v", got)
+			}
+		}
+	}
+}
+
+func TestFifoCacheLayerWriteBackEviction(t *testing.T) {
+	for _, compression := range []pixi.Compression{pixi.CompressionNone, pixi.CompressionFlate} {
+		buf := writeIndexedLayer(t, compression)
+		cache := openFifoCache(t, buf, WriteBack, 2)
+
+		// tile 0, then tile 1; neither should be written yet
+		err := cache.SetFieldAt(pixi.SampleCoordinate{1, 1}, 0, uint32(500))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = cache.SetFieldAt(pixi.SampleCoordinate{6, 1}, 0, uint32(600))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := freshSample(t, buf, pixi.SampleCoordinate{1, 1}); got[0] != uint32(11) {
+			t.Errorf("expected write-back modification to be pending, got %v", got)
+		}
+
+		// touching tile 0 again must not change eviction order, so loading tile 2 evicts tile 0
+		if _, err = cache.FieldAt(pixi.SampleCoordinate{1, 1}, 0); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = cache.SampleAt(pixi.SampleCoordinate{1, 6}); err != nil {
+			t.Fatal(err)
+		}
+		if got := freshSample(t, buf, pixi.SampleCoordinate{1, 1}); got[0] != uint32(500) {
+			t.Errorf("expected evicted tile to be written, got %v", got)
+		}
+		if got := freshSample(t, buf, pixi.SampleCoordinate{6, 1}); got[0] != uint32(16) {
+			t.Errorf("expected tile still in cache to be pending, got %v", got)
+		}
+
+		// the evicted modification must survive being read back into the cache
+		if got, err := cache.FieldAt(pixi.SampleCoordinate{1, 1}, 0); err != nil || got != uint32(500) {
+			t.Errorf("expected reloaded tile to contain modification, got %v (%v)", got, err)
+		}
+
+		err = cache.Flush()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := freshSample(t, buf, pixi.SampleCoordinate{6, 1}); got[0] != uint32(600) || got[1] != float32(8) {
+			t.Errorf("expected flushed modification to be written, got %v", got)
+		}
+	}
+}
+
+func TestFifoCacheLayerMemoryBudget(t *testing.T) {
+	buf := writeIndexedLayer(t, pixi.CompressionNone)
+	cache := openFifoCache(t, buf, WriteBack, 10)
+	// each tile is 25 samples of 8 bytes, so the budget holds two tiles even though the cache allows ten
+	budget := pixi.NewMemoryBudget(450)
+	cache.SetMemoryBudget(budget)
+
+	for _, coord := range []pixi.SampleCoordinate{{1, 1}, {6, 1}, {1, 6}, {6, 6}} {
+		err := cache.SetFieldAt(coord, 0, uint32(1000))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if budget.Used() > budget.Limit() {
+			t.Fatalf("expected cache to stay within the budget, used %d", budget.Used())
+		}
+	}
+	if budget.Usage()[FifoCacheConsumer] != 400 {
+		t.Errorf("expected two tiles held against the budget, got %v", budget.Usage())
+	}
+	if got := freshSample(t, buf, pixi.SampleCoordinate{1, 1}); got[0] != uint32(1000) {
+		t.Errorf("expected tile evicted for the budget to be written, got %v", got)
+	}
+
+	err := cache.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if budget.Used() != 0 {
+		t.Errorf("expected closing the cache to release its memory, %d still used", budget.Used())
+	}
+	if got := freshSample(t, buf, pixi.SampleCoordinate{6, 6}); got[0] != uint32(1000) {
+		t.Errorf("expected closing the cache to flush it, got %v", got)
+	}
+}
@@ -0,0 +1,156 @@
+package edit
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/owlpinetech/pixi"
+)
+
+// Bounds on the decoded size of the disk tiles of a cloud-optimized file, see CheckCloudOptimized. Smaller
+// tiles cost a request for too few bytes, larger ones make readers fetch much more than they need.
+const (
+	CloudMinTileBytes = 16 << 10
+	CloudMaxTileBytes = 16 << 20
+)
+
+// Returned by CheckCloudOptimized, and by Optimize when asked for a cloud-optimized file, for files that
+// do not meet the cloud-optimized profile.
+var ErrNotCloudOptimized = errors.New("pixi: file is not cloud optimized")
+
+// Checks the Pixi file in src against the cloud-optimized profile, the layout Optimize writes with the
+// CloudOptimized option, which lets readers fetching the file over a network (see the remote package)
+// learn its structure and draw a first view of it with a single small request, in the manner of a cloud
+// optimized GeoTIFF. A cloud-optimized file:
+//   - uses 8 byte offsets, so that it can grow past 4 GiB without being rewritten;
+//   - holds its file tags, every layer header and every layer tag section before any tile;
+//   - has at least one overview of its first layer, if the first layer has more than one tile (which
+//     layers are overviews is decided as by UpdateOverviews);
+//   - holds the tiles of each overview before those of larger overviews, and the tiles of the overviews
+//     before those of every other layer;
+//   - has disk tiles of at most CloudMaxTileBytes decoded, and at least CloudMinTileBytes unless their
+//     layer fits in a single tile.
+//
+// Returns an error wrapping ErrNotCloudOptimized describing every problem found, or nil if there are none.
+func CheckCloudOptimized(src io.ReadSeeker) error {
+	_, err := src.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	summary, err := pixi.ReadPixi(src)
+	if err != nil {
+		return err
+	}
+	problems := cloudLayerProblems(summary.Layers)
+	if summary.Header.OffsetSize != 8 {
+		problems = append(problems, fmt.Sprintf("offsets are %d bytes rather than 8", summary.Header.OffsetSize))
+	}
+
+	// the end of the structure, and where the tiles of each layer start and end
+	structureEnd := int64(summary.Header.HeaderSize())
+	for _, err := range summary.TagsIter(src) {
+		if err != nil {
+			return err
+		}
+		structureEnd, err = maxPosition(src, structureEnd)
+		if err != nil {
+			return err
+		}
+	}
+	firstTiles := make([]int64, len(summary.Layers))
+	lastTiles := make([]int64, len(summary.Layers))
+	firstTile := int64(-1)
+	for i, layer := range summary.Layers {
+		structureEnd = max(structureEnd, summary.LayerOffset(layer)+int64(layer.HeaderSize(summary.Header)))
+		for _, err := range layer.TagsIter(src, summary.Header) {
+			if err != nil {
+				return err
+			}
+			structureEnd, err = maxPosition(src, structureEnd)
+			if err != nil {
+				return err
+			}
+		}
+		firstTiles[i], lastTiles[i] = -1, -1
+		for tileIndex, offset := range layer.TileOffsets {
+			if layer.TileBytes[tileIndex] == 0 {
+				continue
+			}
+			if firstTiles[i] < 0 || offset < firstTiles[i] {
+				firstTiles[i] = offset
+			}
+			lastTiles[i] = max(lastTiles[i], offset+layer.TileBytes[tileIndex])
+		}
+		if firstTiles[i] >= 0 && (firstTile < 0 || firstTiles[i] < firstTile) {
+			firstTile = firstTiles[i]
+		}
+	}
+	if firstTile >= 0 && firstTile < structureEnd {
+		problems = append(problems, fmt.Sprintf("a tile starts at offset %d, before the end of the headers and tags at %d", firstTile, structureEnd))
+	}
+
+	prev := -1
+	for _, layerIndex := range cloudTileOrder(summary.Layers) {
+		if firstTiles[layerIndex] < 0 {
+			continue
+		}
+		if prev >= 0 && firstTiles[layerIndex] < lastTiles[prev] {
+			problems = append(problems, fmt.Sprintf("tiles of layer '%s' do not all follow those of layer '%s'",
+				summary.Layers[layerIndex].Name, summary.Layers[prev].Name))
+		}
+		prev = layerIndex
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrNotCloudOptimized, strings.Join(problems, "; "))
+}
+
+// The problems that keep layers from being written as a cloud-optimized file in any layout.
+func cloudLayerProblems(layers []*pixi.Layer) []string {
+	problems := []string{}
+	if len(layers) > 0 && layers[0].Dimensions.Tiles() > 1 && len(overviewChain(layers)) == 0 {
+		problems = append(problems, fmt.Sprintf("layer '%s' has %d tiles but no overviews", layers[0].Name, layers[0].Dimensions.Tiles()))
+	}
+	for _, layer := range layers {
+		if layer.DiskTiles() == 0 {
+			continue
+		}
+		sizes := []int{}
+		for diskTile := range layer.DiskTiles() {
+			sizes = append(sizes, layer.DiskTileSize(diskTile))
+		}
+		smallest, largest := slices.Min(sizes), slices.Max(sizes)
+		if largest > CloudMaxTileBytes {
+			problems = append(problems, fmt.Sprintf("tiles of layer '%s' hold %d bytes, more than %d", layer.Name, largest, CloudMaxTileBytes))
+		}
+		if smallest < CloudMinTileBytes && layer.Dimensions.Tiles() > 1 {
+			problems = append(problems, fmt.Sprintf("tiles of layer '%s' hold %d bytes, fewer than %d", layer.Name, smallest, CloudMinTileBytes))
+		}
+	}
+	return problems
+}
+
+// The order in which a cloud-optimized file holds the tiles of its layers: the overviews from the
+// smallest to the largest, then every other layer in order.
+func cloudTileOrder(layers []*pixi.Layer) []int {
+	overviews := overviewChain(layers)
+	order := slices.Clone(overviews)
+	slices.Reverse(order)
+	for i := range layers {
+		if !slices.Contains(overviews, i) {
+			order = append(order, i)
+		}
+	}
+	return order
+}
+
+// The larger of the given offset and the current position of the stream.
+func maxPosition(s io.Seeker, offset int64) (int64, error) {
+	pos, err := s.Seek(0, io.SeekCurrent)
+	return max(offset, pos), err
+}
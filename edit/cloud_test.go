@@ -0,0 +1,84 @@
+package edit
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/internal/buffer"
+)
+
+// Writes a 256x256 base layer in tiles of 32 KiB with a single tile overview, laid out as written, one
+// layer after the other, with 4 byte offsets.
+func writeCloudPyramid(t *testing.T) *buffer.Buffer {
+	t.Helper()
+	header := pixi.PixiHeader{Version: pixi.Version, OffsetSize: 4, ByteOrder: binary.LittleEndian}
+	fields := []pixi.Field{{Name: "height", Type: pixi.FieldUint16}}
+	value := func(layer *pixi.Layer, coord pixi.SampleCoordinate) ([]any, map[string]any) {
+		return []any{uint16(coord[0] + coord[1])}, nil
+	}
+	buf := buffer.NewBuffer(20)
+	err := WriteContiguousTileOrderPixi(buf, header, map[string]string{},
+		LayerWriter{
+			Layer: pixi.NewLayer("base", false, pixi.CompressionFlate,
+				pixi.DimensionSet{{Name: "x", Size: 256, TileSize: 128}, {Name: "y", Size: 256, TileSize: 128}}, fields),
+			IterFn: value,
+		},
+		LayerWriter{
+			Layer: pixi.NewLayer("half", false, pixi.CompressionFlate,
+				pixi.DimensionSet{{Name: "x", Size: 128, TileSize: 128}, {Name: "y", Size: 128, TileSize: 128}}, fields),
+			IterFn: value,
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf
+}
+
+func TestCheckCloudOptimized(t *testing.T) {
+	src := writeCloudPyramid(t)
+	err := CheckCloudOptimized(buffer.NewBufferFrom(src.Bytes()))
+	if !errors.Is(err, ErrNotCloudOptimized) {
+		t.Fatalf("expected a file written layer by layer not to be cloud optimized, got %v", err)
+	}
+	for _, problem := range []string{"offsets are 4 bytes", "before the end of the headers", "do not all follow"} {
+		if !strings.Contains(err.Error(), problem) {
+			t.Errorf("expected the problems to include %q, got %v", problem, err)
+		}
+	}
+
+	// optimizing without the profile only leaves the offsets too small
+	dst := buffer.NewBuffer(20)
+	_, err = Optimize(context.Background(), dst, buffer.NewBufferFrom(src.Bytes()), OptimizeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = CheckCloudOptimized(buffer.NewBufferFrom(dst.Bytes()))
+	if !errors.Is(err, ErrNotCloudOptimized) || strings.Count(err.Error(), ";") != 0 || !strings.Contains(err.Error(), "offsets") {
+		t.Errorf("expected only the offsets to be reported, got %v", err)
+	}
+
+	cloud := buffer.NewBuffer(20)
+	_, err = Optimize(context.Background(), cloud, buffer.NewBufferFrom(src.Bytes()), OptimizeOptions{CloudOptimized: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckCloudOptimized(buffer.NewBufferFrom(cloud.Bytes())); err != nil {
+		t.Errorf("expected the optimized file to be cloud optimized, got %v", err)
+	}
+}
+
+func TestOptimizeCloudRequiresOverviews(t *testing.T) {
+	src := writeIndexedLayer(t, pixi.CompressionNone)
+	dst := buffer.NewBuffer(20)
+	_, err := Optimize(context.Background(), dst, buffer.NewBufferFrom(src.Bytes()), OptimizeOptions{CloudOptimized: true})
+	if !errors.Is(err, ErrNotCloudOptimized) || !strings.Contains(err.Error(), "no overviews") {
+		t.Errorf("expected a layer of several tiles without overviews to be refused, got %v", err)
+	}
+	if len(dst.Bytes()) != 0 {
+		t.Errorf("expected nothing to be written, got %d bytes", len(dst.Bytes()))
+	}
+}
@@ -0,0 +1,124 @@
+package edit
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/owlpinetech/pixi"
+)
+
+// The sizes of a file before and after it was compacted.
+type CompactReport struct {
+	SourceBytes    int64 // The size of the original file.
+	CompactBytes   int64 // The size of the compacted file.
+	ReclaimedBytes int64 // The number of bytes no longer taken, SourceBytes less CompactBytes.
+}
+
+// Copies the Pixi file in src to dst keeping only what is still reachable, for files that have built up
+// dead bytes from in-place edits, appended tiles, and superseded tag sections. The output is laid out as
+// a freshly written file: the header, then the file tags combined into a single section, then each layer
+// with its header, its tiles in index order, and its tags combined into a single section. Scratch layers
+// (see pixi.Layer.Scratch) are reclaimed along with the other dead bytes and not copied. Tiles are
+// copied without being decoded, so their compression and checksums are kept as they are, and tiles that
+// were never written stay unwritten. A content seal (see pixi.SealContent) would no longer match the
+// compacted file, so it is dropped. Cancelling the context stops the copy between tiles.
+func Compact(ctx context.Context, dst io.WriteSeeker, src io.ReadSeeker, progress ProgressFunc) (CompactReport, error) {
+	report := CompactReport{}
+	srcPixi, err := pixi.ReadPixi(src)
+	if err != nil {
+		return report, err
+	}
+	report.SourceBytes, err = src.Seek(0, io.SeekEnd)
+	if err != nil {
+		return report, err
+	}
+
+	tags := mergeTagSections(srcPixi.Tags)
+	delete(tags.Tags, pixi.ContentHashTag)
+	delete(tags.Tags, pixi.ContentSizeTag)
+	layers := make([]derivedLayer, len(srcPixi.Layers))
+	for i, srcLayer := range srcPixi.Layers {
+		layers[i] = derivedLayer{
+			layer:      deriveLayer(srcLayer, srcLayer.Compression, srcLayer.Dimensions),
+			copyFrom:   srcLayer,
+			copyReader: src,
+		}
+	}
+	err = writeDerivedPixi(ctx, dst, srcPixi.Header, tags, layers, progress)
+	if err != nil {
+		return report, err
+	}
+
+	report.CompactBytes, err = dst.Seek(0, io.SeekEnd)
+	if err != nil {
+		return report, err
+	}
+	report.ReclaimedBytes = report.SourceBytes - report.CompactBytes
+	return report, nil
+}
+
+// Compacts the named file in place: the compacted copy is written to a temporary file in the same
+// directory, synced, and renamed over the original, so the original is left untouched if anything fails.
+// An exclusive lock is held on the original throughout (see pixi.OpenFile), waiting for it if asked;
+// writers queued on the lock meanwhile go on to open the compacted file instead of the original.
+func CompactFile(ctx context.Context, name string, waitForLock bool, progress ProgressFunc) (CompactReport, error) {
+	var report CompactReport
+	err := replaceFile(name, waitForLock, "compact", func(dst io.WriteSeeker, src io.ReadSeeker) error {
+		var err error
+		report, err = Compact(ctx, dst, src, progress)
+		return err
+	})
+	return report, err
+}
+
+// Replaces the named file with the copy written by rewrite, which is written to a temporary file in the
+// same directory named after the operation, synced, and renamed over the original while an exclusive
+// lock is held on it, so the original is left untouched if anything fails.
+func replaceFile(name string, waitForLock bool, operation string, rewrite func(dst io.WriteSeeker, src io.ReadSeeker) error) error {
+	src, err := pixi.OpenFile(name, pixi.OpenOptions{Mode: pixi.ReadWrite, WaitForLock: waitForLock})
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+"."+operation+"-*")
+	if err != nil {
+		return err
+	}
+	renamed := false
+	defer func() {
+		tmp.Close()
+		if !renamed {
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	err = rewrite(tmp, src)
+	if err != nil {
+		return err
+	}
+	err = tmp.Chmod(info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	err = tmp.Sync()
+	if err != nil {
+		return err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmp.Name(), name)
+	if err != nil {
+		return err
+	}
+	renamed = true
+	return nil
+}
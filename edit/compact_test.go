@@ -0,0 +1,162 @@
+package edit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/internal/buffer"
+)
+
+// Rewrites tile 0 of the layer at the end of the file and appends a tag section superseding the first,
+// leaving the old tile and tags as dead bytes, as repeated in-place edits would.
+func fragment(t *testing.T, buf *buffer.Buffer) {
+	t.Helper()
+	buf.Seek(0, io.SeekStart)
+	summary, err := pixi.ReadPixi(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layer := summary.Layers[0]
+	data := make([]byte, layer.DiskTileSize(0))
+	err = layer.ReadTile(buf, summary.Header, 0, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Seek(0, io.SeekEnd)
+	err = layer.WriteTile(buf, summary.Header, 0, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = layer.OverwriteHeader(buf, summary.Header, summary.LayerOffset(layer))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tagsOffset, _ := buf.Seek(0, io.SeekEnd)
+	section := &pixi.TagSection{}
+	section.Set("edited", "yes")
+	err = section.Write(buf, summary.Header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = summary.Header.OverwriteOffsets(buf, summary.Header.FirstLayerOffset, tagsOffset)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCompactReclaimsDeadBytes(t *testing.T) {
+	src := writeIndexedLayer(t, pixi.CompressionFlate)
+	fragment(t, src)
+	fragmented := buffer.NewBufferFrom(append([]byte{}, src.Bytes()...))
+	_, err := pixi.SealContent(fragmented)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst := buffer.NewBuffer(20)
+	report, err := Compact(context.Background(), dst, buffer.NewBufferFrom(fragmented.Bytes()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.SourceBytes != int64(len(fragmented.Bytes())) || report.CompactBytes != int64(len(dst.Bytes())) ||
+		report.ReclaimedBytes != report.SourceBytes-report.CompactBytes {
+		t.Errorf("report does not match the file sizes: %+v", report)
+	}
+	if report.ReclaimedBytes <= 0 {
+		t.Errorf("expected dead bytes to be reclaimed, got %+v", report)
+	}
+
+	summary, err := pixi.ReadPixi(buffer.NewBufferFrom(dst.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summary.Tags) != 1 || summary.Tags[0].Tags["edited"] != "yes" || summary.Tags[0].Tags[pixi.ContentHashTag] != "" {
+		t.Errorf("expected the tags to be merged and the seal dropped, got %+v", summary.Tags)
+	}
+	for coord := range summary.Layers[0].Dimensions.SampleCoordinates() {
+		if !reflect.DeepEqual(freshSample(t, dst, coord), freshSample(t, src, coord)) {
+			t.Fatalf("sample at %v changed", coord)
+		}
+	}
+
+	// compacting a compacted file changes nothing
+	again := buffer.NewBuffer(20)
+	report, err = Compact(context.Background(), again, buffer.NewBufferFrom(dst.Bytes()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.ReclaimedBytes != 0 || !reflect.DeepEqual(again.Bytes(), dst.Bytes()) {
+		t.Errorf("expected compaction to be stable, reclaimed %d bytes", report.ReclaimedBytes)
+	}
+}
+
+func TestCompactFileInPlace(t *testing.T) {
+	src := writeIndexedLayer(t, pixi.CompressionNone)
+	fragment(t, src)
+	path := filepath.Join(t.TempDir(), "edited.pixi")
+	err := os.WriteFile(path, src.Bytes(), 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := CompactFile(context.Background(), path, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != report.CompactBytes || report.ReclaimedBytes <= 0 || info.Mode().Perm() != 0640 {
+		t.Errorf("expected the file to be replaced by its compacted copy, got %+v and %d bytes, mode %v", report, info.Size(), info.Mode())
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("expected the temporary file to be gone, found %d entries", len(entries))
+	}
+	data, _ := os.ReadFile(path)
+	if !reflect.DeepEqual(freshSample(t, buffer.NewBufferFrom(data), pixi.SampleCoordinate{7, 3}), freshSample(t, src, pixi.SampleCoordinate{7, 3})) {
+		t.Errorf("expected samples to survive compaction in place")
+	}
+}
+
+func TestCompactDropsScratchLayers(t *testing.T) {
+	src := writeIndexedLayer(t, pixi.CompressionFlate)
+	stage := pixi.NewLayer("stage", false, pixi.CompressionFlate,
+		pixi.DimensionSet{{Name: "x", Size: 4, TileSize: 2}}, []pixi.Field{{Name: "v", Type: pixi.FieldUint8}})
+	stage.Scratch = true
+	err := pixi.AppendLayer(src, stage, 1, func(tileIndex int, data []byte) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst := buffer.NewBuffer(10)
+	report, err := Compact(context.Background(), dst, buffer.NewBufferFrom(src.Bytes()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compacted, err := pixi.ReadPixi(buffer.NewBufferFrom(dst.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(compacted.Layers) != 1 || compacted.Layers[0].Name == "stage" || report.ReclaimedBytes <= 0 {
+		t.Errorf("expected the scratch layer to be reclaimed, got %v and %+v", compacted.Layers, report)
+	}
+}
+
+func TestCompactCancelled(t *testing.T) {
+	src := writeIndexedLayer(t, pixi.CompressionNone)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := Compact(ctx, buffer.NewBuffer(20), buffer.NewBufferFrom(src.Bytes()), nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the copy to be cancelled, got %v", err)
+	}
+}
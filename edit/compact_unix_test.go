@@ -0,0 +1,62 @@
+//go:build unix
+
+package edit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/internal/buffer"
+)
+
+func TestCompactFileWithQueuedAppend(t *testing.T) {
+	src := writeIndexedLayer(t, pixi.CompressionNone)
+	fragment(t, src)
+	path := filepath.Join(t.TempDir(), "queued.pixi")
+	err := os.WriteFile(path, src.Bytes(), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the appender is started while the compaction holds the lock, so it queues on the original file,
+	// which the compacted copy then replaces
+	appended := make(chan error, 1)
+	var start sync.Once
+	_, err = CompactFile(context.Background(), path, false, func(done int, total int) {
+		start.Do(func() {
+			go func() {
+				section := &pixi.TagSection{}
+				section.Set("queued", "yes")
+				appended <- pixi.AppendTagsFile(path, section, true)
+			}()
+			time.Sleep(50 * time.Millisecond)
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = <-appended; err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary, err := pixi.ReadPixi(buffer.NewBufferFrom(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, section := range summary.Tags {
+		found = found || section.Tags["queued"] == "yes"
+	}
+	if !found {
+		t.Errorf("expected the queued append to reach the compacted file")
+	}
+}
@@ -0,0 +1,46 @@
+package edit
+
+import (
+	"context"
+	"io"
+
+	"github.com/owlpinetech/pixi"
+)
+
+// Options for Compress.
+type CompressOptions struct {
+	Compression pixi.Compression   // The compression every layer of the output is stored with.
+	Workers     int                // The number of goroutines encoding tiles, or 0 for GOMAXPROCS.
+	Progress    ProgressFunc       // Called after each tile is read, if not nil.
+	Budget      *pixi.MemoryBudget // Bounds the tiles held in memory while being encoded by bytes, if not nil.
+}
+
+// Copies the Pixi file in src to dst with every layer stored using the compression in the options.
+// Tiles are decoded one at a time and re-encoded in parallel, and layers otherwise keep their names, fields, and
+// tiling. The tiles of layers already stored with that compression are copied unchanged instead, without
+// being decoded (see pixi.Layer.CopyTilesFrom). All file tag sections are combined into a single section in the output, as are the tag
+// sections of each layer. Cancelling the context stops the copy between tiles.
+func Compress(ctx context.Context, dst io.WriteSeeker, src io.ReadSeeker, options CompressOptions) error {
+	srcPixi, err := pixi.ReadPixi(src)
+	if err != nil {
+		return err
+	}
+
+	layers := make([]derivedLayer, len(srcPixi.Layers))
+	for i, srcLayer := range srcPixi.Layers {
+		layer := deriveLayer(srcLayer, options.Compression, srcLayer.Dimensions)
+		if srcLayer.Compression == options.Compression && layer.CanCopyTilesFrom(srcLayer) {
+			layers[i] = derivedLayer{layer: layer, copyFrom: srcLayer, copyReader: src}
+			continue
+		}
+		layers[i] = derivedLayer{
+			layer: layer,
+			tile: func(tileIndex int, data []byte) error {
+				return srcLayer.ReadTile(src, srcPixi.Header, tileIndex, data)
+			},
+			workers: options.Workers,
+			budget:  options.Budget,
+		}
+	}
+	return writeDerivedPixi(ctx, dst, srcPixi.Header, mergeTagSections(srcPixi.Tags), layers, options.Progress)
+}
@@ -0,0 +1,109 @@
+package edit
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/internal/buffer"
+)
+
+func TestCompressKeepsSamples(t *testing.T) {
+	src := writeIndexedLayer(t, pixi.CompressionFlate)
+
+	dst := buffer.NewBuffer(20)
+	progress := []int{}
+	err := Compress(context.Background(), dst, buffer.NewBufferFrom(src.Bytes()), CompressOptions{
+		Compression: pixi.CompressionLzwMsb,
+		Progress: func(done int, total int) {
+			if total != 4 {
+				t.Errorf("expected 4 tiles in total, got %d", total)
+			}
+			progress = append(progress, done)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(progress, []int{1, 2, 3, 4}) {
+		t.Errorf("expected progress after every tile, got %v", progress)
+	}
+
+	summary, err := pixi.ReadPixi(buffer.NewBufferFrom(dst.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Layers[0].Compression != pixi.CompressionLzwMsb {
+		t.Errorf("expected lzw_msb compression, got %v", summary.Layers[0].Compression)
+	}
+	for coord := range summary.Layers[0].Dimensions.SampleCoordinates() {
+		if !reflect.DeepEqual(freshSample(t, dst, coord), freshSample(t, src, coord)) {
+			t.Fatalf("sample at %v changed", coord)
+		}
+	}
+}
+
+func TestCompressCopiesMatchingLayers(t *testing.T) {
+	src := writeIndexedLayer(t, pixi.CompressionFlate)
+	dst := buffer.NewBuffer(20)
+	err := Compress(context.Background(), dst, buffer.NewBufferFrom(src.Bytes()), CompressOptions{Compression: pixi.CompressionFlate})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srcSummary, err := pixi.ReadPixi(buffer.NewBufferFrom(src.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary, err := pixi.ReadPixi(buffer.NewBufferFrom(dst.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srcLayer, layer := srcSummary.Layers[0], summary.Layers[0]
+	for tileIndex := range layer.DiskTiles() {
+		start, srcStart := layer.TileOffsets[tileIndex], srcLayer.TileOffsets[tileIndex]
+		if !reflect.DeepEqual(dst.Bytes()[start:start+layer.TileBytes[tileIndex]], src.Bytes()[srcStart:srcStart+srcLayer.TileBytes[tileIndex]]) {
+			t.Errorf("expected tile %d to be copied without being encoded again", tileIndex)
+		}
+	}
+	for coord := range layer.Dimensions.SampleCoordinates() {
+		if !reflect.DeepEqual(freshSample(t, dst, coord), freshSample(t, src, coord)) {
+			t.Fatalf("sample at %v changed", coord)
+		}
+	}
+}
+
+func TestCompressCancelled(t *testing.T) {
+	src := writeIndexedLayer(t, pixi.CompressionNone)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := Compress(ctx, buffer.NewBuffer(20), buffer.NewBufferFrom(src.Bytes()), CompressOptions{Compression: pixi.CompressionFlate})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the copy to be cancelled, got %v", err)
+	}
+}
+
+func TestCompressWithinBudget(t *testing.T) {
+	src := writeIndexedLayer(t, pixi.CompressionNone)
+	srcSummary, err := pixi.ReadPixi(buffer.NewBufferFrom(src.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// room for two tiles, though eight workers would otherwise read eight ahead
+	budget := pixi.NewMemoryBudget(2 * int64(srcSummary.Layers[0].DiskTileSize(0)))
+	dst := buffer.NewBuffer(20)
+	err = Compress(context.Background(), dst, buffer.NewBufferFrom(src.Bytes()), CompressOptions{Compression: pixi.CompressionFlate, Workers: 8, Budget: budget})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if budget.Used() != 0 || budget.Peak() > budget.Limit() {
+		t.Errorf("expected the tiles to be released within the limit, got %d used with a peak of %d", budget.Used(), budget.Peak())
+	}
+	for coord := range srcSummary.Layers[0].Dimensions.SampleCoordinates() {
+		if !reflect.DeepEqual(freshSample(t, dst, coord), freshSample(t, src, coord)) {
+			t.Fatalf("sample at %v changed", coord)
+		}
+	}
+}
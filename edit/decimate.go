@@ -0,0 +1,135 @@
+package edit
+
+import (
+	"context"
+	"io"
+	"math"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/read"
+)
+
+// How Decimate computes each output sample from the block of input samples it covers.
+type DecimateMethod int
+
+const (
+	DecimateMean    DecimateMethod = iota // The mean of the covered samples, as for overview layers.
+	DecimateNearest                       // The first covered sample, keeping exact values such as class labels or masks.
+)
+
+// Options for Decimate.
+type DecimateOptions struct {
+	Factor     int                // The factor every dimension is reduced by, at least 1; 2 halves each dimension.
+	Method     DecimateMethod     // How each output sample is computed from the samples it covers.
+	CacheTiles int                // The number of source tiles held in memory at once, or 0 for a default.
+	Budget     *pixi.MemoryBudget // Bounds the source tiles held in memory by bytes instead of CacheTiles, if not nil.
+	Workers    int                // The number of source tiles decoded at once, ahead of those being sampled, see pixi.Workers.
+	Progress   ProgressFunc       // Called after each tile is written, if not nil.
+}
+
+// Copies the Pixi file in src to dst with every layer downsampled by the factor in the options. Each
+// dimension of size n becomes ceil(n / factor) samples, keeping its tile size unless that is now larger
+// than the dimension, and the resolution of dimensions that record one is scaled by the factor. All
+// file tag sections are combined into a single section in the output, as are the tag sections of each
+// layer. Cancelling the context stops the copy between tiles.
+func Decimate(ctx context.Context, dst io.WriteSeeker, src io.ReadSeeker, options DecimateOptions) error {
+	srcPixi, layers, err := decimatedLayers(src, options)
+	if err != nil {
+		return err
+	}
+	return writeDerivedPixi(ctx, dst, srcPixi.Header, mergeTagSections(srcPixi.Tags), layers, options.Progress)
+}
+
+// Works out the file Decimate would write, without writing it (see OutputPlan).
+func PlanDecimate(ctx context.Context, src io.ReadSeeker, options DecimateOptions) (OutputPlan, error) {
+	srcPixi, layers, err := decimatedLayers(src, options)
+	if err != nil {
+		return OutputPlan{}, err
+	}
+	return planDerivedPixi(ctx, srcPixi.Header, layers)
+}
+
+func decimatedLayers(src io.ReadSeeker, options DecimateOptions) (pixi.Pixi, []derivedLayer, error) {
+	if options.Factor < 1 {
+		return pixi.Pixi{}, nil, pixi.FormatError("decimation factor must be at least 1")
+	}
+	if options.Method != DecimateMean && options.Method != DecimateNearest {
+		return pixi.Pixi{}, nil, pixi.UnsupportedError("unknown decimation method")
+	}
+	srcPixi, err := pixi.ReadPixi(src)
+	if err != nil {
+		return pixi.Pixi{}, nil, err
+	}
+
+	managers := operationCacheManagers(options.CacheTiles, options.Budget)
+	layers := make([]derivedLayer, len(srcPixi.Layers))
+	for i, srcLayer := range srcPixi.Layers {
+		dims := make(pixi.DimensionSet, len(srcLayer.Dimensions))
+		for d, dim := range srcLayer.Dimensions {
+			dim.Size = (dim.Size + options.Factor - 1) / options.Factor
+			dim.TileSize = min(dim.TileSize, dim.Size)
+			dim.Resolution *= float64(options.Factor)
+			dims[d] = dim
+		}
+		// each layer is read ahead on goroutines of its own, which may outlive sampling it, so they cannot share a position
+		cache := read.NewParallelLayerReadCache(io.NewSectionReader(concurrentReaderAt(src), 0, math.MaxInt64), srcPixi.Header, srcLayer, managers(), options.Workers)
+		decimator := &decimator{src: cache, dims: srcLayer.Dimensions, fields: srcLayer.Fields, factor: options.Factor}
+		sample := decimator.mean
+		if options.Method == DecimateNearest {
+			sample = decimator.nearest
+		}
+		layers[i] = derivedLayer{
+			layer:  deriveLayer(srcLayer, srcLayer.Compression, dims),
+			sample: sample,
+		}
+	}
+	return srcPixi, layers, nil
+}
+
+// Anything samples can be read from by coordinate, such as a read.LayerReadCache.
+type sampleReader interface {
+	SampleAt(coord pixi.SampleCoordinate) ([]any, error)
+}
+
+// Computes the samples of a decimated layer from the samples of the source layer.
+type decimator struct {
+	src    sampleReader
+	dims   pixi.DimensionSet
+	fields []pixi.Field
+	factor int
+}
+
+// The source samples covered by the given output sample, clipped to the source bounds.
+func (d *decimator) covered(coord pixi.SampleCoordinate) Region {
+	start := make(pixi.SampleCoordinate, len(coord))
+	end := make(pixi.SampleCoordinate, len(coord))
+	for i := range coord {
+		start[i] = coord[i] * d.factor
+		end[i] = min(start[i]+d.factor, d.dims[i].Size)
+	}
+	return Region{Start: start, End: end}
+}
+
+func (d *decimator) nearest(coord pixi.SampleCoordinate) ([]any, error) {
+	return d.src.SampleAt(d.covered(coord).Start)
+}
+
+func (d *decimator) mean(coord pixi.SampleCoordinate) ([]any, error) {
+	sums := make([]float64, len(d.fields))
+	count := 0
+	for covered := range d.covered(coord).Coordinates() {
+		sample, err := d.src.SampleAt(covered)
+		if err != nil {
+			return nil, err
+		}
+		for i, field := range d.fields {
+			sums[i] += field.Type.ValueToFloat64(sample[i])
+		}
+		count += 1
+	}
+	mean := make([]any, len(d.fields))
+	for i, field := range d.fields {
+		mean[i] = field.Type.Float64ToValue(sums[i] / float64(count))
+	}
+	return mean, nil
+}
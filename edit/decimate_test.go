@@ -0,0 +1,54 @@
+package edit
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/internal/buffer"
+)
+
+func TestDecimate(t *testing.T) {
+	cases := []struct {
+		name   string
+		method DecimateMethod
+		coord  pixi.SampleCoordinate
+		want   []any
+	}{
+		// the indexed layer stores x + 10y, so the mean of a block is the index of its center
+		{"mean", DecimateMean, pixi.SampleCoordinate{1, 1}, []any{uint32(44), float32(22)}},
+		{"mean clipped edge", DecimateMean, pixi.SampleCoordinate{3, 3}, []any{uint32(99), float32(49.5)}},
+		{"nearest", DecimateNearest, pixi.SampleCoordinate{1, 2}, []any{uint32(63), float32(31.5)}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			src := writeIndexedLayer(t, pixi.CompressionNone)
+			dst := buffer.NewBuffer(20)
+			err := Decimate(context.Background(), dst, buffer.NewBufferFrom(src.Bytes()), DecimateOptions{Factor: 3, Method: c.method})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			summary, err := pixi.ReadPixi(buffer.NewBufferFrom(dst.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			dims := summary.Layers[0].Dimensions
+			if dims[0].Size != 4 || dims[1].Size != 4 || dims[0].TileSize != 4 {
+				t.Errorf("expected 4x4 samples in a single tile, got %v", dims)
+			}
+			if got := freshSample(t, dst, c.coord); !reflect.DeepEqual(got, c.want) {
+				t.Errorf("expected %v at %v, got %v", c.want, c.coord, got)
+			}
+		})
+	}
+}
+
+func TestDecimateInvalidFactor(t *testing.T) {
+	src := writeIndexedLayer(t, pixi.CompressionNone)
+	err := Decimate(context.Background(), buffer.NewBuffer(20), buffer.NewBufferFrom(src.Bytes()), DecimateOptions{Factor: 0})
+	if err == nil {
+		t.Error("expected an error for a zero factor")
+	}
+}
@@ -0,0 +1,326 @@
+package edit
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"iter"
+
+	"github.com/owlpinetech/pixi"
+)
+
+// Reports the progress of a long running operation: the number of tiles done so far, out of the
+// total number of tiles the operation will write. Called after each tile is written, or after each
+// tile is read for operations that encode tiles in parallel, from the goroutine running the operation.
+type ProgressFunc func(done int, total int)
+
+// A layer of a file being derived from one or more existing files, with the function that generates
+// its data. Exactly one of tile, sample, or copyFrom is set: tile fills a whole decoded disk tile at once,
+// for layers that keep the tiling of their source, while sample produces the value of every field at a
+// coordinate within the bounds of the layer, for layers that are resampled or rearranged. copyFrom is a
+// layer with the same compression and tiling whose encoded tiles are copied from copyReader unchanged,
+// leaving tiles it never wrote unwritten. Along with tile, encoded may pick disk tiles to copy unchanged
+// from other layers instead, in which case tile is called for the rest ahead of time on several
+// goroutines, and must be safe for concurrent use. Set alone, encoded picks the disk tiles to copy from
+// any number of other layers, leaving those it does not pick unwritten.
+type derivedLayer struct {
+	layer      *pixi.Layer
+	tile       func(tileIndex int, data []byte) error
+	sample     func(coord pixi.SampleCoordinate) ([]any, error)
+	copyFrom   *pixi.Layer
+	copyReader io.ReadSeeker
+	encoded    func(tileIndex int) (src encodedSource, ok bool)
+	workers    int                // The number of goroutines encoding tiles taken from tile, see pixi.Workers.
+	order      iter.Seq[int]      // The order in which disk tiles are taken from tile, or nil for disk tile order.
+	budget     *pixi.MemoryBudget // Bounds the tiles taken from tile and not yet written by bytes, if not nil.
+}
+
+// A disk tile of another layer, stored in reader, copied as a disk tile of a derived layer still encoded.
+type encodedSource struct {
+	layer  *pixi.Layer
+	reader io.ReadSeeker
+	tile   int
+}
+
+// Writes a complete Pixi file with the given header, a single file tag section, and the derived
+// layers, each layer followed by its own tags. Cancelling the context stops the write between tiles,
+// leaving dst incomplete.
+func writeDerivedPixi(ctx context.Context, dst io.WriteSeeker, header pixi.PixiHeader, tags *pixi.TagSection, layers []derivedLayer, progress ProgressFunc) error {
+	written := make([]*pixi.Layer, len(layers))
+	for i, derived := range layers {
+		written[i] = derived.layer
+	}
+	header.SetFeatures(written, []*pixi.TagSection{tags})
+	err := header.WriteHeader(dst)
+	if err != nil {
+		return err
+	}
+
+	tagsOffset, err := dst.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	err = tags.Write(dst, header)
+	if err != nil {
+		return err
+	}
+
+	firstLayerOffset, err := dst.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if len(layers) == 0 {
+		firstLayerOffset = 0
+	}
+	err = header.OverwriteOffsets(dst, firstLayerOffset, tagsOffset)
+	if err != nil {
+		return err
+	}
+
+	tracker := &progressTracker{report: progress}
+	for _, derived := range layers {
+		tracker.total += derived.layer.DiskTiles()
+	}
+
+	layerOffset := firstLayerOffset
+	for layerInd, derived := range layers {
+		switch {
+		case derived.tile != nil && derived.encoded != nil:
+			err = writeMixedTiles(ctx, dst, header, derived, tracker)
+		case derived.tile != nil:
+			err = writeDerivedTiles(ctx, dst, header, derived, tracker)
+		case derived.copyFrom != nil || derived.encoded != nil:
+			err = writeCopiedTiles(ctx, dst, header, derived, tracker)
+		default:
+			err = writeDerivedSamples(ctx, dst, header, derived, tracker)
+		}
+		if err != nil {
+			return err
+		}
+		err = derived.layer.WriteTags(dst, header)
+		if err != nil {
+			return err
+		}
+
+		nextLayerOffset, err := dst.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		if layerInd < len(layers)-1 {
+			derived.layer.NextLayerStart = nextLayerOffset
+		}
+		err = derived.layer.OverwriteHeader(dst, header, layerOffset)
+		if err != nil {
+			return err
+		}
+		layerOffset = nextLayerOffset
+	}
+	return nil
+}
+
+func writeDerivedTiles(ctx context.Context, dst io.WriteSeeker, header pixi.PixiHeader, derived derivedLayer, tracker *progressTracker) error {
+	layer := derived.layer
+	err := layer.WriteHeader(dst, header)
+	if err != nil {
+		return err
+	}
+	// tiles are counted once they are read, since writing them trails behind by at most the worker count
+	fill := func(tileIndex int, data []byte) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		err := derived.tile(tileIndex, data)
+		if err != nil {
+			return err
+		}
+		tracker.add(1)
+		return nil
+	}
+	order := derived.order
+	if order == nil {
+		order = func(yield func(int) bool) {
+			for tileIndex := range layer.DiskTiles() {
+				if !yield(tileIndex) {
+					return
+				}
+			}
+		}
+	}
+	return layer.WriteTilesWithOptions(dst, header, order, fill, pixi.TileWriteOptions{Workers: derived.workers, Budget: derived.budget})
+}
+
+func writeCopiedTiles(ctx context.Context, dst io.WriteSeeker, header pixi.PixiHeader, derived derivedLayer, tracker *progressTracker) error {
+	layer := derived.layer
+	err := layer.WriteHeader(dst, header)
+	if err != nil {
+		return err
+	}
+	for tileIndex := range layer.DiskTiles() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if derived.encoded != nil {
+			if src, ok := derived.encoded(tileIndex); ok {
+				err = layer.CopyEncodedTileFrom(dst, src.reader, header, src.layer, src.tile, tileIndex)
+			}
+		} else if derived.copyFrom.TileBytes[tileIndex] != 0 {
+			err = layer.CopyEncodedTile(dst, derived.copyReader, header, derived.copyFrom, tileIndex)
+		}
+		if err != nil {
+			return err
+		}
+		tracker.add(1)
+	}
+	return nil
+}
+
+// Writes every disk tile of the layer in order, copying those picked by encoded still encoded, and
+// computing the rest with tile on up to workers goroutines, a few tiles ahead of the tile being written.
+func writeMixedTiles(ctx context.Context, dst io.WriteSeeker, header pixi.PixiHeader, derived derivedLayer, tracker *progressTracker) error {
+	layer := derived.layer
+	err := layer.WriteHeader(dst, header)
+	if err != nil {
+		return err
+	}
+	tileSize := int64(layer.DiskTileSize(0))
+	if layer.Separated {
+		for field := range layer.Fields {
+			tileSize = max(tileSize, int64(layer.DiskTileSize(field*layer.Dimensions.Tiles())))
+		}
+	}
+	next, stop := computeAhead(ctx, pixi.Workers(derived.workers), derived.budget, tileSize, layer.DiskTiles(), func(tileIndex int) ([]byte, error) {
+		if _, ok := derived.encoded(tileIndex); ok {
+			return nil, nil
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		data := make([]byte, layer.DiskTileSize(tileIndex))
+		return data, derived.tile(tileIndex, data)
+	})
+	defer stop()
+	for tileIndex := range layer.DiskTiles() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		data, err := next()
+		if err != nil {
+			return err
+		}
+		if src, ok := derived.encoded(tileIndex); ok {
+			err = layer.CopyEncodedTileFrom(dst, src.reader, header, src.layer, src.tile, tileIndex)
+		} else {
+			err = layer.WriteTile(dst, header, tileIndex, data)
+		}
+		if err != nil {
+			return err
+		}
+		tracker.add(1)
+	}
+	return nil
+}
+
+// Fills a decoded disk tile of the layer with the samples at the coordinates it holds, taken from sample.
+// Samples past the edges of the layer are left zero.
+func fillDiskTile(layer *pixi.Layer, order binary.ByteOrder, tileIndex int, data []byte, sample func(coord pixi.SampleCoordinate) ([]any, error)) error {
+	dims := layer.Dimensions
+	tile, fields := tileIndex, []int{}
+	stride := layer.SampleSize()
+	offsets := make([]int, len(layer.Fields))
+	for i := range layer.Fields[1:] {
+		offsets[i+1] = offsets[i] + layer.Fields[i].Size()
+	}
+	if layer.Separated {
+		tile = tileIndex % dims.Tiles()
+		fields = append(fields, tileIndex/dims.Tiles())
+		stride = layer.Fields[fields[0]].Size()
+		offsets[fields[0]] = 0
+	} else {
+		for i := range layer.Fields {
+			fields = append(fields, i)
+		}
+	}
+
+	start, end := dims.TileBounds(tile)
+	for coord := range (Region{Start: start, End: end}).Coordinates() {
+		values, err := sample(coord)
+		if err != nil {
+			return err
+		}
+		inTile := coord.ToTileSelector(dims).InTile
+		for _, fieldIndex := range fields {
+			layer.Fields[fieldIndex].ValueToBytes(values[fieldIndex], data[inTile*stride+offsets[fieldIndex]:], order)
+		}
+	}
+	return nil
+}
+
+func writeDerivedSamples(ctx context.Context, dst io.WriteSeeker, header pixi.PixiHeader, derived derivedLayer, tracker *progressTracker) error {
+	layer := derived.layer
+	it, err := NewTileOrderWriteIterator(dst, header, layer)
+	if err != nil {
+		return err
+	}
+	diskTilesPerTile := layer.DiskTiles() / layer.Dimensions.Tiles()
+	for tileIndex := range layer.Dimensions.Tiles() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		start, end := layer.Dimensions.TileBounds(tileIndex)
+		for coord := range (Region{Start: start, End: end}).Coordinates() {
+			err = it.SeekTo(coord)
+			if err != nil {
+				return err
+			}
+			if !it.Next() {
+				return it.Err()
+			}
+			sample, err := derived.sample(coord)
+			if err != nil {
+				return err
+			}
+			it.SetSample(sample)
+		}
+		// the tile is only written once iteration moves past it, so count it when the next one starts
+		if tileIndex > 0 {
+			tracker.add(diskTilesPerTile)
+		}
+	}
+	err = it.Done()
+	if err != nil {
+		return err
+	}
+	tracker.add(diskTilesPerTile)
+	return nil
+}
+
+type progressTracker struct {
+	report ProgressFunc
+	done   int
+	total  int
+}
+
+func (p *progressTracker) add(tiles int) {
+	p.done += tiles
+	if p.report != nil {
+		p.report(p.done, p.total)
+	}
+}
+
+// Creates a layer with the same name, fields, separation, alignment, and (merged) tags as the source
+// layer, but with the given compression and dimensions.
+func deriveLayer(src *pixi.Layer, compression pixi.Compression, dims pixi.DimensionSet) *pixi.Layer {
+	layer := pixi.NewLayer(src.Name, src.Separated, compression, dims, src.Fields)
+	layer.TileAlignment = src.TileAlignment
+	layer.Scratch = src.Scratch
+	if src.TileRanges != nil {
+		layer.RecordTileRanges()
+	}
+	if src.TileCompressions != nil {
+		layer.RecordTileCompressions()
+	}
+	if len(src.Tags) > 0 {
+		layer.Tags = []*pixi.TagSection{mergeTagSections(src.Tags)}
+	}
+	return layer
+}
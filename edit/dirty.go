@@ -0,0 +1,75 @@
+package edit
+
+import (
+	"iter"
+	"slices"
+
+	"github.com/owlpinetech/pixi"
+)
+
+// A writable layer that keeps track of which of its tiles have been modified since it was last flushed
+// to its backing stream, so that work derived from the layer (such as overviews or statistics) can be
+// updated for only the tiles that were touched.
+type DirtyTracker interface {
+	// The layer being modified.
+	Layer() *pixi.Layer
+	// The indices of the tiles modified since the last flush, in ascending order. Indices are those of
+	// the layer's tiles (between 0 and Dimensions.Tiles()), so for separated layers a tile is reported
+	// once no matter how many of its fields were modified.
+	DirtyTiles() []int
+}
+
+// A rectangular region of samples in a layer, from Start (inclusive) to End (exclusive) in every dimension.
+type Region struct {
+	Start pixi.SampleCoordinate
+	End   pixi.SampleCoordinate
+}
+
+// The sample regions covered by the dirty tiles of a tracker, one region per tile.
+func DirtyRegions(tracker DirtyTracker) []Region {
+	dims := tracker.Layer().Dimensions
+	dirty := tracker.DirtyTiles()
+	regions := make([]Region, len(dirty))
+	for i, tileIndex := range dirty {
+		regions[i].Start, regions[i].End = dims.TileBounds(tileIndex)
+	}
+	return regions
+}
+
+// Converts a set of disk tile indices into the sorted, distinct indices of the tiles they belong to.
+func diskTilesToTiles(layer *pixi.Layer, diskTiles []int) []int {
+	tiles := make([]int, len(diskTiles))
+	for i, diskTile := range diskTiles {
+		tiles[i] = diskTile % layer.Dimensions.Tiles()
+	}
+	slices.Sort(tiles)
+	return slices.Compact(tiles)
+}
+
+// Iterates over the coordinates of every sample in the region, varying the first dimension fastest.
+func (r Region) Coordinates() iter.Seq[pixi.SampleCoordinate] {
+	return func(yield func(pixi.SampleCoordinate) bool) {
+		for i := range r.Start {
+			if r.Start[i] >= r.End[i] {
+				return
+			}
+		}
+		coord := slices.Clone(r.Start)
+		for {
+			if !yield(coord) {
+				return
+			}
+			dim := 0
+			for ; dim < len(coord); dim++ {
+				coord[dim] += 1
+				if coord[dim] < r.End[dim] {
+					break
+				}
+				coord[dim] = r.Start[dim]
+			}
+			if dim == len(coord) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package edit
+
+import (
+	"encoding/binary"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/internal/buffer"
+)
+
+func TestDirtyTrackers(t *testing.T) {
+	for _, separated := range []bool{false, true} {
+		var trackers []DirtyTracker
+		var setters []func(pixi.SampleCoordinate, int, any)
+		var flushers []func() error
+
+		buf := writeBlankSeparatedLayer(t, pixi.CompressionFlate)
+		if !separated {
+			buf = writeIndexedLayer(t, pixi.CompressionFlate)
+		}
+		mem := openMemoryLayer(t, buf)
+		trackers = append(trackers, mem)
+		setters = append(setters, mem.SetFieldAt)
+		flushers = append(flushers, mem.Commit)
+
+		for _, mode := range []WriteMode{WriteThrough, WriteBack} {
+			buf := writeBlankSeparatedLayer(t, pixi.CompressionFlate)
+			if !separated {
+				buf = writeIndexedLayer(t, pixi.CompressionFlate)
+			}
+			cache := openFifoCache(t, buf, mode, 1)
+			trackers = append(trackers, cache)
+			setters = append(setters, func(coord pixi.SampleCoordinate, fieldIndex int, value any) {
+				if err := cache.SetFieldAt(coord, fieldIndex, value); err != nil {
+					t.Fatal(err)
+				}
+			})
+			flushers = append(flushers, cache.Flush)
+		}
+
+		spill, err := NewSpillWriter(pixi.PixiHeader{Version: pixi.Version, OffsetSize: 4, ByteOrder: binary.LittleEndian},
+			mem.Layer(), t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer spill.Close()
+		trackers = append(trackers, spill)
+		setters = append(setters, func(coord pixi.SampleCoordinate, fieldIndex int, value any) {
+			if err := spill.SetFieldAt(coord, fieldIndex, value); err != nil {
+				t.Fatal(err)
+			}
+		})
+		flushers = append(flushers, func() error { return spill.Assemble(buffer.NewBuffer(10)) })
+
+		for i, tracker := range trackers {
+			setters[i](pixi.SampleCoordinate{7, 8}, 0, uint32(1))
+			setters[i](pixi.SampleCoordinate{7, 8}, 1, float32(1))
+			setters[i](pixi.SampleCoordinate{2, 1}, 1, float32(1))
+			if got := tracker.DirtyTiles(); !slices.Equal(got, []int{0, 3}) {
+				t.Errorf("tracker %d: expected tiles 0 and 3 to be dirty, got %v", i, got)
+			}
+			wantRegions := []Region{
+				{Start: pixi.SampleCoordinate{0, 0}, End: pixi.SampleCoordinate{5, 5}},
+				{Start: pixi.SampleCoordinate{5, 5}, End: pixi.SampleCoordinate{10, 10}},
+			}
+			if got := DirtyRegions(tracker); !reflect.DeepEqual(got, wantRegions) {
+				t.Errorf("tracker %d: expected regions %v, got %v", i, wantRegions, got)
+			}
+			if err := flushers[i](); err != nil {
+				t.Fatal(err)
+			}
+			if got := tracker.DirtyTiles(); len(got) != 0 {
+				t.Errorf("tracker %d: expected no dirty tiles after flushing, got %v", i, got)
+			}
+		}
+	}
+}
+
+func TestDirtyTrackersWholeSamples(t *testing.T) {
+	for _, separated := range []bool{false, true} {
+		var trackers []DirtyTracker
+		var setters []func(pixi.SampleCoordinate, []any) error
+
+		for _, mode := range []WriteMode{WriteThrough, WriteBack} {
+			buf := writeBlankSeparatedLayer(t, pixi.CompressionNone)
+			if !separated {
+				buf = writeIndexedLayer(t, pixi.CompressionNone)
+			}
+			cache := openFifoCache(t, buf, mode, 1)
+			trackers = append(trackers, cache)
+			setters = append(setters, cache.SetSampleAt)
+		}
+		layer := pixi.NewLayer("spilled", separated, pixi.CompressionNone,
+			pixi.DimensionSet{{Name: "x", Size: 10, TileSize: 5}, {Name: "y", Size: 10, TileSize: 5}},
+			[]pixi.Field{{Name: "index", Type: pixi.FieldUint32}, {Name: "half", Type: pixi.FieldFloat32}})
+		spill, err := NewSpillWriter(pixi.PixiHeader{Version: pixi.Version, OffsetSize: 4, ByteOrder: binary.LittleEndian}, layer, t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer spill.Close()
+		trackers = append(trackers, spill)
+		setters = append(setters, spill.SetSampleAt)
+
+		for i, tracker := range trackers {
+			if err := setters[i](pixi.SampleCoordinate{1, 7}, []any{uint32(1), float32(1)}); err != nil {
+				t.Fatal(err)
+			}
+			if got := tracker.DirtyTiles(); !slices.Equal(got, []int{2}) {
+				t.Errorf("tracker %d: expected tile 2 to be dirty after setting a sample, got %v", i, got)
+			}
+		}
+	}
+}
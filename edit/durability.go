@@ -0,0 +1,69 @@
+package edit
+
+import (
+	"os"
+
+	"github.com/owlpinetech/pixi"
+)
+
+// Options controlling when writers force the data they have written to stable storage, for pipelines
+// that must guarantee persistence before acknowledging work upstream. The zero value never syncs,
+// leaving persistence to the operating system. Syncing requires the backing stream to implement Syncer,
+// as *os.File does. Durability is honoured by the writers with a SetDurability method: ReorderingWriter,
+// TileOrderWriteIterator, FifoCacheLayer, MemoryLayer and SpillWriter. Functions writing whole files at
+// once, such as WriteContiguousTileOrderPixi and AssembleShards, leave syncing to the caller, or can
+// write to a file opened with CreateSynchronous.
+type Durability struct {
+	SyncEveryTiles int  // If positive, the backing stream is synced after every batch of this many tiles is written.
+	SyncOnFinish   bool // If true, the backing stream is synced when the writer finishes (on Done, Flush, Assemble, or Commit).
+}
+
+// A stream that can commit its written contents to stable storage.
+type Syncer interface {
+	Sync() error
+}
+
+// Creates (or truncates) the named file for writing with synchronous I/O, so that every write returns
+// only once its data has reached stable storage. This gives the strongest durability, at a significant
+// cost in write speed, without needing any Durability options.
+func CreateSynchronous(name string) (*os.File, error) {
+	return os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_SYNC, 0666)
+}
+
+// Tracks tiles written by a writer and syncs the backing stream according to the durability options.
+type syncPolicy struct {
+	durability Durability
+	syncer     Syncer
+	pending    int
+}
+
+func newSyncPolicy(backing any, durability Durability) (syncPolicy, error) {
+	if durability == (Durability{}) {
+		return syncPolicy{}, nil
+	}
+	syncer, ok := backing.(Syncer)
+	if !ok {
+		return syncPolicy{}, pixi.UnsupportedError("durability options require a backing stream that can be synced")
+	}
+	return syncPolicy{durability: durability, syncer: syncer}, nil
+}
+
+func (s *syncPolicy) tilesWritten(count int) error {
+	if s.durability.SyncEveryTiles <= 0 {
+		return nil
+	}
+	s.pending += count
+	if s.pending < s.durability.SyncEveryTiles {
+		return nil
+	}
+	s.pending = 0
+	return s.syncer.Sync()
+}
+
+func (s *syncPolicy) finished() error {
+	if !s.durability.SyncOnFinish {
+		return nil
+	}
+	s.pending = 0
+	return s.syncer.Sync()
+}
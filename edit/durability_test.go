@@ -0,0 +1,138 @@
+package edit
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/internal/buffer"
+	"github.com/owlpinetech/pixi/pixitest"
+)
+
+func newDurabilityIterator(t *testing.T, file *pixitest.Stream, durability Durability) *TileOrderWriteIterator {
+	t.Helper()
+	header := pixi.PixiHeader{Version: pixi.Version, OffsetSize: 4, ByteOrder: binary.LittleEndian}
+	layer := pixi.NewLayer("durable", false, pixi.CompressionNone,
+		pixi.DimensionSet{{Name: "x", Size: 8, TileSize: 2}}, []pixi.Field{{Name: "v", Type: pixi.FieldUint16}})
+	it, err := NewTileOrderWriteIterator(file, header, layer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = it.SetDurability(durability)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return it
+}
+
+func TestDurabilitySyncBatches(t *testing.T) {
+	file := pixitest.NewStream(nil)
+	it := newDurabilityIterator(t, file, Durability{SyncEveryTiles: 2, SyncOnFinish: true})
+	for it.Next() {
+		it.SetField(0, uint16(it.Coordinate()[0]))
+	}
+	err := it.Done()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// four tiles synced in two batches, then once more when finishing
+	if file.Syncs() != 3 {
+		t.Errorf("expected 3 syncs, got %d", file.Syncs())
+	}
+}
+
+func TestDurabilityFailures(t *testing.T) {
+	file := pixitest.NewStream(nil)
+	file.Inject(pixitest.Fault{Op: pixitest.OpSync})
+	it := newDurabilityIterator(t, file, Durability{SyncOnFinish: true})
+	for it.Next() {
+	}
+	if err := it.Done(); !errors.Is(err, pixitest.ErrInjected) {
+		t.Errorf("expected failed sync to be reported by Done, got %v", err)
+	}
+
+	file = pixitest.NewStream(nil)
+	it = newDurabilityIterator(t, file, Durability{SyncEveryTiles: 1})
+	file.Inject(pixitest.Fault{Op: pixitest.OpWrite, Call: file.Calls(pixitest.OpWrite) + 3})
+	visited := 0
+	for it.Next() {
+		visited += 1
+	}
+	if !errors.Is(it.Err(), pixitest.ErrInjected) {
+		t.Errorf("expected failed write to stop iteration, got %v", it.Err())
+	}
+	if visited == 8 || file.Syncs() == 0 {
+		t.Errorf("expected iteration to stop partway after syncing earlier tiles, visited %d with %d syncs", visited, file.Syncs())
+	}
+
+	header := pixi.PixiHeader{Version: pixi.Version, OffsetSize: 4, ByteOrder: binary.LittleEndian}
+	layer := pixi.NewLayer("plain", false, pixi.CompressionNone,
+		pixi.DimensionSet{{Name: "x", Size: 2, TileSize: 2}}, []pixi.Field{{Name: "v", Type: pixi.FieldUint16}})
+	plain, err := NewReorderingWriter(buffer.NewBuffer(10), header, layer, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plain.SetDurability(Durability{SyncOnFinish: true}) == nil {
+		t.Error("expected durability on a stream without Sync to be rejected")
+	}
+	if plain.SetDurability(Durability{}) != nil {
+		t.Error("expected default durability to be accepted on any stream")
+	}
+}
+
+func TestDurabilityMemoryLayerCommit(t *testing.T) {
+	file := pixitest.NewStream(writeIndexedLayer(t, pixi.CompressionFlate).Bytes())
+	_, err := file.Seek(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary, err := pixi.ReadPixi(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem, err := NewMemoryLayer(file, summary.Header, summary.Layers[0], summary.LayerOffset(summary.Layers[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = mem.SetDurability(Durability{SyncEveryTiles: 1, SyncOnFinish: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem.SetFieldAt(pixi.SampleCoordinate{0, 0}, 0, uint32(7))
+	mem.SetFieldAt(pixi.SampleCoordinate{9, 9}, 0, uint32(7))
+	err = mem.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.Syncs() != 3 {
+		t.Errorf("expected a sync per changed tile and one on commit, got %d", file.Syncs())
+	}
+	if file.Dirty() {
+		t.Error("expected nothing left unsynced after the commit")
+	}
+}
+
+func TestDurabilitySpillWriterAssemble(t *testing.T) {
+	header := pixi.PixiHeader{Version: pixi.Version, OffsetSize: 4, ByteOrder: binary.LittleEndian}
+	layer := pixi.NewLayer("spilled", false, pixi.CompressionNone,
+		pixi.DimensionSet{{Name: "x", Size: 8, TileSize: 2}}, []pixi.Field{{Name: "v", Type: pixi.FieldUint16}})
+	spill, err := NewSpillWriter(header, layer, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spill.Close()
+	spill.SetDurability(Durability{SyncEveryTiles: 3, SyncOnFinish: true})
+
+	file := pixitest.NewStream(nil)
+	if err = spill.Assemble(file); err != nil {
+		t.Fatal(err)
+	}
+	// one sync after the first three of four tiles, then once more when finishing
+	if file.Syncs() != 2 {
+		t.Errorf("expected 2 syncs, got %d", file.Syncs())
+	}
+	if err = spill.Assemble(buffer.NewBuffer(10)); err == nil {
+		t.Error("expected assembling into a stream without Sync to be rejected")
+	}
+}
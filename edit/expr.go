@@ -0,0 +1,163 @@
+package edit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/owlpinetech/pixi"
+)
+
+// Compiles an arithmetic expression over the fields of a layer, such as "(nir - red) / (nir + red)", into
+// a function of the values of the fields of a sample, in field order. Expressions are made of numbers,
+// field names, the operators + - * / with the usual precedence, unary minus and parentheses. Field names
+// that are not identifiers can be written in double quotes.
+func compileBandMath(expression string, fields pixi.FieldSet) (func(values []float64) float64, error) {
+	p := &exprParser{text: expression, fields: fields}
+	eval, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.text) {
+		return nil, p.errorf("unexpected %q", p.text[p.pos:])
+	}
+	return eval, nil
+}
+
+type exprParser struct {
+	text   string
+	pos    int
+	fields pixi.FieldSet
+}
+
+func (p *exprParser) errorf(format string, args ...any) error {
+	return pixi.FormatError(fmt.Sprintf("band math expression %q at %d: ", p.text, p.pos) + fmt.Sprintf(format, args...))
+}
+
+func (p *exprParser) skipSpace() {
+	for p.pos < len(p.text) && p.text[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+// Consumes the next character if it is one of the given operators, returning it.
+func (p *exprParser) operator(ops string) (byte, bool) {
+	p.skipSpace()
+	if p.pos < len(p.text) && strings.IndexByte(ops, p.text[p.pos]) >= 0 {
+		p.pos++
+		return p.text[p.pos-1], true
+	}
+	return 0, false
+}
+
+func (p *exprParser) sum() (func([]float64) float64, error) {
+	left, err := p.product()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.operator("+-")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.product()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		if op == '+' {
+			left = func(v []float64) float64 { return l(v) + right(v) }
+		} else {
+			left = func(v []float64) float64 { return l(v) - right(v) }
+		}
+	}
+}
+
+func (p *exprParser) product() (func([]float64) float64, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.operator("*/")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		if op == '*' {
+			left = func(v []float64) float64 { return l(v) * right(v) }
+		} else {
+			left = func(v []float64) float64 { return l(v) / right(v) }
+		}
+	}
+}
+
+func (p *exprParser) unary() (func([]float64) float64, error) {
+	if _, ok := p.operator("-"); ok {
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(v []float64) float64 { return -operand(v) }, nil
+	}
+	return p.primary()
+}
+
+func (p *exprParser) primary() (func([]float64) float64, error) {
+	p.skipSpace()
+	if p.pos >= len(p.text) {
+		return nil, p.errorf("unexpected end of expression")
+	}
+	start := p.pos
+	c := rune(p.text[p.pos])
+	switch {
+	case c == '(':
+		p.pos++
+		inner, err := p.sum()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := p.operator(")"); !ok {
+			return nil, p.errorf("missing closing parenthesis")
+		}
+		return inner, nil
+	case c == '"':
+		end := strings.IndexByte(p.text[p.pos+1:], '"')
+		if end < 0 {
+			return nil, p.errorf("missing closing quote")
+		}
+		p.pos += end + 2
+		return p.field(p.text[start+1 : p.pos-1])
+	case unicode.IsDigit(c) || c == '.':
+		for p.pos < len(p.text) && (unicode.IsDigit(rune(p.text[p.pos])) || strings.IndexByte(".eE", p.text[p.pos]) >= 0 ||
+			(strings.IndexByte("+-", p.text[p.pos]) >= 0 && strings.IndexByte("eE", p.text[p.pos-1]) >= 0)) {
+			p.pos++
+		}
+		value, err := strconv.ParseFloat(p.text[start:p.pos], 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %q", p.text[start:p.pos])
+		}
+		return func([]float64) float64 { return value }, nil
+	case unicode.IsLetter(c) || c == '_':
+		for p.pos < len(p.text) && (unicode.IsLetter(rune(p.text[p.pos])) || unicode.IsDigit(rune(p.text[p.pos])) || p.text[p.pos] == '_') {
+			p.pos++
+		}
+		return p.field(p.text[start:p.pos])
+	default:
+		return nil, p.errorf("unexpected %q", c)
+	}
+}
+
+func (p *exprParser) field(name string) (func([]float64) float64, error) {
+	index, ok := p.fields.ByName(name)
+	if !ok {
+		return nil, p.errorf("no field named %q", name)
+	}
+	return func(v []float64) float64 { return v[index] }, nil
+}
@@ -4,9 +4,14 @@ import (
 	"encoding/binary"
 	"image"
 	"image/color"
+	"image/draw"
 	"io"
+	"math"
+	"slices"
+	"strconv"
 
 	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/colorext"
 	"github.com/owlpinetech/pixi/read"
 )
 
@@ -16,67 +21,220 @@ type FromImageOptions struct {
 	XTileSize   int
 	YTileSize   int
 	Tags        map[string]string
+	// The number of downsampled overview layers to write after the image layer, each half the width
+	// and height of the layer before it (rounded up), with each sample the mean of the samples it covers
+	// as computed by UpdateOverviews. Fewer are written if the image is too small to halve that many times.
+	// Overviews are not supported for paletted images.
+	Overviews int
+	// Whether to write a layer named "mask" after the image and its overviews, with a single uint8 field
+	// that is 255 where the image is at all opaque and 0 where it is fully transparent.
+	Mask bool
+	// Whether to write the image even if its tile sizes are known to make it very slow to read (see
+	// pixi.DimensionSet.CheckTiling), rather than failing with pixi.ErrSlowTiling.
+	AllowSlowTiling bool
 }
 
+// Writes a new Pixi file holding the image in its first layer, with the color model of the image named
+// in the "color-model" tag, followed by the overview and mask layers requested in the options so that
+// the file is ready to be shown by a viewer.
 func PixiFromImage(w io.WriteSeeker, img image.Image, options FromImageOptions) error {
 	header := pixi.PixiHeader{Version: pixi.Version, OffsetSize: 4, ByteOrder: options.ByteOrder}
-	// write the header first
-	err := header.WriteHeader(w)
-	if err != nil {
-		return err
-	}
 
 	layer, err := ImageToLayer(img, "image", false, options.Compression, options.XTileSize, options.YTileSize)
 	if err != nil {
 		return err
 	}
+	if !options.AllowSlowTiling {
+		err = layer.Dimensions.CheckTiling()
+		if err != nil {
+			return err
+		}
+	}
+
+	// copy the tags so that the caller's map is left untouched and repeated writes are identical
+	tags := make(map[string]string, len(options.Tags)+1)
+	for k, v := range options.Tags {
+		tags[k] = v
+	}
+	tags["color-model"] = colorModelName(img.ColorModel())
+
+	layerWriters := []LayerWriter{{
+		Layer: layer,
+		IterFn: func(layer *pixi.Layer, coord pixi.SampleCoordinate) ([]any, map[string]any) {
+			return imageSample(img, coord[0], coord[1]), nil
+		},
+	}}
+	if options.Overviews > 0 {
+		if _, ok := img.ColorModel().(color.Palette); ok {
+			return pixi.UnsupportedError("overviews of paletted images are not supported")
+		}
+		layerWriters = append(layerWriters, imageOverviews(img, layer, options.Overviews)...)
+	}
+	if options.Mask {
+		mask := pixi.NewLayer("mask", false, options.Compression, layer.Dimensions, []pixi.Field{{Name: "mask", Type: pixi.FieldUint8}})
+		layerWriters = append(layerWriters, LayerWriter{
+			Layer: mask,
+			IterFn: func(layer *pixi.Layer, coord pixi.SampleCoordinate) ([]any, map[string]any) {
+				_, _, _, a := img.At(coord[0], coord[1]).RGBA()
+				if a == 0 {
+					return []any{uint8(0)}, nil
+				}
+				return []any{uint8(math.MaxUint8)}, nil
+			},
+		})
+	}
+
+	return WriteContiguousTileOrderPixi(w, header, tags, layerWriters...)
+}
 
+// The values of the fields of the layer created by ImageToLayer for the pixel at the given position.
+func imageSample(img image.Image, x int, y int) []any {
+	if paletted, ok := img.(image.PalettedImage); ok {
+		if _, ok := img.ColorModel().(color.Palette); ok {
+			return []any{paletted.ColorIndexAt(x, y)}
+		}
+	}
+	pixel := img.At(x, y)
 	switch img.ColorModel() {
 	case color.NRGBAModel:
-		options.Tags["color-model"] = "nrgba"
+		col := pixel.(color.NRGBA)
+		return []any{col.R, col.G, col.B, col.A}
 	case color.NRGBA64Model:
-		options.Tags["color-model"] = "nrgba64"
+		col := pixel.(color.NRGBA64)
+		return []any{col.R, col.G, col.B, col.A}
 	case color.RGBAModel:
-		options.Tags["color-model"] = "rgba"
+		col := pixel.(color.RGBA)
+		return []any{col.R, col.G, col.B, col.A}
 	case color.RGBA64Model:
-		options.Tags["color-model"] = "rgba64"
+		col := pixel.(color.RGBA64)
+		return []any{col.R, col.G, col.B, col.A}
 	case color.CMYKModel:
-		options.Tags["color-model"] = "cmyk"
+		col := pixel.(color.CMYK)
+		return []any{col.C, col.M, col.Y, col.K}
 	case color.YCbCrModel:
-		options.Tags["color-model"] = "YCbCr"
+		col := pixel.(color.YCbCr)
+		return []any{col.Y, col.Cb, col.Cr}
+	case color.GrayModel:
+		col := pixel.(color.Gray)
+		return []any{col.Y}
+	case color.Gray16Model:
+		col := pixel.(color.Gray16)
+		return []any{col.Y}
+	case colorext.RGBModel:
+		col := pixel.(colorext.RGB)
+		return []any{col.R, col.G, col.B}
+	case colorext.Gray32fModel:
+		col := pixel.(colorext.Gray32f)
+		return []any{col.Y}
 	}
+	panic("unsupported color model")
+}
 
-	return WriteContiguousTileOrderPixi(w, header, options.Tags, LayerWriter{
-		Layer: layer,
-		IterFn: func(layer *pixi.Layer, coord pixi.SampleCoordinate) ([]any, map[string]any) {
-			pixel := img.At(coord[0], coord[1])
-			switch img.ColorModel() {
-			case color.NRGBAModel:
-				col := pixel.(color.NRGBA)
-				return []any{col.R, col.G, col.B, col.A}, nil
-			case color.NRGBA64Model:
-				col := pixel.(color.NRGBA64)
-				return []any{col.R, col.G, col.B, col.A}, nil
-			case color.RGBAModel:
-				col := pixel.(color.RGBA)
-				return []any{col.R, col.G, col.B, col.A}, nil
-			case color.RGBA64Model:
-				col := pixel.(color.RGBA64)
-				return []any{col.R, col.G, col.B, col.A}, nil
-			case color.CMYKModel:
-				col := pixel.(color.CMYK)
-				return []any{col.C, col.M, col.Y, col.K}, nil
-			case color.YCbCrModel:
-				col := pixel.(color.YCbCr)
-				return []any{col.Y, col.Cb, col.Cr}, nil
+// Computes up to the given number of overview layers of the image layer in memory, each layer half the
+// size of the one before it, and returns writers for them.
+func imageOverviews(img image.Image, base *pixi.Layer, levels int) []LayerWriter {
+	width, height := base.Dimensions[0].Size, base.Dimensions[1].Size
+	prev := func(x int, y int) []any { return imageSample(img, x, y) }
+	zero := make([]any, len(base.Fields)) // for the padding samples of partial tiles
+	for fieldIndex, field := range base.Fields {
+		zero[fieldIndex] = field.Type.Float64ToValue(0)
+	}
+	writers := []LayerWriter{}
+	for level := 1; level <= levels && (width > 1 || height > 1); level++ {
+		prevWidth, prevHeight := width, height
+		width, height = (width+1)/2, (height+1)/2
+		samples := make([][]any, width*height)
+		for y := range height {
+			for x := range width {
+				sample := make([]any, len(base.Fields))
+				for fieldIndex, field := range base.Fields {
+					sum, count := 0.0, 0
+					// sum in the same order as coveredMean, so that UpdateOverviews reproduces these values
+					for cy := 2 * y; cy < min(2*y+2, prevHeight); cy++ {
+						for cx := 2 * x; cx < min(2*x+2, prevWidth); cx++ {
+							sum += field.Type.ValueToFloat64(prev(cx, cy)[fieldIndex])
+							count += 1
+						}
+					}
+					sample[fieldIndex] = field.Type.Float64ToValue(sum / float64(count))
+				}
+				samples[y*width+x] = sample
 			}
-			panic("unsupported color model")
-		},
-	})
+		}
+		levelWidth := width
+		prev = func(x int, y int) []any { return samples[y*levelWidth+x] }
+
+		overview := pixi.NewLayer("overview"+strconv.Itoa(level), false, base.Compression,
+			pixi.DimensionSet{
+				{Name: "x", Size: width, TileSize: min(base.Dimensions[0].TileSize, width)},
+				{Name: "y", Size: height, TileSize: min(base.Dimensions[1].TileSize, height)}},
+			base.Fields)
+		writers = append(writers, LayerWriter{
+			Layer: overview,
+			IterFn: func(layer *pixi.Layer, coord pixi.SampleCoordinate) ([]any, map[string]any) {
+				if coord[0] >= levelWidth || coord[1] >= len(samples)/levelWidth {
+					return zero, nil
+				}
+				return samples[coord[1]*levelWidth+coord[0]], nil
+			},
+		})
+	}
+	return writers
 }
 
+// The name of the color model recorded in the "color-model" tag of files converted from images, or
+// an empty string if the color model is not supported.
+func colorModelName(model color.Model) string {
+	if _, ok := model.(color.Palette); ok {
+		return "paletted"
+	}
+	switch model {
+	case color.NRGBAModel:
+		return "nrgba"
+	case color.NRGBA64Model:
+		return "nrgba64"
+	case color.RGBAModel:
+		return "rgba"
+	case color.RGBA64Model:
+		return "rgba64"
+	case color.CMYKModel:
+		return "cmyk"
+	case color.YCbCrModel:
+		return "YCbCr"
+	case color.GrayModel:
+		return "gray"
+	case color.Gray16Model:
+		return "gray16"
+	case colorext.RGBModel:
+		return "rgb"
+	case colorext.Gray32fModel:
+		return "gray32f"
+	default:
+		return ""
+	}
+}
+
+// Creates a layer to hold the given image, with one field per channel of the image's color model. The
+// colors of paletted images are stored as a binary "palette" tag of the layer, with four bytes (non-
+// premultiplied red, green, blue, and alpha) per color, and each sample holds an index into the palette.
+// A tile size of 0 is replaced by the one pixi.SuggestTileSize suggests for random access, so that large
+// images are not stored as a single tile.
 func ImageToLayer(img image.Image, layerName string, separated bool, compression pixi.Compression, xTileSize int, yTileSize int) (*pixi.Layer, error) {
 	var fields []pixi.Field
+	var layerTags *pixi.TagSection
+	if palette, ok := img.ColorModel().(color.Palette); ok {
+		if len(palette) > 256 {
+			return nil, pixi.UnsupportedError("palettes of more than 256 colors not supported for conversion to Pixi")
+		}
+		paletteBytes := make([]byte, 0, 4*len(palette))
+		for _, c := range palette {
+			col := color.NRGBAModel.Convert(c).(color.NRGBA)
+			paletteBytes = append(paletteBytes, col.R, col.G, col.B, col.A)
+		}
+		layerTags = &pixi.TagSection{}
+		layerTags.SetBinary("palette", paletteBytes)
+		fields = []pixi.Field{{Name: "index", Type: pixi.FieldUint8}}
+	}
 	switch img.ColorModel() {
 	case color.NRGBAModel:
 		fields = []pixi.Field{
@@ -119,82 +277,445 @@ func ImageToLayer(img image.Image, layerName string, separated bool, compression
 			{Name: "Cb", Type: pixi.FieldUint8},
 			{Name: "Cr", Type: pixi.FieldUint8},
 		}
+	case color.GrayModel:
+		fields = []pixi.Field{{Name: "gray", Type: pixi.FieldUint8}}
+	case color.Gray16Model:
+		fields = []pixi.Field{{Name: "gray", Type: pixi.FieldUint16}}
+	case colorext.RGBModel:
+		fields = []pixi.Field{
+			{Name: "r", Type: pixi.FieldUint8},
+			{Name: "g", Type: pixi.FieldUint8},
+			{Name: "b", Type: pixi.FieldUint8},
+		}
+	case colorext.Gray32fModel:
+		fields = []pixi.Field{{Name: "gray", Type: pixi.FieldFloat32}}
 	default:
-		return nil, pixi.UnsupportedError("color model of the image not yet supported for conversion to Pixi")
+		if fields == nil {
+			return nil, pixi.UnsupportedError("color model of the image not yet supported for conversion to Pixi")
+		}
 	}
 
 	width := img.Bounds().Dx()
 	height := img.Bounds().Dy()
+	dims := pixi.DimensionSet{{Name: "x", Size: width}, {Name: "y", Size: height}}
+	suggested := pixi.SuggestTileSize(dims, fields, pixi.DefaultTargetTileBytes, pixi.AccessRandom)
 	if xTileSize == 0 {
-		xTileSize = width
+		xTileSize = suggested[0]
 	}
-	xTileSize = min(width, xTileSize)
+	dims[0].TileSize = min(width, xTileSize)
 	if yTileSize == 0 {
-		yTileSize = height
+		yTileSize = suggested[1]
 	}
-	yTileSize = min(height, yTileSize)
+	dims[1].TileSize = min(height, yTileSize)
 
-	return pixi.NewLayer(
-		layerName,
-		separated,
-		compression,
-		[]pixi.Dimension{
-			{Name: "x", Size: width, TileSize: xTileSize},
-			{Name: "y", Size: height, TileSize: yTileSize}},
-		fields), nil
+	layer := pixi.NewLayer(layerName, separated, compression, dims, fields)
+	if layerTags != nil {
+		layer.Tags = []*pixi.TagSection{layerTags}
+	}
+	return layer, nil
 }
 
+// Converts the layer into an image, using the color model named by the "color-model" tag of the layer
+// or, failing that, of the file. Channels are found by name (see pixi.FieldSet.ByName), so layers whose
+// fields are stored in a different order or under common alternative names ("red" for "r") are converted
+// correctly, and layers missing a channel of the color model are rejected rather than silently mis-mapped.
+// Files written by other tools without the tag are converted using a color model inferred from the names
+// and types of the layer's fields (see InferColorModel). Only the fields of the channels of the color
+// model are read, so other bands of a separated layer cost nothing.
 func LayerAsImage(r io.ReadSeeker, pixImg *pixi.Pixi, layer *pixi.Layer) (image.Image, error) {
 	width := layer.Dimensions[0].Size
 	height := layer.Dimensions[1].Size
 
-	switch pixImg.Tags[0].Tags["color-model"] {
+	colorModel, positional := taggedColorModel(pixImg, layer), false
+	if colorModel == "" {
+		colorModel, positional = InferColorModel(layer)
+	}
+	switch colorModel {
 	case "nrgba":
+		ch, err := channelIndices(layer, positional, "r", "g", "b", "a")
+		if err != nil {
+			return nil, err
+		}
 		nrgbaImg := image.NewNRGBA(image.Rect(0, 0, width, height))
-		for coord, comps := range read.LayerContiguousTileOrder(r, pixImg.Header, layer) {
-			nrgbaImg.Set(coord[0], coord[1],
+		err = readImageChannels(r, pixImg.Header, layer, ch, func(x int, y int, comps []any) {
+			nrgbaImg.Set(x, y,
 				color.NRGBA{comps[0].(uint8), comps[1].(uint8), comps[2].(uint8), comps[3].(uint8)})
+		})
+		if err != nil {
+			return nil, err
 		}
 		return nrgbaImg, nil
 	case "nrgba64":
+		ch, err := channelIndices(layer, positional, "r", "g", "b", "a")
+		if err != nil {
+			return nil, err
+		}
 		nrgba64Img := image.NewNRGBA64(image.Rect(0, 0, width, height))
-		for coord, comps := range read.LayerContiguousTileOrder(r, pixImg.Header, layer) {
-			nrgba64Img.Set(coord[0], coord[1],
+		err = readImageChannels(r, pixImg.Header, layer, ch, func(x int, y int, comps []any) {
+			nrgba64Img.Set(x, y,
 				color.NRGBA64{comps[0].(uint16), comps[1].(uint16), comps[2].(uint16), comps[3].(uint16)})
+		})
+		if err != nil {
+			return nil, err
 		}
 		return nrgba64Img, nil
 	case "rgba":
+		ch, err := channelIndices(layer, positional, "r", "g", "b", "a")
+		if err != nil {
+			return nil, err
+		}
 		rgbaImg := image.NewRGBA(image.Rect(0, 0, width, height))
-		for coord, comps := range read.LayerContiguousTileOrder(r, pixImg.Header, layer) {
-			rgbaImg.Set(coord[0], coord[1],
+		err = readImageChannels(r, pixImg.Header, layer, ch, func(x int, y int, comps []any) {
+			rgbaImg.Set(x, y,
 				color.RGBA{comps[0].(uint8), comps[1].(uint8), comps[2].(uint8), comps[3].(uint8)})
+		})
+		if err != nil {
+			return nil, err
 		}
 		return rgbaImg, nil
 	case "rgba64":
+		ch, err := channelIndices(layer, positional, "r", "g", "b", "a")
+		if err != nil {
+			return nil, err
+		}
 		rgba64Img := image.NewRGBA64(image.Rect(0, 0, width, height))
-		for coord, comps := range read.LayerContiguousTileOrder(r, pixImg.Header, layer) {
-			rgba64Img.Set(coord[0], coord[1],
+		err = readImageChannels(r, pixImg.Header, layer, ch, func(x int, y int, comps []any) {
+			rgba64Img.Set(x, y,
 				color.NRGBA64{comps[0].(uint16), comps[1].(uint16), comps[2].(uint16), comps[3].(uint16)})
+		})
+		if err != nil {
+			return nil, err
 		}
 		return rgba64Img, nil
 	case "cmyk":
+		ch, err := channelIndices(layer, positional, "c", "m", "y", "k")
+		if err != nil {
+			return nil, err
+		}
 		cmykImg := image.NewCMYK(image.Rect(0, 0, width, height))
-		for coord, comps := range read.LayerContiguousTileOrder(r, pixImg.Header, layer) {
-			cmykImg.Set(coord[0], coord[1],
+		err = readImageChannels(r, pixImg.Header, layer, ch, func(x int, y int, comps []any) {
+			cmykImg.Set(x, y,
 				color.CMYK{comps[0].(uint8), comps[1].(uint8), comps[2].(uint8), comps[3].(uint8)})
+		})
+		if err != nil {
+			return nil, err
 		}
 		return cmykImg, nil
 	case "YCbCr":
+		ch, err := channelIndices(layer, positional, "Y", "Cb", "Cr")
+		if err != nil {
+			return nil, err
+		}
 		ycbcrImg := image.NewYCbCr(image.Rect(0, 0, width, height), image.YCbCrSubsampleRatio420)
-		for coord, comps := range read.LayerContiguousTileOrder(r, pixImg.Header, layer) {
-			yOff := ycbcrImg.YOffset(coord[0], coord[1])
-			cOff := ycbcrImg.COffset(coord[0], coord[1])
+		err = readImageChannels(r, pixImg.Header, layer, ch, func(x int, y int, comps []any) {
+			yOff := ycbcrImg.YOffset(x, y)
+			cOff := ycbcrImg.COffset(x, y)
 			ycbcrImg.Y[yOff] = comps[0].(uint8)
 			ycbcrImg.Cb[cOff] = comps[1].(uint8)
 			ycbcrImg.Cr[cOff] = comps[2].(uint8)
+		})
+		if err != nil {
+			return nil, err
 		}
 		return ycbcrImg, nil
+	case "gray", "gray16", "gray32f":
+		ch, err := channelIndices(layer, positional, "gray")
+		if err != nil {
+			return nil, err
+		}
+		var grayImg draw.Image
+		switch colorModel {
+		case "gray":
+			grayImg = image.NewGray(image.Rect(0, 0, width, height))
+		case "gray16":
+			grayImg = image.NewGray16(image.Rect(0, 0, width, height))
+		default:
+			grayImg = colorext.NewGray32fImage(image.Rect(0, 0, width, height))
+		}
+		err = readImageChannels(r, pixImg.Header, layer, ch, func(x int, y int, comps []any) {
+			switch value := comps[0].(type) {
+			case uint8:
+				grayImg.Set(x, y, color.Gray{value})
+			case uint16:
+				grayImg.Set(x, y, color.Gray16{value})
+			case float32:
+				grayImg.Set(x, y, colorext.Gray32f{Y: value})
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+		return grayImg, nil
+	case "rgb":
+		ch, err := channelIndices(layer, positional, "r", "g", "b")
+		if err != nil {
+			return nil, err
+		}
+		rgbImg := colorext.NewRGBImage(image.Rect(0, 0, width, height))
+		err = readImageChannels(r, pixImg.Header, layer, ch, func(x int, y int, comps []any) {
+			rgbImg.SetRGB(x, y,
+				colorext.RGB{R: comps[0].(uint8), G: comps[1].(uint8), B: comps[2].(uint8)})
+		})
+		if err != nil {
+			return nil, err
+		}
+		return rgbImg, nil
+	case "paletted":
+		ch, err := channelIndices(layer, positional, "index")
+		if err != nil {
+			return nil, err
+		}
+		paletteBytes, found, err := layer.LookupBinaryTag(r, pixImg.Header, "palette")
+		if err != nil {
+			return nil, err
+		}
+		if !found || len(paletteBytes)%4 != 0 {
+			return nil, pixi.FormatError("paletted layer '" + layer.Name + "' has no valid palette tag")
+		}
+		palette := make(color.Palette, len(paletteBytes)/4)
+		for i := range palette {
+			palette[i] = color.NRGBA{paletteBytes[4*i], paletteBytes[4*i+1], paletteBytes[4*i+2], paletteBytes[4*i+3]}
+		}
+		palettedImg := image.NewPaletted(image.Rect(0, 0, width, height), palette)
+		err = readImageChannels(r, pixImg.Header, layer, ch, func(x int, y int, comps []any) {
+			palettedImg.SetColorIndex(x, y, comps[0].(uint8))
+		})
+		if err != nil {
+			return nil, err
+		}
+		return palettedImg, nil
 	default:
 		return nil, pixi.UnsupportedError("color model of the layer not yet supported for conversion to Pixi")
 	}
 }
+
+// Calls set with the values of the given channels (field indices), in the order given, for every sample
+// of the two-dimensional layer within its bounds. Only the tiles of those channels are read from separated
+// layers.
+func readImageChannels(r io.ReadSeeker, header pixi.PixiHeader, layer *pixi.Layer, channels []int, set func(x int, y int, values []any)) error {
+	it := read.NewTileOrderReadIterator(r, header, layer)
+	it.SelectChannels(channels)
+	it.SkipPadding(true)
+	values := make([]any, len(channels))
+	for it.Next() {
+		coord := it.Coordinate()
+		for i, channel := range channels {
+			values[i] = it.Field(channel)
+		}
+		set(coord[0], coord[1], values)
+	}
+	return it.Err()
+}
+
+// A linear stretch of band values into the range of an 8-bit image channel: values at or below Min
+// become 0, values at or above Max become 255, and values between are scaled linearly.
+type Stretch struct {
+	Min float64
+	Max float64
+}
+
+// Chooses which bands (fields) of a layer are shown in which channels of an image, and how the values of
+// each band are stretched, for exporting false-color composites and other layers that are not stored as
+// images. Bands are found by name as with pixi.FieldSet.ByName.
+type ChannelMapping struct {
+	// Maps an image channel ("r", "g", "b", "a", or "gray") to the name of the band shown in it. If
+	// "gray" is mapped, the image is grayscale and no other channel may be mapped. Otherwise unmapped
+	// color channels are 0 and an unmapped alpha channel is fully opaque.
+	Channels map[string]string
+	// The stretch of each band, keyed by band name. Bands without a stretch are not scaled if they are
+	// 8-bit unsigned integers; otherwise they are stretched over the range of their integer type, or
+	// from 0 to 1 for floating point bands.
+	Stretch map[string]Stretch
+}
+
+// Converts the layer into an 8-bit image according to the given mapping of image channels to bands,
+// regardless of any "color-model" tag. The layer must have exactly two dimensions, the first being
+// the horizontal axis of the image.
+func LayerAsImageMapped(r io.ReadSeeker, header pixi.PixiHeader, layer *pixi.Layer, mapping ChannelMapping) (image.Image, error) {
+	if len(layer.Dimensions) != 2 {
+		return nil, pixi.UnsupportedError("only two-dimensional layers can be converted to images")
+	}
+	_, gray := mapping.Channels["gray"]
+	if gray && len(mapping.Channels) > 1 {
+		return nil, pixi.FormatError("a grayscale channel mapping cannot map any other channels")
+	}
+
+	// find each mapped band and its stretch, in channel order
+	channels := []string{"r", "g", "b", "a"}
+	if gray {
+		channels = []string{"gray"}
+	}
+	bands := make([]int, len(channels))
+	stretches := make([]Stretch, len(channels))
+	for i, channel := range channels {
+		bands[i] = -1
+		band, ok := mapping.Channels[channel]
+		if !ok {
+			continue
+		}
+		index, found := layer.Fields.ByName(band)
+		if !found {
+			return nil, pixi.FormatError("layer '" + layer.Name + "' has no band '" + band + "' for the '" + channel + "' channel")
+		}
+		bands[i] = index
+		stretch, ok := mapping.Stretch[band]
+		if !ok {
+			stretch = defaultStretch(layer.Fields[index].Type)
+		}
+		if stretch.Max <= stretch.Min {
+			return nil, pixi.FormatError("stretch of band '" + band + "' must have a maximum greater than its minimum")
+		}
+		stretches[i] = stretch
+	}
+	for channel := range mapping.Channels {
+		if !slices.Contains(channels, channel) {
+			return nil, pixi.FormatError("unknown image channel '" + channel + "'")
+		}
+	}
+
+	bounds := image.Rect(0, 0, layer.Dimensions[0].Size, layer.Dimensions[1].Size)
+	values := make([]uint8, len(channels))
+	var img draw.Image = image.NewNRGBA(bounds)
+	if gray {
+		img = image.NewGray(bounds)
+	}
+	it := read.NewTileOrderReadIterator(r, header, layer)
+	it.SelectChannels(slices.DeleteFunc(slices.Clone(bands), func(band int) bool { return band < 0 }))
+	it.SkipPadding(true)
+	for it.Next() {
+		coord := it.Coordinate()
+		for i, band := range bands {
+			if band < 0 {
+				values[i] = 0
+				if channels[i] == "a" {
+					values[i] = math.MaxUint8
+				}
+				continue
+			}
+			value := layer.Fields[band].Type.ValueToFloat64(it.Field(band))
+			values[i] = stretches[i].apply(value)
+		}
+		if gray {
+			img.Set(coord[0], coord[1], color.Gray{Y: values[0]})
+		} else {
+			img.Set(coord[0], coord[1], color.NRGBA{R: values[0], G: values[1], B: values[2], A: values[3]})
+		}
+	}
+	if it.Err() != nil {
+		return nil, it.Err()
+	}
+	return img, nil
+}
+
+func (s Stretch) apply(value float64) uint8 {
+	scaled := (value - s.Min) / (s.Max - s.Min) * math.MaxUint8
+	return pixi.FieldUint8.Float64ToValue(scaled).(uint8)
+}
+
+func defaultStretch(fieldType pixi.FieldType) Stretch {
+	switch fieldType {
+	case pixi.FieldInt8:
+		return Stretch{Min: math.MinInt8, Max: math.MaxInt8}
+	case pixi.FieldUint8:
+		return Stretch{Min: 0, Max: math.MaxUint8}
+	case pixi.FieldInt16:
+		return Stretch{Min: math.MinInt16, Max: math.MaxInt16}
+	case pixi.FieldUint16:
+		return Stretch{Min: 0, Max: math.MaxUint16}
+	case pixi.FieldInt32:
+		return Stretch{Min: math.MinInt32, Max: math.MaxInt32}
+	case pixi.FieldUint32:
+		return Stretch{Min: 0, Max: math.MaxUint32}
+	case pixi.FieldInt64:
+		return Stretch{Min: math.MinInt64, Max: math.MaxInt64}
+	case pixi.FieldUint64:
+		return Stretch{Min: 0, Max: math.MaxUint64}
+	default:
+		return Stretch{Min: 0, Max: 1}
+	}
+}
+
+// The color model named by the last "color-model" tag of the layer, or of the file if the layer has none.
+// Returns an empty string if neither has the tag.
+func taggedColorModel(pixImg *pixi.Pixi, layer *pixi.Layer) string {
+	for _, sections := range [][]*pixi.TagSection{layer.Tags, pixImg.Tags} {
+		model := ""
+		for _, section := range sections {
+			if value, ok := section.Tags["color-model"]; ok {
+				model = value
+			}
+		}
+		if model != "" {
+			return model
+		}
+	}
+	return ""
+}
+
+// The color models that can be inferred for a layer, with the type and names of the fields they require.
+var inferableColorModels = []struct {
+	model     string
+	fieldType pixi.FieldType
+	channels  []string
+}{
+	{"paletted", pixi.FieldUint8, []string{"index"}},
+	{"gray", pixi.FieldUint8, []string{"gray"}},
+	{"gray16", pixi.FieldUint16, []string{"gray"}},
+	{"gray32f", pixi.FieldFloat32, []string{"gray"}},
+	{"rgb", pixi.FieldUint8, []string{"r", "g", "b"}},
+	{"YCbCr", pixi.FieldUint8, []string{"Y", "Cb", "Cr"}},
+	{"nrgba", pixi.FieldUint8, []string{"r", "g", "b", "a"}},
+	{"nrgba64", pixi.FieldUint16, []string{"r", "g", "b", "a"}},
+	{"cmyk", pixi.FieldUint8, []string{"c", "m", "y", "k"}},
+}
+
+// Infers the color model of a layer without a "color-model" tag from the names and types of its fields,
+// returning the name of the model as used in the tag. A model whose channels are all found by name among
+// fields of the right type is preferred. Otherwise, if the fields are all of one type, a model is chosen
+// by their number alone (one uint8, uint16, or float32 field for grayscale, three uint8 fields for RGB,
+// four uint8 or uint16 fields for RGBA), and positional is true to indicate that the channels should be
+// taken from the fields in order. Returns an empty string if no model fits.
+func InferColorModel(layer *pixi.Layer) (model string, positional bool) {
+	sameType := true
+	for _, field := range layer.Fields {
+		sameType = sameType && field.Type == layer.Fields[0].Type
+	}
+	if len(layer.Fields) == 0 || !sameType {
+		return "", false
+	}
+	fieldType := layer.Fields[0].Type
+	for _, candidate := range inferableColorModels {
+		if candidate.fieldType != fieldType || len(candidate.channels) != len(layer.Fields) {
+			continue
+		}
+		if _, err := channelIndices(layer, false, candidate.channels...); err == nil {
+			return candidate.model, false
+		}
+	}
+	for _, candidate := range []string{"gray", "gray16", "gray32f", "rgb", "nrgba", "nrgba64"} {
+		for _, inferable := range inferableColorModels {
+			if inferable.model == candidate && inferable.fieldType == fieldType && len(inferable.channels) == len(layer.Fields) {
+				return candidate, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Finds the index of the field holding each of the named channels in the layer. If positional is true,
+// the channels are instead taken from the fields in order, regardless of their names.
+func channelIndices(layer *pixi.Layer, positional bool, names ...string) ([]int, error) {
+	indices := make([]int, len(names))
+	for i, name := range names {
+		if positional && i < len(layer.Fields) {
+			indices[i] = i
+			continue
+		}
+		index, found := layer.Fields.ByName(name)
+		if !found {
+			return nil, pixi.FormatError("layer '" + layer.Name + "' has no field for the '" + name + "' channel")
+		}
+		indices[i] = index
+	}
+	return indices, nil
+}
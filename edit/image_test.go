@@ -0,0 +1,307 @@
+package edit
+
+import (
+	"encoding/binary"
+	"image"
+	"image/color"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/colorext"
+	"github.com/owlpinetech/pixi/internal/buffer"
+	"github.com/owlpinetech/pixi/read"
+)
+
+func TestLayerAsImageChannelsByName(t *testing.T) {
+	header := pixi.PixiHeader{Version: pixi.Version, OffsetSize: 4, ByteOrder: binary.LittleEndian}
+	// channels stored out of order and under long names
+	layer := pixi.NewLayer("img", false, pixi.CompressionNone,
+		pixi.DimensionSet{{Name: "x", Size: 2, TileSize: 2}, {Name: "y", Size: 2, TileSize: 2}},
+		[]pixi.Field{
+			{Name: "alpha", Type: pixi.FieldUint8},
+			{Name: "blue", Type: pixi.FieldUint8},
+			{Name: "green", Type: pixi.FieldUint8},
+			{Name: "red", Type: pixi.FieldUint8},
+		})
+	buf := buffer.NewBuffer(10)
+	err := WriteContiguousTileOrderPixi(buf, header, map[string]string{"color-model": "nrgba"}, LayerWriter{
+		Layer: layer,
+		IterFn: func(layer *pixi.Layer, coord pixi.SampleCoordinate) ([]any, map[string]any) {
+			return []any{uint8(255), uint8(3), uint8(2), uint8(1)}, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rdr := buffer.NewBufferFrom(buf.Bytes())
+	readPixi, err := pixi.ReadPixi(rdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := LayerAsImage(rdr, &readPixi, readPixi.Layers[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := color.NRGBAModel.Convert(img.At(1, 1)).(color.NRGBA)
+	if got != (color.NRGBA{R: 1, G: 2, B: 3, A: 255}) {
+		t.Errorf("expected channels to be mapped by name, got %v", got)
+	}
+
+	missing := pixi.NewLayer("img", false, pixi.CompressionNone,
+		pixi.DimensionSet{{Name: "x", Size: 2, TileSize: 2}, {Name: "y", Size: 2, TileSize: 2}},
+		[]pixi.Field{{Name: "r", Type: pixi.FieldUint8}, {Name: "g", Type: pixi.FieldUint8}, {Name: "b", Type: pixi.FieldUint8}})
+	_, err = LayerAsImage(rdr, &readPixi, missing)
+	if _, ok := err.(pixi.FormatError); !ok {
+		t.Errorf("expected format error for a layer missing a channel, got %v", err)
+	}
+}
+
+func TestLayerAsImageMappedFalseColor(t *testing.T) {
+	header := pixi.PixiHeader{Version: pixi.Version, OffsetSize: 4, ByteOrder: binary.BigEndian}
+	layer := pixi.NewLayer("bands", false, pixi.CompressionFlate,
+		pixi.DimensionSet{{Name: "x", Size: 3, TileSize: 2}, {Name: "y", Size: 2, TileSize: 2}},
+		[]pixi.Field{
+			{Name: "B2", Type: pixi.FieldUint16},
+			{Name: "B3", Type: pixi.FieldUint16},
+			{Name: "B4", Type: pixi.FieldUint16},
+			{Name: "ndvi", Type: pixi.FieldFloat32},
+		})
+	buf := buffer.NewBuffer(10)
+	err := WriteContiguousTileOrderPixi(buf, header, nil, LayerWriter{
+		Layer: layer,
+		IterFn: func(layer *pixi.Layer, coord pixi.SampleCoordinate) ([]any, map[string]any) {
+			x := uint16(coord[0])
+			return []any{1000 * x, uint16(500), uint16(3000), float32(coord[0]) / 2}, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rdr := buffer.NewBufferFrom(buf.Bytes())
+
+	img, err := LayerAsImageMapped(rdr, header, layer, ChannelMapping{
+		Channels: map[string]string{"r": "B4", "g": "B3", "b": "b2"},
+		Stretch:  map[string]Stretch{"B4": {Min: 0, Max: 3000}, "B3": {Min: 0, Max: 1000}, "b2": {Min: 0, Max: 2000}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != 3 || img.Bounds().Dy() != 2 {
+		t.Fatalf("expected 3x2 image, got %v", img.Bounds())
+	}
+	expected := []color.NRGBA{{R: 255, G: 128, B: 0, A: 255}, {R: 255, G: 128, B: 128, A: 255}, {R: 255, G: 128, B: 255, A: 255}}
+	for x, want := range expected {
+		got := img.At(x, 1).(color.NRGBA)
+		if got != want {
+			t.Errorf("expected %v at x=%d, got %v", want, x, got)
+		}
+	}
+
+	gray, err := LayerAsImageMapped(rdr, header, layer, ChannelMapping{Channels: map[string]string{"gray": "ndvi"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := gray.At(1, 0).(color.Gray); got.Y != 128 {
+		t.Errorf("expected float band to be stretched from 0 to 1 by default, got %v", got)
+	}
+
+	_, err = LayerAsImageMapped(rdr, header, layer, ChannelMapping{Channels: map[string]string{"r": "B5"}})
+	if _, ok := err.(pixi.FormatError); !ok {
+		t.Errorf("expected format error for a missing band, got %v", err)
+	}
+}
+
+func TestPixiFromImageRoundTripModels(t *testing.T) {
+	bounds := image.Rect(0, 0, 5, 3)
+	palette := color.Palette{color.NRGBA{0, 0, 0, 255}, color.NRGBA{255, 0, 0, 255}, color.NRGBA{0, 0, 255, 128}}
+
+	rgb := colorext.NewRGBImage(bounds)
+	gray := image.NewGray(bounds)
+	gray16 := image.NewGray16(bounds)
+	gray32f := colorext.NewGray32fImage(bounds)
+	paletted := image.NewPaletted(bounds, palette)
+	for y := range bounds.Dy() {
+		for x := range bounds.Dx() {
+			rgb.SetRGB(x, y, colorext.RGB{R: uint8(x), G: uint8(y), B: uint8(x * y)})
+			gray.SetGray(x, y, color.Gray{Y: uint8(x * 40)})
+			gray16.SetGray16(x, y, color.Gray16{Y: uint16(y * 1000)})
+			gray32f.SetGray32f(x, y, colorext.Gray32f{Y: float32(x) / 4})
+			paletted.SetColorIndex(x, y, uint8((x+y)%len(palette)))
+		}
+	}
+
+	for _, img := range []image.Image{rgb, gray, gray16, gray32f, paletted} {
+		buf := buffer.NewBuffer(10)
+		err := PixiFromImage(buf, img, FromImageOptions{Compression: pixi.CompressionFlate, ByteOrder: binary.LittleEndian, XTileSize: 2, YTileSize: 2, AllowSlowTiling: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rdr := buffer.NewBufferFrom(buf.Bytes())
+		readPixi, err := pixi.ReadPixi(rdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		readImg, err := LayerAsImage(rdr, &readPixi, readPixi.Layers[0])
+		if err != nil {
+			t.Fatalf("converting %T back to an image: %v", img, err)
+		}
+		if reflect.TypeOf(readImg) != reflect.TypeOf(img) {
+			t.Errorf("expected %T image, got %T", img, readImg)
+			continue
+		}
+		for y := range bounds.Dy() {
+			for x := range bounds.Dx() {
+				if readImg.At(x, y) != img.At(x, y) {
+					t.Errorf("%T: expected %v at (%d, %d), got %v", img, img.At(x, y), x, y, readImg.At(x, y))
+				}
+			}
+		}
+	}
+}
+
+func TestPixiFromImageOverviewsAndMask(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 7, 5))
+	for y := range 5 {
+		for x := range 7 {
+			alpha := uint8(255)
+			if x == 0 {
+				alpha = 0
+			}
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(x * 30), G: uint8(y * 50), B: 9, A: alpha})
+		}
+	}
+
+	buf := buffer.NewBuffer(10)
+	err := PixiFromImage(buf, img, FromImageOptions{ByteOrder: binary.BigEndian, XTileSize: 2, YTileSize: 2, Overviews: 10, Mask: true, AllowSlowTiling: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rdr := buffer.NewBufferFrom(buf.Bytes())
+	readPixi, err := pixi.ReadPixi(rdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 7x5 -> 4x3 -> 2x2 -> 1x1, then the mask
+	expectedSizes := [][2]int{{7, 5}, {4, 3}, {2, 2}, {1, 1}, {7, 5}}
+	if len(readPixi.Layers) != len(expectedSizes) {
+		t.Fatalf("expected %d layers, got %d", len(expectedSizes), len(readPixi.Layers))
+	}
+	for i, size := range expectedSizes {
+		dims := readPixi.Layers[i].Dimensions
+		if dims[0].Size != size[0] || dims[1].Size != size[1] {
+			t.Errorf("expected layer %d to be %v, got %dx%d", i, size, dims[0].Size, dims[1].Size)
+		}
+	}
+
+	overview := read.NewLayerReadCache(rdr, readPixi.Header, readPixi.Layers[1], read.NewLfuCacheManager(4))
+	sample, err := overview.SampleAt(pixi.SampleCoordinate{1, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// covers x 2..3, y 2..3 of the image
+	if sample[0] != uint8(75) || sample[1] != uint8(125) || sample[3] != uint8(255) {
+		t.Errorf("expected overview sample to be the mean of the pixels it covers, got %v", sample)
+	}
+
+	mask := read.NewLayerReadCache(rdr, readPixi.Header, readPixi.Layers[4], read.NewLfuCacheManager(4))
+	for _, c := range []struct {
+		coord pixi.SampleCoordinate
+		value uint8
+	}{{pixi.SampleCoordinate{0, 3}, 0}, {pixi.SampleCoordinate{1, 3}, 255}} {
+		value, err := mask.FieldAt(c.coord, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value != c.value {
+			t.Errorf("expected mask %d at %v, got %v", c.value, c.coord, value)
+		}
+	}
+
+	// regenerating the overviews from the stored base layer should not change them
+	before := slices.Clone(buf.Bytes())
+	err = UpdateOverviews(buf, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11})
+	if err != nil {
+		t.Fatal(err)
+	}
+	afterPixi, err := pixi.ReadPixi(buffer.NewBufferFrom(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < 4; i++ {
+		for tile := range afterPixi.Layers[i].DiskTiles() {
+			want := make([]byte, readPixi.Layers[i].DiskTileSize(tile))
+			got := make([]byte, len(want))
+			if err := readPixi.Layers[i].ReadTile(buffer.NewBufferFrom(before), readPixi.Header, tile, want); err != nil {
+				t.Fatal(err)
+			}
+			if err := afterPixi.Layers[i].ReadTile(buffer.NewBufferFrom(buf.Bytes()), afterPixi.Header, tile, got); err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(want, got) {
+				t.Errorf("overview %d tile %d changed when regenerated", i, tile)
+			}
+		}
+	}
+}
+
+func TestLayerAsImageInfersColorModel(t *testing.T) {
+	cases := []struct {
+		fields   []pixi.Field
+		sample   []any
+		expected color.Color
+	}{
+		{
+			[]pixi.Field{{Type: pixi.FieldUint8}, {Type: pixi.FieldUint8}, {Type: pixi.FieldUint8}},
+			[]any{uint8(1), uint8(2), uint8(3)},
+			colorext.RGB{R: 1, G: 2, B: 3},
+		},
+		{
+			[]pixi.Field{{Name: "elevation", Type: pixi.FieldUint16}},
+			[]any{uint16(4000)},
+			color.Gray16{Y: 4000},
+		},
+		{
+			[]pixi.Field{{Name: "a", Type: pixi.FieldUint8}, {Name: "b", Type: pixi.FieldUint8}, {Name: "g", Type: pixi.FieldUint8}, {Name: "r", Type: pixi.FieldUint8}},
+			[]any{uint8(255), uint8(3), uint8(2), uint8(1)},
+			color.NRGBA{R: 1, G: 2, B: 3, A: 255},
+		},
+	}
+	for _, c := range cases {
+		layer := pixi.NewLayer("untagged", false, pixi.CompressionNone,
+			pixi.DimensionSet{{Name: "x", Size: 2, TileSize: 2}, {Name: "y", Size: 2, TileSize: 2}}, c.fields)
+		header := pixi.PixiHeader{Version: pixi.Version, OffsetSize: 4, ByteOrder: binary.LittleEndian}
+		buf := buffer.NewBuffer(10)
+		err := WriteContiguousTileOrderPixi(buf, header, nil, LayerWriter{
+			Layer: layer,
+			IterFn: func(layer *pixi.Layer, coord pixi.SampleCoordinate) ([]any, map[string]any) {
+				return c.sample, nil
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rdr := buffer.NewBufferFrom(buf.Bytes())
+		readPixi, err := pixi.ReadPixi(rdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := LayerAsImage(rdr, &readPixi, readPixi.Layers[0])
+		if err != nil {
+			t.Fatalf("fields %v: %v", c.fields, err)
+		}
+		if got := img.At(1, 1); got != c.expected {
+			t.Errorf("fields %v: expected %v, got %v", c.fields, c.expected, got)
+		}
+	}
+
+	mixed := pixi.NewLayer("mixed", false, pixi.CompressionNone,
+		pixi.DimensionSet{{Name: "x", Size: 2, TileSize: 2}, {Name: "y", Size: 2, TileSize: 2}},
+		[]pixi.Field{{Name: "v", Type: pixi.FieldUint8}, {Name: "w", Type: pixi.FieldInt32}})
+	if model, _ := InferColorModel(mixed); model != "" {
+		t.Errorf("expected no color model for mixed field types, got %q", model)
+	}
+}
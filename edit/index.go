@@ -0,0 +1,47 @@
+package edit
+
+import (
+	"context"
+	"io"
+	"maps"
+	"slices"
+
+	"github.com/owlpinetech/pixi"
+)
+
+// Copies the Pixi file in src to dst with value indices (see pixi.ValueIndex) of the named fields added
+// to the tags of every layer that has them, so that readers can find the tiles holding values of interest
+// without decoding any. Fields are found by name as with pixi.FieldSet.ByName, and an index replaces any
+// existing index of the same field. As with Compact, tiles are copied without being re-encoded and tag
+// sections are combined, and a content seal is dropped. Layer tags require a version 2 or later file.
+func IndexValues(ctx context.Context, dst io.WriteSeeker, src io.ReadSeeker, fields map[string]pixi.ValueIndexKind, progress ProgressFunc) error {
+	srcPixi, err := pixi.ReadPixi(src)
+	if err != nil {
+		return err
+	}
+
+	tags := mergeTagSections(srcPixi.Tags)
+	delete(tags.Tags, pixi.ContentHashTag)
+	delete(tags.Tags, pixi.ContentSizeTag)
+	layers := make([]derivedLayer, len(srcPixi.Layers))
+	for i, srcLayer := range srcPixi.Layers {
+		layer := deriveLayer(srcLayer, srcLayer.Compression, srcLayer.Dimensions)
+		for _, name := range slices.Sorted(maps.Keys(fields)) {
+			kind := fields[name]
+			fieldIndex, found := srcLayer.Fields.ByName(name)
+			if !found {
+				continue
+			}
+			index, err := pixi.BuildValueIndex(src, srcPixi.Header, srcLayer, fieldIndex, kind)
+			if err != nil {
+				return err
+			}
+			if len(layer.Tags) == 0 {
+				layer.Tags = []*pixi.TagSection{{}}
+			}
+			layer.Tags[0].SetBinary(pixi.ValueIndexTag(srcLayer.Fields[fieldIndex].Name), index.Encode(srcPixi.Header))
+		}
+		layers[i] = derivedLayer{layer: layer, copyFrom: srcLayer, copyReader: src}
+	}
+	return writeDerivedPixi(ctx, dst, srcPixi.Header, tags, layers, progress)
+}
@@ -0,0 +1,48 @@
+package edit
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/internal/buffer"
+)
+
+func TestIndexValues(t *testing.T) {
+	src := writeIndexedLayer(t, pixi.CompressionFlate)
+	dst := buffer.NewBuffer(20)
+	err := IndexValues(context.Background(), dst, buffer.NewBufferFrom(src.Bytes()),
+		map[string]pixi.ValueIndexKind{"index": pixi.ValueIndexBloom, "half": pixi.ValueIndexMinMax, "missing": pixi.ValueIndexMinMax}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rdr := buffer.NewBufferFrom(dst.Bytes())
+	summary, err := pixi.ReadPixi(rdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layer := summary.Layers[0]
+	bloom, found, err := layer.ReadValueIndex(rdr, summary.Header, "index")
+	if err != nil || !found || bloom.Kind != pixi.ValueIndexBloom {
+		t.Fatalf("expected a bloom index of the index field, got %v, %v", found, err)
+	}
+	// sample 57 is at 7,5, in the last tile
+	if tiles := bloom.TilesContaining(uint32(57)); len(tiles) == 0 || tiles[len(tiles)-1] != 3 {
+		t.Errorf("expected the last tile to contain index 57, got %v", tiles)
+	}
+	minMax, found, err := layer.ReadValueIndex(rdr, summary.Header, "half")
+	if err != nil || !found || minMax.Kind != pixi.ValueIndexMinMax {
+		t.Fatalf("expected a min and max index of the half field, got %v, %v", found, err)
+	}
+	if tiles := minMax.TilesInRange(float32(0), float32(2)); !reflect.DeepEqual(tiles, []int{0}) {
+		t.Errorf("expected only the first tile to hold halves up to 2, got %v", tiles)
+	}
+
+	for coord := range layer.Dimensions.SampleCoordinates() {
+		if !reflect.DeepEqual(freshSample(t, dst, coord), freshSample(t, src, coord)) {
+			t.Fatalf("sample at %v changed", coord)
+		}
+	}
+}
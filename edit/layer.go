@@ -12,8 +12,18 @@ type LayerWriter struct {
 	IterFn func(*pixi.Layer, pixi.SampleCoordinate) ([]any, map[string]any)
 }
 
+// Writes a complete Pixi file with the given header, tags, and layers, generating the samples of each
+// layer in tile order by calling its IterFn. The output is deterministic: the same header, tags, layers,
+// and samples always produce byte-identical files (for a given Go release, since compressed tiles are
+// produced by the standard library compressors), so files can be content-addressed and cached.
 func WriteContiguousTileOrderPixi(w io.WriteSeeker, header pixi.PixiHeader, tags map[string]string, layerWriters ...LayerWriter) error {
-	// write the header first
+	// write the header first, listing the features the file uses
+	tagSection := pixi.TagSection{Tags: tags, NextTagsStart: 0}
+	layers := make([]*pixi.Layer, len(layerWriters))
+	for i, layerWriter := range layerWriters {
+		layers[i] = layerWriter.Layer
+	}
+	header.SetFeatures(layers, []*pixi.TagSection{&tagSection})
 	err := header.WriteHeader(w)
 	if err != nil {
 		return err
@@ -24,7 +34,6 @@ func WriteContiguousTileOrderPixi(w io.WriteSeeker, header pixi.PixiHeader, tags
 	if err != nil {
 		return err
 	}
-	tagSection := pixi.TagSection{Tags: tags, NextTagsStart: 0}
 	err = tagSection.Write(w, header)
 	if err != nil {
 		return err
@@ -52,35 +61,48 @@ func WriteContiguousTileOrderPixi(w io.WriteSeeker, header pixi.PixiHeader, tags
 		}
 
 		for tileInd := range layerWriter.Layer.Dimensions.Tiles() {
-			tileData := make([]byte, 0, layer.Dimensions.TileSamples()*layer.SampleSize())
-			tileBuf := bytes.NewBuffer(tileData)
+			// separated layers get a buffer for each field, written as the disk tiles of that field
+			tileBufs := make([]*bytes.Buffer, 1)
+			if layer.Separated {
+				tileBufs = make([]*bytes.Buffer, len(layer.Fields))
+			}
+			for i := range tileBufs {
+				tileBufs[i] = bytes.NewBuffer(make([]byte, 0, layer.DiskTileSize(tileInd+i*layer.Dimensions.Tiles())))
+			}
 			for inTileInd := range layerWriter.Layer.Dimensions.TileSamples() {
 				sampleCoord := pixi.TileSelector{Tile: tileInd, InTile: inTileInd}.
 					ToTileCoordinate(layer.Dimensions).
 					ToSampleCoordinate(layer.Dimensions)
 				indVals, namedVals := layerWriter.IterFn(layer, sampleCoord)
-				if indVals != nil {
-					for fieldInd := range layer.Fields {
-						err = header.Write(tileBuf, indVals[fieldInd])
-						if err != nil {
-							return err
-						}
+				for fieldInd, field := range layer.Fields {
+					tileBuf := tileBufs[0]
+					if layer.Separated {
+						tileBuf = tileBufs[fieldInd]
 					}
-				} else {
-					for _, field := range layer.Fields {
+					if indVals != nil {
+						err = header.Write(tileBuf, indVals[fieldInd])
+					} else {
 						err = header.Write(tileBuf, namedVals[field.Name])
-						if err != nil {
-							return err
-						}
+					}
+					if err != nil {
+						return err
 					}
 				}
 			}
-			err = layer.WriteTile(w, header, tileInd, tileBuf.Bytes())
-			if err != nil {
-				return err
+			for i, tileBuf := range tileBufs {
+				err = layer.WriteTile(w, header, tileInd+i*layer.Dimensions.Tiles(), tileBuf.Bytes())
+				if err != nil {
+					return err
+				}
 			}
 		}
 
+		// write out the layer's own tags, if any, after its tiles
+		err = layer.WriteTags(w, header)
+		if err != nil {
+			return err
+		}
+
 		nextLayerOffset, err := w.Seek(0, io.SeekCurrent)
 		if err != nil {
 			return err
@@ -1,12 +1,15 @@
 package edit
 
 import (
+	"bytes"
 	"encoding/binary"
+	"fmt"
 	"math/rand"
 	"testing"
 
 	"github.com/owlpinetech/pixi"
 	"github.com/owlpinetech/pixi/internal/buffer"
+	"github.com/owlpinetech/pixi/read"
 )
 
 func TestWriteContiguousTileOrder(t *testing.T) {
@@ -121,3 +124,66 @@ func TestWriteContiguousTileOrder(t *testing.T) {
 		}
 	}
 }
+
+func TestWriteContiguousTileOrderPixiDeterministic(t *testing.T) {
+	tags := map[string]string{}
+	for i := range 50 {
+		tags[fmt.Sprintf("tag-%d", i)] = fmt.Sprint(i * i)
+	}
+	write := func() []byte {
+		buf := buffer.NewBuffer(20)
+		header := pixi.PixiHeader{Version: pixi.Version, OffsetSize: 8, ByteOrder: binary.BigEndian}
+		err := WriteContiguousTileOrderPixi(buf, header, tags, LayerWriter{
+			Layer: pixi.NewLayer("same", false, pixi.CompressionFlate,
+				pixi.DimensionSet{{Name: "x", Size: 30, TileSize: 10}}, []pixi.Field{{Name: "v", Type: pixi.FieldFloat32}}),
+			IterFn: func(layer *pixi.Layer, coord pixi.SampleCoordinate) ([]any, map[string]any) {
+				return []any{float32(coord[0]) / 3}, nil
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	first := write()
+	for range 5 {
+		if !bytes.Equal(first, write()) {
+			t.Fatal("expected identical input to produce byte-identical output")
+		}
+	}
+}
+
+func TestWriteContiguousTileOrderSeparated(t *testing.T) {
+	header := pixi.PixiHeader{Version: pixi.Version, OffsetSize: 4, ByteOrder: binary.BigEndian}
+	buf := buffer.NewBuffer(20)
+	err := WriteContiguousTileOrderPixi(buf, header, map[string]string{}, LayerWriter{
+		Layer: pixi.NewLayer("separated", true, pixi.CompressionFlate,
+			pixi.DimensionSet{{Name: "x", Size: 7, TileSize: 4}, {Name: "y", Size: 6, TileSize: 3}},
+			[]pixi.Field{{Name: "index", Type: pixi.FieldUint16}, {Name: "half", Type: pixi.FieldFloat64}}),
+		IterFn: func(layer *pixi.Layer, coord pixi.SampleCoordinate) ([]any, map[string]any) {
+			ind := coord.ToSampleIndex(layer.Dimensions)
+			return nil, map[string]any{"index": uint16(ind), "half": float64(ind) / 2}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rdr := buffer.NewBufferFrom(buf.Bytes())
+	summary, err := pixi.ReadPixi(rdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layer := summary.Layers[0]
+	for tileIndex := range layer.DiskTiles() {
+		if layer.TileBytes[tileIndex] == 0 {
+			t.Errorf("expected disk tile %d to be written", tileIndex)
+		}
+	}
+	for coord, sample := range read.Samples(rdr, summary.Header, layer) {
+		ind := coord.ToSampleIndex(layer.Dimensions)
+		if sample[0] != uint16(ind) || sample[1] != float64(ind)/2 {
+			t.Fatalf("expected sample %d at %v, got %v", ind, coord, sample)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package edit
+
+import (
+	"io"
+	"slices"
+
+	"github.com/owlpinetech/pixi"
+)
+
+// A read-write view of a single layer in a Pixi stream with every tile of the layer decoded and held
+// in memory, for interactive editing of layers small enough to fit. Tiles are shared copy-on-write
+// between the layer and its snapshots, so taking a Snapshot is cheap and only tiles modified afterwards
+// are copied. Commit writes only the tiles that differ from the backing stream.
+type MemoryLayer struct {
+	backing     io.ReadWriteSeeker
+	header      pixi.PixiHeader
+	layer       *pixi.Layer
+	layerOffset int64
+	tiles       [][]byte
+	owned       []bool   // whether each tile is exclusive to the live layer and can be modified in place
+	committed   [][]byte // the tiles as they were when last loaded from or written to the backing stream
+	sync        syncPolicy
+}
+
+// The saved state of a MemoryLayer, which can be returned to with Restore.
+type MemorySnapshot struct {
+	tiles [][]byte
+}
+
+// Reads every tile of the layer, whose header is found at layerOffset in the backing stream, into memory.
+// Tiles that have never been written are treated as zero-filled.
+func NewMemoryLayer(backing io.ReadWriteSeeker, header pixi.PixiHeader, layer *pixi.Layer, layerOffset int64) (*MemoryLayer, error) {
+	tiles := make([][]byte, layer.DiskTiles())
+	for tileIndex := range tiles {
+		tiles[tileIndex] = make([]byte, layer.DiskTileSize(tileIndex))
+		if layer.TileBytes[tileIndex] == 0 {
+			continue
+		}
+		err := layer.ReadTile(backing, header, tileIndex, tiles[tileIndex])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &MemoryLayer{
+		backing:     backing,
+		header:      header,
+		layer:       layer,
+		layerOffset: layerOffset,
+		tiles:       tiles,
+		owned:       make([]bool, len(tiles)),
+		committed:   slices.Clone(tiles),
+	}, nil
+}
+
+// The layer being viewed.
+func (m *MemoryLayer) Layer() *pixi.Layer {
+	return m.layer
+}
+
+// Reads the values of every field of the sample at the given coordinate.
+func (m *MemoryLayer) SampleAt(coord pixi.SampleCoordinate) []any {
+	sample := make([]any, len(m.layer.Fields))
+	for fieldIndex := range m.layer.Fields {
+		sample[fieldIndex] = m.FieldAt(coord, fieldIndex)
+	}
+	return sample
+}
+
+// Reads the value of a single field of the sample at the given coordinate.
+func (m *MemoryLayer) FieldAt(coord pixi.SampleCoordinate, fieldIndex int) any {
+	tileIndex, offset := fieldLocation(m.layer, coord, fieldIndex)
+	return m.layer.Fields[fieldIndex].BytesToValue(m.tiles[tileIndex][offset:], m.header.ByteOrder)
+}
+
+// Sets the values of every field of the sample at the given coordinate. The values must be of the
+// Go types corresponding to each field's type.
+func (m *MemoryLayer) SetSampleAt(coord pixi.SampleCoordinate, sample []any) {
+	for fieldIndex := range m.layer.Fields {
+		m.SetFieldAt(coord, fieldIndex, sample[fieldIndex])
+	}
+}
+
+// Sets the value of a single field of the sample at the given coordinate.
+func (m *MemoryLayer) SetFieldAt(coord pixi.SampleCoordinate, fieldIndex int, value any) {
+	tileIndex, offset := fieldLocation(m.layer, coord, fieldIndex)
+	if !m.owned[tileIndex] {
+		m.tiles[tileIndex] = slices.Clone(m.tiles[tileIndex])
+		m.owned[tileIndex] = true
+	}
+	m.layer.Fields[fieldIndex].ValueToBytes(value, m.tiles[tileIndex][offset:], m.header.ByteOrder)
+}
+
+// Saves the current state of every tile, so it can be returned to later with Restore. Tiles are not
+// copied until they are next modified.
+func (m *MemoryLayer) Snapshot() MemorySnapshot {
+	clear(m.owned)
+	return MemorySnapshot{tiles: slices.Clone(m.tiles)}
+}
+
+// Returns every tile to the state it was in when the snapshot was taken. The same snapshot can be
+// restored any number of times. Restoring does not write anything to the backing stream.
+func (m *MemoryLayer) Restore(snapshot MemorySnapshot) {
+	if len(snapshot.tiles) != len(m.tiles) {
+		panic("pixi: snapshot was not taken from this memory layer")
+	}
+	copy(m.tiles, snapshot.tiles)
+	clear(m.owned)
+}
+
+// The indices of the disk tiles that differ from the backing stream, in ascending order. A tile that was
+// modified and then restored to a snapshot taken before the modification is not considered changed.
+func (m *MemoryLayer) ChangedTiles() []int {
+	changed := []int{}
+	for tileIndex, tile := range m.tiles {
+		if &tile[0] != &m.committed[tileIndex][0] {
+			changed = append(changed, tileIndex)
+		}
+	}
+	return changed
+}
+
+// The tiles changed since the layer was loaded or last committed. Equivalent to ChangedTiles, except
+// that disk tiles of separated layers are reported by the tile they belong to.
+func (m *MemoryLayer) DirtyTiles() []int {
+	return diskTilesToTiles(m.layer, m.ChangedTiles())
+}
+
+// Writes every changed tile to the backing stream, then rewrites the layer header so that the stream
+// reflects all modifications. Uncompressed tiles are overwritten in place, while compressed tiles are
+// appended to the end of the stream.
+func (m *MemoryLayer) Commit() error {
+	changed := m.ChangedTiles()
+	for _, tileIndex := range changed {
+		err := rewriteTile(m.backing, m.header, m.layer, tileIndex, m.tiles[tileIndex])
+		if err != nil {
+			return err
+		}
+		err = m.sync.tilesWritten(1)
+		if err != nil {
+			return err
+		}
+	}
+	if len(changed) > 0 {
+		err := m.layer.OverwriteHeader(m.backing, m.header, m.layerOffset)
+		if err != nil {
+			return err
+		}
+	}
+	m.committed = slices.Clone(m.tiles)
+	clear(m.owned)
+	return m.sync.finished()
+}
+
+// Sets the options controlling when the backing stream is synced to stable storage. Returns an
+// error if syncing is requested but the backing stream does not implement Syncer.
+func (m *MemoryLayer) SetDurability(durability Durability) error {
+	policy, err := newSyncPolicy(m.backing, durability)
+	if err != nil {
+		return err
+	}
+	m.sync = policy
+	return nil
+}
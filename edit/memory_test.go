@@ -0,0 +1,89 @@
+package edit
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/internal/buffer"
+)
+
+func openMemoryLayer(t *testing.T, buf *buffer.Buffer) *MemoryLayer {
+	t.Helper()
+	_, err := buf.Seek(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary, err := pixi.ReadPixi(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem, err := NewMemoryLayer(buf, summary.Header, summary.Layers[0], summary.LayerOffset(summary.Layers[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mem
+}
+
+func TestMemoryLayerSnapshotRestore(t *testing.T) {
+	mem := openMemoryLayer(t, writeIndexedLayer(t, pixi.CompressionNone))
+
+	mem.SetFieldAt(pixi.SampleCoordinate{1, 1}, 0, uint32(100))
+	before := mem.Snapshot()
+	mem.SetSampleAt(pixi.SampleCoordinate{7, 7}, []any{uint32(200), float32(2)})
+	mem.SetFieldAt(pixi.SampleCoordinate{1, 1}, 0, uint32(101))
+
+	if got := mem.ChangedTiles(); !slices.Equal(got, []int{0, 3}) {
+		t.Errorf("expected tiles 0 and 3 to be changed, got %v", got)
+	}
+
+	mem.Restore(before)
+	if got := mem.FieldAt(pixi.SampleCoordinate{1, 1}, 0); got != uint32(100) {
+		t.Errorf("expected restored value 100, got %v", got)
+	}
+	if got := mem.FieldAt(pixi.SampleCoordinate{7, 7}, 0); got != uint32(77) {
+		t.Errorf("expected restored original value 77, got %v", got)
+	}
+	if got := mem.ChangedTiles(); !slices.Equal(got, []int{0}) {
+		t.Errorf("expected only tile 0 to be changed after restoring, got %v", got)
+	}
+
+	// modifying after a restore must not leak into the snapshot
+	mem.SetFieldAt(pixi.SampleCoordinate{1, 1}, 0, uint32(102))
+	mem.Restore(before)
+	if got := mem.FieldAt(pixi.SampleCoordinate{1, 1}, 0); got != uint32(100) {
+		t.Errorf("expected snapshot to be unaffected by later edits, got %v", got)
+	}
+}
+
+func TestMemoryLayerCommitChangedTiles(t *testing.T) {
+	for _, compression := range []pixi.Compression{pixi.CompressionNone, pixi.CompressionFlate} {
+		buf := writeIndexedLayer(t, compression)
+		mem := openMemoryLayer(t, buf)
+		offsets := slices.Clone(mem.Layer().TileOffsets)
+
+		mem.SetSampleAt(pixi.SampleCoordinate{8, 2}, []any{uint32(9000), float32(-9)})
+		err := mem.Commit()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(mem.ChangedTiles()) != 0 {
+			t.Errorf("expected no changed tiles after commit, got %v", mem.ChangedTiles())
+		}
+		for tileIndex, offset := range mem.Layer().TileOffsets {
+			moved := offset != offsets[tileIndex]
+			if tileIndex != 1 && moved {
+				t.Errorf("expected unchanged tile %d not to be rewritten", tileIndex)
+			}
+			if tileIndex == 1 && moved != (compression != pixi.CompressionNone) {
+				t.Errorf("expected changed tile to be moved only when compressed, moved: %v", moved)
+			}
+		}
+		if got := freshSample(t, buf, pixi.SampleCoordinate{8, 2}); got[0] != uint32(9000) || got[1] != float32(-9) {
+			t.Errorf("expected committed sample, got %v", got)
+		}
+		if got := freshSample(t, buf, pixi.SampleCoordinate{9, 2}); got[0] != uint32(29) {
+			t.Errorf("expected neighboring sample to be unchanged, got %v", got)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package edit
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/owlpinetech/pixi"
+)
+
+// A processing step that can be added to a Pipeline with Apply, for processing this package does not
+// provide itself, such as speckle filtering or a custom index. An operator works a tile of its output at
+// a time, reading whatever samples of its input it needs, so that it can compute neighbourhood filters as
+// well as per-sample transforms; tiles are processed on several goroutines at once, so ProcessTile must
+// be safe for concurrent use. Operators registered with RegisterOperator can also be used in pipeline
+// specs, and so with the pixi run command.
+type Operator interface {
+	// A short description of the operator and its parameters, used in error messages.
+	Describe() string
+	// The dimensions and fields of the layer the operator produces from a layer with the given dimensions
+	// and fields, or an error if the operator cannot be applied to it. The tile sizes of the dimensions
+	// returned are the tiles ProcessTile is asked for.
+	OutputLayerSpec(dims pixi.DimensionSet, fields pixi.FieldSet) (pixi.DimensionSet, pixi.FieldSet, error)
+	// Computes the samples of a tile of the output from the samples of the input.
+	ProcessTile(input SampleSource, tile *OperatorTile) error
+}
+
+// The samples of the layer an Operator is applied to. Reading a sample outside the layer is an error.
+type SampleSource interface {
+	Dimensions() pixi.DimensionSet
+	Fields() pixi.FieldSet
+	SampleAt(coord pixi.SampleCoordinate) ([]any, error)
+}
+
+// A tile of the output of an Operator, filled in by ProcessTile. Samples of the tile that are not set
+// are zero.
+type OperatorTile struct {
+	Start  pixi.SampleCoordinate // The coordinate of the first sample of the tile.
+	End    pixi.SampleCoordinate // The coordinate just past the last sample of the tile in every dimension.
+	dims   pixi.DimensionSet
+	fields pixi.FieldSet
+	order  binary.ByteOrder
+	data   []byte
+}
+
+// Sets the sample at the given coordinate of the output layer, which must be within the tile, to values
+// of the types of the output fields in order.
+func (t *OperatorTile) Set(coord pixi.SampleCoordinate, sample []any) error {
+	if len(coord) != len(t.Start) {
+		return pixi.FormatError("sample coordinate does not match the output of the operator")
+	}
+	for i := range coord {
+		if coord[i] < t.Start[i] || coord[i] >= t.End[i] {
+			return pixi.FormatError("sample coordinate outside the tile being processed")
+		}
+	}
+	if len(sample) != len(t.fields) {
+		return pixi.FormatError("sample does not match the number of output fields")
+	}
+	offset := coord.ToTileSelector(t.dims).InTile * fieldsSize(t.fields)
+	for i, field := range t.fields {
+		field.ValueToBytes(sample[i], t.data[offset:], t.order)
+		offset += field.Size()
+	}
+	return nil
+}
+
+// Creates an operator from the parameters given for it in a pipeline spec, as raw JSON (empty if the
+// spec gives none).
+type OperatorFactory func(params json.RawMessage) (Operator, error)
+
+var (
+	operatorsLock sync.RWMutex
+	operators     = map[string]OperatorFactory{}
+)
+
+// Makes an operator available to pipeline specs under the given name, usually from the init function of
+// the package providing it. Panics if the name is empty or already registered, or the factory is nil.
+func RegisterOperator(name string, factory OperatorFactory) {
+	operatorsLock.Lock()
+	defer operatorsLock.Unlock()
+	if name == "" || factory == nil {
+		panic("pixi: operator must have a name and a factory")
+	}
+	if _, exists := operators[name]; exists {
+		panic("pixi: operator '" + name + "' registered twice")
+	}
+	operators[name] = factory
+}
+
+// The names of the registered operators, in sorted order.
+func RegisteredOperators() []string {
+	operatorsLock.RLock()
+	defer operatorsLock.RUnlock()
+	names := make([]string, 0, len(operators))
+	for name := range operators {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Creates the registered operator of the given name from its parameters.
+func NewOperator(name string, params json.RawMessage) (Operator, error) {
+	operatorsLock.RLock()
+	factory, ok := operators[name]
+	operatorsLock.RUnlock()
+	if !ok {
+		return nil, pixi.UnsupportedError("no operator registered as '" + name + "'")
+	}
+	return factory(params)
+}
+
+// Adds a step computed by an operator. The layer produced by the earlier steps is computed a tile at a
+// time and kept in the cache of each run, where the tiles of the operator read by neighbouring output
+// tiles are shared.
+func (p *Pipeline) Apply(op Operator) *Pipeline {
+	return p.step("apply", func() error {
+		dims, fields, err := op.OutputLayerSpec(slices.Clone(p.dims), slices.Clone(p.fields))
+		if err != nil {
+			return fmt.Errorf("%s: %w", op.Describe(), err)
+		}
+		if len(dims) == 0 || len(fields) == 0 {
+			return pixi.FormatError(op.Describe() + ": output must have dimensions and fields")
+		}
+		for _, dim := range dims {
+			if dim.Size <= 0 || dim.TileSize <= 0 || dim.TileSize > dim.Size {
+				return pixi.FormatError(op.Describe() + ": output dimension '" + dim.Name + "' has invalid sizes")
+			}
+		}
+		for _, field := range fields {
+			if field.Size() == 0 {
+				return pixi.UnsupportedError(op.Describe() + ": output field '" + field.Name + "' has an unknown type")
+			}
+		}
+		if err := fields.Validate(); err != nil {
+			return fmt.Errorf("%s: %w", op.Describe(), err)
+		}
+
+		srcDims, srcFields, build := p.dims, p.fields, p.build
+		p.tileBytes = max(p.tileBytes, srcDims.TileSamples()*fieldsSize(srcFields), dims.TileSamples()*fieldsSize(fields))
+		p.dims, p.fields = dims, fields
+		p.build = func(run *pipelineRun) sampleFunc {
+			input := &operatorInput{tiledStep: run.tiled(srcDims, srcFields, build(run))}
+			return run.tiledBy(dims, fields, func(tileIndex int) ([]byte, error) {
+				start, end := dims.TileBounds(tileIndex)
+				tile := &OperatorTile{
+					Start:  start,
+					End:    end,
+					dims:   dims,
+					fields: fields,
+					order:  run.header.ByteOrder,
+					data:   make([]byte, dims.TileSamples()*fieldsSize(fields)),
+				}
+				err := op.ProcessTile(input, tile)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", op.Describe(), err)
+				}
+				return tile.data, nil
+			}).SampleAt
+		}
+		return nil
+	})
+}
+
+// The input of an operator, checking that samples read from it are inside the layer.
+type operatorInput struct {
+	*tiledStep
+}
+
+func (i *operatorInput) Dimensions() pixi.DimensionSet {
+	return i.dims
+}
+
+func (i *operatorInput) Fields() pixi.FieldSet {
+	return i.fields
+}
+
+func (i *operatorInput) SampleAt(coord pixi.SampleCoordinate) ([]any, error) {
+	if len(coord) != len(i.dims) {
+		return nil, pixi.FormatError("sample coordinate does not match the input of the operator")
+	}
+	for d, dim := range i.dims {
+		if coord[d] < 0 || coord[d] >= dim.Size {
+			return nil, pixi.FormatError("sample coordinate outside the input of the operator")
+		}
+	}
+	return i.tiledStep.SampleAt(coord)
+}
@@ -0,0 +1,161 @@
+package edit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/internal/buffer"
+	"github.com/owlpinetech/pixi/read"
+)
+
+// Replaces every sample with the mean of the first field over the samples within radius of it.
+type boxFilter struct {
+	Radius int `json:"radius"`
+}
+
+func (f boxFilter) Describe() string {
+	return fmt.Sprintf("box filter of radius %d", f.Radius)
+}
+
+func (f boxFilter) OutputLayerSpec(dims pixi.DimensionSet, fields pixi.FieldSet) (pixi.DimensionSet, pixi.FieldSet, error) {
+	if f.Radius < 0 {
+		return nil, nil, pixi.FormatError("negative radius")
+	}
+	return dims, pixi.FieldSet{{Name: "smoothed", Type: pixi.FieldFloat64}}, nil
+}
+
+func (f boxFilter) ProcessTile(input SampleSource, tile *OperatorTile) error {
+	dims := input.Dimensions()
+	for coord := range (Region{Start: tile.Start, End: tile.End}).Coordinates() {
+		start, end := make(pixi.SampleCoordinate, len(coord)), make(pixi.SampleCoordinate, len(coord))
+		for i := range coord {
+			start[i], end[i] = max(0, coord[i]-f.Radius), min(dims[i].Size, coord[i]+f.Radius+1)
+		}
+		sum, count := 0.0, 0
+		for near := range (Region{Start: start, End: end}).Coordinates() {
+			sample, err := input.SampleAt(near)
+			if err != nil {
+				return err
+			}
+			sum += input.Fields()[0].Type.ValueToFloat64(sample[0])
+			count++
+		}
+		err := tile.Set(coord, []any{sum / float64(count)})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reads one sample past the edge of its input.
+type overreach struct{}
+
+func (overreach) Describe() string { return "overreach" }
+
+func (overreach) OutputLayerSpec(dims pixi.DimensionSet, fields pixi.FieldSet) (pixi.DimensionSet, pixi.FieldSet, error) {
+	return dims, fields, nil
+}
+
+func (overreach) ProcessTile(input SampleSource, tile *OperatorTile) error {
+	_, err := input.SampleAt(tile.End)
+	return err
+}
+
+func init() {
+	RegisterOperator("test-box", func(params json.RawMessage) (Operator, error) {
+		filter := boxFilter{Radius: 1}
+		if len(params) > 0 {
+			if err := json.Unmarshal(params, &filter); err != nil {
+				return nil, err
+			}
+		}
+		return filter, nil
+	})
+}
+
+func TestPipelineApplyOperator(t *testing.T) {
+	buf := writeIndexedLayer(t, pixi.CompressionNone)
+	rdr := buffer.NewBufferFrom(buf.Bytes())
+	src, err := pixi.ReadPixi(rdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spec, err := ReadPipelineSpec(strings.NewReader(`{"steps": [{"operator": {"name": "test-box", "params": {"radius": 2}}}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pipeline := spec.Build(NewLayerView(rdr, src.Header, src.Layers[0])).SetOptions(PipelineOptions{Workers: 4})
+	out := buffer.NewBuffer(20)
+	err = pipeline.Write(context.Background(), out, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outRdr := buffer.NewBufferFrom(out.Bytes())
+	written, err := pixi.ReadPixi(outRdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layer := written.Layers[0]
+	if len(layer.Fields) != 1 || layer.Fields[0].Name != "smoothed" {
+		t.Fatalf("unexpected output fields %v", layer.Fields)
+	}
+	cache := read.NewLayerReadCache(outRdr, written.Header, layer, read.NewLfuCacheManager(4))
+	for coord := range layer.Dimensions.SampleCoordinates() {
+		sample, err := cache.SampleAt(coord)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the mean index of a block is the index of the mean coordinate in each dimension
+		meanX := float64(max(0, coord[0]-2)+min(9, coord[0]+2)) / 2
+		meanY := float64(max(0, coord[1]-2)+min(9, coord[1]+2)) / 2
+		if want := meanX + 10*meanY; sample[0] != want {
+			t.Errorf("expected %v at %v, got %v", want, coord, sample[0])
+		}
+	}
+}
+
+func TestPipelineApplyErrors(t *testing.T) {
+	buf := writeIndexedLayer(t, pixi.CompressionNone)
+	rdr := buffer.NewBufferFrom(buf.Bytes())
+	src, err := pixi.ReadPixi(rdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	view := NewLayerView(rdr, src.Header, src.Layers[0])
+
+	if err := NewPipeline(view).Apply(boxFilter{Radius: -1}).Err(); err == nil || !strings.Contains(err.Error(), "box filter of radius -1") {
+		t.Errorf("expected the output spec of the operator to be rejected, got %v", err)
+	}
+	err = NewPipeline(view).Apply(overreach{}).Write(context.Background(), buffer.NewBuffer(10), nil)
+	if err == nil || !strings.Contains(err.Error(), "overreach") {
+		t.Errorf("expected reading outside the input to fail, got %v", err)
+	}
+
+	spec, err := ReadPipelineSpec(strings.NewReader(`{"steps": [{"operator": {"name": "no-such-operator"}}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.Build(view).Err() == nil {
+		t.Error("expected an unregistered operator to be rejected")
+	}
+}
+
+func TestRegisterOperator(t *testing.T) {
+	if !slices.Contains(RegisteredOperators(), "test-box") {
+		t.Errorf("expected test-box among %v", RegisteredOperators())
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("expected registering a name twice to panic")
+		}
+	}()
+	RegisterOperator("test-box", func(json.RawMessage) (Operator, error) { return boxFilter{}, nil })
+}
@@ -0,0 +1,171 @@
+package edit
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/owlpinetech/pixi"
+)
+
+// Where the parts of a file rewritten by Optimize ended up.
+type OptimizeReport struct {
+	// The number of bytes at the start of the file holding its structure: the header, the file and
+	// layer tags, and the header of every layer. Reading this many bytes is enough to read the file with
+	// pixi.ReadPixi.
+	StructureBytes int64
+	// The number of bytes at the start of the file holding its structure and the tiles of every overview
+	// layer, enough to show a first view of the file at the resolution of the largest overview.
+	OverviewBytes int64
+	// The number of bytes in the whole file.
+	TotalBytes int64
+}
+
+// Options for Optimize.
+type OptimizeOptions struct {
+	Progress ProgressFunc // Called as tiles are copied, if set.
+	// Whether the file must meet the cloud-optimized profile (see CheckCloudOptimized). The file is written
+	// with 8 byte offsets, and if its layers cannot meet the profile, such as for lacking overviews,
+	// Optimize fails with an error wrapping ErrNotCloudOptimized before writing anything.
+	CloudOptimized bool
+}
+
+// Copies the Pixi file in src to dst laid out for readers that fetch it over a network, in the manner
+// of a cloud optimized GeoTIFF: the header and file tags, then the header of every layer, then the tags
+// of every layer, then the tiles of the overview layers from the smallest to the largest, and last the
+// tiles of the other layers. A remote reader can then learn the structure of the whole file, and
+// draw its overviews, from a single request for the first bytes of the file, which the report gives the
+// size of. As with UpdateOverviews, the first layer is the base layer and the layers after it are
+// overviews of the layer before, for as long as each can be computed from the one before (see
+// OverviewFactors). Layers keep their order, and tiles are copied as with Compact, without being decoded
+// and dropping any content seal and scratch layers. Cancelling the context stops the copy between tiles.
+func Optimize(ctx context.Context, dst io.WriteSeeker, src io.ReadSeeker, options OptimizeOptions) (OptimizeReport, error) {
+	report := OptimizeReport{}
+	srcPixi, err := pixi.ReadPixi(src)
+	if err != nil {
+		return report, err
+	}
+	header := srcPixi.Header
+	if options.CloudOptimized {
+		if problems := cloudLayerProblems(srcPixi.Layers); len(problems) > 0 {
+			return report, fmt.Errorf("%w: %s", ErrNotCloudOptimized, strings.Join(problems, "; "))
+		}
+		header.OffsetSize = 8
+	}
+
+	tags := mergeTagSections(srcPixi.Tags)
+	delete(tags.Tags, pixi.ContentHashTag)
+	delete(tags.Tags, pixi.ContentSizeTag)
+	header.SetFeatures(srcPixi.Layers, []*pixi.TagSection{tags})
+	err = header.WriteHeader(dst)
+	if err != nil {
+		return report, err
+	}
+	tagsOffset, err := dst.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return report, err
+	}
+	err = tags.Write(dst, header)
+	if err != nil {
+		return report, err
+	}
+
+	// the layer headers are written first to reserve their space, and again once their tiles are placed
+	layers := make([]*pixi.Layer, len(srcPixi.Layers))
+	layerOffsets := make([]int64, len(srcPixi.Layers))
+	tracker := &progressTracker{report: options.Progress}
+	for i, srcLayer := range srcPixi.Layers {
+		layers[i] = deriveLayer(srcLayer, srcLayer.Compression, srcLayer.Dimensions)
+		layerOffsets[i], err = dst.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return report, err
+		}
+		err = layers[i].WriteHeader(dst, header)
+		if err != nil {
+			return report, err
+		}
+		tracker.total += srcLayer.DiskTiles()
+	}
+	firstLayerOffset := int64(0)
+	if len(layers) > 0 {
+		firstLayerOffset = layerOffsets[0]
+	}
+	err = header.OverwriteOffsets(dst, firstLayerOffset, tagsOffset)
+	if err != nil {
+		return report, err
+	}
+	for _, layer := range layers {
+		if len(layer.Tags) == 0 {
+			continue
+		}
+		err = layer.WriteTags(dst, header)
+		if err != nil {
+			return report, err
+		}
+	}
+	report.StructureBytes, err = dst.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return report, err
+	}
+
+	overviews := overviewChain(srcPixi.Layers)
+	report.OverviewBytes = report.StructureBytes
+	for n, layerIndex := range cloudTileOrder(srcPixi.Layers) {
+		layer, srcLayer := layers[layerIndex], srcPixi.Layers[layerIndex]
+		for tileIndex := range layer.DiskTiles() {
+			if err := ctx.Err(); err != nil {
+				return report, err
+			}
+			if srcLayer.TileBytes[tileIndex] != 0 {
+				err = layer.CopyEncodedTile(dst, src, header, srcLayer, tileIndex)
+				if err != nil {
+					return report, err
+				}
+			}
+			tracker.add(1)
+		}
+		if n < len(overviews) {
+			report.OverviewBytes, err = dst.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return report, err
+			}
+		}
+	}
+
+	for i, layer := range layers {
+		if i < len(layers)-1 {
+			layer.NextLayerStart = layerOffsets[i+1]
+		}
+		err = layer.OverwriteHeader(dst, header, layerOffsets[i])
+		if err != nil {
+			return report, err
+		}
+	}
+	report.TotalBytes, err = dst.Seek(0, io.SeekEnd)
+	return report, err
+}
+
+// Optimizes the named file in place, replacing it as CompactFile does.
+func OptimizeFile(ctx context.Context, name string, waitForLock bool, options OptimizeOptions) (OptimizeReport, error) {
+	var report OptimizeReport
+	err := replaceFile(name, waitForLock, "optimize", func(dst io.WriteSeeker, src io.ReadSeeker) error {
+		var err error
+		report, err = Optimize(ctx, dst, src, options)
+		return err
+	})
+	return report, err
+}
+
+// The indices of the layers after the first that are overviews of the layer before them, as taken by
+// UpdateOverviews, from the largest to the smallest.
+func overviewChain(layers []*pixi.Layer) []int {
+	chain := []int{}
+	for i := 1; i < len(layers); i++ {
+		if _, ok := OverviewFactors(layers[i-1], layers[i]); !ok {
+			break
+		}
+		chain = append(chain, i)
+	}
+	return chain
+}
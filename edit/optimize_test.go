@@ -0,0 +1,62 @@
+package edit
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/internal/buffer"
+)
+
+func TestOptimizeOrdersForRemoteReads(t *testing.T) {
+	src := writePyramid(t, pixi.CompressionFlate)
+	dst := buffer.NewBuffer(20)
+	report, err := Optimize(context.Background(), dst, buffer.NewBufferFrom(src.Bytes()), OptimizeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.TotalBytes != int64(len(dst.Bytes())) || report.StructureBytes >= report.OverviewBytes || report.OverviewBytes >= report.TotalBytes {
+		t.Fatalf("unexpected report %+v for a file of %d bytes", report, len(dst.Bytes()))
+	}
+
+	// the structure alone is enough to read the layout of the whole file
+	head, err := pixi.ReadPixi(buffer.NewBufferFrom(dst.Bytes()[:report.StructureBytes]))
+	if err != nil {
+		t.Fatalf("expected the file to be readable from its first %d bytes: %v", report.StructureBytes, err)
+	}
+	tileSpan := func(layer *pixi.Layer) (int64, int64) {
+		first, last := layer.TileOffsets[0], layer.TileOffsets[0]+layer.TileBytes[0]
+		for i := range layer.TileOffsets {
+			first, last = min(first, layer.TileOffsets[i]), max(last, layer.TileOffsets[i]+layer.TileBytes[i])
+		}
+		return first, last
+	}
+	baseStart, _ := tileSpan(head.Layers[0])
+	halfStart, halfEnd := tileSpan(head.Layers[1])
+	quarterStart, quarterEnd := tileSpan(head.Layers[2])
+	if quarterStart < report.StructureBytes || quarterEnd > halfStart || halfEnd > report.OverviewBytes || baseStart < report.OverviewBytes {
+		t.Errorf("expected the smallest overview first and the base layer last, got quarter %d-%d, half %d-%d, base from %d",
+			quarterStart, quarterEnd, halfStart, halfEnd, baseStart)
+	}
+
+	srcPixi, err := pixi.ReadPixi(buffer.NewBufferFrom(src.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, layer := range head.Layers {
+		want, err := NewMemoryLayer(buffer.NewBufferFrom(src.Bytes()), srcPixi.Header, srcPixi.Layers[i], srcPixi.LayerOffset(srcPixi.Layers[i]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := NewMemoryLayer(buffer.NewBufferFrom(dst.Bytes()), head.Header, layer, head.LayerOffset(layer))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for coord := range layer.Dimensions.SampleCoordinates() {
+			if !reflect.DeepEqual(got.SampleAt(coord), want.SampleAt(coord)) {
+				t.Fatalf("layer %s: sample at %v changed", layer.Name, coord)
+			}
+		}
+	}
+}
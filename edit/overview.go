@@ -0,0 +1,124 @@
+package edit
+
+import (
+	"io"
+	"slices"
+
+	"github.com/owlpinetech/pixi"
+)
+
+// Recomputes the overview layers of a Pixi stream after some tiles of its base layer were edited, without
+// regenerating the overviews from scratch. The first layer in the stream is the base layer, and each layer
+// after it is treated as an overview of the one before, for as long as the layers have the same fields and
+// dimensions that are each no larger than those of the previous layer. Each overview sample is the mean
+// of the samples of the previous layer it covers, so only the overview tiles covering changedTiles (as
+// reported by a DirtyTracker for the base layer) and the tiles above them in the pyramid are recomputed.
+func UpdateOverviews(rw io.ReadWriteSeeker, changedTiles []int) error {
+	_, err := rw.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	summary, err := pixi.ReadPixi(rw)
+	if err != nil {
+		return err
+	}
+	if len(summary.Layers) == 0 {
+		return nil
+	}
+
+	prev := summary.Layers[0]
+	prevCache := NewFifoCacheLayer(rw, summary.Header, prev, summary.LayerOffset(prev), WriteBack, 8)
+	changed := slices.Clone(changedTiles)
+	for _, overview := range summary.Layers[1:] {
+		factors, ok := OverviewFactors(prev, overview)
+		if !ok || len(changed) == 0 {
+			break
+		}
+		cache := NewFifoCacheLayer(rw, summary.Header, overview, summary.LayerOffset(overview), WriteBack, 8)
+		affected := affectedOverviewTiles(prev, overview, factors, changed)
+		for _, tileIndex := range affected {
+			start, end := overview.Dimensions.TileBounds(tileIndex)
+			for coord := range (Region{Start: start, End: end}).Coordinates() {
+				for fieldIndex := range overview.Fields {
+					mean, err := coveredMean(prevCache, factors, coord, fieldIndex)
+					if err != nil {
+						return err
+					}
+					err = cache.SetFieldAt(coord, fieldIndex, mean)
+					if err != nil {
+						return err
+					}
+				}
+			}
+		}
+		err = cache.Flush()
+		if err != nil {
+			return err
+		}
+		prev, prevCache, changed = overview, cache, affected
+	}
+	return nil
+}
+
+// Returns the factor by which each dimension of the base layer is reduced in the overview, and whether
+// the overview can be computed from the base layer at all: it must have the same fields, and each of its
+// dimensions must be the size of the base dimension divided by a whole factor, rounded up.
+func OverviewFactors(base *pixi.Layer, overview *pixi.Layer) ([]int, bool) {
+	if len(base.Dimensions) != len(overview.Dimensions) || !slices.Equal(base.Fields, overview.Fields) {
+		return nil, false
+	}
+	factors := make([]int, len(base.Dimensions))
+	for i, dim := range base.Dimensions {
+		if overview.Dimensions[i].Size > dim.Size {
+			return nil, false
+		}
+		factors[i] = (dim.Size + overview.Dimensions[i].Size - 1) / overview.Dimensions[i].Size
+		if (dim.Size+factors[i]-1)/factors[i] != overview.Dimensions[i].Size {
+			return nil, false
+		}
+	}
+	return factors, true
+}
+
+// The sorted indices of the overview tiles that cover any sample of the given base tiles.
+func affectedOverviewTiles(base *pixi.Layer, overview *pixi.Layer, factors []int, baseTiles []int) []int {
+	affected := []int{}
+	for _, baseTile := range baseTiles {
+		start, end := base.Dimensions.TileBounds(baseTile)
+		tileStart := make([]int, len(start))
+		tileEnd := make([]int, len(end))
+		for i, dim := range overview.Dimensions {
+			tileStart[i] = start[i] / factors[i] / dim.TileSize
+			tileEnd[i] = min((end[i]-1)/factors[i], dim.Size-1)/dim.TileSize + 1
+		}
+		for tileCoord := range (Region{Start: tileStart, End: tileEnd}).Coordinates() {
+			selector := pixi.TileCoordinate{Tile: tileCoord, InTile: make([]int, len(tileCoord))}.ToTileSelector(overview.Dimensions)
+			affected = append(affected, selector.Tile)
+		}
+	}
+	slices.Sort(affected)
+	return slices.Compact(affected)
+}
+
+// The mean of a field over the samples of the base layer covered by a single overview sample.
+func coveredMean(base *FifoCacheLayer, factors []int, coord pixi.SampleCoordinate, fieldIndex int) (any, error) {
+	dims := base.Layer().Dimensions
+	start := make(pixi.SampleCoordinate, len(coord))
+	end := make(pixi.SampleCoordinate, len(coord))
+	for i := range coord {
+		start[i] = coord[i] * factors[i]
+		end[i] = min(start[i]+factors[i], dims[i].Size)
+	}
+	fieldType := base.Layer().Fields[fieldIndex].Type
+	sum := 0.0
+	count := 0
+	for covered := range (Region{Start: start, End: end}).Coordinates() {
+		val, err := base.FieldAt(covered, fieldIndex)
+		if err != nil {
+			return nil, err
+		}
+		sum += fieldType.ValueToFloat64(val)
+		count += 1
+	}
+	return fieldType.Float64ToValue(sum / float64(count)), nil
+}
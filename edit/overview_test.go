@@ -0,0 +1,108 @@
+package edit
+
+import (
+	"encoding/binary"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/internal/buffer"
+)
+
+func writePyramid(t *testing.T, compression pixi.Compression) *buffer.Buffer {
+	t.Helper()
+	header := pixi.PixiHeader{Version: pixi.Version, OffsetSize: 4, ByteOrder: binary.LittleEndian}
+	fields := []pixi.Field{{Name: "height", Type: pixi.FieldUint16}, {Name: "temp", Type: pixi.FieldFloat64}}
+	buf := buffer.NewBuffer(20)
+	err := WriteContiguousTileOrderPixi(buf, header, map[string]string{},
+		LayerWriter{
+			Layer: pixi.NewLayer("base", false, compression,
+				pixi.DimensionSet{{Name: "x", Size: 11, TileSize: 4}, {Name: "y", Size: 6, TileSize: 3}}, fields),
+			IterFn: func(layer *pixi.Layer, coord pixi.SampleCoordinate) ([]any, map[string]any) {
+				return []any{uint16(rand.IntN(1000)), rand.Float64()}, nil
+			},
+		},
+		LayerWriter{
+			Layer: pixi.NewLayer("half", false, compression,
+				pixi.DimensionSet{{Name: "x", Size: 6, TileSize: 2}, {Name: "y", Size: 3, TileSize: 3}}, fields),
+			IterFn: func(layer *pixi.Layer, coord pixi.SampleCoordinate) ([]any, map[string]any) {
+				return []any{uint16(0), 0.0}, nil
+			},
+		},
+		LayerWriter{
+			Layer: pixi.NewLayer("quarter", false, compression,
+				pixi.DimensionSet{{Name: "x", Size: 3, TileSize: 3}, {Name: "y", Size: 2, TileSize: 1}}, fields),
+			IterFn: func(layer *pixi.Layer, coord pixi.SampleCoordinate) ([]any, map[string]any) {
+				return []any{uint16(0), 0.0}, nil
+			},
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf
+}
+
+// Checks every overview sample against the mean of the covered samples of the layer below it.
+func checkPyramid(t *testing.T, buf *buffer.Buffer) {
+	t.Helper()
+	rdr := buffer.NewBufferFrom(buf.Bytes())
+	summary, err := pixi.ReadPixi(rdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	levels := make([]*MemoryLayer, len(summary.Layers))
+	for i, layer := range summary.Layers {
+		levels[i], err = NewMemoryLayer(rdr, summary.Header, layer, summary.LayerOffset(layer))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 1; i < len(levels); i++ {
+		prev, cur := levels[i-1].Layer().Dimensions, levels[i].Layer().Dimensions
+		for coord := range cur.SampleCoordinates() {
+			heightSum, tempSum, count := 0.0, 0.0, 0
+			for y := coord[1] * 2; y < min(coord[1]*2+2, prev[1].Size); y++ {
+				for x := coord[0] * 2; x < min(coord[0]*2+2, prev[0].Size); x++ {
+					sample := levels[i-1].SampleAt(pixi.SampleCoordinate{x, y})
+					heightSum += float64(sample[0].(uint16))
+					tempSum += sample[1].(float64)
+					count += 1
+				}
+			}
+			got := levels[i].SampleAt(coord)
+			want := []any{pixi.FieldUint16.Float64ToValue(heightSum / float64(count)), tempSum / float64(count)}
+			if got[0] != want[0] || got[1] != want[1] {
+				t.Fatalf("level %d: expected %v at %v, got %v", i, want, coord, got)
+			}
+		}
+	}
+}
+
+func TestUpdateOverviews(t *testing.T) {
+	for _, compression := range []pixi.Compression{pixi.CompressionNone, pixi.CompressionFlate} {
+		buf := writePyramid(t, compression)
+		allTiles := []int{}
+		for i := range 6 {
+			allTiles = append(allTiles, i)
+		}
+		err := UpdateOverviews(buf, allTiles)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkPyramid(t, buf)
+
+		mem := openMemoryLayer(t, buf)
+		mem.SetSampleAt(pixi.SampleCoordinate{10, 5}, []any{uint16(60000), 1000.0})
+		mem.SetSampleAt(pixi.SampleCoordinate{4, 0}, []any{uint16(50000), -1000.0})
+		dirty := mem.DirtyTiles()
+		err = mem.Commit()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = UpdateOverviews(buf, dirty)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkPyramid(t, buf)
+	}
+}
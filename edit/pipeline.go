@@ -0,0 +1,376 @@
+package edit
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/owlpinetech/pixi"
+)
+
+// A chain of processing steps applied to a layer, such as cropping, casting, computing a band from others
+// and resampling, built by calling a method for each step and then written with Write. Each step is
+// checked against the layer produced by the steps before it as it is added, and the first step that does
+// not fit is reported by Err and by Write, so that a misconfigured pipeline fails before anything is
+// read. Nothing is computed until Write, which computes the tiles of the output in parallel (see
+// PipelineOptions), streaming each sample through the whole chain without intermediate files.
+type Pipeline struct {
+	header      pixi.PixiHeader
+	name        string
+	dims        pixi.DimensionSet
+	fields      pixi.FieldSet
+	compression pixi.Compression                  // The compression of the layer written.
+	separated   bool                              // Whether the fields of the layer written are stored in separate tiles.
+	build       func(run *pipelineRun) sampleFunc // Creates the chain of steps for a single run of the pipeline.
+	tileBytes   int                               // The size of the largest tile held in the cache of a run.
+	options     PipelineOptions
+	steps       int
+	err         error
+}
+
+// Starts a pipeline reading from the given view, which may itself be a window, slice or any other view
+// of a layer. Unless changed by Compress or Interleave, the layer written has the compression and the
+// field layout of the layer the view is of.
+func NewPipeline(src *LayerView) *Pipeline {
+	return &Pipeline{
+		header:      src.header,
+		name:        src.Layer.Name,
+		dims:        src.Layer.Dimensions,
+		fields:      src.Layer.Fields,
+		compression: src.src.Compression,
+		separated:   src.src.Separated,
+		build: func(run *pipelineRun) sampleFunc {
+			return src.withCacheManager(run.manager()).sampleAt
+		},
+		tileBytes: src.src.DiskTileSize(0),
+	}
+}
+
+// Starts a pipeline reading from several views combined into a single layer, placing the first sample
+// of each view at the corresponding offset, as Stitch does for whole files: the layer is just large
+// enough to hold every view, samples not covered by any view are zero, and later views replace earlier
+// ones where they overlap. The views must have the same fields and the same number of dimensions, with
+// the same names, and the values of later views are converted to what the first view measures, which
+// must be from the same datum. The layer takes its name, tiling, compression and field layout from the
+// first view.
+func NewStitchPipeline(srcs []*LayerView, offsets [][]int) *Pipeline {
+	if len(srcs) == 0 || len(offsets) != len(srcs) {
+		p := &Pipeline{}
+		return p.step("stitch", func() error { return pixi.FormatError("stitching requires at least one source and an offset for each") })
+	}
+	first := srcs[0]
+	p := NewPipeline(first)
+	return p.step("stitch", func() error {
+		dims := slices.Clone(first.Layer.Dimensions)
+		for d := range dims {
+			dims[d].Size = 0
+		}
+		for i, src := range srcs {
+			if !slices.Equal(src.Layer.Fields, first.Layer.Fields) || !sameDimensionNames(src.Layer.Dimensions, first.Layer.Dimensions) {
+				return pixi.FormatError(fmt.Sprintf("source %d does not have the same fields and dimensions as the first source", i))
+			}
+			offset := offsets[i]
+			if len(offset) != len(dims) || (len(offset) > 0 && slices.Min(offset) < 0) {
+				return pixi.FormatError(fmt.Sprintf("offset of source %d must have a non-negative entry for every dimension", i))
+			}
+			for d := range dims {
+				dims[d].Size = max(dims[d].Size, offset[d]+src.Layer.Dimensions[d].Size)
+			}
+			p.tileBytes = max(p.tileBytes, src.src.DiskTileSize(0))
+		}
+		for d := range dims {
+			dims[d].TileSize = min(dims[d].TileSize, dims[d].Size)
+		}
+
+		layers := make([]*pixi.Layer, len(srcs))
+		for i, src := range srcs {
+			layers[i] = src.Layer
+		}
+		conversions, err := layerConversions(layers, nil)
+		if err != nil {
+			return err
+		}
+
+		fields := first.Layer.Fields
+		p.dims = dims
+		p.build = func(run *pipelineRun) sampleFunc {
+			tiles := make([]stitchTile, len(srcs))
+			samples := make([]sampleFunc, len(srcs))
+			for i, src := range srcs {
+				tiles[i] = stitchTile{dims: src.Layer.Dimensions, offset: offsets[i], convert: conversions[i]}
+				samples[i] = src.withCacheManager(run.manager()).sampleAt
+			}
+			return func(coord pixi.SampleCoordinate) ([]any, error) {
+				for i := len(tiles) - 1; i >= 0; i-- {
+					if local, ok := tiles[i].local(coord); ok {
+						sample, err := samples[i](local)
+						if err != nil {
+							return nil, err
+						}
+						return tiles[i].converted(sample, fields), nil
+					}
+				}
+				zero := make([]any, len(fields))
+				for i, field := range fields {
+					zero[i] = field.BytesToValue(make([]byte, field.Size()), run.header.ByteOrder)
+				}
+				return zero, nil
+			}
+		}
+		return nil
+	})
+}
+
+// Sets how the pipeline is run by Write.
+func (p *Pipeline) SetOptions(options PipelineOptions) *Pipeline {
+	p.options = options
+	return p
+}
+
+// Adds a step, unless an earlier step has failed, recording the error of the step if it fails.
+func (p *Pipeline) step(name string, apply func() error) *Pipeline {
+	if p.err != nil {
+		return p
+	}
+	p.steps++
+	err := apply()
+	if err != nil {
+		p.err = fmt.Errorf("step %d (%s): %w", p.steps, name, err)
+	}
+	return p
+}
+
+// The error of the first step that could not be added, if any.
+func (p *Pipeline) Err() error {
+	return p.err
+}
+
+// The dimensions of the layer the pipeline produces with the steps added so far.
+func (p *Pipeline) Dimensions() pixi.DimensionSet {
+	return p.dims
+}
+
+// The fields of the layer the pipeline produces with the steps added so far.
+func (p *Pipeline) Fields() pixi.FieldSet {
+	return p.fields
+}
+
+// Keeps only the samples with coordinates at least start and less than end in every dimension.
+func (p *Pipeline) Crop(start pixi.SampleCoordinate, end pixi.SampleCoordinate) *Pipeline {
+	return p.step("crop", func() error {
+		if len(start) != len(p.dims) || len(end) != len(p.dims) {
+			return pixi.FormatError("crop does not match the number of layer dimensions")
+		}
+		dims := make(pixi.DimensionSet, len(p.dims))
+		for i, dim := range p.dims {
+			if start[i] < 0 || end[i] > dim.Size || start[i] >= end[i] {
+				return pixi.FormatError("crop is empty or outside the layer")
+			}
+			dim.Size = end[i] - start[i]
+			dim.TileSize = min(dim.TileSize, dim.Size)
+			dims[i] = dim
+		}
+		start, build := slices.Clone(start), p.build
+		p.dims = dims
+		p.build = func(run *pipelineRun) sampleFunc {
+			sample := build(run)
+			return func(coord pixi.SampleCoordinate) ([]any, error) {
+				shifted := make(pixi.SampleCoordinate, len(coord))
+				for i := range coord {
+					shifted[i] = coord[i] + start[i]
+				}
+				return sample(shifted)
+			}
+		}
+		return nil
+	})
+}
+
+// Keeps only the named fields, in the order given.
+func (p *Pipeline) Select(names ...string) *Pipeline {
+	return p.step("select", func() error {
+		if len(names) == 0 {
+			return pixi.FormatError("must select at least one field")
+		}
+		indices := make([]int, len(names))
+		fields := make(pixi.FieldSet, len(names))
+		for i, name := range names {
+			index, ok := p.fields.ByName(name)
+			if !ok {
+				return pixi.FormatError("no field named '" + name + "'")
+			}
+			indices[i], fields[i] = index, p.fields[index]
+		}
+		build := p.build
+		p.fields = fields
+		p.build = func(run *pipelineRun) sampleFunc {
+			sample := build(run)
+			return func(coord pixi.SampleCoordinate) ([]any, error) {
+				values, err := sample(coord)
+				if err != nil {
+					return nil, err
+				}
+				selected := make([]any, len(indices))
+				for i, index := range indices {
+					selected[i] = values[index]
+				}
+				return selected, nil
+			}
+		}
+		return nil
+	})
+}
+
+// Converts the named field to another type, as with pixi.FieldType.Float64ToValue: integer values are
+// rounded and clamped to the range of the new type.
+func (p *Pipeline) Cast(name string, fieldType pixi.FieldType) *Pipeline {
+	return p.step("cast", func() error {
+		index, ok := p.fields.ByName(name)
+		if !ok {
+			return pixi.FormatError("no field named '" + name + "'")
+		}
+		if fieldType.Size() == 0 {
+			return pixi.UnsupportedError("cannot cast to an unknown field type")
+		}
+		srcType, build := p.fields[index].Type, p.build
+		p.fields = slices.Clone(p.fields)
+		p.fields[index].Type = fieldType
+		p.build = func(run *pipelineRun) sampleFunc {
+			sample := build(run)
+			return func(coord pixi.SampleCoordinate) ([]any, error) {
+				values, err := sample(coord)
+				if err != nil {
+					return nil, err
+				}
+				values[index] = fieldType.Float64ToValue(srcType.ValueToFloat64(values[index]))
+				return values, nil
+			}
+		}
+		return nil
+	})
+}
+
+// Changes the tile size of every dimension to tileSize, or of individual dimensions by name to the sizes
+// in dimensionTileSizes, as Retile does for whole files; a tile size of 0 keeps the current tile size. Tile
+// sizes rejected by pixi.DimensionSet.CheckTiling fail with pixi.ErrSlowTiling unless allowSlowTiling.
+func (p *Pipeline) Retile(tileSize int, dimensionTileSizes map[string]int, allowSlowTiling bool) *Pipeline {
+	return p.step("retile", func() error {
+		dims := slices.Clone(p.dims)
+		for d, dim := range dims {
+			size := tileSize
+			if named, found := dimensionTileSizes[dim.Name]; found {
+				size = named
+			}
+			if size < 0 {
+				return pixi.FormatError("tile size of dimension '" + dim.Name + "' must not be negative")
+			}
+			if size > 0 {
+				dims[d].TileSize = min(size, dim.Size)
+			}
+		}
+		if !allowSlowTiling {
+			if err := dims.CheckTiling(); err != nil {
+				return err
+			}
+		}
+		p.dims = dims
+		return nil
+	})
+}
+
+// Sets the compression of the layer written, as Compress does for whole files. Since compression only
+// affects how the result is stored, it applies to the written layer wherever it is in the chain.
+func (p *Pipeline) Compress(compression pixi.Compression) *Pipeline {
+	return p.step("compress", func() error {
+		if !slices.Contains(pixi.SupportedCompressions(), compression) {
+			return pixi.UnsupportedError("unknown compression")
+		}
+		p.compression = compression
+		return nil
+	})
+}
+
+// Sets whether the fields of the layer written are stored in separate tiles (planar) or interleaved in
+// the same tiles (contiguous). Like Compress, it applies to the written layer wherever it is in the chain.
+func (p *Pipeline) Interleave(separated bool) *Pipeline {
+	return p.step("interleave", func() error {
+		p.separated = separated
+		return nil
+	})
+}
+
+// Adds a field of the given name and type computed from the other fields of each sample by an arithmetic
+// expression, such as "(nir - red) / (nir + red)". Expressions are made of numbers, field names, the
+// operators + - * / with the usual precedence, unary minus and parentheses; field names that are not
+// identifiers can be written in double quotes. The expression is computed in floating point and the
+// result converted to the type of the field as with Cast.
+func (p *Pipeline) BandMath(name string, fieldType pixi.FieldType, expression string) *Pipeline {
+	return p.step("band math", func() error {
+		if _, exists := p.fields.ByName(name); exists || name == "" {
+			return pixi.FormatError("band math field must have a new, non-empty name")
+		}
+		if fieldType.Size() == 0 {
+			return pixi.UnsupportedError("band math field must have a known type")
+		}
+		eval, err := compileBandMath(expression, p.fields)
+		if err != nil {
+			return err
+		}
+		fields, build := p.fields, p.build
+		p.fields = append(slices.Clone(fields), pixi.Field{Name: name, Type: fieldType})
+		p.build = func(run *pipelineRun) sampleFunc {
+			sample := build(run)
+			return func(coord pixi.SampleCoordinate) ([]any, error) {
+				values, err := sample(coord)
+				if err != nil {
+					return nil, err
+				}
+				floats := make([]float64, len(fields))
+				for i, field := range fields {
+					floats[i] = field.Type.ValueToFloat64(values[i])
+				}
+				return append(values, fieldType.Float64ToValue(eval(floats))), nil
+			}
+		}
+		return nil
+	})
+}
+
+// Downsamples every dimension by a whole factor, as Decimate does for whole files. The blocks of samples
+// reduced to each output sample straddle the tiles of the layer produced by the earlier steps, so those
+// tiles are computed whole and kept in the cache of the run, where neighbouring output tiles share them.
+func (p *Pipeline) Resample(factor int, method DecimateMethod) *Pipeline {
+	return p.step("resample", func() error {
+		if factor < 1 {
+			return pixi.FormatError("resampling factor must be at least 1")
+		}
+		if method != DecimateMean && method != DecimateNearest {
+			return pixi.UnsupportedError("unknown resampling method")
+		}
+		dims := make(pixi.DimensionSet, len(p.dims))
+		for i, dim := range p.dims {
+			dim.Size = (dim.Size + factor - 1) / factor
+			dim.TileSize = min(dim.TileSize, dim.Size)
+			dim.Resolution *= float64(factor)
+			dims[i] = dim
+		}
+		srcDims, fields, build := p.dims, p.fields, p.build
+		p.tileBytes = max(p.tileBytes, srcDims.TileSamples()*fieldsSize(fields))
+		p.dims = dims
+		p.build = func(run *pipelineRun) sampleFunc {
+			src := run.tiled(srcDims, fields, build(run))
+			decimator := &decimator{src: src, dims: srcDims, fields: fields, factor: factor}
+			if method == DecimateNearest {
+				return decimator.nearest
+			}
+			return decimator.mean
+		}
+		return nil
+	})
+}
+
+// Adapts a function computing samples to the interface of the sources read by steps such as Resample.
+type sampleFunc func(coord pixi.SampleCoordinate) ([]any, error)
+
+func (f sampleFunc) SampleAt(coord pixi.SampleCoordinate) ([]any, error) {
+	return f(coord)
+}
@@ -0,0 +1,320 @@
+package edit
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/internal/buffer"
+	"github.com/owlpinetech/pixi/read"
+)
+
+func TestPipelineWrite(t *testing.T) {
+	buf := writeIndexedLayer(t, pixi.CompressionFlate)
+	rdr := buffer.NewBufferFrom(buf.Bytes())
+	src, err := pixi.ReadPixi(rdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pipeline := NewPipeline(NewLayerView(rdr, src.Header, src.Layers[0])).
+		Crop(pixi.SampleCoordinate{2, 2}, pixi.SampleCoordinate{8, 8}).
+		BandMath("double", pixi.FieldFloat64, "index + half * 2").
+		Select("double").
+		Cast("double", pixi.FieldUint16).
+		Resample(2, DecimateMean)
+	if err := pipeline.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	out := buffer.NewBuffer(20)
+	err = pipeline.Write(context.Background(), out, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outRdr := buffer.NewBufferFrom(out.Bytes())
+	written, err := pixi.ReadPixi(outRdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layer := written.Layers[0]
+	if layer.Dimensions[0].Size != 3 || layer.Dimensions[1].Size != 3 || len(layer.Fields) != 1 || layer.Fields[0].Type != pixi.FieldUint16 {
+		t.Fatalf("unexpected output layer %v %v", layer.Dimensions, layer.Fields)
+	}
+	cache := read.NewLayerReadCache(outRdr, written.Header, layer, read.NewLfuCacheManager(4))
+	for coord := range (Region{Start: pixi.SampleCoordinate{0, 0}, End: pixi.SampleCoordinate{3, 3}}).Coordinates() {
+		sample, err := cache.SampleAt(coord)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// each output sample is the mean of twice the index of a 2 by 2 block of the cropped layer
+		meanX, meanY := 2.5+2*float64(coord[0]), 2.5+2*float64(coord[1])
+		if want := uint16(math.Round(2 * (meanX + 10*meanY))); sample[0] != want {
+			t.Errorf("expected %d at %v, got %v", want, coord, sample[0])
+		}
+	}
+}
+
+// Counts the seeks to each position of a stream, as made before reading each tile.
+type seekCountingReader struct {
+	io.ReadSeeker
+	seeks map[int64]int
+}
+
+func (r *seekCountingReader) Seek(offset int64, whence int) (int64, error) {
+	if whence == io.SeekStart {
+		r.seeks[offset]++
+	}
+	return r.ReadSeeker.Seek(offset, whence)
+}
+
+func TestPipelineParallelTiles(t *testing.T) {
+	header := pixi.PixiHeader{Version: pixi.Version, OffsetSize: 4, ByteOrder: binary.LittleEndian}
+	buf := buffer.NewBuffer(20)
+	err := WriteContiguousTileOrderPixi(buf, header, map[string]string{},
+		LayerWriter{
+			Layer: pixi.NewLayer("wide", false, pixi.CompressionFlate,
+				pixi.DimensionSet{{Name: "x", Size: 64, TileSize: 2}, {Name: "y", Size: 6, TileSize: 2}},
+				[]pixi.Field{{Name: "v", Type: pixi.FieldUint32}}),
+			IterFn: func(layer *pixi.Layer, coord pixi.SampleCoordinate) ([]any, map[string]any) {
+				return []any{uint32(coord.ToSampleIndex(layer.Dimensions))}, nil
+			},
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(workers int) ([]byte, *pixi.Layer, map[int64]int) {
+		rdr := &seekCountingReader{ReadSeeker: buffer.NewBufferFrom(buf.Bytes()), seeks: map[int64]int{}}
+		src, err := pixi.ReadPixi(rdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the crop moves the tiles of the intermediate layer off the tiles of the source, and the blocks of
+		// the resampling straddle both, so every source tile is needed by several output tiles
+		pipeline := NewPipeline(NewLayerView(rdr, src.Header, src.Layers[0])).
+			Crop(pixi.SampleCoordinate{1, 1}, pixi.SampleCoordinate{64, 6}).
+			BandMath("twice", pixi.FieldFloat64, "v * 2").
+			Resample(3, DecimateMean).
+			SetOptions(PipelineOptions{Workers: workers, CacheTiles: 256})
+		out := buffer.NewBuffer(20)
+		err = pipeline.Write(context.Background(), out, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out.Bytes(), src.Layers[0], rdr.seeks
+	}
+
+	serial, _, _ := write(1)
+	parallel, srcLayer, seeks := write(8)
+	if !bytes.Equal(serial, parallel) {
+		t.Error("expected the same output from one worker and from several")
+	}
+	for tileIndex, offset := range srcLayer.TileOffsets {
+		if seeks[offset] != 1 {
+			t.Errorf("expected source tile %d to be read once, read %d times", tileIndex, seeks[offset])
+		}
+	}
+
+	outRdr := buffer.NewBufferFrom(parallel)
+	written, err := pixi.ReadPixi(outRdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layer := written.Layers[0]
+	cache := read.NewLayerReadCache(outRdr, written.Header, layer, read.NewLfuCacheManager(4))
+	for coord := range layer.Dimensions.SampleCoordinates() {
+		sample, err := cache.SampleAt(coord)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum, count := 0.0, 0
+		for x := 1 + 3*coord[0]; x < min(64, 4+3*coord[0]); x++ {
+			for y := 1 + 3*coord[1]; y < min(6, 4+3*coord[1]); y++ {
+				sum += float64(2 * (x + 64*y))
+				count++
+			}
+		}
+		if sample[0] != uint32(sum/2/float64(count)+0.5) || sample[1] != sum/float64(count) {
+			t.Fatalf("unexpected sample %v at %v", sample, coord)
+		}
+	}
+}
+
+func TestPipelineValidation(t *testing.T) {
+	buf := writeIndexedLayer(t, pixi.CompressionNone)
+	rdr := buffer.NewBufferFrom(buf.Bytes())
+	src, err := pixi.ReadPixi(rdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	view := NewLayerView(rdr, src.Header, src.Layers[0])
+
+	cases := []struct {
+		name     string
+		pipeline *Pipeline
+		step     string
+	}{
+		{"crop outside", NewPipeline(view).Crop(pixi.SampleCoordinate{0, 0}, pixi.SampleCoordinate{11, 5}), "step 1 (crop)"},
+		{"selected away", NewPipeline(view).Select("half").Cast("index", pixi.FieldInt8), "step 2 (cast)"},
+		{"unknown band", NewPipeline(view).BandMath("sum", pixi.FieldFloat32, "index + nir"), "step 1 (band math)"},
+		{"bad expression", NewPipeline(view).BandMath("sum", pixi.FieldFloat32, "(index + half"), "step 1 (band math)"},
+		{"existing name", NewPipeline(view).BandMath("half", pixi.FieldFloat32, "index / 2"), "step 1 (band math)"},
+		{"zero factor", NewPipeline(view).Resample(0, DecimateMean), "step 1 (resample)"},
+	}
+	for _, c := range cases {
+		err := c.pipeline.Write(context.Background(), buffer.NewBuffer(10), nil)
+		if err == nil || !strings.HasPrefix(err.Error(), c.step) {
+			t.Errorf("%s: expected an error from %s, got %v", c.name, c.step, err)
+		}
+	}
+}
+
+func TestCompileBandMath(t *testing.T) {
+	fields := pixi.FieldSet{{Name: "red", Type: pixi.FieldFloat32}, {Name: "nir", Type: pixi.FieldFloat32}, {Name: "band 3", Type: pixi.FieldUint8}}
+	values := []float64{2, 6, 10}
+	cases := []struct {
+		expression string
+		want       float64
+	}{
+		{"(nir - red) / (nir + red)", 0.5},
+		{"nir - red * 2", 2},
+		{"-red + -(nir)", -8},
+		{"\"band 3\" * 1.5e1", 150},
+		{"  red/nir*3 ", 1},
+	}
+	for _, c := range cases {
+		eval, err := compileBandMath(c.expression, fields)
+		if err != nil {
+			t.Errorf("%q: %v", c.expression, err)
+			continue
+		}
+		if got := eval(values); math.Abs(got-c.want) > 1e-12 {
+			t.Errorf("%q: expected %v, got %v", c.expression, c.want, got)
+		}
+	}
+	for _, bad := range []string{"", "red +", "(red", "red nir", "swir", "red % 2", "\"band 3"} {
+		if _, err := compileBandMath(bad, fields); err == nil || !errors.As(err, new(pixi.FormatError)) {
+			t.Errorf("%q: expected a format error, got %v", bad, err)
+		}
+	}
+}
+
+func TestPipelineSpec(t *testing.T) {
+	buf := writeIndexedLayer(t, pixi.CompressionNone)
+	rdr := buffer.NewBufferFrom(buf.Bytes())
+	src, err := pixi.ReadPixi(rdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spec, err := ReadPipelineSpec(strings.NewReader(`{
+		"input": "in.pixi", "layer": "indexed", "output": "out.pixi",
+		"steps": [
+			{"crop": {"start": [0, 0], "end": [4, 6]}},
+			{"bandMath": {"name": "quarter", "type": "float32", "expression": "half / 2"}},
+			{"select": ["quarter", "index"]},
+			{"resample": {"factor": 2, "method": "nearest"}}
+		]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	layer, err := spec.SourceLayer(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pipeline := spec.Build(NewLayerView(rdr, src.Header, layer))
+	if err := pipeline.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if dims, fields := pipeline.Dimensions(), pipeline.Fields(); dims[0].Size != 2 || dims[1].Size != 3 || fields[0].Name != "quarter" || fields[1].Type != pixi.FieldUint32 {
+		t.Errorf("unexpected pipeline output %v %v", dims, fields)
+	}
+
+	if _, err := ReadPipelineSpec(strings.NewReader(`{"steps": [{"crpo": {}}]}`)); err == nil {
+		t.Error("expected an error for an unknown step")
+	}
+	invalid := []string{
+		`{"steps": [{"select": ["index"], "resample": {"factor": 2}}]}`,
+		`{"steps": [{"cast": {"field": "index", "type": "complex64"}}]}`,
+		`{"steps": [{"resample": {"factor": 2, "method": "cubic"}}]}`,
+	}
+	for _, text := range invalid {
+		spec, err := ReadPipelineSpec(strings.NewReader(text))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if spec.Build(NewLayerView(rdr, src.Header, layer)).Err() == nil {
+			t.Errorf("expected %s to be rejected", text)
+		}
+	}
+}
+
+func TestPipelineStitchRetileCompress(t *testing.T) {
+	views := make([]*LayerView, 2)
+	for i := range views {
+		rdr := buffer.NewBufferFrom(writeIndexedLayer(t, pixi.CompressionNone).Bytes())
+		src, err := pixi.ReadPixi(rdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		views[i] = NewLayerView(rdr, src.Header, src.Layers[0])
+	}
+
+	spec, err := ReadPipelineSpec(strings.NewReader(`{
+		"inputs": [{"input": "west.pixi", "offset": [0, 0]}, {"input": "east.pixi", "offset": [10, 2]}],
+		"compression": "lzw_lsb",
+		"steps": [
+			{"retile": {"tileSize": 4, "allowSlowTiling": true}},
+			{"compress": "flate"},
+			{"interleave": "separated"}
+		]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.Build(views[0]).Err() == nil {
+		t.Error("expected a stitching spec built on a single view to be rejected")
+	}
+	pipeline := spec.Build(views...).SetOptions(PipelineOptions{Workers: 3})
+	out := buffer.NewBuffer(20)
+	err = pipeline.Write(context.Background(), out, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outRdr := buffer.NewBufferFrom(out.Bytes())
+	written, err := pixi.ReadPixi(outRdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layer := written.Layers[0]
+	if !layer.Separated || layer.Compression != pixi.CompressionFlate {
+		t.Errorf("expected a separated, flate compressed layer, got separated %v and %v", layer.Separated, layer.Compression)
+	}
+	if dims := layer.Dimensions; dims[0].Size != 20 || dims[1].Size != 12 || dims[0].TileSize != 4 || dims[1].TileSize != 4 {
+		t.Fatalf("unexpected stitched dimensions %v", dims)
+	}
+	cache := read.NewLayerReadCache(outRdr, written.Header, layer, read.NewLfuCacheManager(8))
+	for coord := range layer.Dimensions.SampleCoordinates() {
+		sample, err := cache.SampleAt(coord)
+		if err != nil {
+			t.Fatal(err)
+		}
+		x, y := coord[0], coord[1]
+		want := []any{uint32(0), float32(0)}
+		if x >= 10 && y >= 2 {
+			want = []any{uint32(x - 10 + 10*(y-2)), float32(x-10+10*(y-2)) / 2}
+		} else if x < 10 && y < 10 {
+			want = []any{uint32(x + 10*y), float32(x+10*y) / 2}
+		}
+		if sample[0] != want[0] || sample[1] != want[1] {
+			t.Fatalf("expected %v at %v, got %v", want, coord, sample)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package edit
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"iter"
+	"sync"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/internal/preload"
+	"github.com/owlpinetech/pixi/read"
+)
+
+// Options for running a Pipeline.
+type PipelineOptions struct {
+	Workers    int                // The number of output tiles computed and encoded in parallel, see pixi.Workers.
+	CacheTiles int                // The number of source and intermediate tiles held in memory at once, or 0 for a default.
+	Budget     *pixi.MemoryBudget // Bounds the tiles held in memory by bytes instead of CacheTiles, if not nil.
+}
+
+// Runs the pipeline, writing its output to dst as a Pixi file with the header of the source file (but
+// no file tags), and a single untagged layer. Each tile of the output is a task run on one of the
+// workers, a few tiles ahead of the tile being written. The tiles of the source and of intermediate steps
+// that tasks read are held in a single cache shared by all workers and bounded as set in the options, and
+// a tile needed by several tasks at once is only read, decoded or computed by one of them. Every tile is
+// computed once, whatever the layout of the output: the fields of a tile of a separated layer are written
+// one after another. Cancelling the context stops the write between tiles, leaving dst incomplete.
+func (p *Pipeline) Write(ctx context.Context, dst io.WriteSeeker, progress ProgressFunc) error {
+	if p.err != nil {
+		return p.err
+	}
+	run := newPipelineRun(p.header, p.options, p.tileBytes)
+	defer run.release()
+	sample := p.build(run)
+
+	workers := pixi.Workers(p.options.Workers)
+	next, stop := computeAhead(ctx, workers, nil, 0, p.dims.Tiles(), func(tileIndex int) ([]byte, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return computeTile(p.dims, p.fields, p.header.ByteOrder, tileIndex, sample)
+	})
+	defer stop()
+
+	layer := pixi.NewLayer(p.name, p.separated, p.compression, p.dims, p.fields)
+	derived := derivedLayer{layer: layer, workers: workers}
+	if !p.separated {
+		derived.tile = func(tileIndex int, data []byte) error {
+			tile, err := next()
+			if err != nil {
+				return err
+			}
+			copy(data, tile)
+			return nil
+		}
+	} else {
+		tiles, sampleSize := p.dims.Tiles(), fieldsSize(p.fields)
+		derived.order = func(yield func(int) bool) {
+			for tileIndex := range tiles {
+				for fieldIndex := range p.fields {
+					if !yield(fieldIndex*tiles + tileIndex) {
+						return
+					}
+				}
+			}
+		}
+		var tile []byte
+		derived.tile = func(diskTile int, data []byte) error {
+			fieldIndex := diskTile / tiles
+			if fieldIndex == 0 {
+				var err error
+				if tile, err = next(); err != nil {
+					return err
+				}
+			}
+			fieldOffset, fieldSize := fieldsSize(p.fields[:fieldIndex]), p.fields[fieldIndex].Size()
+			for inTile := range p.dims.TileSamples() {
+				copy(data[inTile*fieldSize:(inTile+1)*fieldSize], tile[inTile*sampleSize+fieldOffset:])
+			}
+			return nil
+		}
+	}
+	return writeDerivedPixi(ctx, dst, p.header, &pixi.TagSection{}, []derivedLayer{derived}, progress)
+}
+
+// The state of a single run of a pipeline: the cache pool shared by the tiles of its source and its
+// intermediate steps, and the managers drawn from it, released when the run ends.
+type pipelineRun struct {
+	header   pixi.PixiHeader
+	pool     *read.CachePool
+	lock     sync.Mutex
+	managers []read.CacheManager[int, []byte]
+}
+
+func newPipelineRun(header pixi.PixiHeader, options PipelineOptions, tileBytes int) *pipelineRun {
+	var pool *read.CachePool
+	if options.Budget == nil {
+		pool = read.NewCachePool(int64(cacheTilesOrDefault(options.CacheTiles)) * int64(tileBytes))
+	} else {
+		pool = read.NewCachePool(options.Budget.Limit())
+		pool.SetMemoryBudget(options.Budget)
+	}
+	return &pipelineRun{header: header, pool: pool}
+}
+
+func (r *pipelineRun) manager() read.CacheManager[int, []byte] {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	manager := r.pool.Manager()
+	r.managers = append(r.managers, manager)
+	return manager
+}
+
+// Returns every tile held by the run to its pool, and so to the memory budget.
+func (r *pipelineRun) release() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, manager := range r.managers {
+		r.pool.Release(manager)
+	}
+}
+
+// Makes the samples of a step available a whole tile at a time through the cache of the run.
+func (r *pipelineRun) tiled(dims pixi.DimensionSet, fields pixi.FieldSet, sample sampleFunc) *tiledStep {
+	return r.tiledBy(dims, fields, func(tileIndex int) ([]byte, error) {
+		return computeTile(dims, fields, r.header.ByteOrder, tileIndex, sample)
+	})
+}
+
+// Makes the output of a step that computes whole tiles at once available through the cache of the run.
+func (r *pipelineRun) tiledBy(dims pixi.DimensionSet, fields pixi.FieldSet, compute func(tileIndex int) ([]byte, error)) *tiledStep {
+	return &tiledStep{
+		dims:    dims,
+		fields:  fields,
+		order:   r.header.ByteOrder,
+		compute: compute,
+		cache:   &sync.Map{},
+		manager: r.manager(),
+	}
+}
+
+// The output of a step of a pipeline, computed a whole tile at a time when any of its samples is read
+// and kept in the cache of the run. Safe for use from several goroutines at once; a tile requested again
+// while it is being computed is waited for rather than computed twice.
+type tiledStep struct {
+	dims     pixi.DimensionSet
+	fields   pixi.FieldSet
+	order    binary.ByteOrder
+	compute  func(tileIndex int) ([]byte, error)
+	cache    *sync.Map // map[int][]byte, managed by manager
+	manager  read.CacheManager[int, []byte]
+	inflight sync.Map // map[int]*tileTask, the tiles being computed
+}
+
+type tileTask struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+func (s *tiledStep) SampleAt(coord pixi.SampleCoordinate) ([]any, error) {
+	selector := coord.ToTileSelector(s.dims)
+	data, err := s.tile(selector.Tile)
+	if err != nil {
+		return nil, err
+	}
+	offset := selector.InTile * fieldsSize(s.fields)
+	sample := make([]any, len(s.fields))
+	for i, field := range s.fields {
+		sample[i] = field.BytesToValue(data[offset:], s.order)
+		offset += field.Size()
+	}
+	return sample, nil
+}
+
+func (s *tiledStep) tile(tileIndex int) ([]byte, error) {
+	s.manager.Access(tileIndex)
+	if data, ok := s.cache.Load(tileIndex); ok {
+		return data.([]byte), nil
+	}
+	task := &tileTask{done: make(chan struct{})}
+	if running, computing := s.inflight.LoadOrStore(tileIndex, task); computing {
+		task = running.(*tileTask)
+		<-task.done
+		return task.data, task.err
+	}
+	task.data, task.err = s.compute(tileIndex)
+	if task.err == nil {
+		s.manager.Add(tileIndex, task.data, s.cache)
+	}
+	s.inflight.Delete(tileIndex)
+	close(task.done)
+	return task.data, task.err
+}
+
+// Computes the decoded contents of a tile of a contiguous layer with the given dimensions and fields,
+// taking each sample from sample. Samples past the edges of the layer are left zero.
+func computeTile(dims pixi.DimensionSet, fields pixi.FieldSet, order binary.ByteOrder, tileIndex int, sample sampleFunc) ([]byte, error) {
+	sampleSize := fieldsSize(fields)
+	data := make([]byte, dims.TileSamples()*sampleSize)
+	start, end := dims.TileBounds(tileIndex)
+	for coord := range (Region{Start: start, End: end}).Coordinates() {
+		values, err := sample(coord)
+		if err != nil {
+			return nil, err
+		}
+		offset := coord.ToTileSelector(dims).InTile * sampleSize
+		for i, field := range fields {
+			field.ValueToBytes(values[i], data[offset:], order)
+			offset += field.Size()
+		}
+	}
+	return data, nil
+}
+
+// Runs compute for every tile index in order on up to workers goroutines, at most workers tiles ahead of
+// the tile last taken, so that only that many computed tiles are held at once. Calling next returns the
+// result for each tile in turn, and stop abandons the tiles not yet started, waiting for those running.
+// With a budget, tileSize bytes are acquired from it for each tile before it is computed, and released
+// once the next tile is taken or stop is called, and no further tiles are computed ahead while the budget
+// is exhausted.
+func computeAhead(ctx context.Context, workers int, budget *pixi.MemoryBudget, tileSize int64, tiles int, compute func(tileIndex int) ([]byte, error)) (next func() ([]byte, error), stop func()) {
+	// everything but compute runs on the goroutine calling next, so held needs no lock
+	held, reserved, taken := int64(0), false, false
+	more := func() bool {
+		reserved = budget.TryAcquire(pixi.TileWriterConsumer, tileSize)
+		if reserved {
+			held += tileSize
+		}
+		return reserved
+	}
+	results := preload.OrderedWhile(ctx, workers, func(yield func(int) bool) {
+		for tileIndex := range tiles {
+			if !reserved {
+				budget.Acquire(pixi.TileWriterConsumer, tileSize)
+				held += tileSize
+			}
+			reserved = false
+			if !yield(tileIndex) {
+				return
+			}
+		}
+	}, more, func(ctx context.Context, tileIndex int) ([]byte, error) {
+		return compute(tileIndex)
+	})
+	pull, stopPull := iter.Pull2(results)
+	next = func() ([]byte, error) {
+		if taken {
+			budget.Release(pixi.TileWriterConsumer, tileSize)
+			held -= tileSize
+		}
+		data, err, ok := pull()
+		taken = ok
+		if !ok {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return data, err
+	}
+	stop = func() {
+		stopPull()
+		if held > 0 {
+			budget.Release(pixi.TileWriterConsumer, held)
+			held = 0
+		}
+	}
+	return next, stop
+}
+
+// The size in bytes of a sample with the given fields.
+func fieldsSize(fields pixi.FieldSet) int {
+	size := 0
+	for _, field := range fields {
+		size += field.Size()
+	}
+	return size
+}
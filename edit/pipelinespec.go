@@ -0,0 +1,238 @@
+package edit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/owlpinetech/pixi"
+)
+
+// A declarative description of a Pipeline, read from JSON so that recurring processing recipes can be
+// kept as files and run with the pixi run command instead of written as programs. For example:
+//
+//	{
+//	  "input": "scene.pixi",
+//	  "layer": "bands",
+//	  "output": "ndvi.pixi",
+//	  "compression": "flate",
+//	  "steps": [
+//	    {"crop": {"start": [0, 0], "end": [1024, 1024]}},
+//	    {"bandMath": {"name": "ndvi", "type": "float32", "expression": "(nir - red) / (nir + red)"}},
+//	    {"select": ["ndvi"]},
+//	    {"resample": {"factor": 2, "method": "mean"}}
+//	  ]
+//	}
+//
+// Instead of a single input, several can be stitched together (see NewStitchPipeline) by listing them
+// with their offsets, as in "inputs": [{"input": "west.pixi", "offset": [0, 0]}, {"input": "east.pixi",
+// "offset": [1024, 0]}], so that stitching, retiling and compressing take a single pass over the data.
+type PipelineSpec struct {
+	Input       string         `json:"input"`       // The name of the file to read.
+	Inputs      []StitchInput  `json:"inputs"`      // The files to stitch together and read instead of Input, if any.
+	Layer       string         `json:"layer"`       // The name of the layer to read from each input, or empty for the first layer.
+	Output      string         `json:"output"`      // The name of the file to write.
+	Compression string         `json:"compression"` // The compression of the output layer by name, or empty to keep that of the input.
+	Steps       []PipelineStep `json:"steps"`
+}
+
+// One of the inputs of a PipelineSpec that stitches several together.
+type StitchInput struct {
+	Input  string `json:"input"`  // The name of the file to read.
+	Offset []int  `json:"offset"` // The coordinate in the stitched layer of the first sample of the input.
+}
+
+// A single step of a PipelineSpec, of which exactly one member must be set.
+type PipelineStep struct {
+	Crop       *CropStep     `json:"crop,omitempty"`
+	Select     []string      `json:"select,omitempty"`
+	Cast       *CastStep     `json:"cast,omitempty"`
+	BandMath   *BandMathStep `json:"bandMath,omitempty"`
+	Resample   *ResampleStep `json:"resample,omitempty"`
+	Operator   *OperatorStep `json:"operator,omitempty"`
+	Retile     *RetileStep   `json:"retile,omitempty"`
+	Compress   string        `json:"compress,omitempty"`   // See Pipeline.Compress, by name as for pixi.ParseCompression.
+	Interleave string        `json:"interleave,omitempty"` // See Pipeline.Interleave: "separated" or "contiguous".
+}
+
+// See Pipeline.Retile.
+type RetileStep struct {
+	TileSize           int            `json:"tileSize"`
+	DimensionTileSizes map[string]int `json:"dimensionTileSizes"`
+	AllowSlowTiling    bool           `json:"allowSlowTiling"`
+}
+
+// See Pipeline.Crop.
+type CropStep struct {
+	Start []int `json:"start"`
+	End   []int `json:"end"`
+}
+
+// See Pipeline.Cast. The type is given by name, as for pixi.ParseFieldType.
+type CastStep struct {
+	Field string `json:"field"`
+	Type  string `json:"type"`
+}
+
+// See Pipeline.BandMath. The type is given by name, as for pixi.ParseFieldType.
+type BandMathStep struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	Expression string `json:"expression"`
+}
+
+// See Pipeline.Resample. The method is "mean" (the default) or "nearest".
+type ResampleStep struct {
+	Factor int    `json:"factor"`
+	Method string `json:"method"`
+}
+
+// See Pipeline.Apply. The operator is one registered under the name with RegisterOperator, created from
+// the parameters, whose form is up to the operator.
+type OperatorStep struct {
+	Name   string          `json:"name"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// Reads a pipeline spec from JSON, rejecting unknown keys so that misspelled steps are not silently
+// ignored.
+func ReadPipelineSpec(r io.Reader) (PipelineSpec, error) {
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	spec := PipelineSpec{}
+	err := decoder.Decode(&spec)
+	if err != nil {
+		return PipelineSpec{}, fmt.Errorf("pipeline spec: %w", err)
+	}
+	return spec, nil
+}
+
+// The names of the files the spec reads, in order.
+func (s PipelineSpec) InputFiles() []string {
+	if len(s.Inputs) == 0 {
+		return []string{s.Input}
+	}
+	files := make([]string, len(s.Inputs))
+	for i, input := range s.Inputs {
+		files[i] = input.Input
+	}
+	return files
+}
+
+// Finds the layer of the source file named by the spec, or its first layer if the spec names none.
+func (s PipelineSpec) SourceLayer(src pixi.Pixi) (*pixi.Layer, error) {
+	if len(src.Layers) == 0 {
+		return nil, pixi.FormatError("the input file has no layers")
+	}
+	if s.Layer == "" {
+		return src.Layers[0], nil
+	}
+	for _, layer := range src.Layers {
+		if layer.Name == s.Layer {
+			return layer, nil
+		}
+	}
+	return nil, pixi.FormatError("the input file has no layer named '" + s.Layer + "'")
+}
+
+// Builds the pipeline described by the spec on top of the given views, one of each of the files named by
+// InputFiles in order. Whether the steps fit together is reported by the Err method of the pipeline.
+func (s PipelineSpec) Build(srcs ...*LayerView) *Pipeline {
+	var p *Pipeline
+	if len(s.Inputs) == 0 {
+		if len(srcs) != 1 {
+			p = &Pipeline{}
+			return p.step("spec", func() error { return pixi.FormatError("a spec with a single input must be built on a single view") })
+		}
+		p = NewPipeline(srcs[0])
+	} else {
+		offsets := make([][]int, len(s.Inputs))
+		for i, input := range s.Inputs {
+			offsets[i] = input.Offset
+		}
+		if len(srcs) != len(offsets) {
+			offsets = nil
+		}
+		p = NewStitchPipeline(srcs, offsets)
+	}
+	if s.Compression != "" {
+		compression, err := pixi.ParseCompression(s.Compression)
+		if err != nil {
+			return p.step("compress", func() error { return err })
+		}
+		p.Compress(compression)
+	}
+
+	for _, step := range s.Steps {
+		set := 0
+		for _, isSet := range []bool{step.Crop != nil, step.Select != nil, step.Cast != nil, step.BandMath != nil, step.Resample != nil,
+			step.Operator != nil, step.Retile != nil, step.Compress != "", step.Interleave != ""} {
+			if isSet {
+				set++
+			}
+		}
+		if set != 1 {
+			p.step("spec", func() error { return pixi.FormatError("a step must have exactly one action") })
+			return p
+		}
+
+		switch {
+		case step.Crop != nil:
+			p.Crop(step.Crop.Start, step.Crop.End)
+		case step.Select != nil:
+			p.Select(step.Select...)
+		case step.Cast != nil:
+			fieldType, err := pixi.ParseFieldType(step.Cast.Type)
+			if err != nil {
+				p.step("cast", func() error { return err })
+				return p
+			}
+			p.Cast(step.Cast.Field, fieldType)
+		case step.BandMath != nil:
+			fieldType, err := pixi.ParseFieldType(step.BandMath.Type)
+			if err != nil {
+				p.step("band math", func() error { return err })
+				return p
+			}
+			p.BandMath(step.BandMath.Name, fieldType, step.BandMath.Expression)
+		case step.Resample != nil:
+			method := DecimateMean
+			switch step.Resample.Method {
+			case "", "mean":
+			case "nearest":
+				method = DecimateNearest
+			default:
+				p.step("resample", func() error { return pixi.UnsupportedError("unknown resampling method '" + step.Resample.Method + "'") })
+				return p
+			}
+			p.Resample(step.Resample.Factor, method)
+		case step.Operator != nil:
+			op, err := NewOperator(step.Operator.Name, step.Operator.Params)
+			if err != nil {
+				p.step("apply", func() error { return err })
+				return p
+			}
+			p.Apply(op)
+		case step.Retile != nil:
+			p.Retile(step.Retile.TileSize, step.Retile.DimensionTileSizes, step.Retile.AllowSlowTiling)
+		case step.Compress != "":
+			compression, err := pixi.ParseCompression(step.Compress)
+			if err != nil {
+				p.step("compress", func() error { return err })
+				return p
+			}
+			p.Compress(compression)
+		case step.Interleave != "":
+			switch step.Interleave {
+			case "separated":
+				p.Interleave(true)
+			case "contiguous":
+				p.Interleave(false)
+			default:
+				p.step("interleave", func() error { return pixi.UnsupportedError("unknown field layout '" + step.Interleave + "'") })
+				return p
+			}
+		}
+	}
+	return p
+}
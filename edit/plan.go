@@ -0,0 +1,88 @@
+package edit
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/owlpinetech/pixi"
+)
+
+// The number of tiles of each layer computed and encoded by a plan, to estimate the size of the layer
+// and the time taken to write it.
+const planCalibrationTiles = 4
+
+// The structure of the file an operation would write, worked out without writing it, so that runs that
+// are larger or slower than expected can be caught before they start. The sizes and times are estimated
+// from a few tiles spread across each layer, computed and encoded as the operation would, so they are
+// only as good as those tiles are typical of the layer.
+type OutputPlan struct {
+	Layers   []LayerPlan
+	Bytes    int64         // The estimated size of the file, not counting tags.
+	Duration time.Duration // The estimated time taken to write the file.
+}
+
+// A layer of the file described by an OutputPlan.
+type LayerPlan struct {
+	Name        string
+	Dimensions  pixi.DimensionSet
+	Fields      pixi.FieldSet
+	Compression pixi.Compression
+	Separated   bool
+	Tiles       int           // The number of tiles of the layer, counting each field of a separated layer.
+	Calibrated  int           // The number of tiles computed to estimate the size and time.
+	Bytes       int64         // The estimated size of the layer header and tiles.
+	Duration    time.Duration // The estimated time taken to compute and encode the tiles.
+}
+
+// Works out the plan of the file writeDerivedPixi would write, computing and encoding a few tiles of each
+// layer to calibrate the estimates.
+func planDerivedPixi(ctx context.Context, header pixi.PixiHeader, layers []derivedLayer) (OutputPlan, error) {
+	plan := OutputPlan{Bytes: int64(header.HeaderSize())}
+	for _, derived := range layers {
+		layer := derived.layer
+		layerPlan := LayerPlan{
+			Name:        layer.Name,
+			Dimensions:  layer.Dimensions,
+			Fields:      layer.Fields,
+			Compression: layer.Compression,
+			Separated:   layer.Separated,
+			Tiles:       layer.DiskTiles(),
+			Calibrated:  min(layer.DiskTiles(), planCalibrationTiles),
+			Bytes:       int64(layer.HeaderSize(header)),
+		}
+
+		encoded := int64(0)
+		start := time.Now()
+		for i := range layerPlan.Calibrated {
+			if err := ctx.Err(); err != nil {
+				return OutputPlan{}, err
+			}
+			tileIndex := i * layerPlan.Tiles / layerPlan.Calibrated
+			data := make([]byte, layer.DiskTileSize(tileIndex))
+			var err error
+			if derived.tile != nil {
+				err = derived.tile(tileIndex, data)
+			} else {
+				err = fillDiskTile(layer, header.ByteOrder, tileIndex, data, derived.sample)
+			}
+			if err != nil {
+				return OutputPlan{}, err
+			}
+			n, err := layer.Compression.WriteChunk(io.Discard, data)
+			if err != nil {
+				return OutputPlan{}, err
+			}
+			encoded += int64(n + header.Checksum.Size())
+		}
+		if layerPlan.Calibrated > 0 {
+			layerPlan.Bytes += encoded * int64(layerPlan.Tiles) / int64(layerPlan.Calibrated)
+			layerPlan.Duration = time.Since(start) * time.Duration(layerPlan.Tiles) / time.Duration(layerPlan.Calibrated)
+		}
+
+		plan.Layers = append(plan.Layers, layerPlan)
+		plan.Bytes += layerPlan.Bytes
+		plan.Duration += layerPlan.Duration
+	}
+	return plan, nil
+}
@@ -0,0 +1,60 @@
+package edit
+
+import (
+	"context"
+	"testing"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/internal/buffer"
+)
+
+func TestPlanRetile(t *testing.T) {
+	src := writeIndexedLayer(t, pixi.CompressionNone)
+	options := RetileOptions{TileSize: 2, AllowSlowTiling: true}
+	plan, err := PlanRetile(context.Background(), buffer.NewBufferFrom(src.Bytes()), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Layers) != 1 {
+		t.Fatalf("expected a single layer, got %d", len(plan.Layers))
+	}
+	layer := plan.Layers[0]
+	if layer.Name != "indexed" || layer.Tiles != 25 || layer.Calibrated != planCalibrationTiles || layer.Dimensions[0].TileSize != 2 {
+		t.Errorf("unexpected layer plan %+v", layer)
+	}
+
+	dst := buffer.NewBuffer(20)
+	err = Retile(context.Background(), dst, buffer.NewBufferFrom(src.Bytes()), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// uncompressed tiles all have the same size, so only the tags are missing from the estimate
+	if written := int64(len(dst.Bytes())); plan.Bytes > written || written-plan.Bytes > 64 {
+		t.Errorf("expected an estimate just under the %d bytes written, got %d", written, plan.Bytes)
+	}
+
+	if _, err := PlanRetile(context.Background(), buffer.NewBufferFrom(src.Bytes()), RetileOptions{TileSize: -1}); err == nil {
+		t.Error("expected invalid options to be rejected")
+	}
+}
+
+func TestPlanDecimate(t *testing.T) {
+	src := writeIndexedLayer(t, pixi.CompressionFlate)
+	plan, err := PlanDecimate(context.Background(), buffer.NewBufferFrom(src.Bytes()), DecimateOptions{Factor: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	layer := plan.Layers[0]
+	if layer.Dimensions[0].Size != 4 || layer.Dimensions[1].Size != 4 || layer.Tiles != 1 || layer.Calibrated != 1 {
+		t.Errorf("unexpected layer plan %+v", layer)
+	}
+	if plan.Bytes <= int64(layer.Bytes) || layer.Bytes <= 0 {
+		t.Errorf("expected the file estimate to include the layer estimate, got %d and %d", plan.Bytes, layer.Bytes)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := PlanDecimate(ctx, buffer.NewBufferFrom(src.Bytes()), DecimateOptions{Factor: 3}); err == nil {
+		t.Error("expected a cancelled plan to fail")
+	}
+}
@@ -0,0 +1,214 @@
+package edit
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/owlpinetech/pixi"
+)
+
+type pendingTile struct {
+	data      [][]byte
+	set       []bool
+	remaining int
+}
+
+// Writes the samples of a layer given in any order, for producers such as parallel tile renderers
+// or network receivers that generate samples only roughly in tile order. Samples are buffered per tile,
+// and each tile is written to the stream as soon as every sample in it (other than the padding of
+// partial edge tiles) has been set. To bound memory use, at most a fixed number of tiles may be
+// incomplete at any one time. Both contiguous and separated layers are supported.
+type ReorderingWriter struct {
+	backing     io.WriteSeeker
+	header      pixi.PixiHeader
+	layer       *pixi.Layer
+	layerOffset int64
+	maxPending  int
+	pending     map[int]*pendingTile
+	written     []bool
+	sync        syncPolicy
+	budget      *pixi.MemoryBudget
+}
+
+// The name under which ReorderingWriters report their usage to a memory budget.
+const ReorderingWriterConsumer = "reordering writer"
+
+// Writes the header of the layer at the current stream position and creates a writer that allows at
+// most maxPending tiles to be incomplete at once. Done must be called once every sample has been set.
+func NewReorderingWriter(w io.WriteSeeker, header pixi.PixiHeader, layer *pixi.Layer, maxPending int) (*ReorderingWriter, error) {
+	layerOffset, err := w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	err = layer.WriteHeader(w, header)
+	if err != nil {
+		return nil, err
+	}
+	return &ReorderingWriter{
+		backing:     w,
+		header:      header,
+		layer:       layer,
+		layerOffset: layerOffset,
+		maxPending:  max(1, maxPending),
+		pending:     make(map[int]*pendingTile),
+		written:     make([]bool, layer.Dimensions.Tiles()),
+	}, nil
+}
+
+// Sets the values of every field of the sample at the given coordinate, writing its tile if this was
+// the last sample of the tile to be set. Setting a sample more than once before its tile is written
+// replaces the earlier values. Returns an error if the sample's tile has already been written, or if
+// the sample would start a new tile while the maximum number of tiles are already incomplete, or when
+// the memory budget (if any) cannot hold another tile.
+func (r *ReorderingWriter) SetSampleAt(coord pixi.SampleCoordinate, sample []any) error {
+	if len(coord) != len(r.layer.Dimensions) {
+		return pixi.FormatError("sample coordinate does not match the number of layer dimensions")
+	}
+	for i, c := range coord {
+		if c < 0 || c >= r.layer.Dimensions[i].Size {
+			return pixi.FormatError("sample coordinate is outside the layer")
+		}
+	}
+	selector := coord.ToTileSelector(r.layer.Dimensions)
+	if r.written[selector.Tile] {
+		return pixi.UnsupportedError(fmt.Sprintf("sample %v is in tile %d, which has already been written", coord, selector.Tile))
+	}
+
+	tile, ok := r.pending[selector.Tile]
+	if !ok {
+		if len(r.pending) >= r.maxPending {
+			return pixi.UnsupportedError(fmt.Sprintf("sample %v would exceed the limit of %d incomplete tiles", coord, r.maxPending))
+		}
+		size := int64(r.pendingTileBytes(selector.Tile))
+		if !r.budget.TryAcquire(ReorderingWriterConsumer, size) {
+			return pixi.UnsupportedError(fmt.Sprintf("sample %v would exceed the memory budget with %d incomplete tiles", coord, len(r.pending)))
+		}
+		tile = r.newPendingTile(selector.Tile)
+		r.pending[selector.Tile] = tile
+	}
+
+	if r.layer.Separated {
+		for fieldIndex, field := range r.layer.Fields {
+			field.ValueToBytes(sample[fieldIndex], tile.data[fieldIndex][selector.InTile*field.Size():], r.header.ByteOrder)
+		}
+	} else {
+		offset := selector.InTile * r.layer.SampleSize()
+		for fieldIndex, field := range r.layer.Fields {
+			field.ValueToBytes(sample[fieldIndex], tile.data[0][offset:], r.header.ByteOrder)
+			offset += field.Size()
+		}
+	}
+	if !tile.set[selector.InTile] {
+		tile.set[selector.InTile] = true
+		tile.remaining -= 1
+	}
+
+	if tile.remaining == 0 {
+		return r.writeTile(selector.Tile, tile)
+	}
+	return nil
+}
+
+// Checks that every tile of the layer has been completed and written, then rewrites the layer header
+// with the final tile offsets. Returns an error naming the first incomplete tile if there are gaps.
+func (r *ReorderingWriter) Done() error {
+	for tileIndex, written := range r.written {
+		if written {
+			continue
+		}
+		missing := r.layer.Dimensions.TileSamples()
+		if tile, ok := r.pending[tileIndex]; ok {
+			missing = tile.remaining
+		}
+		return pixi.FormatError(fmt.Sprintf("tile %d of layer '%s' is incomplete, %d samples were never set", tileIndex, r.layer.Name, missing))
+	}
+	err := r.layer.OverwriteHeader(r.backing, r.header, r.layerOffset)
+	if err != nil {
+		return err
+	}
+	return r.sync.finished()
+}
+
+// Sets the options controlling when the backing stream is synced to stable storage. Returns an
+// error if syncing is requested but the backing stream does not implement Syncer.
+func (r *ReorderingWriter) SetDurability(durability Durability) error {
+	policy, err := newSyncPolicy(r.backing, durability)
+	if err != nil {
+		return err
+	}
+	r.sync = policy
+	return nil
+}
+
+// Makes the writer also stay within the given memory budget, shared with other consumers, by refusing
+// to start a new incomplete tile when the budget cannot hold it. Tiles already pending are moved from
+// any previous budget to the new one.
+func (r *ReorderingWriter) SetMemoryBudget(budget *pixi.MemoryBudget) {
+	held := int64(0)
+	for tileIndex := range r.pending {
+		held += int64(r.pendingTileBytes(tileIndex))
+	}
+	r.budget.Release(ReorderingWriterConsumer, held)
+	r.budget = budget
+	r.budget.Acquire(ReorderingWriterConsumer, held)
+}
+
+// The number of bytes of tile data buffered for an incomplete tile.
+func (r *ReorderingWriter) pendingTileBytes(tileIndex int) int {
+	size := 0
+	if r.layer.Separated {
+		for i := range r.layer.Fields {
+			size += r.layer.DiskTileSize(tileIndex + r.layer.Dimensions.Tiles()*i)
+		}
+		return size
+	}
+	return r.layer.DiskTileSize(tileIndex)
+}
+
+func (r *ReorderingWriter) newPendingTile(tileIndex int) *pendingTile {
+	diskTilesPerTile := 1
+	if r.layer.Separated {
+		diskTilesPerTile = len(r.layer.Fields)
+	}
+	tile := &pendingTile{
+		data: make([][]byte, diskTilesPerTile),
+		set:  make([]bool, r.layer.Dimensions.TileSamples()),
+	}
+	for i := range tile.data {
+		tile.data[i] = make([]byte, r.layer.DiskTileSize(tileIndex+r.layer.Dimensions.Tiles()*i))
+	}
+
+	// padding samples beyond the edge of the layer can never be set, so they are not waited for
+	origin := pixi.TileSelector{Tile: tileIndex, InTile: 0}.ToTileCoordinate(r.layer.Dimensions).ToSampleCoordinate(r.layer.Dimensions)
+	tile.remaining = 1
+	for i, dim := range r.layer.Dimensions {
+		tile.remaining *= min(dim.TileSize, dim.Size-origin[i])
+	}
+	for inTile := range tile.set {
+		coord := pixi.TileSelector{Tile: tileIndex, InTile: inTile}.ToTileCoordinate(r.layer.Dimensions).ToSampleCoordinate(r.layer.Dimensions)
+		for i, c := range coord {
+			if c >= r.layer.Dimensions[i].Size {
+				tile.set[inTile] = true
+				break
+			}
+		}
+	}
+	return tile
+}
+
+func (r *ReorderingWriter) writeTile(tileIndex int, tile *pendingTile) error {
+	_, err := r.backing.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	for i, data := range tile.data {
+		err = r.layer.WriteTile(r.backing, r.header, tileIndex+r.layer.Dimensions.Tiles()*i, data)
+		if err != nil {
+			return err
+		}
+	}
+	delete(r.pending, tileIndex)
+	r.budget.Release(ReorderingWriterConsumer, int64(r.pendingTileBytes(tileIndex)))
+	r.written[tileIndex] = true
+	return r.sync.tilesWritten(1)
+}
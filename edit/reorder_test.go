@@ -0,0 +1,104 @@
+package edit
+
+import (
+	"encoding/binary"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/internal/buffer"
+	"github.com/owlpinetech/pixi/read"
+)
+
+func TestReorderingWriterShuffledWithinWindow(t *testing.T) {
+	for _, separated := range []bool{false, true} {
+		header := pixi.PixiHeader{Version: pixi.Version, OffsetSize: 4, ByteOrder: binary.BigEndian}
+		layer := pixi.NewLayer("shuffled", separated, pixi.CompressionFlate,
+			pixi.DimensionSet{{Name: "x", Size: 10, TileSize: 4}, {Name: "y", Size: 7, TileSize: 3}},
+			[]pixi.Field{{Name: "index", Type: pixi.FieldUint32}, {Name: "neg", Type: pixi.FieldInt16}})
+		buf := buffer.NewBuffer(10)
+		writer, err := NewReorderingWriter(buf, header, layer, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// shuffle samples within groups of two tiles, so at most three tiles are ever incomplete
+		groups := make([][]pixi.SampleCoordinate, (layer.Dimensions.Tiles()+1)/2)
+		for coord := range layer.Dimensions.SampleCoordinates() {
+			group := coord.ToTileSelector(layer.Dimensions).Tile / 2
+			groups[group] = append(groups[group], append(pixi.SampleCoordinate{}, coord...))
+		}
+		coords := make([]pixi.SampleCoordinate, 0, layer.Dimensions.Samples())
+		for _, group := range groups {
+			rand.Shuffle(len(group), func(i, j int) { group[i], group[j] = group[j], group[i] })
+			coords = append(coords, group...)
+		}
+
+		for _, coord := range coords {
+			ind := coord.ToSampleIndex(layer.Dimensions)
+			err = writer.SetSampleAt(coord, []any{uint32(ind), int16(-ind)})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		err = writer.Done()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rdr := buffer.NewBufferFrom(buf.Bytes())
+		readLayer := &pixi.Layer{}
+		err = readLayer.ReadLayer(rdr, header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		count := 0
+		for coord, sample := range read.Samples(rdr, header, readLayer) {
+			ind := coord.ToSampleIndex(layer.Dimensions)
+			if sample[0] != uint32(ind) || sample[1] != int16(-ind) {
+				t.Fatalf("expected (%d, %d) at %v, got %v", ind, -ind, coord, sample)
+			}
+			count += 1
+		}
+		if count != layer.Dimensions.Samples() {
+			t.Errorf("expected %d samples, read %d", layer.Dimensions.Samples(), count)
+		}
+	}
+}
+
+func TestReorderingWriterErrors(t *testing.T) {
+	header := pixi.PixiHeader{Version: pixi.Version, OffsetSize: 4, ByteOrder: binary.LittleEndian}
+	layer := pixi.NewLayer("gaps", false, pixi.CompressionNone,
+		pixi.DimensionSet{{Name: "x", Size: 4, TileSize: 2}, {Name: "y", Size: 2, TileSize: 2}},
+		[]pixi.Field{{Name: "v", Type: pixi.FieldUint8}})
+	writer, err := NewReorderingWriter(buffer.NewBuffer(10), header, layer, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = writer.SetSampleAt(pixi.SampleCoordinate{0, 0}, []any{uint8(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.SetSampleAt(pixi.SampleCoordinate{2, 0}, []any{uint8(1)})
+	if err == nil {
+		t.Error("expected starting a second incomplete tile to exceed the window")
+	}
+	for _, coord := range []pixi.SampleCoordinate{{1, 0}, {0, 1}, {1, 1}} {
+		err = writer.SetSampleAt(coord, []any{uint8(1)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = writer.SetSampleAt(pixi.SampleCoordinate{0, 0}, []any{uint8(2)})
+	if err == nil {
+		t.Error("expected setting a sample in a written tile to fail")
+	}
+	err = writer.SetSampleAt(pixi.SampleCoordinate{3, 1}, []any{uint8(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if writer.Done() == nil {
+		t.Error("expected gaps in the second tile to be reported")
+	}
+}
@@ -0,0 +1,386 @@
+package edit
+
+import (
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/owlpinetech/pixi"
+)
+
+// The problems found in a Pixi file by CheckFile or Repair, and what was done about them.
+type RepairReport struct {
+	Layers          int      // The number of layers that could be read.
+	Tags            int      // The number of tag sections that could be read.
+	RelocatedTiles  int      // Tiles whose offsets were wrong but whose data was found by scanning for its checksum.
+	LostTiles       int      // Tiles whose data could not be found, which are replaced with zeros in a repaired copy.
+	TrailingBytes   int64    // Bytes at the end of the file not referenced by any header, layer, tile, or tag section.
+	Problems        []string // A description of each problem found.
+	layers          []*pixi.Layer
+	lostTileIndices [][]int
+	layerTags       []*pixi.TagSection // the readable tags of each layer combined into one section, nil if none
+}
+
+// Reports whether no problems were found.
+func (r RepairReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+func (r *RepairReport) problem(format string, args ...any) {
+	r.Problems = append(r.Problems, fmt.Sprintf(format, args...))
+}
+
+// Checks the structure of the Pixi file in src without modifying it: the layer and tag section chains
+// are followed until they leave the file or loop, and every tile is checked against its checksum. Tiles
+// that fail the check are searched for by scanning the file for data matching their checksum.
+func CheckFile(src io.ReadSeeker) (RepairReport, error) {
+	report := RepairReport{}
+	size, err := src.Seek(0, io.SeekEnd)
+	if err != nil {
+		return report, err
+	}
+	_, err = src.Seek(0, io.SeekStart)
+	if err != nil {
+		return report, err
+	}
+	header := pixi.PixiHeader{}
+	err = header.ReadHeader(src)
+	if err != nil {
+		// without a header, nothing else in the file can be interpreted
+		return report, err
+	}
+	end := int64(header.HeaderSize())
+
+	seen := []int64{}
+	layerOffset := header.FirstLayerOffset
+	for layerOffset != 0 {
+		if layerOffset < int64(header.HeaderSize()) || layerOffset >= size || slices.Contains(seen, layerOffset) {
+			report.problem("layer chain broken after %d layers: invalid or repeated offset %d", len(report.layers), layerOffset)
+			break
+		}
+		seen = append(seen, layerOffset)
+		layer := &pixi.Layer{}
+		err = recoverFormat(func() error {
+			_, err := src.Seek(layerOffset, io.SeekStart)
+			if err != nil {
+				return err
+			}
+			return layer.ReadLayer(src, header)
+		})
+		if err != nil {
+			report.problem("layer chain broken after %d layers: %v", len(report.layers), err)
+			break
+		}
+		end = max(end, layerOffset+int64(layer.HeaderSize(header)))
+		lost, tilesEnd := locateTiles(src, header, layer, layerOffset+int64(layer.HeaderSize(header)), size, &report)
+		end = max(end, tilesEnd)
+		tags, tagsEnd := locateLayerTags(src, header, layer, size, &report)
+		end = max(end, tagsEnd)
+		report.layers = append(report.layers, layer)
+		report.lostTileIndices = append(report.lostTileIndices, lost)
+		report.layerTags = append(report.layerTags, tags)
+		layerOffset = layer.NextLayerStart
+	}
+	report.Layers = len(report.layers)
+
+	tagsOffset := header.FirstTagsOffset
+	for tagsOffset != 0 {
+		if tagsOffset < int64(header.HeaderSize()) || tagsOffset >= size || slices.Contains(seen, tagsOffset) {
+			report.problem("tag chain broken after %d sections: invalid or repeated offset %d", report.Tags, tagsOffset)
+			break
+		}
+		seen = append(seen, tagsOffset)
+		section := &pixi.TagSection{}
+		err = recoverFormat(func() error {
+			_, err := src.Seek(tagsOffset, io.SeekStart)
+			if err != nil {
+				return err
+			}
+			return section.Read(src, header)
+		})
+		if err != nil {
+			report.problem("tag chain broken after %d sections: %v", report.Tags, err)
+			break
+		}
+		sectionEnd, err := src.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return report, err
+		}
+		end = max(end, sectionEnd)
+		report.Tags += 1
+		tagsOffset = section.NextTagsStart
+	}
+
+	if end < size {
+		report.TrailingBytes = size - end
+		report.problem("%d bytes of trailing data after the end of the last section", report.TrailingBytes)
+	}
+	return report, nil
+}
+
+// Checks the Pixi file in src as with CheckFile, then writes a repaired copy to dst. The copy contains
+// every layer and tag section that could be read, with tile offsets rebuilt for tiles found by scanning,
+// lost tiles replaced with zeros, the layer and tag chains terminated at the last readable section, and
+// no trailing data. All tag sections are combined into one. The source file is never modified.
+func Repair(dst io.WriteSeeker, src io.ReadSeeker) (RepairReport, error) {
+	report, err := CheckFile(src)
+	if err != nil {
+		return report, err
+	}
+
+	_, err = src.Seek(0, io.SeekStart)
+	if err != nil {
+		return report, err
+	}
+	header := pixi.PixiHeader{}
+	err = header.ReadHeader(src)
+	if err != nil {
+		return report, err
+	}
+	tagSection := pixi.TagSection{}
+	tagsOffset := header.FirstTagsOffset
+	for range report.Tags {
+		_, err = src.Seek(tagsOffset, io.SeekStart)
+		if err != nil {
+			return report, err
+		}
+		section := &pixi.TagSection{}
+		err = section.Read(src, header)
+		if err != nil {
+			return report, err
+		}
+		tagSection.Merge(section)
+		tagsOffset = section.NextTagsStart
+	}
+
+	dstLayers := make([]*pixi.Layer, len(report.layers))
+	for layerInd, srcLayer := range report.layers {
+		dstLayers[layerInd] = pixi.NewLayer(srcLayer.Name, srcLayer.Separated, srcLayer.Compression, srcLayer.Dimensions, srcLayer.Fields)
+		dstLayers[layerInd].TileAlignment = srcLayer.TileAlignment
+		if report.layerTags[layerInd] != nil {
+			dstLayers[layerInd].Tags = []*pixi.TagSection{report.layerTags[layerInd]}
+		}
+	}
+	header.SetFeatures(dstLayers, []*pixi.TagSection{&tagSection})
+	err = header.WriteHeader(dst)
+	if err != nil {
+		return report, err
+	}
+	dstTagsOffset, err := dst.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return report, err
+	}
+	err = tagSection.Write(dst, header)
+	if err != nil {
+		return report, err
+	}
+	firstLayerOffset, err := dst.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return report, err
+	}
+	if len(report.layers) == 0 {
+		firstLayerOffset = 0
+	}
+	err = header.OverwriteOffsets(dst, firstLayerOffset, dstTagsOffset)
+	if err != nil {
+		return report, err
+	}
+
+	layerOffset := firstLayerOffset
+	for layerInd, srcLayer := range report.layers {
+		dstLayer := dstLayers[layerInd]
+		err = dstLayer.WriteHeader(dst, header)
+		if err != nil {
+			return report, err
+		}
+		for tileInd := range srcLayer.DiskTiles() {
+			tileData := make([]byte, srcLayer.DiskTileSize(tileInd))
+			if !slices.Contains(report.lostTileIndices[layerInd], tileInd) {
+				err = srcLayer.ReadTile(src, header, tileInd, tileData)
+				if err != nil {
+					return report, err
+				}
+			}
+			err = dstLayer.WriteTile(dst, header, tileInd, tileData)
+			if err != nil {
+				return report, err
+			}
+		}
+		err = dstLayer.WriteTags(dst, header)
+		if err != nil {
+			return report, err
+		}
+		nextLayerOffset, err := dst.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return report, err
+		}
+		if layerInd < len(report.layers)-1 {
+			dstLayer.NextLayerStart = nextLayerOffset
+		}
+		err = dstLayer.OverwriteHeader(dst, header, layerOffset)
+		if err != nil {
+			return report, err
+		}
+		layerOffset = nextLayerOffset
+	}
+	return report, nil
+}
+
+// Follows the tag chain of the layer until it leaves the file or fails to read. Returns the tags of
+// every readable section combined into one section (nil if the layer has none), and the end of the last
+// readable section.
+func locateLayerTags(src io.ReadSeeker, header pixi.PixiHeader, layer *pixi.Layer, size int64, report *RepairReport) (*pixi.TagSection, int64) {
+	if layer.TagsStart == 0 {
+		return nil, 0
+	}
+	var tags *pixi.TagSection
+	end := int64(0)
+	sections := 0
+	err := recoverFormat(func() error {
+		for section, err := range layer.TagsIter(src, header) {
+			if err != nil {
+				return err
+			}
+			sectionEnd, err := src.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return err
+			}
+			if sectionEnd > size {
+				return io.ErrUnexpectedEOF
+			}
+			if tags == nil {
+				tags = &pixi.TagSection{}
+			}
+			tags.Merge(section)
+			end = max(end, sectionEnd)
+			sections += 1
+		}
+		return nil
+	})
+	if err != nil {
+		report.problem("tag chain of layer '%s' broken after %d sections: %v", layer.Name, sections, err)
+	}
+	return tags, end
+}
+
+// The most offsets tried one byte at a time when looking for a tile that is not at any known tile
+// boundary, on each side of the end of the last tile found before it.
+const maxScanOffsets = 4096
+
+// Checks every tile of the layer, updating the offsets of tiles found elsewhere in the file. Returns
+// the indices of tiles that could not be found, and the end of the last tile that was found.
+func locateTiles(src io.ReadSeeker, header pixi.PixiHeader, layer *pixi.Layer, searchStart int64, size int64, report *RepairReport) ([]int, int64) {
+	// every tile passes the check of its own checksum, so the data of the readable tiles is claimed to keep
+	// other tiles from being found there, and the ends of that data are where other tiles most likely start
+	scan := tileScan{start: searchStart, size: size, boundaries: []int64{searchStart}}
+	readable := make([]bool, layer.DiskTiles())
+	for tileInd := range layer.DiskTiles() {
+		readable[tileInd] = tileReadable(src, header, layer, tileInd, size)
+		if readable[tileInd] {
+			scan.claim(layer.TileOffsets[tileInd], tileEnd(header, layer, tileInd))
+		}
+	}
+
+	lost := []int{}
+	end := searchStart
+	for tileInd := range layer.DiskTiles() {
+		if readable[tileInd] {
+			end = max(end, tileEnd(header, layer, tileInd))
+			continue
+		}
+		if scan.find(src, header, layer, tileInd, end) {
+			report.RelocatedTiles += 1
+			report.problem("tile %d of layer '%s' relocated to offset %d", tileInd, layer.Name, layer.TileOffsets[tileInd])
+			end = max(end, tileEnd(header, layer, tileInd))
+			scan.claim(layer.TileOffsets[tileInd], tileEnd(header, layer, tileInd))
+			continue
+		}
+		report.LostTiles += 1
+		report.problem("tile %d of layer '%s' could not be found", tileInd, layer.Name)
+		lost = append(lost, tileInd)
+	}
+	return lost, end
+}
+
+func tileEnd(header pixi.PixiHeader, layer *pixi.Layer, tileInd int) int64 {
+	return layer.TileOffsets[tileInd] + layer.TileBytes[tileInd] + int64(header.Checksum.Size())
+}
+
+func tileReadable(src io.ReadSeeker, header pixi.PixiHeader, layer *pixi.Layer, tileInd int, size int64) bool {
+	offset, bytes := layer.TileOffsets[tileInd], layer.TileBytes[tileInd]
+	if bytes <= 0 || offset <= 0 || offset+bytes+int64(header.Checksum.Size()) > size {
+		return false
+	}
+	data := make([]byte, layer.DiskTileSize(tileInd))
+	return recoverFormat(func() error { return layer.ReadTile(src, header, tileInd, data) }) == nil
+}
+
+// The parts of the file searched for tiles that could not be read at their recorded offsets.
+type tileScan struct {
+	start      int64      // The first offset tiles can be found at.
+	size       int64      // The size of the file.
+	boundaries []int64    // The ends of the tiles found so far, along with start.
+	claimed    [][2]int64 // The offsets of the data of the tiles found so far, from start to end.
+}
+
+func (s *tileScan) claim(from int64, to int64) {
+	s.claimed = append(s.claimed, [2]int64{from, to})
+	s.boundaries = append(s.boundaries, to)
+}
+
+// Searches the file for data matching the checksum of the tile outside of the data of the tiles found
+// already: first at each tile boundary, then one byte at a time for a bounded distance after and before
+// the end of the last tile found, so that the work done does not grow with the size of the file. Only
+// possible when the size of the stored tile is known: always for uncompressed tiles, and for compressed
+// tiles only if their byte count in the layer header is intact. Tiles cannot be located without a checksum.
+func (s *tileScan) find(src io.ReadSeeker, header pixi.PixiHeader, layer *pixi.Layer, tileInd int, end int64) bool {
+	if header.Checksum == pixi.ChecksumNone {
+		return false
+	}
+	candidateBytes := layer.TileBytes[tileInd]
+	if layer.Compression == pixi.CompressionNone && (layer.TileCompressions == nil || layer.TileCompressions[tileInd] == pixi.CompressionNone) {
+		candidateBytes = int64(layer.DiskTileSize(tileInd))
+	}
+	if candidateBytes <= 0 || candidateBytes > s.size {
+		return false
+	}
+	origOffset, origBytes := layer.TileOffsets[tileInd], layer.TileBytes[tileInd]
+	layer.TileBytes[tileInd] = candidateBytes
+	try := func(offset int64) bool {
+		candidateEnd := offset + candidateBytes + int64(header.Checksum.Size())
+		if offset < s.start || candidateEnd > s.size || layer.TilePadding(offset) != 0 {
+			return false
+		}
+		for _, claimed := range s.claimed {
+			if offset < claimed[1] && candidateEnd > claimed[0] {
+				return false
+			}
+		}
+		layer.TileOffsets[tileInd] = offset
+		return tileReadable(src, header, layer, tileInd, s.size)
+	}
+
+	for _, boundary := range s.boundaries {
+		if try(boundary + int64(layer.TilePadding(boundary))) {
+			return true
+		}
+	}
+	// tiles are usually stored in order, so look after the previous tile before looking before it
+	for distance := range int64(maxScanOffsets) {
+		if try(end+distance) || (distance > 0 && try(end-distance)) {
+			return true
+		}
+	}
+	layer.TileOffsets[tileInd], layer.TileBytes[tileInd] = origOffset, origBytes
+	return false
+}
+
+// Runs fn, converting any panic caused by interpreting corrupted data into a format error.
+func recoverFormat(fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = pixi.FormatError(fmt.Sprint(r))
+		}
+	}()
+	return fn()
+}
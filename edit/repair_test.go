@@ -0,0 +1,156 @@
+package edit
+
+import (
+	"encoding/binary"
+	"slices"
+	"testing"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/internal/buffer"
+	"github.com/owlpinetech/pixi/pixitest"
+	"github.com/owlpinetech/pixi/read"
+)
+
+func TestRepairCorruptedFile(t *testing.T) {
+	for _, compression := range []pixi.Compression{pixi.CompressionNone, pixi.CompressionFlate} {
+		buf := writeIndexedLayer(t, compression)
+		summary, err := pixi.ReadPixi(buffer.NewBufferFrom(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report, err := CheckFile(buffer.NewBufferFrom(buf.Bytes())); err != nil || !report.OK() {
+			t.Fatalf("expected intact file to pass checks, got %v, %v", report.Problems, err)
+		}
+
+		// point a tile at the wrong data, lose another tile entirely, loop the tag chain back on
+		// itself, and add some trailing garbage
+		layer := summary.Layers[0]
+		layerOffset := summary.LayerOffset(layer)
+		layer.TileOffsets[1] += 3
+		layer.TileOffsets[2] = 1
+		layer.TileBytes[2] = 1
+		err = layer.OverwriteHeader(buf, summary.Header, layerOffset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = buf.Seek(summary.Header.FirstTagsOffset, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		summary.Tags[0].NextTagsStart = summary.Header.FirstTagsOffset
+		err = summary.Tags[0].Write(buf, summary.Header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = buf.Seek(0, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = buf.Write([]byte{1, 2, 3, 4, 5})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := pixi.ReadPixi(buffer.NewBufferFrom(buf.Bytes())); err == nil {
+			t.Fatal("expected corrupted file to fail to read")
+		}
+
+		repaired := buffer.NewBuffer(20)
+		report, err := Repair(repaired, buffer.NewBufferFrom(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.Layers != 1 || report.Tags != 1 {
+			t.Errorf("expected 1 layer and 1 tag section, got %d and %d", report.Layers, report.Tags)
+		}
+		// the size of an uncompressed tile is always known so it can always be found, but the lost byte
+		// count of the compressed tile makes it impossible to find
+		wantLost := 0
+		if compression != pixi.CompressionNone {
+			wantLost = 1
+		}
+		if report.RelocatedTiles != 2-wantLost || report.LostTiles != wantLost {
+			t.Errorf("expected %d relocated and %d lost tiles, got %d and %d", 2-wantLost, wantLost, report.RelocatedTiles, report.LostTiles)
+		}
+		if report.TrailingBytes != 5 {
+			t.Errorf("expected 5 trailing bytes, got %d", report.TrailingBytes)
+		}
+
+		rdr := buffer.NewBufferFrom(repaired.Bytes())
+		fixed, err := pixi.ReadPixi(rdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lostRegion := []pixi.SampleCoordinate{}
+		if wantLost > 0 {
+			start, end := fixed.Layers[0].Dimensions.TileBounds(2)
+			for coord := range (Region{Start: start, End: end}).Coordinates() {
+				lostRegion = append(lostRegion, slices.Clone(coord))
+			}
+		}
+		for coord, sample := range read.Samples(rdr, fixed.Header, fixed.Layers[0]) {
+			ind := coord.ToSampleIndex(fixed.Layers[0].Dimensions)
+			want := []any{uint32(ind), float32(ind) / 2}
+			if slices.ContainsFunc(lostRegion, func(c pixi.SampleCoordinate) bool { return slices.Equal(c, coord) }) {
+				want = []any{uint32(0), float32(0)}
+			}
+			if sample[0] != want[0] || sample[1] != want[1] {
+				t.Fatalf("expected %v at %v in repaired file, got %v", want, coord, sample)
+			}
+		}
+	}
+}
+
+func TestCheckFileIntactBigEndian(t *testing.T) {
+	header := pixi.PixiHeader{Version: pixi.Version, OffsetSize: 8, ByteOrder: binary.BigEndian, Checksum: pixi.ChecksumCrc32c}
+	buf := buffer.NewBuffer(20)
+	err := WriteContiguousTileOrderPixi(buf, header, map[string]string{"k": "v"},
+		LayerWriter{
+			Layer: pixi.NewLayer("one", false, pixi.CompressionLzwMsb,
+				pixi.DimensionSet{{Name: "x", Size: 6, TileSize: 3}}, []pixi.Field{{Name: "v", Type: pixi.FieldInt64}}),
+			IterFn: func(layer *pixi.Layer, coord pixi.SampleCoordinate) ([]any, map[string]any) {
+				return []any{int64(coord[0])}, nil
+			},
+		},
+		LayerWriter{
+			Layer: pixi.NewLayer("two", false, pixi.CompressionNone,
+				pixi.DimensionSet{{Name: "x", Size: 3, TileSize: 3}}, []pixi.Field{{Name: "v", Type: pixi.FieldInt64}}),
+			IterFn: func(layer *pixi.Layer, coord pixi.SampleCoordinate) ([]any, map[string]any) {
+				return []any{int64(coord[0])}, nil
+			},
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := CheckFile(buffer.NewBufferFrom(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() || report.Layers != 2 || report.Tags != 1 {
+		t.Errorf("expected clean report of 2 layers and 1 tag section, got %+v", report)
+	}
+}
+
+func TestCheckFileBoundsTileScan(t *testing.T) {
+	buf := writeIndexedLayer(t, pixi.CompressionNone)
+	summary, err := pixi.ReadPixi(buffer.NewBufferFrom(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// corrupt the last tile so that it cannot be found anywhere, in a file made much larger by trailing data
+	layer := summary.Layers[0]
+	data := slices.Clone(buf.Bytes())
+	data[layer.TileOffsets[3]] ^= 0xff
+	data = append(data, make([]byte, 1<<20)...)
+
+	stream := pixitest.NewStream(data)
+	report, err := CheckFile(stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.LostTiles != 1 || report.RelocatedTiles != 0 {
+		t.Errorf("expected 1 lost tile, got %d lost and %d relocated", report.LostTiles, report.RelocatedTiles)
+	}
+	if reads := stream.Calls(pixitest.OpRead); reads > 8*maxScanOffsets {
+		t.Errorf("expected the scan for the lost tile to be bounded, but it read %d times", reads)
+	}
+}
@@ -0,0 +1,107 @@
+package edit
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/read"
+)
+
+// The number of source tiles held in memory while resampling, when the options do not say otherwise.
+const defaultOperationCacheTiles = 16
+
+// Options for Retile.
+type RetileOptions struct {
+	TileSize           int                // The new tile size of every dimension, or 0 to keep the existing tile sizes.
+	DimensionTileSizes map[string]int     // New tile sizes of individual dimensions by name, overriding TileSize.
+	CacheTiles         int                // The number of source tiles held in memory at once, or 0 for a default.
+	Budget             *pixi.MemoryBudget // Bounds the source tiles held in memory by bytes instead of CacheTiles, if not nil.
+	Progress           ProgressFunc       // Called after each tile is written, if not nil.
+	AllowSlowTiling    bool               // Whether to allow tile sizes rejected by pixi.DimensionSet.CheckTiling.
+}
+
+// Copies the Pixi file in src to dst with the tiles of every layer resized according to the options.
+// A tile size larger than its dimension is reduced to the size of the dimension. The samples of each
+// layer are unchanged, as are the names, fields, and compression of the layers. All file tag sections
+// are combined into a single section in the output, as are the tag sections of each layer. Cancelling
+// the context stops the copy between tiles. Tile sizes rejected by pixi.DimensionSet.CheckTiling fail with
+// pixi.ErrSlowTiling unless the options allow them.
+func Retile(ctx context.Context, dst io.WriteSeeker, src io.ReadSeeker, options RetileOptions) error {
+	srcPixi, layers, err := retiledLayers(src, options)
+	if err != nil {
+		return err
+	}
+	return writeDerivedPixi(ctx, dst, srcPixi.Header, mergeTagSections(srcPixi.Tags), layers, options.Progress)
+}
+
+// Works out the file Retile would write, without writing it (see OutputPlan).
+func PlanRetile(ctx context.Context, src io.ReadSeeker, options RetileOptions) (OutputPlan, error) {
+	srcPixi, layers, err := retiledLayers(src, options)
+	if err != nil {
+		return OutputPlan{}, err
+	}
+	return planDerivedPixi(ctx, srcPixi.Header, layers)
+}
+
+func retiledLayers(src io.ReadSeeker, options RetileOptions) (pixi.Pixi, []derivedLayer, error) {
+	if options.TileSize < 0 {
+		return pixi.Pixi{}, nil, pixi.FormatError("tile size must not be negative")
+	}
+	srcPixi, err := pixi.ReadPixi(src)
+	if err != nil {
+		return pixi.Pixi{}, nil, err
+	}
+
+	managers := operationCacheManagers(options.CacheTiles, options.Budget)
+	layers := make([]derivedLayer, len(srcPixi.Layers))
+	for i, srcLayer := range srcPixi.Layers {
+		dims := make(pixi.DimensionSet, len(srcLayer.Dimensions))
+		for d, dim := range srcLayer.Dimensions {
+			tileSize := options.TileSize
+			if size, found := options.DimensionTileSizes[dim.Name]; found {
+				tileSize = size
+			}
+			if tileSize < 0 {
+				return pixi.Pixi{}, nil, pixi.FormatError("tile size of dimension '" + dim.Name + "' must not be negative")
+			}
+			if tileSize > 0 {
+				dim.TileSize = min(tileSize, dim.Size)
+			}
+			dims[d] = dim
+		}
+		if !options.AllowSlowTiling {
+			err = dims.CheckTiling()
+			if err != nil {
+				return pixi.Pixi{}, nil, fmt.Errorf("layer '%s': %w", srcLayer.Name, err)
+			}
+		}
+		cache := read.NewLayerReadCache(src, srcPixi.Header, srcLayer, managers())
+		layers[i] = derivedLayer{
+			layer:  deriveLayer(srcLayer, srcLayer.Compression, dims),
+			sample: cache.SampleAt,
+		}
+	}
+	return srcPixi, layers, nil
+}
+
+// Returns a function creating the cache manager for each source layer of an operation. Without a budget,
+// each layer caches up to cacheTiles tiles; with one, all layers draw from a single pool bounded by it.
+func operationCacheManagers(cacheTiles int, budget *pixi.MemoryBudget) func() read.CacheManager[int, []byte] {
+	if budget == nil {
+		return func() read.CacheManager[int, []byte] {
+			return read.NewLfuCacheManager(cacheTilesOrDefault(cacheTiles))
+		}
+	}
+	pool := read.NewCachePool(budget.Limit())
+	pool.SetMemoryBudget(budget)
+	return pool.Manager
+}
+
+func cacheTilesOrDefault(cacheTiles int) int {
+	if cacheTiles <= 0 {
+		return defaultOperationCacheTiles
+	}
+	return cacheTiles
+}
@@ -0,0 +1,85 @@
+package edit
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/internal/buffer"
+)
+
+func TestRetileKeepsSamples(t *testing.T) {
+	src := writeIndexedLayer(t, pixi.CompressionFlate)
+
+	dst := buffer.NewBuffer(20)
+	lastDone, lastTotal := 0, 0
+	err := Retile(context.Background(), dst, buffer.NewBufferFrom(src.Bytes()), RetileOptions{
+		TileSize:           3,
+		DimensionTileSizes: map[string]int{"y": 20},
+		CacheTiles:         1,
+		Progress:           func(done int, total int) { lastDone, lastTotal = done, total },
+		AllowSlowTiling:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastDone != lastTotal || lastTotal != 4 {
+		t.Errorf("expected progress to finish at 4 of 4 tiles, got %d of %d", lastDone, lastTotal)
+	}
+
+	summary, err := pixi.ReadPixi(buffer.NewBufferFrom(dst.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dims := summary.Layers[0].Dimensions
+	if dims[0].TileSize != 3 || dims[1].TileSize != 10 {
+		t.Errorf("expected tile sizes 3 and 10 (clipped to the dimension), got %d and %d", dims[0].TileSize, dims[1].TileSize)
+	}
+	if summary.Layers[0].Compression != pixi.CompressionFlate {
+		t.Errorf("expected the compression to be kept, got %v", summary.Layers[0].Compression)
+	}
+	for coord := range dims.SampleCoordinates() {
+		if !reflect.DeepEqual(freshSample(t, dst, coord), freshSample(t, src, coord)) {
+			t.Fatalf("sample at %v changed", coord)
+		}
+	}
+}
+
+func TestRetileWithinMemoryBudget(t *testing.T) {
+	src := writeIndexedLayer(t, pixi.CompressionNone)
+
+	// room for a single 200 byte source tile at a time
+	budget := pixi.NewMemoryBudget(250)
+	dst := buffer.NewBuffer(20)
+	err := Retile(context.Background(), dst, buffer.NewBufferFrom(src.Bytes()), RetileOptions{TileSize: 2, Budget: budget, AllowSlowTiling: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if budget.Peak() > budget.Limit() {
+		t.Errorf("expected source tiles to stay within the budget, peak was %d", budget.Peak())
+	}
+	dims := pixi.DimensionSet{{Name: "x", Size: 10, TileSize: 2}, {Name: "y", Size: 10, TileSize: 2}}
+	for coord := range dims.SampleCoordinates() {
+		if !reflect.DeepEqual(freshSample(t, dst, coord), freshSample(t, src, coord)) {
+			t.Fatalf("sample at %v changed", coord)
+		}
+	}
+}
+
+func TestRetileInvalidTileSize(t *testing.T) {
+	src := writeIndexedLayer(t, pixi.CompressionNone)
+	err := Retile(context.Background(), buffer.NewBuffer(20), buffer.NewBufferFrom(src.Bytes()), RetileOptions{DimensionTileSizes: map[string]int{"x": -1}})
+	if err == nil {
+		t.Error("expected an error for a negative tile size")
+	}
+}
+
+func TestRetileRejectsSlowTiling(t *testing.T) {
+	src := writeIndexedLayer(t, pixi.CompressionNone)
+	err := Retile(context.Background(), buffer.NewBuffer(20), buffer.NewBufferFrom(src.Bytes()), RetileOptions{TileSize: 1})
+	if !errors.Is(err, pixi.ErrSlowTiling) {
+		t.Errorf("expected single sample tiles to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,239 @@
+package edit
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"slices"
+	"strconv"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/internal/xxhash"
+)
+
+// The keys of the file tags holding the manifest of a shard, see ShardManifest.
+const (
+	ShardDatasetTag = "shard-dataset"
+	ShardIndexTag   = "shard-index"
+	ShardCountTag   = "shard-count"
+)
+
+// Identifies a shard: one of several Pixi files produced independently, such as by the machines of a
+// cluster, each holding a disjoint subset of the tiles of the same layers, to be combined into the final
+// file by AssembleShards. The manifest is recorded in the file tags of the shard, and the tiles it holds
+// are those written in it.
+type ShardManifest struct {
+	Dataset string // Names the dataset the shard is part of, the same for every shard of the dataset.
+	Index   int    // The position of the shard among the shards of the dataset, from 0.
+	Count   int    // The number of shards of the dataset.
+}
+
+// Records the manifest in the tags of the section.
+func (m ShardManifest) SetTags(section *pixi.TagSection) {
+	section.Set(ShardDatasetTag, m.Dataset)
+	section.Set(ShardIndexTag, strconv.Itoa(m.Index))
+	section.Set(ShardCountTag, strconv.Itoa(m.Count))
+}
+
+// Finds the manifest of a shard from the last of its file tags that record each part. Returns an error if
+// the file is not a shard, or its manifest is invalid.
+func ReadShardManifest(shard *pixi.Pixi) (ShardManifest, error) {
+	tags := mergeTagSections(shard.Tags).Tags
+	dataset, hasDataset := tags[ShardDatasetTag]
+	index, indexErr := strconv.Atoi(tags[ShardIndexTag])
+	count, countErr := strconv.Atoi(tags[ShardCountTag])
+	if !hasDataset || indexErr != nil || countErr != nil {
+		return ShardManifest{}, pixi.FormatError("file has no valid shard manifest")
+	}
+	if count <= 0 || index < 0 || index >= count {
+		return ShardManifest{}, pixi.FormatError("shard index " + strconv.Itoa(index) + " is outside the " + strconv.Itoa(count) + " shards of the dataset")
+	}
+	return ShardManifest{Dataset: dataset, Index: index, Count: count}, nil
+}
+
+// The disk tiles of a layer with the given number of disk tiles that the shard at index of count shards
+// produces when the tiles are split evenly between them: a contiguous run, so that each shard writes its
+// tiles in order.
+func ShardTiles(diskTiles int, index int, count int) []int {
+	tiles := []int{}
+	for tileIndex := index * diskTiles / count; tileIndex < (index+1)*diskTiles/count; tileIndex++ {
+		tiles = append(tiles, tileIndex)
+	}
+	return tiles
+}
+
+// The shard of count shards that owns the disk tile of the layer, found by consistent hashing of the name
+// of the layer and the coordinate of the tile, so that producers and the assembler agree on the owner of
+// every tile knowing only the layer and the number of shards. Tiles are spread evenly across the shards
+// without regard to where they lie, every field of a tile of a separated layer has the same owner, and
+// adding a shard moves only the tiles the new shard takes over.
+func ShardOwner(layer *pixi.Layer, diskTile int, count int) int {
+	tile := diskTile % layer.Dimensions.Tiles()
+	coord := pixi.TileSelector{Tile: tile}.ToTileCoordinate(layer.Dimensions)
+	key := []byte(layer.Name)
+	for _, c := range coord.Tile {
+		key = binary.LittleEndian.AppendUint64(key, uint64(c))
+	}
+	return jumpHash(xxhash.Sum64(key), count)
+}
+
+// The disk tiles of the layer owned by the shard of count shards, in order, as assigned by ShardOwner.
+func OwnedTiles(layer *pixi.Layer, shard int, count int) []int {
+	tiles := []int{}
+	for diskTile := range layer.DiskTiles() {
+		if ShardOwner(layer, diskTile, count) == shard {
+			tiles = append(tiles, diskTile)
+		}
+	}
+	return tiles
+}
+
+// Maps a key to one of the given number of buckets with the jump consistent hash of Lamping and Veach.
+func jumpHash(key uint64, buckets int) int {
+	bucket, next := int64(-1), int64(0)
+	for next < int64(buckets) {
+		bucket = next
+		key = key*2862933555777941757 + 1
+		next = int64(float64(bucket+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(bucket)
+}
+
+// Writes a shard holding only the given disk tiles of the layer, each filled with its decoded data by
+// fill, with the manifest in its file tags. The decoded tiles are encoded on up to workers goroutines
+// (see pixi.Workers), but fill is only called from the calling goroutine, in the order of the tiles.
+// Cancelling the context stops the write between tiles.
+func WriteShard(ctx context.Context, dst io.WriteSeeker, header pixi.PixiHeader, layer *pixi.Layer, manifest ShardManifest, tiles []int, workers int, fill func(tileIndex int, data []byte) error) error {
+	tags := &pixi.TagSection{}
+	manifest.SetTags(tags)
+	return writeDerivedPixi(ctx, dst, header, tags, []derivedLayer{{
+		layer:   layer,
+		tile:    fill,
+		workers: workers,
+		order:   slices.Values(tiles),
+	}}, nil)
+}
+
+// Options for AssembleShards.
+type AssembleOptions struct {
+	AllowMissing bool         // Leave tiles held by no shard unwritten, rather than failing.
+	Progress     ProgressFunc // Called as tiles are copied, if set.
+	// If set, gives the shard of count shards that must hold each disk tile of each layer, such as
+	// ShardOwner, so that tiles written by the wrong shard are caught.
+	Owner func(layer *pixi.Layer, diskTile int, count int) int
+}
+
+// Combines the shards of a dataset into a single file, copying the encoded tiles of every shard without
+// decoding them and merging the offsets of the tiles of each layer. Every shard of the dataset must be
+// given, in any order, and they must have the same header and layers, differing only in the tiles they
+// hold; no tile may be held by more than one shard, and unless the options allow it, every tile must be
+// held by one. The output holds the file tags of every shard, less their manifests, and the layer tags of
+// every shard, with those of later shards by index replacing those of earlier ones. Cancelling the
+// context stops the assembly between tiles.
+func AssembleShards(ctx context.Context, dst io.WriteSeeker, srcs []io.ReadSeeker, options AssembleOptions) error {
+	if len(srcs) == 0 {
+		return pixi.FormatError("no shards to assemble")
+	}
+	shards := make([]*pixi.Pixi, len(srcs))
+	readers := make([]io.ReadSeeker, len(srcs))
+	var dataset string
+	for i, src := range srcs {
+		shard, err := pixi.ReadPixi(src)
+		if err != nil {
+			return err
+		}
+		manifest, err := ReadShardManifest(&shard)
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			dataset = manifest.Dataset
+		}
+		switch {
+		case manifest.Dataset != dataset:
+			return pixi.FormatError("shard of dataset '" + manifest.Dataset + "' cannot be assembled with shards of '" + dataset + "'")
+		case manifest.Count != len(srcs):
+			return pixi.FormatError("dataset has " + strconv.Itoa(manifest.Count) + " shards, but " + strconv.Itoa(len(srcs)) + " were given")
+		case shards[manifest.Index] != nil:
+			return pixi.FormatError("shard " + strconv.Itoa(manifest.Index) + " was given more than once")
+		}
+		shards[manifest.Index], readers[manifest.Index] = &shard, src
+	}
+
+	first := shards[0]
+	for index, shard := range shards[1:] {
+		if err := compatibleShards(first, shard); err != nil {
+			return pixi.FormatError("shard " + strconv.Itoa(index+1) + " does not match shard 0: " + err.Error())
+		}
+	}
+
+	tags := &pixi.TagSection{}
+	for _, shard := range shards {
+		tags.Merge(mergeTagSections(shard.Tags))
+	}
+	for _, key := range []string{ShardDatasetTag, ShardIndexTag, ShardCountTag, pixi.ContentHashTag, pixi.ContentSizeTag} {
+		delete(tags.Tags, key)
+	}
+
+	layers := make([]derivedLayer, len(first.Layers))
+	for layerIndex, firstLayer := range first.Layers {
+		layer := deriveLayer(firstLayer, firstLayer.Compression, firstLayer.Dimensions)
+		sources := make([]encodedSource, layer.DiskTiles())
+		layerTags, tagged := &pixi.TagSection{}, false
+		for shardIndex, shard := range shards {
+			shardLayer := shard.Layers[layerIndex]
+			for tileIndex, tileBytes := range shardLayer.TileBytes {
+				if tileBytes == 0 {
+					continue
+				}
+				if held := sources[tileIndex].layer; held != nil {
+					return pixi.FormatError("tile " + strconv.Itoa(tileIndex) + " of layer '" + layer.Name + "' is held by more than one shard")
+				}
+				if options.Owner != nil && options.Owner(layer, tileIndex, len(shards)) != shardIndex {
+					return pixi.FormatError("tile " + strconv.Itoa(tileIndex) + " of layer '" + layer.Name + "' is held by shard " + strconv.Itoa(shardIndex) + ", which does not own it")
+				}
+				sources[tileIndex] = encodedSource{layer: shardLayer, reader: readers[shardIndex], tile: tileIndex}
+			}
+			if len(shardLayer.Tags) > 0 {
+				layerTags.Merge(mergeTagSections(shardLayer.Tags))
+				tagged = true
+			}
+		}
+		if tagged {
+			layer.Tags = []*pixi.TagSection{layerTags}
+		}
+		if !options.AllowMissing {
+			if missing := slices.IndexFunc(sources, func(src encodedSource) bool { return src.layer == nil }); missing >= 0 {
+				return pixi.FormatError("tile " + strconv.Itoa(missing) + " of layer '" + layer.Name + "' is held by no shard")
+			}
+		}
+		layers[layerIndex] = derivedLayer{
+			layer: layer,
+			encoded: func(tileIndex int) (encodedSource, bool) {
+				return sources[tileIndex], sources[tileIndex].layer != nil
+			},
+		}
+	}
+	return writeDerivedPixi(ctx, dst, first.Header, tags, layers, options.Progress)
+}
+
+// Checks that two shards have the same header and layers, so that the encoded tiles of one can be copied
+// into a file laid out as the other.
+func compatibleShards(a *pixi.Pixi, b *pixi.Pixi) error {
+	if a.Header.Version != b.Header.Version || a.Header.OffsetSize != b.Header.OffsetSize ||
+		a.Header.ByteOrder != b.Header.ByteOrder || a.Header.Checksum != b.Header.Checksum {
+		return pixi.FormatError("headers differ")
+	}
+	if len(a.Layers) != len(b.Layers) {
+		return pixi.FormatError("numbers of layers differ")
+	}
+	for i, layer := range a.Layers {
+		other := b.Layers[i]
+		if layer.Name != other.Name || layer.Separated != other.Separated || layer.Compression != other.Compression ||
+			layer.TileAlignment != other.TileAlignment || !slices.Equal(layer.Dimensions, other.Dimensions) ||
+			!slices.Equal(layer.Fields, other.Fields) {
+			return pixi.FormatError("layer '" + layer.Name + "' differs")
+		}
+	}
+	return nil
+}
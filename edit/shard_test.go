@@ -0,0 +1,192 @@
+package edit
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/internal/buffer"
+)
+
+// A 10x10 layer in 5x5 tiles with a single uint32 field, as written to every shard by writeShard.
+func shardedLayer() *pixi.Layer {
+	return pixi.NewLayer("sharded", false, pixi.CompressionFlate,
+		pixi.DimensionSet{{Name: "x", Size: 10, TileSize: 5}, {Name: "y", Size: 10, TileSize: 5}},
+		[]pixi.Field{{Name: "index", Type: pixi.FieldUint32}})
+}
+
+// Writes shard index of count of the layer of shardedLayer, whose field holds the index of each sample,
+// holding the given disk tiles.
+func writeShard(t *testing.T, manifest ShardManifest, tiles []int) *buffer.Buffer {
+	t.Helper()
+	header := pixi.PixiHeader{Version: pixi.Version, OffsetSize: 4, ByteOrder: binary.LittleEndian}
+	layer := shardedLayer()
+	layer.Tags = []*pixi.TagSection{{Tags: map[string]string{"producer": manifest.Dataset + "-" + string(rune('a'+manifest.Index))}}}
+	buf := buffer.NewBuffer(10)
+	err := WriteShard(context.Background(), buf, header, layer, manifest, tiles, 2, func(tileIndex int, data []byte) error {
+		return fillDiskTile(layer, header.ByteOrder, tileIndex, data, func(coord pixi.SampleCoordinate) ([]any, error) {
+			return []any{uint32(coord.ToSampleIndex(layer.Dimensions))}, nil
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf
+}
+
+func assembleShards(shards []*buffer.Buffer, options AssembleOptions) (*buffer.Buffer, error) {
+	srcs := make([]io.ReadSeeker, len(shards))
+	for i, shard := range shards {
+		srcs[i] = buffer.NewBufferFrom(shard.Bytes())
+	}
+	dst := buffer.NewBuffer(10)
+	return dst, AssembleShards(context.Background(), dst, srcs, options)
+}
+
+func TestAssembleShards(t *testing.T) {
+	shards := make([]*buffer.Buffer, 3)
+	for index := range shards {
+		manifest := ShardManifest{Dataset: "farm", Index: index, Count: len(shards)}
+		shards[index] = writeShard(t, manifest, ShardTiles(4, index, len(shards)))
+	}
+	// shards can be given in any order
+	dst, err := assembleShards([]*buffer.Buffer{shards[2], shards[0], shards[1]}, AssembleOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assembled, err := pixi.ReadPixi(buffer.NewBufferFrom(dst.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadShardManifest(&assembled); err == nil {
+		t.Error("expected the manifests of the shards to be dropped")
+	}
+	if producer := mergeTagSections(assembled.Layers[0].Tags).Tags["producer"]; producer != "farm-c" {
+		t.Errorf("expected the layer tags of the last shard, got %q", producer)
+	}
+	for _, coord := range []pixi.SampleCoordinate{{0, 0}, {7, 2}, {3, 8}, {9, 9}} {
+		sample := freshSample(t, dst, coord)
+		if expect := uint32(coord.ToSampleIndex(assembled.Layers[0].Dimensions)); sample[0] != expect {
+			t.Errorf("expected %d at %v, got %v", expect, coord, sample[0])
+		}
+	}
+}
+
+func TestAssembleShardsMissingTiles(t *testing.T) {
+	shards := []*buffer.Buffer{
+		writeShard(t, ShardManifest{Dataset: "farm", Index: 0, Count: 2}, []int{0, 1}),
+		writeShard(t, ShardManifest{Dataset: "farm", Index: 1, Count: 2}, []int{3}),
+	}
+	if _, err := assembleShards(shards, AssembleOptions{}); err == nil {
+		t.Error("expected an error for a tile held by no shard")
+	}
+	dst, err := assembleShards(shards, AssembleOptions{AllowMissing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assembled, err := pixi.ReadPixi(buffer.NewBufferFrom(dst.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assembled.Layers[0].TileBytes[2] != 0 || assembled.Layers[0].TileBytes[3] == 0 {
+		t.Errorf("expected only tile 2 to be left unwritten, got tile bytes %v", assembled.Layers[0].TileBytes)
+	}
+}
+
+func TestAssembleShardsRejectsMismatches(t *testing.T) {
+	shard := func(dataset string, index int, count int, tiles ...int) *buffer.Buffer {
+		return writeShard(t, ShardManifest{Dataset: dataset, Index: index, Count: count}, tiles)
+	}
+	cases := map[string][]*buffer.Buffer{
+		"overlapping tiles":  {shard("farm", 0, 2, 0, 1, 2), shard("farm", 1, 2, 2, 3)},
+		"missing shard":      {shard("farm", 0, 3, 0, 1), shard("farm", 1, 3, 2, 3)},
+		"repeated shard":     {shard("farm", 0, 2, 0, 1), shard("farm", 0, 2, 2, 3)},
+		"different datasets": {shard("farm", 0, 2, 0, 1), shard("field", 1, 2, 2, 3)},
+	}
+	for name, shards := range cases {
+		if _, err := assembleShards(shards, AssembleOptions{}); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	plain := writeIndexedLayer(t, pixi.CompressionFlate)
+	if _, err := assembleShards([]*buffer.Buffer{plain}, AssembleOptions{}); err == nil {
+		t.Error("expected an error for a file without a shard manifest")
+	}
+}
+
+func TestShardTilesCoverEveryTile(t *testing.T) {
+	for _, count := range []int{1, 3, 7, 20} {
+		seen := make([]int, 13)
+		for index := range count {
+			for _, tile := range ShardTiles(len(seen), index, count) {
+				seen[tile]++
+			}
+		}
+		for tile, times := range seen {
+			if times != 1 {
+				t.Errorf("%d shards: expected tile %d in exactly one shard, got %d", count, tile, times)
+			}
+		}
+	}
+}
+
+func TestShardOwner(t *testing.T) {
+	layer := pixi.NewLayer("owned", true, pixi.CompressionNone,
+		pixi.DimensionSet{{Name: "x", Size: 400, TileSize: 10}, {Name: "y", Size: 300, TileSize: 10}},
+		[]pixi.Field{{Name: "a", Type: pixi.FieldUint8}, {Name: "b", Type: pixi.FieldUint8}})
+	tiles := layer.Dimensions.Tiles()
+	counts := make([]int, 8)
+	for tile := range tiles {
+		owner := ShardOwner(layer, tile, len(counts))
+		if owner < 0 || owner >= len(counts) {
+			t.Fatalf("expected an owner among %d shards, got %d", len(counts), owner)
+		}
+		if other := ShardOwner(layer, tile+tiles, len(counts)); other != owner {
+			t.Errorf("expected both fields of tile %d to have the same owner, got %d and %d", tile, owner, other)
+		}
+		counts[owner]++
+		// a new shard only takes tiles over, never moving them between the old shards
+		if grown := ShardOwner(layer, tile, len(counts)+1); grown != owner && grown != len(counts) {
+			t.Errorf("expected tile %d to stay with shard %d or move to the new shard, got %d", tile, owner, grown)
+		}
+	}
+	for shard, count := range counts {
+		if count < tiles/len(counts)*3/4 || count > tiles/len(counts)*5/4 {
+			t.Errorf("expected shard %d to own about %d tiles, got %d", shard, tiles/len(counts), count)
+		}
+	}
+
+	owned := 0
+	for shard := range len(counts) {
+		for _, diskTile := range OwnedTiles(layer, shard, len(counts)) {
+			if ShardOwner(layer, diskTile, len(counts)) != shard {
+				t.Errorf("expected disk tile %d to be owned by shard %d", diskTile, shard)
+			}
+			owned++
+		}
+	}
+	if owned != layer.DiskTiles() {
+		t.Errorf("expected every one of %d disk tiles to be owned once, got %d", layer.DiskTiles(), owned)
+	}
+}
+
+func TestAssembleShardsChecksOwners(t *testing.T) {
+	owned := make([]*buffer.Buffer, 3)
+	ranged := make([]*buffer.Buffer, 3)
+	for index := range owned {
+		manifest := ShardManifest{Dataset: "farm", Index: index, Count: len(owned)}
+		owned[index] = writeShard(t, manifest, OwnedTiles(shardedLayer(), index, len(owned)))
+		ranged[index] = writeShard(t, manifest, ShardTiles(4, index, len(ranged)))
+	}
+	if _, err := assembleShards(owned, AssembleOptions{Owner: ShardOwner}); err != nil {
+		t.Errorf("expected shards of their own tiles to assemble, got %v", err)
+	}
+	// shards split by range hold tiles that consistent hashing gives to other shards
+	if _, err := assembleShards(ranged, AssembleOptions{Owner: ShardOwner}); err == nil {
+		t.Error("expected an error for tiles held by shards that do not own them")
+	}
+}
@@ -0,0 +1,217 @@
+package edit
+
+import (
+	"io"
+	"os"
+	"sync"
+
+	"github.com/owlpinetech/pixi"
+)
+
+// Writes the samples of a layer in any order, without holding the layer in memory, by spooling the
+// uncompressed tiles into a temporary spill file. Each sample is written straight to its final place
+// in the spill file, so the order samples are set in does not matter. Once every sample of interest has
+// been set, Assemble reads the tiles back in order and writes the finished (and possibly compressed)
+// layer to the destination stream. Samples that are never set are zero. The spill file is created
+// with its full size up front, which most file systems allocate sparsely.
+type SpillWriter struct {
+	spill        *os.File
+	header       pixi.PixiHeader
+	layer        *pixi.Layer
+	spillOffsets []int64
+	lock         sync.Mutex
+	modified     map[int]struct{} // disk tile indices modified since the last assembly
+	durability   Durability
+}
+
+// Creates a spill writer for the given layer, with its temporary spill file in dir (or the default
+// directory for temporary files if dir is empty). Close must be called to remove the spill file.
+func NewSpillWriter(header pixi.PixiHeader, layer *pixi.Layer, dir string) (*SpillWriter, error) {
+	spill, err := os.CreateTemp(dir, "pixi-spill-*")
+	if err != nil {
+		return nil, err
+	}
+	spillOffsets := make([]int64, layer.DiskTiles())
+	var size int64
+	for tileIndex := range spillOffsets {
+		spillOffsets[tileIndex] = size
+		size += int64(layer.DiskTileSize(tileIndex))
+	}
+	err = spill.Truncate(size)
+	if err != nil {
+		spill.Close()
+		os.Remove(spill.Name())
+		return nil, err
+	}
+	return &SpillWriter{
+		spill:        spill,
+		header:       header,
+		layer:        layer,
+		spillOffsets: spillOffsets,
+		modified:     make(map[int]struct{}),
+	}, nil
+}
+
+// The layer being written.
+func (s *SpillWriter) Layer() *pixi.Layer {
+	return s.layer
+}
+
+// The tiles modified since the writer was created or last assembled. Assembling resets the set of
+// tiles reported.
+func (s *SpillWriter) DirtyTiles() []int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	diskTiles := make([]int, 0, len(s.modified))
+	for tileIndex := range s.modified {
+		diskTiles = append(diskTiles, tileIndex)
+	}
+	return diskTilesToTiles(s.layer, diskTiles)
+}
+
+func (s *SpillWriter) markModified(diskTile int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.modified[diskTile] = struct{}{}
+}
+
+// Sets the values of every field of the sample at the given coordinate. The values must be of the
+// Go types corresponding to each field's type. Returns an error if the coordinate is outside the layer
+// or there is not one value for each field.
+func (s *SpillWriter) SetSampleAt(coord pixi.SampleCoordinate, sample []any) error {
+	err := s.checkCoordinate(coord)
+	if err != nil {
+		return err
+	}
+	if len(sample) != len(s.layer.Fields) {
+		return pixi.FormatError("sample does not have a value for each field of the layer")
+	}
+	if !s.layer.Separated {
+		// all fields of the sample are adjacent, so they can be written at once
+		raw := make([]byte, s.layer.SampleSize())
+		offset := 0
+		for fieldIndex, field := range s.layer.Fields {
+			field.ValueToBytes(sample[fieldIndex], raw[offset:], s.header.ByteOrder)
+			offset += field.Size()
+		}
+		selector := coord.ToTileSelector(s.layer.Dimensions)
+		_, err = s.spill.WriteAt(raw, s.spillOffsets[selector.Tile]+int64(selector.InTile*len(raw)))
+		if err != nil {
+			return err
+		}
+		s.markModified(selector.Tile)
+		return nil
+	}
+	for fieldIndex := range s.layer.Fields {
+		err = s.SetFieldAt(coord, fieldIndex, sample[fieldIndex])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Sets the value of a single field of the sample at the given coordinate. Returns an error if the
+// coordinate is outside the layer or the field index is outside the fields of the layer.
+func (s *SpillWriter) SetFieldAt(coord pixi.SampleCoordinate, fieldIndex int, value any) error {
+	err := s.checkCoordinate(coord)
+	if err != nil {
+		return err
+	}
+	if fieldIndex < 0 || fieldIndex >= len(s.layer.Fields) {
+		return pixi.FormatError("field index is outside the fields of the layer")
+	}
+	field := s.layer.Fields[fieldIndex]
+	raw := make([]byte, field.Size())
+	field.ValueToBytes(value, raw, s.header.ByteOrder)
+
+	selector := coord.ToTileSelector(s.layer.Dimensions)
+	diskTile := selector.Tile
+	var offset int64
+	if s.layer.Separated {
+		diskTile += s.layer.Dimensions.Tiles() * fieldIndex
+		offset = s.spillOffsets[diskTile] + int64(selector.InTile*field.Size())
+	} else {
+		offset = s.spillOffsets[diskTile] + int64(selector.InTile*s.layer.SampleSize())
+		for _, f := range s.layer.Fields[:fieldIndex] {
+			offset += int64(f.Size())
+		}
+	}
+	_, err = s.spill.WriteAt(raw, offset)
+	if err != nil {
+		return err
+	}
+	s.markModified(diskTile)
+	return nil
+}
+
+// Sets the options controlling when the stream the layer is assembled into is synced to stable storage.
+// Since that stream is only given to Assemble, it is there that an error is returned if syncing is
+// requested but the stream does not implement Syncer.
+func (s *SpillWriter) SetDurability(durability Durability) {
+	s.durability = durability
+}
+
+func (s *SpillWriter) checkCoordinate(coord pixi.SampleCoordinate) error {
+	if len(coord) != len(s.layer.Dimensions) {
+		return pixi.FormatError("sample coordinate does not match the number of layer dimensions")
+	}
+	for i, c := range coord {
+		if c < 0 || c >= s.layer.Dimensions[i].Size {
+			return pixi.FormatError("sample coordinate is outside the layer")
+		}
+	}
+	return nil
+}
+
+// Writes the layer header at the current position of w, followed by every tile of the layer read back
+// from the spill file, then rewrites the header with the final tile offsets. The stream is left
+// positioned at the end of the layer data. The spill writer can continue to be used afterwards, and
+// reports only the tiles modified after the assembly from DirtyTiles.
+func (s *SpillWriter) Assemble(w io.WriteSeeker) error {
+	sync, err := newSyncPolicy(w, s.durability)
+	if err != nil {
+		return err
+	}
+	layerOffset, err := w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	err = s.layer.WriteHeader(w, s.header)
+	if err != nil {
+		return err
+	}
+	for tileIndex := range s.layer.DiskTiles() {
+		data := make([]byte, s.layer.DiskTileSize(tileIndex))
+		_, err = s.spill.ReadAt(data, s.spillOffsets[tileIndex])
+		if err != nil {
+			return err
+		}
+		err = s.layer.WriteTile(w, s.header, tileIndex, data)
+		if err != nil {
+			return err
+		}
+		err = sync.tilesWritten(1)
+		if err != nil {
+			return err
+		}
+	}
+	err = s.layer.OverwriteHeader(w, s.header, layerOffset)
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	clear(s.modified)
+	s.lock.Unlock()
+	return sync.finished()
+}
+
+// Closes and removes the spill file.
+func (s *SpillWriter) Close() error {
+	err := s.spill.Close()
+	removeErr := os.Remove(s.spill.Name())
+	if err != nil {
+		return err
+	}
+	return removeErr
+}
@@ -0,0 +1,113 @@
+package edit
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/rand/v2"
+	"os"
+	"testing"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/internal/buffer"
+	"github.com/owlpinetech/pixi/read"
+)
+
+func TestSpillWriterRandomOrder(t *testing.T) {
+	for _, separated := range []bool{false, true} {
+		header := pixi.PixiHeader{Version: pixi.Version, OffsetSize: 8, ByteOrder: binary.LittleEndian}
+		layer := pixi.NewLayer("spilled", separated, pixi.CompressionFlate,
+			pixi.DimensionSet{{Name: "x", Size: 13, TileSize: 4}, {Name: "y", Size: 9, TileSize: 5}},
+			[]pixi.Field{{Name: "index", Type: pixi.FieldInt32}, {Name: "scaled", Type: pixi.FieldFloat64}})
+		dir := t.TempDir()
+		writer, err := NewSpillWriter(header, layer, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		coords := make([]pixi.SampleCoordinate, 0, layer.Dimensions.Samples())
+		for coord := range layer.Dimensions.SampleCoordinates() {
+			coords = append(coords, append(pixi.SampleCoordinate{}, coord...))
+		}
+		rand.Shuffle(len(coords), func(i, j int) { coords[i], coords[j] = coords[j], coords[i] })
+		for i, coord := range coords {
+			// leave every tenth sample unset so it reads back as zero
+			if i%10 == 0 {
+				continue
+			}
+			ind := coord.ToSampleIndex(layer.Dimensions)
+			err = writer.SetSampleAt(coord, []any{int32(ind), float64(ind) * 1.5})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		buf := buffer.NewBuffer(10)
+		err = writer.Assemble(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = writer.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+			t.Errorf("expected spill file to be removed, found %d files", len(entries))
+		}
+
+		unset := make(map[pixi.SampleIndex]bool)
+		for i := 0; i < len(coords); i += 10 {
+			unset[coords[i].ToSampleIndex(layer.Dimensions)] = true
+		}
+		rdr := buffer.NewBufferFrom(buf.Bytes())
+		readLayer := &pixi.Layer{}
+		err = readLayer.ReadLayer(rdr, header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for coord, sample := range read.Samples(rdr, header, readLayer) {
+			ind := coord.ToSampleIndex(layer.Dimensions)
+			want := []any{int32(ind), float64(ind) * 1.5}
+			if unset[ind] {
+				want = []any{int32(0), float64(0)}
+			}
+			if sample[0] != want[0] || sample[1] != want[1] {
+				t.Fatalf("expected %v at %v, got %v", want, coord, sample)
+			}
+		}
+	}
+}
+
+func TestSpillWriterRejectsInvalidSamples(t *testing.T) {
+	for _, separated := range []bool{false, true} {
+		header := pixi.PixiHeader{Version: pixi.Version, OffsetSize: 4, ByteOrder: binary.BigEndian}
+		layer := pixi.NewLayer("spilled", separated, pixi.CompressionNone,
+			pixi.DimensionSet{{Name: "x", Size: 6, TileSize: 4}, {Name: "y", Size: 3, TileSize: 2}},
+			[]pixi.Field{{Name: "v", Type: pixi.FieldUint8}, {Name: "w", Type: pixi.FieldUint16}})
+		writer, err := NewSpillWriter(header, layer, t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer writer.Close()
+
+		var format pixi.FormatError
+		for _, coord := range []pixi.SampleCoordinate{{6, 0}, {0, -1}, {1}, {1, 1, 1}} {
+			if err = writer.SetSampleAt(coord, []any{uint8(1), uint16(1)}); !errors.As(err, &format) {
+				t.Errorf("expected setting a sample at %v to be refused, got %v", coord, err)
+			}
+			if err = writer.SetFieldAt(coord, 0, uint8(1)); !errors.As(err, &format) {
+				t.Errorf("expected setting a field at %v to be refused, got %v", coord, err)
+			}
+		}
+		for _, fieldIndex := range []int{-1, 2} {
+			if err = writer.SetFieldAt(pixi.SampleCoordinate{1, 1}, fieldIndex, uint8(1)); !errors.As(err, &format) {
+				t.Errorf("expected setting field %d to be refused, got %v", fieldIndex, err)
+			}
+		}
+		if err = writer.SetSampleAt(pixi.SampleCoordinate{1, 1}, []any{uint8(1)}); !errors.As(err, &format) {
+			t.Errorf("expected a sample missing a field to be refused, got %v", err)
+		}
+		if dirty := writer.DirtyTiles(); len(dirty) != 0 {
+			t.Errorf("expected refused samples to leave no tiles dirty, got %v", dirty)
+		}
+	}
+}
@@ -0,0 +1,521 @@
+package edit
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"sync"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/read"
+)
+
+// How Stitch combines the samples of sources that overlap.
+type StitchBlend int
+
+const (
+	StitchReplace  StitchBlend = iota // Later sources replace earlier ones, giving hard seams.
+	StitchPriority                    // Later sources replace earlier ones, except where their samples are missing (see StitchOptions.NoData).
+	StitchFeather                     // The valid samples of the overlapping sources are averaged, weighted by their distance from the edge of their source.
+)
+
+// Options for Stitch.
+type StitchOptions struct {
+	Layer        string             // The name of the layer to take from each source, or empty for the first layer.
+	Offsets      [][]int            // For each source, the coordinate in the output of its first sample.
+	Origins      [][]float64        // For each source, the georeferenced coordinate of its first sample, used instead of Offsets if they are nil.
+	Blend        StitchBlend        // How overlapping sources are combined.
+	FeatherWidth int                // The number of samples from the edge of a source over which its weight rises to full with StitchFeather.
+	NoData       []float64          // For each field, or once for all of them, the value marking a missing sample, or nil if none is missing. NaN matches NaN.
+	DatumShifts  map[string]float64 // For each datum, the amount added to values measured from it to measure them from the datum of the first source.
+	CacheTiles   int                // The number of tiles of each source held in memory at once, or 0 for a default.
+	Budget       *pixi.MemoryBudget // Bounds the tiles of all sources held in memory by bytes instead of CacheTiles, if not nil.
+	Workers      int                // The number of tiles computed from the samples of the sources at once, see pixi.Workers.
+	Progress     ProgressFunc       // Called after each tile is written, if not nil.
+}
+
+// Combines a layer from each of several Pixi files into a single layer of a new file, placing the first
+// sample of each source at its offset in the options. The output layer is just large enough to hold
+// every source, and samples not covered by any source are the no-data values of the options, or zero.
+// Where sources overlap, later sources replace earlier ones, unless the options blend them instead. The
+// layers must have the same fields and the same number of dimensions, with the same names. The output
+// takes its header, layer name, tiling, and compression from the first source, and combines the file tags
+// of all sources, with later sources replacing the tags of earlier ones. Cancelling the context stops the
+// stitching between tiles.
+//
+// Instead of offsets, the options can give the georeferenced origin of each source, from which the
+// offsets are found using the resolution of each dimension. The sources must then record the same
+// resolution and unit for each dimension, and lie on a common grid of samples.
+//
+// The values of each field of later sources are converted to the unit, scale, offset and datum recorded
+// for the field in the first source (see pixi.FieldValues), converting between units of length, and
+// between datums by the shifts in the options. Sources whose values cannot be converted are rejected
+// rather than mixed with the others.
+//
+// A sample is missing where every field with a no-data value has that value. With StitchPriority, a
+// missing sample of a later source leaves the sample of the next source beneath it showing through. With
+// StitchFeather, the samples of the sources covering each position that are not missing are averaged,
+// each weighted by its distance in samples from the nearest edge of its source, up to FeatherWidth,
+// ignoring edges along the edge of the output; so that sources fade into each other across seams. Where
+// a single source is valid, its sample is used unchanged. Samples are compared with the no-data values
+// as they are stored in each source, before being converted.
+//
+// A tile of the output that lies entirely within a single tile of a source, and is not covered by any
+// later source (nor any other source when blending), is copied without being decoded when the source has
+// the same tiling, compression, field layout, byte order and checksums as the output, and an offset that
+// is a multiple of the tile size; so sources placed on the tile grid of the output are only decoded along
+// the seams where they meet. The other tiles are computed from the samples of the sources on several
+// goroutines at once, reading from different sources in parallel. The output is the same whatever the
+// number of workers.
+func Stitch(ctx context.Context, dst io.WriteSeeker, srcs []io.ReadSeeker, options StitchOptions) error {
+	if len(srcs) == 0 {
+		return pixi.FormatError("no sources to stitch")
+	}
+	if options.Offsets == nil && len(options.Origins) != len(srcs) {
+		return pixi.FormatError("stitching requires an offset or origin for every source")
+	}
+	if options.Offsets != nil && len(options.Offsets) != len(srcs) {
+		return pixi.FormatError("stitching requires an offset for every source")
+	}
+	switch options.Blend {
+	case StitchReplace, StitchPriority:
+	case StitchFeather:
+		if options.FeatherWidth <= 0 {
+			return pixi.FormatError("feathering requires a positive width")
+		}
+	default:
+		return pixi.UnsupportedError("unknown stitch blending")
+	}
+
+	managers := operationCacheManagers(options.CacheTiles, options.Budget)
+	tiles := make([]stitchTile, len(srcs))
+	tags := &pixi.TagSection{}
+	var first pixi.Pixi
+	var firstLayer *pixi.Layer
+	srcPixis := make([]pixi.Pixi, len(srcs))
+	layers := make([]*pixi.Layer, len(srcs))
+	offsets := options.Offsets
+	for i, src := range srcs {
+		srcPixi, err := pixi.ReadPixi(src)
+		if err != nil {
+			return err
+		}
+		layer, err := stitchLayer(srcPixi, options.Layer)
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			first, firstLayer = srcPixi, layer
+		} else if !slices.Equal(layer.Fields, firstLayer.Fields) || !sameDimensionNames(layer.Dimensions, firstLayer.Dimensions) {
+			return pixi.FormatError(fmt.Sprintf("source %d does not have the same fields and dimensions as the first source", i))
+		}
+		srcPixis[i], layers[i] = srcPixi, layer
+	}
+	if offsets == nil {
+		var err error
+		offsets, err = originOffsets(layers, options.Origins)
+		if err != nil {
+			return err
+		}
+	}
+	noData := options.NoData
+	if len(noData) == 1 {
+		noData = slices.Repeat(noData, len(firstLayer.Fields))
+	}
+	if noData != nil && len(noData) != len(firstLayer.Fields) {
+		return pixi.FormatError("stitching requires a no-data value for every field, a single one, or none")
+	}
+	conversions, err := layerConversions(layers, options.DatumShifts)
+	if err != nil {
+		return err
+	}
+
+	for i, src := range srcs {
+		srcPixi, layer := srcPixis[i], layers[i]
+		offset := offsets[i]
+		if len(offset) != len(layer.Dimensions) || (len(offset) > 0 && slices.Min(offset) < 0) {
+			return pixi.FormatError(fmt.Sprintf("offset of source %d must have a non-negative entry for every dimension", i))
+		}
+		for _, section := range srcPixi.Tags {
+			tags.Merge(section)
+		}
+		// the sources are read both through their caches and by copying tiles, from several goroutines
+		reader := concurrentReaderAt(src)
+		cache := read.NewLayerReadCache(io.NewSectionReader(reader, 0, math.MaxInt64), srcPixi.Header, layer, managers())
+		tiles[i] = stitchTile{cache: cache, dims: layer.Dimensions, offset: offset, header: srcPixi.Header, layer: layer, reader: reader, convert: conversions[i]}
+	}
+
+	dims := slices.Clone(firstLayer.Dimensions)
+	for d := range dims {
+		dims[d].Size = 0
+		for _, tile := range tiles {
+			dims[d].Size = max(dims[d].Size, tile.offset[d]+tile.dims[d].Size)
+		}
+		dims[d].TileSize = min(dims[d].TileSize, dims[d].Size)
+	}
+
+	outLayer := deriveLayer(firstLayer, firstLayer.Compression, dims)
+	stitched := &stitcher{
+		tiles:        tiles,
+		dims:         dims,
+		fields:       firstLayer.Fields,
+		blend:        options.Blend,
+		featherWidth: options.FeatherWidth,
+		noData:       noData,
+		fill:         make([]any, len(firstLayer.Fields)),
+	}
+	for i, field := range firstLayer.Fields {
+		stitched.fill[i] = field.Type.Float64ToValue(0)
+		if noData != nil {
+			stitched.fill[i] = field.Type.Float64ToValue(noData[i])
+		}
+	}
+	layer := derivedLayer{
+		layer: outLayer,
+		tile: func(tileIndex int, data []byte) error {
+			return fillDiskTile(outLayer, first.Header.ByteOrder, tileIndex, data, stitched.sampleAt)
+		},
+		encoded: func(tileIndex int) (encodedSource, bool) {
+			return stitchedTileSource(tiles, first.Header, outLayer, tileIndex, options.Blend != StitchReplace)
+		},
+		workers: options.Workers,
+	}
+	return writeDerivedPixi(ctx, dst, first.Header, tags, []derivedLayer{layer}, options.Progress)
+}
+
+// One of the sources being stitched, placed at an offset in the output.
+type stitchTile struct {
+	cache   *read.LayerReadCache
+	dims    pixi.DimensionSet
+	offset  []int
+	header  pixi.PixiHeader
+	layer   *pixi.Layer
+	reader  io.ReaderAt       // Read through a section reader of its own by the cache and by each tile copied.
+	convert []valueConversion // How the values of each field convert to those of the output, or nil if they are the same.
+}
+
+// Computes the samples of the output of Stitch from the sources covering them.
+type stitcher struct {
+	tiles        []stitchTile
+	dims         pixi.DimensionSet
+	fields       pixi.FieldSet
+	blend        StitchBlend
+	featherWidth int
+	noData       []float64
+	fill         []any // The sample where no source has a valid sample.
+}
+
+func (s *stitcher) sampleAt(coord pixi.SampleCoordinate) ([]any, error) {
+	var blended []float64
+	var weights float64
+	var only []any
+	for i := len(s.tiles) - 1; i >= 0; i-- {
+		local, ok := s.tiles[i].local(coord)
+		if !ok {
+			continue
+		}
+		sample, err := s.tiles[i].cache.SampleAt(local)
+		if err != nil {
+			return nil, err
+		}
+		missing := s.missing(sample)
+		if s.blend == StitchReplace && missing {
+			return s.fill, nil
+		}
+		sample = s.tiles[i].converted(sample, s.fields)
+		if s.blend == StitchReplace {
+			return sample, nil
+		}
+		if missing {
+			continue
+		}
+		if s.blend == StitchPriority {
+			return sample, nil
+		}
+
+		weight := s.featherWeight(s.tiles[i], local)
+		if only == nil && blended == nil {
+			only = sample
+		} else if blended == nil {
+			blended = make([]float64, len(s.fields))
+			for f, field := range s.fields {
+				blended[f] = field.Type.ValueToFloat64(only[f]) * weights
+			}
+		}
+		if blended != nil {
+			for f, field := range s.fields {
+				blended[f] += field.Type.ValueToFloat64(sample[f]) * weight
+			}
+		}
+		weights += weight
+	}
+	if blended != nil {
+		sample := make([]any, len(s.fields))
+		for f, field := range s.fields {
+			sample[f] = field.Type.Float64ToValue(blended[f] / weights)
+		}
+		return sample, nil
+	}
+	if only != nil {
+		return only, nil
+	}
+	return s.fill, nil
+}
+
+// Whether every field of the sample with a no-data value has that value.
+func (s *stitcher) missing(sample []any) bool {
+	if s.noData == nil {
+		return false
+	}
+	for f, field := range s.fields {
+		value, noData := field.Type.ValueToFloat64(sample[f]), s.noData[f]
+		if value != noData && !(math.IsNaN(value) && math.IsNaN(noData)) {
+			return false
+		}
+	}
+	return true
+}
+
+// The weight of the sample of a source at a local coordinate when feathering, rising from the edges of the
+// source that are not also edges of the output.
+func (s *stitcher) featherWeight(tile stitchTile, local pixi.SampleCoordinate) float64 {
+	distance := s.featherWidth
+	for d, c := range local {
+		if tile.offset[d] > 0 {
+			distance = min(distance, c+1)
+		}
+		if tile.offset[d]+tile.dims[d].Size < s.dims[d].Size {
+			distance = min(distance, tile.dims[d].Size-c)
+		}
+	}
+	return float64(distance) / float64(s.featherWidth)
+}
+
+// A linear conversion of the stored values of a field.
+type valueConversion struct {
+	scale, offset float64
+}
+
+// Finds how the stored values of each field of each layer convert to the stored values of the same field
+// of the first layer, given what they measure (see pixi.FieldValues). The conversions of a layer are nil
+// if its values need none.
+func layerConversions(layers []*pixi.Layer, datumShifts map[string]float64) ([][]valueConversion, error) {
+	conversions := make([][]valueConversion, len(layers))
+	for f, field := range layers[0].Fields {
+		out, err := pixi.LayerFieldValues(layers[0], field.Name)
+		if err != nil {
+			return nil, err
+		}
+		for i, layer := range layers[1:] {
+			src, err := pixi.LayerFieldValues(layer, field.Name)
+			if err != nil {
+				return nil, fmt.Errorf("source %d: %w", i+1, err)
+			}
+			factor, err := pixi.UnitFactor(src.Unit, out.Unit)
+			if err != nil {
+				return nil, fmt.Errorf("field '%s' of source %d: %w", field.Name, i+1, err)
+			}
+			shift := 0.0
+			if src.Datum != out.Datum {
+				var ok bool
+				if shift, ok = datumShifts[src.Datum]; !ok {
+					return nil, pixi.UnsupportedError(fmt.Sprintf("field '%s' of source %d is measured from datum '%s' rather than '%s', and no shift between them was given",
+						field.Name, i+1, src.Datum, out.Datum))
+				}
+			}
+			convert := valueConversion{
+				scale:  src.Scale * factor / out.Scale,
+				offset: (src.Offset*factor + shift - out.Offset) / out.Scale,
+			}
+			if convert == (valueConversion{scale: 1}) {
+				continue
+			}
+			if conversions[i+1] == nil {
+				conversions[i+1] = slices.Repeat([]valueConversion{{scale: 1}}, len(layers[0].Fields))
+			}
+			conversions[i+1][f] = convert
+		}
+	}
+	return conversions, nil
+}
+
+// Finds the offset of each layer from its origin, the georeferenced coordinate of its first sample, and
+// the resolution of its dimensions. The layers must agree on the resolution and unit of each dimension,
+// and their origins must be a whole number of samples apart.
+func originOffsets(layers []*pixi.Layer, origins [][]float64) ([][]int, error) {
+	first := layers[0].Dimensions
+	positions := make([][]float64, len(layers))
+	for i, layer := range layers {
+		if len(origins[i]) != len(first) {
+			return nil, pixi.FormatError(fmt.Sprintf("origin of source %d must have an entry for every dimension", i))
+		}
+		positions[i] = make([]float64, len(first))
+		for d, dim := range layer.Dimensions {
+			if dim.Resolution <= 0 || dim.Unit != first[d].Unit || math.Abs(dim.Resolution-first[d].Resolution) > 1e-9*first[d].Resolution {
+				return nil, pixi.FormatError(fmt.Sprintf("dimension '%s' of source %d must have the same positive resolution and unit as the first source to place it by its origin", dim.Name, i))
+			}
+			positions[i][d] = origins[i][d] / first[d].Resolution
+			if first[d].Direction == pixi.AxisDecreasing {
+				positions[i][d] = -positions[i][d]
+			}
+		}
+	}
+
+	offsets := make([][]int, len(layers))
+	for i := range offsets {
+		offsets[i] = make([]int, len(first))
+	}
+	for d := range first {
+		least := positions[0][d]
+		for _, position := range positions {
+			least = min(least, position[d])
+		}
+		for i, position := range positions {
+			offset := position[d] - least
+			if math.Abs(offset-math.Round(offset)) > 1e-6 {
+				return nil, pixi.FormatError(fmt.Sprintf("source %d is not on the same grid of samples as the others along dimension '%s'", i, first[d].Name))
+			}
+			offsets[i][d] = int(math.Round(offset))
+		}
+	}
+	return offsets, nil
+}
+
+// Finds the disk tile of a source that a disk tile of the output can be copied from unchanged, if any: the
+// last source covering any of the tile must hold all of it in a single written tile, with the same
+// encoding and the same size, ending where the tile of the output ends. When exclusive, no other source
+// may cover any of the tile either, since its samples would be blended with the copied ones.
+func stitchedTileSource(tiles []stitchTile, header pixi.PixiHeader, out *pixi.Layer, diskTile int, exclusive bool) (encodedSource, bool) {
+	outTiles := out.Dimensions.Tiles()
+	tile, field := diskTile, 0
+	if out.Separated {
+		tile, field = diskTile%outTiles, diskTile/outTiles
+	}
+	start, end := out.Dimensions.TileBounds(tile)
+	for i := len(tiles) - 1; i >= 0; i-- {
+		src := tiles[i]
+		if !src.overlaps(start, end) {
+			continue
+		}
+		contains := true
+		for d := range start {
+			contains = contains && start[d] >= src.offset[d] && end[d] <= src.offset[d]+src.dims[d].Size
+		}
+		if !contains || src.convert != nil || src.layer.Compression != out.Compression || src.layer.Separated != out.Separated ||
+			src.header.ByteOrder != header.ByteOrder || src.header.Checksum != header.Checksum {
+			return encodedSource{}, false
+		}
+		local := make(pixi.SampleCoordinate, len(start))
+		for d, dim := range src.dims {
+			tileSize := out.Dimensions[d].TileSize
+			if dim.TileSize != tileSize || src.offset[d]%tileSize != 0 {
+				return encodedSource{}, false
+			}
+			local[d] = start[d] - src.offset[d]
+			// a tile cut short by the edge of the source must also be cut short by the edge of the output
+			if min(local[d]+tileSize, dim.Size) != end[d]-src.offset[d] {
+				return encodedSource{}, false
+			}
+		}
+		if exclusive {
+			for _, other := range tiles[:i] {
+				if other.overlaps(start, end) {
+					return encodedSource{}, false
+				}
+			}
+		}
+		srcTile := local.ToTileSelector(src.dims).Tile
+		if src.layer.Separated {
+			srcTile += field * src.dims.Tiles()
+		}
+		if src.layer.TileBytes[srcTile] == 0 {
+			return encodedSource{}, false
+		}
+		return encodedSource{layer: src.layer, reader: io.NewSectionReader(src.reader, 0, math.MaxInt64), tile: srcTile}, true
+	}
+	return encodedSource{}, false
+}
+
+// Makes a stream readable from several goroutines at once, at any offset. Streams that are already an
+// io.ReaderAt, such as files, are used as they are; others are read under a lock.
+func concurrentReaderAt(r io.ReadSeeker) io.ReaderAt {
+	if at, ok := r.(io.ReaderAt); ok {
+		return at
+	}
+	return &lockedReaderAt{r: r}
+}
+
+type lockedReaderAt struct {
+	lock sync.Mutex
+	r    io.ReadSeeker
+}
+
+func (l *lockedReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	_, err := l.r.Seek(off, io.SeekStart)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.ReadFull(l.r, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// Converts a coordinate of the output into the coordinate of the same sample in the source, if the
+// source covers it.
+func (t stitchTile) local(coord pixi.SampleCoordinate) (pixi.SampleCoordinate, bool) {
+	local := make(pixi.SampleCoordinate, len(coord))
+	for d, c := range coord {
+		local[d] = c - t.offset[d]
+		if local[d] < 0 || local[d] >= t.dims[d].Size {
+			return nil, false
+		}
+	}
+	return local, true
+}
+
+// Converts a sample of the source to the values of the output.
+func (t stitchTile) converted(sample []any, fields pixi.FieldSet) []any {
+	if t.convert == nil {
+		return sample
+	}
+	converted := make([]any, len(sample))
+	for f, field := range fields {
+		converted[f] = field.Type.Float64ToValue(field.Type.ValueToFloat64(sample[f])*t.convert[f].scale + t.convert[f].offset)
+	}
+	return converted
+}
+
+// Whether the source covers any of the samples from start up to end in the output.
+func (t stitchTile) overlaps(start pixi.SampleCoordinate, end pixi.SampleCoordinate) bool {
+	for d := range start {
+		if start[d] >= t.offset[d]+t.dims[d].Size || end[d] <= t.offset[d] {
+			return false
+		}
+	}
+	return true
+}
+
+func stitchLayer(srcPixi pixi.Pixi, name string) (*pixi.Layer, error) {
+	if len(srcPixi.Layers) == 0 {
+		return nil, pixi.FormatError("source has no layers to stitch")
+	}
+	if name == "" {
+		return srcPixi.Layers[0], nil
+	}
+	for _, layer := range srcPixi.Layers {
+		if layer.Name == name {
+			return layer, nil
+		}
+	}
+	return nil, pixi.FormatError("source has no layer named '" + name + "'")
+}
+
+func sameDimensionNames(a pixi.DimensionSet, b pixi.DimensionSet) bool {
+	return slices.EqualFunc(a, b, func(x pixi.Dimension, y pixi.Dimension) bool { return x.Name == y.Name })
+}
@@ -0,0 +1,319 @@
+package edit
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/internal/buffer"
+)
+
+func TestStitch(t *testing.T) {
+	first := writeIndexedLayer(t, pixi.CompressionNone)
+	second := writeIndexedLayer(t, pixi.CompressionFlate)
+
+	dst := buffer.NewBuffer(20)
+	err := Stitch(context.Background(), dst,
+		[]io.ReadSeeker{buffer.NewBufferFrom(first.Bytes()), buffer.NewBufferFrom(second.Bytes())},
+		StitchOptions{Offsets: [][]int{{0, 0}, {8, 12}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	summary, err := pixi.ReadPixi(buffer.NewBufferFrom(dst.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dims := summary.Layers[0].Dimensions
+	if dims[0].Size != 18 || dims[1].Size != 22 {
+		t.Fatalf("expected an 18x22 layer, got %dx%d", dims[0].Size, dims[1].Size)
+	}
+	if summary.Layers[0].Name != "indexed" || summary.Layers[0].Compression != pixi.CompressionNone {
+		t.Errorf("expected the layer name and compression of the first source, got %s and %v", summary.Layers[0].Name, summary.Layers[0].Compression)
+	}
+
+	cases := []struct {
+		coord pixi.SampleCoordinate
+		want  []any
+	}{
+		{pixi.SampleCoordinate{3, 4}, []any{uint32(43), float32(21.5)}},
+		{pixi.SampleCoordinate{9, 9}, []any{uint32(99), float32(49.5)}},
+		{pixi.SampleCoordinate{9, 12}, []any{uint32(1), float32(0.5)}},
+		{pixi.SampleCoordinate{17, 21}, []any{uint32(99), float32(49.5)}},
+		{pixi.SampleCoordinate{2, 20}, []any{uint32(0), float32(0)}},
+	}
+	for _, c := range cases {
+		if got := freshSample(t, dst, c.coord); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("expected %v at %v, got %v", c.want, c.coord, got)
+		}
+	}
+}
+
+func TestStitchTileAligned(t *testing.T) {
+	srcs := [][]byte{
+		writeIndexedLayer(t, pixi.CompressionFlate).Bytes(),
+		writeIndexedLayer(t, pixi.CompressionFlate).Bytes(),
+		writeIndexedLayer(t, pixi.CompressionFlate).Bytes(),
+	}
+	offsets := [][]int{{0, 0}, {10, 0}, {5, 5}}
+	stitch := func(workers int) []byte {
+		readers := make([]io.ReadSeeker, len(srcs))
+		for i, src := range srcs {
+			readers[i] = buffer.NewBufferFrom(src)
+		}
+		dst := buffer.NewBuffer(20)
+		err := Stitch(context.Background(), dst, readers, StitchOptions{Offsets: offsets, Workers: workers})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return dst.Bytes()
+	}
+
+	out := stitch(1)
+	if !reflect.DeepEqual(out, stitch(8)) {
+		t.Error("expected the same output from one worker and from several")
+	}
+	stitched, err := pixi.ReadPixi(buffer.NewBufferFrom(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	layer := stitched.Layers[0]
+	if dims := layer.Dimensions; dims[0].Size != 20 || dims[1].Size != 15 {
+		t.Fatalf("expected a 20x15 layer, got %dx%d", dims[0].Size, dims[1].Size)
+	}
+
+	// tiles held by one tile of the last source covering them are copied still encoded
+	copied := []struct {
+		tile, src, srcTile int
+	}{{0, 0, 0}, {1, 0, 1}, {5, 2, 0}, {6, 2, 1}, {3, 1, 1}, {9, 2, 2}}
+	for _, c := range copied {
+		srcPixi, err := pixi.ReadPixi(buffer.NewBufferFrom(srcs[c.src]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		srcLayer := srcPixi.Layers[0]
+		want := srcs[c.src][srcLayer.TileOffsets[c.srcTile] : srcLayer.TileOffsets[c.srcTile]+srcLayer.TileBytes[c.srcTile]]
+		got := out[layer.TileOffsets[c.tile] : layer.TileOffsets[c.tile]+layer.TileBytes[c.tile]]
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("expected tile %d to be copied from tile %d of source %d", c.tile, c.srcTile, c.src)
+		}
+	}
+
+	dst := buffer.NewBufferFrom(out)
+	for coord := range layer.Dimensions.SampleCoordinates() {
+		want := []any{uint32(0), float32(0)}
+		for i := len(offsets) - 1; i >= 0; i-- {
+			x, y := coord[0]-offsets[i][0], coord[1]-offsets[i][1]
+			if x >= 0 && x < 10 && y >= 0 && y < 10 {
+				want = []any{uint32(x + 10*y), float32(x+10*y) / 2}
+				break
+			}
+		}
+		if got := freshSample(t, dst, coord); !reflect.DeepEqual(got, want) {
+			t.Fatalf("expected %v at %v, got %v", want, coord, got)
+		}
+	}
+}
+
+func TestStitchMismatchedFields(t *testing.T) {
+	first := writeIndexedLayer(t, pixi.CompressionNone)
+	header := pixi.PixiHeader{Version: pixi.Version, OffsetSize: 4, ByteOrder: binary.BigEndian}
+	other := buffer.NewBuffer(20)
+	err := WriteContiguousTileOrderPixi(other, header, map[string]string{},
+		LayerWriter{
+			Layer: pixi.NewLayer("other", false, pixi.CompressionNone,
+				pixi.DimensionSet{{Name: "x", Size: 4, TileSize: 4}, {Name: "y", Size: 4, TileSize: 4}},
+				[]pixi.Field{{Name: "index", Type: pixi.FieldUint16}}),
+			IterFn: func(layer *pixi.Layer, coord pixi.SampleCoordinate) ([]any, map[string]any) {
+				return []any{uint16(0)}, nil
+			},
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = Stitch(context.Background(), buffer.NewBuffer(20),
+		[]io.ReadSeeker{buffer.NewBufferFrom(first.Bytes()), buffer.NewBufferFrom(other.Bytes())},
+		StitchOptions{Offsets: [][]int{{0, 0}, {10, 0}}})
+	if err == nil {
+		t.Error("expected an error stitching layers with different fields")
+	}
+}
+
+// Writes a 6x4 layer of a single float32 field, tiled 2x2, with samples given by value and the x dimension
+// 0.5 metres a sample from west to east, and y from north to south.
+func writeStitchSource(t *testing.T, value func(x, y int) float32) []byte {
+	t.Helper()
+	return writeMeasuredStitchSource(t, pixi.FieldValues{Scale: 1}, value)
+}
+
+// Writes a layer as writeStitchSource does, recording what its values measure in its tags.
+func writeMeasuredStitchSource(t *testing.T, values pixi.FieldValues, value func(x, y int) float32) []byte {
+	t.Helper()
+	header := pixi.PixiHeader{Version: pixi.Version, OffsetSize: 4, ByteOrder: binary.LittleEndian}
+	layer := pixi.NewLayer("mosaic", false, pixi.CompressionNone,
+		pixi.DimensionSet{
+			{Name: "x", Size: 6, TileSize: 2, Unit: "m", Direction: pixi.AxisIncreasing, Resolution: 0.5},
+			{Name: "y", Size: 4, TileSize: 2, Unit: "m", Direction: pixi.AxisDecreasing, Resolution: 0.5},
+		},
+		[]pixi.Field{{Name: "v", Type: pixi.FieldFloat32}})
+	section := &pixi.TagSection{}
+	values.SetTags(section, "v")
+	if len(section.Tags) > 0 {
+		layer.Tags = []*pixi.TagSection{section}
+	}
+	buf := buffer.NewBuffer(20)
+	err := WriteContiguousTileOrderPixi(buf, header, map[string]string{},
+		LayerWriter{
+			Layer: layer,
+			IterFn: func(layer *pixi.Layer, coord pixi.SampleCoordinate) ([]any, map[string]any) {
+				return []any{value(coord[0], coord[1])}, nil
+			},
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func stitchSources(t *testing.T, srcs [][]byte, options StitchOptions) *buffer.Buffer {
+	t.Helper()
+	readers := make([]io.ReadSeeker, len(srcs))
+	for i, src := range srcs {
+		readers[i] = buffer.NewBufferFrom(src)
+	}
+	dst := buffer.NewBuffer(20)
+	err := Stitch(context.Background(), dst, readers, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dst
+}
+
+func TestStitchPriority(t *testing.T) {
+	west := writeStitchSource(t, func(x, y int) float32 { return 1 })
+	east := writeStitchSource(t, func(x, y int) float32 {
+		if x == 0 {
+			return -9999
+		}
+		return 2
+	})
+	offsets := [][]int{{0, 0}, {3, 1}}
+
+	cases := []struct {
+		blend StitchBlend
+		coord pixi.SampleCoordinate
+		want  float32
+	}{
+		{StitchReplace, pixi.SampleCoordinate{3, 1}, -9999},
+		{StitchReplace, pixi.SampleCoordinate{0, 4}, -9999},
+		{StitchPriority, pixi.SampleCoordinate{3, 1}, 1},
+		{StitchPriority, pixi.SampleCoordinate{3, 0}, 1},
+		{StitchPriority, pixi.SampleCoordinate{4, 1}, 2},
+		{StitchPriority, pixi.SampleCoordinate{3, 4}, -9999},
+		{StitchPriority, pixi.SampleCoordinate{8, 4}, 2},
+		{StitchPriority, pixi.SampleCoordinate{0, 4}, -9999},
+	}
+	for _, c := range cases {
+		dst := stitchSources(t, [][]byte{west, east}, StitchOptions{Offsets: offsets, Blend: c.blend, NoData: []float64{-9999}})
+		if got := freshSample(t, dst, c.coord); got[0] != c.want {
+			t.Errorf("blend %d: expected %v at %v, got %v", c.blend, c.want, c.coord, got[0])
+		}
+	}
+}
+
+func TestStitchFeather(t *testing.T) {
+	west := writeStitchSource(t, func(x, y int) float32 { return 1 })
+	east := writeStitchSource(t, func(x, y int) float32 { return 2 })
+	dst := stitchSources(t, [][]byte{west, east}, StitchOptions{Offsets: [][]int{{0, 0}, {3, 0}}, Blend: StitchFeather, FeatherWidth: 2, Workers: 4})
+
+	// the sources overlap from x=3 to x=5, each fading out towards its inner edge over two samples
+	want := []float32{1, 1, 1, 4.0 / 3, 1.5, 5.0 / 3, 2, 2, 2}
+	for y := range 4 {
+		for x, w := range want {
+			if got := freshSample(t, dst, pixi.SampleCoordinate{x, y}); got[0] != w {
+				t.Errorf("expected %v at (%d, %d), got %v", w, x, y, got[0])
+			}
+		}
+	}
+}
+
+func TestStitchOrigins(t *testing.T) {
+	west := writeStitchSource(t, func(x, y int) float32 { return float32(x + 10*y) })
+	east := writeStitchSource(t, func(x, y int) float32 { return float32(100 + x + 10*y) })
+	srcs := [][]byte{west, east}
+
+	// y decreases from north to south, so the lower origin of the east source is further along y
+	byOrigin := stitchSources(t, srcs, StitchOptions{Origins: [][]float64{{100, 50}, {101.5, 49.5}}, Blend: StitchFeather, FeatherWidth: 2})
+	byOffset := stitchSources(t, srcs, StitchOptions{Offsets: [][]int{{0, 0}, {3, 1}}, Blend: StitchFeather, FeatherWidth: 2})
+	if !reflect.DeepEqual(byOrigin.Bytes(), byOffset.Bytes()) {
+		t.Error("expected placing the sources by their origins to match placing them by the equivalent offsets")
+	}
+
+	err := Stitch(context.Background(), buffer.NewBuffer(20),
+		[]io.ReadSeeker{buffer.NewBufferFrom(west), buffer.NewBufferFrom(east)},
+		StitchOptions{Origins: [][]float64{{100, 50}, {101.2, 50}}})
+	if err == nil || !strings.Contains(err.Error(), "grid") {
+		t.Errorf("expected sources off the grid of samples to be rejected, got %v", err)
+	}
+}
+
+func TestStitchBlendValidation(t *testing.T) {
+	src := writeStitchSource(t, func(x, y int) float32 { return 0 })
+	cases := []StitchOptions{
+		{Offsets: [][]int{{0, 0}, {3, 0}}, Blend: StitchFeather},
+		{Offsets: [][]int{{0, 0}, {3, 0}}, Blend: StitchPriority, NoData: []float64{0, 0}},
+		{Offsets: [][]int{{0, 0}, {3, 0}}, Blend: StitchBlend(9)},
+		{Origins: [][]float64{{0, 0}}},
+	}
+	for _, options := range cases {
+		err := Stitch(context.Background(), buffer.NewBuffer(20),
+			[]io.ReadSeeker{buffer.NewBufferFrom(src), buffer.NewBufferFrom(src)}, options)
+		if err == nil {
+			t.Errorf("expected an error stitching with %+v", options)
+		}
+	}
+}
+
+func TestStitchConvertsValues(t *testing.T) {
+	metres := writeMeasuredStitchSource(t, pixi.FieldValues{Unit: "m", Scale: 1, Datum: "NAVD88"}, func(x, y int) float32 { return 10 })
+	feet := writeMeasuredStitchSource(t, pixi.FieldValues{Unit: "ft", Scale: 0.5, Offset: 2, Datum: "NAVD88"}, func(x, y int) float32 { return 96 })
+	shifted := writeMeasuredStitchSource(t, pixi.FieldValues{Unit: "m", Scale: 1, Datum: "EGM2008"}, func(x, y int) float32 { return 10 })
+
+	// 96 stored is 50 feet, or 15.24 metres
+	dst := stitchSources(t, [][]byte{metres, feet}, StitchOptions{Offsets: [][]int{{0, 0}, {6, 0}}})
+	if got := freshSample(t, dst, pixi.SampleCoordinate{2, 2}); got[0] != float32(10) {
+		t.Errorf("expected the first source unchanged, got %v", got[0])
+	}
+	if got := freshSample(t, dst, pixi.SampleCoordinate{8, 2}); got[0] != float32(15.24) {
+		t.Errorf("expected feet converted to metres, got %v", got[0])
+	}
+	summary, err := pixi.ReadPixi(buffer.NewBufferFrom(dst.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values, err := pixi.LayerFieldValues(summary.Layers[0], "v"); err != nil || values.Unit != "m" || values.Datum != "NAVD88" {
+		t.Errorf("expected the output to measure what the first source does, got %+v (%v)", values, err)
+	}
+
+	err = Stitch(context.Background(), buffer.NewBuffer(20),
+		[]io.ReadSeeker{buffer.NewBufferFrom(metres), buffer.NewBufferFrom(shifted)}, StitchOptions{Offsets: [][]int{{0, 0}, {6, 0}}})
+	if err == nil || !strings.Contains(err.Error(), "EGM2008") {
+		t.Errorf("expected different datums without a shift to be rejected, got %v", err)
+	}
+	dst = stitchSources(t, [][]byte{metres, shifted}, StitchOptions{Offsets: [][]int{{0, 0}, {6, 0}}, DatumShifts: map[string]float64{"EGM2008": -0.5}})
+	if got := freshSample(t, dst, pixi.SampleCoordinate{8, 2}); got[0] != float32(9.5) {
+		t.Errorf("expected the datum shift to be applied, got %v", got[0])
+	}
+
+	unitless := writeStitchSource(t, func(x, y int) float32 { return 10 })
+	err = Stitch(context.Background(), buffer.NewBuffer(20),
+		[]io.ReadSeeker{buffer.NewBufferFrom(metres), buffer.NewBufferFrom(unitless)}, StitchOptions{Offsets: [][]int{{0, 0}, {6, 0}}})
+	if err == nil {
+		t.Error("expected values of an unknown unit to be rejected rather than mixed with metres")
+	}
+}
@@ -0,0 +1,292 @@
+package edit
+
+import (
+	"io"
+
+	"github.com/owlpinetech/pixi"
+)
+
+// A stateful iterator that writes every sample of a layer in tile order, buffering one tile at a time
+// and writing it to the stream as soon as iteration moves past it. The iterator can be moved forward
+// with SeekTo and SkipTile; samples that are passed over are left as zeros, and tiles that are passed
+// over entirely are written as zero-filled tiles without any per-sample work. Samples in the padding of
+// partial tiles at the edges of the layer, beyond the size of some dimension, are never visited, and are
+// written as zeros or as the sample given to FillPadding. Both contiguous and separated layers are
+// supported.
+type TileOrderWriteIterator struct {
+	backing     io.WriteSeeker
+	header      pixi.PixiHeader
+	layer       *pixi.Layer
+	layerOffset int64
+	next        pixi.TileSelector
+	cur         pixi.TileSelector
+	valid       bool
+	written     int      // the number of tiles that have been written to the stream so far
+	tileData    [][]byte // one disk tile per field for separated layers, otherwise just one
+	offsets     []int    // the byte offset of each field within a sample of a contiguous tile
+	padding     []any    // the sample written in the padding of edge tiles, or nil for zeros
+	edgeTile    int      // the last tile checked for padding by inPadding, and whether it has any
+	edge        bool
+	sync        syncPolicy
+	err         error
+
+	// The coordinate of the sample at coordOf, reused across samples and advanced in place by
+	// Coordinate, so that visiting huge layers allocates nothing per sample.
+	coord   pixi.SampleCoordinate
+	inTile  []int
+	coordOf pixi.TileSelector
+}
+
+// Writes the header of the layer at the current stream position and creates an iterator positioned
+// before the first sample of the layer. Done must be called once writing is finished.
+func NewTileOrderWriteIterator(w io.WriteSeeker, header pixi.PixiHeader, layer *pixi.Layer) (*TileOrderWriteIterator, error) {
+	layerOffset, err := w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	err = layer.WriteHeader(w, header)
+	if err != nil {
+		return nil, err
+	}
+	diskTilesPerTile := 1
+	if layer.Separated {
+		diskTilesPerTile = len(layer.Fields)
+	}
+	it := &TileOrderWriteIterator{
+		backing:     w,
+		header:      header,
+		layer:       layer,
+		layerOffset: layerOffset,
+		edgeTile:    -1,
+		tileData:    make([][]byte, diskTilesPerTile),
+		offsets:     make([]int, len(layer.Fields)),
+		coord:       make(pixi.SampleCoordinate, len(layer.Dimensions)),
+		inTile:      make([]int, len(layer.Dimensions)),
+	}
+	for i := range it.tileData {
+		it.tileData[i] = make([]byte, layer.DiskTileSize(layer.Dimensions.Tiles()*i))
+	}
+	for i := 1; i < len(layer.Fields); i++ {
+		it.offsets[i] = it.offsets[i-1] + layer.Fields[i-1].Size()
+	}
+	return it, nil
+}
+
+// Advances the iterator to the next sample, writing out the tiles that iteration has moved past.
+// Returns false once every sample has been visited or if writing a tile failed, in which case Err
+// reports the failure.
+func (it *TileOrderWriteIterator) Next() bool {
+	for it.next.Tile < it.layer.Dimensions.Tiles() && it.inPadding(it.next) {
+		it.advance()
+	}
+	if it.err != nil || it.next.Tile >= it.layer.Dimensions.Tiles() {
+		it.valid = false
+		return false
+	}
+	err := it.writeUntil(it.next.Tile)
+	if err != nil {
+		it.err = err
+		it.valid = false
+		return false
+	}
+	it.cur = it.next
+	it.valid = true
+	it.advance()
+	return true
+}
+
+// Sets the values of every field that the padding of partial tiles at the edges of the layer is filled
+// with, such as the no-data value of each field, in place of zeros. The values must be of the Go types
+// corresponding to each field's type. Applies to every tile not yet written.
+func (it *TileOrderWriteIterator) FillPadding(sample []any) {
+	it.padding = sample
+}
+
+// Reports whether the selected sample lies in the padding of a partial tile, only checking the samples of
+// tiles that have padding at all, which the last sample of a tile is beyond exactly when it does.
+func (it *TileOrderWriteIterator) inPadding(selector pixi.TileSelector) bool {
+	dims := it.layer.Dimensions
+	if selector.Tile != it.edgeTile {
+		it.edgeTile = selector.Tile
+		it.edge = !(pixi.TileSelector{Tile: selector.Tile, InTile: dims.TileSamples() - 1}).InBounds(dims)
+	}
+	return it.edge && !selector.InBounds(dims)
+}
+
+// Moves the position of the following sample on by one, into the next tile once the current one is done.
+func (it *TileOrderWriteIterator) advance() {
+	it.next.InTile += 1
+	if it.next.InTile >= it.layer.Dimensions.TileSamples() {
+		it.next = pixi.TileSelector{Tile: it.next.Tile + 1, InTile: 0}
+	}
+}
+
+// Positions the iterator so that the following call to Next visits the sample at the given coordinate.
+// Since tiles are written as soon as iteration leaves them, the coordinate must not lie in a tile that
+// has already been written.
+func (it *TileOrderWriteIterator) SeekTo(coord pixi.SampleCoordinate) error {
+	if len(coord) != len(it.layer.Dimensions) {
+		return pixi.FormatError("seek coordinate does not match the number of layer dimensions")
+	}
+	for i, c := range coord {
+		if c < 0 || c >= it.layer.Dimensions[i].Size {
+			return pixi.FormatError("seek coordinate is outside the layer")
+		}
+	}
+	selector := coord.ToTileSelector(it.layer.Dimensions)
+	if selector.Tile < it.written {
+		return pixi.UnsupportedError("cannot seek a write iterator back to a tile that has already been written")
+	}
+	it.next = selector
+	it.valid = false
+	return nil
+}
+
+// Skips the remaining samples in the tile of the current sample, leaving them as zeros, so that the
+// following call to Next visits the first sample of the next tile. If Next has not been called since the
+// iterator was created or repositioned with SeekTo, the whole tile that would have been visited next is
+// skipped instead.
+func (it *TileOrderWriteIterator) SkipTile() {
+	if it.valid {
+		it.next = pixi.TileSelector{Tile: it.cur.Tile + 1, InTile: 0}
+	} else {
+		it.next = pixi.TileSelector{Tile: it.next.Tile + 1, InTile: 0}
+	}
+	it.valid = false
+}
+
+// The coordinate of the current sample. Only meaningful after Next has returned true. The coordinate is
+// updated in place as the iterator moves, so callers that keep it past the next call to Next must
+// clone it.
+func (it *TileOrderWriteIterator) Coordinate() pixi.SampleCoordinate {
+	if it.cur != it.coordOf {
+		if it.cur.Tile == it.coordOf.Tile && it.cur.InTile == it.coordOf.InTile+1 {
+			it.advanceCoordinate()
+		} else {
+			it.locateCoordinate()
+		}
+		it.coordOf = it.cur
+	}
+	return it.coord
+}
+
+// Moves the reused coordinate on to the following sample within the same tile, carrying into the next
+// dimension whenever one wraps around, as iteration in tile order does.
+func (it *TileOrderWriteIterator) advanceCoordinate() {
+	for dim, d := range it.layer.Dimensions {
+		it.inTile[dim] += 1
+		it.coord[dim] += 1
+		if it.inTile[dim] < d.TileSize {
+			return
+		}
+		it.coord[dim] -= it.inTile[dim]
+		it.inTile[dim] = 0
+	}
+}
+
+// Recomputes the reused coordinate from the current tile selector, after the iterator jumped with SeekTo
+// or SkipTile or moved to another tile.
+func (it *TileOrderWriteIterator) locateCoordinate() {
+	tileIndex, inTileIndex := it.cur.Tile, it.cur.InTile
+	for dim, d := range it.layer.Dimensions {
+		tiles := d.Tiles()
+		it.inTile[dim] = inTileIndex % d.TileSize
+		it.coord[dim] = (tileIndex%tiles)*d.TileSize + it.inTile[dim]
+		tileIndex /= tiles
+		inTileIndex /= d.TileSize
+	}
+}
+
+// Sets the values of every field of the current sample. The values must be of the Go types
+// corresponding to each field's type.
+func (it *TileOrderWriteIterator) SetSample(sample []any) {
+	for fieldIndex := range it.layer.Fields {
+		it.SetField(fieldIndex, sample[fieldIndex])
+	}
+}
+
+// Sets the value of a single field of the current sample.
+func (it *TileOrderWriteIterator) SetField(fieldIndex int, value any) {
+	it.setValue(it.cur.InTile, fieldIndex, value)
+}
+
+// Encodes the value of a field of the sample at the given index within the buffered tile.
+func (it *TileOrderWriteIterator) setValue(inTile int, fieldIndex int, value any) {
+	field := it.layer.Fields[fieldIndex]
+	if it.layer.Separated {
+		field.ValueToBytes(value, it.tileData[fieldIndex][inTile*field.Size():], it.header.ByteOrder)
+		return
+	}
+	offset := inTile*it.layer.SampleSize() + it.offsets[fieldIndex]
+	field.ValueToBytes(value, it.tileData[0][offset:], it.header.ByteOrder)
+}
+
+// Fills the padding of the buffered tile with the padding sample, if the tile is a partial one at the edge
+// of the layer.
+func (it *TileOrderWriteIterator) fillPadding(tileIndex int) {
+	if it.padding == nil || !it.inPadding(pixi.TileSelector{Tile: tileIndex, InTile: it.layer.Dimensions.TileSamples() - 1}) {
+		return
+	}
+	for inTile := range it.layer.Dimensions.TileSamples() {
+		if !it.inPadding(pixi.TileSelector{Tile: tileIndex, InTile: inTile}) {
+			continue
+		}
+		for fieldIndex, value := range it.padding {
+			it.setValue(inTile, fieldIndex, value)
+		}
+	}
+}
+
+// The error that stopped iteration, if any.
+func (it *TileOrderWriteIterator) Err() error {
+	return it.err
+}
+
+// Sets the options controlling when the backing stream is synced to stable storage. Returns an
+// error if syncing is requested but the backing stream does not implement Syncer.
+func (it *TileOrderWriteIterator) SetDurability(durability Durability) error {
+	policy, err := newSyncPolicy(it.backing, durability)
+	if err != nil {
+		return err
+	}
+	it.sync = policy
+	return nil
+}
+
+// Writes every tile not yet written (the ones never reached being zero-filled), then rewrites the layer
+// header with the final tile offsets. The stream is left positioned at the end of the layer data.
+func (it *TileOrderWriteIterator) Done() error {
+	if it.err != nil {
+		return it.err
+	}
+	err := it.writeUntil(it.layer.Dimensions.Tiles())
+	if err != nil {
+		it.err = err
+		return err
+	}
+	err = it.layer.OverwriteHeader(it.backing, it.header, it.layerOffset)
+	if err != nil {
+		return err
+	}
+	return it.sync.finished()
+}
+
+// Writes the buffered tile and any tiles after it, up to but not including the given tile index.
+func (it *TileOrderWriteIterator) writeUntil(tileIndex int) error {
+	for it.written < tileIndex {
+		it.fillPadding(it.written)
+		for i, data := range it.tileData {
+			err := it.layer.WriteTile(it.backing, it.header, it.written+it.layer.Dimensions.Tiles()*i, data)
+			if err != nil {
+				return err
+			}
+			clear(data)
+		}
+		it.written += 1
+		err := it.sync.tilesWritten(1)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package edit
+
+import (
+	"encoding/binary"
+	"io"
+	"slices"
+	"testing"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/internal/buffer"
+	"github.com/owlpinetech/pixi/read"
+)
+
+func TestTileOrderWriteIteratorSeekAndSkip(t *testing.T) {
+	for _, separated := range []bool{false, true} {
+		header := pixi.PixiHeader{Version: pixi.Version, OffsetSize: 8, ByteOrder: binary.LittleEndian}
+		layer := pixi.NewLayer("written", separated, pixi.CompressionFlate,
+			pixi.DimensionSet{{Name: "x", Size: 9, TileSize: 3}, {Name: "y", Size: 6, TileSize: 3}},
+			[]pixi.Field{{Name: "index", Type: pixi.FieldUint32}, {Name: "neg", Type: pixi.FieldInt8}})
+		buf := buffer.NewBuffer(10)
+		it, err := NewTileOrderWriteIterator(buf, header, layer)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// fill only the first row of every tile, and skip the middle tile of the second row entirely
+		skipped := func(coord pixi.SampleCoordinate) bool {
+			tile := coord.ToTileCoordinate(layer.Dimensions)
+			return tile.InTile[1] != 0 || (tile.Tile[0] == 1 && tile.Tile[1] == 1)
+		}
+		for it.Next() {
+			coord := it.Coordinate()
+			tile := coord.ToTileCoordinate(layer.Dimensions)
+			if tile.Tile[0] == 1 && tile.Tile[1] == 1 {
+				it.SkipTile()
+				continue
+			}
+			if skipped(coord) {
+				continue
+			}
+			ind := coord.ToSampleIndex(layer.Dimensions)
+			it.SetSample([]any{uint32(ind), int8(-ind)})
+		}
+		if err := it.SeekTo(pixi.SampleCoordinate{0, 0}); err == nil {
+			t.Error("expected seeking back to a written tile to fail")
+		}
+		err = it.Done()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rdr := buffer.NewBufferFrom(buf.Bytes())
+		readLayer := &pixi.Layer{}
+		err = readLayer.ReadLayer(rdr, header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		readIt := read.NewTileOrderReadIterator(rdr, header, readLayer)
+		for readIt.Next() {
+			coord := readIt.Coordinate()
+			want := []any{uint32(0), int8(0)}
+			if !skipped(coord) {
+				ind := coord.ToSampleIndex(layer.Dimensions)
+				want = []any{uint32(ind), int8(-ind)}
+			}
+			got := readIt.Sample()
+			if got[0] != want[0] || got[1] != want[1] {
+				t.Fatalf("expected %v at %v, got %v", want, coord, got)
+			}
+		}
+		if readIt.Err() != nil {
+			t.Fatal(readIt.Err())
+		}
+	}
+}
+
+func TestTileOrderWriteIteratorCoordinates(t *testing.T) {
+	header := pixi.PixiHeader{Version: pixi.Version, OffsetSize: 4, ByteOrder: binary.BigEndian}
+	layer := pixi.NewLayer("coords", false, pixi.CompressionNone,
+		pixi.DimensionSet{{Name: "x", Size: 5, TileSize: 2}, {Name: "y", Size: 4, TileSize: 3}, {Name: "z", Size: 3, TileSize: 2}},
+		[]pixi.Field{{Name: "v", Type: pixi.FieldUint8}})
+	it, err := NewTileOrderWriteIterator(&discardSeeker{}, header, layer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = it.SeekTo(pixi.SampleCoordinate{3, 1, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	visited := 0
+	for it.Next() {
+		want := it.cur.ToTileCoordinate(layer.Dimensions).ToSampleCoordinate(layer.Dimensions)
+		if got := it.Coordinate(); !slices.Equal(got, want) {
+			t.Fatalf("expected coordinate %v, got %v", want, got)
+		}
+		if visited++; visited%7 == 0 {
+			it.SkipTile()
+		}
+	}
+}
+
+func TestTileOrderWriteIteratorFillsPadding(t *testing.T) {
+	for _, separated := range []bool{false, true} {
+		header := pixi.PixiHeader{Version: pixi.Version, OffsetSize: 4, ByteOrder: binary.BigEndian}
+		layer := pixi.NewLayer("padded", separated, pixi.CompressionFlate,
+			pixi.DimensionSet{{Name: "x", Size: 5, TileSize: 4}, {Name: "y", Size: 3, TileSize: 2}},
+			[]pixi.Field{{Name: "v", Type: pixi.FieldUint16}, {Name: "f", Type: pixi.FieldFloat32}})
+		buf := buffer.NewBuffer(10)
+		it, err := NewTileOrderWriteIterator(buf, header, layer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		it.FillPadding([]any{uint16(65535), float32(-9999)})
+		visited := 0
+		for it.Next() {
+			coord := it.Coordinate()
+			if coord[0] >= 5 || coord[1] >= 3 {
+				t.Fatalf("expected padding not to be visited, got %v", coord)
+			}
+			visited++
+			it.SetSample([]any{uint16(coord.ToSampleIndex(layer.Dimensions)), float32(1)})
+		}
+		if visited != layer.Dimensions.Samples() {
+			t.Errorf("expected %d samples to be visited, got %d", layer.Dimensions.Samples(), visited)
+		}
+		err = it.Done()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rdr := buffer.NewBufferFrom(buf.Bytes())
+		readLayer := &pixi.Layer{}
+		err = readLayer.ReadLayer(rdr, header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		readIt := read.NewTileOrderReadIterator(rdr, header, readLayer)
+		for readIt.Next() {
+			coord := readIt.Coordinate()
+			want := []any{uint16(65535), float32(-9999)}
+			if coord[0] < 5 && coord[1] < 3 {
+				want = []any{uint16(coord.ToSampleIndex(layer.Dimensions)), float32(1)}
+			}
+			if got := readIt.Sample(); got[0] != want[0] || got[1] != want[1] {
+				t.Fatalf("expected %v at %v, got %v", want, coord, got)
+			}
+		}
+		if readIt.Err() != nil {
+			t.Fatal(readIt.Err())
+		}
+	}
+}
+
+// Discards everything written to it, keeping track of the position as a file would.
+type discardSeeker struct {
+	pos int64
+	end int64
+}
+
+func (d *discardSeeker) Write(p []byte) (int, error) {
+	d.pos += int64(len(p))
+	d.end = max(d.end, d.pos)
+	return len(p), nil
+}
+
+func (d *discardSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += d.pos
+	case io.SeekEnd:
+		offset += d.end
+	}
+	d.pos = offset
+	return offset, nil
+}
+
+// Writes the samples of a layer of over a billion samples, visiting b.N of them in tile order, and
+// reports the allocations made per sample by Next, Coordinate, and SetField.
+func BenchmarkTileOrderWriteIterator(b *testing.B) {
+	header := pixi.PixiHeader{Version: pixi.Version, OffsetSize: 8, ByteOrder: binary.LittleEndian}
+	layer := pixi.NewLayer("huge", false, pixi.CompressionNone,
+		pixi.DimensionSet{{Name: "x", Size: 32768, TileSize: 1024}, {Name: "y", Size: 32768, TileSize: 1024}},
+		[]pixi.Field{{Name: "x", Type: pixi.FieldUint16}, {Name: "y", Type: pixi.FieldUint16}})
+	it, err := NewTileOrderWriteIterator(&discardSeeker{}, header, layer)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		if !it.Next() {
+			b.Fatal("expected more samples than iterations")
+		}
+		coord := it.Coordinate()
+		it.SetField(1, uint16(coord[1]))
+	}
+}
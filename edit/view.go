@@ -0,0 +1,322 @@
+package edit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"slices"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/read"
+)
+
+// The number of tiles of the source layer of a view kept decoded in memory while tiles of the view are
+// extracted from them.
+const viewCacheTiles = 16
+
+// A virtual layer whose samples are taken from a source layer through a chain of transforms (windowing,
+// slicing, selecting channels and casting field types) applied lazily as it is read, so that a part of a
+// layer can be exported as an image, summarized or otherwise read without an intermediate file. The view
+// is an uncompressed layer, described by Layer, stored in a stream that the view itself implements: its
+// tiles are extracted from the tiles of the source as they are read, so that the view and its Layer can be
+// passed to anything that reads a layer from a stream (LayerAsImage, a read.LayerReadCache, and so on).
+// Transforms return a new view and can be chained in any order; however many there are, each sample of a
+// view is read directly from the source. Samples taken from tiles of the source that were never written
+// are zero. Like other streams, a view must not be read from more than one goroutine at a time.
+type LayerView struct {
+	Layer   *pixi.Layer // The layer of the view, uncompressed and without tags.
+	header  pixi.PixiHeader
+	src     *pixi.Layer
+	backing io.ReadSeeker
+	cache   *read.LayerReadCache
+	coord   func(pixi.SampleCoordinate) pixi.SampleCoordinate // The source coordinate of a sample of the view.
+	fields  []int                                             // The source field of each field of the view.
+	pos     int64
+	size    int64
+	loaded  int    // The disk tile of the view held in chunk, or -1.
+	chunk   []byte // The data and checksum of the loaded disk tile.
+}
+
+// Creates a view of the whole src layer, stored in r, to apply transforms to.
+func NewLayerView(r io.ReadSeeker, header pixi.PixiHeader, src *pixi.Layer) *LayerView {
+	fields := make([]int, len(src.Fields))
+	for i := range fields {
+		fields[i] = i
+	}
+	base := &LayerView{
+		header:  header,
+		src:     src,
+		backing: r,
+		cache:   read.NewLayerReadCache(r, header, src, read.NewLfuCacheManager(viewCacheTiles)),
+		coord:   func(coord pixi.SampleCoordinate) pixi.SampleCoordinate { return coord },
+	}
+	return base.derive(src.Dimensions, src.Fields, fields, base.coord)
+}
+
+// Creates a view of the samples of a layer at fixed positions along some of its dimensions, such as the
+// 2D slice at z=5 and t=12 of a four-dimensional data cube, as with LayerView.Slice.
+func SliceLayer(r io.ReadSeeker, header pixi.PixiHeader, src *pixi.Layer, fixedAxes map[int]int) (*LayerView, error) {
+	return NewLayerView(r, header, src).Slice(fixedAxes)
+}
+
+// Returns a view of the samples of this view with coordinates at least start and less than end in every
+// dimension, with the sample at start becoming the first sample of the new view.
+func (v *LayerView) Window(start pixi.SampleCoordinate, end pixi.SampleCoordinate) (*LayerView, error) {
+	if len(start) != len(v.Layer.Dimensions) || len(end) != len(v.Layer.Dimensions) {
+		return nil, pixi.FormatError("window does not match the number of layer dimensions")
+	}
+	dims := make(pixi.DimensionSet, len(v.Layer.Dimensions))
+	for i, dim := range v.Layer.Dimensions {
+		if start[i] < 0 || end[i] > dim.Size || start[i] >= end[i] {
+			return nil, pixi.FormatError("window is empty or outside the layer")
+		}
+		dim.Size = end[i] - start[i]
+		dim.TileSize = min(dim.TileSize, dim.Size)
+		dims[i] = dim
+	}
+	start = slices.Clone(start)
+	coord := func(coord pixi.SampleCoordinate) pixi.SampleCoordinate {
+		shifted := make(pixi.SampleCoordinate, len(coord))
+		for i := range coord {
+			shifted[i] = coord[i] + start[i]
+		}
+		return v.coord(shifted)
+	}
+	return v.derive(dims, v.Layer.Fields, v.fields, coord), nil
+}
+
+// Returns a view of the samples of this view at fixed positions along some of its dimensions. fixedAxes
+// maps the indices of the dimensions to fix to the coordinate to fix each one at. At least one dimension
+// must be left free; the dimensions left free become the dimensions of the new view, in their order.
+func (v *LayerView) Slice(fixedAxes map[int]int) (*LayerView, error) {
+	fixed := make(pixi.SampleCoordinate, len(v.Layer.Dimensions))
+	for axis, coord := range fixedAxes {
+		if axis < 0 || axis >= len(v.Layer.Dimensions) {
+			return nil, pixi.FormatError("fixed axis is not a dimension of the layer")
+		}
+		if coord < 0 || coord >= v.Layer.Dimensions[axis].Size {
+			return nil, pixi.FormatError("fixed coordinate is outside the layer")
+		}
+		fixed[axis] = coord
+	}
+	free := []int{}
+	dims := pixi.DimensionSet{}
+	for axis, dim := range v.Layer.Dimensions {
+		if _, ok := fixedAxes[axis]; !ok {
+			free = append(free, axis)
+			dims = append(dims, dim)
+		}
+	}
+	if len(free) == 0 {
+		return nil, pixi.FormatError("a slice must leave at least one dimension free")
+	}
+	coord := func(coord pixi.SampleCoordinate) pixi.SampleCoordinate {
+		full := slices.Clone(fixed)
+		for j, axis := range free {
+			full[axis] = coord[j]
+		}
+		return v.coord(full)
+	}
+	return v.derive(dims, v.Layer.Fields, v.fields, coord), nil
+}
+
+// Returns a view of the given channels (field indices) of this view, in the order given.
+func (v *LayerView) Channels(channels []int) (*LayerView, error) {
+	if len(channels) == 0 {
+		return nil, pixi.FormatError("a view must keep at least one channel")
+	}
+	fields := make([]pixi.Field, len(channels))
+	srcFields := make([]int, len(channels))
+	for i, channel := range channels {
+		if channel < 0 || channel >= len(v.Layer.Fields) {
+			return nil, pixi.FormatError("channel index is outside the fields of the layer")
+		}
+		fields[i] = v.Layer.Fields[channel]
+		srcFields[i] = v.fields[channel]
+	}
+	return v.derive(v.Layer.Dimensions, fields, srcFields, v.coord), nil
+}
+
+// Returns a view of this view with the field at the given index converted to another type, as with
+// pixi.FieldType.Float64ToValue: integer values are rounded and clamped to the range of the new type.
+func (v *LayerView) Cast(fieldIndex int, fieldType pixi.FieldType) (*LayerView, error) {
+	if fieldIndex < 0 || fieldIndex >= len(v.Layer.Fields) {
+		return nil, pixi.FormatError("field index is outside the fields of the layer")
+	}
+	if fieldType.Size() == 0 {
+		return nil, pixi.UnsupportedError("cannot cast to an unknown field type")
+	}
+	fields := slices.Clone(v.Layer.Fields)
+	fields[fieldIndex].Type = fieldType
+	return v.derive(v.Layer.Dimensions, fields, v.fields, v.coord), nil
+}
+
+// The coordinate in the source layer of a sample of the view.
+func (v *LayerView) SourceCoordinate(coord pixi.SampleCoordinate) pixi.SampleCoordinate {
+	return v.coord(coord)
+}
+
+// Creates a view over the same source with the given layout, laying its tiles out one after another in
+// its stream, each followed by its checksum.
+func (v *LayerView) derive(dims pixi.DimensionSet, fields []pixi.Field, srcFields []int, coord func(pixi.SampleCoordinate) pixi.SampleCoordinate) *LayerView {
+	view := &LayerView{
+		Layer:   pixi.NewLayer(v.src.Name, v.src.Separated, pixi.CompressionNone, dims, fields),
+		header:  v.header,
+		src:     v.src,
+		backing: v.backing,
+		cache:   v.cache,
+		coord:   coord,
+		fields:  srcFields,
+		loaded:  -1,
+	}
+	for diskTile := range view.Layer.DiskTiles() {
+		view.Layer.TileOffsets[diskTile] = view.size
+		view.Layer.TileBytes[diskTile] = int64(view.Layer.DiskTileSize(diskTile))
+		view.size += view.Layer.TileBytes[diskTile] + int64(v.header.Checksum.Size())
+	}
+	return view
+}
+
+// Fills data with the decoded contents of a disk tile of the view, taking each sample from the source.
+func (v *LayerView) readTile(diskTile int, data []byte) error {
+	clear(data)
+	dims := v.Layer.Dimensions
+	tile, fields := diskTile%dims.Tiles(), []int{diskTile / dims.Tiles()}
+	stride := v.Layer.SampleSize()
+	offsets := make([]int, len(v.Layer.Fields))
+	for i := range v.Layer.Fields[1:] {
+		offsets[i+1] = offsets[i] + v.Layer.Fields[i].Size()
+	}
+	if v.Layer.Separated {
+		stride = v.Layer.Fields[fields[0]].Size()
+		offsets[fields[0]] = 0
+	} else {
+		fields = fields[:0]
+		for i := range v.Layer.Fields {
+			fields = append(fields, i)
+		}
+	}
+
+	for inTile := range dims.TileSamples() {
+		coord := pixi.TileSelector{Tile: tile, InTile: inTile}.ToTileCoordinate(dims).ToSampleCoordinate(dims)
+		if !inLayer(dims, coord) {
+			continue
+		}
+		srcCoord := v.coord(coord)
+		for _, fieldIndex := range fields {
+			value, err := v.fieldAt(srcCoord, fieldIndex)
+			if err != nil {
+				return err
+			}
+			v.Layer.Fields[fieldIndex].ValueToBytes(value, data[inTile*stride+offsets[fieldIndex]:], v.header.ByteOrder)
+		}
+	}
+	return nil
+}
+
+// Reads a field of the view from the sample of the source at srcCoord, converting it to the type of the
+// field of the view. Fields in tiles of the source that were never written are zero.
+func (v *LayerView) fieldAt(srcCoord pixi.SampleCoordinate, fieldIndex int) (any, error) {
+	field, srcField := v.Layer.Fields[fieldIndex], v.fields[fieldIndex]
+	srcDiskTile := srcCoord.ToTileSelector(v.src.Dimensions).Tile
+	if v.src.Separated {
+		srcDiskTile += srcField * v.src.Dimensions.Tiles()
+	}
+	if v.src.TileBytes[srcDiskTile] == 0 {
+		return field.BytesToValue(make([]byte, field.Size()), v.header.ByteOrder), nil
+	}
+	value, err := v.cache.FieldAt(srcCoord, srcField)
+	if err != nil {
+		return nil, err
+	}
+	if srcType := v.src.Fields[srcField].Type; field.Type != srcType {
+		value = field.Type.Float64ToValue(srcType.ValueToFloat64(value))
+	}
+	return value, nil
+}
+
+// Reads a sample of the view straight from the source, without laying out the tile of the view it is in.
+func (v *LayerView) sampleAt(coord pixi.SampleCoordinate) ([]any, error) {
+	srcCoord := v.coord(coord)
+	sample := make([]any, len(v.Layer.Fields))
+	for i := range sample {
+		value, err := v.fieldAt(srcCoord, i)
+		if err != nil {
+			return nil, err
+		}
+		sample[i] = value
+	}
+	return sample, nil
+}
+
+// Returns a copy of the view that reads the source through a new cache with the given manager, which
+// unlike the cache of the view may be used from several goroutines at once.
+func (v *LayerView) withCacheManager(manager read.CacheManager[int, []byte]) *LayerView {
+	view := *v
+	view.cache = read.NewLayerReadCache(v.backing, v.header, v.src, manager)
+	view.loaded, view.chunk = -1, nil
+	return &view
+}
+
+func inLayer(dims pixi.DimensionSet, coord pixi.SampleCoordinate) bool {
+	for i, dim := range dims {
+		if coord[i] >= dim.Size {
+			return false
+		}
+	}
+	return true
+}
+
+// Reads from the stream of the view, in which the tiles of Layer are stored.
+func (v *LayerView) Read(p []byte) (int, error) {
+	if v.pos >= v.size {
+		return 0, io.EOF
+	}
+	diskTile, found := slices.BinarySearch(v.Layer.TileOffsets, v.pos)
+	if !found {
+		diskTile -= 1
+	}
+	if v.loaded != diskTile {
+		data := make([]byte, v.Layer.TileBytes[diskTile])
+		err := v.readTile(diskTile, data)
+		if err != nil {
+			return 0, err
+		}
+		buf := bytes.NewBuffer(data)
+		err = v.header.WriteChecksum(buf, v.header.Checksum.Compute(data))
+		if err != nil {
+			return 0, err
+		}
+		v.chunk, v.loaded = buf.Bytes(), diskTile
+	}
+	n := copy(p, v.chunk[v.pos-v.Layer.TileOffsets[diskTile]:])
+	v.pos += int64(n)
+	return n, nil
+}
+
+// Moves the position in the stream of the view, as for io.Seeker.
+func (v *LayerView) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += v.pos
+	case io.SeekEnd:
+		offset += v.size
+	default:
+		return 0, errors.New("pixi: invalid seek whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("pixi: negative seek position")
+	}
+	v.pos = offset
+	return offset, nil
+}
+
+// Writes the view to dst as a Pixi file of its own, with the header of the source file (but no file
+// tags), and a single untagged layer with the given compression.
+func (v *LayerView) Materialize(ctx context.Context, dst io.WriteSeeker, compression pixi.Compression, progress ProgressFunc) error {
+	layer := pixi.NewLayer(v.Layer.Name, v.Layer.Separated, compression, v.Layer.Dimensions, v.Layer.Fields)
+	derived := derivedLayer{layer: layer, tile: v.readTile}
+	return writeDerivedPixi(ctx, dst, v.header, &pixi.TagSection{}, []derivedLayer{derived}, progress)
+}
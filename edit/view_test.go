@@ -0,0 +1,159 @@
+package edit
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/internal/buffer"
+	"github.com/owlpinetech/pixi/read"
+)
+
+func TestSliceLayer(t *testing.T) {
+	header := pixi.PixiHeader{Version: pixi.Version, OffsetSize: 4, ByteOrder: binary.LittleEndian, Checksum: pixi.ChecksumCrc32}
+	buf := buffer.NewBuffer(20)
+	err := WriteContiguousTileOrderPixi(buf, header, map[string]string{},
+		LayerWriter{
+			Layer: pixi.NewLayer("cube", false, pixi.CompressionFlate,
+				pixi.DimensionSet{{Name: "x", Size: 6, TileSize: 4}, {Name: "y", Size: 5, TileSize: 2}, {Name: "z", Size: 4, TileSize: 3}},
+				[]pixi.Field{{Name: "index", Type: pixi.FieldUint32}}),
+			IterFn: func(layer *pixi.Layer, coord pixi.SampleCoordinate) ([]any, map[string]any) {
+				return []any{uint32(coord.ToSampleIndex(layer.Dimensions))}, nil
+			},
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rdr := buffer.NewBufferFrom(buf.Bytes())
+	src, err := pixi.ReadPixi(rdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cube := src.Layers[0]
+
+	// the layer of the slice, stored in r, is read as any other layer would be
+	checkSlice := func(slice *LayerView, r io.ReadSeeker, layer *pixi.Layer) {
+		t.Helper()
+		cache := read.NewLayerReadCache(r, header, layer, read.NewLfuCacheManager(4))
+		for coord := range (Region{Start: make(pixi.SampleCoordinate, len(layer.Dimensions)), End: layerSize(layer)}).Coordinates() {
+			sample, err := cache.SampleAt(coord)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := uint32(slice.SourceCoordinate(coord).ToSampleIndex(cube.Dimensions))
+			if sample[0] != want {
+				t.Fatalf("expected sample %v of the slice to be %d, got %v", coord, want, sample[0])
+			}
+		}
+	}
+
+	slice, err := SliceLayer(rdr, header, cube, map[int]int{2: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(slice.Layer.Dimensions) != 2 || slice.Layer.Dimensions[0].Name != "x" || slice.Layer.Dimensions[1].Name != "y" {
+		t.Fatalf("expected an x by y slice, got %v", slice.Layer.Dimensions)
+	}
+	checkSlice(slice, slice, slice.Layer)
+	img, err := LayerAsImageMapped(slice, header, slice.Layer, ChannelMapping{Channels: map[string]string{"gray": "index"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != 6 || img.Bounds().Dy() != 5 {
+		t.Errorf("expected a 6x5 image of the slice, got %v", img.Bounds())
+	}
+
+	column, err := SliceLayer(rdr, header, cube, map[int]int{0: 5, 2: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSlice(column, column, column.Layer)
+
+	out := buffer.NewBuffer(20)
+	err = slice.Materialize(context.Background(), out, pixi.CompressionNone, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outRdr := buffer.NewBufferFrom(out.Bytes())
+	materialized, err := pixi.ReadPixi(outRdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSlice(slice, outRdr, materialized.Layers[0])
+
+	for _, fixed := range []map[int]int{{3: 0}, {1: 5}, {0: 0, 1: 0, 2: 0}} {
+		if _, err := SliceLayer(rdr, header, cube, fixed); err == nil {
+			t.Errorf("expected an error slicing at %v", fixed)
+		}
+	}
+}
+
+func layerSize(layer *pixi.Layer) pixi.SampleCoordinate {
+	size := make(pixi.SampleCoordinate, len(layer.Dimensions))
+	for i, dim := range layer.Dimensions {
+		size[i] = dim.Size
+	}
+	return size
+}
+
+func TestLayerViewTransforms(t *testing.T) {
+	buf := writeIndexedLayer(t, pixi.CompressionFlate)
+	rdr := buffer.NewBufferFrom(buf.Bytes())
+	src, err := pixi.ReadPixi(rdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, layer := src.Header, src.Layers[0]
+
+	// the halves of a 3 by 4 window starting at 2,5, cast to whole numbers
+	view := NewLayerView(rdr, header, layer)
+	view, err = view.Window(pixi.SampleCoordinate{2, 5}, pixi.SampleCoordinate{5, 9})
+	if err != nil {
+		t.Fatal(err)
+	}
+	view, err = view.Channels([]int{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	view, err = view.Cast(0, pixi.FieldInt16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if view.Layer.Dimensions[0].Size != 3 || view.Layer.Dimensions[1].Size != 4 || len(view.Layer.Fields) != 1 || view.Layer.Fields[0].Type != pixi.FieldInt16 {
+		t.Fatalf("unexpected view layer %v %v", view.Layer.Dimensions, view.Layer.Fields)
+	}
+
+	cache := read.NewLayerReadCache(view, header, view.Layer, read.NewLfuCacheManager(4))
+	for coord := range (Region{Start: pixi.SampleCoordinate{0, 0}, End: layerSize(view.Layer)}).Coordinates() {
+		sample, err := cache.SampleAt(coord)
+		if err != nil {
+			t.Fatal(err)
+		}
+		index := (coord[0] + 2) + (coord[1]+5)*10
+		if want := pixi.FieldInt16.Float64ToValue(float64(index) / 2); sample[0] != want {
+			t.Fatalf("expected sample %v of the view to be %v, got %v", coord, want, sample[0])
+		}
+	}
+
+	// a view reads like any other layer, so statistics and images work on it unchanged
+	stats, err := cache.RegionStats(0, pixi.SampleCoordinate{0, 0}, layerSize(view.Layer), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Min != int16(26) || stats.Max != int16(42) {
+		t.Errorf("expected the view to range from 26 to 42, got %v to %v", stats.Min, stats.Max)
+	}
+	stretched := ChannelMapping{Channels: map[string]string{"gray": "half"}, Stretch: map[string]Stretch{"half": {Min: 0, Max: 50}}}
+	if _, err := LayerAsImageMapped(view, header, view.Layer, stretched); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := view.Window(pixi.SampleCoordinate{0, 0}, pixi.SampleCoordinate{4, 1}); err == nil {
+		t.Error("expected an error for a window outside the view")
+	}
+	if _, err := view.Channels([]int{1}); err == nil {
+		t.Error("expected an error for a channel outside the view")
+	}
+}
@@ -0,0 +1,213 @@
+package pixi
+
+import (
+	"encoding/binary"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// Identifies the kind of an extension section. IDs below FirstApplicationExtension are reserved for
+// extensions defined alongside the format, and the rest are free for applications to use.
+type ExtensionID uint32
+
+// The first extension ID available to applications.
+const FirstApplicationExtension ExtensionID = 1 << 16
+
+// The key of the binary tag holding the extension sections of a file or layer, see Extension.
+const ExtensionsTag = "pixi-extensions"
+
+// A typed section of data added to a file or layer by a feature the format has no place for of its own,
+// such as georeferencing, statistics, palettes or signatures. The extension sections of a file or layer
+// are stored one after the other in the binary tag ExtensionsTag of its tags, each as its ID and the
+// length of its payload, both little endian (4 and 8 bytes), then the payload. Readers that predate
+// extensions see a single binary tag they ignore, and readers that do not know the ID of a section skip
+// it by its length, so new kinds of section never break existing readers.
+type Extension struct {
+	ID      ExtensionID
+	Payload []byte
+}
+
+// The size of the ID and length that precede the payload of each encoded extension section.
+const extensionHeaderSize = 4 + 8
+
+// Encodes extension sections, in order, as stored in the ExtensionsTag binary tag.
+func EncodeExtensions(sections []Extension) []byte {
+	size := 0
+	for _, section := range sections {
+		size += extensionHeaderSize + len(section.Payload)
+	}
+	data := make([]byte, 0, size)
+	for _, section := range sections {
+		data = binary.LittleEndian.AppendUint32(data, uint32(section.ID))
+		data = binary.LittleEndian.AppendUint64(data, uint64(len(section.Payload)))
+		data = append(data, section.Payload...)
+	}
+	return data
+}
+
+// Decodes the extension sections stored in an ExtensionsTag binary tag, in order, whether or not their IDs
+// are registered. Returns a FormatError if the data is cut off in the middle of a section.
+func DecodeExtensions(data []byte) ([]Extension, error) {
+	sections := []Extension{}
+	for len(data) > 0 {
+		if len(data) < extensionHeaderSize {
+			return nil, FormatError("extension section header is cut off")
+		}
+		id := ExtensionID(binary.LittleEndian.Uint32(data))
+		length := binary.LittleEndian.Uint64(data[4:])
+		data = data[extensionHeaderSize:]
+		if length > uint64(len(data)) {
+			return nil, FormatError(fmt.Sprintf("extension section %d is cut off", id))
+		}
+		sections = append(sections, Extension{ID: id, Payload: data[:length:length]})
+		data = data[length:]
+	}
+	return sections, nil
+}
+
+// Returns the extension sections stored in the section's ExtensionsTag, or none if it has no such tag.
+func (t *TagSection) Extensions() ([]Extension, error) {
+	data, ok := t.Binary[ExtensionsTag]
+	if !ok {
+		return []Extension{}, nil
+	}
+	return DecodeExtensions(data)
+}
+
+// Adds an extension section to the ExtensionsTag of the tag section, replacing any section with the same
+// ID. Returns an error if the extensions already stored in the section cannot be decoded.
+func (t *TagSection) SetExtension(section Extension) error {
+	sections, err := t.Extensions()
+	if err != nil {
+		return err
+	}
+	t.SetBinary(ExtensionsTag, EncodeExtensions(replaceExtension(sections, section)))
+	return nil
+}
+
+// Removes the extension section with the given ID from the ExtensionsTag of the tag section, if present,
+// removing the tag entirely once it holds no sections.
+func (t *TagSection) RemoveExtension(id ExtensionID) error {
+	sections, err := t.Extensions()
+	if err != nil {
+		return err
+	}
+	sections = slices.DeleteFunc(sections, func(section Extension) bool { return section.ID == id })
+	if len(sections) == 0 {
+		delete(t.Binary, ExtensionsTag)
+		return nil
+	}
+	t.SetBinary(ExtensionsTag, EncodeExtensions(sections))
+	return nil
+}
+
+// Adds the encoded extension sections to those of the tag section, replacing sections with the same ID.
+// If either side cannot be decoded, the encoded sections replace the tag as a whole.
+func (t *TagSection) mergeExtensions(encoded []byte) {
+	sections, err := t.Extensions()
+	others, otherErr := DecodeExtensions(encoded)
+	if err != nil || otherErr != nil {
+		t.SetBinary(ExtensionsTag, encoded)
+		return
+	}
+	for _, section := range others {
+		sections = replaceExtension(sections, section)
+	}
+	t.SetBinary(ExtensionsTag, EncodeExtensions(sections))
+}
+
+// The extension sections of the file, from all of its tag sections: where several sections have the same
+// ID, the one in the latest tag section wins.
+func (d *Pixi) Extensions() ([]Extension, error) {
+	return mergeExtensions(d.Tags)
+}
+
+// The extension sections of the layer, from all of its tag sections, as with Pixi.Extensions.
+func (l *Layer) Extensions() ([]Extension, error) {
+	return mergeExtensions(l.Tags)
+}
+
+func mergeExtensions(tagSections []*TagSection) ([]Extension, error) {
+	merged := []Extension{}
+	for _, tags := range tagSections {
+		sections, err := tags.Extensions()
+		if err != nil {
+			return nil, err
+		}
+		for _, section := range sections {
+			merged = replaceExtension(merged, section)
+		}
+	}
+	return merged, nil
+}
+
+// Replaces the section with the ID of the given section, or adds it at the end if there is none.
+func replaceExtension(sections []Extension, section Extension) []Extension {
+	if i := slices.IndexFunc(sections, func(s Extension) bool { return s.ID == section.ID }); i >= 0 {
+		sections[i] = section
+		return sections
+	}
+	return append(sections, section)
+}
+
+// Describes a kind of extension section to readers, see RegisterExtension.
+type ExtensionType struct {
+	Name string // A short name for the kind of section, such as "georeference".
+	// Checks that a payload is valid for this kind of section, if set. Used by CheckExtensions.
+	Validate func(payload []byte) error
+}
+
+var (
+	extensionsLock sync.RWMutex
+	extensions     = map[ExtensionID]ExtensionType{}
+)
+
+// Makes a kind of extension section known under the given ID, usually from the init function of the
+// package that reads and writes it. Panics if the type has no name or the ID is already registered.
+func RegisterExtension(id ExtensionID, ext ExtensionType) {
+	extensionsLock.Lock()
+	defer extensionsLock.Unlock()
+	if ext.Name == "" {
+		panic("pixi: extension must have a name")
+	}
+	if existing, exists := extensions[id]; exists {
+		panic(fmt.Sprintf("pixi: extension %d registered twice, as '%s' and '%s'", id, existing.Name, ext.Name))
+	}
+	extensions[id] = ext
+}
+
+// Finds the registered kind of extension section with the given ID.
+func LookupExtension(id ExtensionID) (ExtensionType, bool) {
+	extensionsLock.RLock()
+	defer extensionsLock.RUnlock()
+	ext, ok := extensions[id]
+	return ext, ok
+}
+
+// The IDs of the registered kinds of extension section, in increasing order.
+func RegisteredExtensions() []ExtensionID {
+	extensionsLock.RLock()
+	defer extensionsLock.RUnlock()
+	ids := make([]ExtensionID, 0, len(extensions))
+	for id := range extensions {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// Checks each extension section whose ID is registered with its Validate function, skipping those whose
+// IDs are not registered. Returns a FormatError naming the first invalid section.
+func CheckExtensions(sections []Extension) error {
+	for _, section := range sections {
+		ext, ok := LookupExtension(section.ID)
+		if !ok || ext.Validate == nil {
+			continue
+		}
+		if err := ext.Validate(section.Payload); err != nil {
+			return FormatError(fmt.Sprintf("extension section '%s' (%d) is invalid: %v", ext.Name, section.ID, err))
+		}
+	}
+	return nil
+}
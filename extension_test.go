@@ -0,0 +1,139 @@
+package pixi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/owlpinetech/pixi/internal/buffer"
+)
+
+func TestExtensionsRoundTripAndSkipUnknown(t *testing.T) {
+	header := PixiHeader{Version: Version, OffsetSize: 4, ByteOrder: binary.BigEndian}
+	section := TagSection{}
+	section.Set("author", "someone")
+	for _, ext := range []Extension{
+		{ID: FirstApplicationExtension + 1, Payload: []byte("georeference")},
+		{ID: FirstApplicationExtension + 2, Payload: []byte{}},
+		{ID: FirstApplicationExtension + 1, Payload: []byte("replaced")},
+	} {
+		if err := section.SetExtension(ext); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	buf := buffer.NewBuffer(10)
+	if err := section.Write(buf, header); err != nil {
+		t.Fatal(err)
+	}
+	read := TagSection{}
+	if err := read.Read(buffer.NewBufferFrom(buf.Bytes()), header); err != nil {
+		t.Fatal(err)
+	}
+	sections, err := read.Extensions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sections) != 2 || sections[0].ID != FirstApplicationExtension+1 || !bytes.Equal(sections[0].Payload, []byte("replaced")) ||
+		sections[1].ID != FirstApplicationExtension+2 || len(sections[1].Payload) != 0 {
+		t.Errorf("unexpected extension sections %+v", sections)
+	}
+	if read.Tags["author"] != "someone" {
+		t.Errorf("expected string tags to survive alongside extensions, got %v", read.Tags)
+	}
+
+	// neither section is registered, so checking skips both
+	if err := CheckExtensions(sections); err != nil {
+		t.Errorf("expected unknown sections to be skipped, got %v", err)
+	}
+
+	if err := read.RemoveExtension(FirstApplicationExtension + 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := read.RemoveExtension(FirstApplicationExtension + 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := read.Binary[ExtensionsTag]; ok {
+		t.Errorf("expected the extensions tag to be removed with its last section")
+	}
+}
+
+func TestDecodeExtensionsCutOff(t *testing.T) {
+	data := EncodeExtensions([]Extension{{ID: 7, Payload: []byte("payload")}})
+	for _, cut := range []int{3, extensionHeaderSize + 2} {
+		_, err := DecodeExtensions(data[:cut])
+		var formatErr FormatError
+		if !errors.As(err, &formatErr) {
+			t.Errorf("expected a format error for data cut at %d, got %v", cut, err)
+		}
+	}
+}
+
+func TestExtensionsMergeByID(t *testing.T) {
+	first, second := &TagSection{}, &TagSection{}
+	first.SetExtension(Extension{ID: 1, Payload: []byte("one")})
+	first.SetExtension(Extension{ID: 2, Payload: []byte("two")})
+	second.SetExtension(Extension{ID: 2, Payload: []byte("newer")})
+	second.SetExtension(Extension{ID: 3, Payload: []byte("three")})
+
+	want := []Extension{{ID: 1, Payload: []byte("one")}, {ID: 2, Payload: []byte("newer")}, {ID: 3, Payload: []byte("three")}}
+	equal := func(a, b Extension) bool { return a.ID == b.ID && bytes.Equal(a.Payload, b.Payload) }
+
+	file := Pixi{Tags: []*TagSection{first, second}}
+	got, err := file.Extensions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.EqualFunc(got, want, equal) {
+		t.Errorf("expected later tag sections to win by ID, got %+v", got)
+	}
+
+	merged := &TagSection{}
+	merged.Merge(first)
+	merged.Merge(second)
+	got, err = merged.Extensions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.EqualFunc(got, want, equal) {
+		t.Errorf("expected merged tag sections to keep every extension, got %+v", got)
+	}
+}
+
+func TestRegisterExtension(t *testing.T) {
+	id := FirstApplicationExtension + 100
+	RegisterExtension(id, ExtensionType{Name: "even-length", Validate: func(payload []byte) error {
+		if len(payload)%2 != 0 {
+			return errors.New("odd length")
+		}
+		return nil
+	}})
+	defer func() {
+		extensionsLock.Lock()
+		delete(extensions, id)
+		extensionsLock.Unlock()
+	}()
+
+	if ext, ok := LookupExtension(id); !ok || ext.Name != "even-length" {
+		t.Errorf("expected to find the registered extension, got %+v", ext)
+	}
+	if !slices.Contains(RegisteredExtensions(), id) {
+		t.Errorf("expected %d among registered extensions", id)
+	}
+	if err := CheckExtensions([]Extension{{ID: id, Payload: []byte("ab")}}); err != nil {
+		t.Errorf("expected a valid payload to pass, got %v", err)
+	}
+	var formatErr FormatError
+	if err := CheckExtensions([]Extension{{ID: id, Payload: []byte("abc")}}); !errors.As(err, &formatErr) {
+		t.Errorf("expected an invalid payload to fail with a format error, got %v", err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected registering an ID twice to panic")
+		}
+	}()
+	RegisterExtension(id, ExtensionType{Name: "again"})
+}
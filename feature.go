@@ -0,0 +1,141 @@
+package pixi
+
+import (
+	"fmt"
+	"io"
+	"math/bits"
+	"slices"
+	"strings"
+)
+
+// A set of optional format features a file uses, stored as bit flags in the header from version 3.
+// A file lists the features it uses in one of two sets of its header: required features change how
+// the file must be read, such as encrypted tiles or a new compression, so a reader that lacks any of
+// them fails with a FeatureError rather than returning wrong data; optional features only add to the
+// file, such as extension sections, and readers that lack them may safely ignore them.
+type Features uint32
+
+const (
+	FeatureExtensions       Features = 1 << iota // The file or its layers hold extension sections, see Extension.
+	FeatureTileCompressions                      // Layers record the compression of each tile, see Layer.RecordTileCompressions.
+	FeatureAutoCompression                       // Tiles are stored with CompressionAuto.
+)
+
+// The features this package knows how to read. Files requiring any others are refused by ReadHeader.
+const SupportedFeatures = FeatureExtensions | FeatureTileCompressions | FeatureAutoCompression
+
+var featureNames = map[Features]string{
+	FeatureExtensions:       "extensions",
+	FeatureTileCompressions: "tile compressions",
+	FeatureAutoCompression:  "automatic compression",
+}
+
+// Whether every feature of other is in the set.
+func (f Features) Has(other Features) bool {
+	return f&other == other
+}
+
+// The names of the features in the set, in bit order. Features this package does not know are named
+// by their bit, such as "feature bit 7".
+func (f Features) Names() []string {
+	names := []string{}
+	for f != 0 {
+		bit := Features(1) << bits.TrailingZeros32(uint32(f))
+		if name, ok := featureNames[bit]; ok {
+			names = append(names, name)
+		} else {
+			names = append(names, fmt.Sprintf("feature bit %d", bits.TrailingZeros32(uint32(bit))))
+		}
+		f &^= bit
+	}
+	return names
+}
+
+func (f Features) String() string {
+	if f == 0 {
+		return "none"
+	}
+	return strings.Join(f.Names(), ", ")
+}
+
+// Returned when reading a file that requires features the reader does not support.
+type FeatureError struct {
+	Missing Features // The required features of the file that the reader does not support.
+}
+
+func (e FeatureError) Error() string {
+	return "pixi: file requires features this reader does not support - " + e.Missing.String()
+}
+
+// The features used by the layers and tag sections of a file, which its header must list: the required
+// features, which change how the file is read, and the optional ones, which readers may ignore.
+func UsedFeatures(layers []*Layer, tags []*TagSection) (required Features, optional Features) {
+	for _, layer := range layers {
+		layerRequired, layerOptional := layer.features()
+		required |= layerRequired
+		optional |= layerOptional
+	}
+	for _, section := range tags {
+		optional |= section.features()
+	}
+	return required, optional
+}
+
+// Sets the features of the header to those used by the layers and tag sections of the file it is
+// written for, as given by UsedFeatures. Does nothing before version 3, which has no feature flags.
+func (h *PixiHeader) SetFeatures(layers []*Layer, tags []*TagSection) {
+	if h.Version < 3 {
+		return
+	}
+	h.RequiredFeatures, h.OptionalFeatures = UsedFeatures(layers, tags)
+}
+
+// Adds the features used by the layers and tag sections to those of a header that has already been
+// written at the start of the stream, for content appended to the file, and rewrites the feature flags
+// of the header if any were added. The stream cursor is returned to the position it was at previously.
+// Does nothing before version 3, which has no feature flags.
+func (h *PixiHeader) AddFeatures(w io.WriteSeeker, layers []*Layer, tags []*TagSection) error {
+	required, optional := UsedFeatures(layers, tags)
+	if h.Version < 3 || (h.RequiredFeatures.Has(required) && h.OptionalFeatures.Has(optional)) {
+		return nil
+	}
+	h.RequiredFeatures |= required
+	h.OptionalFeatures |= optional
+
+	oldPos, err := w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	// the two sets of flags come just before the offsets at the end of the header
+	_, err = w.Seek(h.offsetsOffset()-8, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	err = h.Write(w, [2]uint32{uint32(h.RequiredFeatures), uint32(h.OptionalFeatures)})
+	if err != nil {
+		return err
+	}
+	_, err = w.Seek(oldPos, io.SeekStart)
+	return err
+}
+
+func (l *Layer) features() (required Features, optional Features) {
+	// readers without either feature would take the tile data for that of the layer's compression
+	if l.TileCompressions != nil {
+		required |= FeatureTileCompressions
+	}
+	if l.Compression == CompressionAuto || slices.Contains(l.TileCompressions, CompressionAuto) {
+		required |= FeatureAutoCompression
+	}
+	for _, section := range l.Tags {
+		optional |= section.features()
+	}
+	return required, optional
+}
+
+func (t *TagSection) features() Features {
+	if _, ok := t.Binary[ExtensionsTag]; ok {
+		return FeatureExtensions
+	}
+	return 0
+}
@@ -4,6 +4,9 @@ import (
 	"encoding/binary"
 	"io"
 	"math"
+	"slices"
+	"strconv"
+	"strings"
 )
 
 // Describes a set of values in a data set with a common shape. Similar to a field of a record
@@ -33,6 +36,12 @@ func (f Field) WriteValue(raw []byte, val any) {
 	f.Type.WriteValue(raw, val)
 }
 
+// Writes a value of the field's type into the provided byte slice using the given byte order. This
+// is the inverse of BytesToValue.
+func (f Field) ValueToBytes(val any, raw []byte, order binary.ByteOrder) {
+	f.Type.ValueToBytes(val, raw, order)
+}
+
 // Get the size in bytes of this dimension description as it is laid out and written to disk.
 func (d Field) HeaderSize(h PixiHeader) int {
 	return 2 + len([]byte(d.Name)) + 4
@@ -60,6 +69,96 @@ func (d *Field) Read(r io.Reader, h PixiHeader) error {
 	return h.Read(r, &d.Type)
 }
 
+// The fields of a layer, in the order they are stored in each sample. Also referred to as channels
+// when the layer holds image data.
+type FieldSet []Field
+
+// Alternative names under which a field can be found by FieldSet.ByName, keyed by lower case name.
+var fieldAliases = map[string][]string{
+	"r":       {"red"},
+	"red":     {"r"},
+	"g":       {"green"},
+	"green":   {"g"},
+	"b":       {"blue"},
+	"blue":    {"b"},
+	"a":       {"alpha"},
+	"alpha":   {"a"},
+	"y":       {"luma", "yellow"},
+	"luma":    {"y"},
+	"yellow":  {"y"},
+	"c":       {"cyan"},
+	"cyan":    {"c"},
+	"m":       {"magenta"},
+	"magenta": {"m"},
+	"k":       {"black", "key"},
+	"black":   {"k"},
+	"key":     {"k"},
+	"cb":      {"u"},
+	"u":       {"cb"},
+	"cr":      {"v"},
+	"v":       {"cr"},
+	"gray":    {"grey", "l"},
+	"grey":    {"gray", "l"},
+	"l":       {"gray", "grey"},
+}
+
+// Finds the index of the field with the given name. An exact match is preferred, then a case-insensitive
+// match, then a case-insensitive match on a common alias of the name (such as "red" for "r", or "luma"
+// for "Y"). Returns -1 and false if no field matches.
+func (s FieldSet) ByName(name string) (int, bool) {
+	for i, f := range s {
+		if f.Name == name {
+			return i, true
+		}
+	}
+	for i, f := range s {
+		if strings.EqualFold(f.Name, name) {
+			return i, true
+		}
+	}
+	for _, alias := range fieldAliases[strings.ToLower(name)] {
+		for i, f := range s {
+			if strings.EqualFold(f.Name, alias) {
+				return i, true
+			}
+		}
+	}
+	return -1, false
+}
+
+// Checks that the names of the fields are unique, ignoring case, so that every field can be found by
+// name. Anonymous fields (with an empty name) are not checked; see Named.
+func (s FieldSet) Validate() error {
+	for i, f := range s {
+		if f.Name == "" {
+			continue
+		}
+		for _, other := range s[:i] {
+			if strings.EqualFold(f.Name, other.Name) {
+				return FormatError("duplicate field name '" + f.Name + "'")
+			}
+		}
+	}
+	return nil
+}
+
+// Returns a copy of the fields in which every anonymous field is given a name, "field" followed by its
+// index, so that each field can be referred to by name rather than by an assumed position.
+func (s FieldSet) Named() FieldSet {
+	named := slices.Clone(s)
+	for i := range named {
+		if named[i].Name != "" {
+			continue
+		}
+		name := "field" + strconv.Itoa(i)
+		for suffix := 1; slices.ContainsFunc(s, func(f Field) bool { return strings.EqualFold(f.Name, name) }); suffix++ {
+			name = "field" + strconv.Itoa(i) + "_" + strconv.Itoa(suffix)
+		}
+		named[i].Name = name
+	}
+	return named
+}
+
 // Describes the size and interpretation of a field.
 type FieldType uint32
 
@@ -77,6 +176,13 @@ const (
 	FieldFloat64 FieldType = 10 // A 64-bit floating point number.
 )
 
+// Returns every field type this version of the library can read and write, in order of their
+// identifiers. FieldUnknown is not included.
+func SupportedFieldTypes() []FieldType {
+	return []FieldType{FieldInt8, FieldUint8, FieldInt16, FieldUint16, FieldInt32, FieldUint32,
+		FieldInt64, FieldUint64, FieldFloat32, FieldFloat64}
+}
+
 // This function returns the size of each element in a field in bytes.
 func (f FieldType) Size() int {
 	switch f {
@@ -107,6 +213,16 @@ func (f FieldType) Size() int {
 	}
 }
 
+// Finds the field type with the given name (as returned by String) or numeric identifier.
+func ParseFieldType(name string) (FieldType, error) {
+	for f := FieldInt8; f <= FieldFloat64; f++ {
+		if strings.EqualFold(name, f.String()) || name == strconv.Itoa(int(f)) {
+			return f, nil
+		}
+	}
+	return FieldUnknown, UnsupportedError("unknown field type '" + name + "'")
+}
+
 func (f FieldType) String() string {
 	switch f {
 	case FieldUnknown:
@@ -219,9 +335,15 @@ func (f FieldType) BytesToValue(raw []byte, o binary.ByteOrder) any {
 }
 
 // This function writes a value of any type into bytes according to the specified FieldType.
-// The written bytes are stored in the provided byte array. This function will panic if
-// the FieldType is unknown or if an unsupported field type is encountered.
+// The written bytes are stored in the provided byte array in big endian order. This function will
+// panic if the FieldType is unknown or if an unsupported field type is encountered.
 func (f FieldType) WriteValue(raw []byte, val any) {
+	f.ValueToBytes(val, raw, binary.BigEndian)
+}
+
+// Writes a value of this field type into the provided byte slice using the given byte order. This
+// is the inverse of BytesToValue, and panics under the same conditions as WriteValue.
+func (f FieldType) ValueToBytes(val any, raw []byte, o binary.ByteOrder) {
 	switch f {
 	case FieldUnknown:
 		panic("pixi: tried to write field with unknown size")
@@ -230,22 +352,87 @@ func (f FieldType) WriteValue(raw []byte, val any) {
 	case FieldUint8:
 		raw[0] = val.(uint8)
 	case FieldInt16:
-		binary.BigEndian.PutUint16(raw, uint16(val.(int16)))
+		o.PutUint16(raw, uint16(val.(int16)))
 	case FieldUint16:
-		binary.BigEndian.PutUint16(raw, val.(uint16))
+		o.PutUint16(raw, val.(uint16))
 	case FieldInt32:
-		binary.BigEndian.PutUint32(raw, uint32(val.(int32)))
+		o.PutUint32(raw, uint32(val.(int32)))
 	case FieldUint32:
-		binary.BigEndian.PutUint32(raw, val.(uint32))
+		o.PutUint32(raw, val.(uint32))
 	case FieldInt64:
-		binary.BigEndian.PutUint64(raw, uint64(val.(int64)))
+		o.PutUint64(raw, uint64(val.(int64)))
 	case FieldUint64:
-		binary.BigEndian.PutUint64(raw, val.(uint64))
+		o.PutUint64(raw, val.(uint64))
 	case FieldFloat32:
-		binary.BigEndian.PutUint32(raw, math.Float32bits(val.(float32)))
+		o.PutUint32(raw, math.Float32bits(val.(float32)))
 	case FieldFloat64:
-		binary.BigEndian.PutUint64(raw, math.Float64bits(val.(float64)))
+		o.PutUint64(raw, math.Float64bits(val.(float64)))
 	default:
 		panic("pixi: tried to write unsupported field type")
 	}
 }
+
+// Converts a value of this field type to a float64. Large 64-bit integers may lose precision.
+func (f FieldType) ValueToFloat64(val any) float64 {
+	switch f {
+	case FieldInt8:
+		return float64(val.(int8))
+	case FieldUint8:
+		return float64(val.(uint8))
+	case FieldInt16:
+		return float64(val.(int16))
+	case FieldUint16:
+		return float64(val.(uint16))
+	case FieldInt32:
+		return float64(val.(int32))
+	case FieldUint32:
+		return float64(val.(uint32))
+	case FieldInt64:
+		return float64(val.(int64))
+	case FieldUint64:
+		return float64(val.(uint64))
+	case FieldFloat32:
+		return float64(val.(float32))
+	case FieldFloat64:
+		return val.(float64)
+	default:
+		panic("pixi: tried to convert unsupported field type")
+	}
+}
+
+// Converts a float64 to a value of this field type. For integer types, the value is rounded to the
+// nearest integer and clamped to the range of the type, and NaN becomes zero.
+func (f FieldType) Float64ToValue(v float64) any {
+	switch f {
+	case FieldInt8:
+		return int8(roundClamp(v, math.MinInt8, math.MaxInt8))
+	case FieldUint8:
+		return uint8(roundClamp(v, 0, math.MaxUint8))
+	case FieldInt16:
+		return int16(roundClamp(v, math.MinInt16, math.MaxInt16))
+	case FieldUint16:
+		return uint16(roundClamp(v, 0, math.MaxUint16))
+	case FieldInt32:
+		return int32(roundClamp(v, math.MinInt32, math.MaxInt32))
+	case FieldUint32:
+		return uint32(roundClamp(v, 0, math.MaxUint32))
+	case FieldInt64:
+		// the largest int64 is not representable as a float64, so clamp to the largest float64 below it
+		return int64(roundClamp(v, math.MinInt64, math.Nextafter(math.MaxInt64, 0)))
+	case FieldUint64:
+		return uint64(roundClamp(v, 0, math.Nextafter(math.MaxUint64, 0)))
+	case FieldFloat32:
+		return float32(v)
+	case FieldFloat64:
+		return v
+	default:
+		panic("pixi: tried to convert unsupported field type")
+	}
+}
+
+func roundClamp(v float64, lo float64, hi float64) float64 {
+	if math.IsNaN(v) {
+		return 0
+	}
+	return math.Max(lo, math.Min(hi, math.Round(v)))
+}
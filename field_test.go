@@ -3,6 +3,7 @@ package pixi
 import (
 	"bytes"
 	"encoding/binary"
+	"math"
 	"reflect"
 	"testing"
 
@@ -145,3 +146,74 @@ func TestFieldWriteRead(t *testing.T) {
 		}
 	}
 }
+
+func TestFieldTypeFloat64Conversion(t *testing.T) {
+	tests := []struct {
+		fieldType FieldType
+		in        float64
+		want      any
+	}{
+		{FieldInt8, -3.6, int8(-4)},
+		{FieldInt8, 300, int8(127)},
+		{FieldUint8, -1, uint8(0)},
+		{FieldUint16, 2.5, uint16(3)},
+		{FieldInt32, math.NaN(), int32(0)},
+		{FieldUint64, 1e30, uint64(math.Nextafter(math.MaxUint64, 0))},
+		{FieldFloat32, 1.5, float32(1.5)},
+		{FieldFloat64, -0.25, -0.25},
+	}
+	for _, tc := range tests {
+		got := tc.fieldType.Float64ToValue(tc.in)
+		if got != tc.want {
+			t.Errorf("%v.Float64ToValue(%v) = %v, want %v", tc.fieldType, tc.in, got, tc.want)
+		}
+		if !math.IsNaN(tc.in) && tc.fieldType.ValueToFloat64(got) != tc.fieldType.ValueToFloat64(tc.want) {
+			t.Errorf("%v.ValueToFloat64(%v) did not round trip", tc.fieldType, got)
+		}
+	}
+}
+
+func TestFieldSetByName(t *testing.T) {
+	rgba := FieldSet{{Name: "Red", Type: FieldUint8}, {Name: "g", Type: FieldUint8}, {Name: "blue", Type: FieldUint8}, {Name: "A", Type: FieldUint8}}
+	ycbcr := FieldSet{{Name: "Y", Type: FieldUint8}, {Name: "Cb", Type: FieldUint8}, {Name: "Cr", Type: FieldUint8}}
+
+	cases := []struct {
+		fields FieldSet
+		name   string
+		index  int
+	}{
+		{rgba, "Red", 0},
+		{rgba, "red", 0},
+		{rgba, "r", 0},
+		{rgba, "green", 1},
+		{rgba, "B", 2},
+		{rgba, "alpha", 3},
+		{rgba, "luma", -1},
+		{ycbcr, "luma", 0},
+		{ycbcr, "y", 0},
+		{ycbcr, "cr", 2},
+	}
+	for _, c := range cases {
+		index, found := c.fields.ByName(c.name)
+		if index != c.index || found != (c.index >= 0) {
+			t.Errorf("expected %q to be found at %d, got %d (found %v)", c.name, c.index, index, found)
+		}
+	}
+}
+
+func TestFieldSetValidateAndNamed(t *testing.T) {
+	if err := (FieldSet{{Name: "a"}, {Name: "b"}, {Name: ""}, {Name: ""}}).Validate(); err != nil {
+		t.Errorf("expected distinct names with anonymous fields to be valid, got %v", err)
+	}
+	if _, ok := (FieldSet{{Name: "band"}, {Name: "Band"}}).Validate().(FormatError); !ok {
+		t.Error("expected names differing only in case to be rejected")
+	}
+
+	named := FieldSet{{Name: ""}, {Name: "field0"}, {Name: ""}}.Named()
+	if named[0].Name != "field0_1" || named[1].Name != "field0" || named[2].Name != "field2" {
+		t.Errorf("expected anonymous fields to be named uniquely, got %v", named)
+	}
+	if err := named.Validate(); err != nil {
+		t.Errorf("expected named fields to be valid, got %v", err)
+	}
+}
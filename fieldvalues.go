@@ -0,0 +1,104 @@
+package pixi
+
+import (
+	"strconv"
+	"strings"
+)
+
+// The prefixes of the keys of the string layer tags describing what the values of a field measure, each
+// followed by the name of the field. See FieldValues.
+const (
+	FieldUnitTagPrefix   = "unit:"
+	FieldScaleTagPrefix  = "scale:"
+	FieldOffsetTagPrefix = "offset:"
+	FieldDatumTagPrefix  = "datum:"
+)
+
+// What the values of a field measure, as recorded in the layer tags of the field. The physical value of a
+// stored value is stored*Scale + Offset, in Unit, measured from Datum; so that, for example, elevations in
+// centimetres above NAVD88 can be stored as integers with a scale of 0.01 and a unit of "m".
+type FieldValues struct {
+	Unit   string  // The unit of the physical values, such as "m" or "ft", or empty if unknown.
+	Scale  float64 // The factor applied to stored values, 1 if not recorded.
+	Offset float64 // The amount added to scaled stored values, 0 if not recorded.
+	Datum  string  // The reference the physical values are measured from, such as a vertical datum, or empty if unknown.
+}
+
+// Finds what the values of the named field of the layer measure, from the last of its layer tags that
+// record each part. Fields without tags have an unknown unit and datum, and are stored unscaled.
+func LayerFieldValues(layer *Layer, field string) (FieldValues, error) {
+	values := FieldValues{Scale: 1}
+	for _, section := range layer.Tags {
+		if unit, ok := section.Tags[FieldUnitTagPrefix+field]; ok {
+			values.Unit = unit
+		}
+		if datum, ok := section.Tags[FieldDatumTagPrefix+field]; ok {
+			values.Datum = datum
+		}
+		for prefix, target := range map[string]*float64{FieldScaleTagPrefix: &values.Scale, FieldOffsetTagPrefix: &values.Offset} {
+			text, ok := section.Tags[prefix+field]
+			if !ok {
+				continue
+			}
+			value, err := strconv.ParseFloat(text, 64)
+			if err != nil {
+				return FieldValues{}, FormatError("invalid " + prefix + field + " tag '" + text + "'")
+			}
+			*target = value
+		}
+	}
+	if values.Scale == 0 {
+		return FieldValues{}, FormatError("the " + FieldScaleTagPrefix + field + " tag must not be zero")
+	}
+	return values, nil
+}
+
+// Records what the values of the named field measure in the tags of the section. Parts that are unknown,
+// or the defaults, are not recorded.
+func (v FieldValues) SetTags(section *TagSection, field string) {
+	if v.Unit != "" {
+		section.Set(FieldUnitTagPrefix+field, v.Unit)
+	}
+	if v.Scale != 1 && v.Scale != 0 {
+		section.Set(FieldScaleTagPrefix+field, strconv.FormatFloat(v.Scale, 'g', -1, 64))
+	}
+	if v.Offset != 0 {
+		section.Set(FieldOffsetTagPrefix+field, strconv.FormatFloat(v.Offset, 'g', -1, 64))
+	}
+	if v.Datum != "" {
+		section.Set(FieldDatumTagPrefix+field, v.Datum)
+	}
+}
+
+// The physical value of a stored value.
+func (v FieldValues) Physical(stored float64) float64 {
+	return stored*v.Scale + v.Offset
+}
+
+// The stored value of a physical value.
+func (v FieldValues) Stored(physical float64) float64 {
+	return (physical - v.Offset) / v.Scale
+}
+
+// The size in metres of the units of length that values can be converted between, by their common names.
+var lengthUnits = map[string]float64{
+	"m": 1, "metre": 1, "metres": 1, "meter": 1, "meters": 1,
+	"km": 1000, "cm": 0.01, "mm": 0.001,
+	"ft": 0.3048, "foot": 0.3048, "feet": 0.3048,
+	"us-ft": 1200.0 / 3937, "us_survey_foot": 1200.0 / 3937,
+	"in": 0.0254, "mi": 1609.344,
+}
+
+// The factor by which values in one unit are multiplied to give values in another. Units of length are
+// converted between each other, and a unit is only otherwise converted to itself.
+func UnitFactor(from string, to string) (float64, error) {
+	if from == to {
+		return 1, nil
+	}
+	fromSize, fromOk := lengthUnits[strings.ToLower(from)]
+	toSize, toOk := lengthUnits[strings.ToLower(to)]
+	if !fromOk || !toOk {
+		return 0, UnsupportedError("cannot convert values in '" + from + "' to '" + to + "'")
+	}
+	return fromSize / toSize, nil
+}
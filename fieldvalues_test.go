@@ -0,0 +1,59 @@
+package pixi
+
+import (
+	"math"
+	"testing"
+)
+
+func TestLayerFieldValues(t *testing.T) {
+	layer := NewLayer("elevation", false, CompressionNone, DimensionSet{{Name: "x", Size: 4, TileSize: 4}}, []Field{{Name: "z", Type: FieldInt16}})
+	section := &TagSection{}
+	FieldValues{Unit: "ft", Scale: 0.1, Offset: -100, Datum: "NAVD88"}.SetTags(section, "z")
+	layer.Tags = []*TagSection{section}
+
+	values, err := LayerFieldValues(layer, "z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values != (FieldValues{Unit: "ft", Scale: 0.1, Offset: -100, Datum: "NAVD88"}) {
+		t.Errorf("unexpected values %+v", values)
+	}
+	if got := values.Physical(1500); math.Abs(got-50) > 1e-9 {
+		t.Errorf("expected a physical value of 50, got %v", got)
+	}
+	if got := values.Stored(50); math.Abs(got-1500) > 1e-9 {
+		t.Errorf("expected a stored value of 1500, got %v", got)
+	}
+
+	untagged, err := LayerFieldValues(layer, "other")
+	if err != nil || untagged != (FieldValues{Scale: 1}) {
+		t.Errorf("expected untagged fields to be unscaled, got %+v (%v)", untagged, err)
+	}
+	section.Set(FieldScaleTagPrefix+"z", "lots")
+	if _, err := LayerFieldValues(layer, "z"); err == nil {
+		t.Error("expected an invalid scale to be rejected")
+	}
+}
+
+func TestUnitFactor(t *testing.T) {
+	cases := []struct {
+		from, to string
+		want     float64
+	}{
+		{"m", "m", 1},
+		{"ft", "m", 0.3048},
+		{"km", "metres", 1000},
+		{"degC", "degC", 1},
+	}
+	for _, c := range cases {
+		got, err := UnitFactor(c.from, c.to)
+		if err != nil || math.Abs(got-c.want) > 1e-12 {
+			t.Errorf("expected %s to %s to be %v, got %v (%v)", c.from, c.to, c.want, got, err)
+		}
+	}
+	for _, pair := range [][2]string{{"m", ""}, {"degC", "m"}, {"furlong", "m"}} {
+		if _, err := UnitFactor(pair[0], pair[1]); err == nil {
+			t.Errorf("expected converting %s to %s to fail", pair[0], pair[1])
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package pixi
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+)
+
+// Whether a Pixi file opened with OpenFile may be modified.
+type OpenMode int
+
+const (
+	ReadOnly  OpenMode = 0 // The file can only be read, and other processes may read it at the same time.
+	ReadWrite OpenMode = 1 // The file can be read and modified, and no other process may open it with OpenFile meanwhile.
+)
+
+func (m OpenMode) String() string {
+	switch m {
+	case ReadOnly:
+		return "read-only"
+	case ReadWrite:
+		return "read-write"
+	default:
+		return "unknown"
+	}
+}
+
+// Returned by OpenFile when another process holds a conflicting lock on the file and the options do
+// not ask to wait for it.
+var ErrLocked = errors.New("pixi: file is locked by another process")
+
+// Options for OpenFile.
+type OpenOptions struct {
+	Mode        OpenMode // Whether the file may be modified, which also decides the kind of lock taken.
+	Create      bool     // With ReadWrite, creates the file if it does not exist.
+	Truncate    bool     // With ReadWrite, empties the file once the lock is held, for writing a new file in its place.
+	WaitForLock bool     // Blocks until a conflicting lock is released instead of failing with ErrLocked, for schedulers that queue jobs on the same file.
+}
+
+// A Pixi file on disk opened with an explicit mode and held under an advisory lock until it is closed.
+// Readers share the lock while a writer holds it exclusively, so two processes cannot both append layers
+// or tags to the same file and corrupt its chain of offsets. The lock is advisory: it only excludes other
+// users of OpenFile (or of flock on the same file), not programs that open the file directly. On platforms
+// without flock the file is opened without a lock.
+type File struct {
+	file *os.File
+	mode OpenMode
+}
+
+// Opens the named file in the mode given by the options, taking a shared lock for ReadOnly and an
+// exclusive lock for ReadWrite. Writes to a file opened ReadOnly fail with an UnsupportedError rather
+// than reaching the operating system. A file replaced at the path while waiting for the lock, as by
+// CompactFile in the edit package, is not used: the replacement is opened and locked in its place.
+func OpenFile(name string, options OpenOptions) (*File, error) {
+	flag := os.O_RDONLY
+	if options.Mode == ReadWrite {
+		flag = os.O_RDWR
+		if options.Create {
+			flag |= os.O_CREATE
+		}
+	} else if options.Mode != ReadOnly {
+		return nil, UnsupportedError("unknown open mode")
+	} else if options.Create || options.Truncate {
+		return nil, UnsupportedError("files opened read-only cannot be created or truncated")
+	}
+
+	var file *os.File
+	for {
+		var err error
+		file, err = os.OpenFile(name, flag, 0666)
+		if err != nil {
+			return nil, err
+		}
+		err = lockFile(file, options.Mode == ReadWrite, options.WaitForLock)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		// a file replaced at its path while waiting for the lock, such as by CompactFile renaming its
+		// rewritten copy over it, is no longer the named file, so its replacement is opened and locked instead
+		current, err := openedFileAt(file, name)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		if current {
+			break
+		}
+		file.Close()
+	}
+	// truncating only once the lock is held leaves a file that another process is still using untouched
+	if options.Truncate {
+		err := file.Truncate(0)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	return &File{file: file, mode: options.Mode}, nil
+}
+
+// Reports whether the named path still refers to the opened file, rather than having been removed or
+// replaced since it was opened.
+func openedFileAt(file *os.File, name string) (bool, error) {
+	opened, err := file.Stat()
+	if err != nil {
+		return false, err
+	}
+	named, err := os.Stat(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return os.SameFile(opened, named), nil
+}
+
+// The mode the file was opened in.
+func (f *File) Mode() OpenMode {
+	return f.mode
+}
+
+// The name of the file as given to OpenFile.
+func (f *File) Name() string {
+	return f.file.Name()
+}
+
+func (f *File) Read(p []byte) (int, error) {
+	return f.file.Read(p)
+}
+
+func (f *File) ReadAt(p []byte, off int64) (int, error) {
+	return f.file.ReadAt(p, off)
+}
+
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	return f.file.Seek(offset, whence)
+}
+
+func (f *File) Write(p []byte) (int, error) {
+	if f.mode != ReadWrite {
+		return 0, f.readOnlyError()
+	}
+	return f.file.Write(p)
+}
+
+func (f *File) WriteAt(p []byte, off int64) (int, error) {
+	if f.mode != ReadWrite {
+		return 0, f.readOnlyError()
+	}
+	return f.file.WriteAt(p, off)
+}
+
+// Changes the size of the file, as with os.File.Truncate.
+func (f *File) Truncate(size int64) error {
+	if f.mode != ReadWrite {
+		return f.readOnlyError()
+	}
+	return f.file.Truncate(size)
+}
+
+// Commits the contents of the file to stable storage.
+func (f *File) Sync() error {
+	return f.file.Sync()
+}
+
+// Returns information about the file, as with os.File.Stat.
+func (f *File) Stat() (os.FileInfo, error) {
+	return f.file.Stat()
+}
+
+// Closes the file, releasing its lock.
+func (f *File) Close() error {
+	return f.file.Close()
+}
+
+func (f *File) readOnlyError() error {
+	return UnsupportedError("cannot modify '" + f.file.Name() + "', it was opened " + f.mode.String())
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package pixi
+
+import "os"
+
+// Files are not locked on platforms without flock.
+func lockFile(file *os.File, exclusive bool, wait bool) error {
+	return nil
+}
@@ -0,0 +1,64 @@
+package pixi
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenFileReadOnlyRejectsWrites(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "ro.pixi")
+	err := os.WriteFile(name, []byte("PIXI"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := OpenFile(name, OpenOptions{Mode: ReadOnly})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err = file.Write([]byte("x")); !errors.As(err, new(UnsupportedError)) {
+		t.Errorf("expected write to a read-only file to be unsupported, got %v", err)
+	}
+	if err = file.Truncate(0); !errors.As(err, new(UnsupportedError)) {
+		t.Errorf("expected truncating a read-only file to be unsupported, got %v", err)
+	}
+	data := make([]byte, 4)
+	if _, err = file.Read(data); err != nil || string(data) != "PIXI" {
+		t.Errorf("expected to read the file contents, got %q (%v)", data, err)
+	}
+
+	_, err = OpenFile(filepath.Join(t.TempDir(), "new.pixi"), OpenOptions{Mode: ReadOnly, Create: true})
+	if !errors.As(err, new(UnsupportedError)) {
+		t.Errorf("expected creating a read-only file to be unsupported, got %v", err)
+	}
+}
+
+func TestOpenFileReadWriteCreateTruncate(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "rw.pixi")
+	file, err := OpenFile(name, OpenOptions{Mode: ReadWrite, Create: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = file.Write([]byte("some data")); err != nil {
+		t.Fatal(err)
+	}
+	if err = file.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err = OpenFile(name, OpenOptions{Mode: ReadWrite, Truncate: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != 0 {
+		t.Errorf("expected truncated file to be empty, got %d bytes", info.Size())
+	}
+}
@@ -0,0 +1,34 @@
+//go:build unix
+
+package pixi
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// Takes an advisory flock on the file, exclusive or shared, failing with ErrLocked instead of blocking
+// unless asked to wait.
+func lockFile(file *os.File, exclusive bool, wait bool) error {
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+	if !wait {
+		how |= syscall.LOCK_NB
+	}
+	for {
+		err := syscall.Flock(int(file.Fd()), how)
+		switch {
+		case err == nil:
+			return nil
+		case errors.Is(err, syscall.EINTR):
+			continue
+		case errors.Is(err, syscall.EWOULDBLOCK):
+			return ErrLocked
+		default:
+			return &os.PathError{Op: "flock", Path: file.Name(), Err: err}
+		}
+	}
+}
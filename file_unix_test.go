@@ -0,0 +1,107 @@
+//go:build unix
+
+package pixi
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOpenFileLocking(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "locked.pixi")
+	err := os.WriteFile(name, []byte("PIXI"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// flock locks belong to each open file, so separate opens in one process conflict like separate processes
+	reader, err := OpenFile(name, OpenOptions{Mode: ReadOnly})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := OpenFile(name, OpenOptions{Mode: ReadOnly})
+	if err != nil {
+		t.Fatalf("expected readers to share the lock, got %v", err)
+	}
+	other.Close()
+	if _, err = OpenFile(name, OpenOptions{Mode: ReadWrite}); err != ErrLocked {
+		t.Errorf("expected a writer to be locked out by a reader, got %v", err)
+	}
+	reader.Close()
+
+	writer, err := OpenFile(name, OpenOptions{Mode: ReadWrite})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = OpenFile(name, OpenOptions{Mode: ReadOnly}); err != ErrLocked {
+		t.Errorf("expected a reader to be locked out by a writer, got %v", err)
+	}
+	if _, err = OpenFile(name, OpenOptions{Mode: ReadWrite, Truncate: true}); err != ErrLocked {
+		t.Errorf("expected a second writer to be locked out, got %v", err)
+	}
+	if info, err := os.Stat(name); err != nil || info.Size() != 4 {
+		t.Errorf("expected a locked out writer not to truncate the file, got %v (%v)", info, err)
+	}
+
+	waited := make(chan error, 1)
+	go func() {
+		file, err := OpenFile(name, OpenOptions{Mode: ReadWrite, WaitForLock: true})
+		if err == nil {
+			file.Close()
+		}
+		waited <- err
+	}()
+	select {
+	case err = <-waited:
+		t.Fatalf("expected waiting writer to block while the lock is held, got %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	writer.Close()
+	if err = <-waited; err != nil {
+		t.Errorf("expected waiting writer to get the lock once released, got %v", err)
+	}
+}
+
+func TestAppendFilesQueueOnLock(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "shared.pixi")
+	file, err := OpenFile(name, OpenOptions{Mode: ReadWrite, Create: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := PixiHeader{Version: Version, OffsetSize: 4, ByteOrder: binary.LittleEndian}
+	base := appendTestLayer("base")
+	writeSingleLayerPixi(t, file, header, map[string]string{"a": "1"}, base, randomTiles(base))
+
+	// both writers queue behind the lock held here, then append one after the other
+	done := make(chan error, 2)
+	go func() {
+		done <- AppendTagsFile(name, &TagSection{Tags: map[string]string{"b": "2"}}, true)
+	}()
+	go func() {
+		layer := appendTestLayer("appended")
+		done <- AppendLayerFile(name, layer, 2, func(tileIndex int, data []byte) error { return nil }, true)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	file.Close()
+	for range 2 {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reader, err := OpenFile(name, OpenOptions{Mode: ReadOnly})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	summary, err := ReadPixi(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summary.Layers) != 2 || len(summary.Tags) != 2 || summary.Tags[1].Tags["b"] != "2" {
+		t.Errorf("expected both appends to be linked, got layers %v and tags %v", summary.Layers, summary.Tags)
+	}
+}
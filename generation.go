@@ -0,0 +1,163 @@
+package pixi
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"strconv"
+)
+
+// The key of the file tag holding the generation of a file published with PublishGeneration.
+const GenerationTag = "pixi-generation"
+
+// The number of times ReadSnapshot reads a file that keeps changing underneath it before giving up.
+const snapshotAttempts = 8
+
+// The generation of the file, as recorded by the last PublishGeneration, or 0 if it was never published
+// that way.
+func (d *Pixi) Generation() uint64 {
+	generation := uint64(0)
+	for _, section := range d.Tags {
+		if value, ok := section.Tags[GenerationTag]; ok {
+			generation, _ = strconv.ParseUint(value, 10, 64)
+		}
+	}
+	return generation
+}
+
+// Publishes a new generation of a file that is being updated while readers are using it, such as a mosaic
+// served while it is refreshed. The writer appends any new or changed tiles to the end of the file with
+// Layer.WriteTile, never overwriting bytes the current generation refers to, which updates the layers of
+// the given summary; then PublishGeneration writes a complete copy of every layer header and of the tags
+// of the summary at the end of the file, and swaps the offsets in the file header over to them with a
+// single write. Readers using ReadSnapshot see either the old generation or the new one in full, and
+// readers still holding the old generation can keep reading its tiles. Returns the number of the new
+// generation, one more than that of the summary, which is recorded in the GenerationTag.
+//
+// The header and tags of earlier generations are left in the file until it is compacted. Writers are
+// guarded against each other as with AppendTags, and sealed files are refused.
+func PublishGeneration(f io.ReadWriteSeeker, summary *Pixi) (uint64, error) {
+	state, err := readAppendState(f)
+	if err != nil {
+		return 0, err
+	}
+	header := state.header
+	generation := summary.Generation() + 1
+	_, err = f.Seek(state.size, io.SeekStart)
+	if err != nil {
+		return 0, err
+	}
+
+	// the layers, each linked to the next and with its tags after it
+	layers := summary.AllLayers()
+	layerOffsets := make([]int64, len(layers))
+	for i, layer := range layers {
+		layerOffsets[i], err = f.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return 0, err
+		}
+		layer.NextLayerStart = 0
+		err = layer.WriteHeader(f, header)
+		if err != nil {
+			return 0, err
+		}
+		if len(layer.Tags) > 0 {
+			err = layer.WriteTags(f, header)
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+	for i, layer := range layers {
+		if i < len(layers)-1 {
+			layer.NextLayerStart = layerOffsets[i+1]
+		}
+		err = layer.OverwriteHeader(f, header, layerOffsets[i])
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// the file tags, with the generation in a section of its own at the end
+	sections := []*TagSection{}
+	for _, section := range summary.Tags {
+		if _, ok := section.Tags[GenerationTag]; ok {
+			section = &TagSection{Tags: maps.Clone(section.Tags), Binary: section.Binary, Order: section.Order}
+			delete(section.Tags, GenerationTag)
+			if len(section.Tags) == 0 && len(section.Binary) == 0 {
+				continue
+			}
+		}
+		sections = append(sections, section)
+	}
+	stamp := &TagSection{}
+	stamp.Set(GenerationTag, strconv.FormatUint(generation, 10))
+	sections = append(sections, stamp)
+	_, err = f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	tagsOffset, err := writeTagSections(f, header, sections)
+	if err != nil {
+		return 0, err
+	}
+	end, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = checkAppend(f, state, end)
+	if err != nil {
+		return 0, err
+	}
+	firstLayer := int64(0)
+	if len(layerOffsets) > 0 {
+		firstLayer = layerOffsets[0]
+	}
+	// both offsets in one write, so that the swap is as close to atomic as the stream allows
+	_, err = f.Seek(header.offsetsOffset(), io.SeekStart)
+	if err != nil {
+		return 0, err
+	}
+	err = header.WriteOffsets(f, []int64{firstLayer, tagsOffset})
+	if err != nil {
+		return 0, err
+	}
+	summary.Header.FirstLayerOffset, summary.Header.FirstTagsOffset = firstLayer, tagsOffset
+	summary.Tags = sections
+	return generation, nil
+}
+
+// Reads the summary of a file as ReadPixi does, but consistently even while another process publishes
+// new generations of it with PublishGeneration: the file header is read again after everything else, and
+// if its offsets moved meanwhile the file is read again. Fails with ErrConcurrentModification if the file
+// keeps changing. Files that are not updated through PublishGeneration are read as by ReadPixi.
+func ReadSnapshot(r io.ReadSeeker) (Pixi, error) {
+	var lastErr error
+	for range snapshotAttempts {
+		_, err := r.Seek(0, io.SeekStart)
+		if err != nil {
+			return Pixi{}, err
+		}
+		summary, err := ReadPixi(r)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		_, err = r.Seek(0, io.SeekStart)
+		if err != nil {
+			return Pixi{}, err
+		}
+		var header PixiHeader
+		err = header.ReadHeader(r)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if header.FirstLayerOffset == summary.Header.FirstLayerOffset && header.FirstTagsOffset == summary.Header.FirstTagsOffset {
+			return summary, nil
+		}
+		lastErr = fmt.Errorf("%w: a new generation was published while reading", ErrConcurrentModification)
+	}
+	return Pixi{}, lastErr
+}
@@ -0,0 +1,147 @@
+package pixi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"slices"
+	"testing"
+
+	"github.com/owlpinetech/pixi/internal/buffer"
+)
+
+// Appends a new version of the given tile of the first layer of the summary, then publishes it.
+func publishTile(t *testing.T, buf *buffer.Buffer, summary *Pixi, tileIndex int, data []byte) uint64 {
+	t.Helper()
+	layer := summary.Layers[0]
+	_, err := buf.Seek(0, io.SeekEnd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = layer.WriteTile(buf, summary.Header, tileIndex, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	generation, err := PublishGeneration(buf, summary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return generation
+}
+
+func TestPublishGenerationKeepsOldSnapshotsReadable(t *testing.T) {
+	header := PixiHeader{Version: Version, OffsetSize: 4, ByteOrder: binary.LittleEndian}
+	buf := buffer.NewBuffer(10)
+	err := header.WriteHeader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = AppendTags(buf, &TagSection{Tags: map[string]string{"title": "nightly"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	layer := appendTestLayer("mosaic")
+	layer.Tags = []*TagSection{{Tags: map[string]string{"band": "gray"}}}
+	tiles := randomTiles(layer)
+	err = AppendLayer(buf, layer, 1, func(tileIndex int, data []byte) error {
+		copy(data, tiles[tileIndex])
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old, err := ReadSnapshot(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if old.Generation() != 0 {
+		t.Errorf("expected an unpublished file to be generation 0, got %d", old.Generation())
+	}
+	writer, err := ReadSnapshot(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	updated := []byte{9, 9, 9, 9}
+	if generation := publishTile(t, buf, &writer, 0, updated); generation != 1 {
+		t.Errorf("expected generation 1, got %d", generation)
+	}
+	if generation := publishTile(t, buf, &writer, 1, updated); generation != 2 {
+		t.Errorf("expected generation 2, got %d", generation)
+	}
+
+	current, err := ReadSnapshot(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current.Generation() != 2 {
+		t.Errorf("expected generation 2 to be read, got %d", current.Generation())
+	}
+	stamps := 0
+	for _, section := range current.Tags {
+		if _, ok := section.Tags[GenerationTag]; ok {
+			stamps++
+		}
+	}
+	if stamps != 1 || current.Tags[0].Tags["title"] != "nightly" || current.Layers[0].Tags[0].Tags["band"] != "gray" {
+		t.Errorf("expected the tags to carry over with a single generation stamp, got %v", current.Tags)
+	}
+
+	data := make([]byte, 4)
+	for tileIndex := range 2 {
+		err = current.Layers[0].ReadTile(buf, current.Header, tileIndex, data)
+		if err != nil || !slices.Equal(data, updated) {
+			t.Errorf("expected tile %d of the new generation to be updated, got %v %v", tileIndex, data, err)
+		}
+		err = old.Layers[0].ReadTile(buf, old.Header, tileIndex, data)
+		if err != nil || !slices.Equal(data, tiles[tileIndex]) {
+			t.Errorf("expected tile %d of the old generation to be unchanged, got %v %v", tileIndex, data, err)
+		}
+	}
+}
+
+// Reads from one version of a file until it has been sought to the start a number of times, then from
+// another, as if a new generation were published in the middle of reading.
+type publishingReader struct {
+	current *bytes.Reader
+	next    *bytes.Reader
+	rewinds int
+	publish int
+}
+
+func (r *publishingReader) Read(p []byte) (int, error) {
+	return r.current.Read(p)
+}
+
+func (r *publishingReader) Seek(offset int64, whence int) (int64, error) {
+	if offset == 0 && whence == io.SeekStart {
+		r.rewinds++
+		if r.rewinds == r.publish {
+			r.current = r.next
+		}
+	}
+	return r.current.Seek(offset, whence)
+}
+
+func TestReadSnapshotRetriesWhenPublishedDuringRead(t *testing.T) {
+	header := PixiHeader{Version: Version, OffsetSize: 8, ByteOrder: binary.BigEndian}
+	buf := buffer.NewBuffer(10)
+	layer := appendTestLayer("mosaic")
+	writeSingleLayerPixi(t, buf, header, nil, layer, randomTiles(layer))
+	before := slices.Clone(buf.Bytes())
+	summary, err := ReadSnapshot(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publishTile(t, buf, &summary, 0, []byte{1, 2, 3, 4})
+
+	// the second rewind is ReadSnapshot checking the header again, which then sees the new generation
+	r := &publishingReader{current: bytes.NewReader(before), next: bytes.NewReader(buf.Bytes()), publish: 2}
+	snapshot, err := ReadSnapshot(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.Generation() != 1 || r.rewinds < 3 {
+		t.Errorf("expected the snapshot to be read again at generation 1, got generation %d after %d rewinds", snapshot.Generation(), r.rewinds)
+	}
+}
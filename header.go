@@ -4,21 +4,21 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"math"
 	"strconv"
 )
 
-const (
-	offsetsOffset int64 = 8
-)
-
 // Contains information used to read or write the rest of a Pixi data file. This information
 // is always found at the start of a stream of Pixi data.
 type PixiHeader struct {
 	Version          int
 	OffsetSize       int
 	ByteOrder        binary.ByteOrder
+	Checksum         ChecksumAlgorithm // The algorithm used for tile checksums, always CRC-32 before version 2.
 	FirstLayerOffset int64
 	FirstTagsOffset  int64
+	RequiredFeatures Features // Features a reader must support to read the file, added in version 3.
+	OptionalFeatures Features // Features the file uses that readers may ignore, added in version 3.
 }
 
 // Writes a fixed size value, or a slice of such values, using the byte order given in the header.
@@ -31,6 +31,36 @@ func (s *PixiHeader) Read(r io.Reader, val any) error {
 	return binary.Read(r, s.ByteOrder, val)
 }
 
+// Writes a tile checksum computed with the header's checksum algorithm to the current position in
+// the writer stream. Nothing is written if the header uses ChecksumNone.
+func (s *PixiHeader) WriteChecksum(w io.Writer, checksum uint64) error {
+	switch s.Checksum.Size() {
+	case 0:
+		return nil
+	case 4:
+		return binary.Write(w, s.ByteOrder, uint32(checksum))
+	default:
+		return binary.Write(w, s.ByteOrder, checksum)
+	}
+}
+
+// Reads a tile checksum written with the header's checksum algorithm from the current position in
+// the reader. Returns 0 without reading anything if the header uses ChecksumNone.
+func (s *PixiHeader) ReadChecksum(r io.Reader) (uint64, error) {
+	switch s.Checksum.Size() {
+	case 0:
+		return 0, nil
+	case 4:
+		var checksum uint32
+		err := binary.Read(r, s.ByteOrder, &checksum)
+		return uint64(checksum), err
+	default:
+		var checksum uint64
+		err := binary.Read(r, s.ByteOrder, &checksum)
+		return checksum, err
+	}
+}
+
 // Writes a file offset to the current position in the writer stream, based on the offset size
 // specified in the header. Panics if the file offset size has not yet been set, and returns
 // an error if writing fails.
@@ -101,9 +131,12 @@ func (s *PixiHeader) ReadOffsets(r io.Reader, offsets []int64) error {
 
 func (s *PixiHeader) WriteFriendly(w io.Writer, friendly string) error {
 	strBytes := []byte(friendly)
+	if len(strBytes) > math.MaxUint16 {
+		return FormatError("friendly strings cannot be longer than 65535 bytes")
+	}
 	err := s.Write(w, uint16(len(strBytes)))
 	if err != nil {
-		return nil
+		return err
 	}
 	return s.Write(w, strBytes)
 }
@@ -149,6 +182,26 @@ func (h *PixiHeader) WriteHeader(w io.Writer) error {
 		return err
 	}
 
+	// write checksum algorithm indicator (1 byte), added in version 2
+	if h.Version >= 2 {
+		_, err = w.Write([]byte{byte(h.Checksum)})
+		if err != nil {
+			return err
+		}
+	} else if h.Checksum != ChecksumCrc32 {
+		return FormatError("checksum algorithms other than crc32 require version 2 or later")
+	}
+
+	// write required and optional feature flags (4 bytes each), added in version 3
+	if h.Version >= 3 {
+		err = h.Write(w, [2]uint32{uint32(h.RequiredFeatures), uint32(h.OptionalFeatures)})
+		if err != nil {
+			return err
+		}
+	} else if h.RequiredFeatures != 0 || h.OptionalFeatures != 0 {
+		return FormatError("feature flags require version 3 or later")
+	}
+
 	// write first layer offset
 	err = h.WriteOffset(w, h.FirstLayerOffset)
 	if err != nil {
@@ -165,7 +218,7 @@ func (h *PixiHeader) ReadHeader(r io.Reader) error {
 	buf := make([]byte, 4)
 
 	// check file type
-	_, err := r.Read(buf)
+	_, err := io.ReadFull(r, buf)
 	if err != nil {
 		return err
 	}
@@ -175,7 +228,7 @@ func (h *PixiHeader) ReadHeader(r io.Reader) error {
 	}
 
 	// check file version
-	_, err = r.Read(buf[0:2])
+	_, err = io.ReadFull(r, buf[0:2])
 	if err != nil {
 		return err
 	}
@@ -190,7 +243,7 @@ func (h *PixiHeader) ReadHeader(r io.Reader) error {
 	h.Version = int(version)
 
 	// read offset size indicator & byte order indicator
-	_, err = r.Read(buf[0:2])
+	_, err = io.ReadFull(r, buf[0:2])
 	if err != nil {
 		return err
 	}
@@ -208,6 +261,33 @@ func (h *PixiHeader) ReadHeader(r io.Reader) error {
 		return FormatError("unsupported or invalid byte order specified")
 	}
 
+	// read checksum algorithm indicator, only present from version 2
+	h.Checksum = ChecksumCrc32
+	if h.Version >= 2 {
+		_, err = io.ReadFull(r, buf[0:1])
+		if err != nil {
+			return err
+		}
+		h.Checksum = ChecksumAlgorithm(buf[0])
+		if h.Checksum > ChecksumNone {
+			return FormatError("unsupported or invalid checksum algorithm specified")
+		}
+	}
+
+	// read feature flags, only present from version 3, refusing files that need unsupported features
+	h.RequiredFeatures, h.OptionalFeatures = 0, 0
+	if h.Version >= 3 {
+		var flags [2]uint32
+		err = h.Read(r, &flags)
+		if err != nil {
+			return err
+		}
+		h.RequiredFeatures, h.OptionalFeatures = Features(flags[0]), Features(flags[1])
+		if missing := h.RequiredFeatures &^ SupportedFeatures; missing != 0 {
+			return FeatureError{Missing: missing}
+		}
+	}
+
 	// read first layer offset
 	firstLayerOffset, err := h.ReadOffset(r)
 	if err != nil {
@@ -225,12 +305,30 @@ func (h *PixiHeader) ReadHeader(r io.Reader) error {
 	return nil
 }
 
+// The byte-index offset from the start of the file at which the first layer and tag offsets are written.
+func (h *PixiHeader) offsetsOffset() int64 {
+	if h.Version >= 3 {
+		return 17
+	}
+	if h.Version >= 2 {
+		return 9
+	}
+	return 8
+}
+
+// Get the total number of bytes occupied by this header at the start of a file.
+func (h *PixiHeader) HeaderSize() int {
+	return int(h.offsetsOffset()) + 2*h.OffsetSize
+}
+
+// Rewrites the first layer and first tag section offsets of a header that has already been written
+// at the start of the stream, returning the stream cursor to the position it was at previously.
 func (h *PixiHeader) OverwriteOffsets(w io.WriteSeeker, firstLayer int64, firstTags int64) error {
 	oldPos, err := w.Seek(0, io.SeekCurrent)
 	if err != nil {
 		return err
 	}
-	_, err = w.Seek(offsetsOffset, io.SeekStart)
+	_, err = w.Seek(h.offsetsOffset(), io.SeekStart)
 	if err != nil {
 		return err
 	}
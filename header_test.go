@@ -15,6 +15,13 @@ func TestWriteReadHeader(t *testing.T) {
 		{Version: Version, OffsetSize: 4, ByteOrder: binary.LittleEndian},
 		{Version: Version, OffsetSize: 8, ByteOrder: binary.BigEndian},
 		{Version: Version, OffsetSize: 4, ByteOrder: binary.BigEndian},
+		{Version: Version, OffsetSize: 8, ByteOrder: binary.LittleEndian, Checksum: ChecksumCrc32c},
+		{Version: Version, OffsetSize: 4, ByteOrder: binary.BigEndian, Checksum: ChecksumXxHash64},
+		{Version: Version, OffsetSize: 8, ByteOrder: binary.BigEndian, Checksum: ChecksumNone},
+		{Version: Version, OffsetSize: 4, ByteOrder: binary.LittleEndian, RequiredFeatures: FeatureExtensions, OptionalFeatures: 1 << 20},
+		{Version: 2, OffsetSize: 8, ByteOrder: binary.BigEndian, Checksum: ChecksumCrc32c},
+		{Version: 1, OffsetSize: 4, ByteOrder: binary.LittleEndian},
+		{Version: 1, OffsetSize: 8, ByteOrder: binary.BigEndian},
 	}
 
 	for range 10 {
@@ -64,3 +71,97 @@ func TestWriteReadHeader(t *testing.T) {
 		}
 	}
 }
+
+func TestWriteHeaderChecksumRequiresVersion2(t *testing.T) {
+	header := PixiHeader{Version: 1, OffsetSize: 4, ByteOrder: binary.BigEndian, Checksum: ChecksumXxHash64}
+	err := header.WriteHeader(buffer.NewBuffer(10))
+	if err == nil {
+		t.Error("expected error writing non-default checksum in a version 1 header")
+	}
+}
+
+func TestWriteHeaderFeaturesRequireVersion3(t *testing.T) {
+	header := PixiHeader{Version: 2, OffsetSize: 4, ByteOrder: binary.BigEndian, OptionalFeatures: FeatureExtensions}
+	err := header.WriteHeader(buffer.NewBuffer(10))
+	if err == nil {
+		t.Error("expected error writing feature flags in a version 2 header")
+	}
+}
+
+func TestReadHeaderRefusesUnsupportedRequiredFeatures(t *testing.T) {
+	unknown := Features(1<<5 | 1<<9)
+	header := PixiHeader{Version: Version, OffsetSize: 4, ByteOrder: binary.LittleEndian,
+		RequiredFeatures: FeatureExtensions | unknown, OptionalFeatures: 1 << 12}
+	buf := buffer.NewBuffer(10)
+	err := header.WriteHeader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = (&PixiHeader{}).ReadHeader(bytes.NewReader(buf.Bytes()))
+	featureErr, ok := err.(FeatureError)
+	if !ok || featureErr.Missing != unknown {
+		t.Fatalf("expected a feature error missing %v, got %v", unknown, err)
+	}
+	if want := "feature bit 5, feature bit 9"; featureErr.Missing.String() != want {
+		t.Errorf("expected missing features named %q, got %q", want, featureErr.Missing.String())
+	}
+
+	// unknown optional features alone do not stop the file from being read
+	header.RequiredFeatures = FeatureExtensions
+	buf = buffer.NewBuffer(10)
+	err = header.WriteHeader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = (&PixiHeader{}).ReadHeader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Errorf("expected unknown optional features to be ignored, got %v", err)
+	}
+}
+
+func TestFeaturesFollowUsage(t *testing.T) {
+	plain := &TagSection{Tags: map[string]string{"title": "terrain"}}
+	extended := &TagSection{}
+	if err := extended.SetDescription("# Terrain"); err != nil {
+		t.Fatal(err)
+	}
+	layer := appendTestLayer("elevation")
+	if required, optional := UsedFeatures([]*Layer{layer}, []*TagSection{plain}); required != 0 || optional != 0 {
+		t.Errorf("expected plain content to use no features, got %v and %v", required, optional)
+	}
+	layer.Tags = []*TagSection{extended}
+	if required, optional := UsedFeatures([]*Layer{layer}, nil); required != 0 || optional != FeatureExtensions {
+		t.Errorf("expected layer extensions to be an optional feature, got %v and %v", required, optional)
+	}
+
+	// stale features of the header are replaced by those used
+	header := PixiHeader{Version: Version, OffsetSize: 4, ByteOrder: binary.BigEndian, RequiredFeatures: 1 << 20}
+	header.SetFeatures(nil, []*TagSection{plain})
+	if header.RequiredFeatures != 0 || header.OptionalFeatures != 0 {
+		t.Errorf("expected no features to be set, got %v and %v", header.RequiredFeatures, header.OptionalFeatures)
+	}
+	old := PixiHeader{Version: 2, OffsetSize: 4, ByteOrder: binary.BigEndian}
+	old.SetFeatures(nil, []*TagSection{extended})
+	if old.OptionalFeatures != 0 {
+		t.Errorf("expected no features to be set before version 3, got %v", old.OptionalFeatures)
+	}
+
+	// appending extensions to a file without them adds the feature to its header
+	buf := buffer.NewBuffer(10)
+	plainLayer := appendTestLayer("plain")
+	writeSingleLayerPixi(t, buf, header, nil, plainLayer, randomTiles(plainLayer))
+	if err := AppendDescription(buf, "# Terrain"); err != nil {
+		t.Fatal(err)
+	}
+	summary, err := ReadPixi(buffer.NewBufferFrom(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Header.OptionalFeatures != FeatureExtensions {
+		t.Errorf("expected appending a description to add the extensions feature, got %v", summary.Header.OptionalFeatures)
+	}
+	if description, found, err := summary.Description(); err != nil || !found || description != "# Terrain" {
+		t.Errorf("expected the description to be read back, got %q %v %v", description, found, err)
+	}
+}
@@ -0,0 +1,40 @@
+package pixi
+
+import "io"
+
+// A run of bytes of a stream.
+type ByteRange struct {
+	Offset int64
+	Length int64
+}
+
+// Implemented by streams that read faster when told ahead of time which bytes will be read, such as
+// remote files, which fetch runs of adjacent ranges with a single request rather than one per read.
+// Hints are only advice: the stream must still serve every read as usual, and ranges that are hinted
+// but never read cost at most the bytes fetched with them.
+type RangeHinter interface {
+	HintRanges(ranges []ByteRange)
+}
+
+// The bytes of the stream holding the encoded disk tile at the given index followed by its checksum.
+func (l *Layer) TileByteRange(h PixiHeader, tileIndex int) ByteRange {
+	return ByteRange{Offset: l.TileOffsets[tileIndex], Length: l.TileBytes[tileIndex] + int64(h.Checksum.Size())}
+}
+
+// Tells the stream which bytes reading the given disk tiles will touch, if it is a RangeHinter, so that
+// it can fetch tiles lying next to each other together. Tiles that have not been written are left out.
+func (l *Layer) HintTiles(r io.Reader, h PixiHeader, tiles []int) {
+	hinter, ok := r.(RangeHinter)
+	if !ok {
+		return
+	}
+	ranges := make([]ByteRange, 0, len(tiles))
+	for _, tileIndex := range tiles {
+		if l.TileBytes[tileIndex] > 0 {
+			ranges = append(ranges, l.TileByteRange(h, tileIndex))
+		}
+	}
+	if len(ranges) > 0 {
+		hinter.HintRanges(ranges)
+	}
+}
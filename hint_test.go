@@ -0,0 +1,38 @@
+package pixi
+
+import (
+	"encoding/binary"
+	"slices"
+	"testing"
+
+	"github.com/owlpinetech/pixi/internal/buffer"
+)
+
+// A buffer recording the ranges hinted to it.
+type hintedBuffer struct {
+	*buffer.Buffer
+	hints []ByteRange
+}
+
+func (b *hintedBuffer) HintRanges(ranges []ByteRange) {
+	b.hints = append(b.hints, ranges...)
+}
+
+func TestLayerHintTiles(t *testing.T) {
+	header := PixiHeader{Version: Version, OffsetSize: 8, ByteOrder: binary.LittleEndian, Checksum: ChecksumCrc32}
+	layer := NewLayer("hinted", false, CompressionNone,
+		DimensionSet{{Name: "x", Size: 8, TileSize: 4}, {Name: "y", Size: 4, TileSize: 4}},
+		[]Field{{Name: "v", Type: FieldUint8}})
+	buf := &hintedBuffer{Buffer: buffer.NewBuffer(10)}
+	if err := layer.WriteTile(buf, header, 1, make([]byte, layer.DiskTileSize(1))); err != nil {
+		t.Fatal(err)
+	}
+
+	layer.HintTiles(buf, header, []int{0, 1})
+	want := []ByteRange{{Offset: layer.TileOffsets[1], Length: 16 + 4}}
+	if !slices.Equal(buf.hints, want) {
+		t.Errorf("expected only the written tile and its checksum to be hinted as %v, got %v", want, buf.hints)
+	}
+	// streams that take no hints are left alone
+	layer.HintTiles(buf.Buffer, header, []int{1})
+}
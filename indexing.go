@@ -61,6 +61,22 @@ func (s TileSelector) ToTileIndex(set DimensionSet) TileIndex {
 	return TileIndex(set.TileSamples()*s.Tile + s.InTile)
 }
 
+// Reports whether the selected sample lies within the size of every dimension, rather than in the padding
+// of a partial tile at the edge of the set, without converting it to a coordinate.
+func (s TileSelector) InBounds(set DimensionSet) bool {
+	tileIndex := s.Tile
+	inTileIndex := s.InTile
+	for _, dim := range set {
+		tiles := dim.Tiles()
+		if (tileIndex%tiles)*dim.TileSize+inTileIndex%dim.TileSize >= dim.Size {
+			return false
+		}
+		tileIndex /= tiles
+		inTileIndex /= dim.TileSize
+	}
+	return true
+}
+
 func (s TileSelector) ToTileCoordinate(set DimensionSet) TileCoordinate {
 	coord := TileCoordinate{make([]int, len(set)), make([]int, len(set))}
 	tileIndex := s.Tile
@@ -119,3 +119,17 @@ func TestSampleCoordinateToTileSelectorDirectAndIndirectSame(t *testing.T) {
 		}
 	}
 }
+
+func TestTileSelectorInBounds(t *testing.T) {
+	dims := DimensionSet{{Size: 5, TileSize: 2}, {Size: 3, TileSize: 2}, {Size: 2, TileSize: 2}}
+	for tileIndex := range dims.Tiles() {
+		for inTile := range dims.TileSamples() {
+			selector := TileSelector{Tile: tileIndex, InTile: inTile}
+			coord := selector.ToTileCoordinate(dims).ToSampleCoordinate(dims)
+			want := coord[0] < 5 && coord[1] < 3 && coord[2] < 2
+			if got := selector.InBounds(dims); got != want {
+				t.Errorf("expected %v to be in bounds %v, got %v", coord, want, got)
+			}
+		}
+	}
+}
@@ -4,26 +4,26 @@ import (
 	"io"
 )
 
-type buffer struct {
+type Buffer struct {
 	buf []byte
 	pos int
 	end int
 }
 
-func NewBuffer(initialSize int) *buffer {
-	return &buffer{
+func NewBuffer(initialSize int) *Buffer {
+	return &Buffer{
 		buf: make([]byte, initialSize),
 	}
 }
 
-func NewBufferFrom(underlying []byte) *buffer {
-	return &buffer{
+func NewBufferFrom(underlying []byte) *Buffer {
+	return &Buffer{
 		buf: underlying,
 		end: len(underlying),
 	}
 }
 
-func (b *buffer) Read(p []byte) (int, error) {
+func (b *Buffer) Read(p []byte) (int, error) {
 	if len(p) > 0 && b.pos < len(b.buf) {
 		n := copy(p, b.buf[b.pos:])
 		b.pos += n
@@ -37,7 +37,7 @@ func (b *buffer) Read(p []byte) (int, error) {
 	}
 }
 
-func (b *buffer) Write(p []byte) (int, error) {
+func (b *Buffer) Write(p []byte) (int, error) {
 	for b.pos+len(p) >= len(b.buf) {
 		b.buf = append(b.buf, make([]byte, len(b.buf))...)
 	}
@@ -47,7 +47,7 @@ func (b *buffer) Write(p []byte) (int, error) {
 	return n, nil
 }
 
-func (b *buffer) Seek(offset int64, whence int) (int64, error) {
+func (b *Buffer) Seek(offset int64, whence int) (int64, error) {
 	var newOffset int
 	switch whence {
 	case io.SeekStart:
@@ -59,7 +59,7 @@ func (b *buffer) Seek(offset int64, whence int) (int64, error) {
 			newOffset = max(0, b.pos+int(offset))
 		}
 	case io.SeekEnd:
-		newOffset = len(b.buf) + int(offset)
+		newOffset = b.end + int(offset)
 	default:
 		panic("pixi: invalid whence in buffer seek")
 	}
@@ -73,14 +73,14 @@ func (b *buffer) Seek(offset int64, whence int) (int64, error) {
 	return int64(b.pos), nil
 }
 
-func (b *buffer) Bytes() []byte {
+func (b *Buffer) Bytes() []byte {
 	return b.buf[:b.end]
 }
 
-func (b *buffer) Size() int {
+func (b *Buffer) Size() int {
 	return len(b.buf)
 }
 
-func (b *buffer) Position() int {
+func (b *Buffer) Position() int {
 	return b.pos
 }
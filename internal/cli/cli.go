@@ -0,0 +1,219 @@
+// Package cli holds the flag parsing, output, and error handling shared by the command line tools, so
+// that every tool accepts the same common flags and exits with the same codes.
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/config"
+	"github.com/owlpinetech/pixi/remote"
+)
+
+// The exit codes used by every tool.
+const (
+	ExitOK       = 0 // The tool completed successfully.
+	ExitFailure  = 1 // The tool failed, for example because a file could not be read or written.
+	ExitUsage    = 2 // The tool was given invalid flags or arguments.
+	ExitProblems = 3 // The tool completed, but found problems in its input (such as a failed check).
+)
+
+// An error that carries the exit code the tool should exit with.
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// Creates an error that makes Run exit with ExitUsage.
+func UsageError(format string, args ...any) error {
+	return &ExitError{Code: ExitUsage, Err: fmt.Errorf(format, args...)}
+}
+
+// Creates an error that makes Run exit with ExitProblems.
+func ProblemsError(format string, args ...any) error {
+	return &ExitError{Code: ExitProblems, Err: fmt.Errorf(format, args...)}
+}
+
+// A command line tool, with its flags and the common options every tool accepts: -quiet to print only
+// results and errors, -verbose to print extra progress detail, and -json to print errors (and, for tools
+// that support it, results) as JSON. Config holds the defaults loaded from the config file and
+// environment, for tools to use as the defaults of their own flags.
+type Tool struct {
+	Name      string
+	Flags     *flag.FlagSet
+	Quiet     bool
+	Verbose   bool
+	JSON      bool
+	Config    config.Options
+	Stdout    io.Writer
+	Stderr    io.Writer
+	exit      func(int)
+	configErr error
+	throttle  *remote.Throttle
+}
+
+// Creates a tool with the given name, the common flags registered, and the config defaults loaded.
+// Tool-specific flags are added to Flags before calling Parse.
+func New(name string) *Tool {
+	opts, err := config.Load()
+	t := &Tool{
+		Name:      name,
+		Flags:     flag.NewFlagSet(name, flag.ContinueOnError),
+		Config:    opts,
+		Stdout:    os.Stdout,
+		Stderr:    os.Stderr,
+		exit:      os.Exit,
+		configErr: err,
+	}
+	t.Flags.SetOutput(t.Stderr)
+	t.Flags.BoolVar(&t.Quiet, "quiet", false, "print only results and errors")
+	t.Flags.BoolVar(&t.Verbose, "verbose", false, "print extra detail about progress")
+	t.Flags.BoolVar(&t.JSON, "json", false, "print errors and results as JSON")
+	return t
+}
+
+// Parses the command line arguments (without the program name), exiting with ExitUsage if they are
+// invalid, or ExitOK if help was requested.
+func (t *Tool) Parse(args []string) {
+	err := t.Flags.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		t.exit(ExitOK)
+		return
+	}
+	if err != nil {
+		t.exit(ExitUsage)
+		return
+	}
+	if t.configErr != nil {
+		t.Fail(&ExitError{Code: ExitUsage, Err: t.configErr})
+		return
+	}
+	if t.Quiet && t.Verbose {
+		t.Fail(UsageError("-quiet and -verbose cannot be used together"))
+	}
+}
+
+// Runs the body of the tool, then exits with ExitOK if it succeeded, or reports the error and exits with
+// the matching code otherwise. With -verbose, the use made of the HTTP throttle is reported first.
+func (t *Tool) Run(fn func() error) {
+	err := fn()
+	if t.throttle != nil {
+		usage := t.throttle.Usage()
+		t.Verbosef("http: %d requests for %d bytes, %d delayed for %s\n", usage.Requests, usage.Bytes, usage.Throttled, usage.Waited)
+	}
+	if err != nil {
+		t.Fail(err)
+		return
+	}
+	t.exit(ExitOK)
+}
+
+// Reports the error on standard error and exits with its code: the code of an ExitError, ExitUsage for
+// an error caused by invalid flags, or ExitFailure otherwise.
+func (t *Tool) Fail(err error) {
+	code := ExitCode(err)
+	if t.JSON {
+		json.NewEncoder(t.Stderr).Encode(struct {
+			Tool  string `json:"tool"`
+			Error string `json:"error"`
+			Code  int    `json:"code"`
+		}{t.Name, err.Error(), code})
+	} else {
+		fmt.Fprintf(t.Stderr, "%s: %v\n", t.Name, err)
+	}
+	t.exit(code)
+}
+
+// The exit code for the given error.
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Code
+	}
+	return ExitFailure
+}
+
+// Prints results of the tool to standard output. Results are printed even with -quiet.
+func (t *Tool) Printf(format string, args ...any) {
+	fmt.Fprintf(t.Stdout, format, args...)
+}
+
+// Prints informational messages to standard output, unless -quiet was given.
+func (t *Tool) Infof(format string, args ...any) {
+	if !t.Quiet {
+		fmt.Fprintf(t.Stdout, format, args...)
+	}
+}
+
+// Prints detailed progress messages to standard error, only if -verbose was given.
+func (t *Tool) Verbosef(format string, args ...any) {
+	if t.Verbose {
+		fmt.Fprintf(t.Stderr, format, args...)
+	}
+}
+
+// Prints a result of the tool to standard output as indented JSON.
+func (t *Tool) PrintJSON(v any) error {
+	enc := json.NewEncoder(t.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// Opens a Pixi stream for reading, accepting anything pixi.Open does as well as http and https URLs,
+// which are read with range requests using the HTTP credentials in the configuration. Several URLs of
+// mirrors of the same file can be given separated by remote.MirrorSeparator. A missing name is a usage
+// error. Every file the tool opens over HTTP shares the bandwidth and request rate limits of the
+// configuration.
+func (t *Tool) Open(name string) (io.ReadSeekCloser, error) {
+	if name == "" {
+		return nil, UsageError("must specify a Pixi file to read")
+	}
+	t.Verbosef("opening %s\n", name)
+	if strings.HasPrefix(name, "http://") || strings.HasPrefix(name, "https://") {
+		return remote.OpenMirrors(context.Background(), strings.Split(name, remote.MirrorSeparator), remote.Options{
+			User:     t.Config.HTTPUser,
+			Password: t.Config.HTTPPassword,
+			Token:    t.Config.HTTPToken,
+			Throttle: t.Throttle(),
+		})
+	}
+	return pixi.Open(name)
+}
+
+// The throttle limiting the files the tool reads over HTTP to the bandwidth and request rate of the
+// configuration, or nil if neither is limited. Its usage tells how much the tool has read.
+func (t *Tool) Throttle() *remote.Throttle {
+	if t.throttle == nil && (t.Config.HTTPBandwidth > 0 || t.Config.HTTPRequestRate > 0) {
+		t.throttle = remote.NewThrottle(t.Config.HTTPBandwidth, float64(t.Config.HTTPRequestRate))
+	}
+	return t.throttle
+}
+
+// Creates (or truncates) a file for writing, holding an exclusive lock on it until it is closed so that
+// another tool cannot write the same file at once. A missing name is a usage error. If another process
+// holds the lock, this fails unless the wait-for-lock setting is on.
+func (t *Tool) Create(name string) (*pixi.File, error) {
+	if name == "" {
+		return nil, UsageError("must specify a file to write")
+	}
+	t.Verbosef("creating %s\n", name)
+	return pixi.OpenFile(name, pixi.OpenOptions{Mode: pixi.ReadWrite, Create: true, Truncate: true, WaitForLock: t.Config.WaitForLock})
+}
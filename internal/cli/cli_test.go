@@ -0,0 +1,163 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// Creates a tool that writes to buffers and records its exit code rather than exiting.
+func testTool(name string) (*Tool, *bytes.Buffer, *bytes.Buffer, *int) {
+	tool := New(name)
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	tool.Stdout = stdout
+	tool.Stderr = stderr
+	tool.Flags.SetOutput(stderr)
+	code := -1
+	tool.exit = func(c int) {
+		if code < 0 {
+			code = c
+		}
+	}
+	return tool, stdout, stderr, &code
+}
+
+func TestExitCode(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"nil", nil, ExitOK},
+		{"plain", errors.New("boom"), ExitFailure},
+		{"usage", UsageError("bad flag %s", "x"), ExitUsage},
+		{"problems", ProblemsError("found %d problems", 2), ExitProblems},
+		{"wrapped", fmt.Errorf("reading: %w", ProblemsError("bad")), ExitProblems},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := ExitCode(c.err); got != c.want {
+				t.Errorf("expected exit code %d, got %d", c.want, got)
+			}
+		})
+	}
+}
+
+func TestRunExitCodes(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"success", nil, ExitOK},
+		{"failure", errors.New("cannot read"), ExitFailure},
+		{"usage", UsageError("missing -src"), ExitUsage},
+		{"problems", ProblemsError("found 1 problems"), ExitProblems},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			tool, _, stderr, code := testTool("tool")
+			tool.Parse(nil)
+			tool.Run(func() error { return c.err })
+			if *code != c.want {
+				t.Errorf("expected exit code %d, got %d", c.want, *code)
+			}
+			if c.err != nil && stderr.String() != "tool: "+c.err.Error()+"\n" {
+				t.Errorf("unexpected error output %q", stderr.String())
+			}
+		})
+	}
+}
+
+func TestJSONError(t *testing.T) {
+	tool, stdout, stderr, code := testTool("tool")
+	tool.Parse([]string{"-json"})
+	tool.Run(func() error { return UsageError("missing -src") })
+
+	if *code != ExitUsage {
+		t.Errorf("expected exit code %d, got %d", ExitUsage, *code)
+	}
+	if stdout.Len() != 0 {
+		t.Errorf("expected no standard output, got %q", stdout.String())
+	}
+	var report struct {
+		Tool  string `json:"tool"`
+		Error string `json:"error"`
+		Code  int    `json:"code"`
+	}
+	if err := json.Unmarshal(stderr.Bytes(), &report); err != nil {
+		t.Fatalf("error output is not JSON: %v", err)
+	}
+	if report.Tool != "tool" || report.Error != "missing -src" || report.Code != ExitUsage {
+		t.Errorf("unexpected error report %+v", report)
+	}
+}
+
+func TestQuietVerbose(t *testing.T) {
+	cases := []struct {
+		name       string
+		args       []string
+		wantStdout string
+		wantStderr string
+	}{
+		{"default", nil, "info\nresult\n", ""},
+		{"quiet", []string{"-quiet"}, "result\n", ""},
+		{"verbose", []string{"-verbose"}, "info\nresult\n", "detail\n"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			tool, stdout, stderr, _ := testTool("tool")
+			tool.Parse(c.args)
+			tool.Infof("info\n")
+			tool.Verbosef("detail\n")
+			tool.Printf("result\n")
+			if stdout.String() != c.wantStdout {
+				t.Errorf("expected stdout %q, got %q", c.wantStdout, stdout.String())
+			}
+			if stderr.String() != c.wantStderr {
+				t.Errorf("expected stderr %q, got %q", c.wantStderr, stderr.String())
+			}
+		})
+	}
+}
+
+func TestParseUsageErrors(t *testing.T) {
+	cases := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"help", []string{"-h"}, ExitOK},
+		{"unknown flag", []string{"-nope"}, ExitUsage},
+		{"quiet and verbose", []string{"-quiet", "-verbose"}, ExitUsage},
+		{"bad value", []string{"-count", "many"}, ExitUsage},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			tool, _, _, code := testTool("tool")
+			tool.Flags.Int("count", 0, "a count")
+			tool.Parse(c.args)
+			if *code != c.want {
+				t.Errorf("expected exit code %d, got %d", c.want, *code)
+			}
+		})
+	}
+}
+
+func TestOpenMissingName(t *testing.T) {
+	tool, _, _, _ := testTool("tool")
+	_, err := tool.Open("")
+	if ExitCode(err) != ExitUsage {
+		t.Errorf("expected a usage error, got %v", err)
+	}
+	_, err = tool.Open("does-not-exist.pixi")
+	if err == nil || ExitCode(err) != ExitFailure {
+		t.Errorf("expected a failure opening a missing file, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "does-not-exist.pixi") {
+		t.Errorf("expected the error to name the file, got %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+package command
+
+import (
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/internal/cli"
+)
+
+// Lists the image formats that convert can read and write, as JSON.
+var Formats = Command{
+	Name:    "formats",
+	Summary: "list the image formats that can be converted to and from Pixi, as JSON",
+	Setup:   setupFormats,
+}
+
+// Lists the compression methods that Pixi layers can be stored with, as JSON.
+var Codecs = Command{
+	Name:    "codecs",
+	Summary: "list the supported layer compression methods, as JSON",
+	Setup:   setupCodecs,
+}
+
+// Lists the types that the channels (fields) of a layer can have, as JSON.
+var ChannelTypes = Command{
+	Name:    "channel-types",
+	Summary: "list the supported channel (field) types, as JSON",
+	Setup:   setupChannelTypes,
+}
+
+type formatListing struct {
+	Name       string   `json:"name"`
+	Extensions []string `json:"extensions"`
+	ToPixi     bool     `json:"toPixi"`
+	FromPixi   bool     `json:"fromPixi"`
+}
+
+type codecListing struct {
+	ID   uint32 `json:"id"`
+	Name string `json:"name"`
+}
+
+type channelTypeListing struct {
+	ID   uint32 `json:"id"`
+	Name string `json:"name"`
+	Size int    `json:"size"`
+}
+
+func setupFormats(tool *cli.Tool) func() error {
+	return func() error {
+		listing := make([]formatListing, 0, len(imageFormats))
+		for _, format := range imageFormats {
+			listing = append(listing, formatListing{
+				Name:       format.Name,
+				Extensions: format.Extensions,
+				ToPixi:     format.Decode != nil,
+				FromPixi:   format.Encode != nil,
+			})
+		}
+		return tool.PrintJSON(listing)
+	}
+}
+
+func setupCodecs(tool *cli.Tool) func() error {
+	return func() error {
+		compressions := pixi.SupportedCompressions()
+		listing := make([]codecListing, 0, len(compressions))
+		for _, compression := range compressions {
+			listing = append(listing, codecListing{ID: uint32(compression), Name: compression.String()})
+		}
+		return tool.PrintJSON(listing)
+	}
+}
+
+func setupChannelTypes(tool *cli.Tool) func() error {
+	return func() error {
+		fieldTypes := pixi.SupportedFieldTypes()
+		listing := make([]channelTypeListing, 0, len(fieldTypes))
+		for _, fieldType := range fieldTypes {
+			listing = append(listing, channelTypeListing{ID: uint32(fieldType), Name: fieldType.String(), Size: fieldType.Size()})
+		}
+		return tool.PrintJSON(listing)
+	}
+}
@@ -0,0 +1,120 @@
+// Package command implements each subcommand of the pixi command line tool. The standalone tools in
+// cmd/ are thin wrappers that run a single one of these commands under their old name.
+package command
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/owlpinetech/pixi/internal/cli"
+)
+
+// A subcommand of the pixi tool. A command either has a Setup function, which registers the flags of
+// the command on the tool and returns the body to run once they are parsed, or a list of Subcommands
+// chosen between by the next argument.
+type Command struct {
+	Name        string
+	Summary     string
+	Setup       func(tool *cli.Tool) func() error
+	Subcommands []Command
+}
+
+// Every subcommand of the pixi tool, in the order they are listed in the usage message. Filled in by
+// init, as the completion command needs to refer back to the list.
+var Commands []Command
+
+func init() {
+	Commands = []Command{
+		Inspect,
+		Convert,
+		Compress,
+		Compact,
+		Optimize,
+		Index,
+		Retile,
+		Decimate,
+		Stitch,
+		Merge,
+		Assemble,
+		Run,
+		Tag,
+		Verify,
+		Seal,
+		Swab,
+		Serve,
+		Formats,
+		Codecs,
+		ChannelTypes,
+		Vectors,
+		Config,
+		Completion,
+	}
+}
+
+// Finds the subcommand with the given name.
+func (c Command) Lookup(name string) (Command, bool) {
+	for _, sub := range c.Subcommands {
+		if sub.Name == name {
+			return sub, true
+		}
+	}
+	return Command{}, false
+}
+
+// Runs the command under the given name (used as a prefix in messages and the names of subcommands)
+// with the arguments following it on the command line, then exits the process.
+func (c Command) Run(name string, args []string) {
+	if c.Setup != nil {
+		tool := cli.New(name)
+		body := c.Setup(tool)
+		tool.Parse(args)
+		tool.Run(body)
+		return
+	}
+
+	if len(args) < 1 {
+		c.usage(os.Stderr, name)
+		os.Exit(cli.ExitUsage)
+	}
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		if len(args) > 1 {
+			sub, found := c.Lookup(args[1])
+			if !found {
+				fmt.Fprintf(os.Stderr, "%s: unknown command: %s\n", name, args[1])
+				os.Exit(cli.ExitUsage)
+			}
+			sub.Run(name+" "+sub.Name, []string{"-h"})
+			return
+		}
+		c.usage(os.Stdout, name)
+		os.Exit(cli.ExitOK)
+	}
+
+	sub, found := c.Lookup(args[0])
+	if !found {
+		fmt.Fprintf(os.Stderr, "%s: unknown command: %s\n", name, args[0])
+		c.usage(os.Stderr, name)
+		os.Exit(cli.ExitUsage)
+	}
+	sub.Run(name+" "+sub.Name, args[1:])
+}
+
+// Runs the subcommand of the pixi tool named by the first argument with the remaining arguments.
+func Main(name string, args []string) {
+	Command{Name: name, Subcommands: Commands}.Run(name, args)
+}
+
+func (c Command) usage(w io.Writer, name string) {
+	fmt.Fprintf(w, "usage: %s <command> [flags]\n\ncommands:\n", name)
+	width := 0
+	for _, sub := range c.Subcommands {
+		width = max(width, len(sub.Name))
+	}
+	for _, sub := range c.Subcommands {
+		fmt.Fprintf(w, "  %s%s  %s\n", sub.Name, strings.Repeat(" ", width-len(sub.Name)), sub.Summary)
+	}
+	fmt.Fprintf(w, "\nrun '%s help <command>' for the flags of a command\n", name)
+}
@@ -0,0 +1,256 @@
+package command
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/edit"
+	"github.com/owlpinetech/pixi/internal/cli"
+)
+
+// Runs the body of a command with the given arguments, returning what it printed.
+func runSetup(t *testing.T, cmd Command, args ...string) string {
+	t.Helper()
+	tool := cli.New(cmd.Name)
+	stdout := &bytes.Buffer{}
+	tool.Stdout = stdout
+	body := cmd.Setup(tool)
+	if err := tool.Flags.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	if err := body(); err != nil {
+		t.Fatal(err)
+	}
+	return stdout.String()
+}
+
+func TestCodecsListing(t *testing.T) {
+	var listing []codecListing
+	if err := json.Unmarshal([]byte(runSetup(t, Codecs)), &listing); err != nil {
+		t.Fatal(err)
+	}
+	if len(listing) != len(pixi.SupportedCompressions()) {
+		t.Fatalf("expected %d codecs, got %d", len(pixi.SupportedCompressions()), len(listing))
+	}
+	for i, compression := range pixi.SupportedCompressions() {
+		if listing[i].ID != uint32(compression) || listing[i].Name != compression.String() {
+			t.Errorf("expected codec %d to be %v, got %+v", i, compression, listing[i])
+		}
+	}
+}
+
+func TestChannelTypesListing(t *testing.T) {
+	var listing []channelTypeListing
+	if err := json.Unmarshal([]byte(runSetup(t, ChannelTypes)), &listing); err != nil {
+		t.Fatal(err)
+	}
+	if len(listing) != len(pixi.SupportedFieldTypes()) {
+		t.Fatalf("expected %d channel types, got %d", len(pixi.SupportedFieldTypes()), len(listing))
+	}
+	for _, entry := range listing {
+		if entry.Size != pixi.FieldType(entry.ID).Size() {
+			t.Errorf("expected %s to have size %d, got %d", entry.Name, pixi.FieldType(entry.ID).Size(), entry.Size)
+		}
+	}
+}
+
+func TestFormatsListing(t *testing.T) {
+	var listing []formatListing
+	if err := json.Unmarshal([]byte(runSetup(t, Formats)), &listing); err != nil {
+		t.Fatal(err)
+	}
+	if len(listing) != len(imageFormats) {
+		t.Fatalf("expected %d formats, got %d", len(imageFormats), len(listing))
+	}
+	for _, format := range listing {
+		for _, ext := range format.Extensions {
+			found, ok := imageFormatFor("image" + strings.ToUpper(ext))
+			if !ok || found.Name != format.Name {
+				t.Errorf("expected extension %s to select format %s", ext, format.Name)
+			}
+		}
+	}
+}
+
+func TestCompletionCoversCommands(t *testing.T) {
+	for _, shell := range completionShells {
+		t.Run(shell, func(t *testing.T) {
+			script := runSetup(t, Completion, shell)
+			for _, cmd := range Commands {
+				if !strings.Contains(script, cmd.Name) {
+					t.Errorf("expected completion to mention command %s", cmd.Name)
+				}
+			}
+			for _, word := range []string{"-bands", "-tileSize", "-repair", "-order"} {
+				if !strings.Contains(script, strings.TrimPrefix(word, "-")) {
+					t.Errorf("expected completion to mention flag %s", word)
+				}
+			}
+		})
+	}
+}
+
+func TestLookupSubcommands(t *testing.T) {
+	root := Command{Name: "pixi", Subcommands: Commands}
+	convert, found := root.Lookup("convert")
+	if !found {
+		t.Fatal("expected to find convert")
+	}
+	if _, found := convert.Lookup("from"); !found {
+		t.Error("expected convert to have a from subcommand")
+	}
+	if _, found := root.Lookup("from"); found {
+		t.Error("expected from to be found only under convert")
+	}
+	merge, found := root.Lookup("merge")
+	if !found || reflect.ValueOf(merge.Setup).Pointer() != reflect.ValueOf(Stitch.Setup).Pointer() {
+		t.Error("expected merge to run stitch")
+	}
+}
+
+func TestDecimateDryRun(t *testing.T) {
+	dir := t.TempDir()
+	srcFile, dstFile := filepath.Join(dir, "src.pixi"), filepath.Join(dir, "dst.pixi")
+	src, err := os.Create(srcFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := pixi.PixiHeader{Version: pixi.Version, OffsetSize: 4, ByteOrder: binary.LittleEndian}
+	err = edit.WriteContiguousTileOrderPixi(src, header, map[string]string{}, edit.LayerWriter{
+		Layer: pixi.NewLayer("elevation", false, pixi.CompressionNone,
+			pixi.DimensionSet{{Name: "x", Size: 64, TileSize: 16}, {Name: "y", Size: 64, TileSize: 16}},
+			[]pixi.Field{{Name: "z", Type: pixi.FieldFloat32}}),
+		IterFn: func(layer *pixi.Layer, coord pixi.SampleCoordinate) ([]any, map[string]any) {
+			return []any{float32(coord[0] + coord[1])}, nil
+		},
+	})
+	src.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := runSetup(t, Decimate, "-src", srcFile, "-dst", dstFile, "-dryRun")
+	if !strings.Contains(out, "x=32/16, y=32/16") || !strings.Contains(out, "4 tiles") || !strings.Contains(out, "estimated output") {
+		t.Errorf("expected the planned structure to be printed, got %q", out)
+	}
+	if _, err := os.Stat(dstFile); !os.IsNotExist(err) {
+		t.Error("expected a dry run not to write the output")
+	}
+
+	tool := cli.New(Decimate.Name)
+	tool.Stdout = &bytes.Buffer{}
+	body := Decimate.Setup(tool)
+	if err := tool.Flags.Parse([]string{"-src", srcFile, "-dst", dstFile, "-confirmAbove", "100"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := body(); err == nil || !strings.Contains(err.Error(), "-yes") {
+		t.Errorf("expected a large output to require -yes, got %v", err)
+	}
+	runSetup(t, Decimate, "-src", srcFile, "-dst", dstFile, "-confirmAbove", "100", "-yes")
+	if _, err := os.Stat(dstFile); err != nil {
+		t.Errorf("expected the output to be written with -yes, got %v", err)
+	}
+}
+
+func TestThroughputReport(t *testing.T) {
+	dir := t.TempDir()
+	srcFile, dstFile := filepath.Join(dir, "src.pixi"), filepath.Join(dir, "dst.pixi")
+	src, err := os.Create(srcFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := pixi.PixiHeader{Version: pixi.Version, OffsetSize: 4, ByteOrder: binary.LittleEndian}
+	err = edit.WriteContiguousTileOrderPixi(src, header, map[string]string{}, edit.LayerWriter{
+		Layer: pixi.NewLayer("elevation", false, pixi.CompressionNone,
+			pixi.DimensionSet{{Name: "x", Size: 32, TileSize: 16}, {Name: "y", Size: 32, TileSize: 16}},
+			[]pixi.Field{{Name: "z", Type: pixi.FieldUint16}}),
+		IterFn: func(layer *pixi.Layer, coord pixi.SampleCoordinate) ([]any, map[string]any) {
+			return []any{uint16(coord[0])}, nil
+		},
+	})
+	src.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tool := cli.New(Compress.Name)
+	stdout := &bytes.Buffer{}
+	tool.Stdout = stdout
+	tool.Config.ProcessingReport = true
+	body := Compress.Setup(tool)
+	if err := tool.Flags.Parse([]string{"-src", srcFile, "-dst", dstFile, "-compression", "flate"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := body(); err != nil {
+		t.Fatal(err)
+	}
+	if out := stdout.String(); !strings.Contains(out, "1024 samples in") || !strings.Contains(out, "samples/s") || !strings.Contains(out, "compression ratio") {
+		t.Errorf("expected the throughput to be printed, got %q", out)
+	}
+
+	dst, err := pixi.Open(dstFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+	summary, err := pixi.ReadPixi(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, found, err := summary.LookupTag(dst, processingReportTag)
+	if err != nil || !found {
+		t.Fatalf("expected a processing report tag, got %v", err)
+	}
+	var report throughput
+	if err := json.Unmarshal([]byte(value), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Tool != Compress.Name || report.Samples != 1024 || report.SampleBytes != 2048 || report.CompressionRatio <= 1 {
+		t.Errorf("expected the report to describe the compressed output, got %+v", report)
+	}
+}
+
+func TestInspectDescriptionAndLicense(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "described.pixi")
+	file, err := os.Create(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := pixi.PixiHeader{Version: pixi.Version, OffsetSize: 4, ByteOrder: binary.LittleEndian}
+	err = edit.WriteContiguousTileOrderPixi(file, header, map[string]string{}, edit.LayerWriter{
+		Layer: pixi.NewLayer("elevation", false, pixi.CompressionNone,
+			pixi.DimensionSet{{Name: "x", Size: 4, TileSize: 4}},
+			[]pixi.Field{{Name: "z", Type: pixi.FieldUint16}}),
+		IterFn: func(layer *pixi.Layer, coord pixi.SampleCoordinate) ([]any, map[string]any) {
+			return []any{uint16(coord[0])}, nil
+		},
+	})
+	if err == nil {
+		err = pixi.AppendDescription(file, "# Elevation\n\nA test dataset.\n")
+	}
+	if err == nil {
+		err = pixi.AppendLicense(file, pixi.License{SPDX: "CC-BY-4.0", Attribution: "Contains test data", Sources: []string{"https://example.com/dem"}})
+	}
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if out := runSetup(t, Inspect, "-file", fileName, "-describe"); out != "# Elevation\n\nA test dataset.\n" {
+		t.Errorf("expected only the description to be printed, got %q", out)
+	}
+	out := runSetup(t, Inspect, "-file", fileName)
+	if !strings.Contains(out, "Description: 29 bytes") {
+		t.Errorf("expected the summary to mention the description, got %q", out)
+	}
+	if !strings.Contains(out, "License: CC-BY-4.0\n\tAttribution: Contains test data\n\tSource: https://example.com/dem\n") {
+		t.Errorf("expected the summary to show the license, got %q", out)
+	}
+}
@@ -0,0 +1,152 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/owlpinetech/pixi/internal/cli"
+)
+
+// Prints a shell completion script for the pixi tool, generated from the registered commands and their
+// flags so it never falls out of date.
+var Completion = Command{
+	Name:    "completion",
+	Summary: "print a shell completion script for bash, zsh, or fish",
+	Setup:   setupCompletion,
+}
+
+var completionShells = []string{"bash", "zsh", "fish"}
+
+func setupCompletion(tool *cli.Tool) func() error {
+	return func() error {
+		shell := tool.Flags.Arg(0)
+		if !slices.Contains(completionShells, shell) {
+			return cli.UsageError("must specify a shell to complete for: %s", strings.Join(completionShells, ", "))
+		}
+		root := Command{Name: "pixi", Subcommands: Commands}
+		nodes := completionNodes(root, nil)
+		switch shell {
+		case "bash":
+			return writeBashCompletion(tool.Stdout, nodes, false)
+		case "zsh":
+			return writeBashCompletion(tool.Stdout, nodes, true)
+		default:
+			return writeFishCompletion(tool.Stdout, nodes)
+		}
+	}
+}
+
+// A command in the tree of pixi commands, with the names of the commands leading to it from the root
+// and the words that can follow it: its subcommands, or its flags and their usage.
+type completionNode struct {
+	path        []string
+	subcommands []Command
+	flags       []*flag.Flag
+}
+
+// Walks the command tree depth first, so that deeper commands come before the groups containing them.
+func completionNodes(c Command, path []string) []completionNode {
+	nodes := []completionNode{}
+	for _, sub := range c.Subcommands {
+		nodes = append(nodes, completionNodes(sub, append(slices.Clone(path), sub.Name))...)
+	}
+	node := completionNode{path: path, subcommands: c.Subcommands}
+	if c.Setup != nil {
+		tool := cli.New(strings.Join(path, " "))
+		c.Setup(tool)
+		tool.Flags.VisitAll(func(f *flag.Flag) {
+			node.flags = append(node.flags, f)
+		})
+	}
+	return append(nodes, node)
+}
+
+func (n completionNode) words() string {
+	words := []string{}
+	for _, sub := range n.subcommands {
+		words = append(words, sub.Name)
+	}
+	for _, f := range n.flags {
+		words = append(words, "-"+f.Name)
+	}
+	return strings.Join(words, " ")
+}
+
+// Writes a bash completion function. The command path is collected from the non-flag words before the
+// cursor and matched by prefix, deepest command first, so flag values after a command do not matter.
+// For zsh the same function is loaded through bashcompinit.
+func writeBashCompletion(w io.Writer, nodes []completionNode, zsh bool) error {
+	b := &strings.Builder{}
+	if zsh {
+		b.WriteString("#compdef pixi\nautoload -U +X bashcompinit && bashcompinit\n\n")
+	}
+	b.WriteString("_pixi() {\n")
+	b.WriteString("\tlocal cur cmdpath i\n")
+	b.WriteString("\tcur=\"${COMP_WORDS[COMP_CWORD]}\"\n")
+	b.WriteString("\tcmdpath=\"\"\n")
+	b.WriteString("\tfor ((i = 1; i < COMP_CWORD; i++)); do\n")
+	b.WriteString("\t\tcase \"${COMP_WORDS[i]}\" in\n")
+	b.WriteString("\t\t-*) ;;\n")
+	b.WriteString("\t\t*) cmdpath=\"$cmdpath ${COMP_WORDS[i]}\" ;;\n")
+	b.WriteString("\t\tesac\n")
+	b.WriteString("\tdone\n")
+	b.WriteString("\tcase \"$cmdpath\" in\n")
+	for _, node := range nodes {
+		prefix := ""
+		for _, name := range node.path {
+			prefix += " " + name
+		}
+		if len(node.subcommands) > 0 {
+			// a group only completes its subcommands when nothing follows it yet
+			fmt.Fprintf(b, "\t\"%s\")\n", prefix)
+			fmt.Fprintf(b, "\t\tCOMPREPLY=($(compgen -W \"%s\" -- \"$cur\"))\n", node.words())
+		} else {
+			// flags are offered for a leaf command, anything else falls back to file names
+			fmt.Fprintf(b, "\t\"%s\" | \"%s \"*)\n", prefix, prefix)
+			fmt.Fprintf(b, "\t\t[[ $cur == -* ]] && COMPREPLY=($(compgen -W \"%s\" -- \"$cur\"))\n", node.words())
+		}
+		b.WriteString("\t\t;;\n")
+	}
+	b.WriteString("\tesac\n")
+	b.WriteString("}\n\n")
+	b.WriteString("complete -o default -F _pixi pixi\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Writes fish completions, one complete command per subcommand and flag.
+func writeFishCompletion(w io.Writer, nodes []completionNode) error {
+	b := &strings.Builder{}
+	for _, node := range nodes {
+		condition := "__fish_use_subcommand"
+		if len(node.path) > 0 {
+			conditions := []string{}
+			for _, name := range node.path {
+				conditions = append(conditions, "__fish_seen_subcommand_from "+name)
+			}
+			condition = strings.Join(conditions, "; and ")
+			if len(node.subcommands) > 0 {
+				names := []string{}
+				for _, sub := range node.subcommands {
+					names = append(names, sub.Name)
+				}
+				condition += "; and not __fish_seen_subcommand_from " + strings.Join(names, " ")
+			}
+		}
+		for _, sub := range node.subcommands {
+			fmt.Fprintf(b, "complete -c pixi -f -n '%s' -a %s -d %s\n", condition, sub.Name, fishQuote(sub.Summary))
+		}
+		for _, f := range node.flags {
+			fmt.Fprintf(b, "complete -c pixi -n '%s' -o %s -d %s\n", condition, f.Name, fishQuote(f.Usage))
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func fishQuote(s string) string {
+	return "'" + strings.ReplaceAll(strings.ReplaceAll(s, `\`, `\\`), "'", `\'`) + "'"
+}
@@ -0,0 +1,57 @@
+package command
+
+import (
+	"github.com/owlpinetech/pixi/config"
+	"github.com/owlpinetech/pixi/internal/cli"
+)
+
+// Prints the defaults in effect after reading the config file and environment, as JSON, so operators
+// can check which settings the tools will use. Secrets are only reported as set or not set.
+var Config = Command{
+	Name:    "config",
+	Summary: "print the defaults loaded from the config file and environment, as JSON",
+	Setup:   setupConfig,
+}
+
+type configListing struct {
+	Path             string `json:"path"`
+	Compression      string `json:"compression"`
+	TileSize         int    `json:"tileSize"`
+	CacheTiles       int    `json:"cacheTiles"`
+	CacheBytes       int64  `json:"cacheBytes"`
+	MemoryBudget     int64  `json:"memoryBudget"`
+	Workers          int    `json:"workers"`
+	WaitForLock      bool   `json:"waitForLock"`
+	HTTPUser         string `json:"httpUser"`
+	HTTPPassword     bool   `json:"httpPasswordSet"`
+	HTTPToken        bool   `json:"httpTokenSet"`
+	HTTPBandwidth    int64  `json:"httpBandwidth"`
+	HTTPRequestRate  int    `json:"httpRequestRate"`
+	ProcessingReport bool   `json:"processingReport"`
+}
+
+func setupConfig(tool *cli.Tool) func() error {
+	return func() error {
+		path, err := config.Path()
+		if err != nil {
+			path = ""
+		}
+		opts := tool.Config
+		return tool.PrintJSON(configListing{
+			Path:             path,
+			Compression:      opts.Compression.String(),
+			TileSize:         opts.TileSize,
+			CacheTiles:       opts.CacheTiles,
+			CacheBytes:       opts.CacheBytes,
+			MemoryBudget:     opts.MemoryBudget,
+			Workers:          opts.Workers,
+			WaitForLock:      opts.WaitForLock,
+			HTTPUser:         opts.HTTPUser,
+			HTTPPassword:     opts.HTTPPassword != "",
+			HTTPToken:        opts.HTTPToken != "",
+			HTTPBandwidth:    opts.HTTPBandwidth,
+			HTTPRequestRate:  opts.HTTPRequestRate,
+			ProcessingReport: opts.ProcessingReport,
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package command
+
+import (
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/edit"
+	"github.com/owlpinetech/pixi/internal/cli"
+)
+
+// Converts images to and from Pixi files, with the direction given by a subcommand: "to" converts an
+// image into a new Pixi file, and "from" exports the first layer of a Pixi file as an image.
+var Convert = Command{
+	Name:    "convert",
+	Summary: "convert images to or from Pixi files",
+	Subcommands: []Command{
+		{Name: "to", Summary: "convert an image into a new Pixi file", Setup: setupConvertTo},
+		{Name: "from", Summary: "export the first layer of a Pixi file as an image", Setup: setupConvertFrom},
+	},
+}
+
+func setupConvertTo(tool *cli.Tool) func() error {
+	srcFile := tool.Flags.String("src", "", "file to convert to Pixi")
+	dstFile := tool.Flags.String("dst", "", "name of the resulting Pixi file")
+	tileSize := tool.Flags.Int("tileSize", tool.Config.TileSize, "the size of tiles to generate in the Pixi file, if 0 will be calculated automatically")
+	allowSlow := tool.Flags.Bool("allowSlowTiling", false, "convert even with a tile size known to be very slow to read")
+	comp := tool.Flags.String("compression", tool.Config.Compression.String(), "compression to be used for data in Pixi, by name (see the codecs command) or number")
+	overviews := tool.Flags.Int("overviews", 0, "number of downsampled overview layers to add after the image layer")
+	mask := tool.Flags.Bool("mask", false, "add a mask layer derived from the transparency of the image")
+
+	return func() error {
+		return otherToPixi(tool, *srcFile, *dstFile, *tileSize, *comp, *overviews, *mask, *allowSlow)
+	}
+}
+
+func setupConvertFrom(tool *cli.Tool) func() error {
+	srcFile := tool.Flags.String("src", "", "Pixi file to convert")
+	dstFile := tool.Flags.String("dst", "", "name of the file resulting from Pixi conversion")
+	bands := tool.Flags.String("bands", "", "image channels to fill from layer bands instead of using the color model, e.g. r=B4,g=B3,b=B2 or gray=elevation")
+	stretch := tool.Flags.String("stretch", "", "value range of each band mapped to the full channel range, e.g. B4=0:3000,B3=0:3000")
+
+	return func() error {
+		mapping, err := parseChannelMapping(*bands, *stretch)
+		if err != nil {
+			return err
+		}
+		return pixiToOther(tool, *srcFile, *dstFile, mapping)
+	}
+}
+
+func otherToPixi(tool *cli.Tool, srcFile string, dstFile string, tileSize int, comp string, overviews int, mask bool, allowSlow bool) error {
+	if srcFile == "" {
+		return cli.UsageError("must specify an image file to convert")
+	}
+	compression, err := pixi.ParseCompression(comp)
+	if err != nil {
+		return &cli.ExitError{Code: cli.ExitUsage, Err: err}
+	}
+
+	rdFile, err := os.Open(srcFile)
+	if err != nil {
+		return err
+	}
+	defer rdFile.Close()
+
+	pixiFile, err := tool.Create(dstFile)
+	if err != nil {
+		return err
+	}
+	defer pixiFile.Close()
+
+	options := edit.FromImageOptions{
+		Compression:     compression,
+		ByteOrder:       binary.BigEndian,
+		XTileSize:       tileSize,
+		YTileSize:       tileSize,
+		Tags:            map[string]string{},
+		Overviews:       overviews,
+		Mask:            mask,
+		AllowSlowTiling: allowSlow,
+	}
+
+	format, found := imageFormatFor(srcFile)
+	if !found || format.Decode == nil {
+		return pixi.UnsupportedError("image format not yet supported for conversion to Pixi")
+	}
+	started := time.Now()
+	img, err := format.Decode(rdFile)
+	if err != nil {
+		return err
+	}
+	err = edit.PixiFromImage(pixiFile, img, options)
+	if err != nil {
+		return slowTilingHint(err)
+	}
+	err = finishOutput(tool, pixiFile, started)
+	if err != nil {
+		return err
+	}
+	return pixiFile.Close()
+}
+
+func pixiToOther(tool *cli.Tool, srcFile string, dstFile string, mapping *edit.ChannelMapping) error {
+	pixiFile, err := tool.Open(srcFile)
+	if err != nil {
+		return err
+	}
+	defer pixiFile.Close()
+
+	imgFile, err := tool.Create(dstFile)
+	if err != nil {
+		return err
+	}
+	defer imgFile.Close()
+
+	pixiSum, err := pixi.ReadPixi(pixiFile)
+	if err != nil {
+		return err
+	}
+
+	tool.Verbosef("read pixi summary: offset size %d, %d layers, %d tag sections\n", pixiSum.Header.OffsetSize, len(pixiSum.Layers), len(pixiSum.Tags))
+
+	var img image.Image
+	if mapping != nil {
+		img, err = edit.LayerAsImageMapped(pixiFile, pixiSum.Header, pixiSum.Layers[0], *mapping)
+	} else {
+		img, err = edit.LayerAsImage(pixiFile, &pixiSum, pixiSum.Layers[0])
+	}
+	if err != nil {
+		return err
+	}
+
+	format, found := imageFormatFor(dstFile)
+	if !found || format.Encode == nil {
+		return pixi.UnsupportedError("image format not yet supported for conversion from Pixi")
+	}
+	return format.Encode(imgFile, img)
+}
+
+// An image file format that can be converted to or from Pixi, identified by the extension of the file
+// name. A nil Decode or Encode means the format can only be converted in the other direction.
+type imageFormat struct {
+	Name       string
+	Extensions []string
+	Decode     func(r io.Reader) (image.Image, error)
+	Encode     func(w io.Writer, img image.Image) error
+}
+
+// The image formats supported by convert, listed by the formats command.
+var imageFormats = []imageFormat{
+	{
+		Name:       "png",
+		Extensions: []string{".png"},
+		Decode:     png.Decode,
+		Encode:     png.Encode,
+	},
+	{
+		Name:       "jpeg",
+		Extensions: []string{".jpg", ".jpeg"},
+		Decode:     jpeg.Decode,
+		Encode: func(w io.Writer, img image.Image) error {
+			return jpeg.Encode(w, img, nil)
+		},
+	},
+}
+
+// Finds the image format matching the extension of the file name.
+func imageFormatFor(fileName string) (imageFormat, bool) {
+	ext := strings.ToLower(path.Ext(fileName))
+	for _, format := range imageFormats {
+		if slices.Contains(format.Extensions, ext) {
+			return format, true
+		}
+	}
+	return imageFormat{}, false
+}
+
+// Parses the -bands and -stretch flags into a channel mapping, or returns nil if no bands were given.
+func parseChannelMapping(bands string, stretch string) (*edit.ChannelMapping, error) {
+	if bands == "" {
+		if stretch != "" {
+			return nil, cli.UsageError("-stretch requires -bands")
+		}
+		return nil, nil
+	}
+	mapping := &edit.ChannelMapping{Channels: map[string]string{}, Stretch: map[string]edit.Stretch{}}
+	for _, pair := range strings.Split(bands, ",") {
+		channel, band, found := strings.Cut(pair, "=")
+		if !found {
+			return nil, cli.UsageError("invalid band mapping '%s', expected channel=band", pair)
+		}
+		mapping.Channels[channel] = band
+	}
+	if stretch == "" {
+		return mapping, nil
+	}
+	for _, pair := range strings.Split(stretch, ",") {
+		band, bounds, found := strings.Cut(pair, "=")
+		lo, hi, rangeFound := strings.Cut(bounds, ":")
+		if !found || !rangeFound {
+			return nil, cli.UsageError("invalid stretch '%s', expected band=min:max", pair)
+		}
+		minVal, err := strconv.ParseFloat(lo, 64)
+		if err != nil {
+			return nil, err
+		}
+		maxVal, err := strconv.ParseFloat(hi, 64)
+		if err != nil {
+			return nil, err
+		}
+		mapping.Stretch[band] = edit.Stretch{Min: minVal, Max: maxVal}
+	}
+	return mapping, nil
+}
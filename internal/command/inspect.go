@@ -0,0 +1,137 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/internal/cli"
+)
+
+// Prints a summary of the header, tags, layers, and space use of a Pixi file, or with -dump every on-disk
+// field, or with -describe the Markdown description of the dataset.
+var Inspect = Command{
+	Name:    "inspect",
+	Summary: "print a summary of the header, tags, layers, and space use of a file",
+	Setup:   setupInspect,
+}
+
+func setupInspect(tool *cli.Tool) func() error {
+	fileName := tool.Flags.String("file", "", "name of the pixi file to open")
+	dump := tool.Flags.Bool("dump", false, "print every on-disk field with its byte offset and size")
+	describe := tool.Flags.Bool("describe", false, "print only the Markdown description of the dataset")
+
+	return func() error {
+		return inspect(tool, *fileName, *dump, *describe)
+	}
+}
+
+func inspect(tool *cli.Tool, fileName string, dump bool, describe bool) error {
+	pixiFile, err := tool.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer pixiFile.Close()
+
+	pixiSum, err := pixi.ReadPixi(pixiFile)
+	if err != nil {
+		return err
+	}
+
+	if dump {
+		return pixiSum.Dump(tool.Stdout)
+	}
+	description, described, err := pixiSum.Description()
+	if err != nil {
+		return err
+	}
+	if describe {
+		if !described {
+			return fmt.Errorf("%s has no description", fileName)
+		}
+		if tool.JSON {
+			return tool.PrintJSON(map[string]string{"description": description})
+		}
+		tool.Printf("%s\n", strings.TrimSuffix(description, "\n"))
+		return nil
+	}
+
+	tool.Infof("Inspecting %s\n", fileName)
+	tool.Printf("\tVersion: %d\n", pixiSum.Header.Version)
+	tool.Printf("\tOffset size: %d\n", pixiSum.Header.OffsetSize)
+	tool.Printf("\tByte order: %s\n", pixiSum.Header.ByteOrder)
+	tool.Printf("\tChecksum: %s\n", pixiSum.Header.Checksum)
+	if pixiSum.Header.Version >= 3 {
+		tool.Printf("\tRequired features: %s\n", pixiSum.Header.RequiredFeatures)
+		tool.Printf("\tOptional features: %s\n", pixiSum.Header.OptionalFeatures)
+	}
+	if described {
+		tool.Printf("\tDescription: %d bytes (see -describe)\n", len(description))
+	}
+	license, licensed, err := pixiSum.License()
+	if err != nil {
+		tool.Printf("\tLicense: invalid, %v\n", err)
+	} else if licensed {
+		tool.Printf("\tLicense: %s\n", license.SPDX)
+		if license.Attribution != "" {
+			tool.Printf("\tAttribution: %s\n", license.Attribution)
+		}
+		for _, source := range license.Sources {
+			tool.Printf("\tSource: %s\n", source)
+		}
+	}
+	tool.Printf("Tag Sections: %d\n", len(pixiSum.Tags))
+	for sectionInd, section := range pixiSum.Tags {
+		tool.Printf("\tSection %d\n", sectionInd)
+		for k, v := range section.All() {
+			tool.Printf("\t\t%s: %s\n", k, v)
+		}
+		for k, v := range section.AllBinary() {
+			tool.Printf("\t\t%s: (%d bytes)\n", k, len(v))
+		}
+	}
+	tool.Printf("Layers: %d\n", len(pixiSum.Layers))
+	for layerInd, layer := range pixiSum.Layers {
+		tool.Printf("\tLayer %d: %s\n", layerInd, layer.Name)
+		tool.Printf("\t\tSeparated: %v\n", layer.Separated)
+		tool.Printf("\t\tCompression: %s\n", layer.Compression)
+		tool.Printf("\t\tDimensions: %d\n", len(layer.Dimensions))
+		for dimInd, dim := range layer.Dimensions {
+			tool.Printf("\t\t\tDim %d (%s): %d / %d (%d tiles)\n", dimInd, dim.Name, dim.Size, dim.TileSize, dim.Tiles())
+			if dim.HasMetadata() {
+				tool.Printf("\t\t\t\tUnit: %q, direction: %s, resolution: %g\n", dim.Unit, dim.Direction, dim.Resolution)
+			}
+		}
+		tool.Printf("\t\tFields: %d\n", len(layer.Fields))
+		for fieldInd, field := range layer.Fields {
+			tool.Printf("\t\t\tField %d (%s) : %s\n", fieldInd, field.Name, field.Type)
+		}
+		for _, section := range layer.Tags {
+			tool.Printf("\t\tTag Section\n")
+			for k, v := range section.All() {
+				tool.Printf("\t\t\t%s: %s\n", k, v)
+			}
+			for k, v := range section.AllBinary() {
+				tool.Printf("\t\t\t%s: (%d bytes)\n", k, len(v))
+			}
+		}
+	}
+	for _, layer := range pixiSum.AllLayers() {
+		if layer.Scratch {
+			tool.Printf("Scratch Layer: %s\n", layer.Name)
+		}
+	}
+
+	space, err := pixiSum.SpaceReport(pixiFile)
+	if err != nil {
+		return err
+	}
+	tool.Printf("Space: %d bytes\n", space.FileBytes)
+	tool.Printf("\tHeader: %d\n", space.HeaderBytes)
+	tool.Printf("\tTags: %d\n", space.TagBytes)
+	tool.Printf("\tLayer headers: %d\n", space.LayerHeaderBytes)
+	tool.Printf("\tTiles: %d\n", space.TileBytes)
+	tool.Printf("\tPadding: %d\n", space.PaddingBytes)
+	tool.Printf("\tDead: %d (%.1f%%)\n", space.DeadBytes, space.DeadFraction()*100)
+	return nil
+}
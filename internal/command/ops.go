@@ -0,0 +1,612 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/edit"
+	"github.com/owlpinetech/pixi/internal/cli"
+)
+
+// Rewrites every layer of a file with a different compression.
+var Compress = Command{
+	Name:    "compress",
+	Summary: "rewrite a file with every layer in a different compression",
+	Setup:   setupCompress,
+}
+
+// Rewrites a file keeping only its live sections, in place with -inPlace.
+var Compact = Command{
+	Name:    "compact",
+	Summary: "rewrite a file without the dead bytes left by in-place edits",
+	Setup:   setupCompact,
+}
+
+// Rewrites a file laid out for remote readers, in place with -inPlace.
+var Optimize = Command{
+	Name:    "optimize",
+	Summary: "rewrite a file with its headers, tags and overviews first, for reading over a network",
+	Setup:   setupOptimize,
+}
+
+// Rewrites a file with value indices of some fields added to its layers.
+var Index = Command{
+	Name:    "index",
+	Summary: "rewrite a file with per-tile value indices of fields, for finding tiles without reading them",
+	Setup:   setupIndex,
+}
+
+// Rewrites every layer of a file with different tile sizes.
+var Retile = Command{
+	Name:    "retile",
+	Summary: "rewrite a file with the tiles of every layer resized",
+	Setup:   setupRetile,
+}
+
+// Downsamples every layer of a file by a whole factor.
+var Decimate = Command{
+	Name:    "decimate",
+	Summary: "downsample every layer of a file by a whole factor",
+	Setup:   setupDecimate,
+}
+
+// Combines a layer from each of several files into one layer of a new file.
+var Stitch = Command{
+	Name:    "stitch",
+	Summary: "combine a layer from each of several files, placed at offsets, into one file",
+	Setup:   setupStitch,
+}
+
+// An alias of Stitch, under the name the command is commonly looked for by.
+var Merge = Command{
+	Name:    "merge",
+	Summary: "alias of stitch",
+	Setup:   setupStitch,
+}
+
+// Combines shards of a dataset, each produced separately with some of its tiles, into one file.
+var Assemble = Command{
+	Name:    "assemble",
+	Summary: "combine the shards of a dataset, each holding some of its tiles, into one file",
+	Setup:   setupAssemble,
+}
+
+func setupCompress(tool *cli.Tool) func() error {
+	srcFile := tool.Flags.String("src", "", "name of the pixi file to compress")
+	dstFile := tool.Flags.String("dst", "", "name of the resulting pixi file")
+	comp := tool.Flags.String("compression", tool.Config.Compression.String(), "compression of the resulting layers, by name (see the codecs command) or number")
+	workers := tool.Flags.Int("workers", tool.Config.Workers, "number of tiles compressed in parallel, or 0 for one per CPU")
+
+	return func() error {
+		compression, err := pixi.ParseCompression(*comp)
+		if err != nil {
+			return &cli.ExitError{Code: cli.ExitUsage, Err: err}
+		}
+		budget := memoryBudget(tool)
+		defer reportMemoryUsage(tool, budget)
+		return runOperation(tool, *srcFile, *dstFile, func(ctx context.Context, dst io.WriteSeeker, src io.ReadSeeker) error {
+			return edit.Compress(ctx, dst, src, edit.CompressOptions{
+				Compression: compression,
+				Workers:     *workers,
+				Progress:    progressReporter(tool),
+				Budget:      budget,
+			})
+		})
+	}
+}
+
+func setupCompact(tool *cli.Tool) func() error {
+	srcFile := tool.Flags.String("src", "", "name of the pixi file to compact")
+	dstFile := tool.Flags.String("dst", "", "name of the resulting pixi file")
+	inPlace := tool.Flags.Bool("inPlace", false, "replace the source file with its compacted copy, written to a temporary file first")
+
+	return func() error {
+		var report edit.CompactReport
+		var err error
+		if *inPlace {
+			if *srcFile == "" || *dstFile != "" {
+				return cli.UsageError("must specify only a source Pixi file to compact in place")
+			}
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer stop()
+			started := time.Now()
+			report, err = edit.CompactFile(ctx, *srcFile, tool.Config.WaitForLock, progressReporter(tool))
+			if err == nil {
+				err = finishFile(tool, *srcFile, started)
+			}
+		} else {
+			err = runOperation(tool, *srcFile, *dstFile, func(ctx context.Context, dst io.WriteSeeker, src io.ReadSeeker) error {
+				report, err = edit.Compact(ctx, dst, src, progressReporter(tool))
+				return err
+			})
+		}
+		if err != nil {
+			return err
+		}
+		if tool.JSON {
+			return tool.PrintJSON(report)
+		}
+		tool.Infof("reclaimed %d of %d bytes\n", report.ReclaimedBytes, report.SourceBytes)
+		return nil
+	}
+}
+
+func setupOptimize(tool *cli.Tool) func() error {
+	srcFile := tool.Flags.String("src", "", "name of the pixi file to optimize")
+	dstFile := tool.Flags.String("dst", "", "name of the resulting pixi file")
+	inPlace := tool.Flags.Bool("inPlace", false, "replace the source file with its optimized copy, written to a temporary file first")
+	cloud := tool.Flags.Bool("cloud", false, "write a file meeting the cloud-optimized profile, failing if the layers cannot meet it")
+
+	return func() error {
+		var report edit.OptimizeReport
+		var err error
+		options := edit.OptimizeOptions{Progress: progressReporter(tool), CloudOptimized: *cloud}
+		if *inPlace {
+			if *srcFile == "" || *dstFile != "" {
+				return cli.UsageError("must specify only a source Pixi file to optimize in place")
+			}
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer stop()
+			started := time.Now()
+			report, err = edit.OptimizeFile(ctx, *srcFile, tool.Config.WaitForLock, options)
+			if err == nil {
+				err = finishFile(tool, *srcFile, started)
+			}
+		} else {
+			err = runOperation(tool, *srcFile, *dstFile, func(ctx context.Context, dst io.WriteSeeker, src io.ReadSeeker) error {
+				report, err = edit.Optimize(ctx, dst, src, options)
+				return err
+			})
+		}
+		if err != nil {
+			return err
+		}
+		if tool.JSON {
+			return tool.PrintJSON(report)
+		}
+		tool.Infof("structure in the first %d bytes, overviews in the first %d of %d bytes\n", report.StructureBytes, report.OverviewBytes, report.TotalBytes)
+		return nil
+	}
+}
+
+func setupIndex(tool *cli.Tool) func() error {
+	srcFile := tool.Flags.String("src", "", "name of the pixi file to index")
+	dstFile := tool.Flags.String("dst", "", "name of the resulting pixi file")
+	minMax := tool.Flags.String("minmax", "", "comma separated fields to index by the minimum and maximum of each tile")
+	bloom := tool.Flags.String("bloom", "", "comma separated categorical fields to index by a bloom filter of each tile")
+
+	return func() error {
+		fields := map[string]pixi.ValueIndexKind{}
+		for _, list := range []struct {
+			names string
+			kind  pixi.ValueIndexKind
+		}{{*minMax, pixi.ValueIndexMinMax}, {*bloom, pixi.ValueIndexBloom}} {
+			for _, name := range strings.Split(list.names, ",") {
+				if name == "" {
+					continue
+				}
+				if _, found := fields[name]; found {
+					return cli.UsageError("field '%s' can only have one index", name)
+				}
+				fields[name] = list.kind
+			}
+		}
+		if len(fields) == 0 {
+			return cli.UsageError("must specify fields to index with -minmax or -bloom")
+		}
+		return runOperation(tool, *srcFile, *dstFile, func(ctx context.Context, dst io.WriteSeeker, src io.ReadSeeker) error {
+			return edit.IndexValues(ctx, dst, src, fields, progressReporter(tool))
+		})
+	}
+}
+
+func setupRetile(tool *cli.Tool) func() error {
+	srcFile := tool.Flags.String("src", "", "name of the pixi file to retile")
+	dstFile := tool.Flags.String("dst", "", "name of the resulting pixi file")
+	tileSize := tool.Flags.Int("tileSize", tool.Config.TileSize, "new tile size of every dimension")
+	dimTileSizes := tool.Flags.String("dimensionTileSizes", "", "new tile sizes of individual dimensions, e.g. x=512,y=256")
+	allowSlow := tool.Flags.Bool("allowSlowTiling", false, "retile even to tile sizes known to be very slow to read")
+	preview := addPreviewFlags(tool)
+
+	return func() error {
+		sizes, err := parseDimensionSizes(*dimTileSizes)
+		if err != nil {
+			return err
+		}
+		if *tileSize <= 0 && len(sizes) == 0 {
+			return cli.UsageError("must specify a tile size")
+		}
+		budget := memoryBudget(tool)
+		defer reportMemoryUsage(tool, budget)
+		options := edit.RetileOptions{
+			TileSize:           *tileSize,
+			DimensionTileSizes: sizes,
+			CacheTiles:         tool.Config.CacheTiles,
+			Budget:             budget,
+			Progress:           progressReporter(tool),
+			AllowSlowTiling:    *allowSlow,
+		}
+		proceed, err := preview.confirm(tool, *srcFile, func(ctx context.Context, src io.ReadSeeker) (edit.OutputPlan, error) {
+			plan, err := edit.PlanRetile(ctx, src, options)
+			return plan, slowTilingHint(err)
+		})
+		if err != nil || !proceed {
+			return err
+		}
+		return runOperation(tool, *srcFile, *dstFile, func(ctx context.Context, dst io.WriteSeeker, src io.ReadSeeker) error {
+			return slowTilingHint(edit.Retile(ctx, dst, src, options))
+		})
+	}
+}
+
+func setupDecimate(tool *cli.Tool) func() error {
+	srcFile := tool.Flags.String("src", "", "name of the pixi file to decimate")
+	dstFile := tool.Flags.String("dst", "", "name of the resulting pixi file")
+	factor := tool.Flags.Int("factor", 2, "factor every dimension is reduced by")
+	methodName := tool.Flags.String("method", "mean", "how each sample is computed from the samples it covers: mean or nearest")
+	preview := addPreviewFlags(tool)
+
+	return func() error {
+		var method edit.DecimateMethod
+		switch *methodName {
+		case "mean":
+			method = edit.DecimateMean
+		case "nearest":
+			method = edit.DecimateNearest
+		default:
+			return cli.UsageError("unknown decimation method: %s", *methodName)
+		}
+		if *factor < 1 {
+			return cli.UsageError("decimation factor must be at least 1")
+		}
+		budget := memoryBudget(tool)
+		defer reportMemoryUsage(tool, budget)
+		options := edit.DecimateOptions{
+			Factor:     *factor,
+			Method:     method,
+			CacheTiles: tool.Config.CacheTiles,
+			Budget:     budget,
+			Workers:    tool.Config.Workers,
+			Progress:   progressReporter(tool),
+		}
+		proceed, err := preview.confirm(tool, *srcFile, func(ctx context.Context, src io.ReadSeeker) (edit.OutputPlan, error) {
+			return edit.PlanDecimate(ctx, src, options)
+		})
+		if err != nil || !proceed {
+			return err
+		}
+		return runOperation(tool, *srcFile, *dstFile, func(ctx context.Context, dst io.WriteSeeker, src io.ReadSeeker) error {
+			return edit.Decimate(ctx, dst, src, options)
+		})
+	}
+}
+
+func setupStitch(tool *cli.Tool) func() error {
+	dstFile := tool.Flags.String("dst", "", "name of the resulting pixi file")
+	layerName := tool.Flags.String("layer", "", "name of the layer to take from each source, instead of the first layer")
+	blendName := tool.Flags.String("blend", "replace", "how overlapping sources are combined: replace, priority (later sources unless missing) or feather")
+	featherWidth := tool.Flags.Int("feather", 16, "number of samples from the edge of a source over which it is feathered in")
+	noData := tool.Flags.String("nodata", "", "value of every field marking a missing sample, e.g. -9999 or NaN")
+	datumShifts := tool.Flags.String("datumShifts", "", "comma separated datum=shift pairs, the amount added to values measured from each datum to measure them from that of the first source")
+	byOrigin := tool.Flags.Bool("origins", false, "treat the position of each source as the georeferenced coordinate of its first sample instead of an offset")
+
+	return func() error {
+		if tool.Flags.NArg() == 0 {
+			return cli.UsageError("must specify source files as arguments, each as name@offset, e.g. west.pixi@0,0 east.pixi@1024,0")
+		}
+		blend, ok := map[string]edit.StitchBlend{
+			"replace":  edit.StitchReplace,
+			"priority": edit.StitchPriority,
+			"feather":  edit.StitchFeather,
+		}[*blendName]
+		if !ok {
+			return cli.UsageError("unknown blending '%s', expected replace, priority or feather", *blendName)
+		}
+		var noDataValues []float64
+		if *noData != "" {
+			value, err := strconv.ParseFloat(*noData, 64)
+			if err != nil {
+				return cli.UsageError("invalid no-data value '%s'", *noData)
+			}
+			noDataValues = []float64{value}
+		}
+		shifts := map[string]float64{}
+		if *datumShifts != "" {
+			for _, pair := range strings.Split(*datumShifts, ",") {
+				datum, text, found := strings.Cut(pair, "=")
+				shift, err := strconv.ParseFloat(text, 64)
+				if !found || err != nil {
+					return cli.UsageError("invalid datum shift '%s', expected datum=shift", pair)
+				}
+				shifts[datum] = shift
+			}
+		}
+
+		names := make([]string, tool.Flags.NArg())
+		var offsets [][]int
+		var origins [][]float64
+		for i, arg := range tool.Flags.Args() {
+			if *byOrigin {
+				name, origin, err := parseStitchOrigin(arg)
+				if err != nil {
+					return err
+				}
+				names[i], origins = name, append(origins, origin)
+				continue
+			}
+			name, offset, err := parseStitchSource(arg)
+			if err != nil {
+				return err
+			}
+			names[i], offsets = name, append(offsets, offset)
+		}
+
+		srcs := make([]io.ReadSeeker, len(names))
+		for i, name := range names {
+			src, err := tool.Open(name)
+			if err != nil {
+				return err
+			}
+			defer src.Close()
+			srcs[i] = src
+		}
+		dst, err := tool.Create(*dstFile)
+		if err != nil {
+			return err
+		}
+		defer dst.Close()
+
+		budget := memoryBudget(tool)
+		defer reportMemoryUsage(tool, budget)
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		err = edit.Stitch(ctx, dst, srcs, edit.StitchOptions{
+			Layer:        *layerName,
+			Offsets:      offsets,
+			Origins:      origins,
+			Blend:        blend,
+			FeatherWidth: *featherWidth,
+			NoData:       noDataValues,
+			DatumShifts:  shifts,
+			CacheTiles:   tool.Config.CacheTiles,
+			Budget:       budget,
+			Workers:      tool.Config.Workers,
+			Progress:     progressReporter(tool),
+		})
+		if err != nil {
+			return err
+		}
+		return dst.Close()
+	}
+}
+
+func setupAssemble(tool *cli.Tool) func() error {
+	dstFile := tool.Flags.String("dst", "", "name of the resulting pixi file")
+	allowMissing := tool.Flags.Bool("allowMissing", false, "leave tiles held by no shard unwritten instead of failing")
+	checkOwners := tool.Flags.Bool("checkOwners", false, "fail if a tile is held by a shard other than the one consistent hashing assigns it to")
+
+	return func() error {
+		if tool.Flags.NArg() == 0 {
+			return cli.UsageError("must specify every shard of the dataset as arguments, in any order")
+		}
+		srcs := make([]io.ReadSeeker, tool.Flags.NArg())
+		for i, name := range tool.Flags.Args() {
+			src, err := tool.Open(name)
+			if err != nil {
+				return err
+			}
+			defer src.Close()
+			srcs[i] = src
+		}
+		dst, err := tool.Create(*dstFile)
+		if err != nil {
+			return err
+		}
+		defer dst.Close()
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		options := edit.AssembleOptions{
+			AllowMissing: *allowMissing,
+			Progress:     progressReporter(tool),
+		}
+		if *checkOwners {
+			options.Owner = edit.ShardOwner
+		}
+		err = edit.AssembleShards(ctx, dst, srcs, options)
+		if err != nil {
+			return err
+		}
+		return dst.Close()
+	}
+}
+
+// The flags of commands that preview the structure of their output before writing it.
+type previewFlags struct {
+	dryRun       *bool
+	yes          *bool
+	confirmAbove *int64
+}
+
+func addPreviewFlags(tool *cli.Tool) previewFlags {
+	flags := previewFlags{
+		dryRun:       tool.Flags.Bool("dryRun", false, "only print the structure, estimated size and estimated time of the output"),
+		yes:          new(bool),
+		confirmAbove: tool.Flags.Int64("confirmAbove", 1<<30, "estimated output size in bytes above which -yes is required to proceed"),
+	}
+	tool.Flags.BoolVar(flags.yes, "yes", false, "proceed even if the output is estimated to be larger than -confirmAbove")
+	tool.Flags.BoolVar(flags.yes, "force", false, "same as -yes")
+	return flags
+}
+
+// Plans the operation on the source and prints the plan, reporting whether to go on with writing the
+// output: not after a dry run, and only with -yes if the output is estimated to be too large.
+func (f previewFlags) confirm(tool *cli.Tool, srcFile string, plan func(ctx context.Context, src io.ReadSeeker) (edit.OutputPlan, error)) (bool, error) {
+	src, err := tool.Open(srcFile)
+	if err != nil {
+		return false, err
+	}
+	defer src.Close()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	out, err := plan(ctx, src)
+	if err != nil {
+		return false, err
+	}
+
+	if tool.JSON && *f.dryRun {
+		return false, tool.PrintJSON(out)
+	}
+	report := tool.Infof
+	if *f.dryRun {
+		report = tool.Printf
+	}
+	for _, layer := range out.Layers {
+		dims := make([]string, len(layer.Dimensions))
+		for i, dim := range layer.Dimensions {
+			dims[i] = fmt.Sprintf("%s=%d/%d", dim.Name, dim.Size, dim.TileSize)
+		}
+		fields := make([]string, len(layer.Fields))
+		for i, field := range layer.Fields {
+			fields[i] = field.Name + " " + field.Type.String()
+		}
+		report("layer '%s': %s; fields %s; %s, %d tiles, about %d bytes\n", layer.Name, strings.Join(dims, ", "),
+			strings.Join(fields, ", "), layer.Compression, layer.Tiles, layer.Bytes)
+	}
+	report("estimated output: %d bytes, written in about %s\n", out.Bytes, out.Duration.Round(time.Millisecond))
+
+	if *f.dryRun {
+		return false, nil
+	}
+	if out.Bytes > *f.confirmAbove && !*f.yes {
+		return false, cli.UsageError("the output is estimated at %d bytes, more than %d; run again with -yes to proceed", out.Bytes, *f.confirmAbove)
+	}
+	return true, nil
+}
+
+// Opens the source, creates the destination, and runs the operation between them, cancelling it if the
+// tool is interrupted. The throughput of the operation is reported once it is done (see finishOutput).
+func runOperation(tool *cli.Tool, srcFile string, dstFile string, op func(ctx context.Context, dst io.WriteSeeker, src io.ReadSeeker) error) error {
+	src, err := tool.Open(srcFile)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := tool.Create(dstFile)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	started := time.Now()
+	err = op(ctx, dst, src)
+	if err != nil {
+		return err
+	}
+	err = finishOutput(tool, dst, started)
+	if err != nil {
+		return err
+	}
+	return dst.Close()
+}
+
+// Returns the memory budget configured for operations, or nil if memory is only bounded by tile counts.
+func memoryBudget(tool *cli.Tool) *pixi.MemoryBudget {
+	if tool.Config.MemoryBudget <= 0 {
+		return nil
+	}
+	return pixi.NewMemoryBudget(tool.Config.MemoryBudget)
+}
+
+// Reports the most memory held at once under the budget with -verbose, if there is a budget.
+func reportMemoryUsage(tool *cli.Tool, budget *pixi.MemoryBudget) {
+	if budget == nil {
+		return
+	}
+	tool.Verbosef("peak memory: %d of %d bytes\n", budget.Peak(), budget.Limit())
+}
+
+// Reports the progress of an operation with -verbose, each time another percent of the tiles is done.
+func progressReporter(tool *cli.Tool) edit.ProgressFunc {
+	lastPercent := -1
+	return func(done int, total int) {
+		percent := done * 100 / max(total, 1)
+		if percent != lastPercent {
+			lastPercent = percent
+			tool.Verbosef("%d%% (%d of %d tiles)\n", percent, done, total)
+		}
+	}
+}
+
+// Turns a rejection of slow tile sizes into a usage error pointing out the flag that allows them.
+func slowTilingHint(err error) error {
+	if errors.Is(err, pixi.ErrSlowTiling) {
+		return cli.UsageError("%w (use -allowSlowTiling to write it anyway)", err)
+	}
+	return err
+}
+
+// Parses a list of per-dimension sizes such as x=512,y=256.
+func parseDimensionSizes(list string) (map[string]int, error) {
+	sizes := map[string]int{}
+	if list == "" {
+		return sizes, nil
+	}
+	for _, pair := range strings.Split(list, ",") {
+		name, value, found := strings.Cut(pair, "=")
+		size, err := strconv.Atoi(value)
+		if !found || err != nil || size <= 0 {
+			return nil, cli.UsageError("invalid dimension size '%s', expected name=size", pair)
+		}
+		sizes[name] = size
+	}
+	return sizes, nil
+}
+
+// Parses a stitch source argument of the form name@x,y,... into the file name and its offset.
+func parseStitchSource(arg string) (string, []int, error) {
+	at := strings.LastIndex(arg, "@")
+	if at < 0 {
+		return "", nil, cli.UsageError("invalid source '%s', expected name@offset", arg)
+	}
+	parts := strings.Split(arg[at+1:], ",")
+	offset := make([]int, len(parts))
+	for i, part := range parts {
+		v, err := strconv.Atoi(part)
+		if err != nil || v < 0 {
+			return "", nil, cli.UsageError("invalid offset in source '%s', expected non-negative integers", arg)
+		}
+		offset[i] = v
+	}
+	return arg[:at], offset, nil
+}
+
+// Parses a source of the stitch command given with -origins, as name@x,y,... with the georeferenced
+// coordinate of its first sample.
+func parseStitchOrigin(arg string) (string, []float64, error) {
+	at := strings.LastIndex(arg, "@")
+	if at < 0 {
+		return "", nil, cli.UsageError("invalid source '%s', expected name@origin", arg)
+	}
+	parts := strings.Split(arg[at+1:], ",")
+	origin := make([]float64, len(parts))
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return "", nil, cli.UsageError("invalid origin in source '%s', expected numbers", arg)
+		}
+		origin[i] = v
+	}
+	return arg[:at], origin, nil
+}
@@ -0,0 +1,119 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/edit"
+	"github.com/owlpinetech/pixi/internal/cli"
+)
+
+// Runs a processing pipeline described by a JSON spec file (see edit.PipelineSpec).
+var Run = Command{
+	Name:    "run",
+	Summary: "run a processing pipeline (stitch, crop, retile, cast, band math, resample, compress, registered operators) described by a JSON spec",
+	Setup:   setupRun,
+}
+
+func setupRun(tool *cli.Tool) func() error {
+	specFile := tool.Flags.String("spec", "", "name of the JSON pipeline spec to run")
+	srcFile := tool.Flags.String("src", "", "name of the pixi file to read, instead of the input of the spec")
+	dstFile := tool.Flags.String("dst", "", "name of the resulting pixi file, instead of the output of the spec")
+	check := tool.Flags.Bool("check", false, "only check that the steps fit the input and print the resulting layer")
+	listOperators := tool.Flags.Bool("operators", false, "list the operators registered for use in specs and exit")
+
+	return func() error {
+		if *listOperators {
+			for _, name := range edit.RegisteredOperators() {
+				tool.Printf("%s\n", name)
+			}
+			return nil
+		}
+		if *specFile == "" {
+			return cli.UsageError("must specify a pipeline spec")
+		}
+		specReader, err := os.Open(*specFile)
+		if err != nil {
+			return err
+		}
+		defer specReader.Close()
+		spec, err := edit.ReadPipelineSpec(specReader)
+		if err != nil {
+			return cli.UsageError("%w", err)
+		}
+		if *srcFile != "" {
+			if len(spec.Inputs) > 0 {
+				return cli.UsageError("cannot replace the inputs of a spec that stitches several together")
+			}
+			spec.Input = *srcFile
+		}
+		if *dstFile != "" {
+			spec.Output = *dstFile
+		}
+
+		views := []*edit.LayerView{}
+		for _, name := range spec.InputFiles() {
+			src, err := tool.Open(name)
+			if err != nil {
+				return err
+			}
+			defer src.Close()
+			srcPixi, err := pixi.ReadPixi(src)
+			if err != nil {
+				return err
+			}
+			layer, err := spec.SourceLayer(srcPixi)
+			if err != nil {
+				return cli.UsageError("%s: %w", name, err)
+			}
+			views = append(views, edit.NewLayerView(src, srcPixi.Header, layer))
+		}
+		pipeline := spec.Build(views...)
+		if pipeline.Err() != nil {
+			return cli.UsageError("%w", pipeline.Err())
+		}
+
+		if *check {
+			dims := make([]string, len(pipeline.Dimensions()))
+			for i, dim := range pipeline.Dimensions() {
+				dims[i] = fmt.Sprintf("%s=%d", dim.Name, dim.Size)
+			}
+			fields := make([]string, len(pipeline.Fields()))
+			for i, field := range pipeline.Fields() {
+				fields[i] = field.Name + " " + field.Type.String()
+			}
+			tool.Printf("dimensions: %s\nfields: %s\n", strings.Join(dims, ", "), strings.Join(fields, ", "))
+			return nil
+		}
+
+		budget := memoryBudget(tool)
+		defer reportMemoryUsage(tool, budget)
+		pipeline.SetOptions(edit.PipelineOptions{
+			Workers:    tool.Config.Workers,
+			CacheTiles: tool.Config.CacheTiles,
+			Budget:     budget,
+		})
+		dst, err := tool.Create(spec.Output)
+		if err != nil {
+			return err
+		}
+		defer dst.Close()
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		started := time.Now()
+		err = pipeline.Write(ctx, dst, progressReporter(tool))
+		if err != nil {
+			return err
+		}
+		err = finishOutput(tool, dst, started)
+		if err != nil {
+			return err
+		}
+		return dst.Close()
+	}
+}
@@ -0,0 +1,61 @@
+package command
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/internal/cli"
+)
+
+// Seals a finished Pixi file for publication by embedding the size and hash of its content in a tag
+// section at its end, and with -sidecar also writes a sha256sum file for the whole sealed file.
+var Seal = Command{
+	Name:    "seal",
+	Summary: "embed a content hash in a finished file so mirrors can check downloads quickly",
+	Setup:   setupSeal,
+}
+
+func setupSeal(tool *cli.Tool) func() error {
+	fileName := tool.Flags.String("file", "", "name of the pixi file to seal in place")
+	sidecar := tool.Flags.Bool("sidecar", false, "also write the hash of the sealed file to a .sha256 file beside it")
+
+	return func() error {
+		if *fileName == "" {
+			return cli.UsageError("must specify a Pixi file to seal")
+		}
+		file, err := pixi.OpenFile(*fileName, pixi.OpenOptions{Mode: pixi.ReadWrite, WaitForLock: tool.Config.WaitForLock})
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		digest, err := pixi.SealContent(file)
+		if err != nil {
+			return err
+		}
+		tool.Verbosef("sealed %d bytes of content\n", digest.Size)
+		if tool.JSON {
+			tool.PrintJSON(map[string]any{pixi.ContentSizeTag: digest.Size, pixi.ContentHashTag: digest.String()})
+		} else {
+			tool.Printf("%s\n", digest)
+		}
+
+		if *sidecar {
+			size, err := file.Seek(0, io.SeekEnd)
+			if err != nil {
+				return err
+			}
+			whole, err := pixi.DigestContent(file, size)
+			if err != nil {
+				return err
+			}
+			err = os.WriteFile(*fileName+".sha256", []byte(whole.Sidecar(filepath.Base(*fileName))), 0666)
+			if err != nil {
+				return err
+			}
+		}
+		return file.Close()
+	}
+}
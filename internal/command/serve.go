@@ -0,0 +1,67 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/owlpinetech/pixi/internal/cli"
+	"github.com/owlpinetech/pixi/serve"
+)
+
+// Serves the Pixi files in a directory over HTTP until interrupted, reloading files as they change.
+var Serve = Command{
+	Name:    "serve",
+	Summary: "serve the pixi files in a directory over HTTP, reloading them when they change",
+	Setup:   setupServe,
+}
+
+func setupServe(tool *cli.Tool) func() error {
+	dirName := tool.Flags.String("dir", ".", "directory of the pixi files to serve")
+	addr := tool.Flags.String("addr", "localhost:8080", "address to listen on")
+	checkInterval := tool.Flags.Duration("checkInterval", time.Second, "how long a file is trusted not to have changed before it is checked again")
+	maxRegionSamples := tool.Flags.Int64("maxRegionSamples", serve.DefaultMaxRegionSamples, "largest number of samples a region request may send, or -1 for no limit; larger regions are reduced to fit")
+	rejectOversize := tool.Flags.Bool("rejectOversizeRegions", false, "refuse regions over the limit instead of reducing them")
+	rateLimit := tool.Flags.Float64("rateLimit", 0, "region requests each client may make per second, or 0 for no limit")
+	rateBurst := tool.Flags.Int("rateBurst", 0, "region requests each client may make at once, or 0 for the rate limit rounded up")
+	cacheControl := tool.Flags.String("cacheControl", serve.DefaultCacheControl, "Cache-Control header sent with summaries and tiles")
+
+	return func() error {
+		info, err := os.Stat(*dirName)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return cli.UsageError("%s is not a directory", *dirName)
+		}
+
+		dir := serve.NewDirectory(*dirName, serve.Options{
+			CacheBytes:            tool.Config.CacheBytes,
+			CheckInterval:         *checkInterval,
+			CacheControl:          *cacheControl,
+			MaxRegionSamples:      *maxRegionSamples,
+			RejectOversizeRegions: *rejectOversize,
+			RateLimit:             *rateLimit,
+			RateBurst:             *rateBurst,
+		})
+		defer dir.Close()
+		server := &http.Server{Addr: *addr, Handler: dir.Handler()}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		go func() {
+			<-ctx.Done()
+			server.Shutdown(context.Background())
+		}()
+
+		tool.Infof("serving %s on http://%s\n", *dirName, *addr)
+		err = server.ListenAndServe()
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	}
+}
@@ -0,0 +1,70 @@
+package command
+
+import (
+	"encoding/binary"
+	"strings"
+
+	"github.com/owlpinetech/pixi/edit"
+	"github.com/owlpinetech/pixi/internal/cli"
+)
+
+// Copies a Pixi file, rewriting it in the byte order given by -order.
+var Swab = Command{
+	Name:    "swab",
+	Summary: "rewrite a file in a different byte order",
+	Setup:   setupSwab,
+}
+
+func setupSwab(tool *cli.Tool) func() error {
+	srcFile := tool.Flags.String("src", "", "name of the pixi file to convert")
+	dstFile := tool.Flags.String("dst", "", "name of the resulting pixi file")
+	orderName := tool.Flags.String("order", "native", "byte order of the resulting file: big, little, or native")
+
+	return func() error {
+		if *srcFile == "" || *dstFile == "" {
+			return cli.UsageError("must specify both a source and destination Pixi file")
+		}
+		order, err := parseByteOrder(*orderName)
+		if err != nil {
+			return err
+		}
+		return swapFile(tool, *srcFile, *dstFile, order)
+	}
+}
+
+func parseByteOrder(name string) (binary.ByteOrder, error) {
+	switch strings.ToLower(name) {
+	case "big":
+		return binary.BigEndian, nil
+	case "little":
+		return binary.LittleEndian, nil
+	case "native":
+		// the header only understands the two concrete orders, so resolve native to one of them
+		if binary.NativeEndian.Uint16([]byte{0x00, 0x01}) == 0x0001 {
+			return binary.BigEndian, nil
+		}
+		return binary.LittleEndian, nil
+	default:
+		return nil, cli.UsageError("unknown byte order: %s", name)
+	}
+}
+
+func swapFile(tool *cli.Tool, srcFile string, dstFile string, order binary.ByteOrder) error {
+	rdFile, err := tool.Open(srcFile)
+	if err != nil {
+		return err
+	}
+	defer rdFile.Close()
+
+	wrFile, err := tool.Create(dstFile)
+	if err != nil {
+		return err
+	}
+	defer wrFile.Close()
+
+	err = edit.ConvertByteOrder(wrFile, rdFile, order)
+	if err != nil {
+		return err
+	}
+	return wrFile.Close()
+}
@@ -0,0 +1,124 @@
+package command
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/internal/cli"
+)
+
+// Lists the tags of a Pixi file, or of one of its layers with -layer. With -key, prints only the value
+// of that tag, reading just the keys of the other tags.
+var Tag = Command{
+	Name:    "tag",
+	Summary: "list the tags of a file or layer, or print the value of one tag",
+	Setup:   setupTag,
+}
+
+func setupTag(tool *cli.Tool) func() error {
+	fileName := tool.Flags.String("file", "", "name of the pixi file to read")
+	layerName := tool.Flags.String("layer", "", "name of the layer to read the tags of, instead of the file tags")
+	key := tool.Flags.String("key", "", "print only the value of the tag with this key")
+
+	return func() error {
+		pixiFile, err := tool.Open(*fileName)
+		if err != nil {
+			return err
+		}
+		defer pixiFile.Close()
+
+		summary, err := pixi.ReadPixiLayers(pixiFile)
+		if err != nil {
+			return err
+		}
+		var layer *pixi.Layer
+		if *layerName != "" {
+			for _, l := range summary.Layers {
+				if l.Name == *layerName {
+					layer = l
+					break
+				}
+			}
+			if layer == nil {
+				return cli.UsageError("no layer named '%s'", *layerName)
+			}
+		}
+
+		if *key != "" {
+			return printTag(tool, pixiFile, summary, layer, *key)
+		}
+		return listTags(tool, pixiFile, summary, layer)
+	}
+}
+
+func printTag(tool *cli.Tool, r io.ReadSeeker, summary pixi.Pixi, layer *pixi.Layer, key string) error {
+	var value string
+	var found bool
+	var err error
+	if layer != nil {
+		value, found, err = layer.LookupTag(r, summary.Header, key)
+	} else {
+		value, found, err = summary.LookupTag(r, key)
+	}
+	if err != nil {
+		return err
+	}
+	if found {
+		if tool.JSON {
+			return tool.PrintJSON(map[string]string{key: value})
+		}
+		tool.Printf("%s\n", value)
+		return nil
+	}
+
+	var payload []byte
+	if layer != nil {
+		payload, found, err = layer.LookupBinaryTag(r, summary.Header, key)
+	} else {
+		payload, found, err = summary.LookupBinaryTag(r, key)
+	}
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("no tag with key '%s'", key)
+	}
+	if tool.JSON {
+		return tool.PrintJSON(map[string][]byte{key: payload})
+	}
+	_, err = tool.Stdout.Write(payload)
+	return err
+}
+
+func listTags(tool *cli.Tool, r io.ReadSeeker, summary pixi.Pixi, layer *pixi.Layer) error {
+	sections := summary.TagsIter(r)
+	if layer != nil {
+		sections = layer.TagsIter(r, summary.Header)
+	}
+	merged := &pixi.TagSection{}
+	for section, err := range sections {
+		if err != nil {
+			return err
+		}
+		merged.Merge(section)
+	}
+
+	if tool.JSON {
+		tags := map[string]any{}
+		for k, v := range merged.All() {
+			tags[k] = v
+		}
+		for k, v := range merged.AllBinary() {
+			tags[k] = v
+		}
+		return tool.PrintJSON(tags)
+	}
+	for k, v := range merged.All() {
+		tool.Printf("%s: %s\n", k, v)
+	}
+	for k, v := range merged.AllBinary() {
+		tool.Printf("%s: (%d bytes)\n", k, len(v))
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package command
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/internal/cli"
+)
+
+// The key of the tag holding the processing report appended to the files written by a tool when the
+// processing-report setting is on, a JSON object with the fields of throughput.
+const processingReportTag = "pixi-processing-report"
+
+// The throughput of a run of a tool that wrote a Pixi file, so that operators can compare runs on the
+// same data and notice when one slows down.
+type throughput struct {
+	Tool             string  `json:"tool"`
+	Finished         string  `json:"finished"`
+	Seconds          float64 `json:"seconds"`
+	Samples          int64   `json:"samples"`     // The samples of every layer written.
+	SampleBytes      int64   `json:"sampleBytes"` // The size of the samples once decoded.
+	DataBytes        int64   `json:"dataBytes"`   // The size of the tiles as stored.
+	FileBytes        int64   `json:"fileBytes"`
+	SamplesPerSecond float64 `json:"samplesPerSecond"`
+	MBPerSecond      float64 `json:"mbPerSecond"` // Megabytes of the file written per second.
+	CompressionRatio float64 `json:"compressionRatio"`
+}
+
+// Measures the throughput of a run that wrote the Pixi file in r, taking the given time since started.
+func measureThroughput(tool string, r io.ReadSeeker, started time.Time, finished time.Time) (throughput, error) {
+	_, err := r.Seek(0, io.SeekStart)
+	if err != nil {
+		return throughput{}, err
+	}
+	summary, err := pixi.ReadPixiLayers(r)
+	if err != nil {
+		return throughput{}, err
+	}
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return throughput{}, err
+	}
+
+	t := throughput{
+		Tool:      tool,
+		Finished:  finished.UTC().Format(time.RFC3339),
+		Seconds:   finished.Sub(started).Seconds(),
+		DataBytes: summary.DiskDataBytes(),
+		FileBytes: size,
+	}
+	for _, layer := range summary.Layers {
+		samples := int64(layer.Dimensions.Samples())
+		t.Samples += samples
+		t.SampleBytes += samples * int64(layer.SampleSize())
+	}
+	if t.Seconds > 0 {
+		t.SamplesPerSecond = float64(t.Samples) / t.Seconds
+		t.MBPerSecond = float64(t.FileBytes) / 1e6 / t.Seconds
+	}
+	if t.DataBytes > 0 {
+		t.CompressionRatio = float64(t.SampleBytes) / float64(t.DataBytes)
+	}
+	return t, nil
+}
+
+// Reports the throughput of a run of the tool that wrote the Pixi file f, and with the processing-report
+// setting appends it to the file as a tag section. Results printed as JSON are left uncluttered.
+func finishOutput(tool *cli.Tool, f io.ReadWriteSeeker, started time.Time) error {
+	t, err := measureThroughput(tool.Name, f, started, time.Now())
+	if err != nil {
+		return err
+	}
+	if !tool.JSON {
+		tool.Infof("%d samples in %.2fs: %.0f samples/s, %.1f MB/s, compression ratio %.2f\n",
+			t.Samples, t.Seconds, t.SamplesPerSecond, t.MBPerSecond, t.CompressionRatio)
+	}
+	if !tool.Config.ProcessingReport {
+		return nil
+	}
+	report, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	section := &pixi.TagSection{}
+	section.Set(processingReportTag, string(report))
+	return pixi.AppendTags(f, section)
+}
+
+// Reports the throughput of a run that replaced the named file in place, as finishOutput does.
+func finishFile(tool *cli.Tool, name string, started time.Time) error {
+	mode := pixi.ReadOnly
+	if tool.Config.ProcessingReport {
+		mode = pixi.ReadWrite
+	}
+	file, err := pixi.OpenFile(name, pixi.OpenOptions{Mode: mode, WaitForLock: tool.Config.WaitForLock})
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	err = finishOutput(tool, file, started)
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,30 @@
+package command
+
+import (
+	"github.com/owlpinetech/pixi/internal/cli"
+	"github.com/owlpinetech/pixi/pixitest"
+)
+
+// Writes the canonical test vectors, tiny files covering every variant of the format with descriptions
+// of what reading them must produce, for checking other implementations of the format against this one.
+var Vectors = Command{
+	Name:    "vectors",
+	Summary: "write the test vectors other implementations of the format check themselves against",
+	Setup:   setupVectors,
+}
+
+func setupVectors(tool *cli.Tool) func() error {
+	dir := tool.Flags.String("dir", "", "directory to write the test vector files and their descriptions to")
+
+	return func() error {
+		if *dir == "" {
+			return cli.UsageError("must specify a directory to write the test vectors to")
+		}
+		descriptions, err := pixitest.WriteVectors(*dir)
+		if err != nil {
+			return err
+		}
+		tool.Verbosef("wrote %d test vectors to %s\n", len(descriptions), *dir)
+		return nil
+	}
+}
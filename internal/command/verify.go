@@ -0,0 +1,127 @@
+package command
+
+import (
+	"errors"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/edit"
+	"github.com/owlpinetech/pixi/internal/cli"
+)
+
+// Checks the structure and tile checksums of a Pixi file, and with -repair writes a repaired copy of it.
+// With -content, only checks the file against the content seal written by 'pixi seal', in one pass, and
+// with -cloud, only checks that the file meets the cloud-optimized profile written by 'pixi optimize -cloud'.
+// Exits with cli.ExitProblems if problems were found and not repaired.
+var Verify = Command{
+	Name:    "verify",
+	Summary: "check the structure and tile checksums of a file, optionally repairing it",
+	Setup:   setupVerify,
+}
+
+func setupVerify(tool *cli.Tool) func() error {
+	srcFile := tool.Flags.String("src", "", "name of the pixi file to check")
+	repair := tool.Flags.Bool("repair", false, "write a repaired copy of the file to the destination")
+	dstFile := tool.Flags.String("dst", "", "name of the repaired pixi file, required with -repair")
+	content := tool.Flags.Bool("content", false, "only check the file against its content seal, without reading its tiles")
+	cloud := tool.Flags.Bool("cloud", false, "only check that the file is laid out by the cloud-optimized profile, without reading its tiles")
+
+	return func() error {
+		if *srcFile == "" {
+			return cli.UsageError("must specify a Pixi file to check")
+		}
+		if *content {
+			return verifyContent(tool, *srcFile)
+		}
+		if *cloud {
+			return verifyCloud(tool, *srcFile)
+		}
+		if *repair && *dstFile == "" {
+			return cli.UsageError("must specify a destination Pixi file to repair into")
+		}
+
+		report, err := checkFile(tool, *srcFile, *dstFile, *repair)
+		if err != nil {
+			return err
+		}
+		printReport(tool, report)
+		if !report.OK() && !*repair {
+			return cli.ProblemsError("found %d problems", len(report.Problems))
+		}
+		return nil
+	}
+}
+
+func printReport(tool *cli.Tool, report edit.RepairReport) {
+	if tool.JSON {
+		tool.PrintJSON(report)
+		return
+	}
+	tool.Printf("Layers: %d\n", report.Layers)
+	tool.Printf("Tag sections: %d\n", report.Tags)
+	tool.Printf("Relocated tiles: %d\n", report.RelocatedTiles)
+	tool.Printf("Lost tiles: %d\n", report.LostTiles)
+	tool.Printf("Trailing bytes: %d\n", report.TrailingBytes)
+	for _, problem := range report.Problems {
+		tool.Printf("\t%s\n", problem)
+	}
+}
+
+func checkFile(tool *cli.Tool, srcFile string, dstFile string, repair bool) (edit.RepairReport, error) {
+	rdFile, err := tool.Open(srcFile)
+	if err != nil {
+		return edit.RepairReport{}, err
+	}
+	defer rdFile.Close()
+
+	if !repair {
+		return edit.CheckFile(rdFile)
+	}
+
+	wrFile, err := tool.Create(dstFile)
+	if err != nil {
+		return edit.RepairReport{}, err
+	}
+	defer wrFile.Close()
+
+	report, err := edit.Repair(wrFile, rdFile)
+	if err != nil {
+		return report, err
+	}
+	return report, wrFile.Close()
+}
+
+func verifyContent(tool *cli.Tool, srcFile string) error {
+	rdFile, err := tool.Open(srcFile)
+	if err != nil {
+		return err
+	}
+	defer rdFile.Close()
+
+	digest, err := pixi.VerifyContent(rdFile)
+	if errors.Is(err, pixi.ErrUnsealed) || errors.Is(err, pixi.ErrContentMismatch) {
+		return cli.ProblemsError("%v", err)
+	}
+	if err != nil {
+		return err
+	}
+	tool.Infof("content matches seal %s\n", digest)
+	return nil
+}
+
+func verifyCloud(tool *cli.Tool, srcFile string) error {
+	rdFile, err := tool.Open(srcFile)
+	if err != nil {
+		return err
+	}
+	defer rdFile.Close()
+
+	err = edit.CheckCloudOptimized(rdFile)
+	if errors.Is(err, edit.ErrNotCloudOptimized) {
+		return cli.ProblemsError("%v", err)
+	}
+	if err != nil {
+		return err
+	}
+	tool.Infof("file is cloud optimized\n")
+	return nil
+}
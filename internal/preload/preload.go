@@ -0,0 +1,175 @@
+// Package preload runs work ahead of the code consuming it on a bounded number of goroutines, in the two
+// shapes shared by the readers and writers of Pixi files: results computed in parallel but consumed in
+// order, such as tiles encoded ahead of being written, and fire-and-forget background tasks, such as
+// tiles read ahead of being requested. Neither leaves goroutines running once it is done with: Ordered
+// returns only after every task it started has finished, and a Group can be waited on.
+package preload
+
+import (
+	"context"
+	"iter"
+	"sync"
+)
+
+// A bounded set of goroutines working on behalf of a common task, in the manner of errgroup: the first
+// task to fail cancels the context of the others, and Wait reports its error.
+type Group struct {
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	slots  chan struct{}
+	wait   sync.WaitGroup
+	once   sync.Once
+	err    error
+}
+
+// Creates a group running at most limit tasks at once, or any number if limit is not positive, with a
+// context derived from ctx that is cancelled when a task fails or the group is waited on.
+func NewGroup(ctx context.Context, limit int) *Group {
+	g := &Group{}
+	g.ctx, g.cancel = context.WithCancelCause(ctx)
+	if limit > 0 {
+		g.slots = make(chan struct{}, limit)
+	}
+	return g
+}
+
+// The context passed to the tasks of the group.
+func (g *Group) Context() context.Context {
+	return g.ctx
+}
+
+// Runs the task on a new goroutine, first waiting until fewer than the limit are running. The task is not
+// started, and the error of the context recorded instead, if the context is done first.
+func (g *Group) Go(task func(ctx context.Context) error) {
+	if g.slots != nil {
+		select {
+		case g.slots <- struct{}{}:
+		case <-g.ctx.Done():
+			g.fail(context.Cause(g.ctx))
+			return
+		}
+	}
+	g.start(task)
+}
+
+// Runs the task on a new goroutine if fewer than the limit are running and the context is not done,
+// reporting whether it was started.
+func (g *Group) TryGo(task func(ctx context.Context) error) bool {
+	if g.ctx.Err() != nil {
+		return false
+	}
+	if g.slots != nil {
+		select {
+		case g.slots <- struct{}{}:
+		default:
+			return false
+		}
+	}
+	g.start(task)
+	return true
+}
+
+func (g *Group) start(task func(ctx context.Context) error) {
+	g.wait.Add(1)
+	go func() {
+		defer g.wait.Done()
+		if g.slots != nil {
+			defer func() { <-g.slots }()
+		}
+		if err := task(g.ctx); err != nil {
+			g.fail(err)
+		}
+	}()
+}
+
+func (g *Group) fail(err error) {
+	g.once.Do(func() {
+		g.err = err
+		g.cancel(err)
+	})
+}
+
+// Waits for every task started so far to finish, returning the first error recorded, if any.
+func (g *Group) Wait() error {
+	g.wait.Wait()
+	g.cancel(context.Canceled)
+	return g.err
+}
+
+// Runs fn on each item of items on up to workers goroutines, yielding the results in the order of their
+// items. Items are taken from items on the goroutine ranging over the results, so items may be produced
+// by code that is not safe for concurrent use, and no more than workers items are taken ahead of the
+// result last yielded, so that only that many results are held at once. The first error, whether from fn
+// or the context being done, is yielded in place of a result and ends the iteration. However iteration
+// ends, the context passed to fn is cancelled and every call of fn started has returned before ranging
+// over the results finishes.
+func Ordered[In, Out any](ctx context.Context, workers int, items iter.Seq[In], fn func(ctx context.Context, item In) (Out, error)) iter.Seq2[Out, error] {
+	return OrderedWhile(ctx, workers, items, func() bool { return true }, fn)
+}
+
+// Runs fn on items as with Ordered, but only takes another item ahead of the result last yielded while
+// more reports true, so that what is held can be bounded by something other than a count, such as a
+// memory budget. When more reports false, results are yielded until it reports true or none are pending.
+// more is called on the goroutine ranging over the results, and not before an item taken while no results
+// are pending, which is always taken so that the iteration makes progress.
+func OrderedWhile[In, Out any](ctx context.Context, workers int, items iter.Seq[In], more func() bool, fn func(ctx context.Context, item In) (Out, error)) iter.Seq2[Out, error] {
+	type result struct {
+		value Out
+		err   error
+	}
+	return func(yield func(Out, error) bool) {
+		group := NewGroup(ctx, 0)
+		defer func() {
+			group.cancel(context.Canceled)
+			group.Wait()
+		}()
+		pending := make([]chan result, 0, max(workers, 1))
+		// yields the oldest result, reporting whether to carry on
+		next := func() bool {
+			var done result
+			// a result already computed is taken even if the context is done since
+			select {
+			case done = <-pending[0]:
+			default:
+				select {
+				case done = <-pending[0]:
+				case <-group.Context().Done():
+					done.err = context.Cause(group.Context())
+				}
+			}
+			pending = pending[1:]
+			if done.err != nil {
+				var zero Out
+				yield(zero, done.err)
+				return false
+			}
+			return yield(done.value, nil)
+		}
+
+		for item := range items {
+			if err := group.Context().Err(); err != nil {
+				var zero Out
+				yield(zero, context.Cause(group.Context()))
+				return
+			}
+			// each result channel is buffered, so calls still running after iteration ends never block
+			done := make(chan result, 1)
+			group.Go(func(ctx context.Context) error {
+				value, err := fn(ctx, item)
+				done <- result{value: value, err: err}
+				return nil
+			})
+			pending = append(pending, done)
+			for len(pending) >= max(workers, 1) || len(pending) > 0 && !more() {
+				if !next() {
+					return
+				}
+			}
+		}
+		for len(pending) > 0 {
+			if !next() {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package preload
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"slices"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Fails the test if goroutines started during it are still running shortly after it ends.
+func checkLeaks(t *testing.T) {
+	t.Helper()
+	before := runtime.NumGoroutine()
+	t.Cleanup(func() {
+		deadline := time.Now().Add(time.Second)
+		for runtime.NumGoroutine() > before {
+			if time.Now().After(deadline) {
+				t.Errorf("expected %d goroutines after the test, got %d", before, runtime.NumGoroutine())
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	})
+}
+
+func count(n int) func(yield func(int) bool) {
+	return func(yield func(int) bool) {
+		for i := range n {
+			if !yield(i) {
+				return
+			}
+		}
+	}
+}
+
+func TestOrderedKeepsOrderAndBound(t *testing.T) {
+	checkLeaks(t)
+	var running, most atomic.Int32
+	results := []int{}
+	for value, err := range Ordered(context.Background(), 4, count(50), func(ctx context.Context, i int) (int, error) {
+		now := running.Add(1)
+		defer running.Add(-1)
+		for {
+			prev := most.Load()
+			if now <= prev || most.CompareAndSwap(prev, now) {
+				break
+			}
+		}
+		// later items finish first, so results arrive out of order
+		time.Sleep(time.Duration(50-i) * 20 * time.Microsecond)
+		return i * i, nil
+	}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		results = append(results, value)
+	}
+	for i, value := range results {
+		if value != i*i {
+			t.Fatalf("expected result %d to be %d, got %d", i, i*i, value)
+		}
+	}
+	if len(results) != 50 || most.Load() > 4 {
+		t.Errorf("expected 50 results with at most 4 running at once, got %d with %d", len(results), most.Load())
+	}
+}
+
+func TestOrderedWhileBoundsAhead(t *testing.T) {
+	checkLeaks(t)
+	// items are taken ahead only while fewer than two are held, even though four workers are allowed
+	held, most := 0, 0
+	items := func(yield func(int) bool) {
+		for i := range 20 {
+			held++
+			most = max(most, held)
+			if !yield(i) {
+				return
+			}
+		}
+	}
+	results := []int{}
+	for value, err := range OrderedWhile(context.Background(), 4, items, func() bool { return held < 2 }, func(ctx context.Context, i int) (int, error) {
+		return i, nil
+	}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		held--
+		results = append(results, value)
+	}
+	if !slices.Equal(results, slices.Collect(count(20))) {
+		t.Errorf("expected every result in order, got %v", results)
+	}
+	if most != 2 {
+		t.Errorf("expected at most 2 items held at once, got %d", most)
+	}
+}
+
+func TestOrderedStopsAtFirstError(t *testing.T) {
+	checkLeaks(t)
+	errBad := errors.New("bad item")
+	taken := 0
+	items := func(yield func(int) bool) {
+		for i := range 100 {
+			taken++
+			if !yield(i) {
+				return
+			}
+		}
+	}
+	values := []int{}
+	var last error
+	for value, err := range Ordered(context.Background(), 3, items, func(ctx context.Context, i int) (int, error) {
+		if i == 5 {
+			return 0, errBad
+		}
+		return i, nil
+	}) {
+		if err != nil {
+			last = err
+			continue
+		}
+		values = append(values, value)
+	}
+	if !errors.Is(last, errBad) || !slices.Equal(values, []int{0, 1, 2, 3, 4}) {
+		t.Errorf("expected the results before the failing item then its error, got %v and %v", values, last)
+	}
+	if taken > 5+3 {
+		t.Errorf("expected no more than the workers to be taken past the failing item, took %d", taken)
+	}
+}
+
+func TestOrderedCancellation(t *testing.T) {
+	checkLeaks(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var cancelled atomic.Int32
+	seen := 0
+	var last error
+	for _, err := range Ordered(ctx, 4, count(1000), func(ctx context.Context, i int) (int, error) {
+		if i >= 2 {
+			// blocks until the iteration is cancelled
+			<-ctx.Done()
+			cancelled.Add(1)
+			return 0, ctx.Err()
+		}
+		return i, nil
+	}) {
+		if err != nil {
+			last = err
+			break
+		}
+		seen++
+		if seen == 2 {
+			cancel()
+		}
+	}
+	if !errors.Is(last, context.Canceled) || seen != 2 {
+		t.Errorf("expected two results then cancellation, got %d and %v", seen, last)
+	}
+	if cancelled.Load() == 0 {
+		t.Error("expected running calls to see the context cancelled")
+	}
+}
+
+func TestOrderedEarlyBreak(t *testing.T) {
+	checkLeaks(t)
+	var finished atomic.Int32
+	for value := range Ordered(context.Background(), 8, count(100), func(ctx context.Context, i int) (int, error) {
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Duration(i) * time.Millisecond):
+		}
+		finished.Add(1)
+		return i, nil
+	}) {
+		if value == 1 {
+			break
+		}
+	}
+	// breaking waits for the calls already started, cancelling them
+	if got := finished.Load(); got < 2 || got > 9 {
+		t.Errorf("expected the started calls to have finished, got %d", got)
+	}
+}
+
+func TestGroup(t *testing.T) {
+	checkLeaks(t)
+	errFirst := errors.New("first")
+	g := NewGroup(context.Background(), 2)
+	var running, most atomic.Int32
+	for i := range 10 {
+		g.Go(func(ctx context.Context) error {
+			now := running.Add(1)
+			defer running.Add(-1)
+			if now > most.Load() {
+				most.Store(now)
+			}
+			time.Sleep(time.Millisecond)
+			if i == 3 {
+				return errFirst
+			}
+			return nil
+		})
+	}
+	if err := g.Wait(); !errors.Is(err, errFirst) {
+		t.Errorf("expected the error of the failing task, got %v", err)
+	}
+	if most.Load() > 2 {
+		t.Errorf("expected at most 2 tasks at once, got %d", most.Load())
+	}
+	if g.Context().Err() == nil {
+		t.Error("expected the context of the group to be cancelled")
+	}
+
+	g = NewGroup(context.Background(), 1)
+	release := make(chan struct{})
+	if !g.TryGo(func(ctx context.Context) error { <-release; return nil }) {
+		t.Fatal("expected the first task to start")
+	}
+	if g.TryGo(func(ctx context.Context) error { return nil }) {
+		t.Error("expected a task past the limit not to start")
+	}
+	close(release)
+	if err := g.Wait(); err != nil {
+		t.Error(err)
+	}
+}
+
+func BenchmarkOrdered(b *testing.B) {
+	work := func(ctx context.Context, i int) (uint64, error) {
+		// stands in for encoding a tile
+		sum := uint64(i)
+		for k := range 20000 {
+			sum = sum*6364136223846793005 + uint64(k)
+		}
+		return sum, nil
+	}
+	for _, workers := range []int{1, 4, runtime.GOMAXPROCS(0)} {
+		b.Run("workers="+strconv.Itoa(workers), func(b *testing.B) {
+			for range b.N {
+				for _, err := range Ordered(context.Background(), workers, count(64), work) {
+					if err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package xxhash
+
+import "testing"
+
+func TestSum64KnownVectors(t *testing.T) {
+	tests := []struct {
+		input string
+		want  uint64
+	}{
+		{"", 0xef46db3751d8e999},
+		{"a", 0xd24ec4f1a98c6e5b},
+		{"abc", 0x44bc2cf5ad770999},
+		{"Nobody inspects the spammish repetition", 0xfbcea83c8a378bf1},
+	}
+	for _, tc := range tests {
+		if got := Sum64([]byte(tc.input)); got != tc.want {
+			t.Errorf("Sum64(%q) = %x, want %x", tc.input, got, tc.want)
+		}
+	}
+}
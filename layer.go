@@ -1,8 +1,29 @@
 package pixi
 
 import (
-	"hash/crc32"
+	"bytes"
+	"context"
+	"fmt"
 	"io"
+	"iter"
+	"sync"
+
+	"github.com/owlpinetech/pixi/internal/preload"
+)
+
+// Bits of the layer configuration word written at the start of each layer header.
+const (
+	layerFlagSeparated uint32 = 1 << 0 // Fields are stored in separate tiles.
+	layerFlagAligned   uint32 = 1 << 1 // Tile start offsets are aligned, alignment follows the compression.
+	layerFlagTagged    uint32 = 1 << 2 // The layer has its own chain of tag sections, pointed to after the next layer start.
+	layerFlagDimMeta   uint32 = 1 << 3 // The dimension descriptions are followed by the metadata of each dimension.
+	layerFlagRanges    uint32 = 1 << 4 // The end of the header holds the range of each field in each tile.
+	layerFlagScratch   uint32 = 1 << 5 // The layer is a temporary product, hidden from listings and dropped by compaction.
+	layerFlagCodecs    uint32 = 1 << 6 // The end of the header holds the compression of each disk tile, one byte each.
+
+	// Every bit this package knows, since the layout of a layer header with any other bit set is unknown.
+	layerFlagsKnown = layerFlagSeparated | layerFlagAligned | layerFlagTagged | layerFlagDimMeta |
+		layerFlagRanges | layerFlagScratch | layerFlagCodecs
 )
 
 // Pixi files are composed of one or more layers. Generally, layers are used to represent the same data set
@@ -17,25 +38,51 @@ type Layer struct {
 	// other at the same index.
 	Separated   bool
 	Compression Compression // The type of compression used on this dataset (e.g., Flate, lz4).
+	// If greater than zero, the start offset of every tile written to the layer is padded to a multiple
+	// of this many bytes. Useful for uncompressed layers read with direct I/O or memory mapping, where tiles
+	// must begin on a block or page boundary. The padding bytes are zero and not counted in TileBytes.
+	// Requires version 2 or later.
+	TileAlignment int
 	// A slice of Dimension structs representing the dimensions and tiling of this dataset.
 	// No dimensions equals an empty dataset. Dimensions are stored and iterated such that the
 	// samples for the first dimension are the closest together in memory, with progressively
 	// higher dimensions samples becoming further apart.
 	Dimensions     DimensionSet
-	Fields         []Field // An array of Field structs representing the fields in this dataset.
-	TileBytes      []int64 // An array of byte counts representing (compressed) size of each tile in bytes for this dataset.
-	TileOffsets    []int64 // An array of byte offsets representing the position in the file of each tile in the dataset.
-	NextLayerStart int64   // The byte-index offset of the next layer in the file, from the start of the file. 0 if this is the last layer in the file.
+	Fields         FieldSet // An array of Field structs representing the fields in this dataset.
+	TileBytes      []int64  // An array of byte counts representing (compressed) size of each tile in bytes for this dataset.
+	TileOffsets    []int64  // An array of byte offsets representing the position in the file of each tile in the dataset.
+	NextLayerStart int64    // The byte-index offset of the next layer in the file, from the start of the file. 0 if this is the last layer in the file.
+	// Tags describing only this layer, such as band wavelengths or processing parameters, broken up into
+	// sections like the tags of the file. The tag sections are stored outside the layer header, and are
+	// read by ReadPixi but not by ReadLayer. Requires version 2 or later.
+	Tags []*TagSection
+	// The byte-index offset of the first tag section of the layer, from the start of the file. 0 if the
+	// layer has no tags. Whether the layer header has room for this offset is decided by whether the layer
+	// has any Tags or a nonzero TagsStart, so Tags must be set before the layer header is first written.
+	TagsStart int64
+	// The smallest and largest value of each field in each tile, indexed by tile (not disk tile), recorded
+	// in the layer header if not nil. See RecordTileRanges. Requires version 2 or later.
+	TileRanges []TileRange
+	// Marks the layer as a temporary product, such as the intermediate result of one stage of a pipeline,
+	// kept in the file while it is being processed. Scratch layers are left out of Pixi.Layers, and so of
+	// what is served, listed and derived from the file, and are dropped when the file is compacted; they
+	// are still listed by Pixi.AllLayers. Requires version 2 or later. See SetScratch.
+	Scratch bool
+	// The compression of each disk tile, recorded in the layer header if not nil, overriding Compression
+	// when tiles are read so that a layer can mix compressions. See RecordTileCompressions. Requires
+	// version 2 or later.
+	TileCompressions []Compression
 }
 
 // Helper constructor to ensure that certain invariants in a layer are maintained when it is created.
+// Anonymous fields are given names (see FieldSet.Named), so that every field can be found by name.
 func NewLayer(name string, separated bool, compression Compression, dimensions []Dimension, fields []Field) *Layer {
 	l := &Layer{
 		Name:        name,
 		Separated:   separated,
 		Compression: compression,
 		Dimensions:  dimensions,
-		Fields:      fields,
+		Fields:      FieldSet(fields).Named(),
 	}
 
 	l.TileBytes = make([]int64, l.DiskTiles())
@@ -82,12 +129,20 @@ func (d *Layer) SampleSize() int {
 
 // Get the total number of bytes that will be occupied in the file by this layer's header.
 func (d *Layer) HeaderSize(h PixiHeader) int {
-	headerSize := 4 + 4                   // 4 bytes each for configuration and compression
+	headerSize := 4 + 4 // 4 bytes each for configuration and compression
+	if d.TileAlignment > 0 {
+		headerSize += 4 // 4 bytes for tile alignment
+	}
 	headerSize += 2 + len([]byte(d.Name)) // 2 bytes for name length, then name
 	headerSize += 4                       // four bytes for dimension count
 	for _, d := range d.Dimensions {
 		headerSize += d.HeaderSize(h) // add each dimension header size
 	}
+	if d.Dimensions.HasMetadata() {
+		for _, d := range d.Dimensions {
+			headerSize += d.MetadataSize() // add each dimension metadata size
+		}
+	}
 	headerSize += 4 // four bytes for field count
 	for _, f := range d.Fields {
 		headerSize += f.HeaderSize(h) // add each field header size
@@ -95,6 +150,11 @@ func (d *Layer) HeaderSize(h PixiHeader) int {
 	headerSize += d.DiskTiles() * h.OffsetSize // offset size bytes for each real disk tile size in bytes
 	headerSize += d.DiskTiles() * h.OffsetSize // offset size bytes for each tile offset
 	headerSize += h.OffsetSize                 // offset size bytes for the next layer start offset
+	if d.tagged() {
+		headerSize += h.OffsetSize // offset size bytes for the layer tags start offset
+	}
+	headerSize += d.tileRangesSize()       // known marker, minimum and maximum of each field of each tile
+	headerSize += d.tileCompressionsSize() // one byte for the compression of each disk tile
 	return headerSize
 }
 
@@ -119,12 +179,66 @@ func (d *Layer) WriteHeader(w io.Writer, h PixiHeader) error {
 		return FormatError("invalid TileOffsets: must have same number of elements as tiles in data set for valid pixi files")
 	}
 
+	if d.TileAlignment < 0 {
+		return FormatError("invalid TileAlignment: must not be negative")
+	}
+	if d.TileAlignment > 0 && h.Version < 2 {
+		return FormatError("tile alignment requires version 2 or later")
+	}
+	if d.Scratch && h.Version < 2 {
+		return FormatError("scratch layers require version 2 or later")
+	}
+	if d.tagged() && h.Version < 2 {
+		return FormatError("layer tags require version 2 or later")
+	}
+	if d.Dimensions.HasMetadata() && h.Version < 2 {
+		return FormatError("dimension metadata requires version 2 or later")
+	}
+	if d.TileRanges != nil {
+		if h.Version < 2 {
+			return FormatError("tile ranges require version 2 or later")
+		}
+		if len(d.TileRanges) != d.Dimensions.Tiles() {
+			return FormatError("invalid TileRanges: must have same number of elements as tiles in data set for valid pixi files")
+		}
+	}
+	if d.TileCompressions != nil {
+		if h.Version < 2 {
+			return FormatError("tile compressions require version 2 or later")
+		}
+		if tiles != len(d.TileCompressions) {
+			return FormatError("invalid TileCompressions: must have same number of elements as tiles in data set for valid pixi files")
+		}
+	}
+	err := d.Fields.Validate()
+	if err != nil {
+		return err
+	}
+
 	// write configuration and compression
 	configuration := uint32(0)
 	if d.Separated {
-		configuration = 1
+		configuration |= layerFlagSeparated
+	}
+	if d.TileAlignment > 0 {
+		configuration |= layerFlagAligned
+	}
+	if d.tagged() {
+		configuration |= layerFlagTagged
+	}
+	if d.Dimensions.HasMetadata() {
+		configuration |= layerFlagDimMeta
+	}
+	if d.TileRanges != nil {
+		configuration |= layerFlagRanges
+	}
+	if d.Scratch {
+		configuration |= layerFlagScratch
 	}
-	err := h.Write(w, configuration)
+	if d.TileCompressions != nil {
+		configuration |= layerFlagCodecs
+	}
+	err = h.Write(w, configuration)
 	if err != nil {
 		return err
 	}
@@ -134,6 +248,14 @@ func (d *Layer) WriteHeader(w io.Writer, h PixiHeader) error {
 		return err
 	}
 
+	// write tile alignment, if any
+	if d.TileAlignment > 0 {
+		err = h.Write(w, uint32(d.TileAlignment))
+		if err != nil {
+			return err
+		}
+	}
+
 	// write layer name
 	err = h.WriteFriendly(w, d.Name)
 	if err != nil {
@@ -151,6 +273,14 @@ func (d *Layer) WriteHeader(w io.Writer, h PixiHeader) error {
 			return err
 		}
 	}
+	if d.Dimensions.HasMetadata() {
+		for _, dim := range d.Dimensions {
+			err = dim.WriteMetadata(w, h)
+			if err != nil {
+				return err
+			}
+		}
+	}
 
 	// write fields
 	err = h.Write(w, uint32(len(d.Fields)))
@@ -178,6 +308,30 @@ func (d *Layer) WriteHeader(w io.Writer, h PixiHeader) error {
 		return err
 	}
 
+	// write start of layer tags, if any
+	if d.tagged() {
+		err = h.WriteOffset(w, d.TagsStart)
+		if err != nil {
+			return err
+		}
+	}
+
+	// write tile ranges, if any
+	if d.TileRanges != nil {
+		err = d.writeTileRanges(w, h)
+		if err != nil {
+			return err
+		}
+	}
+
+	// write tile compressions, if any
+	if d.TileCompressions != nil {
+		err = d.writeTileCompressions(w)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -190,12 +344,27 @@ func (d *Layer) ReadLayer(r io.Reader, h PixiHeader) error {
 	if err != nil {
 		return err
 	}
-	d.Separated = configuration != 0
+	if unknown := configuration &^ layerFlagsKnown; unknown != 0 {
+		return FormatError(fmt.Sprintf("layer configuration has unknown flags %#x", unknown))
+	}
+	d.Separated = configuration&layerFlagSeparated != 0
+	d.Scratch = configuration&layerFlagScratch != 0
 	err = h.Read(r, &d.Compression)
 	if err != nil {
 		return err
 	}
 
+	// read tile alignment, if any
+	d.TileAlignment = 0
+	if configuration&layerFlagAligned != 0 {
+		var alignment uint32
+		err = h.Read(r, &alignment)
+		if err != nil {
+			return err
+		}
+		d.TileAlignment = int(alignment)
+	}
+
 	// read layer name
 	d.Name, err = h.ReadFriendly(r)
 	if err != nil {
@@ -220,6 +389,17 @@ func (d *Layer) ReadLayer(r io.Reader, h PixiHeader) error {
 		}
 		d.Dimensions[dInd] = dim
 	}
+	if configuration&layerFlagDimMeta != 0 {
+		if h.Version < 2 {
+			return FormatError("dimension metadata requires version 2 or later")
+		}
+		for dInd := range d.Dimensions {
+			err = (&d.Dimensions[dInd]).ReadMetadata(r, h)
+			if err != nil {
+				return err
+			}
+		}
+	}
 
 	// read field types
 	var fieldCount uint32
@@ -257,6 +437,80 @@ func (d *Layer) ReadLayer(r io.Reader, h PixiHeader) error {
 		return err
 	}
 
+	// read start of layer tags, if any
+	d.Tags = nil
+	d.TagsStart = 0
+	if configuration&layerFlagTagged != 0 {
+		if h.Version < 2 {
+			return FormatError("layer tags require version 2 or later")
+		}
+		d.TagsStart, err = h.ReadOffset(r)
+		if err != nil {
+			return err
+		}
+	}
+
+	// read tile ranges, if any
+	d.TileRanges = nil
+	if configuration&layerFlagRanges != 0 {
+		if h.Version < 2 {
+			return FormatError("tile ranges require version 2 or later")
+		}
+		err = d.readTileRanges(r, h)
+		if err != nil {
+			return err
+		}
+	}
+
+	// read tile compressions, if any
+	d.TileCompressions = nil
+	if configuration&layerFlagCodecs != 0 {
+		if h.Version < 2 {
+			return FormatError("tile compressions require version 2 or later")
+		}
+		err = d.readTileCompressions(r)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *Layer) tagged() bool {
+	return d.TagsStart != 0 || len(d.Tags) > 0
+}
+
+// Iterates over the tag sections of the layer in the order they are chained, reading each section
+// from r only when the iteration reaches it. If a section cannot be read, the error is yielded with
+// a nil section and iteration stops.
+func (d *Layer) TagsIter(r io.ReadSeeker, h PixiHeader) iter.Seq2[*TagSection, error] {
+	return tagSections(r, h, d.TagsStart)
+}
+
+// Finds the value of the string tag of the layer with the given key, reading as little of the
+// layer's tag sections as possible, as with Pixi.LookupTag.
+func (d *Layer) LookupTag(r io.ReadSeeker, h PixiHeader, key string) (string, bool, error) {
+	return lookupStringTag(r, h, d.TagsStart, key)
+}
+
+// Finds the payload of the binary tag of the layer with the given key, as with Pixi.LookupBinaryTag.
+func (d *Layer) LookupBinaryTag(r io.ReadSeeker, h PixiHeader, key string) ([]byte, bool, error) {
+	return lookupBinaryTag(r, h, d.TagsStart, key)
+}
+
+// Writes the tag sections in Tags to the current stream position, chained together, and sets
+// TagsStart to point at the first of them (but does not write the updated layer header to the
+// stream just yet, as with WriteTile).
+func (d *Layer) WriteTags(w io.WriteSeeker, h PixiHeader) error {
+	if h.Version < 2 {
+		return FormatError("layer tags require version 2 or later")
+	}
+	tagsStart, err := writeTagSections(w, h, d.Tags)
+	if err != nil {
+		return err
+	}
+	d.TagsStart = tagsStart
 	return nil
 }
 
@@ -284,23 +538,388 @@ func (l *Layer) OverwriteHeader(w io.WriteSeeker, h PixiHeader, headerStartOffse
 
 // Write the encoded tile data to the current stream position, updating the offset and byte count
 // for this tile in the layer header (but not writing those offsets to the stream just yet). The
-// data is written with a 4-byte checksum directly after it, which is used to verify data integrity
-// when reading the tile later.
+// data is written with a checksum directly after it (using the algorithm given in the header), which
+// is used to verify data integrity when reading the tile later. If the layer has a tile alignment,
+// zero padding is written first so that the tile starts on an aligned offset.
 func (l *Layer) WriteTile(w io.WriteSeeker, h PixiHeader, tileIndex int, data []byte) error {
 	streamOffset, err := w.Seek(0, io.SeekCurrent)
 	if err != nil {
 		return err
 	}
+	if padding := l.TilePadding(streamOffset); padding > 0 {
+		_, err = w.Write(make([]byte, padding))
+		if err != nil {
+			return err
+		}
+		streamOffset += int64(padding)
+	}
 	l.TileOffsets[tileIndex] = streamOffset
 
-	writeAmt, err := l.Compression.WriteChunk(w, data)
+	compression, writeAmt, err := l.encodeTile(w, data)
 	if err != nil {
 		return err
 	}
 	l.TileBytes[tileIndex] = int64(writeAmt)
+	l.setTileCompression(tileIndex, compression)
+	l.updateTileRange(h, tileIndex, data)
+
+	return h.WriteChecksum(w, h.Checksum.Compute(data))
+}
+
+// Writes every tile of the layer in order starting at the current stream position, as with WriteTile,
+// taking the decoded data of each tile from fill. Tiles are compressed and checksummed on up to workers
+// goroutines (see Workers) while earlier tiles are being written, but fill is only ever called from the
+// calling goroutine, in tile order, so it may read from a stream that is not safe for concurrent use.
+func (l *Layer) WriteTiles(w io.WriteSeeker, h PixiHeader, workers int, fill func(tileIndex int, data []byte) error) error {
+	return l.WriteTilesInOrder(w, h, workers, func(yield func(int) bool) {
+		for tileIndex := range l.DiskTiles() {
+			if !yield(tileIndex) {
+				return
+			}
+		}
+	}, fill)
+}
 
-	checksum := crc32.ChecksumIEEE(data)
-	return h.Write(w, checksum)
+// Writes tiles of the layer as with WriteTiles, but in the given order of disk tile indices rather than
+// in tile order, such as every field of each tile of a separated layer in turn, for when the data of the
+// tiles is produced in that order. Since the offset of every tile is recorded in the layer, tiles can be
+// stored in any order.
+func (l *Layer) WriteTilesInOrder(w io.WriteSeeker, h PixiHeader, workers int, order iter.Seq[int], fill func(tileIndex int, data []byte) error) error {
+	return l.WriteTilesWithOptions(w, h, order, fill, TileWriteOptions{Workers: workers})
+}
+
+// The name under which the tiles filled by WriteTilesWithOptions and not yet written are reported in a
+// MemoryBudget.
+const TileWriterConsumer = "tile writer"
+
+// Options adjusting how the tiles of a layer are written by WriteTilesWithOptions.
+type TileWriteOptions struct {
+	Workers int           // The number of goroutines compressing and checksumming tiles, see Workers.
+	Budget  *MemoryBudget // Bounds the tiles filled and not yet written by bytes, if not nil.
+}
+
+// Writes tiles of the layer in the given order as with WriteTilesInOrder. With a budget, the decoded data
+// of a tile is acquired from it before the tile is filled and released once the tile is written, and no
+// further tiles are filled ahead of those being compressed while the budget is exhausted; a tile is
+// always filled when none are waiting to be written, even if it is larger than the whole budget.
+func (l *Layer) WriteTilesWithOptions(w io.WriteSeeker, h PixiHeader, order iter.Seq[int], fill func(tileIndex int, data []byte) error, opts TileWriteOptions) error {
+	type filledTile struct {
+		tileIndex int
+		data      []byte
+	}
+	type encodedTile struct {
+		tileIndex   int
+		size        int64
+		compression Compression
+		data        []byte
+		checksum    uint64
+	}
+	// the tile to be filled next is not known until it is taken, so room for the largest tile is
+	// reserved ahead of it, and what is not needed returned once it is; everything here runs on the
+	// calling goroutine, so held needs no lock
+	largest := int64(l.DiskTileSize(0))
+	if l.Separated {
+		for field := range l.Fields {
+			largest = max(largest, int64(l.DiskTileSize(field*l.Dimensions.Tiles())))
+		}
+	}
+	held, reserved := int64(0), false
+	defer func() {
+		if held > 0 {
+			opts.Budget.Release(TileWriterConsumer, held)
+		}
+	}()
+	more := func() bool {
+		reserved = opts.Budget.TryAcquire(TileWriterConsumer, largest)
+		if reserved {
+			held += largest
+		}
+		return reserved
+	}
+
+	var fillErr error
+	filled := func(yield func(filledTile) bool) {
+		for tileIndex := range order {
+			size := int64(l.DiskTileSize(tileIndex))
+			if reserved {
+				opts.Budget.Release(TileWriterConsumer, largest-size)
+				held -= largest - size
+				reserved = false
+			} else {
+				opts.Budget.Acquire(TileWriterConsumer, size)
+				held += size
+			}
+			data := make([]byte, size)
+			fillErr = fill(tileIndex, data)
+			if fillErr != nil {
+				return
+			}
+			l.updateTileRange(h, tileIndex, data)
+			if !yield(filledTile{tileIndex: tileIndex, data: data}) {
+				return
+			}
+		}
+	}
+	encode := func(ctx context.Context, tile filledTile) (encodedTile, error) {
+		buf := new(bytes.Buffer)
+		compression, _, err := l.encodeTile(buf, tile.data)
+		return encodedTile{tileIndex: tile.tileIndex, size: int64(len(tile.data)), compression: compression, data: buf.Bytes(), checksum: h.Checksum.Compute(tile.data)}, err
+	}
+
+	for encoded, err := range preload.OrderedWhile(context.Background(), Workers(opts.Workers), filled, more, encode) {
+		if err != nil {
+			return err
+		}
+		// the tiles are filled on this goroutine, so a failure to fill one is seen before the next is written
+		if fillErr != nil {
+			return fillErr
+		}
+		err = l.writeEncodedTile(w, h, encoded.tileIndex, encoded.data, encoded.checksum)
+		if err != nil {
+			return err
+		}
+		l.setTileCompression(encoded.tileIndex, encoded.compression)
+		opts.Budget.Release(TileWriterConsumer, encoded.size)
+		held -= encoded.size
+	}
+	return fillErr
+}
+
+// Writes every tile of the layer as zero-filled data starting at the current stream position, updating
+// the tile offsets and byte counts in the layer (but not writing the layer header). Each distinct tile
+// size is encoded and checksummed only once. For uncompressed layers written at the end of a stream
+// that supports truncation (such as an *os.File), the tile data is not written at all: the stream is
+// extended with Truncate, which most file systems implement by allocating a sparse region, and only
+// the checksums are written. Since unwritten regions read back as zeros, the checksums match when the
+// tiles are later read or overwritten.
+func (l *Layer) WriteBlankTiles(w io.WriteSeeker, h PixiHeader) error {
+	if tr, ok := w.(interface{ Truncate(size int64) error }); ok && l.Compression == CompressionNone {
+		streamOffset, err := w.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		streamEnd, err := w.Seek(0, io.SeekEnd)
+		if err != nil {
+			return err
+		}
+		if streamEnd == streamOffset {
+			return l.truncateBlankTiles(w, tr, h, streamOffset)
+		}
+		_, err = w.Seek(streamOffset, io.SeekStart)
+		if err != nil {
+			return err
+		}
+	}
+
+	type blankTile struct {
+		compression Compression
+		data        []byte
+		checksum    uint64
+	}
+	encoded := make(map[int]blankTile)
+	for tileIndex := range l.DiskTiles() {
+		tileSize := l.DiskTileSize(tileIndex)
+		chunk, ok := encoded[tileSize]
+		if !ok {
+			blank := make([]byte, tileSize)
+			buf := new(bytes.Buffer)
+			compression, _, err := l.encodeTile(buf, blank)
+			if err != nil {
+				return err
+			}
+			chunk = blankTile{compression: compression, data: buf.Bytes(), checksum: h.Checksum.Compute(blank)}
+			encoded[tileSize] = chunk
+		}
+		err := l.writeEncodedTile(w, h, tileIndex, chunk.data, chunk.checksum)
+		if err != nil {
+			return err
+		}
+		l.setTileCompression(tileIndex, chunk.compression)
+		l.blankTileRange(h, tileIndex)
+	}
+	return nil
+}
+
+func (l *Layer) truncateBlankTiles(w io.WriteSeeker, tr interface{ Truncate(size int64) error }, h PixiHeader, streamOffset int64) error {
+	checksums := make(map[int]uint64)
+	for tileIndex := range l.DiskTiles() {
+		tileSize := l.DiskTileSize(tileIndex)
+		streamOffset += int64(l.TilePadding(streamOffset))
+		l.TileOffsets[tileIndex] = streamOffset
+		l.TileBytes[tileIndex] = int64(tileSize)
+		streamOffset += int64(tileSize + h.Checksum.Size())
+		l.setTileCompression(tileIndex, CompressionNone)
+		l.blankTileRange(h, tileIndex)
+		if _, ok := checksums[tileSize]; !ok {
+			checksums[tileSize] = h.Checksum.Compute(make([]byte, tileSize))
+		}
+	}
+
+	err := tr.Truncate(streamOffset)
+	if err != nil {
+		return err
+	}
+	for tileIndex := range l.DiskTiles() {
+		_, err = w.Seek(l.TileOffsets[tileIndex]+l.TileBytes[tileIndex], io.SeekStart)
+		if err != nil {
+			return err
+		}
+		err = h.WriteChecksum(w, checksums[int(l.TileBytes[tileIndex])])
+		if err != nil {
+			return err
+		}
+	}
+	_, err = w.Seek(streamOffset, io.SeekStart)
+	return err
+}
+
+// Writes a tile that was encoded elsewhere, such as by a producer on another machine, to the current
+// stream position as with WriteTile but without encoding it again: the encoded bytes must be the decoded
+// tile data compressed with the layer's compression (for CompressionAuto, starting with the byte naming
+// the method chosen, even if the layer records tile compressions), and the checksum that of the decoded
+// data with the header's checksum algorithm. Neither is checked; see VerifyEncodedTile. Since the decoded
+// values are not seen, any recorded range of the fields of the tile becomes unknown.
+func (l *Layer) WriteEncodedTile(w io.WriteSeeker, h PixiHeader, tileIndex int, encoded []byte, checksum uint64) error {
+	if tileIndex < 0 || tileIndex >= l.DiskTiles() {
+		return FormatError("tile index is outside the layer")
+	}
+	if len(encoded) == 0 {
+		return FormatError("encoded tile is empty")
+	}
+	l.forgetTileRange(tileIndex)
+	l.setTileCompression(tileIndex, l.Compression)
+	return l.writeEncodedTile(w, h, tileIndex, encoded, checksum)
+}
+
+// Decodes a tile encoded elsewhere, as given to WriteEncodedTile, checking that it decodes to the size of
+// the disk tile at the given index and matches the checksum, for callers that do not trust the producer
+// of the tile. Returns an IntegrityError if the checksum does not match.
+func (l *Layer) VerifyEncodedTile(h PixiHeader, tileIndex int, encoded []byte, checksum uint64) error {
+	data := BorrowChunk(l.DiskTileSize(tileIndex))
+	defer ReleaseChunk(data)
+	n, err := l.tileCompression(tileIndex).ReadChunk(bytes.NewReader(encoded), data)
+	if err != nil {
+		return err
+	}
+	if n != len(data) {
+		return FormatError("encoded tile does not decode to the size of the tile")
+	}
+	if h.Checksum.Compute(data) != checksum {
+		return IntegrityError{TileIndex: tileIndex, LayerName: l.Name}
+	}
+	return nil
+}
+
+// Writes tile data that has already been encoded with the layer's compression to the current stream
+// position, followed by the given checksum of the decoded data. The tile offset and byte count are
+// updated in the layer as with WriteTile.
+func (l *Layer) writeEncodedTile(w io.WriteSeeker, h PixiHeader, tileIndex int, encoded []byte, checksum uint64) error {
+	streamOffset, err := w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if padding := l.TilePadding(streamOffset); padding > 0 {
+		_, err = w.Write(make([]byte, padding))
+		if err != nil {
+			return err
+		}
+		streamOffset += int64(padding)
+	}
+	l.TileOffsets[tileIndex] = streamOffset
+
+	writeAmt, err := w.Write(encoded)
+	if err != nil {
+		return err
+	}
+	l.TileBytes[tileIndex] = int64(writeAmt)
+	return h.WriteChecksum(w, checksum)
+}
+
+// Copies the encoded bytes and checksum of a tile of the src layer, stored in r, to the current position
+// of w as the tile at the same index of this layer, without decoding it. The layers must have the same
+// compression, tiling and fields, and both files the header h. The checksum is copied, not verified. If
+// this layer records tile compressions, the compressions may differ, since the tile keeps its own.
+func (l *Layer) CopyEncodedTile(w io.WriteSeeker, r io.ReadSeeker, h PixiHeader, src *Layer, tileIndex int) error {
+	return l.CopyEncodedTileFrom(w, r, h, src, tileIndex, tileIndex)
+}
+
+// Copies a tile of the src layer as with CopyEncodedTile, but as the tile at tileIndex of this layer
+// rather than at the same index, for when the tile is at a different position in this layer, as when
+// layers are stitched together. The tiles must have the same size.
+func (l *Layer) CopyEncodedTileFrom(w io.WriteSeeker, r io.ReadSeeker, h PixiHeader, src *Layer, srcTile int, tileIndex int) error {
+	if src.TileBytes[srcTile] == 0 {
+		panic("invalid tile byte count, likely tried to copy a tile that hasn't been written yet")
+	}
+	encoded, checksum, err := src.ReadEncodedTile(r, h, srcTile)
+	if err != nil {
+		return err
+	}
+	l.copyTileRange(src, srcTile, tileIndex)
+	l.setTileCompression(tileIndex, src.tileCompression(srcTile))
+	return l.writeEncodedTile(w, h, tileIndex, encoded, checksum)
+}
+
+// Copies every tile the src layer has written, stored in r, to the current position of w as the tile at the
+// same index of this layer, as with CopyEncodedTile, so that data moves between files without being decoded
+// and encoded again and keeps its checksums. Tiles src has not written are left unwritten. Returns an
+// UnsupportedError without copying anything if the tiles cannot be copied unchanged, see CanCopyTilesFrom.
+func (l *Layer) CopyTilesFrom(w io.WriteSeeker, r io.ReadSeeker, h PixiHeader, src *Layer) error {
+	if !l.CanCopyTilesFrom(src) {
+		return UnsupportedError("layer '" + src.Name + "' is not stored the same way as layer '" + l.Name + "', its tiles must be decoded to be copied")
+	}
+	for tileIndex := range l.DiskTiles() {
+		if src.TileBytes[tileIndex] == 0 {
+			continue
+		}
+		err := l.CopyEncodedTile(w, r, h, src, tileIndex)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reports whether the encoded tiles of the src layer can be copied into this layer unchanged: the layers must
+// have the same separation, field types, and dimension and tile sizes, and every tile of src must be stored
+// with the compression of this layer unless this layer records the compression of each tile. The files of
+// both layers must also have the same byte order and checksum algorithm, which is left to the caller to check.
+func (l *Layer) CanCopyTilesFrom(src *Layer) bool {
+	if l.Separated != src.Separated || len(l.Dimensions) != len(src.Dimensions) || len(l.Fields) != len(src.Fields) {
+		return false
+	}
+	if l.TileCompressions == nil {
+		// without a table of its own, this layer reads every tile with its compression, which for
+		// CompressionAuto includes the method byte that tiles recorded in a table are stored without
+		for tileIndex := range src.DiskTiles() {
+			if src.tileCompression(tileIndex) != l.Compression {
+				return false
+			}
+		}
+	}
+	for i, dim := range l.Dimensions {
+		if dim.Size != src.Dimensions[i].Size || dim.TileSize != src.Dimensions[i].TileSize {
+			return false
+		}
+	}
+	for i, field := range l.Fields {
+		if field.Type != src.Fields[i].Type {
+			return false
+		}
+	}
+	return true
+}
+
+// The number of zero bytes that must be written before a tile that would otherwise start at the
+// given stream offset, so that the tile begins on a multiple of the layer's tile alignment.
+func (l *Layer) TilePadding(offset int64) int {
+	if l.TileAlignment <= 0 {
+		return 0
+	}
+	rem := int(offset % int64(l.TileAlignment))
+	if rem == 0 {
+		return 0
+	}
+	return l.TileAlignment - rem
 }
 
 func (l *Layer) OverwriteTile(w io.WriteSeeker, h PixiHeader, tileIndex int, data []byte) error {
@@ -316,12 +935,80 @@ func (l *Layer) OverwriteTile(w io.WriteSeeker, h PixiHeader, tileIndex int, dat
 	return l.WriteTile(w, h, tileIndex, data)
 }
 
+// Controls how tile checksums are checked when reading tiles.
+type Verification int
+
+const (
+	VerifyStrict Verification = 0 // The checksum is verified before the read returns, the default.
+	VerifySkip   Verification = 1 // The checksum is neither read nor verified.
+	VerifyAsync  Verification = 2 // The checksum is verified in the background and failures are reported to a callback.
+)
+
+// Options adjusting how a single tile is read from a layer.
+type TileReadOptions struct {
+	// How the checksum of the tile is verified. Strict verification is the default and should
+	// be used for archival reads; skipping or deferring verification is intended for latency-critical
+	// serving of data that has been verified by other means.
+	Verification Verification
+	// Called from a separate goroutine when asynchronous verification detects a checksum mismatch.
+	// If nil, asynchronous verification falls back to strict verification.
+	OnIntegrityError func(IntegrityError)
+	// Runs the checks of asynchronous verification, bounding how many tiles are copied and waiting to be
+	// checked at once, and letting the caller wait for them. If nil, the checks run on a verifier shared
+	// by the whole process, with one check per CPU.
+	Verifier *AsyncVerifier
+}
+
+// Runs the checksum checks of tiles read with VerifyAsync in the background on a bounded number of
+// goroutines. Each check holds a copy of its tile, so a read waits for a check to finish when as many
+// are already running, rather than holding every tile of a large read twice. Safe for concurrent use.
+type AsyncVerifier struct {
+	slots   chan struct{}
+	pending sync.WaitGroup
+}
+
+var defaultVerifier = NewAsyncVerifier(0)
+
+// Creates a verifier running at most workers checks at once (see Workers).
+func NewAsyncVerifier(workers int) *AsyncVerifier {
+	return &AsyncVerifier{slots: make(chan struct{}, Workers(workers))}
+}
+
+// Waits for every check started so far to finish, and so for every mismatch among them to be reported.
+func (v *AsyncVerifier) Wait() {
+	v.pending.Wait()
+}
+
+// Copies the data once fewer than the limit of checks are running, and checks the copy on a new goroutine.
+func (v *AsyncVerifier) start(data []byte, check func(data []byte)) {
+	v.slots <- struct{}{}
+	v.pending.Add(1)
+	dataCopy := BorrowChunk(len(data))
+	copy(dataCopy, data)
+	go func() {
+		defer func() {
+			ReleaseChunk(dataCopy)
+			<-v.slots
+			v.pending.Done()
+		}()
+		check(dataCopy)
+	}()
+}
+
 // Read a raw tile (not yet decoded into sample fields) at the given tile index. The tile must
 // have been previously written (either in this session or a previous one) for this operation to succeed.
-// The data is verified for integrity using a four-byte checksum placed directly after the saved
+// The data is verified for integrity using the checksum placed directly after the saved
 // tile data, and an error is returned (along with the data read into the chunk) if the checksum
 // check fails.
 func (l *Layer) ReadTile(r io.ReadSeeker, h PixiHeader, tileIndex int, data []byte) error {
+	return l.ReadTileWithOptions(r, h, tileIndex, data, TileReadOptions{})
+}
+
+// Read a raw tile as with ReadTile, but with control over how the tile checksum is verified. With
+// VerifyAsync, the data is copied and checked on a separate goroutine after this function returns,
+// so a nil error does not guarantee the data is intact until the verifier of the options has been
+// waited on (see AsyncVerifier).
+func (l *Layer) ReadTileWithOptions(r io.ReadSeeker, h PixiHeader, tileIndex int, data []byte, opts TileReadOptions) error {
 	if l.TileBytes[tileIndex] == 0 {
 		panic("invalid tile byte count, likely tried to read a tile that hasn't been written yet")
 	}
@@ -331,11 +1018,15 @@ func (l *Layer) ReadTile(r io.ReadSeeker, h PixiHeader, tileIndex int, data []by
 		return err
 	}
 
-	_, err = l.Compression.ReadChunk(r, data)
+	_, err = l.tileCompression(tileIndex).ReadChunk(r, data)
 	if err != nil {
 		return err
 	}
 
+	if opts.Verification == VerifySkip {
+		return nil
+	}
+
 	// because compression can read more than necessary, we seek to tile start plus tile size
 	// to get to the correct position for checksum
 	_, err = r.Seek(l.TileOffsets[tileIndex]+l.TileBytes[tileIndex], io.SeekStart)
@@ -343,14 +1034,126 @@ func (l *Layer) ReadTile(r io.ReadSeeker, h PixiHeader, tileIndex int, data []by
 		return err
 	}
 
-	var savedChecksum uint32
-	err = h.Read(r, &savedChecksum)
+	savedChecksum, err := h.ReadChecksum(r)
 	if err != nil {
 		return err
 	}
+	return l.verifyTile(h, tileIndex, data, savedChecksum, opts)
+}
+
+// Reads the stored bytes of the tile at the given index and the checksum of its decoded data stored after
+// them, without decoding the tile, so that reading can be kept apart from decoding, such as to read tiles
+// from a stream one at a time while decoding them on several goroutines (see DecodeTile).
+func (l *Layer) ReadEncodedTile(r io.ReadSeeker, h PixiHeader, tileIndex int) ([]byte, uint64, error) {
+	if l.TileBytes[tileIndex] == 0 {
+		panic("invalid tile byte count, likely tried to read a tile that hasn't been written yet")
+	}
+	_, err := r.Seek(l.TileOffsets[tileIndex], io.SeekStart)
+	if err != nil {
+		return nil, 0, err
+	}
+	encoded := make([]byte, l.TileBytes[tileIndex])
+	_, err = io.ReadFull(r, encoded)
+	if err != nil {
+		return nil, 0, err
+	}
+	checksum, err := h.ReadChecksum(r)
+	if err != nil {
+		return nil, 0, err
+	}
+	return encoded, checksum, nil
+}
 
-	if savedChecksum != crc32.ChecksumIEEE(data) {
+// Decodes the stored bytes of the tile at the given index, as read by ReadEncodedTile, into data, verifying
+// the checksum as ReadTileWithOptions does. Safe to call from several goroutines at once.
+func (l *Layer) DecodeTile(h PixiHeader, tileIndex int, encoded []byte, checksum uint64, data []byte, opts TileReadOptions) error {
+	_, err := l.tileCompression(tileIndex).ReadChunk(bytes.NewReader(encoded), data)
+	if err != nil {
+		return err
+	}
+	if opts.Verification == VerifySkip {
+		return nil
+	}
+	return l.verifyTile(h, tileIndex, data, checksum, opts)
+}
+
+// Checks the decoded data of a tile against its saved checksum, either before returning or in the
+// background, as given by the options.
+func (l *Layer) verifyTile(h PixiHeader, tileIndex int, data []byte, savedChecksum uint64, opts TileReadOptions) error {
+	if opts.Verification == VerifyAsync && opts.OnIntegrityError != nil {
+		verifier := opts.Verifier
+		if verifier == nil {
+			verifier = defaultVerifier
+		}
+		verifier.start(data, func(data []byte) {
+			if savedChecksum != h.Checksum.Compute(data) {
+				opts.OnIntegrityError(IntegrityError{TileIndex: tileIndex, LayerName: l.Name})
+			}
+		})
+		return nil
+	}
+
+	if savedChecksum != h.Checksum.Compute(data) {
 		return IntegrityError{TileIndex: tileIndex, LayerName: l.Name}
 	}
 	return nil
 }
+
+// The compression the disk tile at the given index is stored with: the one recorded for it if the layer
+// records tile compressions, and otherwise that of the layer; unless that is CompressionAuto, in which
+// case the method chosen for the tile is read from the byte before its data. Tiles that have not been
+// written yet report the compression of the layer.
+func (l *Layer) TileCompression(r io.ReadSeeker, tileIndex int) (Compression, error) {
+	if l.TileBytes[tileIndex] == 0 {
+		return l.Compression, nil
+	}
+	compression := l.tileCompression(tileIndex)
+	if compression != CompressionAuto {
+		return compression, nil
+	}
+	_, err := r.Seek(l.TileOffsets[tileIndex], io.SeekStart)
+	if err != nil {
+		return l.Compression, err
+	}
+	return readAutoCompression(r)
+}
+
+// Reads len(data) bytes of the decoded tile at the given index, starting offset bytes into it, without
+// reading the rest of the tile, to save bandwidth when only a few samples of a tile are needed from a
+// remote file. Only uncompressed tiles are stored exactly as decoded, so other tiles return an
+// UnsupportedError. The checksum covers the whole tile and so cannot be verified.
+func (l *Layer) ReadTileSpan(r io.ReadSeeker, tileIndex int, offset int, data []byte) error {
+	if l.tileCompression(tileIndex) != CompressionNone {
+		return UnsupportedError("partial tile reads require an uncompressed tile")
+	}
+	if l.TileBytes[tileIndex] == 0 {
+		panic("invalid tile byte count, likely tried to read a tile that hasn't been written yet")
+	}
+	if offset < 0 || offset+len(data) > l.DiskTileSize(tileIndex) {
+		return FormatError("span is outside the tile")
+	}
+	// a ReaderAt such as a remote file can fetch exactly the span, rather than a block around it
+	if at, ok := r.(io.ReaderAt); ok {
+		_, err := at.ReadAt(data, l.TileOffsets[tileIndex]+int64(offset))
+		return err
+	}
+	_, err := r.Seek(l.TileOffsets[tileIndex]+int64(offset), io.SeekStart)
+	if err != nil {
+		return err
+	}
+	_, err = io.ReadFull(r, data)
+	return err
+}
+
+// Reads the checksum stored after the tile at the given index, without reading or decoding the tile
+// itself, for example to tell whether a tile has changed. Returns 0 if the header uses ChecksumNone.
+func (l *Layer) ReadTileChecksum(r io.ReadSeeker, h PixiHeader, tileIndex int) (uint64, error) {
+	if l.TileBytes[tileIndex] == 0 {
+		panic("invalid tile byte count, likely tried to read a tile that hasn't been written yet")
+	}
+	_, err := r.Seek(l.TileOffsets[tileIndex]+l.TileBytes[tileIndex], io.SeekStart)
+	if err != nil {
+		return 0, err
+	}
+	return h.ReadChecksum(r)
+}
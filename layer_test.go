@@ -2,10 +2,16 @@ package pixi
 
 import (
 	"encoding/binary"
+	"errors"
+	"io"
 	"math/rand/v2"
+	"os"
+	"path/filepath"
 	"reflect"
 	"slices"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/owlpinetech/pixi/internal/buffer"
 )
@@ -230,3 +236,631 @@ func TestLayerTileWriteReadCorrupted(t *testing.T) {
 		}
 	}
 }
+
+func TestLayerTileAlignment(t *testing.T) {
+	header := PixiHeader{Version: Version, OffsetSize: 8, ByteOrder: binary.LittleEndian}
+	for _, alignment := range []int{1, 7, 64, 512} {
+		layer := NewLayer("aligned", false, CompressionNone,
+			DimensionSet{{Name: "x", Size: 9, TileSize: 3}},
+			[]Field{{Name: "v", Type: FieldUint8}})
+		layer.TileAlignment = alignment
+
+		buf := buffer.NewBuffer(10)
+		err := layer.WriteHeader(buf, header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if buf.Position() != layer.HeaderSize(header) {
+			t.Errorf("expected header size %d, wrote %d", layer.HeaderSize(header), buf.Position())
+		}
+		readLayer := &Layer{}
+		if err = readLayer.ReadLayer(buffer.NewBufferFrom(buf.Bytes()), header); err != nil || readLayer.TileAlignment != alignment {
+			t.Errorf("expected alignment %d to be read back, got %d (%v)", alignment, readLayer.TileAlignment, err)
+		}
+
+		tiles := [][]byte{{1, 2, 3}, {4, 5, 6}, {7, 8, 9}}
+		for i, tile := range tiles {
+			err = layer.WriteTile(buf, header, i, tile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if layer.TileOffsets[i]%int64(alignment) != 0 {
+				t.Errorf("expected tile %d offset %d to be aligned to %d", i, layer.TileOffsets[i], alignment)
+			}
+		}
+
+		rdr := buffer.NewBufferFrom(buf.Bytes())
+		for i, tile := range tiles {
+			rdTile := make([]byte, len(tile))
+			err = layer.ReadTile(rdr, header, i, rdTile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(tile, rdTile) {
+				t.Errorf("expected tile %v, got %v", tile, rdTile)
+			}
+		}
+	}
+}
+
+func TestLayerTileAlignmentRequiresVersion2(t *testing.T) {
+	layer := NewLayer("aligned", false, CompressionNone,
+		DimensionSet{{Name: "x", Size: 9, TileSize: 3}},
+		[]Field{{Name: "v", Type: FieldUint8}})
+	layer.TileAlignment = 64
+	err := layer.WriteHeader(buffer.NewBuffer(10), PixiHeader{Version: 1, OffsetSize: 4, ByteOrder: binary.BigEndian})
+	if _, ok := err.(FormatError); !ok {
+		t.Errorf("expected format error writing tile alignment to a version 1 file, got %v", err)
+	}
+}
+
+func TestLayerWriteTilesMatchesWriteTile(t *testing.T) {
+	header := PixiHeader{Version: Version, OffsetSize: 8, ByteOrder: binary.LittleEndian, Checksum: ChecksumCrc32}
+	tiles := make([][]byte, 12)
+	for i := range tiles {
+		tiles[i] = make([]byte, 64)
+		for j := range tiles[i] {
+			tiles[i][j] = byte(rand.IntN(4))
+		}
+	}
+	newLayer := func() *Layer {
+		layer := NewLayer("parallel", false, CompressionFlate,
+			DimensionSet{{Name: "x", Size: 12, TileSize: 4}, {Name: "y", Size: 16, TileSize: 4}},
+			[]Field{{Name: "v", Type: FieldUint32}})
+		layer.TileAlignment = 8
+		return layer
+	}
+
+	sequential := buffer.NewBuffer(10)
+	seqLayer := newLayer()
+	for i, tile := range tiles {
+		err := seqLayer.WriteTile(sequential, header, i, tile)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, workers := range []int{0, 1, 3, 32} {
+		parallel := buffer.NewBuffer(10)
+		parLayer := newLayer()
+		filled := 0
+		err := parLayer.WriteTiles(parallel, header, workers, func(tileIndex int, data []byte) error {
+			if tileIndex != filled {
+				t.Errorf("expected tile %d to be filled next, got %d", filled, tileIndex)
+			}
+			filled++
+			copy(data, tiles[tileIndex])
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(parallel.Bytes(), sequential.Bytes()) {
+			t.Errorf("expected %d workers to write the same bytes as WriteTile", workers)
+		}
+		if !slices.Equal(parLayer.TileOffsets, seqLayer.TileOffsets) || !slices.Equal(parLayer.TileBytes, seqLayer.TileBytes) {
+			t.Errorf("expected %d workers to record the same tile offsets and sizes as WriteTile", workers)
+		}
+	}
+
+	failure := FormatError("fill failed")
+	err := newLayer().WriteTiles(buffer.NewBuffer(10), header, 4, func(tileIndex int, data []byte) error {
+		if tileIndex == 5 {
+			return failure
+		}
+		return nil
+	})
+	if err != failure {
+		t.Errorf("expected fill error to be returned, got %v", err)
+	}
+}
+
+func TestLayerWriteTilesInOrder(t *testing.T) {
+	header := PixiHeader{Version: Version, OffsetSize: 8, ByteOrder: binary.LittleEndian}
+	layer := NewLayer("reversed", false, CompressionFlate,
+		DimensionSet{{Name: "x", Size: 8, TileSize: 4}, {Name: "y", Size: 8, TileSize: 4}},
+		[]Field{{Name: "v", Type: FieldUint16}})
+	buf := buffer.NewBuffer(10)
+	order := []int{3, 1, 2, 0}
+	err := layer.WriteTilesInOrder(buf, header, 2, slices.Values(order), func(tileIndex int, data []byte) error {
+		for i := range data {
+			data[i] = byte(tileIndex)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < len(order); i++ {
+		if layer.TileOffsets[order[i]] <= layer.TileOffsets[order[i-1]] {
+			t.Errorf("expected tile %d to be written after tile %d", order[i], order[i-1])
+		}
+	}
+	for tileIndex := range layer.DiskTiles() {
+		data := make([]byte, layer.DiskTileSize(tileIndex))
+		err := layer.ReadTile(buf, header, tileIndex, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data[0] != byte(tileIndex) || data[len(data)-1] != byte(tileIndex) {
+			t.Errorf("expected tile %d to be read back, got %v", tileIndex, data[:4])
+		}
+	}
+}
+
+func TestLayerWriteTilesWithinBudget(t *testing.T) {
+	header := PixiHeader{Version: Version, OffsetSize: 8, ByteOrder: binary.LittleEndian}
+	layer := NewLayer("budgeted", true, CompressionFlate,
+		DimensionSet{{Name: "x", Size: 64, TileSize: 8}, {Name: "y", Size: 64, TileSize: 8}},
+		[]Field{{Name: "a", Type: FieldUint16}, {Name: "b", Type: FieldFloat64}})
+	// room for three of the larger tiles, though eight workers would otherwise fill eight ahead
+	budget := NewMemoryBudget(3 * 8 * 8 * 8)
+	order := []int{}
+	for tileIndex := range layer.DiskTiles() {
+		order = append(order, tileIndex)
+	}
+	buf := buffer.NewBuffer(10)
+	err := layer.WriteTilesWithOptions(buf, header, slices.Values(order), func(tileIndex int, data []byte) error {
+		if budget.Used() > budget.Limit() {
+			t.Errorf("expected the budget to hold while filling tile %d, got %d bytes used", tileIndex, budget.Used())
+		}
+		data[0] = byte(tileIndex)
+		return nil
+	}, TileWriteOptions{Workers: 8, Budget: budget})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if budget.Used() != 0 || budget.Peak() > budget.Limit() {
+		t.Errorf("expected every tile to be released within the limit, got %d used with a peak of %d", budget.Used(), budget.Peak())
+	}
+	data := make([]byte, layer.DiskTileSize(layer.DiskTiles()-1))
+	if err = layer.ReadTile(buf, header, layer.DiskTiles()-1, data); err != nil || data[0] != byte(layer.DiskTiles()-1) {
+		t.Errorf("expected the last tile to be read back, got %v", err)
+	}
+
+	// a tile larger than the whole budget is still written
+	small := NewMemoryBudget(16)
+	err = layer.WriteTilesWithOptions(buffer.NewBuffer(10), header, slices.Values([]int{0, 64, 1}), func(tileIndex int, data []byte) error {
+		return nil
+	}, TileWriteOptions{Workers: 4, Budget: small})
+	if err != nil || small.Used() != 0 {
+		t.Errorf("expected tiles larger than the budget to be written one at a time, got %v with %d used", err, small.Used())
+	}
+}
+
+func TestLayerWriteBlankTiles(t *testing.T) {
+	header := PixiHeader{Version: Version, OffsetSize: 8, ByteOrder: binary.BigEndian}
+	for _, compression := range []Compression{CompressionNone, CompressionFlate} {
+		layer := NewLayer("blank", true, compression,
+			DimensionSet{{Name: "x", Size: 100, TileSize: 30}, {Name: "y", Size: 50, TileSize: 25}},
+			[]Field{{Name: "a", Type: FieldUint16}, {Name: "b", Type: FieldFloat64}})
+		layer.TileAlignment = 16
+
+		// the file path exercises truncation, the buffer the plain write path
+		file, err := os.Create(filepath.Join(t.TempDir(), "blank.pixi"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		backings := []io.ReadWriteSeeker{file, buffer.NewBuffer(10)}
+
+		for _, backing := range backings {
+			err = header.WriteHeader(backing)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = layer.WriteHeader(backing, header)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = layer.WriteBlankTiles(backing, header)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			end, err := backing.Seek(0, io.SeekCurrent)
+			if err != nil {
+				t.Fatal(err)
+			}
+			last := layer.DiskTiles() - 1
+			if end != layer.TileOffsets[last]+layer.TileBytes[last]+4 {
+				t.Errorf("expected stream to be positioned after last tile, got %d", end)
+			}
+
+			for tileIndex := range layer.DiskTiles() {
+				if layer.TileOffsets[tileIndex]%16 != 0 {
+					t.Errorf("expected tile %d to be aligned, got offset %d", tileIndex, layer.TileOffsets[tileIndex])
+				}
+				tile := make([]byte, layer.DiskTileSize(tileIndex))
+				err = layer.ReadTile(backing, header, tileIndex, tile)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if slices.ContainsFunc(tile, func(b byte) bool { return b != 0 }) {
+					t.Errorf("expected blank tile %d to be all zeros", tileIndex)
+				}
+			}
+		}
+	}
+}
+
+func TestLayerTileChecksumAlgorithms(t *testing.T) {
+	for _, checksum := range []ChecksumAlgorithm{ChecksumCrc32, ChecksumCrc32c, ChecksumXxHash64, ChecksumNone} {
+		header := PixiHeader{Version: Version, OffsetSize: 8, ByteOrder: binary.BigEndian, Checksum: checksum}
+		layer := &Layer{
+			Compression: CompressionNone,
+			TileBytes:   make([]int64, 1),
+			TileOffsets: make([]int64, 1),
+		}
+
+		chunk := make([]byte, rand.IntN(499)+1)
+		for i := range len(chunk) {
+			chunk[i] = byte(rand.IntN(256))
+		}
+
+		buf := buffer.NewBuffer(10)
+		err := layer.WriteTile(buf, header, 0, chunk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(buf.Bytes()) != len(chunk)+checksum.Size() {
+			t.Errorf("expected %d bytes written for %v, got %d", len(chunk)+checksum.Size(), checksum, len(buf.Bytes()))
+		}
+
+		rdChunk := make([]byte, len(chunk))
+		err = layer.ReadTile(buffer.NewBufferFrom(buf.Bytes()), header, 0, rdChunk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(chunk, rdChunk) {
+			t.Errorf("expected chunks to be equal for %v", checksum)
+		}
+
+		// corrupt the data, which should be detected by every algorithm except none
+		buf.Bytes()[0] ^= 0xff
+		err = layer.ReadTile(buffer.NewBufferFrom(buf.Bytes()), header, 0, rdChunk)
+		if checksum != ChecksumNone && err == nil {
+			t.Errorf("expected corruption to be detected by %v", checksum)
+		} else if checksum == ChecksumNone && err != nil {
+			t.Errorf("expected no verification with %v, got %v", checksum, err)
+		}
+	}
+}
+
+func TestLayerWriteEncodedTile(t *testing.T) {
+	header := PixiHeader{Version: Version, OffsetSize: 8, ByteOrder: binary.LittleEndian}
+	layer := NewLayer("farmed", false, CompressionFlate,
+		DimensionSet{{Name: "x", Size: 8, TileSize: 4}, {Name: "y", Size: 4, TileSize: 4}},
+		[]Field{{Name: "v", Type: FieldUint16}})
+	layer.RecordTileRanges()
+	chunk := make([]byte, layer.DiskTileSize(1))
+	for i := range chunk {
+		chunk[i] = byte(i)
+	}
+
+	// as a producer elsewhere would encode the tile
+	encoded := buffer.NewBuffer(10)
+	if _, err := layer.Compression.WriteChunk(encoded, chunk); err != nil {
+		t.Fatal(err)
+	}
+	checksum := header.Checksum.Compute(chunk)
+	if err := layer.VerifyEncodedTile(header, 1, encoded.Bytes(), checksum); err != nil {
+		t.Errorf("expected the encoded tile to verify, got %v", err)
+	}
+	if err := layer.VerifyEncodedTile(header, 1, encoded.Bytes(), checksum+1); !errors.As(err, &IntegrityError{}) {
+		t.Errorf("expected an integrity error for the wrong checksum, got %v", err)
+	}
+	if err := layer.VerifyEncodedTile(header, 1, encoded.Bytes()[:len(encoded.Bytes())/2], checksum); err == nil {
+		t.Error("expected a truncated tile not to verify")
+	}
+
+	buf := buffer.NewBuffer(10)
+	if err := layer.WriteEncodedTile(buf, header, 1, encoded.Bytes(), checksum); err != nil {
+		t.Fatal(err)
+	}
+	if layer.TileBytes[1] != int64(len(encoded.Bytes())) {
+		t.Errorf("expected %d tile bytes, got %d", len(encoded.Bytes()), layer.TileBytes[1])
+	}
+	if layer.TileRanges[1].Min[0] != nil {
+		t.Errorf("expected the range of the tile to be unknown, got %v", layer.TileRanges[1].Min[0])
+	}
+	data := make([]byte, len(chunk))
+	if err := layer.ReadTile(buf, header, 1, data); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(data, chunk) {
+		t.Errorf("expected the tile to be read back, got %v", data)
+	}
+
+	if err := layer.WriteEncodedTile(buf, header, 2, encoded.Bytes(), checksum); err == nil {
+		t.Error("expected an error writing a tile outside the layer")
+	}
+	if err := layer.WriteEncodedTile(buf, header, 0, nil, checksum); err == nil {
+		t.Error("expected an error writing an empty tile")
+	}
+}
+
+func TestLayerCopyTilesFrom(t *testing.T) {
+	header := PixiHeader{Version: Version, OffsetSize: 4, ByteOrder: binary.BigEndian}
+	srcBuf := buffer.NewBuffer(10)
+	src := appendTestLayer("src")
+	tiles := randomTiles(src)
+	writeSingleLayerPixi(t, srcBuf, header, nil, src, tiles[:1])
+
+	buf := buffer.NewBuffer(10)
+	layer := appendTestLayer("dst")
+	layer.Dimensions = DimensionSet{{Name: "renamed", Size: 4, TileSize: 2}}
+	if err := layer.CopyTilesFrom(buf, srcBuf, header, src); err != nil {
+		t.Fatal(err)
+	}
+	if layer.TileBytes[0] != src.TileBytes[0] || layer.TileBytes[1] != 0 {
+		t.Errorf("expected only the written tile to be copied verbatim, got %v from %v", layer.TileBytes, src.TileBytes)
+	}
+	checksum, err := layer.ReadTileChecksum(buf, header, 0)
+	if err != nil || checksum != header.Checksum.Compute(tiles[0]) {
+		t.Errorf("expected the checksum to be copied, got %d %v", checksum, err)
+	}
+	data := make([]byte, layer.DiskTileSize(0))
+	if err = layer.ReadTile(buf, header, 0, data); err != nil || !slices.Equal(data, tiles[0]) {
+		t.Errorf("expected the copied tile to be read back, got %v", err)
+	}
+
+	retiled := NewLayer("retiled", false, CompressionFlate, DimensionSet{{Name: "x", Size: 4, TileSize: 4}}, src.Fields)
+	recompressed := NewLayer("recompressed", false, CompressionNone, src.Dimensions, src.Fields)
+	var unsupported UnsupportedError
+	for _, other := range []*Layer{retiled, recompressed} {
+		if err = other.CopyTilesFrom(buf, srcBuf, header, src); !errors.As(err, &unsupported) {
+			t.Errorf("expected copying into %s to be refused, got %v", other.Name, err)
+		}
+	}
+	recompressed.RecordTileCompressions()
+	if !recompressed.CanCopyTilesFrom(src) {
+		t.Error("expected a layer recording tile compressions to take tiles of another compression")
+	}
+
+	auto := NewLayer("auto", false, CompressionAuto, src.Dimensions, src.Fields)
+	recorded := NewLayer("recorded", false, CompressionAuto, src.Dimensions, src.Fields)
+	recorded.RecordTileCompressions()
+	recorded.TileCompressions[0] = CompressionFlate
+	if auto.CanCopyTilesFrom(recorded) {
+		t.Error("expected tiles without their method byte to be refused by a layer without tile compressions")
+	}
+	if !recorded.CanCopyTilesFrom(auto) {
+		t.Error("expected a layer recording tile compressions to take automatically compressed tiles")
+	}
+	for tileIndex := range recorded.TileCompressions {
+		recorded.TileCompressions[tileIndex] = CompressionFlate
+	}
+	if !src.CanCopyTilesFrom(recorded) {
+		t.Error("expected tiles recorded with the compression of the layer to be copied")
+	}
+}
+
+func TestLayerReadEncodedTileThenDecode(t *testing.T) {
+	header := PixiHeader{Version: Version, OffsetSize: 4, ByteOrder: binary.LittleEndian}
+	buf := buffer.NewBuffer(10)
+	layer := appendTestLayer("split")
+	tiles := randomTiles(layer)
+	writeSingleLayerPixi(t, buf, header, nil, layer, tiles)
+
+	encoded, checksum, err := layer.ReadEncodedTile(buf, header, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(encoded)) != layer.TileBytes[1] || checksum != header.Checksum.Compute(tiles[1]) {
+		t.Errorf("expected the stored bytes and checksum of the tile, got %d bytes and %d", len(encoded), checksum)
+	}
+	data := make([]byte, layer.DiskTileSize(1))
+	if err = layer.DecodeTile(header, 1, encoded, checksum, data, TileReadOptions{}); err != nil || !slices.Equal(data, tiles[1]) {
+		t.Errorf("expected the tile to be decoded, got %v", err)
+	}
+	if err = layer.DecodeTile(header, 1, encoded, checksum+1, data, TileReadOptions{}); !errors.As(err, &IntegrityError{}) {
+		t.Errorf("expected a mismatched checksum to be reported, got %v", err)
+	}
+	if err = layer.DecodeTile(header, 1, encoded, checksum+1, data, TileReadOptions{Verification: VerifySkip}); err != nil {
+		t.Errorf("expected verification to be skipped, got %v", err)
+	}
+}
+
+func TestLayerReadTileVerificationModes(t *testing.T) {
+	header := PixiHeader{Version: Version, OffsetSize: 4, ByteOrder: binary.LittleEndian}
+	layer := &Layer{
+		Name:        "verify",
+		Compression: CompressionNone,
+		TileBytes:   make([]int64, 1),
+		TileOffsets: make([]int64, 1),
+	}
+	chunk := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	buf := buffer.NewBuffer(10)
+	err := layer.WriteTile(buf, header, 0, chunk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Bytes()[2] = 0xff
+
+	rdChunk := make([]byte, len(chunk))
+	err = layer.ReadTileWithOptions(buffer.NewBufferFrom(buf.Bytes()), header, 0, rdChunk, TileReadOptions{})
+	if err == nil {
+		t.Error("expected strict verification to detect corruption")
+	}
+
+	err = layer.ReadTileWithOptions(buffer.NewBufferFrom(buf.Bytes()), header, 0, rdChunk, TileReadOptions{Verification: VerifySkip})
+	if err != nil {
+		t.Errorf("expected skipped verification not to fail, got %v", err)
+	}
+
+	reported := make(chan IntegrityError, 1)
+	err = layer.ReadTileWithOptions(buffer.NewBufferFrom(buf.Bytes()), header, 0, rdChunk, TileReadOptions{
+		Verification:     VerifyAsync,
+		OnIntegrityError: func(e IntegrityError) { reported <- e },
+	})
+	if err != nil {
+		t.Errorf("expected asynchronous verification not to fail immediately, got %v", err)
+	}
+	if e := <-reported; e.TileIndex != 0 || e.LayerName != "verify" {
+		t.Errorf("unexpected integrity error reported: %v", e)
+	}
+
+	err = layer.ReadTileWithOptions(buffer.NewBufferFrom(buf.Bytes()), header, 0, rdChunk, TileReadOptions{Verification: VerifyAsync})
+	if err == nil {
+		t.Error("expected asynchronous verification without a callback to verify strictly")
+	}
+}
+
+func TestLayerReadTileAsyncVerifier(t *testing.T) {
+	header := PixiHeader{Version: Version, OffsetSize: 4, ByteOrder: binary.LittleEndian}
+	layer := &Layer{
+		Name:        "verify",
+		Compression: CompressionNone,
+		TileBytes:   make([]int64, 1),
+		TileOffsets: make([]int64, 1),
+	}
+	buf := buffer.NewBuffer(10)
+	err := layer.WriteTile(buf, header, 0, []byte{1, 2, 3, 4, 5, 6, 7, 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Bytes()[2] = 0xff
+
+	verifier := NewAsyncVerifier(2)
+	var lock sync.Mutex
+	running, most, reported := 0, 0, 0
+	options := TileReadOptions{Verification: VerifyAsync, Verifier: verifier, OnIntegrityError: func(e IntegrityError) {
+		lock.Lock()
+		running++
+		most = max(most, running)
+		lock.Unlock()
+		time.Sleep(time.Millisecond)
+		lock.Lock()
+		running--
+		reported++
+		lock.Unlock()
+	}}
+	data := make([]byte, 8)
+	for range 20 {
+		err = layer.ReadTileWithOptions(buffer.NewBufferFrom(buf.Bytes()), header, 0, data, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	verifier.Wait()
+	if reported != 20 || most > 2 {
+		t.Errorf("expected every mismatch reported by the time the verifier is waited on, with at most 2 checks at once, got %d with %d", reported, most)
+	}
+}
+
+func TestLayerTags(t *testing.T) {
+	header := PixiHeader{Version: Version, OffsetSize: 4, ByteOrder: binary.BigEndian}
+	layer := NewLayer("band", false, CompressionNone,
+		DimensionSet{{Name: "x", Size: 4, TileSize: 2}},
+		[]Field{{Name: "v", Type: FieldUint8}})
+	first, second := &TagSection{}, &TagSection{}
+	first.Set("wavelength", "665nm")
+	first.Set("gain", "1.0")
+	second.Set("gain", "2.5")
+	layer.Tags = []*TagSection{first, second}
+
+	buf := buffer.NewBuffer(10)
+	err := header.WriteHeader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layerOffset := int64(header.HeaderSize())
+	err = layer.WriteHeader(buf, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.Position() != int(layerOffset)+layer.HeaderSize(header) {
+		t.Errorf("expected header size %d, wrote %d", layer.HeaderSize(header), buf.Position()-int(layerOffset))
+	}
+	for i := range layer.DiskTiles() {
+		err = layer.WriteTile(buf, header, i, []byte{byte(i), byte(i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = layer.WriteTags(buf, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = layer.OverwriteHeader(buf, header, layerOffset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = header.OverwriteOffsets(buf, layerOffset, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rdr := buffer.NewBufferFrom(buf.Bytes())
+	readPixi, err := ReadPixi(rdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	readLayer := readPixi.Layers[0]
+	if readLayer.TagsStart != layer.TagsStart {
+		t.Errorf("expected tags start %d, got %d", layer.TagsStart, readLayer.TagsStart)
+	}
+	if len(readLayer.Tags) != 2 || readLayer.Tags[0].Tags["wavelength"] != "665nm" || readLayer.Tags[1].Tags["gain"] != "2.5" {
+		t.Errorf("expected both layer tag sections to be read, got %v", readLayer.Tags)
+	}
+	if len(readPixi.Tags) != 0 {
+		t.Errorf("expected no file tags, got %d sections", len(readPixi.Tags))
+	}
+
+	gain, found, err := readLayer.LookupTag(rdr, readPixi.Header, "gain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found || gain != "2.5" {
+		t.Errorf("expected later layer tag section to take precedence, got %q", gain)
+	}
+}
+
+func TestLayerTagsRequireVersion2(t *testing.T) {
+	header := PixiHeader{Version: 1, OffsetSize: 4, ByteOrder: binary.BigEndian}
+	layer := NewLayer("band", false, CompressionNone,
+		DimensionSet{{Name: "x", Size: 4, TileSize: 2}},
+		[]Field{{Name: "v", Type: FieldUint8}})
+	section := &TagSection{}
+	section.Set("k", "v")
+	layer.Tags = []*TagSection{section}
+
+	err := layer.WriteHeader(buffer.NewBuffer(10), header)
+	if _, ok := err.(FormatError); !ok {
+		t.Errorf("expected format error writing layer tags to a version 1 file, got %v", err)
+	}
+}
+
+func TestLayerDimensionMetadata(t *testing.T) {
+	header := PixiHeader{Version: Version, OffsetSize: 4, ByteOrder: binary.LittleEndian}
+	layer := NewLayer("grid", false, CompressionNone,
+		DimensionSet{
+			{Name: "x", Size: 8, TileSize: 4, Unit: "degrees_east", Direction: AxisIncreasing, Resolution: 0.5},
+			{Name: "y", Size: 4, TileSize: 4},
+		},
+		[]Field{{Name: "v", Type: FieldUint8}})
+
+	buf := buffer.NewBuffer(10)
+	err := layer.WriteHeader(buf, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.Position() != layer.HeaderSize(header) {
+		t.Errorf("expected header size %d, wrote %d", layer.HeaderSize(header), buf.Position())
+	}
+
+	readLayer := &Layer{}
+	err = readLayer.ReadLayer(buffer.NewBufferFrom(buf.Bytes()), header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(layer.Dimensions, readLayer.Dimensions) {
+		t.Errorf("expected dimensions %v, got %v", layer.Dimensions, readLayer.Dimensions)
+	}
+
+	err = layer.WriteHeader(buffer.NewBuffer(10), PixiHeader{Version: 1, OffsetSize: 4, ByteOrder: binary.LittleEndian})
+	if _, ok := err.(FormatError); !ok {
+		t.Errorf("expected format error writing dimension metadata to a version 1 file, got %v", err)
+	}
+}
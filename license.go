@@ -0,0 +1,290 @@
+package pixi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// The ID of the extension section holding the license and attribution of a dataset, see Pixi.License.
+const ExtensionLicense ExtensionID = 2
+
+func init() {
+	RegisterExtension(ExtensionLicense, ExtensionType{Name: "license", Validate: func(payload []byte) error {
+		_, err := decodeLicense(payload)
+		return err
+	}})
+}
+
+// The terms a dataset is distributed under and who must be credited for it, so that products derived from
+// public data carry their attribution with them: operations that derive one file from another merge the
+// tags of the source into the output, and so keep its license. Stored as JSON in the ExtensionLicense
+// extension section of the file, with the keys given for each field.
+type License struct {
+	// The SPDX license expression the dataset is distributed under, such as "CC-BY-4.0" or
+	// "ODbL-1.0 OR CC-BY-SA-4.0", see ValidateSPDX. Licenses without an SPDX identifier are named with a
+	// LicenseRef-, such as "LicenseRef-Copernicus".
+	SPDX        string   `json:"spdx"`
+	Attribution string   `json:"attribution,omitempty"` // The credit the license requires, as it should be displayed.
+	Sources     []string `json:"sources,omitempty"`     // Absolute URLs of the data the dataset was derived from.
+}
+
+// Checks that the license names a valid SPDX expression and that its sources are absolute URLs, returning
+// a FormatError describing the first problem found.
+func (l License) Validate() error {
+	err := ValidateSPDX(l.SPDX)
+	if err != nil {
+		return err
+	}
+	for _, source := range l.Sources {
+		parsed, err := url.Parse(source)
+		if err != nil || !parsed.IsAbs() || parsed.Host == "" {
+			return FormatError(fmt.Sprintf("license source '%s' is not an absolute URL", source))
+		}
+	}
+	return nil
+}
+
+// The license of the dataset, from the latest of the tag sections of the file holding one, and whether the
+// file has a license at all. Returns a FormatError if the stored license is not valid.
+func (d *Pixi) License() (License, bool, error) {
+	sections, err := d.Extensions()
+	if err != nil {
+		return License{}, false, err
+	}
+	for _, section := range sections {
+		if section.ID == ExtensionLicense {
+			license, err := decodeLicense(section.Payload)
+			return license, true, err
+		}
+	}
+	return License{}, false, nil
+}
+
+// Sets the license of the dataset in the tag section, for files written with it, replacing any license the
+// section already holds. Returns an error if the license is not valid, or if the extension sections
+// already stored in the section cannot be decoded.
+func (t *TagSection) SetLicense(license License) error {
+	err := license.Validate()
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(license)
+	if err != nil {
+		return err
+	}
+	return t.SetExtension(Extension{ID: ExtensionLicense, Payload: payload})
+}
+
+// Licenses an existing file by appending a tag section holding only the license, as with AppendTags, which
+// then takes the place of any earlier license of the file.
+func AppendLicense(f io.ReadWriteSeeker, license License) error {
+	section := &TagSection{}
+	err := section.SetLicense(license)
+	if err != nil {
+		return err
+	}
+	return AppendTags(f, section)
+}
+
+func decodeLicense(payload []byte) (License, error) {
+	var license License
+	err := json.Unmarshal(payload, &license)
+	if err != nil {
+		return License{}, FormatError("license is not valid JSON: " + err.Error())
+	}
+	return license, license.Validate()
+}
+
+// Checks that the expression is a valid SPDX license expression: license identifiers from the SPDX license
+// list (matched without regard to case, and optionally followed by + for "or later"), or LicenseRef- and
+// DocumentRef- references for licenses not on the list, combined with AND, OR, WITH an exception, and
+// parentheses. Only the identifiers of the licenses commonly used for data and software are known; others
+// are refused so that misspelled identifiers are caught, and can be given as a LicenseRef- instead.
+func ValidateSPDX(expression string) error {
+	tokens := spdxTokens(expression)
+	if len(tokens) == 0 {
+		return FormatError("license expression is empty")
+	}
+	p := &spdxParser{tokens: tokens}
+	err := p.expression()
+	if err != nil {
+		return err
+	}
+	if p.pos < len(p.tokens) {
+		return FormatError(fmt.Sprintf("unexpected '%s' in license expression", p.tokens[p.pos]))
+	}
+	return nil
+}
+
+// Splits a license expression into identifiers, operators and parentheses.
+func spdxTokens(expression string) []string {
+	tokens := []string{}
+	for _, field := range strings.Fields(expression) {
+		for field != "" {
+			i := strings.IndexAny(field, "()")
+			switch {
+			case i < 0:
+				tokens = append(tokens, field)
+				field = ""
+			case i == 0:
+				tokens = append(tokens, field[:1])
+				field = field[1:]
+			default:
+				tokens = append(tokens, field[:i])
+				field = field[i:]
+			}
+		}
+	}
+	return tokens
+}
+
+// A recursive descent parser of SPDX license expressions, in which AND binds tighter than OR.
+type spdxParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *spdxParser) next() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	token := p.tokens[p.pos]
+	p.pos++
+	return token
+}
+
+func (p *spdxParser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+// expression = conjunction { "OR" conjunction }
+func (p *spdxParser) expression() error {
+	err := p.conjunction()
+	for err == nil && p.peek() == "OR" {
+		p.next()
+		err = p.conjunction()
+	}
+	return err
+}
+
+// conjunction = term { "AND" term }
+func (p *spdxParser) conjunction() error {
+	err := p.term()
+	for err == nil && p.peek() == "AND" {
+		p.next()
+		err = p.term()
+	}
+	return err
+}
+
+// term = "(" expression ")" | license [ "WITH" exception ]
+func (p *spdxParser) term() error {
+	token := p.next()
+	switch token {
+	case "":
+		return FormatError("license expression ends where a license was expected")
+	case "(":
+		err := p.expression()
+		if err != nil {
+			return err
+		}
+		if p.next() != ")" {
+			return FormatError("license expression has an unclosed parenthesis")
+		}
+		return nil
+	case ")", "AND", "OR", "WITH":
+		return FormatError(fmt.Sprintf("unexpected '%s' where a license was expected", token))
+	}
+	err := validateSPDXLicense(token)
+	if err != nil {
+		return err
+	}
+	if p.peek() == "WITH" {
+		p.next()
+		exception := p.next()
+		if !spdxIdentifier(exception) {
+			return FormatError(fmt.Sprintf("'%s' is not a valid license exception", exception))
+		}
+	}
+	return nil
+}
+
+func validateSPDXLicense(token string) error {
+	if ref, ok := strings.CutPrefix(token, "DocumentRef-"); ok {
+		document, license, found := strings.Cut(ref, ":")
+		if !found || !spdxIdentifier(document) || !strings.HasPrefix(license, "LicenseRef-") {
+			return FormatError(fmt.Sprintf("'%s' is not a valid document license reference", token))
+		}
+		token = license
+	}
+	if ref, ok := strings.CutPrefix(token, "LicenseRef-"); ok {
+		if !spdxIdentifier(ref) {
+			return FormatError(fmt.Sprintf("'%s' is not a valid license reference", token))
+		}
+		return nil
+	}
+	id := strings.TrimSuffix(token, "+")
+	if !spdxIdentifier(id) {
+		return FormatError(fmt.Sprintf("'%s' is not a valid license identifier", token))
+	}
+	if !spdxLicenses[strings.ToLower(id)] {
+		return FormatError(fmt.Sprintf("'%s' is not a known SPDX license identifier, use a LicenseRef- for other licenses", token))
+	}
+	return nil
+}
+
+// Reports whether s is made only of the letters, digits, dots and hyphens allowed in SPDX identifiers.
+func spdxIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// The identifiers of the SPDX license list known to ValidateSPDX, in lower case: the Creative Commons,
+// Open Data Commons and government open data licenses used for published datasets, and the common
+// software licenses.
+var spdxLicenses = func() map[string]bool {
+	ids := []string{
+		// Creative Commons
+		"CC0-1.0", "CC-PDDC",
+		"CC-BY-1.0", "CC-BY-2.0", "CC-BY-2.5", "CC-BY-3.0", "CC-BY-4.0",
+		"CC-BY-SA-1.0", "CC-BY-SA-2.0", "CC-BY-SA-2.5", "CC-BY-SA-3.0", "CC-BY-SA-4.0",
+		"CC-BY-ND-1.0", "CC-BY-ND-2.0", "CC-BY-ND-2.5", "CC-BY-ND-3.0", "CC-BY-ND-4.0",
+		"CC-BY-NC-1.0", "CC-BY-NC-2.0", "CC-BY-NC-2.5", "CC-BY-NC-3.0", "CC-BY-NC-4.0",
+		"CC-BY-NC-SA-1.0", "CC-BY-NC-SA-2.0", "CC-BY-NC-SA-2.5", "CC-BY-NC-SA-3.0", "CC-BY-NC-SA-4.0",
+		"CC-BY-NC-ND-1.0", "CC-BY-NC-ND-2.0", "CC-BY-NC-ND-2.5", "CC-BY-NC-ND-3.0", "CC-BY-NC-ND-4.0",
+		"CC-BY-3.0-IGO", "CC-BY-SA-3.0-IGO", "CC-BY-NC-SA-3.0-IGO", "CC-BY-NC-ND-3.0-IGO",
+		// Open Data Commons and other data licenses
+		"PDDL-1.0", "ODC-By-1.0", "ODbL-1.0",
+		"CDLA-Permissive-1.0", "CDLA-Permissive-2.0", "CDLA-Sharing-1.0",
+		"OGL-UK-1.0", "OGL-UK-2.0", "OGL-UK-3.0", "OGL-Canada-2.0",
+		"DL-DE-BY-2.0", "DL-DE-ZERO-2.0", "etalab-2.0", "NLOD-1.0", "NLOD-2.0",
+		"OGDL-Taiwan-1.0", "CC-BY-3.0-AU", "CC-BY-3.0-US", "CC-BY-3.0-DE",
+		"Unlicense",
+		// software
+		"0BSD", "MIT", "MIT-0", "ISC", "Zlib", "BSL-1.0", "Apache-1.1", "Apache-2.0",
+		"BSD-1-Clause", "BSD-2-Clause", "BSD-3-Clause", "BSD-3-Clause-Clear", "BSD-4-Clause",
+		"GPL-2.0-only", "GPL-2.0-or-later", "GPL-3.0-only", "GPL-3.0-or-later",
+		"LGPL-2.1-only", "LGPL-2.1-or-later", "LGPL-3.0-only", "LGPL-3.0-or-later",
+		"AGPL-3.0-only", "AGPL-3.0-or-later", "MPL-1.1", "MPL-2.0", "EPL-1.0", "EPL-2.0",
+		"EUPL-1.1", "EUPL-1.2", "CDDL-1.0", "Artistic-2.0", "PSF-2.0", "Python-2.0",
+		"OFL-1.1", "WTFPL", "X11",
+	}
+	known := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		known[strings.ToLower(id)] = true
+	}
+	return known
+}()
@@ -0,0 +1,95 @@
+package pixi
+
+import (
+	"encoding/binary"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/owlpinetech/pixi/internal/buffer"
+)
+
+func TestValidateSPDX(t *testing.T) {
+	valid := []string{
+		"CC-BY-4.0",
+		"cc-by-sa-4.0",
+		"ODbL-1.0 OR CC-BY-SA-4.0",
+		"(MIT OR Apache-2.0) AND CC-BY-4.0",
+		"GPL-2.0-or-later WITH Classpath-exception-2.0",
+		"Apache-1.1+",
+		"LicenseRef-Copernicus",
+		"DocumentRef-terms:LicenseRef-agency AND CC0-1.0",
+	}
+	for _, expression := range valid {
+		if err := ValidateSPDX(expression); err != nil {
+			t.Errorf("expected '%s' to be valid, got %v", expression, err)
+		}
+	}
+	invalid := []string{
+		"",
+		"CC-BY-5.0",
+		"MIT or Apache-2.0",
+		"MIT AND",
+		"(MIT OR Apache-2.0",
+		"MIT)",
+		"WITH MIT",
+		"LicenseRef-",
+		"DocumentRef-terms:MIT",
+		"CC_BY_4.0",
+	}
+	for _, expression := range invalid {
+		var format FormatError
+		if err := ValidateSPDX(expression); !errors.As(err, &format) {
+			t.Errorf("expected '%s' to be refused, got %v", expression, err)
+		}
+	}
+}
+
+func TestLicenseSetAndAppend(t *testing.T) {
+	header := PixiHeader{Version: Version, OffsetSize: 8, ByteOrder: binary.BigEndian, OptionalFeatures: FeatureExtensions}
+	buf := buffer.NewBuffer(10)
+	layer := appendTestLayer("landcover")
+	writeSingleLayerPixi(t, buf, header, nil, layer, randomTiles(layer))
+
+	var format FormatError
+	if err := AppendLicense(buf, License{SPDX: "CC-BY-4.0", Sources: []string{"landcover.tif"}}); !errors.As(err, &format) {
+		t.Errorf("expected a relative source to be refused, got %v", err)
+	}
+	license := License{
+		SPDX:        "CC-BY-4.0",
+		Attribution: "Contains modified land cover data",
+		Sources:     []string{"https://example.com/landcover", "s3://bucket/landcover.tif"},
+	}
+	if err := AppendLicense(buf, license); err != nil {
+		t.Fatal(err)
+	}
+
+	summary, err := ReadPixi(buffer.NewBufferFrom(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	read, found, err := summary.License()
+	if err != nil || !found {
+		t.Fatalf("expected the license to be found, got %v %v", found, err)
+	}
+	if read.SPDX != license.SPDX || read.Attribution != license.Attribution || !slices.Equal(read.Sources, license.Sources) {
+		t.Errorf("expected the license to be read back, got %+v", read)
+	}
+
+	// a license stored by another writer without validation is reported when read
+	section := &TagSection{}
+	if err = section.SetExtension(Extension{ID: ExtensionLicense, Payload: []byte(`{"spdx": "Made-Up-1.0"}`)}); err != nil {
+		t.Fatal(err)
+	}
+	summary.Tags = append(summary.Tags, section)
+	if _, found, err = summary.License(); !found || !errors.As(err, &format) {
+		t.Errorf("expected an invalid stored license to be reported, got %v %v", found, err)
+	}
+	extensions, err := summary.Extensions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = CheckExtensions(extensions); !errors.As(err, &format) {
+		t.Errorf("expected the invalid license to fail its check, got %v", err)
+	}
+}
@@ -0,0 +1,139 @@
+package pixi
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Separates the path of an archive from the path of a member within it, as in "archive.zip!/dem.pixi".
+const ArchiveMemberSeparator = "!/"
+
+// Opens a Pixi stream for reading. The name is usually the path of a file on disk, but may also name a
+// member of a zip or tar archive using ArchiveMemberSeparator, for example "products.zip!/dem.pixi".
+// The name is only split where the part before the separator is an existing regular file with a .zip or
+// .tar extension, so files and directories whose names happen to contain the separator are opened as
+// they are. Archive members that are stored without compression (the usual case for already-compressed
+// Pixi data) are read with ranged reads directly against the archive file, so only the parts of the
+// member that are actually needed are read. Members compressed by the archive itself must be fully
+// decompressed into memory when opened.
+func Open(name string) (io.ReadSeekCloser, error) {
+	for start := 0; ; {
+		i := strings.Index(name[start:], ArchiveMemberSeparator)
+		if i < 0 {
+			break
+		}
+		archivePath, member := name[:start+i], name[start+i+len(ArchiveMemberSeparator):]
+		start += i + len(ArchiveMemberSeparator)
+		info, err := os.Stat(archivePath)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		switch strings.ToLower(filepath.Ext(archivePath)) {
+		case ".zip":
+			return openZipMember(archivePath, member)
+		case ".tar":
+			return openTarMember(archivePath, member)
+		}
+	}
+	return os.Open(name)
+}
+
+func openZipMember(archivePath string, member string) (io.ReadSeekCloser, error) {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	archive, err := zip.NewReader(file, info.Size())
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	for _, f := range archive.File {
+		if f.Name != member {
+			continue
+		}
+		if f.Method == zip.Store {
+			offset, err := f.DataOffset()
+			if err != nil {
+				file.Close()
+				return nil, err
+			}
+			return &archiveMember{io.NewSectionReader(file, offset, int64(f.UncompressedSize64)), file}, nil
+		}
+
+		// compressed members cannot be read at arbitrary positions, so we have to inflate the whole thing
+		rdr, err := f.Open()
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		data, err := io.ReadAll(rdr)
+		rdr.Close()
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		return &archiveMember{bytes.NewReader(data), file}, nil
+	}
+
+	file.Close()
+	return nil, os.ErrNotExist
+}
+
+func openTarMember(archivePath string, member string) (io.ReadSeekCloser, error) {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+
+	archive := tar.NewReader(file)
+	for {
+		hdr, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		if hdr.Name != member {
+			continue
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			file.Close()
+			return nil, UnsupportedError("tar member '" + member + "' is not a regular file")
+		}
+		// the tar reader leaves the file positioned at the start of the member's contents
+		offset, err := file.Seek(0, io.SeekCurrent)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		return &archiveMember{io.NewSectionReader(file, offset, hdr.Size), file}, nil
+	}
+
+	file.Close()
+	return nil, os.ErrNotExist
+}
+
+// A read-only view of a member within an archive file, which closes the archive when closed.
+type archiveMember struct {
+	io.ReadSeeker
+	archive io.Closer
+}
+
+func (m *archiveMember) Close() error {
+	return m.archive.Close()
+}
@@ -0,0 +1,129 @@
+package pixi
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/owlpinetech/pixi/internal/buffer"
+)
+
+func TestOpenArchiveMembers(t *testing.T) {
+	header := PixiHeader{Version: Version, OffsetSize: 4, ByteOrder: binary.BigEndian}
+	layer := NewLayer("dem", false, CompressionFlate,
+		DimensionSet{{Name: "x", Size: 8, TileSize: 4}, {Name: "y", Size: 8, TileSize: 4}},
+		[]Field{{Name: "height", Type: FieldInt16}})
+	pixiBuf := buffer.NewBuffer(10)
+	writeSingleLayerPixi(t, pixiBuf, header, map[string]string{"a": "b"}, layer, randomTiles(layer))
+	pixiData := pixiBuf.Bytes()
+
+	dir := t.TempDir()
+
+	zipPath := filepath.Join(dir, "products.zip")
+	zipFile, err := os.Create(zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zipWriter := zip.NewWriter(zipFile)
+	for _, method := range []uint16{zip.Store, zip.Deflate} {
+		name := "stored/dem.pixi"
+		if method == zip.Deflate {
+			name = "deflated/dem.pixi"
+		}
+		w, err := zipWriter.CreateHeader(&zip.FileHeader{Name: name, Method: method})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = w.Write(pixiData); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = zipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zipFile.Close()
+
+	tarPath := filepath.Join(dir, "products.tar")
+	tarFile, err := os.Create(tarPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tarWriter := tar.NewWriter(tarFile)
+	if err = tarWriter.WriteHeader(&tar.Header{Name: "readme.txt", Mode: 0644, Size: 5, Typeflag: tar.TypeReg}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tarWriter.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err = tarWriter.WriteHeader(&tar.Header{Name: "dem.pixi", Mode: 0644, Size: int64(len(pixiData)), Typeflag: tar.TypeReg}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tarWriter.Write(pixiData); err != nil {
+		t.Fatal(err)
+	}
+	if err = tarWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	tarFile.Close()
+
+	for _, name := range []string{
+		zipPath + "!/stored/dem.pixi",
+		zipPath + "!/deflated/dem.pixi",
+		tarPath + "!/dem.pixi",
+	} {
+		t.Run(filepath.Base(name), func(t *testing.T) {
+			member, err := Open(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer member.Close()
+
+			summary, err := ReadPixi(member)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(summary.Layers[0], layer) {
+				t.Errorf("expected layer %v, got %v", layer, summary.Layers[0])
+			}
+			for i := range layer.DiskTiles() {
+				tile := make([]byte, layer.DiskTileSize(i))
+				if err := summary.Layers[0].ReadTile(member, summary.Header, i, tile); err != nil {
+					t.Fatal(err)
+				}
+			}
+		})
+	}
+
+	if _, err := Open(zipPath + "!/missing.pixi"); !os.IsNotExist(err) {
+		t.Errorf("expected not exist error for missing member, got %v", err)
+	}
+}
+
+func TestOpenSeparatorOutsideArchives(t *testing.T) {
+	dir := t.TempDir()
+	for _, path := range []string{
+		filepath.Join(dir, "data!", "dem.pixi"),
+		filepath.Join(dir, "looks.zip!", "dem.pixi"),
+	} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("PIXI"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		file, err := Open(path)
+		if err != nil {
+			t.Fatalf("expected %s to be opened as a plain file, got %v", path, err)
+		}
+		data := make([]byte, 4)
+		if _, err = io.ReadFull(file, data); err != nil || string(data) != "PIXI" {
+			t.Errorf("expected the file at %s to be read, got %q (%v)", path, data, err)
+		}
+		file.Close()
+	}
+}
@@ -2,34 +2,64 @@ package pixi
 
 import (
 	"io"
+	"iter"
 	"slices"
 )
 
 const (
 	FileType string = "pixi" // Every file starts with these four bytes.
-	Version  int    = 1      // Every file has a version number as the second set of four bytes.
+	Version  int    = 3      // Every file has a version number as the second set of four bytes.
 )
 
 // Represents a single pixi file composed of one or more layers. Functions as a handle
 // to access the description of the each layer as well as the data stored in each layer.
 type Pixi struct {
-	Header PixiHeader    // The metadata about the file version and how to read information from the file.
-	Layers []*Layer      // The metadata information about each layer in the file.
-	Tags   []*TagSection // The string tags of the file, broken up into sections for easy appending.
+	Header PixiHeader // The metadata about the file version and how to read information from the file.
+	// The metadata information about each layer in the file, leaving out scratch layers (see
+	// Layer.Scratch), which are listed along with the rest by AllLayers.
+	Layers []*Layer
+	Tags   []*TagSection // The tags of the file, broken up into sections for easy appending.
+	all    []*Layer      // every layer in the file as read, scratch layers included
 }
 
 // Convenience function to read all the metadata information from a Pixi file into a single
 // containing struct.
 func ReadPixi(r io.ReadSeeker) (Pixi, error) {
+	pixi, err := ReadPixiLayers(r)
+	if err != nil {
+		return pixi, err
+	}
+	pixi.Tags = make([]*TagSection, 0)
+	for section, err := range pixi.TagsIter(r) {
+		if err != nil {
+			return pixi, err
+		}
+		pixi.Tags = append(pixi.Tags, section)
+	}
+	for _, layer := range pixi.AllLayers() {
+		for section, err := range layer.TagsIter(r, pixi.Header) {
+			if err != nil {
+				return pixi, err
+			}
+			layer.Tags = append(layer.Tags, section)
+		}
+	}
+	return pixi, nil
+}
+
+// Reads the header and every layer header of a Pixi file, but none of its tag sections or those of
+// its layers, which can instead be read one at a time with TagsIter or searched for a single key
+// with LookupTag. Scratch layers are left out of Layers, see AllLayers.
+// Useful when the file is stored remotely and the tags are large or not needed.
+func ReadPixiLayers(r io.ReadSeeker) (Pixi, error) {
 	pixi := Pixi{
 		Header: PixiHeader{},
 		Layers: make([]*Layer, 0),
-		Tags:   make([]*TagSection, 0),
 	}
 
 	seenOffsets := []int64{}
 
-	// read the header first, then the layers and tags.
+	// read the header first, then the layers
 	err := (&pixi.Header).ReadHeader(r)
 	if err != nil {
 		return pixi, err
@@ -50,36 +80,50 @@ func ReadPixi(r io.ReadSeeker) (Pixi, error) {
 		if err != nil {
 			return pixi, err
 		}
-		pixi.Layers = append(pixi.Layers, rdLayer)
-		layerOffset = rdLayer.NextLayerStart
-	}
-
-	tagOffset := pixi.Header.FirstTagsOffset
-	for tagOffset != 0 {
-		if slices.Contains(seenOffsets, tagOffset) {
-			return pixi, FormatError("loop detected in tag offsets")
-		}
-		seenOffsets = append(seenOffsets, layerOffset)
-		_, err := r.Seek(tagOffset, io.SeekStart)
-		if err != nil {
-			return pixi, err
-		}
-		rdTags := &TagSection{}
-		err = rdTags.Read(r, pixi.Header)
-		if err != nil {
-			return pixi, err
+		pixi.all = append(pixi.all, rdLayer)
+		if !rdLayer.Scratch {
+			pixi.Layers = append(pixi.Layers, rdLayer)
 		}
-		pixi.Tags = append(pixi.Tags, rdTags)
-		tagOffset = rdTags.NextTagsStart
+		layerOffset = rdLayer.NextLayerStart
 	}
 
 	return pixi, nil
 }
 
+// Iterates over the tag sections of the file in the order they are chained, reading each section
+// from r only when the iteration reaches it. If a section cannot be read, the error is yielded with
+// a nil section and iteration stops.
+func (d *Pixi) TagsIter(r io.ReadSeeker) iter.Seq2[*TagSection, error] {
+	return tagSections(r, d.Header, d.Header.FirstTagsOffset)
+}
+
+// Finds the value of the string tag with the given key by walking the tag sections of the file in r.
+// Only keys are read; the values of other tags are skipped over by seeking, so the I/O needed does not
+// depend on the size of the other values. If the key appears in several sections, the value from the
+// last one is returned, as later sections take precedence over earlier ones.
+func (d *Pixi) LookupTag(r io.ReadSeeker, key string) (string, bool, error) {
+	return lookupStringTag(r, d.Header, d.Header.FirstTagsOffset, key)
+}
+
+// Finds the payload of the binary tag with the given key, in the same way as LookupTag.
+func (d *Pixi) LookupBinaryTag(r io.ReadSeeker, key string) ([]byte, bool, error) {
+	return lookupBinaryTag(r, d.Header, d.Header.FirstTagsOffset, key)
+}
+
+// Every layer of the file in the order they are linked, scratch layers included, for code that follows
+// how the file is laid out rather than listing what it holds. For a summary not read from a file, this
+// is Layers.
+func (d *Pixi) AllLayers() []*Layer {
+	if d.all == nil {
+		return d.Layers
+	}
+	return d.all
+}
+
 // Gets the byte-index offset from the start of the file at which the layer header begins.
 func (d *Pixi) LayerOffset(l *Layer) int64 {
 	offset := d.Header.FirstLayerOffset
-	for _, item := range d.Layers {
+	for _, item := range d.AllLayers() {
 		if item == l {
 			break
 		}
@@ -92,7 +136,7 @@ func (d *Pixi) LayerOffset(l *Layer) int64 {
 // as part of the size.
 func (d *Pixi) DiskDataBytes() int64 {
 	size := int64(0)
-	for _, l := range d.Layers {
+	for _, l := range d.AllLayers() {
 		for _, t := range l.TileBytes {
 			size += t
 		}
@@ -1,7 +1,15 @@
 package pixi
 
 import (
+	"encoding/binary"
+	"io"
+	"math/rand/v2"
+	"reflect"
+	"slices"
+	"strings"
 	"testing"
+
+	"github.com/owlpinetech/pixi/internal/buffer"
 )
 
 func TestPixiSampleSize(t *testing.T) {
@@ -263,3 +271,208 @@ func TestPixiTiles(t *testing.T) {
 		})
 	}
 }
+
+// Simulates a network stream that never returns more than a single byte per Read call, to
+// make sure binary parsing never relies on a single Read filling the whole buffer.
+type oneByteReadSeeker struct {
+	rs io.ReadSeeker
+}
+
+func (o oneByteReadSeeker) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	return o.rs.Read(p[:1])
+}
+
+func (o oneByteReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	return o.rs.Seek(offset, whence)
+}
+
+// Writes a minimal Pixi file with a single tag section and a single layer, with each tile's contents
+// given by the tiles slice, for tests that need a complete file without depending on other packages.
+func writeSingleLayerPixi(t *testing.T, w io.WriteSeeker, header PixiHeader, tags map[string]string, layer *Layer, tiles [][]byte) {
+	t.Helper()
+	if err := header.WriteHeader(w); err != nil {
+		t.Fatal(err)
+	}
+
+	tagsOffset, _ := w.Seek(0, io.SeekCurrent)
+	section := TagSection{Tags: tags}
+	if err := section.Write(w, header); err != nil {
+		t.Fatal(err)
+	}
+
+	layerOffset, _ := w.Seek(0, io.SeekCurrent)
+	if err := header.OverwriteOffsets(w, layerOffset, tagsOffset); err != nil {
+		t.Fatal(err)
+	}
+	if err := layer.WriteHeader(w, header); err != nil {
+		t.Fatal(err)
+	}
+	for i := range tiles {
+		if err := layer.WriteTile(w, header, i, tiles[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := layer.OverwriteHeader(w, header, layerOffset); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Generates random contents for every disk tile of the layer.
+func randomTiles(layer *Layer) [][]byte {
+	tiles := make([][]byte, layer.DiskTiles())
+	for i := range tiles {
+		tiles[i] = make([]byte, layer.DiskTileSize(i))
+		for j := range tiles[i] {
+			tiles[i][j] = byte(rand.IntN(256))
+		}
+	}
+	return tiles
+}
+
+func TestReadPixiOneByteReads(t *testing.T) {
+	headers := []PixiHeader{
+		{Version: Version, OffsetSize: 4, ByteOrder: binary.BigEndian},
+		{Version: Version, OffsetSize: 8, ByteOrder: binary.LittleEndian},
+	}
+	for _, header := range headers {
+		for _, compression := range []Compression{CompressionNone, CompressionFlate, CompressionLzwMsb} {
+			buf := buffer.NewBuffer(10)
+			layer := NewLayer("short", false, compression,
+				DimensionSet{{Name: "x", Size: 8, TileSize: 4}, {Name: "y", Size: 4, TileSize: 4}},
+				[]Field{{Name: "v", Type: FieldUint16}})
+			tiles := randomTiles(layer)
+			writeSingleLayerPixi(t, buf, header, map[string]string{"hello": "world"}, layer, tiles)
+
+			rdr := oneByteReadSeeker{buffer.NewBufferFrom(buf.Bytes())}
+			readPixi, err := ReadPixi(rdr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if readPixi.Tags[0].Tags["hello"] != "world" {
+				t.Errorf("expected tag to be read, got %v", readPixi.Tags[0].Tags)
+			}
+			if !reflect.DeepEqual(readPixi.Layers[0], layer) {
+				t.Errorf("expected layer %v, got %v", layer, readPixi.Layers[0])
+			}
+			for i := range tiles {
+				rdTile := make([]byte, layer.DiskTileSize(i))
+				if err := readPixi.Layers[0].ReadTile(rdr, readPixi.Header, i, rdTile); err != nil {
+					t.Fatal(err)
+				}
+				if !slices.Equal(rdTile, tiles[i]) {
+					t.Errorf("tile %d read in single bytes did not match written tile", i)
+				}
+			}
+		}
+	}
+}
+
+// Counts the bytes read through it, to check how much of a stream an operation touches.
+type countingReadSeeker struct {
+	rs    io.ReadSeeker
+	count int
+}
+
+func (c *countingReadSeeker) Read(p []byte) (int, error) {
+	n, err := c.rs.Read(p)
+	c.count += n
+	return n, err
+}
+
+func (c *countingReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	return c.rs.Seek(offset, whence)
+}
+
+// Writes a Pixi file with no layers and the given tag sections chained in order.
+func writeTagSectionsPixi(t *testing.T, header PixiHeader, sections ...*TagSection) []byte {
+	t.Helper()
+	buf := buffer.NewBuffer(10)
+	if err := header.WriteHeader(buf); err != nil {
+		t.Fatal(err)
+	}
+	firstTagsOffset, _ := buf.Seek(0, io.SeekCurrent)
+	for i, section := range sections {
+		offset, _ := buf.Seek(0, io.SeekCurrent)
+		if i < len(sections)-1 {
+			scratch := buffer.NewBuffer(10)
+			if err := section.Write(scratch, header); err != nil {
+				t.Fatal(err)
+			}
+			section.NextTagsStart = offset + int64(len(scratch.Bytes()))
+		}
+		if err := section.Write(buf, header); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := header.OverwriteOffsets(buf, 0, firstTagsOffset); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestPixiTagsIterAndLookup(t *testing.T) {
+	header := PixiHeader{Version: Version, OffsetSize: 4, ByteOrder: binary.LittleEndian}
+	large := strings.Repeat("z", 100000)
+	first := &TagSection{}
+	first.Set("name", "original")
+	first.Set("large", large)
+	first.SetBinary("thumbnail", []byte{0, 1, 2, 3})
+	second := &TagSection{}
+	second.Set("name", "renamed")
+	second.Set("author", "someone")
+	data := writeTagSectionsPixi(t, header, first, second)
+
+	rdr := &countingReadSeeker{rs: buffer.NewBufferFrom(data)}
+	pixi, err := ReadPixiLayers(rdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pixi.Tags != nil {
+		t.Errorf("expected no tag sections to be read eagerly, got %d", len(pixi.Tags))
+	}
+
+	sections := 0
+	for section, err := range pixi.TagsIter(rdr) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		sections += 1
+		if section.Tags["name"] != "original" {
+			t.Errorf("expected first section first, got %v", section.Order)
+		}
+		// stopping early should not read the second section
+		break
+	}
+	if sections != 1 {
+		t.Errorf("expected to stop after one section, got %d", sections)
+	}
+
+	rdr.count = 0
+	name, found, err := pixi.LookupTag(rdr, "name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found || name != "renamed" {
+		t.Errorf("expected later section to take precedence, got %q (found %v)", name, found)
+	}
+	if rdr.count >= len(large) {
+		t.Errorf("expected lookup to skip over large values, read %d bytes", rdr.count)
+	}
+
+	thumbnail, found, err := pixi.LookupBinaryTag(rdr, "thumbnail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found || !slices.Equal(thumbnail, []byte{0, 1, 2, 3}) {
+		t.Errorf("expected binary tag to be found, got %v (found %v)", thumbnail, found)
+	}
+	if _, found, _ := pixi.LookupTag(rdr, "thumbnail"); found {
+		t.Error("expected binary tag not to be returned as a string tag")
+	}
+	if _, found, _ := pixi.LookupTag(rdr, "missing"); found {
+		t.Error("expected missing tag not to be found")
+	}
+}
@@ -0,0 +1,310 @@
+// Package pixitest provides an in-memory stream for testing how code reading and writing Pixi files
+// handles failing I/O, deterministically: errors injected into chosen calls or at chosen offsets, short
+// reads and writes, added latency, and a record of which writes were synced. A Stream can stand in for
+// the files and network streams given to the pixi, read and edit packages. It also generates the
+// canonical test vectors other implementations of the format check themselves against, see Vectors.
+package pixitest
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// The error returned by injected faults that do not give their own.
+var ErrInjected = errors.New("pixitest: injected fault")
+
+// An operation on a Stream that faults can be injected into.
+type Op int
+
+const (
+	OpRead  Op = iota // Read and ReadAt.
+	OpWrite           // Write and WriteAt.
+	OpSeek            // Seek.
+	OpSync            // Sync.
+)
+
+func (o Op) String() string {
+	switch o {
+	case OpRead:
+		return "read"
+	case OpWrite:
+		return "write"
+	case OpSeek:
+		return "seek"
+	case OpSync:
+		return "sync"
+	default:
+		return "unknown"
+	}
+}
+
+// A failure injected into the calls of an operation on a Stream. A fault with neither Call nor Offset set
+// fails every call of its operation, until the faults of the stream are cleared.
+type Fault struct {
+	Op     Op
+	Call   int   // The 1-based number of the call of Op to fail, counting every call since the stream was created, or 0 for any call.
+	Offset int64 // Only reads and writes reaching the byte at this offset or beyond fail, if positive.
+	Err    error // The error returned, or ErrInjected if nil.
+}
+
+// A seekable in-memory stream with injected faults, safe for concurrent use. Failing reads and writes
+// transfer nothing. The zero value is an empty stream without faults.
+type Stream struct {
+	lock      sync.Mutex
+	data      []byte
+	pos       int64
+	faults    []Fault
+	calls     [4]int
+	maxRead   int
+	maxWrite  int
+	latency   time.Duration
+	syncs     int
+	synced    []byte
+	dirty     bool
+	lastFault Fault
+	faulted   bool
+}
+
+// Creates a stream holding a copy of the data, positioned at its start.
+func NewStream(data []byte) *Stream {
+	return &Stream{data: append([]byte(nil), data...), synced: append([]byte(nil), data...)}
+}
+
+// Adds a fault to those injected into the calls of the stream.
+func (s *Stream) Inject(fault Fault) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.faults = append(s.faults, fault)
+}
+
+// Removes every fault injected into the stream.
+func (s *Stream) ClearFaults() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.faults = nil
+}
+
+// Limits every read to at most n bytes, or removes the limit if n is 0, as network streams often return
+// less than asked for. Short reads are not errors.
+func (s *Stream) SetShortReads(n int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.maxRead = n
+}
+
+// Limits every write to at most n bytes, or removes the limit if n is 0. Writes cut short return
+// io.ErrShortWrite, as io.Writer requires.
+func (s *Stream) SetShortWrites(n int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.maxWrite = n
+}
+
+// Delays every call of the stream by the given duration, without holding up calls on other goroutines.
+func (s *Stream) SetLatency(latency time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.latency = latency
+}
+
+// The number of calls of the operation made so far, including those that failed.
+func (s *Stream) Calls(op Op) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.calls[op]
+}
+
+// The number of successful calls of Sync so far.
+func (s *Stream) Syncs() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.syncs
+}
+
+// Whether anything has been written since the last successful Sync, or since the stream was created.
+func (s *Stream) Dirty() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.dirty
+}
+
+// A copy of the contents of the stream.
+func (s *Stream) Bytes() []byte {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]byte(nil), s.data...)
+}
+
+// A copy of the contents of the stream as of the last successful Sync, or as created if it was never
+// synced; what a file would hold after a crash, at worst.
+func (s *Stream) Synced() []byte {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]byte(nil), s.synced...)
+}
+
+// The fault that failed the most recent failing call, if any.
+func (s *Stream) LastFault() (Fault, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.lastFault, s.faulted
+}
+
+func (s *Stream) Read(p []byte) (int, error) {
+	s.delay()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	n, err := s.readAt(p, s.pos)
+	s.pos += int64(n)
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+func (s *Stream) ReadAt(p []byte, off int64) (int, error) {
+	s.delay()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	// ReadAt must fill p unless it fails, so reads are never cut short
+	return s.readAtLimit(p, off, 0)
+}
+
+func (s *Stream) Write(p []byte) (int, error) {
+	s.delay()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	n, err := s.writeAt(p, s.pos)
+	s.pos += int64(n)
+	return n, err
+}
+
+func (s *Stream) WriteAt(p []byte, off int64) (int, error) {
+	s.delay()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.writeAt(p, off)
+}
+
+func (s *Stream) Seek(offset int64, whence int) (int64, error) {
+	s.delay()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.fault(OpSeek, 0, 0); err != nil {
+		return s.pos, err
+	}
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += s.pos
+	case io.SeekEnd:
+		offset += int64(len(s.data))
+	default:
+		return s.pos, errors.New("pixitest: invalid whence")
+	}
+	if offset < 0 {
+		return s.pos, errors.New("pixitest: negative position")
+	}
+	s.pos = offset
+	return s.pos, nil
+}
+
+// Records the current contents of the stream as synced, unless a fault fails the call.
+func (s *Stream) Sync() error {
+	s.delay()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.fault(OpSync, 0, 0); err != nil {
+		return err
+	}
+	s.syncs++
+	s.synced = append(s.synced[:0], s.data...)
+	s.dirty = false
+	return nil
+}
+
+// Cuts the stream to the given size, or extends it with zeros.
+func (s *Stream) Truncate(size int64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if size < 0 {
+		return errors.New("pixitest: negative size")
+	}
+	if size <= int64(len(s.data)) {
+		s.data = s.data[:size]
+	} else {
+		s.data = append(s.data, make([]byte, size-int64(len(s.data)))...)
+	}
+	s.dirty = true
+	return nil
+}
+
+func (s *Stream) delay() {
+	s.lock.Lock()
+	latency := s.latency
+	s.lock.Unlock()
+	if latency > 0 {
+		time.Sleep(latency)
+	}
+}
+
+func (s *Stream) readAt(p []byte, off int64) (int, error) {
+	return s.readAtLimit(p, off, s.maxRead)
+}
+
+func (s *Stream) readAtLimit(p []byte, off int64, limit int) (int, error) {
+	if limit > 0 && len(p) > limit {
+		p = p[:limit]
+	}
+	if err := s.fault(OpRead, off, len(p)); err != nil {
+		return 0, err
+	}
+	if off >= int64(len(s.data)) {
+		if len(p) == 0 {
+			return 0, nil
+		}
+		return 0, io.EOF
+	}
+	n := copy(p, s.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (s *Stream) writeAt(p []byte, off int64) (int, error) {
+	if err := s.fault(OpWrite, off, len(p)); err != nil {
+		return 0, err
+	}
+	var err error
+	if s.maxWrite > 0 && len(p) > s.maxWrite {
+		p, err = p[:s.maxWrite], io.ErrShortWrite
+	}
+	if end := off + int64(len(p)); end > int64(len(s.data)) {
+		s.data = append(s.data, make([]byte, end-int64(len(s.data)))...)
+	}
+	copy(s.data[off:], p)
+	s.dirty = s.dirty || len(p) > 0
+	return len(p), err
+}
+
+// Counts a call of the operation, returning the error of the first fault it triggers, if any.
+func (s *Stream) fault(op Op, off int64, n int) error {
+	s.calls[op]++
+	for _, fault := range s.faults {
+		if fault.Op != op || (fault.Call != 0 && fault.Call != s.calls[op]) {
+			continue
+		}
+		if fault.Offset > 0 && (op == OpSeek || op == OpSync || off+int64(n) <= fault.Offset) {
+			continue
+		}
+		s.lastFault, s.faulted = fault, true
+		if fault.Err == nil {
+			return ErrInjected
+		}
+		return fault.Err
+	}
+	return nil
+}
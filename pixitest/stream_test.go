@@ -0,0 +1,149 @@
+package pixitest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/edit"
+)
+
+func TestStreamFaultsByCall(t *testing.T) {
+	s := NewStream([]byte("abcdef"))
+	errBroken := errors.New("broken")
+	s.Inject(Fault{Op: OpRead, Call: 2, Err: errBroken})
+
+	p := make([]byte, 2)
+	if n, err := s.Read(p); n != 2 || err != nil || string(p) != "ab" {
+		t.Fatalf("expected the first read to succeed, got %d %v %q", n, err, p)
+	}
+	if n, err := s.Read(p); n != 0 || !errors.Is(err, errBroken) {
+		t.Fatalf("expected the second read to fail, got %d %v", n, err)
+	}
+	if n, err := s.Read(p); n != 2 || err != nil || string(p) != "cd" {
+		t.Fatalf("expected the third read to carry on where the first stopped, got %d %v %q", n, err, p)
+	}
+	if fault, ok := s.LastFault(); !ok || fault.Call != 2 {
+		t.Errorf("expected the last fault to be recorded, got %+v", fault)
+	}
+	if s.Calls(OpRead) != 3 {
+		t.Errorf("expected 3 reads, got %d", s.Calls(OpRead))
+	}
+}
+
+func TestStreamFaultsByOffset(t *testing.T) {
+	s := NewStream(make([]byte, 100))
+	s.Inject(Fault{Op: OpWrite, Offset: 50})
+	if _, err := s.WriteAt([]byte{1, 2}, 10); err != nil {
+		t.Errorf("expected a write before the offset to succeed, got %v", err)
+	}
+	if _, err := s.WriteAt([]byte{1, 2}, 49); !errors.Is(err, ErrInjected) {
+		t.Errorf("expected a write reaching the offset to fail, got %v", err)
+	}
+	s.ClearFaults()
+	if _, err := s.WriteAt([]byte{1, 2}, 49); err != nil {
+		t.Errorf("expected cleared faults not to fail, got %v", err)
+	}
+}
+
+func TestStreamShortReadsAndWrites(t *testing.T) {
+	s := NewStream(nil)
+	s.SetShortWrites(3)
+	if n, err := s.Write([]byte("abcdef")); n != 3 || !errors.Is(err, io.ErrShortWrite) {
+		t.Errorf("expected a short write, got %d %v", n, err)
+	}
+	s.SetShortWrites(0)
+	if _, err := s.Write([]byte("def")); err != nil {
+		t.Fatal(err)
+	}
+
+	s.SetShortReads(1)
+	if _, err := s.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	p := make([]byte, 6)
+	if n, err := s.Read(p); n != 1 || err != nil {
+		t.Errorf("expected a single byte read, got %d %v", n, err)
+	}
+	if _, err := io.ReadFull(s, p[1:]); err != nil || string(p) != "abcdef" {
+		t.Errorf("expected the rest to be read a byte at a time, got %v %q", err, p)
+	}
+}
+
+func TestStreamSyncTracking(t *testing.T) {
+	s := NewStream([]byte("old"))
+	if _, err := s.WriteAt([]byte("new"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if !s.Dirty() || string(s.Synced()) != "old" {
+		t.Errorf("expected the write to be unsynced, got %q", s.Synced())
+	}
+	if err := s.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	s.Inject(Fault{Op: OpSync})
+	if _, err := s.WriteAt([]byte("bad"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Sync(); !errors.Is(err, ErrInjected) {
+		t.Errorf("expected the sync to fail, got %v", err)
+	}
+	if s.Syncs() != 1 || string(s.Synced()) != "new" || string(s.Bytes()) != "bad" {
+		t.Errorf("expected only the first sync to count, got %d syncs of %q", s.Syncs(), s.Synced())
+	}
+}
+
+func TestStreamLatency(t *testing.T) {
+	s := NewStream([]byte("abc"))
+	s.SetLatency(5 * time.Millisecond)
+	start := time.Now()
+	if _, err := s.ReadAt(make([]byte, 3), 0); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 5*time.Millisecond {
+		t.Errorf("expected the read to be delayed, took %v", elapsed)
+	}
+}
+
+func TestStreamWithPixi(t *testing.T) {
+	header := pixi.PixiHeader{Version: pixi.Version, OffsetSize: 4, ByteOrder: binary.LittleEndian}
+	write := func(s *Stream) error {
+		return edit.WriteContiguousTileOrderPixi(s, header, map[string]string{"k": "v"}, edit.LayerWriter{
+			Layer: pixi.NewLayer("layer", false, pixi.CompressionFlate,
+				pixi.DimensionSet{{Name: "x", Size: 16, TileSize: 8}}, []pixi.Field{{Name: "v", Type: pixi.FieldUint16}}),
+			IterFn: func(layer *pixi.Layer, coord pixi.SampleCoordinate) ([]any, map[string]any) {
+				return []any{uint16(coord[0])}, nil
+			},
+		})
+	}
+
+	healthy := NewStream(nil)
+	if err := write(healthy); err != nil {
+		t.Fatal(err)
+	}
+	for call := 1; call <= healthy.Calls(OpWrite); call++ {
+		s := NewStream(nil)
+		s.Inject(Fault{Op: OpWrite, Call: call})
+		if err := write(s); !errors.Is(err, ErrInjected) {
+			t.Errorf("expected failing write %d to be reported, got %v", call, err)
+		}
+	}
+
+	s := NewStream(healthy.Bytes())
+	s.SetShortReads(1)
+	summary, err := pixi.ReadPixi(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, summary.Layers[0].DiskTileSize(1))
+	if err := summary.Layers[0].ReadTile(s, summary.Header, 1, data); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data[:2], []byte{8, 0}) {
+		t.Errorf("expected the second tile to start with 8, got %v", data[:2])
+	}
+}
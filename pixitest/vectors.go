@@ -0,0 +1,448 @@
+package pixitest
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/internal/buffer"
+)
+
+// The expected outcome of reading a test vector whose file must be refused, see VectorDescription.
+const ExpectUnsupportedFeature = "unsupported-feature"
+
+// A tiny canonical Pixi file and a description of what reading it must produce, for checking that
+// implementations of the format in any language agree with this one. The set of vectors returned by
+// Vectors covers every header variant, field type, compression and layer flag, and extension sections.
+type Vector struct {
+	Description VectorDescription
+	File        []byte
+}
+
+// The JSON description written beside the file of each test vector. Samples are listed in sample index
+// order, with the first dimension varying fastest, each as the values of its fields in order. Integer
+// values stay within 53 bits so that they survive JSON parsers that read every number as a float64, and
+// floating point values are exactly representable in binary.
+type VectorDescription struct {
+	Name             string            `json:"name"`
+	Description      string            `json:"description"`
+	File             string            `json:"file"`
+	Expect           string            `json:"expect,omitempty"` // Empty if reading must succeed, otherwise the reason it must fail.
+	Version          int               `json:"version"`
+	OffsetSize       int               `json:"offsetSize"`
+	ByteOrder        string            `json:"byteOrder"`
+	Checksum         string            `json:"checksum"`
+	RequiredFeatures uint32            `json:"requiredFeatures"`
+	OptionalFeatures uint32            `json:"optionalFeatures"`
+	Tags             map[string]string `json:"tags,omitempty"`
+	BinaryTags       map[string][]byte `json:"binaryTags,omitempty"` // Encoded in base64.
+	Extensions       []VectorExtension `json:"extensions,omitempty"`
+	Layers           []VectorLayer     `json:"layers"`
+}
+
+// An extension section expected in the file tags of a test vector.
+type VectorExtension struct {
+	ID      uint32 `json:"id"`
+	Payload []byte `json:"payload"` // Encoded in base64.
+}
+
+// A layer expected in a test vector, with every one of its samples.
+type VectorLayer struct {
+	Name          string            `json:"name"`
+	Separated     bool              `json:"separated"`
+	Compression   string            `json:"compression"`
+	TileAlignment int               `json:"tileAlignment,omitempty"`
+	Dimensions    []VectorDimension `json:"dimensions"`
+	Fields        []VectorField     `json:"fields"`
+	Tags          map[string]string `json:"tags,omitempty"`
+	Samples       [][]any           `json:"samples"`
+}
+
+// A dimension of a layer expected in a test vector.
+type VectorDimension struct {
+	Name       string  `json:"name"`
+	Size       int     `json:"size"`
+	TileSize   int     `json:"tileSize"`
+	Unit       string  `json:"unit,omitempty"`
+	Direction  string  `json:"direction,omitempty"`
+	Resolution float64 `json:"resolution,omitempty"`
+}
+
+// A field of a layer expected in a test vector.
+type VectorField struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// The layers and tags a test vector is written from.
+type vectorSpec struct {
+	name        string
+	description string
+	expect      string
+	header      pixi.PixiHeader
+	tags        map[string]string
+	binary      map[string][]byte
+	extensions  []pixi.Extension
+	layers      []vectorLayer
+}
+
+type vectorLayer struct {
+	layer     *pixi.Layer
+	tags      map[string]string
+	unwritten []int // disk tiles left unwritten, which read as zeros
+}
+
+// Builds every test vector, in a fixed order. The files are byte-identical from run to run for a given Go
+// release, as compressed tiles are produced by the standard library compressors.
+func Vectors() ([]Vector, error) {
+	vectors := []Vector{}
+	for _, spec := range vectorSpecs() {
+		vector, err := spec.build()
+		if err != nil {
+			return nil, fmt.Errorf("pixitest: building vector %s: %w", spec.name, err)
+		}
+		vectors = append(vectors, vector)
+	}
+	return vectors, nil
+}
+
+// Writes every test vector into dir as a .pixi file and a .json description of the same name, and an
+// index.json listing the descriptions of all of them. The directory is created if needed.
+func WriteVectors(dir string) ([]VectorDescription, error) {
+	vectors, err := Vectors()
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(dir, 0777)
+	if err != nil {
+		return nil, err
+	}
+	descriptions := make([]VectorDescription, len(vectors))
+	for i, vector := range vectors {
+		descriptions[i] = vector.Description
+		err = os.WriteFile(filepath.Join(dir, vector.Description.File), vector.File, 0666)
+		if err != nil {
+			return nil, err
+		}
+		err = writeJSON(filepath.Join(dir, vector.Description.Name+".json"), vector.Description)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return descriptions, writeJSON(filepath.Join(dir, "index.json"), descriptions)
+}
+
+func writeJSON(name string, value any) error {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(name, append(data, '\n'), 0666)
+}
+
+func vectorSpecs() []vectorSpec {
+	specs := []vectorSpec{}
+	small := func(name string, compression pixi.Compression, fields ...pixi.FieldType) *pixi.Layer {
+		fieldSet := make([]pixi.Field, len(fields))
+		for i, field := range fields {
+			fieldSet[i] = pixi.Field{Name: fmt.Sprintf("f%d", i), Type: field}
+		}
+		return pixi.NewLayer(name, false, compression,
+			pixi.DimensionSet{{Name: "x", Size: 4, TileSize: 2}, {Name: "y", Size: 3, TileSize: 2}}, fieldSet)
+	}
+	orders := []struct {
+		name  string
+		order binary.ByteOrder
+	}{{"le", binary.LittleEndian}, {"be", binary.BigEndian}}
+
+	// every header variant
+	for version := 1; version <= pixi.Version; version++ {
+		for _, offsetSize := range []int{4, 8} {
+			for _, order := range orders {
+				specs = append(specs, vectorSpec{
+					name:        fmt.Sprintf("header-v%d-offset%d-%s", version, offsetSize, order.name),
+					description: fmt.Sprintf("version %d header with %d byte offsets in %s byte order", version, offsetSize, order.order),
+					header:      pixi.PixiHeader{Version: version, OffsetSize: offsetSize, ByteOrder: order.order},
+					tags:        map[string]string{"vector": "header"},
+					layers:      []vectorLayer{{layer: small("data", pixi.CompressionNone, pixi.FieldUint16)}},
+				})
+			}
+		}
+	}
+	for _, checksum := range []pixi.ChecksumAlgorithm{pixi.ChecksumCrc32, pixi.ChecksumCrc32c, pixi.ChecksumXxHash64, pixi.ChecksumNone} {
+		specs = append(specs, vectorSpec{
+			name:        "checksum-" + checksum.String(),
+			description: fmt.Sprintf("tiles followed by %s checksums", checksum),
+			header:      pixi.PixiHeader{Version: pixi.Version, OffsetSize: 4, ByteOrder: binary.LittleEndian, Checksum: checksum},
+			layers:      []vectorLayer{{layer: small("data", pixi.CompressionNone, pixi.FieldUint32)}},
+		})
+	}
+
+	// every field type in both byte orders, and every compression
+	for _, fieldType := range pixi.SupportedFieldTypes() {
+		for _, order := range orders {
+			specs = append(specs, vectorSpec{
+				name:        fmt.Sprintf("field-%s-%s", fieldType, order.name),
+				description: fmt.Sprintf("a single %s field in %s byte order", fieldType, order.order),
+				header:      pixi.PixiHeader{Version: pixi.Version, OffsetSize: 4, ByteOrder: order.order},
+				layers:      []vectorLayer{{layer: small("data", pixi.CompressionNone, fieldType)}},
+			})
+		}
+	}
+	for _, compression := range pixi.SupportedCompressions() {
+		specs = append(specs, vectorSpec{
+			name:        "compression-" + compression.String(),
+			description: fmt.Sprintf("tiles compressed with %s", compression),
+			header:      pixi.PixiHeader{Version: pixi.Version, OffsetSize: 4, ByteOrder: binary.BigEndian},
+			layers:      []vectorLayer{{layer: small("data", compression, pixi.FieldInt16, pixi.FieldFloat32)}},
+		})
+	}
+
+	// every layer flag, and layouts exercising tiling
+	header := pixi.PixiHeader{Version: pixi.Version, OffsetSize: 8, ByteOrder: binary.LittleEndian, Checksum: pixi.ChecksumXxHash64}
+	separated := pixi.NewLayer("separated", true, pixi.CompressionFlate, small("", pixi.CompressionNone).Dimensions,
+		[]pixi.Field{{Name: "f0", Type: pixi.FieldUint8}, {Name: "f1", Type: pixi.FieldFloat64}, {Name: "f2", Type: pixi.FieldInt32}})
+	aligned := small("aligned", pixi.CompressionNone, pixi.FieldUint8)
+	aligned.TileAlignment = 64
+	described := small("described", pixi.CompressionNone, pixi.FieldFloat32)
+	described.Dimensions[0].Unit, described.Dimensions[0].Direction, described.Dimensions[0].Resolution = "degrees_east", pixi.AxisIncreasing, 0.25
+	described.Dimensions[1].Unit, described.Dimensions[1].Direction, described.Dimensions[1].Resolution = "degrees_north", pixi.AxisDecreasing, 0.5
+	ranged := small("ranged", pixi.CompressionNone, pixi.FieldInt16, pixi.FieldUint64)
+	ranged.RecordTileRanges()
+	volume := pixi.NewLayer("volume", false, pixi.CompressionLzwLsb,
+		pixi.DimensionSet{{Name: "x", Size: 3, TileSize: 2}, {Name: "y", Size: 2, TileSize: 2}, {Name: "z", Size: 3, TileSize: 1}},
+		[]pixi.Field{{Name: "v", Type: pixi.FieldInt64}})
+	specs = append(specs,
+		vectorSpec{name: "layout-separated", description: "fields stored in separate tiles", header: header,
+			layers: []vectorLayer{{layer: separated}}},
+		vectorSpec{name: "layout-aligned", description: "tile offsets aligned to 64 bytes", header: header,
+			layers: []vectorLayer{{layer: aligned}}},
+		vectorSpec{name: "layout-dimension-metadata", description: "dimensions with units, directions and resolutions", header: header,
+			layers: []vectorLayer{{layer: described}}},
+		vectorSpec{name: "layout-tile-ranges", description: "the range of each field in each tile recorded in the layer header", header: header,
+			layers: []vectorLayer{{layer: ranged}}},
+		vectorSpec{name: "layout-layer-tags", description: "a layer with its own tag section", header: header,
+			layers: []vectorLayer{{layer: small("tagged", pixi.CompressionNone, pixi.FieldUint8), tags: map[string]string{"band": "red"}}}},
+		vectorSpec{name: "layout-three-dimensions", description: "three dimensions with partial edge tiles", header: header,
+			layers: []vectorLayer{{layer: volume}}},
+		vectorSpec{name: "layout-unwritten-tiles", description: "tiles never written, which read as zeros", header: header,
+			layers: []vectorLayer{{layer: small("sparse", pixi.CompressionFlate, pixi.FieldUint16), unwritten: []int{1, 2}}}},
+		vectorSpec{name: "layout-multiple-layers", description: "several layers chained one after the other", header: header,
+			layers: []vectorLayer{
+				{layer: small("first", pixi.CompressionNone, pixi.FieldUint8)},
+				{layer: small("second", pixi.CompressionFlate, pixi.FieldFloat64), tags: map[string]string{"role": "second"}},
+				{layer: small("third", pixi.CompressionLzwMsb, pixi.FieldInt8, pixi.FieldUint16)},
+			}},
+	)
+
+	// tags, extension sections and feature flags
+	specs = append(specs,
+		vectorSpec{name: "tags-binary", description: "binary and long string tags in the extended tag layout", header: header,
+			tags:   map[string]string{"title": "binary tags", "long": string(slices.Repeat([]byte("0123456789"), 6554))},
+			binary: map[string][]byte{"thumbnail": {0x89, 'P', 'N', 'G', 0x00, 0xff}},
+			layers: []vectorLayer{{layer: small("data", pixi.CompressionNone, pixi.FieldUint8)}}},
+		vectorSpec{name: "extensions", description: "extension sections, one of them of an unregistered kind readers must skip",
+			header: pixi.PixiHeader{Version: pixi.Version, OffsetSize: 4, ByteOrder: binary.BigEndian, OptionalFeatures: pixi.FeatureExtensions},
+			extensions: []pixi.Extension{
+				{ID: pixi.FirstApplicationExtension, Payload: []byte("first section")},
+				{ID: pixi.FirstApplicationExtension + 0xbeef, Payload: []byte{0, 1, 2, 3, 4, 5, 6, 7}},
+				{ID: pixi.FirstApplicationExtension + 2, Payload: []byte{}},
+			},
+			layers: []vectorLayer{{layer: small("data", pixi.CompressionNone, pixi.FieldUint8)}}},
+		vectorSpec{name: "features-optional-unknown", description: "an optional feature no reader knows, which must be ignored",
+			header: pixi.PixiHeader{Version: pixi.Version, OffsetSize: 4, ByteOrder: binary.LittleEndian, OptionalFeatures: 1 << 30},
+			layers: []vectorLayer{{layer: small("data", pixi.CompressionNone, pixi.FieldUint8)}}},
+		vectorSpec{name: "features-required-unknown", description: "a required feature no reader knows, which must make readers refuse the file",
+			expect: ExpectUnsupportedFeature,
+			header: pixi.PixiHeader{Version: pixi.Version, OffsetSize: 4, ByteOrder: binary.LittleEndian, RequiredFeatures: 1 << 30},
+			layers: []vectorLayer{{layer: small("data", pixi.CompressionNone, pixi.FieldUint8)}}},
+	)
+	return specs
+}
+
+// A deterministic value of the given type for a field of a sample, spread over the whole range of the
+// type as far as the limits described on VectorDescription allow.
+func vectorValue(fieldType pixi.FieldType, sample int, field int) any {
+	h := uint64(sample+1)*0x9e3779b97f4a7c15 ^ uint64(field+1)*0xbf58476d1ce4e5b9
+	switch fieldType {
+	case pixi.FieldInt8:
+		return int8(h)
+	case pixi.FieldUint8:
+		return uint8(h)
+	case pixi.FieldInt16:
+		return int16(h)
+	case pixi.FieldUint16:
+		return uint16(h)
+	case pixi.FieldInt32:
+		return int32(h)
+	case pixi.FieldUint32:
+		return uint32(h)
+	case pixi.FieldInt64:
+		return int64(h) >> 11
+	case pixi.FieldUint64:
+		return h >> 11
+	case pixi.FieldFloat32:
+		return float32(int16(h)) / 8
+	case pixi.FieldFloat64:
+		return float64(int32(h)) / 16
+	}
+	panic("pixitest: unsupported field type")
+}
+
+// The disk tile and offset into it holding a field of a sample.
+func vectorFieldLocation(layer *pixi.Layer, coord pixi.SampleCoordinate, fieldIndex int) (int, int) {
+	selector := coord.ToTileSelector(layer.Dimensions)
+	if layer.Separated {
+		return selector.Tile + layer.Dimensions.Tiles()*fieldIndex, selector.InTile * layer.Fields[fieldIndex].Size()
+	}
+	offset := selector.InTile * layer.SampleSize()
+	for _, field := range layer.Fields[:fieldIndex] {
+		offset += field.Size()
+	}
+	return selector.Tile, offset
+}
+
+func (s vectorSpec) build() (Vector, error) {
+	buf := buffer.NewBuffer(1024)
+	description, err := s.write(buf)
+	return Vector{Description: description, File: buf.Bytes()}, err
+}
+
+// Writes the file of the vector, returning its description.
+func (s vectorSpec) write(w io.WriteSeeker) (VectorDescription, error) {
+	header := s.header
+	description := VectorDescription{
+		Name:             s.name,
+		Description:      s.description,
+		File:             s.name + ".pixi",
+		Expect:           s.expect,
+		Version:          header.Version,
+		OffsetSize:       header.OffsetSize,
+		ByteOrder:        header.ByteOrder.String(),
+		Checksum:         header.Checksum.String(),
+		RequiredFeatures: uint32(header.RequiredFeatures),
+		OptionalFeatures: uint32(header.OptionalFeatures),
+		Tags:             s.tags,
+		BinaryTags:       s.binary,
+		Layers:           []VectorLayer{},
+	}
+
+	err := header.WriteHeader(w)
+	if err != nil {
+		return description, err
+	}
+	tagsOffset, err := w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return description, err
+	}
+	tags := &pixi.TagSection{Tags: s.tags, Binary: s.binary}
+	for _, ext := range s.extensions {
+		err = tags.SetExtension(ext)
+		if err != nil {
+			return description, err
+		}
+		description.Extensions = append(description.Extensions, VectorExtension{ID: uint32(ext.ID), Payload: ext.Payload})
+	}
+	err = tags.Write(w, header)
+	if err != nil {
+		return description, err
+	}
+
+	layerOffsets := make([]int64, len(s.layers))
+	for i, spec := range s.layers {
+		layer := spec.layer
+		if spec.tags != nil {
+			layer.Tags = []*pixi.TagSection{{Tags: spec.tags}}
+		}
+		layerOffsets[i], err = w.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return description, err
+		}
+		err = layer.WriteHeader(w, header)
+		if err != nil {
+			return description, err
+		}
+
+		tiles := make([][]byte, layer.DiskTiles())
+		for tileIndex := range tiles {
+			tiles[tileIndex] = make([]byte, layer.DiskTileSize(tileIndex))
+		}
+		for coord := range layer.Dimensions.SampleCoordinates() {
+			sampleIndex := int(coord.ToSampleIndex(layer.Dimensions))
+			for fieldIndex, field := range layer.Fields {
+				tileIndex, offset := vectorFieldLocation(layer, coord, fieldIndex)
+				field.ValueToBytes(vectorValue(field.Type, sampleIndex, fieldIndex), tiles[tileIndex][offset:], header.ByteOrder)
+			}
+		}
+		for _, tileIndex := range spec.unwritten {
+			clear(tiles[tileIndex])
+		}
+		for tileIndex, tile := range tiles {
+			if slices.Contains(spec.unwritten, tileIndex) {
+				continue
+			}
+			err = layer.WriteTile(w, header, tileIndex, tile)
+			if err != nil {
+				return description, err
+			}
+		}
+		if len(layer.Tags) > 0 {
+			err = layer.WriteTags(w, header)
+			if err != nil {
+				return description, err
+			}
+		}
+		description.Layers = append(description.Layers, describeVectorLayer(layer, spec.tags, header, tiles))
+	}
+
+	for i, spec := range s.layers {
+		if i < len(s.layers)-1 {
+			spec.layer.NextLayerStart = layerOffsets[i+1]
+		}
+		err = spec.layer.OverwriteHeader(w, header, layerOffsets[i])
+		if err != nil {
+			return description, err
+		}
+	}
+	firstLayer := int64(0)
+	if len(layerOffsets) > 0 {
+		firstLayer = layerOffsets[0]
+	}
+	return description, header.OverwriteOffsets(w, firstLayer, tagsOffset)
+}
+
+func describeVectorLayer(layer *pixi.Layer, tags map[string]string, header pixi.PixiHeader, tiles [][]byte) VectorLayer {
+	described := VectorLayer{
+		Name:          layer.Name,
+		Separated:     layer.Separated,
+		Compression:   layer.Compression.String(),
+		TileAlignment: layer.TileAlignment,
+		Dimensions:    make([]VectorDimension, len(layer.Dimensions)),
+		Fields:        make([]VectorField, len(layer.Fields)),
+		Tags:          tags,
+		Samples:       make([][]any, layer.Dimensions.Samples()),
+	}
+	for i, dim := range layer.Dimensions {
+		described.Dimensions[i] = VectorDimension{Name: dim.Name, Size: dim.Size, TileSize: dim.TileSize, Unit: dim.Unit, Resolution: dim.Resolution}
+		if dim.Direction != pixi.AxisUnspecified {
+			described.Dimensions[i].Direction = dim.Direction.String()
+		}
+	}
+	for i, field := range layer.Fields {
+		described.Fields[i] = VectorField{Name: field.Name, Type: field.Type.String()}
+	}
+	for coord := range layer.Dimensions.SampleCoordinates() {
+		sample := make([]any, len(layer.Fields))
+		for fieldIndex, field := range layer.Fields {
+			tileIndex, offset := vectorFieldLocation(layer, coord, fieldIndex)
+			sample[fieldIndex] = field.BytesToValue(tiles[tileIndex][offset:], header.ByteOrder)
+		}
+		described.Samples[coord.ToSampleIndex(layer.Dimensions)] = sample
+	}
+	return described
+}
@@ -0,0 +1,123 @@
+package pixitest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/edit"
+	"github.com/owlpinetech/pixi/internal/buffer"
+)
+
+func TestVectorsDecodeAsDescribed(t *testing.T) {
+	vectors, err := Vectors()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, vector := range vectors {
+		desc := vector.Description
+		summary, err := pixi.ReadPixi(buffer.NewBufferFrom(vector.File))
+		if desc.Expect == ExpectUnsupportedFeature {
+			var featureErr pixi.FeatureError
+			if !errors.As(err, &featureErr) {
+				t.Errorf("%s: expected the file to be refused for its features, got %v", desc.Name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", desc.Name, err)
+			continue
+		}
+
+		header := summary.Header
+		if header.Version != desc.Version || header.OffsetSize != desc.OffsetSize || header.ByteOrder.String() != desc.ByteOrder ||
+			header.Checksum.String() != desc.Checksum || uint32(header.OptionalFeatures) != desc.OptionalFeatures {
+			t.Errorf("%s: header %+v does not match its description", desc.Name, header)
+		}
+		for key, value := range desc.Tags {
+			if summary.Tags[0].Tags[key] != value {
+				t.Errorf("%s: expected tag %s to be read back", desc.Name, key)
+			}
+		}
+		for key, payload := range desc.BinaryTags {
+			if !bytes.Equal(summary.Tags[0].Binary[key], payload) {
+				t.Errorf("%s: expected binary tag %s to be read back", desc.Name, key)
+			}
+		}
+		extensions, err := summary.Extensions()
+		if err != nil || len(extensions) != len(desc.Extensions) {
+			t.Errorf("%s: expected %d extension sections, got %v %v", desc.Name, len(desc.Extensions), extensions, err)
+		}
+
+		if len(summary.Layers) != len(desc.Layers) {
+			t.Fatalf("%s: expected %d layers, got %d", desc.Name, len(desc.Layers), len(summary.Layers))
+		}
+		for i, layer := range summary.Layers {
+			want := desc.Layers[i]
+			if layer.Name != want.Name || layer.Compression.String() != want.Compression || len(layer.Dimensions) != len(want.Dimensions) {
+				t.Errorf("%s: layer %s does not match its description", desc.Name, layer.Name)
+				continue
+			}
+			memory, err := edit.NewMemoryLayer(buffer.NewBufferFrom(vector.File), header, layer, summary.LayerOffset(layer))
+			if err != nil {
+				t.Errorf("%s: layer %s: %v", desc.Name, layer.Name, err)
+				continue
+			}
+			for coord := range layer.Dimensions.SampleCoordinates() {
+				got, expected := memory.SampleAt(coord), want.Samples[coord.ToSampleIndex(layer.Dimensions)]
+				if !reflect.DeepEqual(got, expected) {
+					t.Errorf("%s: layer %s: sample at %v is %v, expected %v", desc.Name, layer.Name, coord, got, expected)
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestVectorsAreDeterministic(t *testing.T) {
+	first, err := Vectors()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := Vectors()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range first {
+		if !bytes.Equal(first[i].File, second[i].File) {
+			t.Errorf("expected vector %s to be byte-identical between runs", first[i].Description.Name)
+		}
+	}
+}
+
+func TestWriteVectors(t *testing.T) {
+	dir := t.TempDir()
+	descriptions, err := WriteVectors(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "index.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := []VectorDescription{}
+	if err := json.Unmarshal(data, &index); err != nil {
+		t.Fatal(err)
+	}
+	if len(index) != len(descriptions) {
+		t.Fatalf("expected %d vectors in the index, got %d", len(descriptions), len(index))
+	}
+	for _, desc := range index {
+		if _, err := os.Stat(filepath.Join(dir, desc.File)); err != nil {
+			t.Errorf("expected the file of vector %s to be written: %v", desc.Name, err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, desc.Name+".json")); err != nil {
+			t.Errorf("expected the description of vector %s to be written: %v", desc.Name, err)
+		}
+	}
+}
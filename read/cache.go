@@ -1,11 +1,15 @@
 package read
 
 import (
+	"context"
 	"io"
 	"math"
+	"slices"
 	"sync"
+	"time"
 
 	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/internal/preload"
 )
 
 type CacheManager[K comparable, V any] interface {
@@ -15,12 +19,20 @@ type CacheManager[K comparable, V any] interface {
 }
 
 type LayerReadCache struct {
-	lock    sync.RWMutex
-	layer   *pixi.Layer
-	header  pixi.PixiHeader
-	backing io.ReadSeeker
-	cache   *sync.Map // map[int][]byte, but safe for concurrent access/modification
-	manager CacheManager[int, []byte]
+	lock     sync.RWMutex
+	layer    *pixi.Layer
+	header   pixi.PixiHeader
+	backing  io.ReadSeeker
+	cache    *sync.Map // map[int][]byte, but safe for concurrent access/modification
+	manager  CacheManager[int, []byte]
+	options  pixi.TileReadOptions
+	tracer   Tracer
+	partial  bool
+	prefetch *prefetcher
+	readers  *preload.Group // the background reads ahead, at most one per tile being read ahead
+	inflight sync.Map       // tiles being read ahead, so that each is only read once
+	decoders chan struct{}  // a slot for each goroutine that may decode at once, or nil to decode under the lock, see NewParallelLayerReadCache
+	loading  sync.Map       // map[int]*tileLoad, the tiles being decoded outside the lock
 }
 
 func NewLayerReadCache(backing io.ReadSeeker, header pixi.PixiHeader, layer *pixi.Layer, eviction CacheManager[int, []byte]) *LayerReadCache {
@@ -33,32 +45,87 @@ func NewLayerReadCache(backing io.ReadSeeker, header pixi.PixiHeader, layer *pix
 	}
 }
 
+// Sets the options used when loading tiles into the cache, such as how tile checksums are verified.
+func (c *LayerReadCache) SetTileReadOptions(options pixi.TileReadOptions) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.options = options
+}
+
+// Sets a tracer to receive a record of every tile requested from the cache, or nil to stop tracing.
+func (c *LayerReadCache) SetTracer(tracer Tracer) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.tracer = tracer
+}
+
+// Sets whether samples of an uncompressed layer are read straight from the backing stream, only the bytes
+// needed at a time, rather than by loading their whole tiles into the cache. Meant for point and small
+// window queries against remote files, where fetching whole tiles wastes bandwidth; tiles already in the
+// cache are still used. Partial reads skip checksum verification, since a checksum covers a whole tile,
+// and have no effect on compressed layers.
+func (c *LayerReadCache) SetPartialReads(enabled bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.partial = enabled
+}
+
+// Enables reading ahead of the tiles requested from the cache, or disables it if maxDepth is not
+// positive. The cache watches the order in which tiles are requested, and once it is confident that they
+// follow a constant step (sequential, or strided as when walking down a column of tiles) it reads tiles
+// further along that step in the background, doubling how far ahead it reads with each request that
+// confirms the pattern, up to maxDepth tiles or half the capacity of the cache manager. Requests off the
+// pattern halve the read ahead, and only several in a row abandon the pattern, so a stray request does
+// not stop a scan from being read ahead. At most maxDepth batches of tiles are read ahead at once, and
+// batches found while that many are being read are left for the requests that need them.
+func (c *LayerReadCache) SetPrefetch(maxDepth int) {
+	if capacity := c.manager.MaxInCache(); capacity > 0 {
+		maxDepth = min(maxDepth, capacity/2)
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if maxDepth <= 0 {
+		c.prefetch, c.readers = nil, nil
+	} else {
+		c.prefetch = newPrefetcher(c.layer, maxDepth)
+		c.readers = preload.NewGroup(context.Background(), maxDepth)
+	}
+}
+
+// The pattern in which tiles are currently being requested, as detected for reading ahead. Always
+// pixi.AccessRandom unless prefetching is enabled with SetPrefetch.
+func (c *LayerReadCache) AccessPattern() pixi.AccessPattern {
+	c.lock.RLock()
+	prefetch := c.prefetch
+	c.lock.RUnlock()
+	if prefetch == nil {
+		return pixi.AccessRandom
+	}
+	return prefetch.pattern()
+}
+
 func (c *LayerReadCache) SampleAt(coord pixi.SampleCoordinate) ([]any, error) {
 	tileSelector := coord.ToTileSelector(c.layer.Dimensions)
 	if c.layer.Separated {
 		sample := make([]any, len(c.layer.Fields))
 		for fieldIndex, field := range c.layer.Fields {
-			fieldTile := tileSelector.Tile + c.layer.Dimensions.Tiles()*fieldIndex
-			fieldOffset := tileSelector.InTile * field.Size()
-
-			tileData, err := c.getTile(fieldTile)
+			tileIndex, offset := c.fieldLocation(tileSelector, fieldIndex)
+			data, err := c.tileBytes(tileIndex, offset, field.Size())
 			if err != nil {
 				return nil, err
 			}
-
-			sample[fieldIndex] = field.BytesToValue(tileData[fieldOffset:], c.header.ByteOrder)
+			sample[fieldIndex] = field.BytesToValue(data, c.header.ByteOrder)
 		}
 		return sample, nil
 	} else {
-		fieldOffset := tileSelector.InTile * c.layer.SampleSize()
-
-		tileData, err := c.getTile(tileSelector.Tile)
+		data, err := c.tileBytes(tileSelector.Tile, tileSelector.InTile*c.layer.SampleSize(), c.layer.SampleSize())
 		if err != nil {
 			return nil, err
 		}
 		sample := make([]any, len(c.layer.Fields))
+		fieldOffset := 0
 		for i, field := range c.layer.Fields {
-			sample[i] = field.BytesToValue(tileData[fieldOffset:], c.header.ByteOrder)
+			sample[i] = field.BytesToValue(data[fieldOffset:], c.header.ByteOrder)
 			fieldOffset += field.Size()
 		}
 		return sample, nil
@@ -67,25 +134,225 @@ func (c *LayerReadCache) SampleAt(coord pixi.SampleCoordinate) ([]any, error) {
 
 func (c *LayerReadCache) FieldAt(coord pixi.SampleCoordinate, fieldIndex int) (any, error) {
 	tileSelector := coord.ToTileSelector(c.layer.Dimensions)
-	offset := tileSelector.InTile
-	if c.layer.Separated {
-		tileSelector.Tile *= c.layer.Dimensions.Tiles()
-		offset *= c.layer.Fields[fieldIndex].Size()
-	} else {
-		offset *= c.layer.SampleSize()
-		for _, field := range c.layer.Fields[:fieldIndex] {
-			offset += field.Size()
+	tileIndex, offset := c.fieldLocation(tileSelector, fieldIndex)
+	data, err := c.tileBytes(tileIndex, offset, c.layer.Fields[fieldIndex].Size())
+	if err != nil {
+		return nil, err
+	}
+	return c.layer.Fields[fieldIndex].BytesToValue(data, c.header.ByteOrder), nil
+}
+
+// Reads the given channels (field indices) of every sample in the region from start (inclusive) to end
+// (exclusive), returning one slice per sample, in order with the first dimension varying fastest, holding
+// the values of the channels in the order given. For separated layers only the disk tiles of the
+// requested channels are read and decoded, so reading one band of a many-band layer costs no more than
+// reading a layer of just that band.
+func (c *LayerReadCache) ReadChannels(start pixi.SampleCoordinate, end pixi.SampleCoordinate, channels []int) ([][]any, error) {
+	dims := c.layer.Dimensions
+	if len(start) != len(dims) || len(end) != len(dims) {
+		return nil, pixi.FormatError("region does not match the number of layer dimensions")
+	}
+	samples := 1
+	for i, dim := range dims {
+		if start[i] < 0 || end[i] > dim.Size || start[i] >= end[i] {
+			return nil, pixi.FormatError("region is empty or outside the layer")
+		}
+		samples *= end[i] - start[i]
+	}
+	for _, channel := range channels {
+		if channel < 0 || channel >= len(c.layer.Fields) {
+			return nil, pixi.FormatError("channel index is outside the fields of the layer")
 		}
 	}
 
-	tileData, err := c.getTile(tileSelector.Tile)
+	forEachSample := func(visit func(tileSelector pixi.TileSelector) error) error {
+		coord := slices.Clone(start)
+		for range samples {
+			err := visit(coord.ToTileSelector(dims))
+			if err != nil {
+				return err
+			}
+			for i := range coord {
+				coord[i]++
+				if coord[i] < end[i] {
+					break
+				}
+				coord[i] = start[i]
+			}
+		}
+		return nil
+	}
+
+	// with partial reads, the bytes the region needs from each uncached tile are read in a single span
+	spans := map[int]tileSpan{}
+	if c.partialReads() {
+		forEachSample(func(tileSelector pixi.TileSelector) error {
+			for _, channel := range channels {
+				tileIndex, offset := c.fieldLocation(tileSelector, channel)
+				if _, cached := c.cache.Load(tileIndex); cached || !c.storedDecoded(tileIndex) {
+					continue
+				}
+				span := tileSpan{start: offset, end: offset + c.layer.Fields[channel].Size()}
+				if found, ok := spans[tileIndex]; ok {
+					span.start, span.end = min(span.start, found.start), max(span.end, found.end)
+				}
+				spans[tileIndex] = span
+			}
+			return nil
+		})
+		for tileIndex, span := range spans {
+			span.data = make([]byte, span.end-span.start)
+			err := c.readSpan(tileIndex, span.start, span.data)
+			if err != nil {
+				return nil, err
+			}
+			spans[tileIndex] = span
+		}
+	}
+
+	values := make([][]any, 0, samples)
+	err := forEachSample(func(tileSelector pixi.TileSelector) error {
+		sample := make([]any, len(channels))
+		for i, channel := range channels {
+			tileIndex, offset := c.fieldLocation(tileSelector, channel)
+			var data []byte
+			if span, found := spans[tileIndex]; found {
+				data = span.data[offset-span.start:]
+			} else {
+				tileData, err := c.getTile(tileIndex)
+				if err != nil {
+					return err
+				}
+				data = tileData[offset:]
+			}
+			sample[i] = c.layer.Fields[channel].BytesToValue(data, c.header.ByteOrder)
+		}
+		values = append(values, sample)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	return c.layer.Fields[fieldIndex].BytesToValue(tileData[offset:], c.header.ByteOrder), nil
+	return values, nil
+}
+
+// A span of bytes read from a disk tile without loading the whole tile.
+type tileSpan struct {
+	start, end int
+	data       []byte
+}
+
+// The index of the disk tile holding a field of the selected sample, and the offset of the field in it.
+func (c *LayerReadCache) fieldLocation(tileSelector pixi.TileSelector, fieldIndex int) (int, int) {
+	if c.layer.Separated {
+		return tileSelector.Tile + c.layer.Dimensions.Tiles()*fieldIndex, tileSelector.InTile * c.layer.Fields[fieldIndex].Size()
+	}
+	offset := tileSelector.InTile * c.layer.SampleSize()
+	for _, field := range c.layer.Fields[:fieldIndex] {
+		offset += field.Size()
+	}
+	return tileSelector.Tile, offset
+}
+
+// Returns the decoded data of the disk tile at the given index, loading it into the cache if it is not
+// already there. The returned slice is shared with the cache and must not be modified.
+func (c *LayerReadCache) Tile(tileIndex int) ([]byte, error) {
+	return c.getTile(tileIndex)
+}
+
+// Returns size bytes of the decoded disk tile from the given offset: from the cache if the tile is there,
+// read directly if partial reads are enabled, and otherwise by loading the tile into the cache.
+func (c *LayerReadCache) tileBytes(tileIndex int, offset int, size int) ([]byte, error) {
+	if _, cached := c.cache.Load(tileIndex); !cached && c.partialReads() && c.storedDecoded(tileIndex) {
+		data := make([]byte, size)
+		return data, c.readSpan(tileIndex, offset, data)
+	}
+	tileData, err := c.getTile(tileIndex)
+	if err != nil {
+		return nil, err
+	}
+	return tileData[offset : offset+size], nil
+}
+
+func (c *LayerReadCache) partialReads() bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.partial && c.layer.Compression == pixi.CompressionNone
+}
+
+// Reports whether the disk tile is stored uncompressed, for layers that record the compression of each
+// tile and may hold tiles copied from compressed layers.
+func (c *LayerReadCache) storedDecoded(tileIndex int) bool {
+	return c.layer.TileCompressions == nil || c.layer.TileCompressions[tileIndex] == pixi.CompressionNone
+}
+
+// Reads a span of the disk tile straight from the backing stream, bypassing the cache.
+func (c *LayerReadCache) readSpan(tileIndex int, offset int, data []byte) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	start := time.Now()
+	err := c.layer.ReadTileSpan(c.backing, tileIndex, offset, data)
+	if err == nil && c.tracer != nil {
+		c.tracer(TileRead{Time: start, Layer: c.layer.Name, Tile: tileIndex, Bytes: len(data), Latency: time.Since(start)})
+	}
+	return err
 }
 
 func (c *LayerReadCache) getTile(tileIndex int) ([]byte, error) {
+	c.lock.RLock()
+	tracer, prefetch, readers := c.tracer, c.prefetch, c.readers
+	c.lock.RUnlock()
+	if prefetch != nil {
+		if ahead := prefetch.observe(tileIndex); len(ahead) > 0 {
+			readers.TryGo(func(ctx context.Context) error {
+				c.prefetchTiles(ctx, ahead)
+				return nil
+			})
+		}
+	}
+	if tracer == nil {
+		return c.cachedTile(tileIndex)
+	}
+
+	start := time.Now()
+	_, hit := c.cache.Load(tileIndex)
+	tile, err := c.cachedTile(tileIndex)
+	if err == nil {
+		tracer(TileRead{Time: start, Layer: c.layer.Name, Tile: tileIndex, Bytes: len(tile), Latency: time.Since(start), Hit: hit})
+	}
+	return tile, err
+}
+
+// Loads the given tiles into the cache in the background, until the context is done. Errors are left for
+// the requests that need the tiles to find.
+func (c *LayerReadCache) prefetchTiles(ctx context.Context, tiles []int) {
+	// hinted first so that a remote stream can fetch adjacent tiles with one request
+	missing := slices.DeleteFunc(slices.Clone(tiles), func(tileIndex int) bool {
+		_, cached := c.cache.Load(tileIndex)
+		return cached
+	})
+	c.lock.Lock()
+	c.layer.HintTiles(c.backing, c.header, missing)
+	c.lock.Unlock()
+	for _, tileIndex := range missing {
+		if ctx.Err() != nil {
+			return
+		}
+		if c.layer.TileBytes[tileIndex] == 0 {
+			continue
+		}
+		if _, cached := c.cache.Load(tileIndex); cached {
+			continue
+		}
+		if _, loading := c.inflight.LoadOrStore(tileIndex, true); loading {
+			continue
+		}
+		c.loadTile(tileIndex)
+		c.inflight.Delete(tileIndex)
+	}
+}
+
+func (c *LayerReadCache) cachedTile(tileIndex int) ([]byte, error) {
 	c.manager.Access(tileIndex)
 	if tile, ok := c.cache.Load(tileIndex); ok {
 		return tile.([]byte), nil
@@ -95,6 +362,9 @@ func (c *LayerReadCache) getTile(tileIndex int) ([]byte, error) {
 }
 
 func (c *LayerReadCache) loadTile(tileIndex int) ([]byte, error) {
+	if c.decoders != nil {
+		return c.decodeTile(tileIndex)
+	}
 	c.lock.Lock()
 	defer c.lock.Unlock()
 	// in case multiple readers get locked trying to load the same tile
@@ -103,13 +373,13 @@ func (c *LayerReadCache) loadTile(tileIndex int) ([]byte, error) {
 	}
 
 	chunk := make([]byte, c.layer.DiskTileSize(tileIndex))
-	err := c.layer.ReadTile(c.backing, c.header, tileIndex, chunk)
+	err := c.layer.ReadTileWithOptions(c.backing, c.header, tileIndex, chunk, c.options)
 	if err != nil {
 		return nil, err
 	}
+	// the chunk is returned directly, since a manager shared with other caches may already have evicted it
 	c.manager.Add(tileIndex, chunk, c.cache)
-	tileData, _ := c.cache.Load(tileIndex)
-	return tileData.([]byte), err
+	return chunk, nil
 }
 
 type LfuCacheManager struct {
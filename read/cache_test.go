@@ -1,8 +1,10 @@
 package read
 
 import (
+	"bytes"
 	"encoding/binary"
 	"math/rand/v2"
+	"reflect"
 	"sync"
 	"testing"
 
@@ -68,3 +70,120 @@ func testSampleAtSameAsRaw(t *testing.T, wg *sync.WaitGroup, cache *LayerReadCac
 		t.Errorf("expected %v but got %v at coord %v", expect, at, coord)
 	}
 }
+
+func TestReadChannelsOfSeparatedLayer(t *testing.T) {
+	header := pixi.PixiHeader{Version: pixi.Version, OffsetSize: 4, ByteOrder: binary.LittleEndian}
+	layer := pixi.NewLayer("bands", true, pixi.CompressionNone,
+		pixi.DimensionSet{{Name: "x", Size: 6, TileSize: 4}, {Name: "y", Size: 5, TileSize: 4}},
+		[]pixi.Field{{Name: "a", Type: pixi.FieldUint8}, {Name: "b", Type: pixi.FieldUint16}, {Name: "c", Type: pixi.FieldUint8}})
+
+	// each field of each sample holds its field index and tile sample index, so values can be checked
+	wrtBuf := buffer.NewBuffer(10)
+	for fieldIndex, field := range layer.Fields {
+		for tile := range layer.Dimensions.Tiles() {
+			diskTile := tile + fieldIndex*layer.Dimensions.Tiles()
+			chunk := make([]byte, layer.DiskTileSize(diskTile))
+			for inTile := range layer.Dimensions.TileSamples() {
+				field.ValueToBytes(field.Type.Float64ToValue(float64(fieldIndex*100+inTile)), chunk[inTile*field.Size():], header.ByteOrder)
+			}
+			if err := layer.WriteTile(wrtBuf, header, diskTile, chunk); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	cache := NewLayerReadCache(buffer.NewBufferFrom(wrtBuf.Bytes()), header, layer, NewLfuCacheManager(16))
+	readTiles := map[int]bool{}
+	cache.SetTracer(func(read TileRead) { readTiles[read.Tile] = true })
+	start, end := pixi.SampleCoordinate{2, 1}, pixi.SampleCoordinate{6, 5}
+	values, err := cache.ReadChannels(start, end, []int{2, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 16 {
+		t.Fatalf("expected 16 samples, got %d", len(values))
+	}
+	sample := 0
+	for y := start[1]; y < end[1]; y++ {
+		for x := start[0]; x < end[0]; x++ {
+			inTile := pixi.SampleCoordinate{x, y}.ToTileSelector(layer.Dimensions).InTile
+			if values[sample][0] != uint8(200+inTile) || values[sample][1] != uint16(100+inTile) {
+				t.Errorf("unexpected channels %v at %d,%d", values[sample], x, y)
+			}
+			sample++
+		}
+	}
+	for tile := range readTiles {
+		if tile < layer.Dimensions.Tiles() {
+			t.Errorf("read tile %d of the unrequested first field", tile)
+		}
+	}
+
+	if field, err := cache.FieldAt(pixi.SampleCoordinate{5, 4}, 1); err != nil || field != values[15][1] {
+		t.Errorf("expected FieldAt to agree with ReadChannels, got %v (%v)", field, err)
+	}
+}
+
+// Counts the bytes read from a stream, through both Read and ReadAt.
+type countingReader struct {
+	*bytes.Reader
+	read int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.Reader.Read(p)
+	c.read += n
+	return n, err
+}
+
+func (c *countingReader) ReadAt(p []byte, off int64) (int, error) {
+	n, err := c.Reader.ReadAt(p, off)
+	c.read += n
+	return n, err
+}
+
+func TestPartialReadsOfUncompressedLayer(t *testing.T) {
+	header := pixi.PixiHeader{Version: pixi.Version, OffsetSize: 4, ByteOrder: binary.BigEndian, Checksum: pixi.ChecksumCrc32}
+	layer := pixi.NewLayer("partial", false, pixi.CompressionNone,
+		pixi.DimensionSet{{Name: "x", Size: 64, TileSize: 32}, {Name: "y", Size: 64, TileSize: 32}},
+		[]pixi.Field{{Name: "one", Type: pixi.FieldUint16}, {Name: "two", Type: pixi.FieldUint32}})
+	wrtBuf := buffer.NewBuffer(10)
+	for i := range layer.Dimensions.Tiles() {
+		chunk := make([]byte, layer.DiskTileSize(i))
+		for j := range chunk {
+			chunk[j] = byte(rand.IntN(256))
+		}
+		if err := layer.WriteTile(wrtBuf, header, i, chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	whole := NewLayerReadCache(bytes.NewReader(wrtBuf.Bytes()), header, layer, NewLfuCacheManager(4))
+	backing := &countingReader{Reader: bytes.NewReader(wrtBuf.Bytes())}
+	partial := NewLayerReadCache(backing, header, layer, NewLfuCacheManager(4))
+	partial.SetPartialReads(true)
+
+	coord := pixi.SampleCoordinate{40, 3}
+	expect, err := whole.SampleAt(coord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sample, err := partial.SampleAt(coord); err != nil || !reflect.DeepEqual(sample, expect) {
+		t.Errorf("expected partial sample %v, got %v (%v)", expect, sample, err)
+	}
+	if field, err := partial.FieldAt(coord, 1); err != nil || field != expect[1] {
+		t.Errorf("expected partial field %v, got %v (%v)", expect[1], field, err)
+	}
+
+	start, end := pixi.SampleCoordinate{30, 30}, pixi.SampleCoordinate{34, 34}
+	expectWindow, err := whole.ReadChannels(start, end, []int{1, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if window, err := partial.ReadChannels(start, end, []int{1, 0}); err != nil || !reflect.DeepEqual(window, expectWindow) {
+		t.Errorf("expected partial window to match whole tile reads (%v)", err)
+	}
+	if backing.read >= layer.DiskTileSize(0) {
+		t.Errorf("expected partial reads to read less than a single tile, read %d bytes", backing.read)
+	}
+}
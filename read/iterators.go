@@ -16,6 +16,7 @@ func LayerContiguousTileOrder(r io.ReadSeeker, header pixi.PixiHeader, layer *pi
 		panic("this iterator does not support files with separated fields")
 	}
 	return func(yield func(pixi.SampleCoordinate, []any) bool) {
+		hintTiles(r, header, layer, func(int) bool { return true })
 		for tileInd := 0; tileInd < layer.Dimensions.Tiles(); tileInd++ {
 			tileData := make([]byte, layer.DiskTileSize(tileInd))
 			inTileOffset := 0
@@ -61,6 +62,7 @@ func LayerContiguousTileOrderSingleValue(r io.ReadSeeker, header pixi.PixiHeader
 		fieldSkip += layer.Fields[fieldInd].Size()
 	}
 	return func(yield func(pixi.SampleCoordinate, any) bool) {
+		hintTiles(r, header, layer, func(int) bool { return true })
 		for tileInd := 0; tileInd < layer.Dimensions.Tiles(); tileInd++ {
 			tileData := make([]byte, layer.DiskTileSize(tileInd))
 			inTileOffset := fieldOffset
@@ -0,0 +1,69 @@
+package read
+
+import (
+	"io"
+
+	"github.com/owlpinetech/pixi"
+)
+
+// A tile being read and decoded by one goroutine, which others needing the same tile wait for.
+type tileLoad struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+// Creates a cache as NewLayerReadCache does, but which decodes tiles on up to workers goroutines at once
+// (see pixi.Workers) rather than one at a time: only reading the stored bytes of a tile from the backing
+// stream holds the lock of the cache, while decompressing and verifying them does not, so goroutines
+// sampling the cache concurrently decode their tiles in parallel from the one shared cache. For a single
+// goroutine sampling in order, such as a decimation job, the cache also reads ahead (see SetPrefetch) up
+// to workers tiles, so that the tiles it will need next are decoded in the background while it works
+// through the current one.
+func NewParallelLayerReadCache(backing io.ReadSeeker, header pixi.PixiHeader, layer *pixi.Layer, eviction CacheManager[int, []byte], workers int) *LayerReadCache {
+	workers = pixi.Workers(workers)
+	c := NewLayerReadCache(backing, header, layer, eviction)
+	c.decoders = make(chan struct{}, workers)
+	c.SetPrefetch(workers)
+	return c
+}
+
+// Loads a tile into the cache, reading it under the lock and decoding it outside of it. Each tile is only
+// loaded by one goroutine at a time, and others asking for it meanwhile get the same result.
+func (c *LayerReadCache) decodeTile(tileIndex int) ([]byte, error) {
+	load := &tileLoad{done: make(chan struct{})}
+	if other, loading := c.loading.LoadOrStore(tileIndex, load); loading {
+		other := other.(*tileLoad)
+		<-other.done
+		return other.data, other.err
+	}
+	defer func() {
+		c.loading.Delete(tileIndex)
+		close(load.done)
+	}()
+	if tile, ok := c.cache.Load(tileIndex); ok {
+		load.data = tile.([]byte)
+		return load.data, nil
+	}
+
+	c.lock.Lock()
+	encoded, checksum, err := c.layer.ReadEncodedTile(c.backing, c.header, tileIndex)
+	options := c.options
+	c.lock.Unlock()
+	if err != nil {
+		load.err = err
+		return nil, err
+	}
+
+	c.decoders <- struct{}{}
+	chunk := make([]byte, c.layer.DiskTileSize(tileIndex))
+	err = c.layer.DecodeTile(c.header, tileIndex, encoded, checksum, chunk, options)
+	<-c.decoders
+	if err != nil {
+		load.err = err
+		return nil, err
+	}
+	c.manager.Add(tileIndex, chunk, c.cache)
+	load.data = chunk
+	return chunk, nil
+}
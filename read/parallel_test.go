@@ -0,0 +1,95 @@
+package read
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/internal/buffer"
+)
+
+// Writes a flate compressed layer whose samples hold the sum of their coordinates.
+func writeSummedLayer(t *testing.T, header pixi.PixiHeader) (*pixi.Layer, []byte) {
+	t.Helper()
+	layer := pixi.NewLayer("summed", false, pixi.CompressionFlate,
+		pixi.DimensionSet{{Name: "x", Size: 64, TileSize: 16}, {Name: "y", Size: 64, TileSize: 16}},
+		[]pixi.Field{{Name: "v", Type: pixi.FieldUint16}})
+	buf := buffer.NewBuffer(10)
+	for tileIndex := range layer.DiskTiles() {
+		chunk := make([]byte, layer.DiskTileSize(tileIndex))
+		for inTile := range layer.Dimensions.TileSamples() {
+			coord := pixi.TileSelector{Tile: tileIndex, InTile: inTile}.ToTileCoordinate(layer.Dimensions).ToSampleCoordinate(layer.Dimensions)
+			header.ByteOrder.PutUint16(chunk[inTile*2:], uint16(coord[0]+coord[1]))
+		}
+		if err := layer.WriteTile(buf, header, tileIndex, chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return layer, buf.Bytes()
+}
+
+func TestParallelCacheSampleConcurrent(t *testing.T) {
+	header := pixi.PixiHeader{Version: pixi.Version, OffsetSize: 4, ByteOrder: binary.LittleEndian}
+	layer, data := writeSummedLayer(t, header)
+	backing := &countingReader{Reader: bytes.NewReader(data)}
+	cache := NewParallelLayerReadCache(backing, header, layer, NewLfuCacheManager(layer.DiskTiles()), 4)
+
+	var wg sync.WaitGroup
+	for worker := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// every goroutine walks the whole layer from a different row, so that they overlap on every tile
+			for y := range 64 {
+				for x := range 64 {
+					coord := pixi.SampleCoordinate{x, (y + worker*8) % 64}
+					sample, err := cache.SampleAt(coord)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					if sample[0] != uint16(coord[0]+coord[1]) {
+						t.Errorf("expected %d at %v, got %v", coord[0]+coord[1], coord, sample[0])
+						return
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	stored := 0
+	for tileIndex := range layer.DiskTiles() {
+		stored += int(layer.TileBytes[tileIndex]) + header.Checksum.Size()
+	}
+	if backing.read != stored {
+		t.Errorf("expected each tile to be read once, %d bytes, but read %d", stored, backing.read)
+	}
+}
+
+func TestParallelCacheSharesErrors(t *testing.T) {
+	header := pixi.PixiHeader{Version: pixi.Version, OffsetSize: 4, ByteOrder: binary.BigEndian}
+	layer, data := writeSummedLayer(t, header)
+	// corrupt the checksum of the first tile
+	data[layer.TileOffsets[0]+layer.TileBytes[0]] ^= 0xff
+	cache := NewParallelLayerReadCache(bytes.NewReader(data), header, layer, NewLfuCacheManager(4), 2)
+
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var integrity pixi.IntegrityError
+			if _, err := cache.SampleAt(pixi.SampleCoordinate{1, 1}); !errors.As(err, &integrity) {
+				t.Errorf("expected an integrity error, got %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if sample, err := cache.SampleAt(pixi.SampleCoordinate{20, 1}); err != nil || sample[0] != uint16(21) {
+		t.Errorf("expected other tiles to be read, got %v %v", sample, err)
+	}
+}
@@ -0,0 +1,157 @@
+package read
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/owlpinetech/pixi"
+)
+
+// A tile cache budget shared by any number of LayerReadCaches, so that many layers, iterators, and
+// handlers in a process can cache tiles under a single memory limit instead of each maintaining its
+// own private, uncoordinated cache. When adding a tile would exceed the budget, the least recently
+// used tiles across every participating cache are evicted until it fits.
+type CachePool struct {
+	lock      sync.Mutex
+	maxBytes  int64
+	usedBytes int64
+	nextOwner int
+	lru       *list.List // of *poolEntry, most recently used at the front
+	entries   map[poolKey]*list.Element
+	budget    *pixi.MemoryBudget
+}
+
+// The name under which cache pools report their usage to a memory budget.
+const CachePoolConsumer = "cache pool"
+
+// A process-wide cache pool with a budget of 256 MiB, for callers that do not need to manage their own.
+var DefaultCachePool = NewCachePool(256 << 20)
+
+type poolKey struct {
+	owner int
+	tile  int
+}
+
+type poolEntry struct {
+	key   poolKey
+	size  int64
+	cache *sync.Map
+}
+
+// Creates a new cache pool that holds at most maxBytes of tile data across all of its caches.
+func NewCachePool(maxBytes int64) *CachePool {
+	return &CachePool{
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		entries:  make(map[poolKey]*list.Element),
+	}
+}
+
+// Creates a cache manager drawing from this pool's budget, for use with a single LayerReadCache.
+// Each call returns a manager with its own key space, so tile indices of different layers never collide.
+func (p *CachePool) Manager() CacheManager[int, []byte] {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.nextOwner += 1
+	return &poolManager{pool: p, owner: p.nextOwner}
+}
+
+// Drops every tile cached through the given manager (one returned by Manager), returning its bytes to the
+// pool, for when the cache using the manager is discarded and its tiles would otherwise linger until evicted.
+func (p *CachePool) Release(manager CacheManager[int, []byte]) {
+	m, ok := manager.(*poolManager)
+	if !ok || m.pool != p {
+		return
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for key, elem := range p.entries {
+		if key.owner == m.owner {
+			p.remove(elem)
+		}
+	}
+}
+
+// Makes the pool also stay within the given memory budget, shared with other consumers: when the budget
+// is exhausted, tiles are evicted from the pool as if it had reached its own limit. Tiles already held
+// are moved from any previous budget to the new one.
+func (p *CachePool) SetMemoryBudget(budget *pixi.MemoryBudget) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.budget.Release(CachePoolConsumer, p.usedBytes)
+	p.budget = budget
+	p.budget.Acquire(CachePoolConsumer, p.usedBytes)
+}
+
+// The number of bytes of tile data currently held by caches in the pool.
+func (p *CachePool) UsedBytes() int64 {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.usedBytes
+}
+
+// The maximum number of bytes of tile data the pool will hold.
+func (p *CachePool) MaxBytes() int64 {
+	return p.maxBytes
+}
+
+func (p *CachePool) access(key poolKey) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if elem, ok := p.entries[key]; ok {
+		p.lru.MoveToFront(elem)
+	}
+}
+
+func (p *CachePool) add(key poolKey, value []byte, cache *sync.Map) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if elem, ok := p.entries[key]; ok {
+		p.remove(elem)
+	}
+
+	size := int64(len(value))
+	for p.usedBytes+size > p.maxBytes && p.lru.Len() > 0 {
+		p.remove(p.lru.Back())
+	}
+	for !p.budget.TryAcquire(CachePoolConsumer, size) {
+		if p.lru.Len() == 0 {
+			// a tile larger than the whole budget is still cached so the caller can use it, but will be
+			// the first evicted when anything else is added
+			p.budget.Acquire(CachePoolConsumer, size)
+			break
+		}
+		p.remove(p.lru.Back())
+	}
+	p.usedBytes += size
+	p.entries[key] = p.lru.PushFront(&poolEntry{key: key, size: size, cache: cache})
+	cache.Store(key.tile, value)
+}
+
+func (p *CachePool) remove(elem *list.Element) {
+	entry := p.lru.Remove(elem).(*poolEntry)
+	delete(p.entries, entry.key)
+	entry.cache.Delete(entry.key.tile)
+	p.usedBytes -= entry.size
+	p.budget.Release(CachePoolConsumer, entry.size)
+}
+
+// A view of a cache pool for a single layer cache.
+type poolManager struct {
+	pool  *CachePool
+	owner int
+}
+
+// Pool managers are bounded by the byte budget of their pool rather than by a number of tiles,
+// so this always returns 0.
+func (m *poolManager) MaxInCache() int {
+	return 0
+}
+
+func (m *poolManager) Add(key int, value []byte, cache *sync.Map) {
+	m.pool.add(poolKey{owner: m.owner, tile: key}, value, cache)
+}
+
+func (m *poolManager) Access(key int) {
+	m.pool.access(poolKey{owner: m.owner, tile: key})
+}
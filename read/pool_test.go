@@ -0,0 +1,76 @@
+package read
+
+import (
+	"encoding/binary"
+	"math/rand/v2"
+	"sync"
+	"testing"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/internal/buffer"
+)
+
+func TestCachePoolSharedBudget(t *testing.T) {
+	header := pixi.PixiHeader{Version: pixi.Version, OffsetSize: 8, ByteOrder: binary.LittleEndian}
+
+	// two layers of 16 tiles each, 400 bytes per tile, in separate streams
+	caches := make([]*LayerReadCache, 2)
+	rawTiles := make([][][]byte, 2)
+	pool := NewCachePool(400 * 5)
+	for c := range caches {
+		layer := pixi.NewLayer("pooled", false, pixi.CompressionNone,
+			pixi.DimensionSet{{Name: "x", Size: 40, TileSize: 10}, {Name: "y", Size: 40, TileSize: 10}},
+			[]pixi.Field{{Name: "v", Type: pixi.FieldUint32}})
+		wrtBuf := buffer.NewBuffer(10)
+		for i := range layer.DiskTiles() {
+			chunk := make([]byte, layer.DiskTileSize(i))
+			for j := range chunk {
+				chunk[j] = byte(rand.IntN(256))
+			}
+			err := layer.WriteTile(wrtBuf, header, i, chunk)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rawTiles[c] = append(rawTiles[c], chunk)
+		}
+		caches[c] = NewLayerReadCache(buffer.NewBufferFrom(wrtBuf.Bytes()), header, layer, pool.Manager())
+	}
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 200 {
+				c := rand.IntN(len(caches))
+				coord := pixi.SampleCoordinate{rand.IntN(40), rand.IntN(40)}
+				selector := coord.ToTileSelector(caches[c].layer.Dimensions)
+				expect := caches[c].layer.Fields[0].BytesToValue(rawTiles[c][selector.Tile][selector.InTile*4:], header.ByteOrder)
+
+				got, err := caches[c].FieldAt(coord, 0)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if got != expect {
+					t.Errorf("expected %v at %v in cache %d, got %v", expect, coord, c, got)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if pool.UsedBytes() > pool.MaxBytes() {
+		t.Errorf("expected pool to stay within budget %d, used %d", pool.MaxBytes(), pool.UsedBytes())
+	}
+	cached := 0
+	for _, cache := range caches {
+		cache.cache.Range(func(key, value any) bool {
+			cached += len(value.([]byte))
+			return true
+		})
+	}
+	if int64(cached) != pool.UsedBytes() {
+		t.Errorf("expected pool accounting %d to match cached bytes %d", pool.UsedBytes(), cached)
+	}
+}
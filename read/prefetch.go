@@ -0,0 +1,105 @@
+package read
+
+import (
+	"sync"
+
+	"github.com/owlpinetech/pixi"
+)
+
+// How sure the prefetcher must be of a stride before reading ahead along it, and the most sure it gets.
+// Confidence rises by one with each step along the stride and falls by one with each step off it, so a
+// detected pattern survives a few stray requests, and a new stride is only adopted once confidence in the
+// old one has run out.
+const (
+	prefetchConfidence    = 2
+	prefetchMaxConfidence = 4
+)
+
+// Detects the pattern of tile requests made to a cache and decides which tiles to read ahead of them.
+// Requests are tracked by the position of their tile in the layer, so the disk tiles of every field of
+// a separated layer read at one position are read ahead together.
+type prefetcher struct {
+	lock       sync.Mutex
+	maxDepth   int
+	tiles      int    // the number of tiles in each field of the layer
+	last       int    // the position of the last tile requested, or -1
+	fields     []bool // the fields requested at the last position
+	stride     int    // the step between positions being tracked
+	confidence int
+	depth      int // the number of tiles currently read ahead
+}
+
+func newPrefetcher(layer *pixi.Layer, maxDepth int) *prefetcher {
+	fields := 1
+	if layer.Separated {
+		fields = len(layer.Fields)
+	}
+	return &prefetcher{maxDepth: maxDepth, tiles: layer.Dimensions.Tiles(), last: -1, fields: make([]bool, fields)}
+}
+
+// Records a request for a disk tile, returning the disk tiles to read ahead of it, if any.
+func (p *prefetcher) observe(tileIndex int) []int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	position, field := tileIndex%p.tiles, tileIndex/p.tiles
+	if position == p.last {
+		p.fields[field] = true
+		return nil
+	}
+
+	step := position - p.last
+	if p.last < 0 {
+		step = 0
+	}
+	p.last = position
+	requested := make([]bool, len(p.fields))
+	requested[field] = true
+	fields := p.fields
+	p.fields = requested
+	fields[field] = true
+
+	switch {
+	case step != 0 && step == p.stride:
+		p.confidence = min(p.confidence+1, prefetchMaxConfidence)
+		if p.confidence >= prefetchConfidence {
+			p.depth = min(max(p.depth*2, 1), p.maxDepth)
+		}
+	case p.confidence > 0:
+		p.confidence--
+		p.depth /= 2
+	default:
+		p.stride = step
+		p.depth = 0
+	}
+	if p.confidence < prefetchConfidence || p.depth == 0 {
+		return nil
+	}
+
+	ahead := []int{}
+	for k := 1; k <= p.depth; k++ {
+		next := position + k*p.stride
+		if next < 0 || next >= p.tiles {
+			break
+		}
+		for f, wanted := range fields {
+			if wanted {
+				ahead = append(ahead, next+f*p.tiles)
+			}
+		}
+	}
+	return ahead
+}
+
+// The access pattern currently detected.
+func (p *prefetcher) pattern() pixi.AccessPattern {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	switch {
+	case p.confidence < prefetchConfidence:
+		return pixi.AccessRandom
+	case p.stride == 1 || p.stride == -1:
+		return pixi.AccessSequential
+	default:
+		return pixi.AccessStrided
+	}
+}
@@ -0,0 +1,91 @@
+package read
+
+import (
+	"encoding/binary"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/internal/buffer"
+)
+
+func TestPrefetcherDetectsPatterns(t *testing.T) {
+	layer := pixi.NewLayer("scan", false, pixi.CompressionNone,
+		pixi.DimensionSet{{Name: "x", Size: 64, TileSize: 4}, {Name: "y", Size: 64, TileSize: 4}},
+		[]pixi.Field{{Name: "v", Type: pixi.FieldUint8}})
+
+	p := newPrefetcher(layer, 8)
+	var ahead []int
+	for _, tile := range []int{0, 1, 1, 2, 3} {
+		ahead = p.observe(tile)
+	}
+	if p.pattern() != pixi.AccessSequential || !slices.Equal(ahead, []int{4}) {
+		t.Errorf("expected sequential read ahead of a tile, got %v reading %v", p.pattern(), ahead)
+	}
+	for _, tile := range []int{4, 5, 6, 7} {
+		ahead = p.observe(tile)
+	}
+	if len(ahead) != 8 || ahead[0] != 8 {
+		t.Errorf("expected read ahead to grow to the maximum depth, got %v", ahead)
+	}
+
+	// a single stray request keeps the pattern, with less read ahead
+	ahead = p.observe(40)
+	if p.pattern() != pixi.AccessSequential || len(ahead) != 4 || ahead[0] != 41 {
+		t.Errorf("expected a stray request to halve the read ahead, got %v reading %v", p.pattern(), ahead)
+	}
+	for _, tile := range []int{3, 90, 17, 60} {
+		p.observe(tile)
+	}
+	if p.pattern() != pixi.AccessRandom {
+		t.Errorf("expected scattered requests to be detected as random, got %v", p.pattern())
+	}
+
+	// walking down a column of tiles
+	p = newPrefetcher(layer, 8)
+	for _, tile := range []int{2, 18, 34, 50, 66} {
+		ahead = p.observe(tile)
+	}
+	if p.pattern() != pixi.AccessStrided || !slices.Equal(ahead, []int{82, 98}) {
+		t.Errorf("expected strided read ahead down the column, got %v reading %v", p.pattern(), ahead)
+	}
+}
+
+func TestCachePrefetchesSequentialScan(t *testing.T) {
+	header := pixi.PixiHeader{Version: pixi.Version, OffsetSize: 4, ByteOrder: binary.BigEndian}
+	layer := pixi.NewLayer("scan", true, pixi.CompressionNone,
+		pixi.DimensionSet{{Name: "x", Size: 64, TileSize: 4}},
+		[]pixi.Field{{Name: "a", Type: pixi.FieldUint8}, {Name: "b", Type: pixi.FieldUint16}})
+	wrtBuf := buffer.NewBuffer(10)
+	for i := range layer.DiskTiles() {
+		if err := layer.WriteTile(wrtBuf, header, i, make([]byte, layer.DiskTileSize(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cache := NewLayerReadCache(buffer.NewBufferFrom(wrtBuf.Bytes()), header, layer, NewLfuCacheManager(16))
+	cache.SetPrefetch(4)
+	for x := range 16 {
+		if _, err := cache.SampleAt(pixi.SampleCoordinate{x}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if cache.AccessPattern() != pixi.AccessSequential {
+		t.Errorf("expected a sequential pattern, got %v", cache.AccessPattern())
+	}
+
+	// both fields of the tile after the last one requested are read ahead
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, first := cache.cache.Load(4)
+		_, second := cache.cache.Load(4 + layer.Dimensions.Tiles())
+		if first && second {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the next tile of each field to be read ahead")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,42 @@
+package read
+
+import (
+	"github.com/owlpinetech/pixi"
+)
+
+// The decoded bytes of a disk tile together with the layout of its samples, for consumers that run their
+// own loops over tile data rather than decoding a sample at a time. The data is shared with the cache or
+// iterator that returned it and must not be modified.
+type RawTile struct {
+	pixi.TileLayout
+	Data []byte
+}
+
+// Returns the decoded data and layout of the disk tile at the given index, loading it into the cache if it
+// is not already there, as Tile does. The data stays valid after the tile is evicted from the cache.
+func (c *LayerReadCache) RawTile(diskTile int) (RawTile, error) {
+	data, err := c.getTile(diskTile)
+	if err != nil {
+		return RawTile{}, err
+	}
+	return RawTile{TileLayout: c.layer.DiskTileLayout(diskTile, c.header.ByteOrder), Data: data}, nil
+}
+
+// Returns the decoded data and layout of the disk tiles of the tile holding the current sample: one for a
+// contiguous layer, or one for each field of a separated layer that is read (see SelectChannels). Only
+// meaningful after Next has returned true, and the data is only valid until the iterator moves on to
+// another tile, as the iterator reuses its buffers.
+func (it *TileOrderReadIterator) RawTiles() []RawTile {
+	if !it.valid {
+		return nil
+	}
+	tiles := make([]RawTile, 0, len(it.tileData))
+	for i, data := range it.tileData {
+		if it.skip != nil && it.skip[i] {
+			continue
+		}
+		diskTile := it.cur.Tile + it.layer.Dimensions.Tiles()*i
+		tiles = append(tiles, RawTile{TileLayout: it.layer.DiskTileLayout(diskTile, it.header.ByteOrder), Data: data})
+	}
+	return tiles
+}
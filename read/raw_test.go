@@ -0,0 +1,67 @@
+package read
+
+import (
+	"testing"
+
+	"github.com/owlpinetech/pixi"
+)
+
+// Decodes every sample of a raw tile within the layer through its layout, checking each against the
+// values written by writeIndexedIteratorLayer.
+func checkRawTile(t *testing.T, layer *pixi.Layer, tile RawTile) {
+	t.Helper()
+	for inTile := range layer.Dimensions.TileSamples() {
+		coord := pixi.TileSelector{Tile: tile.Tile, InTile: inTile}.ToTileCoordinate(layer.Dimensions).ToSampleCoordinate(layer.Dimensions)
+		if coord[0] >= tile.Origin[0]+tile.Extent[0] || coord[1] >= tile.Origin[1]+tile.Extent[1] {
+			continue
+		}
+		ind := int(coord.ToSampleIndex(layer.Dimensions))
+		for _, channel := range tile.Channels {
+			value := channel.Field.BytesToValue(tile.Data[tile.SampleOffset(coord)+channel.Offset:], tile.ByteOrder)
+			if expect := indexedValue(channel.Field, ind, channel.Index); value != expect {
+				t.Errorf("expected field %d of %v in disk tile %d to be %v, got %v", channel.Index, coord, tile.DiskTile, expect, value)
+			}
+		}
+	}
+}
+
+func TestCacheRawTile(t *testing.T) {
+	for _, separated := range []bool{false, true} {
+		buf, header, layer := writeIndexedIteratorLayer(t, separated)
+		cache := NewLayerReadCache(buf, header, layer, NewLfuCacheManager(4))
+		for diskTile := range layer.DiskTiles() {
+			tile, err := cache.RawTile(diskTile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(tile.Data) != layer.DiskTileSize(diskTile) {
+				t.Errorf("expected %d bytes for disk tile %d, got %d", layer.DiskTileSize(diskTile), diskTile, len(tile.Data))
+			}
+			checkRawTile(t, layer, tile)
+		}
+	}
+}
+
+func TestTileOrderReadIteratorRawTiles(t *testing.T) {
+	for _, separated := range []bool{false, true} {
+		buf, header, layer := writeIndexedIteratorLayer(t, separated)
+		it := NewTileOrderReadIterator(buf, header, layer)
+		if it.RawTiles() != nil {
+			t.Error("expected no raw tiles before the first sample")
+		}
+		it.SelectChannels([]int{1})
+		for it.Next() {
+			tiles := it.RawTiles()
+			if separated && (len(tiles) != 1 || tiles[0].Channels[0].Index != 1) {
+				t.Fatalf("expected only the disk tile of the selected field, got %d tiles", len(tiles))
+			} else if !separated && len(tiles) != 1 {
+				t.Fatalf("expected a single disk tile, got %d", len(tiles))
+			}
+			checkRawTile(t, layer, tiles[0])
+			it.SkipTile()
+		}
+		if it.Err() != nil {
+			t.Fatal(it.Err())
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package read
+
+import (
+	"io"
+	"iter"
+
+	"github.com/owlpinetech/pixi"
+)
+
+// Returns a sequence over the samples remaining in the iterator, from its current position, for use
+// with range loops. Breaking out of the loop leaves the iterator positioned after the last sample visited,
+// and if iteration stops early because a tile could not be read, the error is available from Err.
+func (it *TileOrderReadIterator) All() iter.Seq2[pixi.SampleCoordinate, []any] {
+	return func(yield func(pixi.SampleCoordinate, []any) bool) {
+		for it.Next() {
+			if !yield(it.Coordinate(), it.Sample()) {
+				return
+			}
+		}
+	}
+}
+
+// Returns a sequence of every sample in the layer in tile order, for use with range loops. Unlike
+// LayerContiguousTileOrder, separated layers are supported and samples in the padding of partial tiles
+// are not visited. Iteration stops early if a tile cannot be read; use NewTileOrderReadIterator with
+// All and Err when read errors must be detected.
+func Samples(r io.ReadSeeker, header pixi.PixiHeader, layer *pixi.Layer) iter.Seq2[pixi.SampleCoordinate, []any] {
+	return func(yield func(pixi.SampleCoordinate, []any) bool) {
+		hintTiles(r, header, layer, func(int) bool { return true })
+		it := NewTileOrderReadIterator(r, header, layer)
+		it.SkipPadding(true)
+		for it.Next() {
+			if !yield(it.Coordinate(), it.Sample()) {
+				return
+			}
+		}
+	}
+}
+
+// Returns a sequence of the samples of the layer with coordinates at least start and less than end in
+// every dimension, in tile order. Tiles that do not overlap the window are never read. As with Samples,
+// iteration stops early if a tile cannot be read.
+func WindowSamples(r io.ReadSeeker, header pixi.PixiHeader, layer *pixi.Layer, start pixi.SampleCoordinate, end pixi.SampleCoordinate) iter.Seq2[pixi.SampleCoordinate, []any] {
+	return func(yield func(pixi.SampleCoordinate, []any) bool) {
+		end = clampWindow(end, layerExtent(layer))
+		overlaps := func(tileIndex int) bool {
+			origin := pixi.TileSelector{Tile: tileIndex, InTile: 0}.
+				ToTileCoordinate(layer.Dimensions).
+				ToSampleCoordinate(layer.Dimensions)
+			return tileOverlaps(layer.Dimensions, origin, start, end)
+		}
+		hintTiles(r, header, layer, overlaps)
+		it := NewTileOrderReadIterator(r, header, layer)
+		for tileIndex := range layer.Dimensions.Tiles() {
+			if !overlaps(tileIndex) {
+				continue
+			}
+			origin := pixi.TileSelector{Tile: tileIndex, InTile: 0}.
+				ToTileCoordinate(layer.Dimensions).
+				ToSampleCoordinate(layer.Dimensions)
+			err := it.SeekTo(origin)
+			if err != nil {
+				return
+			}
+			for range layer.Dimensions.TileSamples() {
+				if !it.Next() {
+					return
+				}
+				coord := it.Coordinate()
+				if !inWindow(coord, start, end) {
+					continue
+				}
+				if !yield(coord, it.Sample()) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Tells the stream, if it takes hints (see pixi.RangeHinter), which disk tiles will be read for the tiles
+// of the layer the iteration visits.
+func hintTiles(r io.Reader, header pixi.PixiHeader, layer *pixi.Layer, visits func(tileIndex int) bool) {
+	if _, ok := r.(pixi.RangeHinter); !ok {
+		return
+	}
+	diskTiles := []int{}
+	for tileIndex := range layer.Dimensions.Tiles() {
+		if !visits(tileIndex) {
+			continue
+		}
+		for diskTile := tileIndex; diskTile < layer.DiskTiles(); diskTile += layer.Dimensions.Tiles() {
+			diskTiles = append(diskTiles, diskTile)
+		}
+	}
+	layer.HintTiles(r, header, diskTiles)
+}
+
+func layerExtent(layer *pixi.Layer) pixi.SampleCoordinate {
+	extent := make(pixi.SampleCoordinate, len(layer.Dimensions))
+	for i, dim := range layer.Dimensions {
+		extent[i] = dim.Size
+	}
+	return extent
+}
+
+func clampWindow(end pixi.SampleCoordinate, extent pixi.SampleCoordinate) pixi.SampleCoordinate {
+	clamped := make(pixi.SampleCoordinate, len(extent))
+	for i := range extent {
+		clamped[i] = min(end[i], extent[i])
+	}
+	return clamped
+}
+
+func inWindow(coord pixi.SampleCoordinate, start pixi.SampleCoordinate, end pixi.SampleCoordinate) bool {
+	for i, c := range coord {
+		if c < start[i] || c >= end[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func tileOverlaps(dims pixi.DimensionSet, origin pixi.SampleCoordinate, start pixi.SampleCoordinate, end pixi.SampleCoordinate) bool {
+	for i, dim := range dims {
+		if origin[i]+dim.TileSize <= start[i] || origin[i] >= end[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,55 @@
+package read
+
+import (
+	"testing"
+
+	"github.com/owlpinetech/pixi"
+)
+
+func TestSamplesVisitsEveryInBoundsSample(t *testing.T) {
+	for _, separated := range []bool{false, true} {
+		buf, header, layer := writeIndexedIteratorLayer(t, separated)
+		seen := make(map[pixi.SampleIndex]bool)
+		for coord, sample := range Samples(buf, header, layer) {
+			ind := coord.ToSampleIndex(layer.Dimensions)
+			if seen[ind] {
+				t.Fatalf("visited %v twice", coord)
+			}
+			seen[ind] = true
+			if sample[0] != uint16(ind) || sample[1] != int64(ind+1) {
+				t.Fatalf("expected sample (%d, %d) at %v, got %v", ind, ind+1, coord, sample)
+			}
+		}
+		if len(seen) != layer.Dimensions.Samples() {
+			t.Errorf("expected %d samples, visited %d", layer.Dimensions.Samples(), len(seen))
+		}
+	}
+}
+
+func TestWindowSamples(t *testing.T) {
+	buf, header, layer := writeIndexedIteratorLayer(t, false)
+	count := 0
+	for coord, sample := range WindowSamples(buf, header, layer, pixi.SampleCoordinate{3, 7}, pixi.SampleCoordinate{6, 20}) {
+		if coord[0] < 3 || coord[0] >= 6 || coord[1] < 7 || coord[1] >= 10 {
+			t.Fatalf("visited %v outside the window", coord)
+		}
+		if sample[0] != uint16(coord.ToSampleIndex(layer.Dimensions)) {
+			t.Fatalf("unexpected sample %v at %v", sample, coord)
+		}
+		count += 1
+	}
+	if count != 9 {
+		t.Errorf("expected 9 samples in the window, got %d", count)
+	}
+
+	count = 0
+	for range WindowSamples(buf, header, layer, pixi.SampleCoordinate{0, 0}, pixi.SampleCoordinate{10, 10}) {
+		count += 1
+		if count == 5 {
+			break
+		}
+	}
+	if count != 5 {
+		t.Errorf("expected early break to stop iteration, got %d samples", count)
+	}
+}
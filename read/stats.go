@@ -0,0 +1,112 @@
+package read
+
+import (
+	"github.com/owlpinetech/pixi"
+)
+
+// Statistics of the values of one field over a region of a layer, as computed by LayerReadCache.RegionStats.
+// NaN values are left out, as are samples in tiles that were never written.
+type RegionStats struct {
+	Min   any     // The smallest value in the region, nil if it holds no values.
+	Max   any     // The largest value in the region, nil if it holds no values.
+	Mean  float64 // The mean of the values in the region, if requested.
+	Count int     // The number of values in the mean, if requested.
+	// The number of tiles read and decoded to compute the statistics, and the number of tiles overlapping the
+	// region that did not need to be, because their recorded tile ranges settled the minimum and maximum.
+	TilesRead    int
+	TilesSkipped int
+}
+
+// Computes the minimum, maximum, and if mean is true the mean of a field over the region from start
+// (inclusive) to end (exclusive). If the layer records tile ranges (see pixi.Layer.RecordTileRanges), the
+// minimum and maximum of tiles lying wholly within the region are taken from their ranges, and tiles on the
+// edge of the region are only read if their range extends beyond what has been found already, so that
+// queries over large regions read little more than the tiles along their edges. The results are exact
+// either way, but the mean needs every value, so every tile overlapping the region is read to compute it.
+func (c *LayerReadCache) RegionStats(fieldIndex int, start pixi.SampleCoordinate, end pixi.SampleCoordinate, mean bool) (RegionStats, error) {
+	dims := c.layer.Dimensions
+	if len(start) != len(dims) || len(end) != len(dims) {
+		return RegionStats{}, pixi.FormatError("region does not match the number of layer dimensions")
+	}
+	for i, dim := range dims {
+		if start[i] < 0 || end[i] > dim.Size || start[i] >= end[i] {
+			return RegionStats{}, pixi.FormatError("region is empty or outside the layer")
+		}
+	}
+	if fieldIndex < 0 || fieldIndex >= len(c.layer.Fields) {
+		return RegionStats{}, pixi.FormatError("field index is outside the fields of the layer")
+	}
+
+	field := c.layer.Fields[fieldIndex]
+	ranges := c.layer.TileRanges
+	knownRange := func(tile int) bool {
+		return ranges != nil && ranges[tile].Min[fieldIndex] != nil
+	}
+
+	stats := RegionStats{}
+	minMax := pixi.NewMinMax(field.Type, pixi.NaNIgnore)
+	edges := []int{}
+	for tile := range dims.Tiles() {
+		origin := pixi.TileSelector{Tile: tile, InTile: 0}.ToTileCoordinate(dims).ToSampleCoordinate(dims)
+		if !tileOverlaps(dims, origin, start, end) {
+			continue
+		}
+		diskTile, _ := c.fieldLocation(pixi.TileSelector{Tile: tile}, fieldIndex)
+		if c.layer.TileBytes[diskTile] == 0 {
+			continue
+		}
+		if !mean && knownRange(tile) && tileWithin(dims, origin, start, end) {
+			minMax.Update(ranges[tile].Min[fieldIndex])
+			minMax.Update(ranges[tile].Max[fieldIndex])
+			stats.TilesSkipped++
+			continue
+		}
+		edges = append(edges, tile)
+	}
+
+	sum := 0.0
+	for _, tile := range edges {
+		if !mean && knownRange(tile) && minMax.Min != nil &&
+			field.Type.CompareValues(ranges[tile].Min[fieldIndex], minMax.Min) >= 0 &&
+			field.Type.CompareValues(ranges[tile].Max[fieldIndex], minMax.Max) <= 0 {
+			stats.TilesSkipped++
+			continue
+		}
+		diskTile, _ := c.fieldLocation(pixi.TileSelector{Tile: tile}, fieldIndex)
+		data, err := c.getTile(diskTile)
+		if err != nil {
+			return RegionStats{}, err
+		}
+		stats.TilesRead++
+		for inTile := range dims.TileSamples() {
+			selector := pixi.TileSelector{Tile: tile, InTile: inTile}
+			if !inWindow(selector.ToTileCoordinate(dims).ToSampleCoordinate(dims), start, end) {
+				continue
+			}
+			_, offset := c.fieldLocation(selector, fieldIndex)
+			value := field.BytesToValue(data[offset:], c.header.ByteOrder)
+			minMax.Update(value)
+			if mean && !field.Type.IsNaN(value) {
+				sum += field.Type.ValueToFloat64(value)
+				stats.Count++
+			}
+		}
+	}
+
+	stats.Min, stats.Max = minMax.Min, minMax.Max
+	if stats.Count > 0 {
+		stats.Mean = sum / float64(stats.Count)
+	}
+	return stats, nil
+}
+
+// Reports whether every sample of the tile with the given origin, leaving out the padding of partial tiles,
+// lies within the region from start to end.
+func tileWithin(dims pixi.DimensionSet, origin pixi.SampleCoordinate, start pixi.SampleCoordinate, end pixi.SampleCoordinate) bool {
+	for i, dim := range dims {
+		if origin[i] < start[i] || min(origin[i]+dim.TileSize, dim.Size) > end[i] {
+			return false
+		}
+	}
+	return true
+}
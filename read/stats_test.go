@@ -0,0 +1,84 @@
+package read
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/internal/buffer"
+)
+
+func TestRegionStatsPrunesTiles(t *testing.T) {
+	header := pixi.PixiHeader{Version: pixi.Version, OffsetSize: 4, ByteOrder: binary.LittleEndian, Checksum: pixi.ChecksumCrc32}
+	layer := pixi.NewLayer("elevation", false, pixi.CompressionNone,
+		pixi.DimensionSet{{Name: "x", Size: 16, TileSize: 4}, {Name: "y", Size: 16, TileSize: 4}},
+		[]pixi.Field{{Name: "height", Type: pixi.FieldFloat32}})
+	layer.RecordTileRanges()
+
+	// the extremes of the region lie in tiles wholly inside it, so no tile on its edge can change them
+	height := func(coord pixi.SampleCoordinate) float32 {
+		switch {
+		case coord[0] == 6 && coord[1] == 6:
+			return 100
+		case coord[0] == 9 && coord[1] == 9:
+			return -100
+		default:
+			return float32((coord[0]*7 + coord[1]*13) % 50)
+		}
+	}
+	buf := buffer.NewBuffer(10)
+	for tile := range layer.Dimensions.Tiles() {
+		data := make([]byte, layer.DiskTileSize(tile))
+		for inTile := range layer.Dimensions.TileSamples() {
+			coord := pixi.TileSelector{Tile: tile, InTile: inTile}.ToTileCoordinate(layer.Dimensions).ToSampleCoordinate(layer.Dimensions)
+			binary.LittleEndian.PutUint32(data[inTile*4:], math.Float32bits(height(coord)))
+		}
+		if err := layer.WriteTile(buf, header, tile, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	start, end := pixi.SampleCoordinate{1, 1}, pixi.SampleCoordinate{15, 15}
+	sum, count := 0.0, 0
+	for y := start[1]; y < end[1]; y++ {
+		for x := start[0]; x < end[0]; x++ {
+			sum += float64(height(pixi.SampleCoordinate{x, y}))
+			count++
+		}
+	}
+
+	cache := NewLayerReadCache(buffer.NewBufferFrom(buf.Bytes()), header, layer, NewLfuCacheManager(16))
+	stats, err := cache.RegionStats(0, start, end, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Min != float32(-100) || stats.Max != float32(100) {
+		t.Errorf("expected heights from -100 to 100, got %v to %v", stats.Min, stats.Max)
+	}
+	if stats.TilesRead != 0 || stats.TilesSkipped != 16 {
+		t.Errorf("expected every tile to be pruned, read %d and skipped %d", stats.TilesRead, stats.TilesSkipped)
+	}
+
+	stats, err = cache.RegionStats(0, start, end, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.TilesRead != 16 || stats.Count != count || math.Abs(stats.Mean-sum/float64(count)) > 1e-9 {
+		t.Errorf("expected mean %v of %d values from 16 tiles, got %v of %d from %d", sum/float64(count), count, stats.Mean, stats.Count, stats.TilesRead)
+	}
+
+	// without ranges every overlapping tile is read, with the same result
+	layer.TileRanges = nil
+	stats, err = cache.RegionStats(0, pixi.SampleCoordinate{0, 0}, pixi.SampleCoordinate{8, 8}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Min != float32(0) || stats.Max != float32(100) || stats.TilesRead != 4 {
+		t.Errorf("expected heights from 0 to 100 read from 4 tiles, got %v to %v from %d", stats.Min, stats.Max, stats.TilesRead)
+	}
+
+	if _, err := cache.RegionStats(0, pixi.SampleCoordinate{4, 4}, pixi.SampleCoordinate{4, 8}, false); err == nil {
+		t.Error("expected an error for an empty region")
+	}
+}
@@ -0,0 +1,193 @@
+package read
+
+import (
+	"io"
+
+	"github.com/owlpinetech/pixi"
+)
+
+// A stateful iterator over every sample of a layer in tile order, which (unlike the sequence returned
+// by LayerContiguousTileOrder) can be repositioned with SeekTo and SkipTile. Tiles are only read from
+// the backing stream once a sample in them is actually visited, so skipped regions cost nothing. Both
+// contiguous and separated layers are supported. As with the other tile order iterators, samples in
+// the padding of partial tiles at the edges of the layer are visited too, unless SkipPadding is set.
+type TileOrderReadIterator struct {
+	backing  io.ReadSeeker
+	header   pixi.PixiHeader
+	layer    *pixi.Layer
+	next     pixi.TileSelector
+	cur      pixi.TileSelector
+	valid    bool
+	loaded   int
+	tileData [][]byte // one decoded disk tile per field for separated layers, otherwise just one
+	skip     []bool   // for separated layers, the fields whose disk tiles are not read
+	padding  bool     // whether samples beyond the bounds of the layer are passed over
+	err      error
+}
+
+// Creates an iterator positioned before the first sample of the layer.
+func NewTileOrderReadIterator(r io.ReadSeeker, header pixi.PixiHeader, layer *pixi.Layer) *TileOrderReadIterator {
+	diskTilesPerTile := 1
+	if layer.Separated {
+		diskTilesPerTile = len(layer.Fields)
+	}
+	return &TileOrderReadIterator{
+		backing:  r,
+		header:   header,
+		layer:    layer,
+		loaded:   -1,
+		tileData: make([][]byte, diskTilesPerTile),
+	}
+}
+
+// Advances the iterator to the next sample, loading its tile if needed. Returns false once every
+// sample has been visited or if reading a tile failed, in which case Err reports the failure.
+func (it *TileOrderReadIterator) Next() bool {
+	if it.padding {
+		for it.next.Tile < it.layer.Dimensions.Tiles() && !it.next.InBounds(it.layer.Dimensions) {
+			it.advance()
+		}
+	}
+	if it.err != nil || it.next.Tile >= it.layer.Dimensions.Tiles() {
+		it.valid = false
+		return false
+	}
+	if it.loaded != it.next.Tile {
+		err := it.loadTile(it.next.Tile)
+		if err != nil {
+			it.err = err
+			it.valid = false
+			return false
+		}
+	}
+	it.cur = it.next
+	it.valid = true
+	it.advance()
+	return true
+}
+
+// Sets whether the samples in the padding of partial tiles at the edges of the layer, which lie beyond
+// the size of some dimension and hold no data, are passed over by Next rather than visited. Consumers that
+// only want the samples of the layer set this instead of checking every coordinate against the dimensions.
+func (it *TileOrderReadIterator) SkipPadding(skip bool) {
+	it.padding = skip
+}
+
+// Moves the position of the following sample on by one, into the next tile once the current one is done.
+func (it *TileOrderReadIterator) advance() {
+	it.next.InTile += 1
+	if it.next.InTile >= it.layer.Dimensions.TileSamples() {
+		it.next = pixi.TileSelector{Tile: it.next.Tile + 1, InTile: 0}
+	}
+}
+
+// Restricts the fields read by the iterator to the given channels (field indices), so that the disk
+// tiles of other fields of a separated layer are never read or decoded. Only the selected fields may be
+// passed to Field afterward, and Sample leaves the others nil. Contiguous layers store every field in the
+// same tile, so selecting channels saves no reading for them. Takes effect from the next tile loaded.
+func (it *TileOrderReadIterator) SelectChannels(channels []int) {
+	if !it.layer.Separated {
+		return
+	}
+	it.skip = make([]bool, len(it.layer.Fields))
+	for i := range it.skip {
+		it.skip[i] = true
+	}
+	for _, channel := range channels {
+		it.skip[channel] = false
+	}
+	it.loaded = -1
+}
+
+// Positions the iterator so that the following call to Next visits the sample at the given coordinate.
+// Seeking does not read any tile data. Returns an error if the coordinate is outside the layer.
+func (it *TileOrderReadIterator) SeekTo(coord pixi.SampleCoordinate) error {
+	selector, err := seekSelector(it.layer, coord)
+	if err != nil {
+		return err
+	}
+	it.next = selector
+	it.valid = false
+	return nil
+}
+
+// Skips the remaining samples in the tile of the current sample, so that the following call to Next
+// visits the first sample of the next tile without the rest of the current tile being visited. If Next
+// has not been called since the iterator was created or repositioned with SeekTo, the whole tile that
+// would have been visited next is skipped instead.
+func (it *TileOrderReadIterator) SkipTile() {
+	if it.valid {
+		it.next = pixi.TileSelector{Tile: it.cur.Tile + 1, InTile: 0}
+	} else {
+		it.next = pixi.TileSelector{Tile: it.next.Tile + 1, InTile: 0}
+	}
+	it.valid = false
+}
+
+// The coordinate of the current sample. Only meaningful after Next has returned true.
+func (it *TileOrderReadIterator) Coordinate() pixi.SampleCoordinate {
+	return it.cur.ToTileCoordinate(it.layer.Dimensions).ToSampleCoordinate(it.layer.Dimensions)
+}
+
+// The values of every field of the current sample, or of the selected fields (see SelectChannels).
+func (it *TileOrderReadIterator) Sample() []any {
+	sample := make([]any, len(it.layer.Fields))
+	for fieldIndex := range it.layer.Fields {
+		if it.skip == nil || !it.skip[fieldIndex] {
+			sample[fieldIndex] = it.Field(fieldIndex)
+		}
+	}
+	return sample
+}
+
+// The value of a single field of the current sample.
+func (it *TileOrderReadIterator) Field(fieldIndex int) any {
+	field := it.layer.Fields[fieldIndex]
+	if it.layer.Separated {
+		return field.BytesToValue(it.tileData[fieldIndex][it.cur.InTile*field.Size():], it.header.ByteOrder)
+	}
+	offset := it.cur.InTile * it.layer.SampleSize()
+	for _, f := range it.layer.Fields[:fieldIndex] {
+		offset += f.Size()
+	}
+	return field.BytesToValue(it.tileData[0][offset:], it.header.ByteOrder)
+}
+
+// The error that stopped iteration, if any.
+func (it *TileOrderReadIterator) Err() error {
+	return it.err
+}
+
+func (it *TileOrderReadIterator) loadTile(tileIndex int) error {
+	for i := range it.tileData {
+		if it.skip != nil && it.skip[i] {
+			continue
+		}
+		diskTile := tileIndex + it.layer.Dimensions.Tiles()*i
+		size := it.layer.DiskTileSize(diskTile)
+		if cap(it.tileData[i]) < size {
+			it.tileData[i] = make([]byte, size)
+		}
+		it.tileData[i] = it.tileData[i][:size]
+		err := it.layer.ReadTile(it.backing, it.header, diskTile, it.tileData[i])
+		if err != nil {
+			it.loaded = -1
+			return err
+		}
+	}
+	it.loaded = tileIndex
+	return nil
+}
+
+// Converts a sample coordinate into a tile selector, checking that it lies within the layer.
+func seekSelector(layer *pixi.Layer, coord pixi.SampleCoordinate) (pixi.TileSelector, error) {
+	if len(coord) != len(layer.Dimensions) {
+		return pixi.TileSelector{}, pixi.FormatError("seek coordinate does not match the number of layer dimensions")
+	}
+	for i, c := range coord {
+		if c < 0 || c >= layer.Dimensions[i].Size {
+			return pixi.TileSelector{}, pixi.FormatError("seek coordinate is outside the layer")
+		}
+	}
+	return coord.ToTileSelector(layer.Dimensions), nil
+}
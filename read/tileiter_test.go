@@ -0,0 +1,132 @@
+package read
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/internal/buffer"
+)
+
+// Writes a layer of 10x10 samples in 4x4 tiles where each field of each sample holds the sample index
+// plus the field index.
+func writeIndexedIteratorLayer(t *testing.T, separated bool) (*buffer.Buffer, pixi.PixiHeader, *pixi.Layer) {
+	t.Helper()
+	header := pixi.PixiHeader{Version: pixi.Version, OffsetSize: 4, ByteOrder: binary.BigEndian}
+	layer := pixi.NewLayer("iter", separated, pixi.CompressionFlate,
+		pixi.DimensionSet{{Name: "x", Size: 10, TileSize: 4}, {Name: "y", Size: 10, TileSize: 4}},
+		[]pixi.Field{{Name: "a", Type: pixi.FieldUint16}, {Name: "b", Type: pixi.FieldInt64}})
+	buf := buffer.NewBuffer(10)
+	for tileIndex := range layer.DiskTiles() {
+		data := make([]byte, layer.DiskTileSize(tileIndex))
+		for inTile := range layer.Dimensions.TileSamples() {
+			selector := pixi.TileSelector{Tile: tileIndex % layer.Dimensions.Tiles(), InTile: inTile}
+			ind := int(selector.ToTileCoordinate(layer.Dimensions).ToSampleCoordinate(layer.Dimensions).ToSampleIndex(layer.Dimensions))
+			if separated {
+				fieldIndex := tileIndex / layer.Dimensions.Tiles()
+				field := layer.Fields[fieldIndex]
+				field.ValueToBytes(indexedValue(field, ind, fieldIndex), data[inTile*field.Size():], header.ByteOrder)
+			} else {
+				layer.Fields[0].ValueToBytes(indexedValue(layer.Fields[0], ind, 0), data[inTile*layer.SampleSize():], header.ByteOrder)
+				layer.Fields[1].ValueToBytes(indexedValue(layer.Fields[1], ind, 1), data[inTile*layer.SampleSize()+2:], header.ByteOrder)
+			}
+		}
+		err := layer.WriteTile(buf, header, tileIndex, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buffer.NewBufferFrom(buf.Bytes()), header, layer
+}
+
+func indexedValue(field pixi.Field, ind int, fieldIndex int) any {
+	if field.Type == pixi.FieldUint16 {
+		return uint16(ind + fieldIndex)
+	}
+	return int64(ind + fieldIndex)
+}
+
+func TestTileOrderReadIteratorSeekAndSkip(t *testing.T) {
+	for _, separated := range []bool{false, true} {
+		buf, header, layer := writeIndexedIteratorLayer(t, separated)
+		it := NewTileOrderReadIterator(buf, header, layer)
+
+		visited := 0
+		for it.Next() {
+			visited += 1
+		}
+		if it.Err() != nil {
+			t.Fatal(it.Err())
+		}
+		if visited != layer.Dimensions.Tiles()*layer.Dimensions.TileSamples() {
+			t.Errorf("expected to visit every sample including padding, visited %d", visited)
+		}
+
+		err := it.SeekTo(pixi.SampleCoordinate{5, 6})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !it.Next() {
+			t.Fatal("expected a sample after seeking")
+		}
+		coord := it.Coordinate()
+		if coord[0] != 5 || coord[1] != 6 {
+			t.Fatalf("expected to land on (5, 6), got %v", coord)
+		}
+		ind := int(coord.ToSampleIndex(layer.Dimensions))
+		if it.Field(0) != uint16(ind) || it.Field(1) != int64(ind+1) {
+			t.Errorf("expected sample (%d, %d), got %v", ind, ind+1, it.Sample())
+		}
+
+		it.SkipTile()
+		if !it.Next() {
+			t.Fatal("expected a sample after skipping a tile")
+		}
+		tileCoord := it.Coordinate().ToTileCoordinate(layer.Dimensions)
+		if tileCoord.Tile[0] != 2 || tileCoord.Tile[1] != 1 || it.Coordinate()[0] != 8 || it.Coordinate()[1] != 4 {
+			t.Errorf("expected first sample of the next tile, got %v", it.Coordinate())
+		}
+
+		if err := it.SeekTo(pixi.SampleCoordinate{10, 0}); err == nil {
+			t.Error("expected seeking outside the layer to fail")
+		}
+	}
+}
+
+func TestTileOrderReadIteratorSkipPadding(t *testing.T) {
+	for _, separated := range []bool{false, true} {
+		buf, header, layer := writeIndexedIteratorLayer(t, separated)
+		it := NewTileOrderReadIterator(buf, header, layer)
+		it.SkipPadding(true)
+
+		visited := 0
+		for it.Next() {
+			visited += 1
+			coord := it.Coordinate()
+			if coord[0] >= 10 || coord[1] >= 10 {
+				t.Fatalf("expected padding to be skipped, visited %v", coord)
+			}
+			if ind := int(coord.ToSampleIndex(layer.Dimensions)); it.Field(0) != uint16(ind) {
+				t.Fatalf("expected sample %d at %v, got %v", ind, coord, it.Field(0))
+			}
+		}
+		if it.Err() != nil {
+			t.Fatal(it.Err())
+		}
+		if visited != layer.Dimensions.Samples() {
+			t.Errorf("expected to visit only the %d samples of the layer, visited %d", layer.Dimensions.Samples(), visited)
+		}
+
+		// the rest of a partial tile after skipping its last in-bounds sample is passed over
+		err := it.SeekTo(pixi.SampleCoordinate{9, 3})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !it.Next() || !it.Next() {
+			t.Fatal("expected samples after seeking")
+		}
+		if coord := it.Coordinate(); coord[0] != 0 || coord[1] != 4 {
+			t.Errorf("expected the first sample of the next tile, got %v", coord)
+		}
+	}
+}
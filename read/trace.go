@@ -0,0 +1,181 @@
+package read
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/owlpinetech/pixi"
+)
+
+// A record of one tile requested from a LayerReadCache, whether it was already cached or had to be read.
+type TileRead struct {
+	Time    time.Time     `json:"time"`
+	Layer   string        `json:"layer"`
+	Tile    int           `json:"tile"`    // The index of the disk tile.
+	Bytes   int           `json:"bytes"`   // The decoded size of the tile, or of the span read with partial reads.
+	Latency time.Duration `json:"latency"` // How long the request took, including reading and decoding on a miss.
+	Hit     bool          `json:"hit"`     // Whether the tile was already in the cache.
+}
+
+// Receives a record of every tile requested from a cache it is set on. Called from the goroutine making
+// the request, so it must be safe for concurrent use if the cache is used concurrently.
+type Tracer func(read TileRead)
+
+// Returns a tracer writing every read to w as a line of JSON, which ReadTrace reads back. Safe for
+// concurrent use; write errors are dropped, so tracing never interrupts reading.
+func NewTraceWriter(w io.Writer) Tracer {
+	var lock sync.Mutex
+	enc := json.NewEncoder(w)
+	return func(read TileRead) {
+		lock.Lock()
+		defer lock.Unlock()
+		enc.Encode(read)
+	}
+}
+
+// Reads a trace written by a tracer from NewTraceWriter.
+func ReadTrace(r io.Reader) ([]TileRead, error) {
+	reads := []TileRead{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var read TileRead
+		err := json.Unmarshal(scanner.Bytes(), &read)
+		if err != nil {
+			return nil, fmt.Errorf("trace line %d: %w", len(reads)+1, err)
+		}
+		reads = append(reads, read)
+	}
+	return reads, scanner.Err()
+}
+
+// A summary of how the tiles of a layer were read in a trace, with suggestions for reading them faster.
+type TraceAnalysis struct {
+	Reads           int           // The number of tile requests for the layer.
+	Hits            int           // The number of requests served from the cache.
+	DistinctTiles   int           // The number of different tiles requested.
+	MeanMissLatency time.Duration // The average time taken by requests that missed the cache.
+	// The smallest cache, in tiles and in bytes of decoded tiles, that would have served at least 90% of
+	// the requests that any cache could have (every request but the first for each tile), had it evicted
+	// the least recently used tile.
+	SuggestedCacheTiles int
+	SuggestedCacheBytes int64
+	// The tile size of each dimension suggested by the access pattern: doubled along dimensions that most
+	// consecutive requests stepped along to the adjacent tile, as in a scan, so that fewer, larger reads
+	// are needed, and otherwise unchanged.
+	SuggestedTileSizes []int
+	Notes              []string // Explanations of the suggestions.
+}
+
+// The fraction of requests served from the cache.
+func (a TraceAnalysis) HitRate() float64 {
+	if a.Reads == 0 {
+		return 0
+	}
+	return float64(a.Hits) / float64(a.Reads)
+}
+
+// Analyzes the requests for tiles of the layer in a trace, ignoring those for other layers.
+func AnalyzeTrace(reads []TileRead, layer *pixi.Layer) TraceAnalysis {
+	analysis := TraceAnalysis{SuggestedTileSizes: make([]int, len(layer.Dimensions))}
+	for i, dim := range layer.Dimensions {
+		analysis.SuggestedTileSizes[i] = dim.TileSize
+	}
+
+	// the most recently used tiles first, to find how many others were used since each tile's last use
+	recent := []int{}
+	reuseDistances := []int{}
+	tileBytes := 0
+	missLatency := time.Duration(0)
+	steps := make([]int, len(layer.Dimensions))
+	transitions := 0
+	lastTile := -1
+	for _, read := range reads {
+		if read.Layer != layer.Name {
+			continue
+		}
+		analysis.Reads++
+		tileBytes = max(tileBytes, read.Bytes)
+		if read.Hit {
+			analysis.Hits++
+		} else {
+			missLatency += read.Latency
+		}
+
+		if at := slices.Index(recent, read.Tile); at >= 0 {
+			reuseDistances = append(reuseDistances, at)
+			recent = slices.Delete(recent, at, at+1)
+		}
+		recent = slices.Insert(recent, 0, read.Tile)
+
+		if lastTile >= 0 && read.Tile != lastTile {
+			transitions++
+			if dim, ok := adjacentStep(layer.Dimensions, lastTile, read.Tile); ok {
+				steps[dim]++
+			}
+		}
+		lastTile = read.Tile
+	}
+	analysis.DistinctTiles = len(recent)
+	if misses := analysis.Reads - analysis.Hits; misses > 0 {
+		analysis.MeanMissLatency = missLatency / time.Duration(misses)
+	}
+	if analysis.Reads == 0 {
+		analysis.Notes = append(analysis.Notes, "no tiles of the layer were read")
+		return analysis
+	}
+
+	// a cache of n tiles serves every reuse with fewer than n other tiles used since
+	slices.Sort(reuseDistances)
+	if len(reuseDistances) == 0 {
+		analysis.SuggestedCacheTiles = 1
+		analysis.Notes = append(analysis.Notes, "no tile was read more than once, so a larger cache would not help")
+	} else {
+		needed := (len(reuseDistances)*9 + 9) / 10
+		analysis.SuggestedCacheTiles = reuseDistances[needed-1] + 1
+		analysis.Notes = append(analysis.Notes, fmt.Sprintf("a cache of %d tiles would serve %d of the %d repeated reads",
+			analysis.SuggestedCacheTiles, needed, len(reuseDistances)))
+	}
+	analysis.SuggestedCacheBytes = int64(analysis.SuggestedCacheTiles) * int64(tileBytes)
+
+	for i, dim := range layer.Dimensions {
+		if transitions > 0 && steps[i]*2 > transitions && dim.TileSize < dim.Size {
+			analysis.SuggestedTileSizes[i] = min(dim.TileSize*2, dim.Size)
+			analysis.Notes = append(analysis.Notes, fmt.Sprintf("%d of %d reads moved to the next tile along %s, so larger tiles along it need fewer reads",
+				steps[i], transitions, dim.Name))
+		}
+	}
+	return analysis
+}
+
+// Reports whether two disk tiles of a layer are neighbors along a single dimension, and which.
+func adjacentStep(dims pixi.DimensionSet, from int, to int) (int, bool) {
+	tiles := dims.Tiles()
+	if from/tiles != to/tiles {
+		// tiles of different fields of a separated layer
+		return 0, false
+	}
+	a := pixi.TileSelector{Tile: from % tiles}.ToTileCoordinate(dims).Tile
+	b := pixi.TileSelector{Tile: to % tiles}.ToTileCoordinate(dims).Tile
+	dim, found := -1, false
+	for i := range a {
+		switch b[i] - a[i] {
+		case 0:
+		case 1, -1:
+			if found {
+				return 0, false
+			}
+			dim, found = i, true
+		default:
+			return 0, false
+		}
+	}
+	return dim, found
+}
@@ -0,0 +1,81 @@
+package read
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/internal/buffer"
+)
+
+func TestTracerRecordsHitsAndMisses(t *testing.T) {
+	header := pixi.PixiHeader{Version: pixi.Version, OffsetSize: 4, ByteOrder: binary.BigEndian}
+	layer := pixi.NewLayer("traced", false, pixi.CompressionNone,
+		pixi.DimensionSet{{Name: "x", Size: 8, TileSize: 4}, {Name: "y", Size: 8, TileSize: 4}},
+		[]pixi.Field{{Name: "v", Type: pixi.FieldUint16}})
+	wrtBuf := buffer.NewBuffer(10)
+	for i := range layer.Dimensions.Tiles() {
+		if err := layer.WriteTile(wrtBuf, header, i, make([]byte, layer.DiskTileSize(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cache := NewLayerReadCache(buffer.NewBufferFrom(wrtBuf.Bytes()), header, layer, NewLfuCacheManager(4))
+	trace := &bytes.Buffer{}
+	cache.SetTracer(NewTraceWriter(trace))
+	for _, coord := range []pixi.SampleCoordinate{{0, 0}, {1, 0}, {4, 0}, {0, 1}} {
+		if _, err := cache.SampleAt(coord); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cache.SetTracer(nil)
+	if _, err := cache.SampleAt(pixi.SampleCoordinate{0, 4}); err != nil {
+		t.Fatal(err)
+	}
+
+	reads, err := ReadTrace(trace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectTiles := []int{0, 0, 1, 0}
+	expectHits := []bool{false, true, false, true}
+	if len(reads) != len(expectTiles) {
+		t.Fatalf("expected %d traced reads, got %+v", len(expectTiles), reads)
+	}
+	for i, read := range reads {
+		if read.Layer != "traced" || read.Tile != expectTiles[i] || read.Hit != expectHits[i] || read.Bytes != layer.DiskTileSize(read.Tile) {
+			t.Errorf("unexpected read %d: %+v", i, read)
+		}
+	}
+}
+
+func TestAnalyzeTrace(t *testing.T) {
+	layer := pixi.NewLayer("scan", false, pixi.CompressionNone,
+		pixi.DimensionSet{{Name: "x", Size: 16, TileSize: 4}, {Name: "y", Size: 16, TileSize: 4}},
+		[]pixi.Field{{Name: "v", Type: pixi.FieldUint8}})
+
+	// two row-major scans over every tile, with a cache too small to keep any of them between scans
+	reads := []TileRead{{Layer: "other", Tile: 3}}
+	for range 2 {
+		for tile := range layer.Dimensions.Tiles() {
+			reads = append(reads, TileRead{Layer: "scan", Tile: tile, Bytes: 16})
+		}
+	}
+	analysis := AnalyzeTrace(reads, layer)
+	if analysis.Reads != 32 || analysis.Hits != 0 || analysis.DistinctTiles != 16 || analysis.HitRate() != 0 {
+		t.Errorf("unexpected counts %+v", analysis)
+	}
+	if analysis.SuggestedCacheTiles != 16 || analysis.SuggestedCacheBytes != 256 {
+		t.Errorf("expected a cache holding every tile, got %d tiles, %d bytes", analysis.SuggestedCacheTiles, analysis.SuggestedCacheBytes)
+	}
+	if analysis.SuggestedTileSizes[0] != 8 || analysis.SuggestedTileSizes[1] != 4 {
+		t.Errorf("expected wider tiles along x for a row-major scan, got %v", analysis.SuggestedTileSizes)
+	}
+
+	// repeatedly reading the same tile needs only a single tile cache, and no larger tiles
+	single := AnalyzeTrace([]TileRead{{Layer: "scan", Tile: 5}, {Layer: "scan", Tile: 5, Hit: true}}, layer)
+	if single.SuggestedCacheTiles != 1 || single.SuggestedTileSizes[0] != 4 || single.SuggestedTileSizes[1] != 4 {
+		t.Errorf("unexpected suggestions for a single tile %+v", single)
+	}
+}
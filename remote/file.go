@@ -0,0 +1,359 @@
+package remote
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/owlpinetech/pixi"
+)
+
+// The number of bytes fetched by each range request when reading a remote file, unless a single read
+// asks for more. Reading file structure involves many small reads, which are served from the last block.
+const DefaultBlockSize = 64 << 10
+
+// The most bytes a single range request fetches when joining adjacent hinted ranges, unless changed with
+// the MaxCoalesce field of a file.
+const DefaultMaxCoalesce = 8 << 20
+
+// Separates the URLs of the mirrors of a file in a single name, as in
+// "https://a.example/dem.pixi|https://b.example/dem.pixi". A bar cannot appear unescaped in a URL.
+const MirrorSeparator = "|"
+
+// A Pixi file on a server, read with HTTP range requests. Reads are served from the most recently fetched
+// block where possible, so reading headers field by field does not make a request per field. Not safe for
+// concurrent use, except for ReadAt, which does not touch the read position or the block. For point and
+// small window queries of uncompressed layers, enable partial reads on the read.LayerReadCache (see
+// SetPartialReads) so that only the bytes of the samples are fetched, not whole tiles.
+//
+// Readers that know which tiles they will read next, such as the iterators and prefetching of the read
+// package, hint their byte ranges (see pixi.RangeHinter), and a read falling in a hinted range fetches it
+// together with the hinted ranges following it in a single request, so that scanning tiles in order
+// costs a request per run of tiles rather than per tile.
+//
+// A file opened with OpenMirrors is read from whichever of its mirrors last answered, failing over to the
+// next in turn when a request fails or times out.
+type File struct {
+	client   *Client
+	ctx      context.Context
+	size     int64
+	position int64
+	// The block most recently fetched, starting at blockStart.
+	block      []byte
+	blockStart int64
+	BlockSize  int // The number of bytes each range request fetches at least. Starts at DefaultBlockSize.
+	// The most bytes a range request fetches when joining hinted ranges, or 0 to ignore hints. Starts at
+	// DefaultMaxCoalesce.
+	MaxCoalesce int
+
+	hints []pixi.ByteRange // hinted ranges not yet fetched, in order and not touching each other
+
+	lock    sync.Mutex
+	mirrors []*mirror
+	current int                 // the mirror requests are sent to first
+	seal    *pixi.ContentDigest // the content seal of the file, if it is sealed and has several mirrors
+}
+
+// One of the URLs a file can be read from.
+type mirror struct {
+	url      *url.URL
+	verified bool  // whether the mirror is known to hold the same file as the one first opened
+	rejected error // why the mirror is never used, if it holds a different file
+}
+
+func (c *Client) open(ctx context.Context, fileURL *url.URL) (*File, error) {
+	return c.openMirrors(ctx, []*url.URL{fileURL})
+}
+
+// Opens the file at the first of the URLs that answers, recording its size and, if there are other
+// mirrors to check against it, its content seal.
+func (c *Client) openMirrors(ctx context.Context, urls []*url.URL) (*File, error) {
+	f := &File{client: c, ctx: ctx, BlockSize: DefaultBlockSize, MaxCoalesce: DefaultMaxCoalesce}
+	for _, fileURL := range urls {
+		f.mirrors = append(f.mirrors, &mirror{url: fileURL})
+	}
+	errs := []error{}
+	for i, m := range f.mirrors {
+		size, err := c.headSize(ctx, m.url)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			errs = append(errs, err)
+			continue
+		}
+		f.size, f.current, m.verified = size, i, true
+		break
+	}
+	if len(errs) == len(f.mirrors) {
+		return nil, mirrorsFailed(errs)
+	}
+	if len(f.mirrors) > 1 {
+		seal, err := pixi.ReadContentSeal(f.probe(f.mirrors[f.current]))
+		if err == nil {
+			f.seal = &seal
+		} else if !errors.Is(err, pixi.ErrUnsealed) {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// Finds the size of the file at the URL, checking that the server supports range requests.
+func (c *Client) headSize(ctx context.Context, fileURL *url.URL) (int64, error) {
+	if err := c.options.Throttle.wait(ctx, 0); err != nil {
+		return 0, err
+	}
+	ctx, cancel := c.requestContext(ctx)
+	defer cancel()
+	resp, err := c.do(ctx, http.MethodHead, fileURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.Header.Get("Accept-Ranges") != "bytes" {
+		return 0, fmt.Errorf("remote: %s does not support range requests", fileURL)
+	}
+	if resp.ContentLength < 0 {
+		return 0, fmt.Errorf("remote: %s did not report its size", fileURL)
+	}
+	return resp.ContentLength, nil
+}
+
+// The total number of bytes in the file.
+func (f *File) Size() int64 {
+	return f.size
+}
+
+func (f *File) Read(p []byte) (int, error) {
+	if f.position >= f.size {
+		return 0, io.EOF
+	}
+	if f.position < f.blockStart || f.position >= f.blockStart+int64(len(f.block)) {
+		length := min(max(int64(max(len(p), f.BlockSize)), f.coalesced(f.position)), f.size-f.position)
+		block, err := f.fetch(f.position, length)
+		if err != nil {
+			return 0, err
+		}
+		f.block, f.blockStart = block, f.position
+		f.dropHints(f.position + length)
+	}
+	n := copy(p, f.block[f.position-f.blockStart:])
+	f.position += int64(n)
+	return n, nil
+}
+
+// Reads len(p) bytes at the given offset with a single range request, bypassing the block.
+func (f *File) ReadAt(p []byte, off int64) (int, error) {
+	if off >= f.size {
+		return 0, io.EOF
+	}
+	length := min(int64(len(p)), f.size-off)
+	data, err := f.fetch(off, length)
+	n := copy(p, data)
+	if err == nil && n < len(p) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.position
+	case io.SeekEnd:
+		offset += f.size
+	default:
+		return f.position, errors.New("remote: invalid seek whence")
+	}
+	if offset < 0 {
+		return f.position, errors.New("remote: seek to a negative position")
+	}
+	f.position = offset
+	return offset, nil
+}
+
+// Records ranges of the file that are about to be read, so that a read in one of them fetches the
+// adjacent hinted ranges too, up to MaxCoalesce bytes. Ranges separated by gaps no longer than BlockSize,
+// such as tiles with padding between them, count as adjacent.
+func (f *File) HintRanges(ranges []pixi.ByteRange) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for _, r := range ranges {
+		if r.Length > 0 {
+			f.hints = append(f.hints, r)
+		}
+	}
+	slices.SortFunc(f.hints, func(a, b pixi.ByteRange) int { return cmp.Compare(a.Offset, b.Offset) })
+	merged := f.hints[:0]
+	for _, r := range f.hints {
+		if last := len(merged) - 1; last >= 0 && r.Offset <= merged[last].Offset+merged[last].Length {
+			merged[last].Length = max(merged[last].Length, r.Offset+r.Length-merged[last].Offset)
+			continue
+		}
+		merged = append(merged, r)
+	}
+	f.hints = merged
+}
+
+// The number of bytes from the offset to the end of the run of hinted ranges it lies in, up to
+// MaxCoalesce, or 0 if it lies in no hinted range.
+func (f *File) coalesced(offset int64) int64 {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.MaxCoalesce <= 0 {
+		return 0
+	}
+	limit := offset + int64(f.MaxCoalesce)
+	first, _ := slices.BinarySearchFunc(f.hints, offset, func(r pixi.ByteRange, offset int64) int {
+		return cmp.Compare(r.Offset+r.Length, offset+1)
+	})
+	if first == len(f.hints) || f.hints[first].Offset > offset {
+		return 0
+	}
+	end := f.hints[first].Offset + f.hints[first].Length
+	for _, r := range f.hints[first+1:] {
+		if r.Offset-end > int64(f.BlockSize) || r.Offset+r.Length > limit {
+			break
+		}
+		end = r.Offset + r.Length
+	}
+	return min(end, limit) - offset
+}
+
+// Forgets the hinted ranges ending before the given offset, which have been fetched or passed by.
+func (f *File) dropHints(offset int64) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	kept, _ := slices.BinarySearchFunc(f.hints, offset, func(r pixi.ByteRange, offset int64) int {
+		return cmp.Compare(r.Offset+r.Length, offset+1)
+	})
+	f.hints = slices.Delete(f.hints, 0, kept)
+}
+
+// Releases the file. Nothing is held open between requests, so this only drops the cached block.
+func (f *File) Close() error {
+	f.block = nil
+	return nil
+}
+
+// Fetches length bytes starting at offset with a range request, trying each mirror in turn from the one
+// that last answered until one does.
+func (f *File) fetch(offset int64, length int64) ([]byte, error) {
+	errs := []error{}
+	for attempt := range len(f.mirrors) {
+		f.lock.Lock()
+		index := (f.current + attempt) % len(f.mirrors)
+		m := f.mirrors[index]
+		f.lock.Unlock()
+
+		err := f.verify(m)
+		if err == nil {
+			var data []byte
+			data, err = f.fetchFrom(m.url, offset, length)
+			if err == nil {
+				f.lock.Lock()
+				f.current = index
+				f.lock.Unlock()
+				return data, nil
+			}
+		}
+		if f.ctx.Err() != nil || len(f.mirrors) == 1 {
+			return nil, err
+		}
+		errs = append(errs, err)
+	}
+	return nil, mirrorsFailed(errs)
+}
+
+// Checks, the first time a mirror is used, that it holds the same file as the mirror first opened: the
+// same size and, if the file is sealed (see pixi.SealContent), the same content seal. Mirrors holding a
+// different file are never used again.
+func (f *File) verify(m *mirror) error {
+	f.lock.Lock()
+	verified, rejected := m.verified, m.rejected
+	f.lock.Unlock()
+	if rejected != nil {
+		return rejected
+	}
+	if verified {
+		return nil
+	}
+
+	size, err := f.client.headSize(f.ctx, m.url)
+	if err != nil {
+		return err
+	}
+	if size != f.size {
+		rejected = fmt.Errorf("remote: mirror %s holds %d bytes rather than %d", m.url, size, f.size)
+	} else if f.seal != nil {
+		seal, err := pixi.ReadContentSeal(f.probe(m))
+		switch {
+		case errors.Is(err, pixi.ErrUnsealed) || errors.Is(err, pixi.ErrContentMismatch) || errors.As(err, new(pixi.FormatError)):
+			rejected = fmt.Errorf("remote: mirror %s is not sealed as the file first opened: %w", m.url, err)
+		case err != nil:
+			return err
+		case seal != *f.seal:
+			rejected = fmt.Errorf("remote: mirror %s is sealed with hash %s rather than %s", m.url, seal, f.seal)
+		}
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if rejected != nil {
+		m.rejected = rejected
+		return rejected
+	}
+	m.verified = true
+	return nil
+}
+
+// A file reading only from the given mirror, for checking what it holds.
+func (f *File) probe(m *mirror) *File {
+	return &File{client: f.client, ctx: f.ctx, size: f.size, BlockSize: f.BlockSize, mirrors: []*mirror{{url: m.url, verified: true}}}
+}
+
+// Fetches length bytes starting at offset from the URL with a range request, once the throttle allows
+// it. Time spent waiting for the throttle does not count against the request timeout.
+func (f *File) fetchFrom(fileURL *url.URL, offset int64, length int64) ([]byte, error) {
+	if err := f.client.options.Throttle.wait(f.ctx, length); err != nil {
+		return nil, err
+	}
+	ctx, cancel := f.client.requestContext(f.ctx)
+	defer cancel()
+	header := http.Header{"Range": {"bytes=" + strconv.FormatInt(offset, 10) + "-" + strconv.FormatInt(offset+length-1, 10)}}
+	resp, err := f.client.do(ctx, http.MethodGet, fileURL, header)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return nil, fmt.Errorf("remote: %s ignored a range request with status %d", fileURL, resp.StatusCode)
+	}
+	if contentRange := resp.Header.Get("Content-Range"); !strings.HasPrefix(contentRange, "bytes "+strconv.FormatInt(offset, 10)+"-") {
+		return nil, fmt.Errorf("remote: %s sent range %q for a request at offset %d", fileURL, contentRange, offset)
+	}
+	data := make([]byte, length)
+	_, err = io.ReadFull(resp.Body, data)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// The error of a request that every mirror of a file failed.
+func mirrorsFailed(errs []error) error {
+	if len(errs) == 1 {
+		return errs[0]
+	}
+	return fmt.Errorf("remote: every mirror failed: %w", errors.Join(errs...))
+}
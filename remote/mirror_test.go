@@ -0,0 +1,170 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/edit"
+	"github.com/owlpinetech/pixi/read"
+)
+
+// Writes the file served by startServer, sealed, with the value of every sample offset by shift.
+func sealedPixi(t *testing.T, shift uint16) []byte {
+	t.Helper()
+	file, err := os.Create(filepath.Join(t.TempDir(), "sealed.pixi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	header := pixi.PixiHeader{Version: pixi.Version, OffsetSize: 4, ByteOrder: binary.LittleEndian}
+	layer := pixi.NewLayer("values", false, pixi.CompressionNone,
+		pixi.DimensionSet{{Name: "x", Size: 8, TileSize: 4}, {Name: "y", Size: 8, TileSize: 4}},
+		[]pixi.Field{{Name: "v", Type: pixi.FieldUint16}})
+	err = edit.WriteContiguousTileOrderPixi(file, header, nil, edit.LayerWriter{
+		Layer: layer,
+		IterFn: func(layer *pixi.Layer, coord pixi.SampleCoordinate) ([]any, map[string]any) {
+			return []any{uint16(coord.ToSampleIndex(layer.Dimensions)) + shift}, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pixi.SealContent(file); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// Serves the data as a file supporting range requests, failing every request while fail is set and
+// delaying every request by delay, counting the requests answered.
+type mirrorServer struct {
+	data     []byte
+	fail     atomic.Bool
+	delay    time.Duration
+	answered atomic.Int32
+}
+
+func (m *mirrorServer) start(t *testing.T) string {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(m.delay)
+		if m.fail.Load() {
+			http.Error(w, "mirror down", http.StatusServiceUnavailable)
+			return
+		}
+		m.answered.Add(1)
+		http.ServeContent(w, r, "a.pixi", time.Time{}, bytes.NewReader(m.data))
+	}))
+	t.Cleanup(server.Close)
+	return server.URL + "/a.pixi"
+}
+
+// Reads every sample of the remote file, checking each holds its sample index.
+func readAllSamples(t *testing.T, file *File) error {
+	t.Helper()
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	summary, err := pixi.ReadPixi(file)
+	if err != nil {
+		return err
+	}
+	cache := read.NewLayerReadCache(file, summary.Header, summary.Layers[0], read.NewLfuCacheManager(4))
+	for y := range 8 {
+		for x := range 8 {
+			value, err := cache.FieldAt(pixi.SampleCoordinate{x, y}, 0)
+			if err != nil {
+				return err
+			}
+			if value != uint16(y*8+x) {
+				t.Errorf("expected %d at (%d, %d), got %v", y*8+x, x, y, value)
+			}
+		}
+	}
+	return nil
+}
+
+func TestOpenMirrorsFailsOver(t *testing.T) {
+	data := sealedPixi(t, 0)
+	first, second := &mirrorServer{data: data}, &mirrorServer{data: data}
+	ctx := context.Background()
+	file, err := OpenMirrors(ctx, []string{first.start(t), second.start(t)}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	file.BlockSize = 16
+
+	// the first mirror goes down part way through reading the file
+	summary, err := pixi.ReadPixi(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.fail.Store(true)
+	if err := readAllSamples(t, file); err != nil {
+		t.Fatal(err)
+	}
+	if len(summary.Layers) != 1 || second.answered.Load() == 0 {
+		t.Errorf("expected the second mirror to be read from, answered %d requests", second.answered.Load())
+	}
+
+	// and every mirror going down fails the read, naming each
+	second.fail.Store(true)
+	_, err = file.ReadAt(make([]byte, 4), 0)
+	if err == nil || !strings.Contains(err.Error(), "every mirror failed") {
+		t.Errorf("expected an error from every mirror, got %v", err)
+	}
+}
+
+func TestOpenMirrorsTimesOut(t *testing.T) {
+	data := sealedPixi(t, 0)
+	slow, fast := &mirrorServer{data: data, delay: 300 * time.Millisecond}, &mirrorServer{data: data}
+	file, err := OpenMirrors(context.Background(), []string{slow.start(t), fast.start(t)}, Options{RequestTimeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if err := readAllSamples(t, file); err != nil {
+		t.Fatal(err)
+	}
+	if slow.answered.Load() != 0 {
+		t.Errorf("expected the slow mirror never to answer in time, answered %d requests", slow.answered.Load())
+	}
+}
+
+func TestOpenMirrorsRejectsDifferentFiles(t *testing.T) {
+	data, other := sealedPixi(t, 0), sealedPixi(t, 1)
+	if len(data) != len(other) {
+		t.Fatalf("expected files of the same size, got %d and %d", len(data), len(other))
+	}
+	first, different := &mirrorServer{data: data}, &mirrorServer{data: other}
+	file, err := OpenMirrors(context.Background(), []string{first.start(t), different.start(t)}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := pixi.ReadPixi(file); err != nil {
+		t.Fatal(err)
+	}
+
+	first.fail.Store(true)
+	_, err = file.ReadAt(make([]byte, 4), 0)
+	if err == nil || !strings.Contains(err.Error(), "sealed with hash") {
+		t.Errorf("expected the mirror of a different file to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,262 @@
+// Package remote reads Pixi files from a server, either one run by the serve package or any HTTP server
+// that supports range requests. A remote file opened with Open or OpenURL is an io.ReadSeeker, so it can
+// be used with pixi.ReadPixi and the read package exactly as a local file would be, while a Client can
+// also ask a pixi server for decoded tiles and regions without reading the file structure itself.
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/serve"
+)
+
+// Options for connecting to a server.
+type Options struct {
+	HTTPClient *http.Client // The client requests are made with, or nil for http.DefaultClient.
+	User       string       // The user name for basic authentication, if any.
+	Password   string       // The password for basic authentication.
+	Token      string       // A bearer token sent instead of basic authentication, if set.
+	// The longest a request for the bytes of a file may take before it fails, and the next mirror of the
+	// file is tried (see OpenMirrors), or 0 for no limit beyond that of the HTTP client.
+	RequestTimeout time.Duration
+	// Limits the requests made and the bytes of files read, if set. A throttle may be shared by several
+	// clients and files, so that their combined traffic stays within its limits.
+	Throttle *Throttle
+}
+
+// An error response from a server. A 404 Not Found response matches fs.ErrNotExist with errors.Is.
+type StatusError struct {
+	URL     string
+	Status  int
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("remote: %s: %d %s: %s", e.URL, e.Status, http.StatusText(e.Status), e.Message)
+}
+
+func (e *StatusError) Is(target error) bool {
+	return target == fs.ErrNotExist && e.Status == http.StatusNotFound
+}
+
+// A connection to a pixi server, as started by the serve package or 'pixi serve'.
+type Client struct {
+	base    *url.URL
+	options Options
+}
+
+// Creates a client for the pixi server at the given base URL, such as "http://localhost:8080".
+func New(baseURL string, options Options) (*Client, error) {
+	base, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil {
+		return nil, err
+	}
+	if base.Scheme != "http" && base.Scheme != "https" {
+		return nil, pixi.UnsupportedError("server URL scheme '" + base.Scheme + "' is not http or https")
+	}
+	return &Client{base: base, options: options}, nil
+}
+
+// Returns the names of the files on the server.
+func (c *Client) Files(ctx context.Context) ([]string, error) {
+	var names []string
+	err := c.getJSON(ctx, c.endpoint("files"), &names)
+	return names, err
+}
+
+// Returns the summary of a file on the server.
+func (c *Client) Summary(ctx context.Context, file string) (serve.FileSummary, error) {
+	var summary serve.FileSummary
+	err := c.getJSON(ctx, c.endpoint("files", file), &summary)
+	return summary, err
+}
+
+// Returns the decoded data of the disk tile at the given index in a layer of a file on the server.
+func (c *Client) Tile(ctx context.Context, file string, layer int, tile int) ([]byte, error) {
+	resp, err := c.get(ctx, c.endpoint("files", file, "layers", strconv.Itoa(layer), "tiles", strconv.Itoa(tile)), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// The samples of a region read from a server. If the region was too large for the server to send in
+// full, the samples were read from an overview layer or with a stride, as described by the other fields.
+type Region struct {
+	Data   []byte // The raw samples, the first dimension varying fastest, in the byte order of the file.
+	Layer  int    // The index of the layer the samples were read from.
+	Start  pixi.SampleCoordinate
+	End    pixi.SampleCoordinate // The region read from that layer, end exclusive.
+	Stride int                   // The step between the samples read from that layer.
+	Size   []int                 // The number of samples sent along each dimension.
+	Scale  []int                 // The spacing of the samples sent, in samples of the requested layer.
+}
+
+// Reads the samples of a region of a layer of a file on the server, from start up to but excluding end.
+func (c *Client) Region(ctx context.Context, file string, layer int, start pixi.SampleCoordinate, end pixi.SampleCoordinate) (Region, error) {
+	endpoint := c.endpoint("files", file, "layers", strconv.Itoa(layer), "region")
+	endpoint.RawQuery = url.Values{"start": {joinInts(start)}, "end": {joinInts(end)}}.Encode()
+	resp, err := c.get(ctx, endpoint, nil)
+	if err != nil {
+		return Region{}, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Region{}, err
+	}
+
+	region := Region{Data: data}
+	var bounds []string
+	var parseErr error
+	parseInt := func(text string) int {
+		v, err := strconv.Atoi(text)
+		parseErr = errors.Join(parseErr, err)
+		return v
+	}
+	region.Layer = parseInt(resp.Header.Get("X-Pixi-Layer"))
+	region.Stride = parseInt(resp.Header.Get("X-Pixi-Stride"))
+	region.Size = splitInts(resp.Header.Get("X-Pixi-Size"), parseInt)
+	region.Scale = splitInts(resp.Header.Get("X-Pixi-Scale"), parseInt)
+	bounds = strings.Split(resp.Header.Get("X-Pixi-Region"), ":")
+	if len(bounds) != 2 {
+		return Region{}, pixi.FormatError("server sent a malformed region header")
+	}
+	region.Start = splitInts(bounds[0], parseInt)
+	region.End = splitInts(bounds[1], parseInt)
+	if parseErr != nil {
+		return Region{}, pixi.FormatError("server sent malformed region headers: " + parseErr.Error())
+	}
+	return region, nil
+}
+
+// Opens a file on the server for reading its raw bytes, as a local file would be read.
+func (c *Client) Open(ctx context.Context, file string) (*File, error) {
+	return c.open(ctx, c.endpoint("raw", file))
+}
+
+// Opens the Pixi file at the URL for reading, from any HTTP server that supports range requests.
+func OpenURL(ctx context.Context, rawURL string, options Options) (*File, error) {
+	return OpenMirrors(ctx, []string{rawURL}, options)
+}
+
+// Opens a Pixi file served from several mirrors for reading, from any HTTP servers that support range
+// requests, so that long reads survive a mirror failing. The file is opened from the first mirror that
+// answers, and each request is sent to the mirror that last answered, trying the others in turn if it
+// fails or takes longer than the request timeout of the options. Before a mirror is first read from, it
+// is checked to hold the same file: one of the same size and, if the file has a content seal (see
+// pixi.SealContent), the same seal; mirrors holding anything else are never read from.
+func OpenMirrors(ctx context.Context, rawURLs []string, options Options) (*File, error) {
+	if len(rawURLs) == 0 {
+		return nil, errors.New("remote: no URLs to open")
+	}
+	urls := make([]*url.URL, len(rawURLs))
+	for i, rawURL := range rawURLs {
+		fileURL, err := url.Parse(rawURL)
+		if err != nil {
+			return nil, err
+		}
+		if fileURL.Scheme != "http" && fileURL.Scheme != "https" {
+			return nil, pixi.UnsupportedError("URL scheme '" + fileURL.Scheme + "' is not http or https")
+		}
+		urls[i] = fileURL
+	}
+	c := &Client{base: urls[0], options: options}
+	return c.openMirrors(ctx, urls)
+}
+
+func (c *Client) endpoint(segments ...string) *url.URL {
+	endpoint := *c.base
+	// escaped separately so that names containing a slash stay a single segment
+	endpoint.RawPath = c.base.EscapedPath()
+	for _, segment := range segments {
+		endpoint.Path += "/" + segment
+		endpoint.RawPath += "/" + url.PathEscape(segment)
+	}
+	return &endpoint
+}
+
+func (c *Client) getJSON(ctx context.Context, endpoint *url.URL, v any) error {
+	resp, err := c.get(ctx, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// Makes a request, returning the response if it succeeded and a StatusError otherwise.
+func (c *Client) do(ctx context.Context, method string, endpoint *url.URL, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, endpoint.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	switch {
+	case c.options.Token != "":
+		req.Header.Set("Authorization", "Bearer "+c.options.Token)
+	case c.options.User != "":
+		req.SetBasicAuth(c.options.User, c.options.Password)
+	}
+	httpClient := c.options.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return nil, &StatusError{URL: endpoint.String(), Status: resp.StatusCode, Message: strings.TrimSpace(string(message))}
+}
+
+// The context of a single request for the bytes of a file, limited by the request timeout of the options.
+func (c *Client) requestContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.options.RequestTimeout > 0 {
+		return context.WithTimeout(ctx, c.options.RequestTimeout)
+	}
+	return ctx, func() {}
+}
+
+// Makes a GET request once the throttle of the options, if any, allows it.
+func (c *Client) get(ctx context.Context, endpoint *url.URL, header http.Header) (*http.Response, error) {
+	if err := c.options.Throttle.wait(ctx, 0); err != nil {
+		return nil, err
+	}
+	return c.do(ctx, http.MethodGet, endpoint, header)
+}
+
+func joinInts(values []int) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = strconv.Itoa(v)
+	}
+	return strings.Join(parts, ",")
+}
+
+func splitInts(text string, parse func(string) int) []int {
+	parts := strings.Split(text, ",")
+	values := make([]int, len(parts))
+	for i, part := range parts {
+		values[i] = parse(part)
+	}
+	return values
+}
@@ -0,0 +1,218 @@
+package remote
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/edit"
+	"github.com/owlpinetech/pixi/read"
+	"github.com/owlpinetech/pixi/serve"
+)
+
+// Serves a directory holding a single file, a.pixi, with an 8x8 layer of uint16 samples tiled 4x4 whose
+// values are their sample index.
+func startServer(t *testing.T, options serve.Options) *httptest.Server {
+	t.Helper()
+	root := t.TempDir()
+	file, err := os.Create(filepath.Join(root, "a.pixi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	header := pixi.PixiHeader{Version: pixi.Version, OffsetSize: 4, ByteOrder: binary.LittleEndian}
+	layer := pixi.NewLayer("values", false, pixi.CompressionFlate,
+		pixi.DimensionSet{{Name: "x", Size: 8, TileSize: 4}, {Name: "y", Size: 8, TileSize: 4}},
+		[]pixi.Field{{Name: "v", Type: pixi.FieldUint16}})
+	err = edit.WriteContiguousTileOrderPixi(file, header, nil, edit.LayerWriter{
+		Layer: layer,
+		IterFn: func(layer *pixi.Layer, coord pixi.SampleCoordinate) ([]any, map[string]any) {
+			return []any{uint16(coord.ToSampleIndex(layer.Dimensions))}, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := serve.NewDirectory(root, options)
+	t.Cleanup(func() { dir.Close() })
+	server := httptest.NewServer(dir.Handler())
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestClientRequests(t *testing.T) {
+	server := startServer(t, serve.Options{MaxRegionSamples: 4})
+	ctx := context.Background()
+	client, err := New(server.URL+"/", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names, err := client.Files(ctx)
+	if err != nil || !slices.Equal(names, []string{"a.pixi"}) {
+		t.Errorf("expected listing of a.pixi, got %v, %v", names, err)
+	}
+
+	summary, err := client.Summary(ctx, "a.pixi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summary.Layers) != 1 || summary.Layers[0].DiskTiles != 4 {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+
+	tile, err := client.Tile(ctx, "a.pixi", 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tile) != 32 || binary.LittleEndian.Uint16(tile) != 4 || binary.LittleEndian.Uint16(tile[8:]) != 12 {
+		t.Errorf("unexpected tile 1 %v", tile)
+	}
+
+	// 16 samples are too many, so every other sample is sent
+	region, err := client.Region(ctx, "a.pixi", 0, pixi.SampleCoordinate{0, 0}, pixi.SampleCoordinate{4, 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if region.Layer != 0 || region.Stride != 2 || !slices.Equal(region.Size, []int{2, 2}) || !slices.Equal(region.Scale, []int{2, 2}) ||
+		!slices.Equal(region.Start, pixi.SampleCoordinate{0, 0}) || !slices.Equal(region.End, pixi.SampleCoordinate{4, 4}) {
+		t.Errorf("unexpected region description %+v", region)
+	}
+	if !slices.Equal(region.Data, []byte{0, 0, 2, 0, 16, 0, 18, 0}) {
+		t.Errorf("unexpected region samples %v", region.Data)
+	}
+
+	_, err = client.Summary(ctx, "missing.pixi")
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected a missing file to be not found, got %v", err)
+	}
+}
+
+func TestClientAuthentication(t *testing.T) {
+	server := startServer(t, serve.Options{Authorize: func(access serve.Access) error {
+		if access.Request.Header.Get("Authorization") != "Bearer secret" {
+			return &serve.AccessError{Status: http.StatusUnauthorized, Reason: "token required"}
+		}
+		return nil
+	}})
+	ctx := context.Background()
+
+	client, _ := New(server.URL, Options{})
+	_, err := client.Files(ctx)
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.Status != http.StatusUnauthorized || !strings.Contains(statusErr.Message, "token required") {
+		t.Errorf("expected an unauthorized error, got %v", err)
+	}
+
+	client, _ = New(server.URL, Options{Token: "secret"})
+	if _, err := client.Files(ctx); err != nil {
+		t.Errorf("expected the token to be accepted, got %v", err)
+	}
+}
+
+func TestRemoteFileReadsLikeLocal(t *testing.T) {
+	server := startServer(t, serve.Options{})
+	ctx := context.Background()
+	client, _ := New(server.URL, Options{})
+	file, err := client.Open(ctx, "a.pixi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	file.BlockSize = 16
+
+	summary, err := pixi.ReadPixi(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summary.Layers) != 1 || summary.Layers[0].Name != "values" {
+		t.Fatalf("unexpected remote summary %+v", summary)
+	}
+	cache := read.NewLayerReadCache(file, summary.Header, summary.Layers[0], read.NewLfuCacheManager(4))
+	for _, coord := range []pixi.SampleCoordinate{{0, 0}, {5, 2}, {7, 7}} {
+		value, err := cache.FieldAt(coord, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value != uint16(coord.ToSampleIndex(summary.Layers[0].Dimensions)) {
+			t.Errorf("expected sample index at %v, got %v", coord, value)
+		}
+	}
+
+	_, err = client.Open(ctx, "missing.pixi")
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected a missing file to be not found, got %v", err)
+	}
+	_, err = OpenURL(ctx, "ftp://example.com/a.pixi", Options{})
+	if !errors.As(err, new(pixi.UnsupportedError)) {
+		t.Errorf("expected an unsupported scheme error, got %v", err)
+	}
+}
+
+func TestFileCoalescesHintedTiles(t *testing.T) {
+	// uncompressed, so that each tile is read with a single read of its size
+	server := &mirrorServer{data: sealedPixi(t, 0)}
+	fileURL := server.start(t)
+	requests := func(maxCoalesce int) (int32, []uint16) {
+		file, err := OpenURL(context.Background(), fileURL, Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.BlockSize, file.MaxCoalesce = 16, maxCoalesce
+		p, err := pixi.ReadPixi(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		before := server.answered.Load()
+		values := []uint16{}
+		for _, sample := range read.Samples(file, p.Header, p.Layers[0]) {
+			values = append(values, sample[0].(uint16))
+		}
+		return server.answered.Load() - before, values
+	}
+
+	separate, want := requests(0)
+	coalesced, got := requests(DefaultMaxCoalesce)
+	if !slices.Equal(got, want) || len(got) != 64 {
+		t.Fatalf("expected the same 64 samples with and without coalescing, got %v and %v", got, want)
+	}
+	if coalesced != 1 || separate < 4 {
+		t.Errorf("expected the four contiguous tiles to be fetched with one request rather than %d, got %d", separate, coalesced)
+	}
+}
+
+func TestFileHintRanges(t *testing.T) {
+	file := &File{BlockSize: 16, MaxCoalesce: 100}
+	file.HintRanges([]pixi.ByteRange{{Offset: 100, Length: 10}, {Offset: 0, Length: 10}, {Offset: 5, Length: 10}, {Offset: 20, Length: 10}, {Offset: 60, Length: 0}})
+	want := []pixi.ByteRange{{Offset: 0, Length: 15}, {Offset: 20, Length: 10}, {Offset: 100, Length: 10}}
+	if !slices.Equal(file.hints, want) {
+		t.Fatalf("expected overlapping hints to be merged into %v, got %v", want, file.hints)
+	}
+
+	// the gap of 5 bytes before the second range is joined, the gap of 70 before the third is not
+	if n := file.coalesced(3); n != 27 {
+		t.Errorf("expected 27 bytes to be fetched from offset 3, got %d", n)
+	}
+	if n := file.coalesced(40); n != 0 {
+		t.Errorf("expected nothing to be coalesced outside the hints, got %d", n)
+	}
+	file.MaxCoalesce = 20
+	if n := file.coalesced(3); n != 12 {
+		t.Errorf("expected only the first range to fit within 20 bytes, got %d", n)
+	}
+
+	file.dropHints(16)
+	if want := want[1:]; !slices.Equal(file.hints, want) {
+		t.Errorf("expected the hints before offset 16 to be dropped, leaving %v, got %v", want, file.hints)
+	}
+}
@@ -0,0 +1,122 @@
+package remote
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Limits the requests made to servers and the bytes of files read from them, so that background work
+// such as building overviews from shared object storage leaves room for other traffic. A throttle is
+// shared by every client and file given it in their Options, and delays each request until it fits
+// within both limits: requests per second, counting every request, and bytes per second, counting the
+// bytes asked for by the range requests that read files. Either limit may be zero for none. Safe for
+// concurrent use.
+type Throttle struct {
+	lock     sync.Mutex
+	now      func() time.Time
+	requests tokenBucket
+	bytes    tokenBucket
+	usage    ThrottleUsage
+}
+
+// The use made of a throttle since it was created.
+type ThrottleUsage struct {
+	Requests  int64         // The number of requests let through.
+	Bytes     int64         // The number of bytes of files asked for by those requests.
+	Throttled int64         // The number of requests delayed to keep within the limits.
+	Waited    time.Duration // The total time requests were delayed.
+}
+
+// Creates a throttle allowing the given numbers of bytes and requests per second, averaged over a
+// second, or no limit on either if it is zero.
+func NewThrottle(bytesPerSecond int64, requestsPerSecond float64) *Throttle {
+	return &Throttle{
+		now:      time.Now,
+		requests: newTokenBucket(requestsPerSecond),
+		bytes:    newTokenBucket(float64(bytesPerSecond)),
+	}
+}
+
+// Returns the use made of the throttle so far.
+func (t *Throttle) Usage() ThrottleUsage {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.usage
+}
+
+// Waits until a request for the given number of bytes of a file fits within the limits of the throttle,
+// or the context is done. A nil throttle lets every request through at once.
+func (t *Throttle) wait(ctx context.Context, bytes int64) error {
+	if t == nil {
+		return nil
+	}
+	delay := t.reserve(bytes)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		t.cancel(bytes)
+		return ctx.Err()
+	}
+}
+
+// Takes the tokens for a request from both buckets, returning how long the request must wait for them.
+func (t *Throttle) reserve(bytes int64) time.Duration {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	now := t.now()
+	delay := max(t.requests.take(now, 1), t.bytes.take(now, float64(bytes)))
+	t.usage.Requests++
+	t.usage.Bytes += bytes
+	if delay > 0 {
+		t.usage.Throttled++
+		t.usage.Waited += delay
+	}
+	return delay
+}
+
+// Returns the tokens of a request given up while waiting, so that later requests need not wait for them.
+func (t *Throttle) cancel(bytes int64) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.requests.tokens += 1
+	t.bytes.tokens += float64(bytes)
+	t.usage.Requests--
+	t.usage.Bytes -= bytes
+}
+
+// A token bucket holding up to a second's worth of tokens, which may be taken into debt by requests
+// larger than it holds, so that a single large read is delayed rather than refused.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64) tokenBucket {
+	burst := max(1, rate)
+	return tokenBucket{rate: rate, burst: burst, tokens: burst}
+}
+
+// Takes n tokens, returning how long until the bucket is out of debt again, or 0 if it never went into it.
+func (b *tokenBucket) take(now time.Time, n float64) time.Duration {
+	if b.rate <= 0 {
+		return 0
+	}
+	if !b.last.IsZero() {
+		b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	}
+	b.last = now
+	b.tokens -= n
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
@@ -0,0 +1,79 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/serve"
+)
+
+func TestThrottleReserve(t *testing.T) {
+	throttle := NewThrottle(1000, 2)
+	now := time.Unix(0, 0)
+	throttle.now = func() time.Time { return now }
+
+	if delay := throttle.reserve(600); delay != 0 {
+		t.Errorf("expected the first request to fit within the burst, got a delay of %s", delay)
+	}
+	// 400 bytes remain, so the next 600 go 200 into debt, repaid at 1000 bytes per second
+	if delay := throttle.reserve(600); delay != 200*time.Millisecond {
+		t.Errorf("expected a delay of 200ms for the bytes, got %s", delay)
+	}
+	// both request tokens are spent, so the third request waits half a second for one
+	if delay := throttle.reserve(0); delay != 500*time.Millisecond {
+		t.Errorf("expected a delay of 500ms for the request, got %s", delay)
+	}
+	now = now.Add(2 * time.Second)
+	if delay := throttle.reserve(900); delay != 0 {
+		t.Errorf("expected the buckets to refill after two seconds, got a delay of %s", delay)
+	}
+
+	want := ThrottleUsage{Requests: 4, Bytes: 2100, Throttled: 2, Waited: 700 * time.Millisecond}
+	if usage := throttle.Usage(); usage != want {
+		t.Errorf("expected usage %+v, got %+v", want, usage)
+	}
+}
+
+func TestThrottleWaitCancelled(t *testing.T) {
+	throttle := NewThrottle(10, 0)
+	if err := throttle.wait(context.Background(), 10); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := throttle.wait(ctx, 100); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the wait to end with the context, got %v", err)
+	}
+	if usage := throttle.Usage(); usage.Requests != 1 || usage.Bytes != 10 || usage.Throttled != 1 {
+		t.Errorf("expected the cancelled request not to be counted as made, got %+v", usage)
+	}
+}
+
+func TestOpenURLThrottled(t *testing.T) {
+	server := startServer(t, serve.Options{})
+	throttle := NewThrottle(0, 1000)
+	file, err := OpenURL(context.Background(), server.URL+"/raw/a.pixi", Options{Throttle: throttle})
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.BlockSize = 16
+	if _, err := pixi.ReadPixi(file); err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 10)
+	if _, err := file.ReadAt(data, file.Size()-10); err != nil && err != io.EOF {
+		t.Fatal(err)
+	}
+
+	usage := throttle.Usage()
+	if usage.Requests < 3 {
+		t.Errorf("expected the size and range requests to be counted, got %+v", usage)
+	}
+	if usage.Bytes < 10+16 {
+		t.Errorf("expected the bytes of every range request to be counted, got %+v", usage)
+	}
+}
@@ -0,0 +1,21 @@
+package pixi
+
+import "io"
+
+// Marks the named layer of the file as a scratch layer, or as an ordinary one again, by rewriting its
+// header in place; the flag does not change the size of the header. Useful for a pipeline that keeps the
+// intermediate products of each stage in the file it is writing, then keeps the final product and lets
+// compaction drop the rest. Sealed files are refused, since the seal covers the layer headers.
+func SetScratch(f io.ReadWriteSeeker, layerName string, scratch bool) error {
+	state, layerIndex, err := readLayerState(f, layerName)
+	if err != nil {
+		return err
+	}
+	layer := state.layers[layerIndex]
+	if layer.Scratch == scratch {
+		return nil
+	}
+	layer.Scratch = scratch
+	summary := Pixi{Header: state.header, Layers: state.layers}
+	return layer.OverwriteHeader(f, state.header, summary.LayerOffset(layer))
+}
@@ -0,0 +1,73 @@
+package pixi
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/owlpinetech/pixi/internal/buffer"
+)
+
+func TestScratchLayers(t *testing.T) {
+	header := PixiHeader{Version: Version, OffsetSize: 4, ByteOrder: binary.BigEndian}
+	buf := buffer.NewBuffer(10)
+	final := appendTestLayer("final")
+	writeSingleLayerPixi(t, buf, header, nil, final, randomTiles(final))
+	stage := appendTestLayer("stage")
+	stage.Scratch = true
+	err := AppendLayer(buf, stage, 1, func(tileIndex int, data []byte) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	summary, err := ReadPixi(buffer.NewBufferFrom(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	all := summary.AllLayers()
+	if len(all) != 2 || !all[1].Scratch || all[0].Scratch {
+		t.Fatalf("expected the scratch flag to be read back, got %v", all)
+	}
+	if len(summary.Layers) != 1 || summary.Layers[0].Name != "final" {
+		t.Errorf("expected only the final layer to be listed, got %v", summary.Layers)
+	}
+	if summary.LayerOffset(all[1]) != all[0].NextLayerStart {
+		t.Errorf("expected the offset of the scratch layer to follow the chain, got %d", summary.LayerOffset(all[1]))
+	}
+
+	size := len(buf.Bytes())
+	err = SetScratch(buf, "final", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = SetScratch(buf, "stage", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary, err = ReadPixi(buffer.NewBufferFrom(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if all = summary.AllLayers(); len(buf.Bytes()) != size || !all[0].Scratch || all[1].Scratch || summary.Layers[0].Name != "stage" {
+		t.Errorf("expected the flags to be swapped in place, got %v", all)
+	}
+
+	_, err = SealContent(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var unsupported UnsupportedError
+	if err = SetScratch(buf, "stage", true); !errors.As(err, &unsupported) {
+		t.Errorf("expected marking a layer of a sealed file to be refused, got %v", err)
+	}
+}
+
+func TestScratchLayersRequireVersion2(t *testing.T) {
+	layer := appendTestLayer("stage")
+	layer.Scratch = true
+	err := layer.WriteHeader(buffer.NewBuffer(10), PixiHeader{Version: 1, OffsetSize: 4, ByteOrder: binary.BigEndian})
+	var format FormatError
+	if !errors.As(err, &format) {
+		t.Errorf("expected a scratch layer to be refused in version 1, got %v", err)
+	}
+}
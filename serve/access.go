@@ -0,0 +1,87 @@
+package serve
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/owlpinetech/pixi"
+)
+
+// The kind of resource a request asks for, passed to the Authorize hook.
+type AccessKind int
+
+const (
+	AccessList    AccessKind = iota // The listing of the files in the directory.
+	AccessSummary                   // The summary of a file.
+	AccessTile                      // A decoded tile of a layer.
+	AccessRaw                       // The raw bytes of a file, or a range of them.
+	AccessRegion                    // The samples of a region of a layer.
+	AccessStats                     // The statistics of a field over a region of a layer.
+	AccessFile                      // A file whose tiles, regions or statistics are requested, before it is opened.
+)
+
+func (k AccessKind) String() string {
+	switch k {
+	case AccessList:
+		return "list"
+	case AccessSummary:
+		return "summary"
+	case AccessTile:
+		return "tile"
+	case AccessRaw:
+		return "raw"
+	case AccessRegion:
+		return "region"
+	case AccessStats:
+		return "stats"
+	case AccessFile:
+		return "file"
+	default:
+		return "unknown"
+	}
+}
+
+// Describes what a request is about to read, for the Authorize hook to decide whether it is allowed.
+// Fields that do not apply to the kind of access are left at their zero values, with LayerIndex and
+// Tile set to -1.
+type Access struct {
+	Request    *http.Request
+	Kind       AccessKind
+	File       string // The name of the file within the directory.
+	Layer      string // The name of the layer of a tile or region.
+	LayerIndex int    // The index of the layer of a tile or region within its file.
+	Tile       int    // The index of the disk tile among the tiles of its layer.
+	// The bounds of the samples in the tile or region: the first sample, and one past the last in every dimension.
+	Start pixi.SampleCoordinate
+	End   pixi.SampleCoordinate
+}
+
+// Returned by an Authorize hook to deny a request with a particular status, such as 401 Unauthorized
+// when credentials are missing. Any other error denies the request with 403 Forbidden.
+type AccessError struct {
+	Status int
+	Reason string
+}
+
+func (e *AccessError) Error() string {
+	return e.Reason
+}
+
+// Runs the Authorize hook, if there is one, writing the error response and returning false if the
+// access is denied.
+func (d *Directory) authorize(w http.ResponseWriter, access Access) bool {
+	if d.options.Authorize == nil {
+		return true
+	}
+	err := d.options.Authorize(access)
+	if err == nil {
+		return true
+	}
+	var accessErr *AccessError
+	if errors.As(err, &accessErr) {
+		http.Error(w, accessErr.Reason, accessErr.Status)
+	} else {
+		http.Error(w, err.Error(), http.StatusForbidden)
+	}
+	return false
+}
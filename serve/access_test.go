@@ -0,0 +1,122 @@
+package serve
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/owlpinetech/pixi"
+)
+
+func TestAuthorizeHook(t *testing.T) {
+	root := t.TempDir()
+	writeServedFile(t, filepath.Join(root, "a.pixi"), 0)
+
+	var seen []Access
+	dir := NewDirectory(root, Options{Authorize: func(access Access) error {
+		seen = append(seen, access)
+		if access.Request.Header.Get("Authorization") == "" {
+			return &AccessError{Status: http.StatusUnauthorized, Reason: "credentials required"}
+		}
+		// only the western half of the layer is entitled
+		if access.Kind == AccessTile && access.End[0] > 2 {
+			return errors.New("outside of entitled area")
+		}
+		if access.Kind == AccessRaw {
+			return errors.New("raw access is not entitled")
+		}
+		return nil
+	}})
+	defer dir.Close()
+	server := httptest.NewServer(dir.Handler())
+	defer server.Close()
+
+	request := func(path string, credentials bool) int {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if credentials {
+			req.Header.Set("Authorization", "Bearer token")
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	cases := []struct {
+		path        string
+		credentials bool
+		status      int
+	}{
+		{"/files", false, http.StatusUnauthorized},
+		{"/files", true, http.StatusOK},
+		{"/files/a.pixi", false, http.StatusUnauthorized},
+		{"/files/a.pixi", true, http.StatusOK},
+		{"/files/a.pixi/layers/0/tiles/0", true, http.StatusOK},
+		{"/files/a.pixi/layers/0/tiles/1", true, http.StatusForbidden},
+		{"/raw/a.pixi", true, http.StatusForbidden},
+	}
+	for _, c := range cases {
+		if status := request(c.path, c.credentials); status != c.status {
+			t.Errorf("expected %s (credentials: %v) to get %d, got %d", c.path, c.credentials, c.status, status)
+		}
+	}
+
+	var tile, file Access
+	for _, access := range seen {
+		if access.Kind == AccessTile && access.Tile == 1 {
+			tile = access
+		}
+		if access.Kind == AccessFile {
+			file = access
+		}
+	}
+	if file.File != "a.pixi" || file.LayerIndex != -1 || file.Start != nil {
+		t.Errorf("expected the file to be checked alone before its tiles, got %+v", file)
+	}
+	if tile.File != "a.pixi" || tile.Layer != "values" || tile.LayerIndex != 0 ||
+		!slices.Equal(tile.Start, pixi.SampleCoordinate{2, 0}) || !slices.Equal(tile.End, pixi.SampleCoordinate{4, 2}) {
+		t.Errorf("expected the tile access to describe tile 1 of layer values, got %+v", tile)
+	}
+}
+
+func TestAuthorizeBeforeOpening(t *testing.T) {
+	root := t.TempDir()
+	writeServedFile(t, filepath.Join(root, "a.pixi"), 0)
+	if err := os.WriteFile(filepath.Join(root, "corrupt.pixi"), []byte("not a pixi file"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := NewDirectory(root, Options{Authorize: func(access Access) error {
+		if access.Request.Header.Get("Authorization") == "" {
+			return errors.New("not entitled")
+		}
+		return nil
+	}})
+	defer dir.Close()
+	server := httptest.NewServer(dir.Handler())
+	defer server.Close()
+
+	for _, file := range []string{"a.pixi", "missing.pixi", "corrupt.pixi"} {
+		for _, endpoint := range []string{"/tiles/0", "/region?start=0,0&end=1,1", "/stats?start=0,0&end=1,1"} {
+			path := "/files/" + file + "/layers/0" + endpoint
+			resp, err := http.Get(server.URL + path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusForbidden {
+				t.Errorf("expected a denied client to get %d for %s, got %d", http.StatusForbidden, path, resp.StatusCode)
+			}
+		}
+	}
+}
@@ -0,0 +1,248 @@
+// Package serve publishes a directory of Pixi files over HTTP: a listing of the files, a summary of
+// each file, the decoded tiles of each layer, and the raw bytes of each file for remote readers. Files are reloaded when they change on disk, so
+// updated data can be republished by replacing the files without restarting the server, or by updating
+// them in place and publishing each update with pixi.PublishGeneration.
+package serve
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/read"
+)
+
+// The file extension of the files in a directory that are served.
+const Extension = ".pixi"
+
+// Options for a served Directory.
+type Options struct {
+	CacheBytes int64 // The maximum number of bytes of decoded tiles cached across all files, or 0 for 256 MiB.
+	// How long a file is trusted not to have changed after it was last checked. Each request for a file
+	// checked longer ago than this looks at its modification time, size, and identity on disk, and
+	// reloads the file if any changed. 0 checks on every request.
+	CheckInterval time.Duration
+	// The Cache-Control header of summary and tile responses, or "" for DefaultCacheControl. Every such
+	// response also has a strong ETag, and conditional requests for unchanged data get 304 Not Modified.
+	CacheControl string
+	// Called before anything is read for a request, with a description of what it reads, to enforce
+	// entitlements such as which clients may read which files, layers, or areas. Returning nil allows the
+	// request, while an error denies it (see AccessError). If nil, every request is allowed. Requests for
+	// tiles, regions and statistics are checked twice: first as AccessFile, for the file alone, before it
+	// is opened, so that denied clients learn nothing of it, and then for the layer and bounds requested.
+	Authorize func(access Access) error
+	// The largest number of samples a region request may send, or 0 for DefaultMaxRegionSamples. Negative
+	// values allow regions of any size. Larger regions are reduced to fit, by reading them from an overview
+	// layer or by skipping samples, unless RejectOversizeRegions is set, in which case they are refused.
+	MaxRegionSamples      int64
+	RejectOversizeRegions bool
+	// The number of region requests each client may make per second on average, or 0 for no limit, with up
+	// to RateBurst at once (at least 1, and by default the rate rounded up). Refused requests get 429 Too Many
+	// Requests with a Retry-After header.
+	RateLimit float64
+	RateBurst int
+	// Identifies the client of a request for rate limiting, for example by an API key header. If nil,
+	// clients are identified by their remote host.
+	ClientKey func(r *http.Request) string
+}
+
+// A directory of Pixi files being served. The headers and layers of each file are read once and kept,
+// along with a cache of its tiles, until the file is replaced or modified on disk, at which point the
+// next request for it reads the new version and drops everything cached from the old one. Requests
+// already reading the old version finish with it before it is closed.
+type Directory struct {
+	root    string
+	options Options
+	pool    *read.CachePool
+	limiter *limiter
+	now     func() time.Time
+
+	lock  sync.Mutex
+	files map[string]*servedFile
+}
+
+// A version of a file as it was when it was opened, with the caches of each of its layers. Kept open
+// until it has been replaced and no request is using it.
+type servedFile struct {
+	file     *os.File
+	info     os.FileInfo
+	checked  time.Time
+	summary  pixi.Pixi
+	caches   []*read.LayerReadCache
+	managers []read.CacheManager[int, []byte]
+	users    int
+	stale    bool
+}
+
+// Creates a server for the Pixi files directly within the root directory.
+func NewDirectory(root string, options Options) *Directory {
+	cacheBytes := options.CacheBytes
+	if cacheBytes <= 0 {
+		cacheBytes = 256 << 20
+	}
+	return &Directory{
+		root:    root,
+		options: options,
+		pool:    read.NewCachePool(cacheBytes),
+		limiter: newLimiter(options.RateLimit, options.RateBurst),
+		now:     time.Now,
+		files:   make(map[string]*servedFile),
+	}
+}
+
+// Returns the names of the Pixi files in the directory, sorted.
+func (d *Directory) Files() ([]string, error) {
+	entries, err := os.ReadDir(d.root)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && strings.EqualFold(filepath.Ext(entry.Name()), Extension) {
+			names = append(names, entry.Name())
+		}
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// Closes every file held open by the directory. Requests still in progress finish with the files they
+// are using, which are closed when they are done.
+func (d *Directory) Close() error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	var firstErr error
+	for name, served := range d.files {
+		delete(d.files, name)
+		if err := d.retire(served); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Returns the current version of the named file for use by a request, reloading it first if it has
+// changed on disk. The caller must call release with the result once it is done with it.
+func (d *Directory) acquire(name string) (*servedFile, error) {
+	if !validName(name) {
+		return nil, os.ErrNotExist
+	}
+	path := filepath.Join(d.root, name)
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	served, found := d.files[name]
+	if found && d.now().Sub(served.checked) < d.options.CheckInterval {
+		served.users += 1
+		return served, nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		if found {
+			delete(d.files, name)
+			d.retire(served)
+		}
+		return nil, err
+	}
+	if found && (sameVersion(served.info, info) || served.sameGeneration(info)) {
+		served.checked = d.now()
+		served.users += 1
+		return served, nil
+	}
+	if found {
+		delete(d.files, name)
+		d.retire(served)
+	}
+
+	served, err = d.load(path)
+	if err != nil {
+		return nil, err
+	}
+	d.files[name] = served
+	served.users += 1
+	return served, nil
+}
+
+// Returns a file acquired by a request, closing it if it has been replaced and nothing else uses it.
+func (d *Directory) release(served *servedFile) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	served.users -= 1
+	if served.stale && served.users == 0 {
+		served.file.Close()
+	}
+}
+
+// Marks a version of a file as replaced, dropping its cached tiles, and closes it if no request is
+// using it.
+func (d *Directory) retire(served *servedFile) error {
+	served.stale = true
+	for _, manager := range served.managers {
+		d.pool.Release(manager)
+	}
+	if served.users == 0 {
+		return served.file.Close()
+	}
+	return nil
+}
+
+func (d *Directory) load(path string) (*servedFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	summary, err := pixi.ReadSnapshot(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	// the identity of the opened file is what is served, even if the path is replaced while loading, and
+	// its size is taken after reading so that it covers every tile of the generation read
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	// scratch layers are left out of the summary, so only the finished products of the file are served
+	served := &servedFile{file: file, info: info, checked: d.now(), summary: summary}
+	for _, layer := range summary.Layers {
+		// each layer reads through its own section so that concurrent tile loads do not share a position
+		backing := io.NewSectionReader(file, 0, info.Size())
+		manager := d.pool.Manager()
+		served.caches = append(served.caches, read.NewLayerReadCache(backing, summary.Header, layer, manager))
+		served.managers = append(served.managers, manager)
+	}
+	return served, nil
+}
+
+// Reports whether a file updated through pixi.PublishGeneration, observed again with the given info, still
+// has the generation being served, having only grown since; so that a file being written while it is
+// served is reloaded once per published generation rather than on every change.
+func (s *servedFile) sameGeneration(info os.FileInfo) bool {
+	if s.summary.Generation() == 0 || !os.SameFile(s.info, info) || info.Size() < s.info.Size() {
+		return false
+	}
+	var header pixi.PixiHeader
+	err := header.ReadHeader(io.NewSectionReader(s.file, 0, info.Size()))
+	return err == nil && header.FirstLayerOffset == s.summary.Header.FirstLayerOffset &&
+		header.FirstTagsOffset == s.summary.Header.FirstTagsOffset
+}
+
+// Reports whether two observations of a path refer to the same, unmodified file.
+func sameVersion(a os.FileInfo, b os.FileInfo) bool {
+	return os.SameFile(a, b) && a.ModTime().Equal(b.ModTime()) && a.Size() == b.Size()
+}
+
+// Reports whether the name refers to a Pixi file directly within the served directory.
+func validName(name string) bool {
+	return name != "" && filepath.IsLocal(name) && filepath.Base(name) == name &&
+		strings.EqualFold(filepath.Ext(name), Extension)
+}
@@ -0,0 +1,238 @@
+package serve
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/edit"
+)
+
+// Writes a file with a single 4x4 layer of uint16 samples, tiled 2x2, whose values are the sample index
+// plus base.
+func writeServedFile(t *testing.T, path string, base uint16) {
+	t.Helper()
+	// written beside the path and renamed over it, as a publishing process would
+	tmp, err := os.CreateTemp(filepath.Dir(path), "publish-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tmp.Close()
+	header := pixi.PixiHeader{Version: pixi.Version, OffsetSize: 4, ByteOrder: binary.LittleEndian}
+	layer := pixi.NewLayer("values", false, pixi.CompressionFlate,
+		pixi.DimensionSet{{Name: "x", Size: 4, TileSize: 2}, {Name: "y", Size: 4, TileSize: 2}},
+		[]pixi.Field{{Name: "v", Type: pixi.FieldUint16}})
+	err = edit.WriteContiguousTileOrderPixi(tmp, header, nil, edit.LayerWriter{
+		Layer: layer,
+		IterFn: func(layer *pixi.Layer, coord pixi.SampleCoordinate) ([]any, map[string]any) {
+			return []any{uint16(coord.ToSampleIndex(layer.Dimensions)) + base}, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tmp.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func get(t *testing.T, server *httptest.Server, path string) (int, []byte) {
+	t.Helper()
+	resp, err := http.Get(server.URL + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, body
+}
+
+func TestDirectoryServesFiles(t *testing.T) {
+	root := t.TempDir()
+	writeServedFile(t, filepath.Join(root, "a.pixi"), 0)
+	err := os.WriteFile(filepath.Join(root, "notes.txt"), []byte("not served"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := NewDirectory(root, Options{})
+	defer dir.Close()
+	server := httptest.NewServer(dir.Handler())
+	defer server.Close()
+
+	status, body := get(t, server, "/files")
+	var names []string
+	if status != http.StatusOK || json.Unmarshal(body, &names) != nil || !slices.Equal(names, []string{"a.pixi"}) {
+		t.Errorf("expected listing of a.pixi, got %d %s", status, body)
+	}
+
+	status, body = get(t, server, "/files/a.pixi")
+	var summary FileSummary
+	if status != http.StatusOK || json.Unmarshal(body, &summary) != nil {
+		t.Fatalf("expected summary, got %d %s", status, body)
+	}
+	if len(summary.Layers) != 1 || summary.Layers[0].DiskTiles != 4 || summary.Layers[0].Fields[0].Type != "uint16" {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+
+	// tile 1 covers x 2-3, y 0-1: sample indices 2, 3, 6, 7
+	status, body = get(t, server, "/files/a.pixi/layers/0/tiles/1")
+	if status != http.StatusOK || !slices.Equal(body, []byte{2, 0, 3, 0, 6, 0, 7, 0}) {
+		t.Errorf("expected decoded tile 1, got %d %v", status, body)
+	}
+
+	for _, path := range []string{"/files/b.pixi", "/files/notes.txt", "/files/a.pixi/layers/1/tiles/0", "/files/a.pixi/layers/0/tiles/4", "/files/..%2Fa.pixi"} {
+		if status, _ := get(t, server, path); status != http.StatusNotFound {
+			t.Errorf("expected %s to be not found, got %d", path, status)
+		}
+	}
+}
+
+func TestDirectoryReloadsReplacedFiles(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "a.pixi")
+	writeServedFile(t, path, 0)
+	dir := NewDirectory(root, Options{})
+	defer dir.Close()
+	server := httptest.NewServer(dir.Handler())
+	defer server.Close()
+
+	if _, body := get(t, server, "/files/a.pixi/layers/0/tiles/0"); !slices.Equal(body, []byte{0, 0, 1, 0, 4, 0, 5, 0}) {
+		t.Fatalf("expected original tile, got %v", body)
+	}
+	old := dir.files["a.pixi"]
+
+	writeServedFile(t, path, 100)
+	if _, body := get(t, server, "/files/a.pixi/layers/0/tiles/0"); !slices.Equal(body, []byte{100, 0, 101, 0, 104, 0, 105, 0}) {
+		t.Errorf("expected tile of the replacement file, got %v", body)
+	}
+	if _, err := old.file.Stat(); err == nil {
+		t.Error("expected the replaced version of the file to be closed")
+	}
+	if dir.pool.UsedBytes() != 8 {
+		t.Errorf("expected only the new tile to remain cached, %d bytes cached", dir.pool.UsedBytes())
+	}
+
+	os.Remove(path)
+	if status, _ := get(t, server, "/files/a.pixi"); status != http.StatusNotFound {
+		t.Errorf("expected removed file to be not found, got %d", status)
+	}
+}
+
+func TestDirectoryCheckInterval(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "a.pixi")
+	writeServedFile(t, path, 0)
+	dir := NewDirectory(root, Options{CheckInterval: time.Minute})
+	defer dir.Close()
+	now := time.Now()
+	dir.now = func() time.Time { return now }
+
+	served, err := dir.acquire("a.pixi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a request still using the old version keeps it open after it is replaced
+	writeServedFile(t, path, 100)
+	now = now.Add(30 * time.Second)
+	if again, err := dir.acquire("a.pixi"); err != nil || again != served {
+		t.Errorf("expected the file not to be checked again within the interval")
+	} else {
+		dir.release(again)
+	}
+
+	now = now.Add(time.Minute)
+	reloaded, err := dir.acquire("a.pixi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dir.release(reloaded)
+	if reloaded == served {
+		t.Error("expected the file to be reloaded once the interval passed")
+	}
+	if _, err := served.file.Stat(); err != nil {
+		t.Error("expected the old version to stay open while a request uses it")
+	}
+	dir.release(served)
+	if _, err := served.file.Stat(); err == nil {
+		t.Error("expected the old version to be closed once released")
+	}
+}
+
+func TestDirectoryServesPublishedGenerations(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "a.pixi")
+	writeServedFile(t, path, 0)
+	dir := NewDirectory(root, Options{})
+	defer dir.Close()
+	server := httptest.NewServer(dir.Handler())
+	defer server.Close()
+
+	writer, err := pixi.OpenFile(path, pixi.OpenOptions{Mode: pixi.ReadWrite})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+	summary, err := pixi.ReadSnapshot(writer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = pixi.PublishGeneration(writer, &summary); err != nil {
+		t.Fatal(err)
+	}
+	writer.Close()
+	if _, body := get(t, server, "/files/a.pixi/layers/0/tiles/0"); !slices.Equal(body, []byte{0, 0, 1, 0, 4, 0, 5, 0}) {
+		t.Fatalf("expected original tile, got %v", body)
+	}
+	served := dir.files["a.pixi"]
+
+	// a new tile appended but not yet published is not served, and does not reload the file
+	writer, err = pixi.OpenFile(path, pixi.OpenOptions{Mode: pixi.ReadWrite})
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary, err = pixi.ReadSnapshot(writer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = writer.Seek(0, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	if err = summary.Layers[0].WriteTile(writer, summary.Header, 0, []byte{9, 0, 9, 0, 9, 0, 9, 0}); err != nil {
+		t.Fatal(err)
+	}
+	if _, body := get(t, server, "/files/a.pixi/layers/0/tiles/0"); !slices.Equal(body, []byte{0, 0, 1, 0, 4, 0, 5, 0}) {
+		t.Errorf("expected the published tile while the update is in progress, got %v", body)
+	}
+	if dir.files["a.pixi"] != served {
+		t.Errorf("expected the file not to be reloaded before the update is published")
+	}
+
+	if _, err = pixi.PublishGeneration(writer, &summary); err != nil {
+		t.Fatal(err)
+	}
+	writer.Close()
+	if _, body := get(t, server, "/files/a.pixi/layers/0/tiles/0"); !slices.Equal(body, []byte{9, 0, 9, 0, 9, 0, 9, 0}) {
+		t.Errorf("expected the tile of the new generation, got %v", body)
+	}
+	_, body := get(t, server, "/files/a.pixi")
+	var fileSum FileSummary
+	if err = json.Unmarshal(body, &fileSum); err != nil || fileSum.Generation != 2 {
+		t.Errorf("expected the summary to report generation 2, got %s", body)
+	}
+}
@@ -0,0 +1,68 @@
+package serve
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/internal/xxhash"
+)
+
+// The Cache-Control header sent with responses when the options do not give one. Caches may keep
+// responses but must revalidate them, which is cheap with ETags, since files can be republished at any time.
+const DefaultCacheControl = "public, no-cache"
+
+// Returns the strong ETag of the decoded tile at the given index. It is derived from the checksum stored
+// with the tile, so a conditional request can be answered without reading or decoding the tile. Files
+// without checksums fall back to hashing the decoded tile.
+func (s *servedFile) tileETag(layerIndex int, tileIndex int) (string, error) {
+	layer := s.summary.Layers[layerIndex]
+	header := s.summary.Header
+	if header.Checksum == pixi.ChecksumNone {
+		data, err := s.caches[layerIndex].Tile(tileIndex)
+		if err != nil {
+			return "", err
+		}
+		return contentETag(data), nil
+	}
+	checksum, err := layer.ReadTileChecksum(io.NewSectionReader(s.file, 0, s.info.Size()), header, tileIndex)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(`"%s-%0*x-%d"`, header.Checksum, header.Checksum.Size()*2, checksum, layer.DiskTileSize(tileIndex)), nil
+}
+
+// Returns the strong ETag of an encoded response body, by hashing it.
+func contentETag(body []byte) string {
+	return fmt.Sprintf(`"xxhash64-%016x-%d"`, xxhash.Sum64(body), len(body))
+}
+
+// Sets the caching headers of a response with the given ETag, then reports whether the request already
+// has the current representation according to its If-None-Match header, in which case a 304 Not Modified
+// response has been written and nothing else should be.
+func (d *Directory) checkNotModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	cacheControl := d.options.CacheControl
+	if cacheControl == "" {
+		cacheControl = DefaultCacheControl
+	}
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", cacheControl)
+	if !etagMatches(r.Header.Get("If-None-Match"), etag) {
+		return false
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// Reports whether an If-None-Match header lists the ETag, using the weak comparison the header calls for.
+func etagMatches(ifNoneMatch string, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package serve
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func conditionalGet(t *testing.T, server *httptest.Server, path string, ifNoneMatch string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, server.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ifNoneMatch != "" {
+		req.Header.Set("If-None-Match", ifNoneMatch)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func TestConditionalRequests(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "a.pixi")
+	writeServedFile(t, path, 0)
+	dir := NewDirectory(root, Options{CacheControl: "public, max-age=60"})
+	defer dir.Close()
+	server := httptest.NewServer(dir.Handler())
+	defer server.Close()
+
+	for _, endpoint := range []string{"/files/a.pixi", "/files/a.pixi/layers/0/tiles/2"} {
+		first := conditionalGet(t, server, endpoint, "")
+		etag := first.Header.Get("ETag")
+		if first.StatusCode != http.StatusOK || etag == "" || etag[0] != '"' {
+			t.Fatalf("expected %s to have a strong ETag, got %d %q", endpoint, first.StatusCode, etag)
+		}
+		if cc := first.Header.Get("Cache-Control"); cc != "public, max-age=60" {
+			t.Errorf("expected configured Cache-Control on %s, got %q", endpoint, cc)
+		}
+
+		for _, ifNoneMatch := range []string{etag, `"other", ` + etag, "W/" + etag, "*"} {
+			if resp := conditionalGet(t, server, endpoint, ifNoneMatch); resp.StatusCode != http.StatusNotModified {
+				t.Errorf("expected If-None-Match %s on %s to be not modified, got %d", ifNoneMatch, endpoint, resp.StatusCode)
+			}
+		}
+		if resp := conditionalGet(t, server, endpoint, `"other"`); resp.StatusCode != http.StatusOK {
+			t.Errorf("expected a different ETag on %s to get the content, got %d", endpoint, resp.StatusCode)
+		}
+	}
+
+	// tiles with the same data keep their ETag when the file is republished, while changed tiles do not
+	unchanged := conditionalGet(t, server, "/files/a.pixi/layers/0/tiles/2", "").Header.Get("ETag")
+	summary := conditionalGet(t, server, "/files/a.pixi", "").Header.Get("ETag")
+	writeServedFile(t, path, 0)
+	if resp := conditionalGet(t, server, "/files/a.pixi/layers/0/tiles/2", unchanged); resp.StatusCode != http.StatusNotModified {
+		t.Errorf("expected an identical tile to stay not modified after republishing, got %d", resp.StatusCode)
+	}
+	writeServedFile(t, path, 7)
+	if resp := conditionalGet(t, server, "/files/a.pixi/layers/0/tiles/2", unchanged); resp.StatusCode != http.StatusOK {
+		t.Errorf("expected a changed tile to be sent again, got %d", resp.StatusCode)
+	}
+	if resp := conditionalGet(t, server, "/files/a.pixi", summary); resp.StatusCode != http.StatusOK {
+		t.Errorf("expected the summary of a changed file to be sent again, got %d", resp.StatusCode)
+	}
+}
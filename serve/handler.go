@@ -0,0 +1,252 @@
+package serve
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/owlpinetech/pixi"
+)
+
+// A summary of a served file, as returned for /files/{file}.
+type FileSummary struct {
+	Name       string            `json:"name"`
+	Version    int               `json:"version"`
+	Generation uint64            `json:"generation,omitempty"` // The generation last published with pixi.PublishGeneration, if any.
+	ByteOrder  string            `json:"byteOrder"`
+	Checksum   string            `json:"checksum"`
+	Tags       map[string]string `json:"tags"`
+	Layers     []LayerSummary    `json:"layers"`
+	ModTime    string            `json:"modTime"`
+	DataBytes  int64             `json:"dataBytes"`
+	SourceSize int64             `json:"sourceSize"`
+}
+
+// A summary of a layer of a served file. Tiles are requested by their index among the disk tiles.
+type LayerSummary struct {
+	Name        string             `json:"name"`
+	Separated   bool               `json:"separated"`
+	Compression string             `json:"compression"`
+	Dimensions  []DimensionSummary `json:"dimensions"`
+	Fields      []FieldSummary     `json:"fields"`
+	DiskTiles   int                `json:"diskTiles"`
+	Tags        map[string]string  `json:"tags"`
+}
+
+type DimensionSummary struct {
+	Name     string `json:"name"`
+	Size     int    `json:"size"`
+	TileSize int    `json:"tileSize"`
+	Tiles    int    `json:"tiles"`
+}
+
+type FieldSummary struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// Returns an HTTP handler serving the directory:
+//
+//	GET /files                                       the names of the files, as a JSON array
+//	GET /files/{file}                                a FileSummary of the file, as JSON
+//	GET /files/{file}/layers/{layer}/tiles/{tile}    the decoded bytes of a disk tile of the layer at the given index
+//	GET /files/{file}/layers/{layer}/region          the samples of a region of the layer, see below
+//	GET /files/{file}/layers/{layer}/stats           the statistics of a field over a region, as a RegionStatsSummary
+//	GET /raw/{file}                                  the raw bytes of the file, supporting Range requests (see RawHandler)
+//
+// The region is given by the start and end query parameters as comma separated sample coordinates, with
+// the end exclusive, for example ?start=0,0&end=256,256. Its samples are sent as in a contiguous tile:
+// the first dimension varies fastest, and each sample has the bytes of its fields in order, in the byte
+// order of the file. Samples in tiles that were never written are zero. Regions with more samples than
+// allowed are read from an overview of the layer (one of the layers following it, for as long as each is
+// an overview of the one before, see edit.OverviewFactors), or by taking every few samples of the coarsest
+// overview, with response headers describing the samples actually sent:
+//
+//	X-Pixi-Layer        the index of the layer the samples were read from
+//	X-Pixi-Region       the start and end of the region read from that layer, as "x,y:x,y"
+//	X-Pixi-Stride       the step between samples read from that layer
+//	X-Pixi-Size         the number of samples sent along each dimension
+//	X-Pixi-Scale        the spacing of the samples sent, in samples of the requested layer
+//	X-Pixi-Resolution   the spacing of the samples sent in the units of each dimension, if the layer records them
+//
+// Statistics take the same start and end parameters, the name of the field in the field parameter (the
+// first field if not given), and mean=true to include the mean as well as the minimum and maximum. They
+// are computed as by read.LayerReadCache.RegionStats, so the tiles read are pruned by the tile ranges
+// recorded in the layer, if any; since the mean needs every sample, regions too large to send are
+// refused a mean.
+//
+// Summaries and tiles are sent with an ETag and Cache-Control header, and honor If-None-Match. Region
+// and statistics requests are guarded by a maximum number of samples and a per-client rate limit, set in
+// the options.
+func (d *Directory) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /files", d.serveFiles)
+	mux.HandleFunc("GET /files/{file}", d.serveSummary)
+	mux.HandleFunc("GET /files/{file}/layers/{layer}/tiles/{tile}", d.serveTile)
+	mux.HandleFunc("GET /files/{file}/layers/{layer}/region", d.serveRegion)
+	mux.HandleFunc("GET /files/{file}/layers/{layer}/stats", d.serveStats)
+	mux.Handle("GET /raw/", http.StripPrefix("/raw", d.authorizeRaw(RawHandler(d))))
+	return mux
+}
+
+func (d *Directory) serveFiles(w http.ResponseWriter, r *http.Request) {
+	if !d.authorize(w, Access{Request: r, Kind: AccessList, LayerIndex: -1, Tile: -1}) {
+		return
+	}
+	names, err := d.Files()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, names)
+}
+
+func (d *Directory) serveSummary(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("file")
+	if !d.authorize(w, Access{Request: r, Kind: AccessSummary, File: name, LayerIndex: -1, Tile: -1}) {
+		return
+	}
+	served, err := d.acquire(name)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer d.release(served)
+	body, err := json.Marshal(summarize(name, served))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if d.checkNotModified(w, r, contentETag(body)) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+func (d *Directory) serveTile(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("file")
+	if !d.authorize(w, Access{Request: r, Kind: AccessFile, File: name, LayerIndex: -1, Tile: -1}) {
+		return
+	}
+	served, err := d.acquire(name)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer d.release(served)
+
+	layerIndex, err := strconv.Atoi(r.PathValue("layer"))
+	if err != nil || layerIndex < 0 || layerIndex >= len(served.caches) {
+		http.Error(w, fmt.Sprintf("no layer %q", r.PathValue("layer")), http.StatusNotFound)
+		return
+	}
+	layer := served.summary.Layers[layerIndex]
+	tileIndex, err := strconv.Atoi(r.PathValue("tile"))
+	if err != nil || tileIndex < 0 || tileIndex >= layer.DiskTiles() {
+		http.Error(w, fmt.Sprintf("no tile %q", r.PathValue("tile")), http.StatusNotFound)
+		return
+	}
+	if layer.TileBytes[tileIndex] == 0 {
+		http.Error(w, fmt.Sprintf("tile %d has not been written", tileIndex), http.StatusNotFound)
+		return
+	}
+	start, end := layer.Dimensions.TileBounds(tileIndex % layer.Dimensions.Tiles())
+	access := Access{Request: r, Kind: AccessTile, File: name, Layer: layer.Name, LayerIndex: layerIndex, Tile: tileIndex, Start: start, End: end}
+	if !d.authorize(w, access) {
+		return
+	}
+
+	etag, err := served.tileETag(layerIndex, tileIndex)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if d.checkNotModified(w, r, etag) {
+		return
+	}
+
+	data, err := served.caches[layerIndex].Tile(tileIndex)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Write(data)
+}
+
+// Wraps the raw handler of the directory to run the Authorize hook for the file first.
+func (d *Directory) authorizeRaw(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+		if d.authorize(w, Access{Request: r, Kind: AccessRaw, File: name, LayerIndex: -1, Tile: -1}) {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+func summarize(name string, served *servedFile) FileSummary {
+	summary := served.summary
+	fileSum := FileSummary{
+		Name:       name,
+		Version:    summary.Header.Version,
+		Generation: summary.Generation(),
+		ByteOrder:  summary.Header.ByteOrder.String(),
+		Checksum:   summary.Header.Checksum.String(),
+		Tags:       collectTags(summary.Tags),
+		Layers:     make([]LayerSummary, len(summary.Layers)),
+		ModTime:    served.info.ModTime().UTC().Format(time.RFC3339Nano),
+		DataBytes:  summary.DiskDataBytes(),
+		SourceSize: served.info.Size(),
+	}
+	for i, layer := range summary.Layers {
+		layerSum := LayerSummary{
+			Name:        layer.Name,
+			Separated:   layer.Separated,
+			Compression: layer.Compression.String(),
+			DiskTiles:   layer.DiskTiles(),
+			Tags:        collectTags(layer.Tags),
+		}
+		for _, dim := range layer.Dimensions {
+			layerSum.Dimensions = append(layerSum.Dimensions, DimensionSummary{Name: dim.Name, Size: dim.Size, TileSize: dim.TileSize, Tiles: dim.Tiles()})
+		}
+		for _, field := range layer.Fields {
+			layerSum.Fields = append(layerSum.Fields, FieldSummary{Name: field.Name, Type: field.Type.String()})
+		}
+		fileSum.Layers[i] = layerSum
+	}
+	return fileSum
+}
+
+func collectTags(sections []*pixi.TagSection) map[string]string {
+	tags := map[string]string{}
+	for _, section := range sections {
+		for k, v := range section.All() {
+			tags[k] = v
+		}
+	}
+	return tags
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		http.Error(w, "not found", http.StatusNotFound)
+	case errors.As(err, new(pixi.FormatError)), errors.As(err, new(pixi.IntegrityError)):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,86 @@
+package serve
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// A token bucket rate limiter per client. Each client may make burst requests at once, and earns back
+// one more every 1/rate seconds. A limiter with a rate of zero or less allows everything.
+type limiter struct {
+	rate    float64
+	burst   float64
+	now     func() time.Time
+	lock    sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// The number of clients tracked before buckets that have refilled completely are discarded.
+const limiterPruneClients = 1024
+
+func newLimiter(rate float64, burst int) *limiter {
+	if burst <= 0 {
+		burst = max(1, int(math.Ceil(rate)))
+	}
+	return &limiter{rate: rate, burst: float64(burst), now: time.Now, buckets: make(map[string]*bucket)}
+}
+
+// Takes a token from the bucket of the client, reporting whether there was one.
+func (l *limiter) allow(client string) bool {
+	if l.rate <= 0 {
+		return true
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	now := l.now()
+	if len(l.buckets) >= limiterPruneClients {
+		l.prune(now)
+	}
+	b, found := l.buckets[client]
+	if !found {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[client] = b
+	}
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens -= 1
+	return true
+}
+
+// Discards the buckets of clients that have been idle long enough to have refilled, since a new bucket
+// would be the same.
+func (l *limiter) prune(now time.Time) {
+	for client, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, client)
+		}
+	}
+}
+
+// The number of seconds a client that was refused should wait before its next token, rounded up.
+func (l *limiter) retryAfter() int {
+	return max(1, int(math.Ceil(1/l.rate)))
+}
+
+// Identifies the client of a request for rate limiting, by the ClientKey option or else the remote host.
+func (d *Directory) clientKey(r *http.Request) string {
+	if d.options.ClientKey != nil {
+		return d.options.ClientKey(r)
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,150 @@
+package serve
+
+import (
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The raw bytes of a Pixi file stored somewhere that supports random access, such as a file, an object
+// in a cloud store read with ranged requests, or memory. A blob that also implements io.Closer is closed
+// once a response has been served from it.
+type Blob interface {
+	io.ReaderAt
+	Size() int64        // The total number of bytes in the blob.
+	ModTime() time.Time // When the blob was last modified, or the zero time if unknown.
+}
+
+// A collection of named blobs to serve raw Pixi bytes from.
+type BlobStore interface {
+	// Opens the blob with the given name, returning an error satisfying errors.Is(err, fs.ErrNotExist)
+	// if there is no such blob.
+	Open(name string) (Blob, error)
+}
+
+// Returns an HTTP handler serving the raw bytes of the blobs in the store at GET /{name}, where the
+// name may contain slashes. Responses advertise Accept-Ranges and answer Range requests with 206 Partial
+// Content (or 416 for unsatisfiable ranges), so remote readers can fetch exactly the headers and tiles they
+// need. HEAD requests report the size without any content, and If-Modified-Since and If-Range are honored
+// for blobs with a modification time.
+func RawHandler(store BlobStore) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+		blob, err := store.Open(name)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if closer, ok := blob.(io.Closer); ok {
+			defer closer.Close()
+		}
+		serveBlob(w, r, name, blob)
+	})
+}
+
+func serveBlob(w http.ResponseWriter, r *http.Request, name string, blob Blob) {
+	w.Header().Set("Content-Type", "application/octet-stream")
+	http.ServeContent(w, r, name, blob.ModTime(), io.NewSectionReader(blob, 0, blob.Size()))
+}
+
+// A BlobStore holding its blobs in memory, for tests and for files generated on the fly. Safe for
+// concurrent use; replacing a blob does not affect responses already being served from the old one.
+type MemoryStore struct {
+	lock  sync.RWMutex
+	blobs map[string]*memoryBlob
+}
+
+type memoryBlob struct {
+	data    []byte
+	modTime time.Time
+}
+
+func (b *memoryBlob) ReadAt(p []byte, off int64) (int, error) {
+	if off >= int64(len(b.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, b.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (b *memoryBlob) Size() int64 {
+	return int64(len(b.data))
+}
+
+func (b *memoryBlob) ModTime() time.Time {
+	return b.modTime
+}
+
+// Stores data under the given name, replacing any blob already stored under it. The store keeps the
+// slice, so it must not be modified afterwards.
+func (s *MemoryStore) Put(name string, data []byte, modTime time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.blobs == nil {
+		s.blobs = make(map[string]*memoryBlob)
+	}
+	s.blobs[name] = &memoryBlob{data: data, modTime: modTime}
+}
+
+// Removes the blob with the given name, if there is one.
+func (s *MemoryStore) Delete(name string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.blobs, name)
+}
+
+func (s *MemoryStore) Open(name string) (Blob, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	blob, found := s.blobs[name]
+	if !found {
+		return nil, fs.ErrNotExist
+	}
+	return blob, nil
+}
+
+// The bytes of a version of a served file, which stays readable while a response is served from it
+// even if the file is replaced meanwhile.
+type servedBlob struct {
+	dir    *Directory
+	served *servedFile
+}
+
+func (b servedBlob) ReadAt(p []byte, off int64) (int, error) {
+	return b.served.file.ReadAt(p, off)
+}
+
+func (b servedBlob) Size() int64 {
+	return b.served.info.Size()
+}
+
+func (b servedBlob) ModTime() time.Time {
+	return b.served.info.ModTime()
+}
+
+func (b servedBlob) Close() error {
+	b.dir.release(b.served)
+	return nil
+}
+
+// Opens the current version of a Pixi file in the directory for serving its raw bytes, making the
+// directory a BlobStore. The blob must be closed once it is no longer used.
+func (d *Directory) Open(name string) (Blob, error) {
+	served, err := d.acquire(name)
+	if err != nil {
+		return nil, err
+	}
+	return servedBlob{dir: d, served: served}, nil
+}
@@ -0,0 +1,95 @@
+package serve
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func rangeGet(t *testing.T, server *httptest.Server, method string, path string, byteRange string) (*http.Response, []byte) {
+	t.Helper()
+	req, err := http.NewRequest(method, server.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if byteRange != "" {
+		req.Header.Set("Range", byteRange)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, body
+}
+
+func TestRawHandlerRanges(t *testing.T) {
+	store := &MemoryStore{}
+	data := []byte("0123456789abcdef")
+	store.Put("mosaics/a.pixi", data, time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC))
+	server := httptest.NewServer(RawHandler(store))
+	defer server.Close()
+
+	resp, body := rangeGet(t, server, http.MethodGet, "/mosaics/a.pixi", "")
+	if resp.StatusCode != http.StatusOK || !slices.Equal(body, data) || resp.Header.Get("Accept-Ranges") != "bytes" {
+		t.Errorf("expected whole blob with Accept-Ranges, got %d %q %q", resp.StatusCode, body, resp.Header.Get("Accept-Ranges"))
+	}
+
+	resp, body = rangeGet(t, server, http.MethodGet, "/mosaics/a.pixi", "bytes=4-7")
+	if resp.StatusCode != http.StatusPartialContent || string(body) != "4567" || resp.Header.Get("Content-Range") != "bytes 4-7/16" {
+		t.Errorf("expected partial content 4567, got %d %q %q", resp.StatusCode, body, resp.Header.Get("Content-Range"))
+	}
+	resp, body = rangeGet(t, server, http.MethodGet, "/mosaics/a.pixi", "bytes=-3")
+	if resp.StatusCode != http.StatusPartialContent || string(body) != "def" {
+		t.Errorf("expected suffix range def, got %d %q", resp.StatusCode, body)
+	}
+	if resp, _ = rangeGet(t, server, http.MethodGet, "/mosaics/a.pixi", "bytes=20-30"); resp.StatusCode != http.StatusRequestedRangeNotSatisfiable {
+		t.Errorf("expected unsatisfiable range, got %d", resp.StatusCode)
+	}
+
+	resp, body = rangeGet(t, server, http.MethodHead, "/mosaics/a.pixi", "")
+	if resp.StatusCode != http.StatusOK || len(body) != 0 || resp.ContentLength != 16 {
+		t.Errorf("expected HEAD to report the size only, got %d %d %q", resp.StatusCode, resp.ContentLength, body)
+	}
+	if resp, _ = rangeGet(t, server, http.MethodGet, "/mosaics/b.pixi", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected missing blob to be not found, got %d", resp.StatusCode)
+	}
+	if resp, _ = rangeGet(t, server, http.MethodPost, "/mosaics/a.pixi", ""); resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("expected POST to be rejected, got %d", resp.StatusCode)
+	}
+}
+
+func TestDirectoryServesRawBytes(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "a.pixi")
+	writeServedFile(t, path, 0)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := NewDirectory(root, Options{})
+	defer dir.Close()
+	server := httptest.NewServer(dir.Handler())
+	defer server.Close()
+
+	resp, body := rangeGet(t, server, http.MethodGet, "/raw/a.pixi", "bytes=0-3")
+	if resp.StatusCode != http.StatusPartialContent || !slices.Equal(body, data[:4]) {
+		t.Errorf("expected the first bytes of the file, got %d %q", resp.StatusCode, body)
+	}
+	resp, body = rangeGet(t, server, http.MethodGet, "/raw/a.pixi", "")
+	if resp.StatusCode != http.StatusOK || !slices.Equal(body, data) {
+		t.Errorf("expected the whole file, got %d with %d bytes", resp.StatusCode, len(body))
+	}
+	if served := dir.files["a.pixi"]; served.users != 0 {
+		t.Errorf("expected raw responses to release the file, %d users left", served.users)
+	}
+}
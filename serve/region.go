@@ -0,0 +1,247 @@
+package serve
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/edit"
+)
+
+// The largest number of samples a single region request may read when the options do not say otherwise.
+const DefaultMaxRegionSamples = 1 << 22
+
+// Serves the samples of a region of a layer, as described for Handler.
+func (d *Directory) serveRegion(w http.ResponseWriter, r *http.Request) {
+	if !d.limiter.allow(d.clientKey(r)) {
+		w.Header().Set("Retry-After", strconv.Itoa(d.limiter.retryAfter()))
+		http.Error(w, "too many region requests", http.StatusTooManyRequests)
+		return
+	}
+
+	name := r.PathValue("file")
+	if !d.authorize(w, Access{Request: r, Kind: AccessFile, File: name, LayerIndex: -1, Tile: -1}) {
+		return
+	}
+	served, err := d.acquire(name)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer d.release(served)
+
+	layerIndex, err := strconv.Atoi(r.PathValue("layer"))
+	if err != nil || layerIndex < 0 || layerIndex >= len(served.caches) {
+		http.Error(w, fmt.Sprintf("no layer %q", r.PathValue("layer")), http.StatusNotFound)
+		return
+	}
+	layer := served.summary.Layers[layerIndex]
+	region, err := parseRegion(r.URL.Query().Get("start"), r.URL.Query().Get("end"), layer.Dimensions)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	samples := regionSamples(region)
+	access := Access{Request: r, Kind: AccessRegion, File: name, Layer: layer.Name, LayerIndex: layerIndex, Tile: -1, Start: region.Start, End: region.End}
+	if !d.authorize(w, access) {
+		return
+	}
+
+	plan := planRegion(served.summary.Layers, layerIndex, region, d.maxRegionSamples())
+	if d.options.RejectOversizeRegions && (plan.layerIndex != layerIndex || plan.stride > 1) {
+		http.Error(w, fmt.Sprintf("region of %d samples exceeds the limit of %d", samples, d.maxRegionSamples()), http.StatusBadRequest)
+		return
+	}
+	read := served.summary.Layers[plan.layerIndex]
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatInt(regionSamples(plan.output())*int64(read.SampleSize()), 10))
+	plan.setHeaders(w.Header(), layer)
+	out := bufio.NewWriter(w)
+	sample := make([]byte, read.SampleSize())
+	coord := make(pixi.SampleCoordinate, len(plan.size))
+	for outCoord := range plan.output().Coordinates() {
+		for i := range coord {
+			coord[i] = plan.region.Start[i] + outCoord[i]*plan.stride
+		}
+		err = readRegionSample(served, plan.layerIndex, coord, sample)
+		if err != nil {
+			// the status has been sent already, so all that can be done is to cut the response short
+			return
+		}
+		out.Write(sample)
+	}
+	out.Flush()
+}
+
+// How a region request is answered: the layer actually read, which may be an overview of the requested
+// layer, the region of that layer, and the stride between the samples read from it.
+type regionPlan struct {
+	layerIndex int
+	region     edit.Region
+	stride     int
+	scale      []int // The spacing of the samples sent, in samples of the requested layer, along each dimension.
+	size       []int // The number of samples sent along each dimension.
+}
+
+// The region of the response, in output samples.
+func (p regionPlan) output() edit.Region {
+	return edit.Region{Start: make(pixi.SampleCoordinate, len(p.size)), End: p.size}
+}
+
+// Describes the samples actually sent in the response headers listed for Handler.
+func (p regionPlan) setHeaders(h http.Header, requested *pixi.Layer) {
+	h.Set("X-Pixi-Layer", strconv.Itoa(p.layerIndex))
+	h.Set("X-Pixi-Region", joinInts(p.region.Start)+":"+joinInts(p.region.End))
+	h.Set("X-Pixi-Stride", strconv.Itoa(p.stride))
+	h.Set("X-Pixi-Size", joinInts(p.size))
+	h.Set("X-Pixi-Scale", joinInts(p.scale))
+	if requested.Dimensions.HasMetadata() {
+		resolutions := make([]string, len(p.scale))
+		for i, dim := range requested.Dimensions {
+			resolutions[i] = strconv.FormatFloat(dim.Resolution*float64(p.scale[i]), 'g', -1, 64)
+		}
+		h.Set("X-Pixi-Resolution", strings.Join(resolutions, ","))
+	}
+}
+
+// Chooses how to answer a request for a region of a layer within maxSamples. The region is read from the
+// requested layer if it fits; otherwise from the first of its overviews in which the covered region fits;
+// and otherwise from the coarsest overview, taking every stride-th sample along each dimension.
+func planRegion(layers []*pixi.Layer, layerIndex int, region edit.Region, maxSamples int64) regionPlan {
+	scale := make([]int, len(region.Start))
+	for i := range scale {
+		scale[i] = 1
+	}
+	plan := regionPlan{layerIndex: layerIndex, region: region, stride: 1, scale: scale, size: regionSize(region)}
+	for next := layerIndex + 1; maxSamples > 0 && regionSamples(plan.region) > maxSamples && next < len(layers); next++ {
+		factors, ok := edit.OverviewFactors(layers[next-1], layers[next])
+		if !ok {
+			break
+		}
+		overview := edit.Region{Start: make(pixi.SampleCoordinate, len(scale)), End: make(pixi.SampleCoordinate, len(scale))}
+		for i, factor := range factors {
+			scale[i] *= factor
+			overview.Start[i] = region.Start[i] / scale[i]
+			overview.End[i] = min((region.End[i]+scale[i]-1)/scale[i], layers[next].Dimensions[i].Size)
+		}
+		plan = regionPlan{layerIndex: next, region: overview, stride: 1, scale: slices.Clone(scale), size: regionSize(overview)}
+	}
+	for maxSamples > 0 && regionSamples(plan.output()) > maxSamples {
+		plan.stride += 1
+		for i := range plan.size {
+			length := plan.region.End[i] - plan.region.Start[i]
+			plan.size[i] = (length + plan.stride - 1) / plan.stride
+			plan.scale[i] = scale[i] * plan.stride
+		}
+	}
+	return plan
+}
+
+func regionSize(region edit.Region) []int {
+	size := make([]int, len(region.Start))
+	for i := range size {
+		size[i] = region.End[i] - region.Start[i]
+	}
+	return size
+}
+
+func joinInts(values []int) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = strconv.Itoa(v)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (d *Directory) maxRegionSamples() int64 {
+	switch {
+	case d.options.MaxRegionSamples == 0:
+		return DefaultMaxRegionSamples
+	case d.options.MaxRegionSamples < 0:
+		return 0
+	default:
+		return d.options.MaxRegionSamples
+	}
+}
+
+// Copies the raw bytes of the sample at the coordinate into sample, straight from the cached tiles.
+func readRegionSample(served *servedFile, layerIndex int, coord pixi.SampleCoordinate, sample []byte) error {
+	layer := served.summary.Layers[layerIndex]
+	cache := served.caches[layerIndex]
+	selector := coord.ToTileSelector(layer.Dimensions)
+	if !layer.Separated {
+		if layer.TileBytes[selector.Tile] == 0 {
+			clear(sample)
+			return nil
+		}
+		tile, err := cache.Tile(selector.Tile)
+		if err != nil {
+			return err
+		}
+		copy(sample, tile[selector.InTile*len(sample):])
+		return nil
+	}
+	offset := 0
+	for fieldIndex, field := range layer.Fields {
+		fieldSample := sample[offset : offset+field.Size()]
+		offset += field.Size()
+		tileIndex := selector.Tile + layer.Dimensions.Tiles()*fieldIndex
+		if layer.TileBytes[tileIndex] == 0 {
+			clear(fieldSample)
+			continue
+		}
+		tile, err := cache.Tile(tileIndex)
+		if err != nil {
+			return err
+		}
+		copy(fieldSample, tile[selector.InTile*field.Size():])
+	}
+	return nil
+}
+
+// Parses the bounds of a region from comma separated coordinates, checking they lie within the dimensions.
+func parseRegion(start string, end string, dims pixi.DimensionSet) (edit.Region, error) {
+	startCoord, err := parseCoordinate(start, len(dims))
+	if err != nil {
+		return edit.Region{}, fmt.Errorf("start: %w", err)
+	}
+	endCoord, err := parseCoordinate(end, len(dims))
+	if err != nil {
+		return edit.Region{}, fmt.Errorf("end: %w", err)
+	}
+	for i, dim := range dims {
+		if startCoord[i] < 0 || startCoord[i] >= endCoord[i] || endCoord[i] > dim.Size {
+			return edit.Region{}, fmt.Errorf("region must be non-empty and within the %d samples of dimension %d", dim.Size, i)
+		}
+	}
+	return edit.Region{Start: startCoord, End: endCoord}, nil
+}
+
+func parseCoordinate(text string, dims int) (pixi.SampleCoordinate, error) {
+	parts := strings.Split(text, ",")
+	if len(parts) != dims {
+		return nil, fmt.Errorf("expected %d comma separated coordinates, got %q", dims, text)
+	}
+	coord := make(pixi.SampleCoordinate, dims)
+	for i, part := range parts {
+		v, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return nil, err
+		}
+		coord[i] = v
+	}
+	return coord, nil
+}
+
+// The number of samples in a region.
+func regionSamples(region edit.Region) int64 {
+	samples := int64(1)
+	for i := range region.Start {
+		samples *= int64(region.End[i] - region.Start[i])
+	}
+	return samples
+}
@@ -0,0 +1,143 @@
+package serve
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/owlpinetech/pixi"
+	"github.com/owlpinetech/pixi/edit"
+)
+
+func TestRegionRequests(t *testing.T) {
+	root := t.TempDir()
+	writeServedFile(t, filepath.Join(root, "a.pixi"), 0)
+	dir := NewDirectory(root, Options{MaxRegionSamples: 6})
+	defer dir.Close()
+	server := httptest.NewServer(dir.Handler())
+	defer server.Close()
+
+	// x 1-3 and y 1-2 span all four tiles: sample indices 5, 6, 9, 10
+	status, body := get(t, server, "/files/a.pixi/layers/0/region?start=1,1&end=3,3")
+	if status != http.StatusOK || !slices.Equal(body, []byte{5, 0, 6, 0, 9, 0, 10, 0}) {
+		t.Errorf("expected region samples, got %d %v", status, body)
+	}
+
+	cases := []struct {
+		query  string
+		status int
+	}{
+		{"start=0,0&end=5,1", http.StatusBadRequest}, // outside the layer
+		{"start=2,2&end=2,3", http.StatusBadRequest}, // empty
+		{"start=0&end=1", http.StatusBadRequest},     // wrong number of dimensions
+		{"start=0,0&end=3,2", http.StatusOK},
+	}
+	for _, c := range cases {
+		if status, body := get(t, server, "/files/a.pixi/layers/0/region?"+c.query); status != c.status {
+			t.Errorf("expected %s to get %d, got %d %s", c.query, c.status, status, body)
+		}
+	}
+}
+
+func TestOversizeRegionRequests(t *testing.T) {
+	root := t.TempDir()
+	writeServedFile(t, filepath.Join(root, "a.pixi"), 0)
+	dir := NewDirectory(root, Options{MaxRegionSamples: 6})
+	defer dir.Close()
+	server := httptest.NewServer(dir.Handler())
+	defer server.Close()
+
+	// 12 samples without an overview to read instead: every second sample along each dimension
+	resp, err := http.Get(server.URL + "/files/a.pixi/layers/0/region?start=0,1&end=4,4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || !slices.Equal(body, []byte{4, 0, 6, 0, 12, 0, 14, 0}) {
+		t.Errorf("expected every second sample, got %d %v", resp.StatusCode, body)
+	}
+	for header, want := range map[string]string{"X-Pixi-Layer": "0", "X-Pixi-Region": "0,1:4,4", "X-Pixi-Stride": "2", "X-Pixi-Size": "2,2", "X-Pixi-Scale": "2,2"} {
+		if got := resp.Header.Get(header); got != want {
+			t.Errorf("expected %s %q, got %q", header, want, got)
+		}
+	}
+
+	strict := NewDirectory(root, Options{MaxRegionSamples: 6, RejectOversizeRegions: true})
+	defer strict.Close()
+	strictServer := httptest.NewServer(strict.Handler())
+	defer strictServer.Close()
+	if status, _ := get(t, strictServer, "/files/a.pixi/layers/0/region?start=0,1&end=4,4"); status != http.StatusBadRequest {
+		t.Errorf("expected oversize region to be rejected, got %d", status)
+	}
+}
+
+func TestPlanRegionPrefersOverviews(t *testing.T) {
+	fields := []pixi.Field{{Name: "v", Type: pixi.FieldUint8}}
+	layers := []*pixi.Layer{
+		pixi.NewLayer("base", false, pixi.CompressionNone, pixi.DimensionSet{{Name: "x", Size: 100, TileSize: 10}, {Name: "y", Size: 60, TileSize: 10}}, fields),
+		pixi.NewLayer("half", false, pixi.CompressionNone, pixi.DimensionSet{{Name: "x", Size: 50, TileSize: 10}, {Name: "y", Size: 30, TileSize: 10}}, fields),
+		pixi.NewLayer("quarter", false, pixi.CompressionNone, pixi.DimensionSet{{Name: "x", Size: 25, TileSize: 5}, {Name: "y", Size: 15, TileSize: 5}}, fields),
+		pixi.NewLayer("mask", false, pixi.CompressionNone, pixi.DimensionSet{{Name: "x", Size: 100, TileSize: 10}, {Name: "y", Size: 60, TileSize: 10}}, fields),
+	}
+	region := edit.Region{Start: pixi.SampleCoordinate{10, 10}, End: pixi.SampleCoordinate{51, 30}}
+
+	plan := planRegion(layers, 0, region, 1000)
+	if plan.layerIndex != 0 || plan.stride != 1 {
+		t.Errorf("expected a region within the limit to be read as is, got %+v", plan)
+	}
+	plan = planRegion(layers, 0, region, 300)
+	if plan.layerIndex != 1 || plan.stride != 1 || !slices.Equal(plan.region.Start, pixi.SampleCoordinate{5, 5}) ||
+		!slices.Equal(plan.region.End, pixi.SampleCoordinate{26, 15}) || !slices.Equal(plan.scale, []int{2, 2}) {
+		t.Errorf("expected the region to be read from the half overview, got %+v", plan)
+	}
+	plan = planRegion(layers, 0, region, 20)
+	if plan.layerIndex != 2 || plan.stride != 2 || !slices.Equal(plan.size, []int{6, 3}) || !slices.Equal(plan.scale, []int{8, 8}) {
+		t.Errorf("expected the coarsest overview to be strided, got %+v", plan)
+	}
+	plan = planRegion(layers, 3, region, 300)
+	if plan.layerIndex != 3 || plan.stride != 2 {
+		t.Errorf("expected a layer without overviews to be strided, got %+v", plan)
+	}
+}
+
+func TestRegionRateLimit(t *testing.T) {
+	root := t.TempDir()
+	writeServedFile(t, filepath.Join(root, "a.pixi"), 0)
+	dir := NewDirectory(root, Options{RateLimit: 0.5, RateBurst: 2})
+	defer dir.Close()
+	now := time.Now()
+	dir.limiter.now = func() time.Time { return now }
+	server := httptest.NewServer(dir.Handler())
+	defer server.Close()
+
+	region := "/files/a.pixi/layers/0/region?start=0,0&end=1,1"
+	for i := range 2 {
+		if status, _ := get(t, server, region); status != http.StatusOK {
+			t.Fatalf("expected request %d within the burst to succeed, got %d", i, status)
+		}
+	}
+	resp := conditionalGet(t, server, region, "")
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") != strconv.Itoa(2) {
+		t.Errorf("expected request over the burst to be refused with Retry-After 2, got %d %q", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+	if status, _ := get(t, server, "/files/a.pixi/layers/0/tiles/0"); status != http.StatusOK {
+		t.Errorf("expected tile requests not to be rate limited, got %d", status)
+	}
+
+	now = now.Add(2 * time.Second)
+	if status, _ := get(t, server, region); status != http.StatusOK {
+		t.Errorf("expected a request to succeed once a token is earned back, got %d", status)
+	}
+	if status, _ := get(t, server, region); status != http.StatusTooManyRequests {
+		t.Errorf("expected only one token to be earned back, got %d", status)
+	}
+}
@@ -0,0 +1,87 @@
+package serve
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// The statistics of a field over a region of a layer, as returned for /files/{file}/layers/{layer}/stats.
+type RegionStatsSummary struct {
+	Field        string   `json:"field"`
+	Min          any      `json:"min"`
+	Max          any      `json:"max"`
+	Mean         *float64 `json:"mean,omitempty"`
+	Count        int      `json:"count,omitempty"`
+	TilesRead    int      `json:"tilesRead"`
+	TilesSkipped int      `json:"tilesSkipped"`
+}
+
+// Serves the statistics of a field over a region of a layer, as described for Handler.
+func (d *Directory) serveStats(w http.ResponseWriter, r *http.Request) {
+	if !d.limiter.allow(d.clientKey(r)) {
+		w.Header().Set("Retry-After", strconv.Itoa(d.limiter.retryAfter()))
+		http.Error(w, "too many region requests", http.StatusTooManyRequests)
+		return
+	}
+
+	name := r.PathValue("file")
+	if !d.authorize(w, Access{Request: r, Kind: AccessFile, File: name, LayerIndex: -1, Tile: -1}) {
+		return
+	}
+	served, err := d.acquire(name)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer d.release(served)
+
+	layerIndex, err := strconv.Atoi(r.PathValue("layer"))
+	if err != nil || layerIndex < 0 || layerIndex >= len(served.caches) {
+		http.Error(w, fmt.Sprintf("no layer %q", r.PathValue("layer")), http.StatusNotFound)
+		return
+	}
+	layer := served.summary.Layers[layerIndex]
+	query := r.URL.Query()
+	fieldIndex := 0
+	if fieldName := query.Get("field"); fieldName != "" {
+		found := false
+		fieldIndex, found = layer.Fields.ByName(fieldName)
+		if !found {
+			http.Error(w, fmt.Sprintf("no field %q", fieldName), http.StatusBadRequest)
+			return
+		}
+	}
+	region, err := parseRegion(query.Get("start"), query.Get("end"), layer.Dimensions)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	mean := query.Get("mean") == "true"
+	if mean && d.maxRegionSamples() > 0 && regionSamples(region) > d.maxRegionSamples() {
+		http.Error(w, fmt.Sprintf("mean of %d samples exceeds the limit of %d", regionSamples(region), d.maxRegionSamples()), http.StatusBadRequest)
+		return
+	}
+	access := Access{Request: r, Kind: AccessStats, File: name, Layer: layer.Name, LayerIndex: layerIndex, Tile: -1, Start: region.Start, End: region.End}
+	if !d.authorize(w, access) {
+		return
+	}
+
+	stats, err := served.caches[layerIndex].RegionStats(fieldIndex, region.Start, region.End, mean)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	summary := RegionStatsSummary{
+		Field:        layer.Fields[fieldIndex].Name,
+		Min:          stats.Min,
+		Max:          stats.Max,
+		Count:        stats.Count,
+		TilesRead:    stats.TilesRead,
+		TilesSkipped: stats.TilesSkipped,
+	}
+	if mean && stats.Count > 0 {
+		summary.Mean = &stats.Mean
+	}
+	writeJSON(w, summary)
+}
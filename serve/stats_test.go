@@ -0,0 +1,46 @@
+package serve
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestStatsRequests(t *testing.T) {
+	root := t.TempDir()
+	writeServedFile(t, filepath.Join(root, "a.pixi"), 0)
+	dir := NewDirectory(root, Options{MaxRegionSamples: 6})
+	defer dir.Close()
+	server := httptest.NewServer(dir.Handler())
+	defer server.Close()
+
+	// x 1-3 and y 1-2 span all four tiles: sample indices 5, 6, 9, 10
+	status, body := get(t, server, "/files/a.pixi/layers/0/stats?field=v&start=1,1&end=3,3&mean=true")
+	if status != http.StatusOK {
+		t.Fatalf("expected statistics, got %d %s", status, body)
+	}
+	var summary RegionStatsSummary
+	if err := json.Unmarshal(body, &summary); err != nil {
+		t.Fatal(err)
+	}
+	if summary.Field != "v" || summary.Min != float64(5) || summary.Max != float64(10) || summary.Mean == nil || *summary.Mean != 7.5 || summary.Count != 4 {
+		t.Errorf("unexpected statistics %s", body)
+	}
+
+	cases := []struct {
+		query  string
+		status int
+	}{
+		{"start=0,0&end=4,4", http.StatusOK},                       // no mean, so not limited
+		{"start=0,0&end=4,4&mean=true", http.StatusBadRequest},     // mean of too many samples
+		{"field=missing&start=0,0&end=1,1", http.StatusBadRequest}, // unknown field
+		{"start=2,2&end=2,3", http.StatusBadRequest},               // empty
+	}
+	for _, c := range cases {
+		if status, body := get(t, server, "/files/a.pixi/layers/0/stats?"+c.query); status != c.status {
+			t.Errorf("expected %s to get %d, got %d %s", c.query, c.status, status, body)
+		}
+	}
+}
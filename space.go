@@ -0,0 +1,107 @@
+package pixi
+
+import (
+	"cmp"
+	"io"
+	"slices"
+)
+
+// How the bytes of a file are used, as found by Pixi.SpaceReport. Every byte of the file is counted in
+// exactly one of the categories, so they add up to FileBytes.
+type SpaceReport struct {
+	FileBytes        int64 // The size of the file.
+	HeaderBytes      int64 // The file header.
+	TagBytes         int64 // The tag sections of the file and of its layers.
+	LayerHeaderBytes int64 // The headers of the layers.
+	TileBytes        int64 // The encoded data and checksums of the tiles the layers point to.
+	PaddingBytes     int64 // Bytes skipped so that tiles of aligned layers start on their alignment.
+	DeadBytes        int64 // Bytes nothing points to, such as superseded tiles and tag sections.
+}
+
+// The fraction of the file that is dead, between 0 and 1.
+func (s SpaceReport) DeadFraction() float64 {
+	if s.FileBytes == 0 {
+		return 0
+	}
+	return float64(s.DeadBytes) / float64(s.FileBytes)
+}
+
+// A span of bytes in a file that is reachable from its header.
+type liveSpan struct {
+	start, end int64
+	counter    *int64 // the category of the SpaceReport the span is counted in
+	alignment  int    // for tiles, the tile alignment of their layer
+}
+
+// Attributes every byte of the file backing this summary to the header, tags, layer headers, live tiles,
+// alignment padding, or dead space that nothing points to, to help decide whether a file is worth
+// compacting (see edit.Compact) or recompressing. The tag sections of the file and its layers are read
+// from r to find their sizes; tiles are not read. Bytes pointed to more than once are counted once.
+func (d *Pixi) SpaceReport(r io.ReadSeeker) (SpaceReport, error) {
+	report := SpaceReport{}
+	fileSize, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return report, err
+	}
+	report.FileBytes = fileSize
+
+	spans := []liveSpan{{start: 0, end: int64(d.Header.HeaderSize()), counter: &report.HeaderBytes}}
+	addTags := func(firstOffset int64) error {
+		chain, err := readTagChain(r, d.Header, firstOffset)
+		if err != nil {
+			return err
+		}
+		for _, tags := range chain {
+			spans = append(spans, liveSpan{start: tags.offset, end: tags.end, counter: &report.TagBytes})
+		}
+		return nil
+	}
+	err = addTags(d.Header.FirstTagsOffset)
+	if err != nil {
+		return report, err
+	}
+	checksumSize := int64(d.Header.Checksum.Size())
+	for _, layer := range d.AllLayers() {
+		offset := d.LayerOffset(layer)
+		spans = append(spans, liveSpan{start: offset, end: offset + int64(layer.HeaderSize(d.Header)), counter: &report.LayerHeaderBytes})
+		for tileIndex, tileOffset := range layer.TileOffsets {
+			if layer.TileBytes[tileIndex] == 0 {
+				continue
+			}
+			spans = append(spans, liveSpan{
+				start:     tileOffset,
+				end:       tileOffset + layer.TileBytes[tileIndex] + checksumSize,
+				counter:   &report.TileBytes,
+				alignment: layer.TileAlignment,
+			})
+		}
+		err = addTags(layer.TagsStart)
+		if err != nil {
+			return report, err
+		}
+	}
+
+	slices.SortFunc(spans, func(a, b liveSpan) int {
+		return cmp.Compare(a.start, b.start)
+	})
+	covered := int64(0)
+	for _, span := range spans {
+		start, end := min(max(span.start, covered), fileSize), min(span.end, fileSize)
+		if gap := start - covered; gap > 0 {
+			if span.alignment > 0 && gap < int64(span.alignment) && start%int64(span.alignment) == 0 {
+				report.PaddingBytes += gap
+			} else {
+				report.DeadBytes += gap
+			}
+		}
+		covered = start
+		if end > start {
+			*span.counter += end - start
+			covered = end
+		}
+	}
+	if covered < fileSize {
+		report.DeadBytes += fileSize - covered
+	}
+	return report, nil
+}
@@ -0,0 +1,80 @@
+package pixi
+
+import (
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/owlpinetech/pixi/internal/buffer"
+)
+
+func TestSpaceReport(t *testing.T) {
+	for _, alignment := range []int{0, 64} {
+		header := PixiHeader{Version: Version, OffsetSize: 4, ByteOrder: binary.LittleEndian, Checksum: ChecksumXxHash64}
+		layer := NewLayer("dem", false, CompressionFlate,
+			DimensionSet{{Name: "x", Size: 8, TileSize: 4}, {Name: "y", Size: 8, TileSize: 4}},
+			[]Field{{Name: "height", Type: FieldInt16}})
+		layer.TileAlignment = alignment
+		buf := buffer.NewBuffer(10)
+		writeSingleLayerPixi(t, buf, header, map[string]string{"a": "b"}, layer, randomTiles(layer))
+
+		report := spaceReport(t, buf)
+		liveTiles := int64(0)
+		for _, bytes := range layer.TileBytes {
+			liveTiles += bytes + int64(header.Checksum.Size())
+		}
+		if report.FileBytes != int64(len(buf.Bytes())) || report.HeaderBytes != int64(header.HeaderSize()) ||
+			report.LayerHeaderBytes != int64(layer.HeaderSize(header)) || report.TileBytes != liveTiles || report.DeadBytes != 0 {
+			t.Errorf("alignment %d: unexpected report for a freshly written file %+v", alignment, report)
+		}
+		if (report.PaddingBytes > 0) != (alignment > 0) {
+			t.Errorf("alignment %d: unexpected padding %d", alignment, report.PaddingBytes)
+		}
+		checkTotal(t, report)
+
+		// superseding tile 0 with a copy at the end of the file leaves the original dead
+		oldTile := layer.TileBytes[0] + int64(header.Checksum.Size())
+		data := make([]byte, layer.DiskTileSize(0))
+		if err := layer.ReadTile(buf, header, 0, data); err != nil {
+			t.Fatal(err)
+		}
+		buf.Seek(0, io.SeekEnd)
+		if err := layer.WriteTile(buf, header, 0, data); err != nil {
+			t.Fatal(err)
+		}
+		summary, err := ReadPixi(buffer.NewBufferFrom(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := layer.OverwriteHeader(buf, header, summary.Header.FirstLayerOffset); err != nil {
+			t.Fatal(err)
+		}
+		edited := spaceReport(t, buf)
+		if edited.DeadBytes < oldTile || edited.TileBytes != report.TileBytes {
+			t.Errorf("alignment %d: expected the %d bytes of the old tile to be dead, got %+v", alignment, oldTile, edited)
+		}
+		checkTotal(t, edited)
+	}
+}
+
+func spaceReport(t *testing.T, buf *buffer.Buffer) SpaceReport {
+	t.Helper()
+	rdr := buffer.NewBufferFrom(buf.Bytes())
+	summary, err := ReadPixi(rdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := summary.SpaceReport(rdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return report
+}
+
+func checkTotal(t *testing.T, report SpaceReport) {
+	t.Helper()
+	total := report.HeaderBytes + report.TagBytes + report.LayerHeaderBytes + report.TileBytes + report.PaddingBytes + report.DeadBytes
+	if total != report.FileBytes {
+		t.Errorf("categories add up to %d bytes of a %d byte file: %+v", total, report.FileBytes, report)
+	}
+}
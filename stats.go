@@ -0,0 +1,155 @@
+package pixi
+
+import (
+	"cmp"
+	"math"
+)
+
+// Determines how floating point NaN values are treated when comparing values or tracking
+// statistics such as the minimum and maximum of a field.
+type NaNPolicy int
+
+const (
+	NaNIgnore    NaNPolicy = 0 // NaN values are skipped, leaving statistics as if they were never seen.
+	NaNPropagate NaNPolicy = 1 // A single NaN value causes the tracked statistics to become NaN.
+)
+
+// Reports whether the given value of this field type is a floating point NaN. Always false
+// for integer field types.
+func (f FieldType) IsNaN(val any) bool {
+	switch f {
+	case FieldFloat32:
+		v := val.(float32)
+		return v != v
+	case FieldFloat64:
+		return math.IsNaN(val.(float64))
+	default:
+		return false
+	}
+}
+
+// Reports whether the given value of this field type is a positive or negative floating
+// point infinity. Always false for integer field types.
+func (f FieldType) IsInf(val any) bool {
+	switch f {
+	case FieldFloat32:
+		return math.IsInf(float64(val.(float32)), 0)
+	case FieldFloat64:
+		return math.IsInf(val.(float64), 0)
+	default:
+		return false
+	}
+}
+
+// Compares two values of this field type, returning -1 if a is less than b, 0 if they are
+// equal, and +1 if a is greater than b. Values are compared in their native type, so large
+// 64-bit integers do not lose precision. For floating point types, NaN is considered less
+// than any other value (including negative infinity) and equal to other NaN values, which
+// gives a total order suitable for sorting.
+func (f FieldType) CompareValues(a, b any) int {
+	switch f {
+	case FieldInt8:
+		return cmp.Compare(a.(int8), b.(int8))
+	case FieldUint8:
+		return cmp.Compare(a.(uint8), b.(uint8))
+	case FieldInt16:
+		return cmp.Compare(a.(int16), b.(int16))
+	case FieldUint16:
+		return cmp.Compare(a.(uint16), b.(uint16))
+	case FieldInt32:
+		return cmp.Compare(a.(int32), b.(int32))
+	case FieldUint32:
+		return cmp.Compare(a.(uint32), b.(uint32))
+	case FieldInt64:
+		return cmp.Compare(a.(int64), b.(int64))
+	case FieldUint64:
+		return cmp.Compare(a.(uint64), b.(uint64))
+	case FieldFloat32:
+		return cmp.Compare(a.(float32), b.(float32))
+	case FieldFloat64:
+		return cmp.Compare(a.(float64), b.(float64))
+	default:
+		panic("pixi: tried to compare unsupported field type")
+	}
+}
+
+// Tracks the minimum and maximum of a stream of values of a single field type, with deliberate
+// handling of NaN and infinite values so that a single bad sample does not silently poison
+// the statistics.
+type MinMax struct {
+	Type       FieldType // The type of the values being tracked.
+	NaN        NaNPolicy // How NaN values affect the tracked minimum and maximum.
+	IgnoreInf  bool      // If true, positive and negative infinities are skipped like ignored NaNs.
+	Min        any       // The smallest value seen so far, nil if no values have been counted.
+	Max        any       // The largest value seen so far, nil if no values have been counted.
+	Count      int       // The number of values that contributed to Min and Max.
+	NaNCount   int       // The number of NaN values seen, regardless of policy.
+	InfCount   int       // The number of infinite values seen, regardless of IgnoreInf.
+	propagated bool
+}
+
+// Creates a new minimum and maximum tracker for values of the given type.
+func NewMinMax(fieldType FieldType, policy NaNPolicy) *MinMax {
+	return &MinMax{Type: fieldType, NaN: policy}
+}
+
+// Incorporates the given value into the tracked minimum and maximum. The value must be of
+// the Go type corresponding to the tracker's field type.
+func (m *MinMax) Update(val any) {
+	if m.Type.IsNaN(val) {
+		m.NaNCount += 1
+		if m.NaN == NaNPropagate {
+			m.propagated = true
+			m.Min = val
+			m.Max = val
+		}
+		return
+	}
+	if m.Type.IsInf(val) {
+		m.InfCount += 1
+		if m.IgnoreInf {
+			return
+		}
+	}
+	m.Count += 1
+	if m.propagated {
+		return
+	}
+	if m.Min == nil || m.Type.CompareValues(val, m.Min) < 0 {
+		m.Min = val
+	}
+	if m.Max == nil || m.Type.CompareValues(val, m.Max) > 0 {
+		m.Max = val
+	}
+}
+
+// Incorporates the minimum and maximum from another tracker of the same field type into
+// this one, as if every value seen by the other tracker had been seen by this one.
+func (m *MinMax) Merge(other *MinMax) {
+	m.NaNCount += other.NaNCount
+	m.InfCount += other.InfCount
+	m.Count += other.Count
+	if other.propagated {
+		// the other tracker no longer knows its finite extremes, so nothing else can be merged
+		if m.NaN == NaNPropagate {
+			m.propagated = true
+			m.Min = other.Min
+			m.Max = other.Max
+		}
+		return
+	}
+	if m.propagated {
+		return
+	}
+	if other.Min != nil && (m.Min == nil || m.Type.CompareValues(other.Min, m.Min) < 0) {
+		m.Min = other.Min
+	}
+	if other.Max != nil && (m.Max == nil || m.Type.CompareValues(other.Max, m.Max) > 0) {
+		m.Max = other.Max
+	}
+}
+
+// Reports whether the tracked statistics have been poisoned by a NaN under the propagate policy.
+func (m *MinMax) IsNaN() bool {
+	return m.propagated
+}
@@ -0,0 +1,103 @@
+package pixi
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFieldTypeCompareValues(t *testing.T) {
+	tests := []struct {
+		name      string
+		fieldType FieldType
+		a         any
+		b         any
+		want      int
+	}{
+		{"int8 less", FieldInt8, int8(-5), int8(3), -1},
+		{"uint64 large", FieldUint64, uint64(math.MaxUint64), uint64(math.MaxUint64 - 1), 1},
+		{"int64 equal", FieldInt64, int64(math.MinInt64), int64(math.MinInt64), 0},
+		{"float32 inf", FieldFloat32, float32(math.Inf(1)), float32(1e30), 1},
+		{"float64 neg inf", FieldFloat64, math.Inf(-1), -1e300, -1},
+		{"float64 nan less than neg inf", FieldFloat64, math.NaN(), math.Inf(-1), -1},
+		{"float32 nan equal nan", FieldFloat32, float32(math.NaN()), float32(math.NaN()), 0},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.fieldType.CompareValues(tc.a, tc.b); got != tc.want {
+				t.Errorf("CompareValues(%v, %v) = %d, want %d", tc.a, tc.b, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMinMaxNaNIgnore(t *testing.T) {
+	mm := NewMinMax(FieldFloat64, NaNIgnore)
+	for _, v := range []float64{3, math.NaN(), -2, 10, math.NaN()} {
+		mm.Update(v)
+	}
+	if mm.Min != -2.0 || mm.Max != 10.0 {
+		t.Errorf("expected min -2 and max 10, got %v and %v", mm.Min, mm.Max)
+	}
+	if mm.Count != 3 || mm.NaNCount != 2 {
+		t.Errorf("expected 3 counted and 2 NaN, got %d and %d", mm.Count, mm.NaNCount)
+	}
+	if mm.IsNaN() {
+		t.Error("expected ignored NaNs not to poison statistics")
+	}
+}
+
+func TestMinMaxNaNPropagate(t *testing.T) {
+	mm := NewMinMax(FieldFloat32, NaNPropagate)
+	for _, v := range []float32{3, float32(math.NaN()), -2, 10} {
+		mm.Update(v)
+	}
+	if !mm.IsNaN() {
+		t.Fatal("expected propagated NaN")
+	}
+	if !FieldFloat32.IsNaN(mm.Min) || !FieldFloat32.IsNaN(mm.Max) {
+		t.Errorf("expected NaN min and max, got %v and %v", mm.Min, mm.Max)
+	}
+}
+
+func TestMinMaxIgnoreInf(t *testing.T) {
+	mm := NewMinMax(FieldFloat64, NaNIgnore)
+	mm.IgnoreInf = true
+	for _, v := range []float64{math.Inf(-1), 4, math.Inf(1), 1} {
+		mm.Update(v)
+	}
+	if mm.Min != 1.0 || mm.Max != 4.0 || mm.InfCount != 2 {
+		t.Errorf("expected min 1, max 4, 2 infinities, got %v, %v, %d", mm.Min, mm.Max, mm.InfCount)
+	}
+
+	mm = NewMinMax(FieldFloat64, NaNIgnore)
+	for _, v := range []float64{math.Inf(-1), 4, math.Inf(1), 1} {
+		mm.Update(v)
+	}
+	if !math.IsInf(mm.Min.(float64), -1) || !math.IsInf(mm.Max.(float64), 1) {
+		t.Errorf("expected infinite min and max, got %v and %v", mm.Min, mm.Max)
+	}
+}
+
+func TestMinMaxMerge(t *testing.T) {
+	a := NewMinMax(FieldInt16, NaNIgnore)
+	b := NewMinMax(FieldInt16, NaNIgnore)
+	for _, v := range []int16{5, 2, 9} {
+		a.Update(v)
+	}
+	for _, v := range []int16{-4, 7} {
+		b.Update(v)
+	}
+	a.Merge(b)
+	if a.Min != int16(-4) || a.Max != int16(9) || a.Count != 5 {
+		t.Errorf("unexpected merged stats: %v, %v, %d", a.Min, a.Max, a.Count)
+	}
+
+	nanTracker := NewMinMax(FieldFloat64, NaNPropagate)
+	nanTracker.Update(math.NaN())
+	ignoring := NewMinMax(FieldFloat64, NaNIgnore)
+	ignoring.Update(1.0)
+	ignoring.Merge(nanTracker)
+	if ignoring.Min != 1.0 || ignoring.Max != 1.0 {
+		t.Errorf("expected NaN from propagating tracker to be ignored, got %v and %v", ignoring.Min, ignoring.Max)
+	}
+}
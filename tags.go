@@ -1,31 +1,219 @@
 package pixi
 
-import "io"
+import (
+	"io"
+	"iter"
+	"math"
+	"slices"
+)
+
+// Set in the tag count of a tag section when the section is stored in the extended layout, in which
+// each tag records whether it is a string or binary payload and has a length prefix of the header's
+// offset size rather than two bytes. Sections are only stored in the extended layout when they need it,
+// and the extended layout requires version 2 or later.
+const tagFlagExtended uint32 = 1 << 31
+
+const (
+	tagKindString uint8 = 0
+	tagKindBinary uint8 = 1
+)
 
 // Pixi files can contain zero or more tag sections, used for extraneous non-data related metadata
 // to help describe the file or indicate context of the file's ownership and lifespan. While the tags
 // are conceptually just a flat list of string pairs, the layout in the file is done in sections with
 // offsets pointing to further sections, allowing easier 'appending' of additional tags regardless of
-// where in the file previous tags are stored.
+// where in the file previous tags are stored. Besides strings, tags can hold arbitrary binary payloads
+// such as embedded thumbnails, and neither kind is limited to the 65535 bytes of a friendly string.
 type TagSection struct {
-	Tags          map[string]string // The tags for this section.
+	Tags          map[string]string // The string tags for this section.
+	Binary        map[string][]byte // The binary tags for this section. A key must not be both a string and a binary tag.
+	Order         []string          // The keys of Tags and Binary in the order they are stored. Keys missing from Order are stored after those in it, sorted.
 	NextTagsStart int64             // A byte-index offset from the start of the file pointing to the next tag section. 0 if this is the last tag section.
 }
 
+type tagEntry struct {
+	key      string
+	value    string
+	payload  []byte
+	isBinary bool
+}
+
+// Sets the value of a string tag, adding the key to the end of the section's order if it is new.
+func (t *TagSection) Set(key string, value string) {
+	if t.Tags == nil {
+		t.Tags = make(map[string]string)
+	}
+	if !t.has(key) {
+		t.Order = append(t.Order, key)
+	}
+	delete(t.Binary, key)
+	t.Tags[key] = value
+}
+
+// Sets the value of a binary tag, adding the key to the end of the section's order if it is new.
+func (t *TagSection) SetBinary(key string, payload []byte) {
+	if t.Binary == nil {
+		t.Binary = make(map[string][]byte)
+	}
+	if !t.has(key) {
+		t.Order = append(t.Order, key)
+	}
+	delete(t.Tags, key)
+	t.Binary[key] = payload
+}
+
+// Copies every tag of the other section into this one, in the other section's order, replacing the
+// values of keys that are already present. Extension sections (see Extension) are merged by ID rather than
+// replaced as a whole.
+func (t *TagSection) Merge(other *TagSection) {
+	for entry := range other.entries() {
+		if entry.isBinary && entry.key == ExtensionsTag && t.has(ExtensionsTag) {
+			t.mergeExtensions(entry.payload)
+		} else if entry.isBinary {
+			t.SetBinary(entry.key, entry.payload)
+		} else {
+			t.Set(entry.key, entry.value)
+		}
+	}
+}
+
+func (t *TagSection) has(key string) bool {
+	_, isString := t.Tags[key]
+	_, isBinary := t.Binary[key]
+	return isString || isBinary
+}
+
+// Iterates over the string tags of the section in the order they are stored: first the keys listed
+// in Order, then any other keys of Tags in sorted order. Keys in Order that are not in Tags are skipped.
+func (t *TagSection) All() iter.Seq2[string, string] {
+	return func(yield func(string, string) bool) {
+		for entry := range t.entries() {
+			if !entry.isBinary && !yield(entry.key, entry.value) {
+				return
+			}
+		}
+	}
+}
+
+// Iterates over the binary tags of the section in the order they are stored, as with All.
+func (t *TagSection) AllBinary() iter.Seq2[string, []byte] {
+	return func(yield func(string, []byte) bool) {
+		for entry := range t.entries() {
+			if entry.isBinary && !yield(entry.key, entry.payload) {
+				return
+			}
+		}
+	}
+}
+
+// Iterates over every tag in the order they are stored: the keys in Order, then the remaining string
+// tags sorted by key, then the remaining binary tags sorted by key.
+func (t *TagSection) entries() iter.Seq[tagEntry] {
+	return func(yield func(tagEntry) bool) {
+		ordered := make(map[string]bool, len(t.Order))
+		for _, k := range t.Order {
+			if ordered[k] {
+				continue
+			}
+			if v, ok := t.Tags[k]; ok {
+				ordered[k] = true
+				if !yield(tagEntry{key: k, value: v}) {
+					return
+				}
+			} else if p, ok := t.Binary[k]; ok {
+				ordered[k] = true
+				if !yield(tagEntry{key: k, payload: p, isBinary: true}) {
+					return
+				}
+			}
+		}
+		if len(ordered) == len(t.Tags)+len(t.Binary) {
+			return
+		}
+		rest := make([]string, 0, len(t.Tags))
+		for k := range t.Tags {
+			if !ordered[k] {
+				rest = append(rest, k)
+			}
+		}
+		slices.Sort(rest)
+		for _, k := range rest {
+			if !yield(tagEntry{key: k, value: t.Tags[k]}) {
+				return
+			}
+		}
+		rest = rest[:0]
+		for k := range t.Binary {
+			if !ordered[k] {
+				rest = append(rest, k)
+			}
+		}
+		slices.Sort(rest)
+		for _, k := range rest {
+			if !yield(tagEntry{key: k, payload: t.Binary[k], isBinary: true}) {
+				return
+			}
+		}
+	}
+}
+
+// Reports whether the section must be stored in the extended layout, because it has binary tags or
+// string values too long for a friendly string.
+func (t *TagSection) extended() bool {
+	if len(t.Binary) > 0 {
+		return true
+	}
+	for _, v := range t.Tags {
+		if len(v) > math.MaxUint16 {
+			return true
+		}
+	}
+	return false
+}
+
 // Writes the tag section in binary to the given stream, according to the specification
-// in the Pixi header h.
+// in the Pixi header h. Tags are written in the order given by Order, so writing the same
+// tags always produces the same bytes.
 func (t *TagSection) Write(w io.Writer, h PixiHeader) error {
+	extended := t.extended()
+	if extended && h.Version < 2 {
+		return FormatError("binary tags and tag values longer than 65535 bytes require version 2 or later")
+	}
+
 	// write number of tags, then each key-value pair for tags
-	err := h.Write(w, uint32(len(t.Tags)))
+	count := uint32(len(t.Tags) + len(t.Binary))
+	if extended {
+		count |= tagFlagExtended
+	}
+	err := h.Write(w, count)
 	if err != nil {
 		return err
 	}
-	for k, v := range t.Tags {
-		err = h.WriteFriendly(w, k)
+	for entry := range t.entries() {
+		err = h.WriteFriendly(w, entry.key)
+		if err != nil {
+			return err
+		}
+		if !extended {
+			err = h.WriteFriendly(w, entry.value)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		kind, payload := tagKindString, []byte(entry.value)
+		if entry.isBinary {
+			kind, payload = tagKindBinary, entry.payload
+		}
+		err = h.Write(w, kind)
+		if err != nil {
+			return err
+		}
+		err = h.WriteOffset(w, int64(len(payload)))
 		if err != nil {
 			return err
 		}
-		err = h.WriteFriendly(w, v)
+		_, err = w.Write(payload)
 		if err != nil {
 			return err
 		}
@@ -34,25 +222,258 @@ func (t *TagSection) Write(w io.Writer, h PixiHeader) error {
 }
 
 // Reads a tag section from the given binary stream, according to the specification
-// in the Pixi header h.
+// in the Pixi header h. The order of the tags in the stream is kept in Order.
 func (t *TagSection) Read(r io.Reader, h PixiHeader) error {
 	var tagCount uint32
 	err := h.Read(r, &tagCount)
 	if err != nil {
 		return err
 	}
+	extended := tagCount&tagFlagExtended != 0
+	tagCount &^= tagFlagExtended
+	if extended && h.Version < 2 {
+		return FormatError("extended tag sections require version 2 or later")
+	}
+
 	t.Tags = make(map[string]string)
+	t.Binary = nil
+	t.Order = make([]string, 0, min(tagCount, 1024))
 	for range tagCount {
 		key, err := h.ReadFriendly(r)
 		if err != nil {
 			return err
 		}
-		val, err := h.ReadFriendly(r)
+		if !extended {
+			val, err := h.ReadFriendly(r)
+			if err != nil {
+				return err
+			}
+			t.Set(key, val)
+			continue
+		}
+
+		var kind uint8
+		err = h.Read(r, &kind)
 		if err != nil {
 			return err
 		}
-		t.Tags[key] = val
+		length, err := h.ReadOffset(r)
+		if err != nil {
+			return err
+		}
+		if length < 0 {
+			return FormatError("negative tag value length")
+		}
+		payload, err := readPayload(r, length)
+		if err != nil {
+			return err
+		}
+		switch kind {
+		case tagKindString:
+			t.Set(key, string(payload))
+		case tagKindBinary:
+			t.SetBinary(key, payload)
+		default:
+			return FormatError("unknown tag kind")
+		}
 	}
 	t.NextTagsStart, err = h.ReadOffset(r)
 	return err
 }
+
+// Iterates over a chain of tag sections starting at the given offset, reading each section only when
+// the iteration reaches it. Errors are yielded with a nil section, after which iteration stops.
+func tagSections(r io.ReadSeeker, h PixiHeader, firstOffset int64) iter.Seq2[*TagSection, error] {
+	return func(yield func(*TagSection, error) bool) {
+		seenOffsets := []int64{}
+		tagOffset := firstOffset
+		for tagOffset != 0 {
+			if slices.Contains(seenOffsets, tagOffset) {
+				yield(nil, FormatError("loop detected in tag offsets"))
+				return
+			}
+			seenOffsets = append(seenOffsets, tagOffset)
+			_, err := r.Seek(tagOffset, io.SeekStart)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			rdTags := &TagSection{}
+			err = rdTags.Read(r, h)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if !yield(rdTags, nil) {
+				return
+			}
+			tagOffset = rdTags.NextTagsStart
+		}
+	}
+}
+
+// Writes a chain of tag sections at the current position of the stream, setting the NextTagsStart of
+// each section to point at the section after it. Returns the offset of the first section, or 0 if
+// there are no sections to write.
+func writeTagSections(w io.WriteSeeker, h PixiHeader, sections []*TagSection) (int64, error) {
+	if len(sections) == 0 {
+		return 0, nil
+	}
+	firstOffset, err := w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	sectionOffset := firstOffset
+	for i, section := range sections {
+		section.NextTagsStart = 0
+		err = section.Write(w, h)
+		if err != nil {
+			return 0, err
+		}
+		if i == len(sections)-1 {
+			break
+		}
+		// the size of a section is only known once written, so link it to the next one afterwards
+		nextOffset, err := w.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return 0, err
+		}
+		section.NextTagsStart = nextOffset
+		_, err = w.Seek(sectionOffset, io.SeekStart)
+		if err != nil {
+			return 0, err
+		}
+		err = section.Write(w, h)
+		if err != nil {
+			return 0, err
+		}
+		sectionOffset = nextOffset
+	}
+	return firstOffset, nil
+}
+
+func lookupStringTag(r io.ReadSeeker, h PixiHeader, firstOffset int64, key string) (string, bool, error) {
+	entry, found, err := lookupTag(r, h, firstOffset, key)
+	if err != nil || !found || entry.isBinary {
+		return "", false, err
+	}
+	return entry.value, true, nil
+}
+
+func lookupBinaryTag(r io.ReadSeeker, h PixiHeader, firstOffset int64, key string) ([]byte, bool, error) {
+	entry, found, err := lookupTag(r, h, firstOffset, key)
+	if err != nil || !found || !entry.isBinary {
+		return nil, false, err
+	}
+	return entry.payload, true, nil
+}
+
+// Finds the tag with the given key in a chain of tag sections, preferring later sections.
+func lookupTag(r io.ReadSeeker, h PixiHeader, firstOffset int64, key string) (tagEntry, bool, error) {
+	result, found := tagEntry{}, false
+	seenOffsets := []int64{}
+	tagOffset := firstOffset
+	for tagOffset != 0 {
+		if slices.Contains(seenOffsets, tagOffset) {
+			return tagEntry{}, false, FormatError("loop detected in tag offsets")
+		}
+		seenOffsets = append(seenOffsets, tagOffset)
+		_, err := r.Seek(tagOffset, io.SeekStart)
+		if err != nil {
+			return tagEntry{}, false, err
+		}
+		entry, ok, next, err := scanTagSection(r, h, key)
+		if err != nil {
+			return tagEntry{}, false, err
+		}
+		if ok {
+			result, found = entry, true
+		}
+		tagOffset = next
+	}
+	return result, found, nil
+}
+
+// Reads through a tag section from the given binary stream looking for a tag with the given key,
+// seeking past the values of every other tag rather than reading them. Returns the matching tag, if any,
+// and the offset of the next tag section.
+func scanTagSection(r io.ReadSeeker, h PixiHeader, key string) (tagEntry, bool, int64, error) {
+	var tagCount uint32
+	err := h.Read(r, &tagCount)
+	if err != nil {
+		return tagEntry{}, false, 0, err
+	}
+	extended := tagCount&tagFlagExtended != 0
+	tagCount &^= tagFlagExtended
+	if extended && h.Version < 2 {
+		return tagEntry{}, false, 0, FormatError("extended tag sections require version 2 or later")
+	}
+
+	result, found := tagEntry{}, false
+	for range tagCount {
+		entryKey, err := h.ReadFriendly(r)
+		if err != nil {
+			return tagEntry{}, false, 0, err
+		}
+		kind, length := tagKindString, int64(0)
+		if extended {
+			err = h.Read(r, &kind)
+			if err != nil {
+				return tagEntry{}, false, 0, err
+			}
+			length, err = h.ReadOffset(r)
+			if err != nil {
+				return tagEntry{}, false, 0, err
+			}
+			if length < 0 {
+				return tagEntry{}, false, 0, FormatError("negative tag value length")
+			}
+		} else {
+			var friendlyLength uint16
+			err = h.Read(r, &friendlyLength)
+			if err != nil {
+				return tagEntry{}, false, 0, err
+			}
+			length = int64(friendlyLength)
+		}
+		if entryKey != key {
+			_, err = r.Seek(length, io.SeekCurrent)
+			if err != nil {
+				return tagEntry{}, false, 0, err
+			}
+			continue
+		}
+		payload, err := readPayload(r, length)
+		if err != nil {
+			return tagEntry{}, false, 0, err
+		}
+		switch kind {
+		case tagKindString:
+			result = tagEntry{key: key, value: string(payload)}
+		case tagKindBinary:
+			result = tagEntry{key: key, payload: payload, isBinary: true}
+		default:
+			return tagEntry{}, false, 0, FormatError("unknown tag kind")
+		}
+		found = true
+	}
+	next, err := h.ReadOffset(r)
+	return result, found, next, err
+}
+
+// Reads a length-prefixed payload without trusting the length for a single up-front allocation, so
+// that a corrupted length fails with an unexpected end of stream instead of exhausting memory.
+func readPayload(r io.Reader, length int64) ([]byte, error) {
+	const chunk = 1 << 20
+	payload := make([]byte, 0, min(length, chunk))
+	for int64(len(payload)) < length {
+		n := min(length-int64(len(payload)), chunk)
+		start := len(payload)
+		payload = append(payload, make([]byte, n)...)
+		_, err := io.ReadFull(r, payload[start:])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return payload, nil
+}
@@ -0,0 +1,132 @@
+package pixi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/owlpinetech/pixi/internal/buffer"
+)
+
+func TestTagSectionOrderPreserved(t *testing.T) {
+	header := PixiHeader{Version: Version, OffsetSize: 4, ByteOrder: binary.LittleEndian}
+	section := TagSection{}
+	for _, k := range []string{"zebra", "apple", "mango", "banana"} {
+		section.Set(k, k+"-value")
+	}
+	section.Set("apple", "updated")
+
+	buf := buffer.NewBuffer(10)
+	err := section.Write(buf, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := TagSection{}
+	err = read.Read(buffer.NewBufferFrom(buf.Bytes()), header)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, values := []string{}, []string{}
+	for k, v := range read.All() {
+		keys = append(keys, k)
+		values = append(values, v)
+	}
+	if !slices.Equal(keys, []string{"zebra", "apple", "mango", "banana"}) {
+		t.Errorf("expected insertion order to be preserved, got %v", keys)
+	}
+	if values[1] != "updated" {
+		t.Errorf("expected updated value to keep its position, got %v", values)
+	}
+}
+
+func TestTagSectionUnorderedKeysSorted(t *testing.T) {
+	section := TagSection{Tags: map[string]string{"c": "3", "a": "1", "b": "2", "first": "0"}, Order: []string{"first", "missing"}}
+	keys := []string{}
+	for k := range section.All() {
+		keys = append(keys, k)
+	}
+	if !slices.Equal(keys, []string{"first", "a", "b", "c"}) {
+		t.Errorf("expected ordered keys then sorted remainder, got %v", keys)
+	}
+}
+
+func TestTagSectionLargeAndBinaryValues(t *testing.T) {
+	header := PixiHeader{Version: Version, OffsetSize: 8, ByteOrder: binary.BigEndian}
+	license := strings.Repeat("license text ", 6000)
+	thumbnail := []byte{0x89, 'P', 'N', 'G', 0x00, 0x00, 0x0d, 0x0a, 0x00, 0xff}
+
+	section := TagSection{}
+	section.Set("title", "large")
+	section.SetBinary("thumbnail", thumbnail)
+	section.Set("license", license)
+
+	buf := buffer.NewBuffer(10)
+	err := section.Write(buf, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := TagSection{}
+	err = read.Read(buffer.NewBufferFrom(buf.Bytes()), header)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if read.Tags["title"] != "large" || read.Tags["license"] != license {
+		t.Errorf("expected string tags to round trip, got %d tags", len(read.Tags))
+	}
+	if !bytes.Equal(read.Binary["thumbnail"], thumbnail) {
+		t.Errorf("expected binary payload %v, got %v", thumbnail, read.Binary["thumbnail"])
+	}
+	if !slices.Equal(read.Order, []string{"title", "thumbnail", "license"}) {
+		t.Errorf("expected order to be preserved across kinds, got %v", read.Order)
+	}
+}
+
+func TestTagSectionSmallStringsKeepCompactLayout(t *testing.T) {
+	header := PixiHeader{Version: Version, OffsetSize: 4, ByteOrder: binary.LittleEndian}
+	section := TagSection{}
+	section.Set("a", "b")
+
+	buf := buffer.NewBuffer(10)
+	err := section.Write(buf, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// count, key length and key, value length and value, next section offset
+	if len(buf.Bytes()) != 4+2+1+2+1+4 {
+		t.Errorf("expected compact tag layout, got %d bytes", len(buf.Bytes()))
+	}
+}
+
+func TestTagSectionBinaryRequiresVersion2(t *testing.T) {
+	header := PixiHeader{Version: 1, OffsetSize: 4, ByteOrder: binary.LittleEndian}
+	section := TagSection{}
+	section.SetBinary("blob", []byte{1, 2, 3})
+
+	err := section.Write(buffer.NewBuffer(10), header)
+	if _, ok := err.(FormatError); !ok {
+		t.Errorf("expected format error writing binary tags to a version 1 file, got %v", err)
+	}
+
+	section = TagSection{}
+	section.Set("long", strings.Repeat("x", 70000))
+	err = section.Write(buffer.NewBuffer(10), header)
+	if _, ok := err.(FormatError); !ok {
+		t.Errorf("expected format error writing a long tag to a version 1 file, got %v", err)
+	}
+}
+
+func TestTagSectionSetChangesKind(t *testing.T) {
+	section := TagSection{}
+	section.Set("k", "v")
+	section.SetBinary("k", []byte("v"))
+	if _, ok := section.Tags["k"]; ok {
+		t.Error("expected string tag to be replaced by binary tag")
+	}
+	if !slices.Equal(section.Order, []string{"k"}) {
+		t.Errorf("expected key to appear once in order, got %v", section.Order)
+	}
+}
@@ -0,0 +1,92 @@
+package pixi
+
+import (
+	"bytes"
+	"io"
+	"slices"
+	"strconv"
+)
+
+// Starts recording the compression of every disk tile of the layer in the layer header, so that tiles of
+// the layer can be stored with different compressions: each tile is read with the compression recorded
+// for it rather than that of the layer, which then only decides how new tiles are written. Tiles of a
+// layer using CompressionAuto record the method chosen for them here instead of in a byte before their
+// data, and tiles copied from layers with another compression (see CopyEncodedTileFrom) keep theirs. Like
+// tile ranges, the table changes the size of the layer header, so it must be recorded from before the
+// layer header is first written. Requires version 2 or later.
+func (l *Layer) RecordTileCompressions() {
+	if l.TileCompressions != nil {
+		return
+	}
+	l.TileCompressions = make([]Compression, l.DiskTiles())
+	for tileIndex := range l.TileCompressions {
+		l.TileCompressions[tileIndex] = l.Compression
+	}
+}
+
+// The compression the disk tile at the given index is decoded with: the one recorded for it, if the layer
+// records tile compressions, and otherwise that of the layer.
+func (l *Layer) tileCompression(tileIndex int) Compression {
+	if l.TileCompressions != nil {
+		return l.TileCompressions[tileIndex]
+	}
+	return l.Compression
+}
+
+// Records the compression a disk tile was stored with, if the layer records tile compressions.
+func (l *Layer) setTileCompression(tileIndex int, compression Compression) {
+	if l.TileCompressions != nil {
+		l.TileCompressions[tileIndex] = compression
+	}
+}
+
+// Compresses the decoded data of a tile with the layer's compression and writes it to w, returning the
+// compression to record for the tile and the number of bytes written. With CompressionAuto and recorded
+// tile compressions, the chosen method goes in the table, so only the data after it is written.
+func (l *Layer) encodeTile(w io.Writer, data []byte) (Compression, int, error) {
+	if l.TileCompressions == nil || l.Compression != CompressionAuto {
+		writeAmt, err := l.Compression.WriteChunk(w, data)
+		return l.Compression, writeAmt, err
+	}
+	buf := new(bytes.Buffer)
+	_, err := CompressionAuto.WriteChunk(buf, data)
+	if err != nil {
+		return l.Compression, 0, err
+	}
+	chosen := Compression(buf.Next(1)[0])
+	writeAmt, err := w.Write(buf.Bytes())
+	return chosen, writeAmt, err
+}
+
+func (l *Layer) tileCompressionsSize() int {
+	if l.TileCompressions == nil {
+		return 0
+	}
+	return len(l.TileCompressions)
+}
+
+func (l *Layer) writeTileCompressions(w io.Writer) error {
+	table := make([]byte, len(l.TileCompressions))
+	for tileIndex, compression := range l.TileCompressions {
+		table[tileIndex] = byte(compression)
+	}
+	_, err := w.Write(table)
+	return err
+}
+
+func (l *Layer) readTileCompressions(r io.Reader) error {
+	table := make([]byte, l.DiskTiles())
+	_, err := io.ReadFull(r, table)
+	if err != nil {
+		return err
+	}
+	l.TileCompressions = make([]Compression, len(table))
+	for tileIndex, method := range table {
+		compression := Compression(method)
+		if !slices.Contains(SupportedCompressions(), compression) {
+			return FormatError("unknown compression " + strconv.Itoa(int(method)) + " recorded for tile " + strconv.Itoa(tileIndex))
+		}
+		l.TileCompressions[tileIndex] = compression
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package pixi
+
+import (
+	"encoding/binary"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/owlpinetech/pixi/internal/buffer"
+)
+
+func TestTileCompressionsAutoRoundTrip(t *testing.T) {
+	header := PixiHeader{Version: Version, OffsetSize: 4, ByteOrder: binary.LittleEndian}
+	buf := buffer.NewBuffer(10)
+	layer := NewLayer("mixed", false, CompressionAuto,
+		DimensionSet{{Name: "x", Size: 128, TileSize: 64}},
+		[]Field{{Name: "v", Type: FieldUint16}})
+	layer.RecordTileCompressions()
+	tiles := randomTiles(layer)
+	clear(tiles[0])
+	writeSingleLayerPixi(t, buf, header, nil, layer, tiles)
+
+	if !slices.Equal(layer.TileCompressions, []Compression{CompressionFlate, CompressionNone}) {
+		t.Fatalf("expected the flat tile to be compressed and the noisy one not, got %v", layer.TileCompressions)
+	}
+	if layer.TileBytes[1] != int64(layer.DiskTileSize(1)) {
+		t.Errorf("expected the method chosen to be kept out of the tile data, got %d bytes", layer.TileBytes[1])
+	}
+
+	summary, err := ReadPixi(buffer.NewBufferFrom(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := summary.Layers[0]
+	if !slices.Equal(read.TileCompressions, layer.TileCompressions) {
+		t.Errorf("expected the tile compressions to be read back, got %v", read.TileCompressions)
+	}
+	if read.HeaderSize(header) != layer.HeaderSize(header) {
+		t.Errorf("expected the header sizes to match, got %d and %d", read.HeaderSize(header), layer.HeaderSize(header))
+	}
+	data := make([]byte, read.DiskTileSize(0))
+	for tileIndex := range read.DiskTiles() {
+		err = read.ReadTile(buf, header, tileIndex, data)
+		if err != nil || !slices.Equal(data, tiles[tileIndex]) {
+			t.Errorf("expected tile %d to be read back, got %v", tileIndex, err)
+		}
+		compression, err := read.TileCompression(buf, tileIndex)
+		if err != nil || compression != layer.TileCompressions[tileIndex] {
+			t.Errorf("expected tile %d to report %v, got %v %v", tileIndex, layer.TileCompressions[tileIndex], compression, err)
+		}
+	}
+}
+
+func TestTileCompressionsKeepCopiedTiles(t *testing.T) {
+	header := PixiHeader{Version: Version, OffsetSize: 8, ByteOrder: binary.BigEndian}
+	srcBuf := buffer.NewBuffer(10)
+	src := appendTestLayer("src")
+	srcTiles := randomTiles(src)
+	writeSingleLayerPixi(t, srcBuf, header, nil, src, srcTiles)
+
+	buf := buffer.NewBuffer(10)
+	layer := NewLayer("dst", false, CompressionNone, src.Dimensions, src.Fields)
+	layer.RecordTileCompressions()
+	tiles := randomTiles(layer)
+	writeSingleLayerPixi(t, buf, header, nil, layer, tiles[:1])
+	err := layer.CopyEncodedTile(buf, srcBuf, header, src, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(layer.TileCompressions, []Compression{CompressionNone, CompressionFlate}) {
+		t.Fatalf("expected the copied tile to keep its compression, got %v", layer.TileCompressions)
+	}
+
+	data := make([]byte, layer.DiskTileSize(0))
+	if err = layer.ReadTile(buf, header, 0, data); err != nil || !slices.Equal(data, tiles[0]) {
+		t.Errorf("expected the written tile to be read back, got %v", err)
+	}
+	if err = layer.ReadTile(buf, header, 1, data); err != nil || !slices.Equal(data, srcTiles[1]) {
+		t.Errorf("expected the copied tile to be read back, got %v", err)
+	}
+	span := make([]byte, 2)
+	if err = layer.ReadTileSpan(buf, 0, 2, span); err != nil || !slices.Equal(span, tiles[0][2:4]) {
+		t.Errorf("expected a span of the uncompressed tile to be read, got %v", err)
+	}
+	var unsupported UnsupportedError
+	if err = layer.ReadTileSpan(buf, 1, 2, span); !errors.As(err, &unsupported) {
+		t.Errorf("expected a span of the compressed tile to be refused, got %v", err)
+	}
+}
+
+func TestTileCompressionsRequireVersion2(t *testing.T) {
+	layer := appendTestLayer("old")
+	layer.RecordTileCompressions()
+	err := layer.WriteHeader(buffer.NewBuffer(10), PixiHeader{Version: 1, OffsetSize: 4, ByteOrder: binary.BigEndian})
+	var format FormatError
+	if !errors.As(err, &format) {
+		t.Errorf("expected tile compressions to be refused in version 1, got %v", err)
+	}
+}
+
+func TestTileCompressionsRequireFeatures(t *testing.T) {
+	header := PixiHeader{Version: Version, OffsetSize: 4, ByteOrder: binary.LittleEndian}
+	buf := buffer.NewBuffer(10)
+	plain := appendTestLayer("plain")
+	writeSingleLayerPixi(t, buf, header, nil, plain, randomTiles(plain))
+
+	auto := NewLayer("auto", false, CompressionAuto, plain.Dimensions, plain.Fields)
+	auto.RecordTileCompressions()
+	if required, _ := UsedFeatures([]*Layer{auto}, nil); required != FeatureTileCompressions|FeatureAutoCompression {
+		t.Errorf("expected tile compressions and automatic compression to be required, got %v", required)
+	}
+	tiles := randomTiles(auto)
+	err := AppendLayer(buf, auto, 1, func(tileIndex int, data []byte) error {
+		copy(data, tiles[tileIndex])
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary, err := ReadPixi(buffer.NewBufferFrom(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := FeatureTileCompressions | FeatureAutoCompression; summary.Header.RequiredFeatures != want {
+		t.Errorf("expected appending the layer to require %v, got %v", want, summary.Header.RequiredFeatures)
+	}
+}
+
+func TestReadLayerRefusesUnknownConfiguration(t *testing.T) {
+	header := PixiHeader{Version: Version, OffsetSize: 4, ByteOrder: binary.BigEndian}
+	buf := buffer.NewBuffer(10)
+	if err := appendTestLayer("future").WriteHeader(buf, header); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	data[0] |= 0x80
+	var format FormatError
+	if err := (&Layer{}).ReadLayer(buffer.NewBufferFrom(data), header); !errors.As(err, &format) {
+		t.Errorf("expected a layer with unknown configuration flags to be refused, got %v", err)
+	}
+}
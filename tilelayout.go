@@ -0,0 +1,89 @@
+package pixi
+
+import "encoding/binary"
+
+// Describes where the samples and fields of a decoded disk tile lie in its bytes, so that code working on
+// raw tile data can run its own inner loops over it. Samples are laid out with the first dimension
+// varying fastest, and every tile is the full tile size, so tiles at the edges of the layer hold padding
+// samples beyond the end of each dimension.
+type TileLayout struct {
+	Tile      int              // The index of the tile in the layer.
+	DiskTile  int              // The index of the disk tile, which differs from Tile for all but the first field of a separated layer.
+	Origin    SampleCoordinate // The coordinate in the layer of the first sample of the tile.
+	Shape     []int            // The number of samples of the tile along each dimension, including padding.
+	Extent    []int            // The number of samples of the tile along each dimension that lie within the layer.
+	Strides   []int            // The number of bytes between samples one apart along each dimension.
+	Channels  []ChannelLayout  // The fields stored in the tile, in the order of the fields of the layer.
+	ByteOrder binary.ByteOrder // The byte order of the values of the fields.
+}
+
+// A field stored in a disk tile, as described by a TileLayout.
+type ChannelLayout struct {
+	Field  Field
+	Index  int // The index of the field in the layer.
+	Offset int // The offset in bytes of the value of the field in each sample.
+}
+
+// The layout of the decoded data of the disk tile at the given index, with values in the given byte order.
+func (l *Layer) DiskTileLayout(diskTile int, order binary.ByteOrder) TileLayout {
+	tile := diskTile % l.Dimensions.Tiles()
+	origin, end := l.Dimensions.TileBounds(tile)
+	layout := TileLayout{
+		Tile:      tile,
+		DiskTile:  diskTile,
+		Origin:    origin,
+		Shape:     make([]int, len(l.Dimensions)),
+		Extent:    make([]int, len(l.Dimensions)),
+		Strides:   make([]int, len(l.Dimensions)),
+		ByteOrder: order,
+	}
+	if l.Separated {
+		fieldIndex := diskTile / l.Dimensions.Tiles()
+		layout.Channels = []ChannelLayout{{Field: l.Fields[fieldIndex], Index: fieldIndex}}
+	} else {
+		offset := 0
+		for fieldIndex, field := range l.Fields {
+			layout.Channels = append(layout.Channels, ChannelLayout{Field: field, Index: fieldIndex, Offset: offset})
+			offset += field.Size()
+		}
+	}
+
+	stride := l.SampleSize()
+	if l.Separated {
+		stride = layout.Channels[0].Field.Size()
+	}
+	for i, dim := range l.Dimensions {
+		layout.Shape[i] = dim.TileSize
+		layout.Extent[i] = end[i] - origin[i]
+		layout.Strides[i] = stride
+		stride *= dim.TileSize
+	}
+	return layout
+}
+
+// The number of bytes between consecutive samples of the tile, the stride of its first dimension.
+func (t TileLayout) SampleStride() int {
+	if len(t.Strides) == 0 {
+		return 0
+	}
+	return t.Strides[0]
+}
+
+// The offset in bytes of the sample at the given layer coordinate, which must lie within the tile.
+func (t TileLayout) SampleOffset(coord SampleCoordinate) int {
+	offset := 0
+	for i, c := range coord {
+		offset += (c - t.Origin[i]) * t.Strides[i]
+	}
+	return offset
+}
+
+// The layout of the field with the given index in the layer, if the tile stores it.
+func (t TileLayout) Channel(fieldIndex int) (ChannelLayout, bool) {
+	for _, channel := range t.Channels {
+		if channel.Index == fieldIndex {
+			return channel, true
+		}
+	}
+	return ChannelLayout{}, false
+}
@@ -0,0 +1,55 @@
+package pixi
+
+import (
+	"encoding/binary"
+	"slices"
+	"testing"
+)
+
+func TestDiskTileLayoutContiguous(t *testing.T) {
+	layer := NewLayer("layout", false, CompressionNone,
+		DimensionSet{{Name: "x", Size: 10, TileSize: 4}, {Name: "y", Size: 6, TileSize: 4}},
+		[]Field{{Name: "a", Type: FieldUint16}, {Name: "b", Type: FieldFloat64}})
+	layout := layer.DiskTileLayout(5, binary.BigEndian)
+	if layout.Tile != 5 || layout.DiskTile != 5 || !slices.Equal(layout.Origin, SampleCoordinate{8, 4}) {
+		t.Errorf("expected tile 5 at (8, 4), got tile %d disk tile %d at %v", layout.Tile, layout.DiskTile, layout.Origin)
+	}
+	if !slices.Equal(layout.Shape, []int{4, 4}) || !slices.Equal(layout.Extent, []int{2, 2}) {
+		t.Errorf("expected a 4x4 tile with 2x2 samples in the layer, got %v and %v", layout.Shape, layout.Extent)
+	}
+	if !slices.Equal(layout.Strides, []int{10, 40}) || layout.SampleStride() != 10 {
+		t.Errorf("expected strides of 10 and 40 bytes, got %v", layout.Strides)
+	}
+	if len(layout.Channels) != 2 || layout.Channels[1].Offset != 2 || layout.Channels[1].Index != 1 {
+		t.Errorf("expected both fields with the second 2 bytes in, got %v", layout.Channels)
+	}
+	if offset := layout.SampleOffset(SampleCoordinate{9, 5}); offset != 50 {
+		t.Errorf("expected the sample at (9, 5) 50 bytes in, got %d", offset)
+	}
+	// the offset of each sample agrees with the position the layer gives it in its tile
+	for inTile := range layer.Dimensions.TileSamples() {
+		coord := TileSelector{Tile: 5, InTile: inTile}.ToTileCoordinate(layer.Dimensions).ToSampleCoordinate(layer.Dimensions)
+		if offset := layout.SampleOffset(coord); offset != inTile*layer.SampleSize() {
+			t.Errorf("expected sample %d of the tile at %d bytes, got %d", inTile, inTile*layer.SampleSize(), offset)
+		}
+	}
+}
+
+func TestDiskTileLayoutSeparated(t *testing.T) {
+	layer := NewLayer("layout", true, CompressionNone,
+		DimensionSet{{Name: "x", Size: 10, TileSize: 4}, {Name: "y", Size: 6, TileSize: 4}},
+		[]Field{{Name: "a", Type: FieldUint16}, {Name: "b", Type: FieldFloat64}})
+	layout := layer.DiskTileLayout(layer.Dimensions.Tiles()+1, binary.LittleEndian)
+	if layout.Tile != 1 || layout.DiskTile != layer.Dimensions.Tiles()+1 {
+		t.Errorf("expected tile 1 of the second field, got tile %d disk tile %d", layout.Tile, layout.DiskTile)
+	}
+	if !slices.Equal(layout.Strides, []int{8, 32}) {
+		t.Errorf("expected strides of 8 and 32 bytes, got %v", layout.Strides)
+	}
+	if _, ok := layout.Channel(0); ok {
+		t.Error("expected the tile of the second field not to hold the first")
+	}
+	if channel, ok := layout.Channel(1); !ok || channel.Offset != 0 || channel.Field.Name != "b" {
+		t.Errorf("expected the second field at the start of each sample, got %v", channel)
+	}
+}
@@ -0,0 +1,191 @@
+package pixi
+
+import (
+	"io"
+)
+
+// The smallest and largest value of each field in one tile of a layer. Entries are nil for fields whose
+// range is not known, either because the tile holding them was copied from a layer without ranges or
+// because every value of the field in the tile is NaN.
+type TileRange struct {
+	Min []any
+	Max []any
+}
+
+// Starts recording the range of values of each field in every tile of the layer, updated as tiles are
+// written and stored in the layer header, so that FindTilesWhere can rule out tiles without reading them.
+// Like tags, the ranges change the size of the layer header, so they must be recorded from before the
+// layer header is first written. Requires version 2 or later.
+func (l *Layer) RecordTileRanges() {
+	if l.TileRanges != nil {
+		return
+	}
+	l.TileRanges = make([]TileRange, l.Dimensions.Tiles())
+	for tile := range l.TileRanges {
+		l.TileRanges[tile] = TileRange{Min: make([]any, len(l.Fields)), Max: make([]any, len(l.Fields))}
+	}
+}
+
+// Returns the indices of the written tiles whose values of the field with the given index may satisfy a
+// query, as decided by the predicate from the smallest and largest value of the field in the tile. For
+// example, the tiles that may hold values above a threshold are those whose maximum is above it. Tiles
+// whose range is unknown are always returned, so without recorded ranges every written tile is.
+func (l *Layer) FindTilesWhere(fieldIndex int, predicate func(min any, max any) bool) []int {
+	tiles := []int{}
+	for tile := range l.Dimensions.Tiles() {
+		diskTile := tile
+		if l.Separated {
+			diskTile += fieldIndex * l.Dimensions.Tiles()
+		}
+		if l.TileBytes[diskTile] == 0 {
+			continue
+		}
+		if l.TileRanges != nil {
+			tileRange := l.TileRanges[tile]
+			if tileRange.Min[fieldIndex] != nil && !predicate(tileRange.Min[fieldIndex], tileRange.Max[fieldIndex]) {
+				continue
+			}
+		}
+		tiles = append(tiles, tile)
+	}
+	return tiles
+}
+
+// Updates the recorded ranges of the fields held by the disk tile from its decoded data, ignoring
+// samples in the padding of partial tiles at the edges of the layer.
+func (l *Layer) updateTileRange(h PixiHeader, diskTile int, data []byte) {
+	if l.TileRanges == nil {
+		return
+	}
+	tile, fields := l.diskTileFields(diskTile)
+
+	minMaxes := make([]*MinMax, len(fields))
+	for i, fieldIndex := range fields {
+		minMaxes[i] = NewMinMax(l.Fields[fieldIndex].Type, NaNIgnore)
+	}
+	stride := l.DiskTileSize(diskTile) / l.Dimensions.TileSamples()
+	for inTile := range l.Dimensions.TileSamples() {
+		coord := TileSelector{Tile: tile, InTile: inTile}.ToTileCoordinate(l.Dimensions).ToSampleCoordinate(l.Dimensions)
+		if !inBounds(l.Dimensions, coord) {
+			continue
+		}
+		offset := inTile * stride
+		for i, fieldIndex := range fields {
+			field := l.Fields[fieldIndex]
+			minMaxes[i].Update(field.BytesToValue(data[offset:], h.ByteOrder))
+			offset += field.Size()
+		}
+	}
+	for i, fieldIndex := range fields {
+		l.TileRanges[tile].Min[fieldIndex] = minMaxes[i].Min
+		l.TileRanges[tile].Max[fieldIndex] = minMaxes[i].Max
+	}
+}
+
+// Sets the recorded ranges of the fields held by a zero-filled disk tile, without scanning its data.
+func (l *Layer) blankTileRange(h PixiHeader, diskTile int) {
+	if l.TileRanges == nil {
+		return
+	}
+	tile, fields := l.diskTileFields(diskTile)
+	for _, fieldIndex := range fields {
+		field := l.Fields[fieldIndex]
+		zero := field.BytesToValue(make([]byte, field.Size()), h.ByteOrder)
+		l.TileRanges[tile].Min[fieldIndex] = zero
+		l.TileRanges[tile].Max[fieldIndex] = zero
+	}
+}
+
+// Marks the recorded ranges of the fields held by the disk tile unknown.
+func (l *Layer) forgetTileRange(diskTile int) {
+	if l.TileRanges == nil {
+		return
+	}
+	tile, fields := l.diskTileFields(diskTile)
+	for _, fieldIndex := range fields {
+		l.TileRanges[tile].Min[fieldIndex] = nil
+		l.TileRanges[tile].Max[fieldIndex] = nil
+	}
+}
+
+// Copies the recorded ranges of the fields held by a disk tile of the src layer to a disk tile of this
+// layer with the same fields, marking them unknown if the src layer does not record ranges.
+func (l *Layer) copyTileRange(src *Layer, srcDiskTile int, diskTile int) {
+	if l.TileRanges == nil {
+		return
+	}
+	tile, fields := l.diskTileFields(diskTile)
+	srcTile, _ := src.diskTileFields(srcDiskTile)
+	for _, fieldIndex := range fields {
+		var low, high any
+		if src.TileRanges != nil {
+			low, high = src.TileRanges[srcTile].Min[fieldIndex], src.TileRanges[srcTile].Max[fieldIndex]
+		}
+		l.TileRanges[tile].Min[fieldIndex] = low
+		l.TileRanges[tile].Max[fieldIndex] = high
+	}
+}
+
+// The size in bytes of the tile ranges in the layer header: for each tile and field, a byte marking
+// whether the range is known followed by the minimum and maximum.
+func (l *Layer) tileRangesSize() int {
+	if l.TileRanges == nil {
+		return 0
+	}
+	return l.Dimensions.Tiles() * (len(l.Fields) + 2*l.SampleSize())
+}
+
+func (l *Layer) writeTileRanges(w io.Writer, h PixiHeader) error {
+	for _, tileRange := range l.TileRanges {
+		for fieldIndex, field := range l.Fields {
+			known := tileRange.Min[fieldIndex] != nil
+			raw := make([]byte, 1+2*field.Size())
+			if known {
+				raw[0] = 1
+				field.ValueToBytes(tileRange.Min[fieldIndex], raw[1:], h.ByteOrder)
+				field.ValueToBytes(tileRange.Max[fieldIndex], raw[1+field.Size():], h.ByteOrder)
+			}
+			_, err := w.Write(raw)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (l *Layer) readTileRanges(r io.Reader, h PixiHeader) error {
+	l.TileRanges = nil
+	l.RecordTileRanges()
+	for _, tileRange := range l.TileRanges {
+		for fieldIndex, field := range l.Fields {
+			raw := make([]byte, 1+2*field.Size())
+			_, err := io.ReadFull(r, raw)
+			if err != nil {
+				return err
+			}
+			switch raw[0] {
+			case 0:
+			case 1:
+				tileRange.Min[fieldIndex] = field.BytesToValue(raw[1:], h.ByteOrder)
+				tileRange.Max[fieldIndex] = field.BytesToValue(raw[1+field.Size():], h.ByteOrder)
+			default:
+				return FormatError("invalid tile range marker")
+			}
+		}
+	}
+	return nil
+}
+
+// The tile a disk tile belongs to and the indices of the fields it holds.
+func (l *Layer) diskTileFields(diskTile int) (int, []int) {
+	tiles := l.Dimensions.Tiles()
+	if l.Separated {
+		return diskTile % tiles, []int{diskTile / tiles}
+	}
+	fields := make([]int, len(l.Fields))
+	for i := range fields {
+		fields[i] = i
+	}
+	return diskTile, fields
+}
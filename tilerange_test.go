@@ -0,0 +1,72 @@
+package pixi
+
+import (
+	"encoding/binary"
+	"slices"
+	"testing"
+
+	"github.com/owlpinetech/pixi/internal/buffer"
+)
+
+func TestTileRangesFindTilesWhere(t *testing.T) {
+	header := PixiHeader{Version: Version, OffsetSize: 4, ByteOrder: binary.LittleEndian, Checksum: ChecksumCrc32}
+	layer := NewLayer("flood", false, CompressionNone,
+		DimensionSet{{Name: "x", Size: 6, TileSize: 4}, {Name: "y", Size: 6, TileSize: 4}},
+		[]Field{{Name: "depth", Type: FieldFloat32}, {Name: "class", Type: FieldUint8}})
+	layer.RecordTileRanges()
+
+	// depths are a meter per tile plus a centimeter per sample in the tile, while the padding of partial
+	// tiles holds depths that must not count toward the ranges
+	tiles := make([][]byte, layer.DiskTiles())
+	for tile := range tiles {
+		tiles[tile] = make([]byte, layer.DiskTileSize(tile))
+		for inTile := range layer.Dimensions.TileSamples() {
+			coord := TileSelector{Tile: tile, InTile: inTile}.ToTileCoordinate(layer.Dimensions).ToSampleCoordinate(layer.Dimensions)
+			depth := float32(tile) + float32(inTile)/100
+			if coord[0] >= 6 || coord[1] >= 6 {
+				depth = 50
+			}
+			layer.Fields[0].ValueToBytes(depth, tiles[tile][inTile*layer.SampleSize():], header.ByteOrder)
+			tiles[tile][inTile*layer.SampleSize()+4] = uint8(tile)
+		}
+	}
+	buf := buffer.NewBuffer(10)
+	writeSingleLayerPixi(t, buf, header, nil, layer, tiles)
+
+	rdr := buffer.NewBufferFrom(buf.Bytes())
+	read, err := ReadPixi(rdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	readLayer := read.Layers[0]
+	if len(readLayer.TileRanges) != layer.Dimensions.Tiles() {
+		t.Fatalf("expected tile ranges to be read back, got %v", readLayer.TileRanges)
+	}
+	if readLayer.TileRanges[3].Min[0] != float32(3) || readLayer.TileRanges[3].Max[0] != float32(3.05) {
+		t.Errorf("expected padding to be left out of the range of tile 3, got %v to %v", readLayer.TileRanges[3].Min[0], readLayer.TileRanges[3].Max[0])
+	}
+
+	above := func(threshold float32) func(min any, max any) bool {
+		return func(min any, max any) bool { return max.(float32) > threshold }
+	}
+	if found := readLayer.FindTilesWhere(0, above(1.5)); !slices.Equal(found, []int{2, 3}) {
+		t.Errorf("expected tiles 2 and 3 to hold depths above 1.5, got %v", found)
+	}
+	if found := readLayer.FindTilesWhere(1, func(min any, max any) bool { return min.(uint8) == 0 }); !slices.Equal(found, []int{0}) {
+		t.Errorf("expected only tile 0 to hold class 0, got %v", found)
+	}
+
+	readLayer.TileRanges = nil
+	if found := readLayer.FindTilesWhere(0, above(100)); len(found) != layer.Dimensions.Tiles() {
+		t.Errorf("expected every tile to be a candidate without ranges, got %v", found)
+	}
+}
+
+func TestTileRangesRequireVersion2(t *testing.T) {
+	header := PixiHeader{Version: 1, OffsetSize: 4, ByteOrder: binary.BigEndian}
+	layer := NewLayer("old", false, CompressionNone, DimensionSet{{Name: "x", Size: 4, TileSize: 4}}, []Field{{Name: "v", Type: FieldInt16}})
+	layer.RecordTileRanges()
+	if err := layer.WriteHeader(buffer.NewBuffer(10), header); err == nil {
+		t.Error("expected an error writing tile ranges to a version 1 file")
+	}
+}
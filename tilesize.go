@@ -0,0 +1,135 @@
+package pixi
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+)
+
+// The size of tile that SuggestTileSize aims for when not given one: large enough that reading a tile
+// costs little more than seeking to it, small enough that a cache of a few dozen tiles fits easily in memory.
+const DefaultTargetTileBytes = 256 << 10
+
+// How the samples of a layer are expected to be read, which decides the shape of suggested tiles.
+type AccessPattern int
+
+const (
+	// Samples are read in arbitrary windows or at scattered points, as by a viewer or a server, so tiles
+	// are made as close to square as the dimensions allow.
+	AccessRandom AccessPattern = iota
+	// Samples are read in order, with the first dimension varying fastest, so tiles span as much of the
+	// first dimension as the target allows, then as much of the next, and so on.
+	AccessSequential
+	// Tiles are read at a constant step other than one, as when walking down a column of tiles. Tiles are
+	// suggested as for random access.
+	AccessStrided
+)
+
+func (a AccessPattern) String() string {
+	switch a {
+	case AccessRandom:
+		return "random"
+	case AccessSequential:
+		return "sequential"
+	case AccessStrided:
+		return "strided"
+	default:
+		return "unknown"
+	}
+}
+
+// Suggests a tile size for each dimension of a layer with the given fields, so that a tile holds about
+// targetTileBytes (DefaultTargetTileBytes if not positive) of uncompressed samples, shaped for the access
+// pattern. Dimensions too small to fill their share of the target are tiled whole, and the others take up
+// the remaining budget; other tile sizes are rounded down to a power of two. A layer holding fewer bytes
+// than the target is suggested a single tile.
+func SuggestTileSize(dims DimensionSet, fields FieldSet, targetTileBytes int, access AccessPattern) []int {
+	if targetTileBytes <= 0 {
+		targetTileBytes = DefaultTargetTileBytes
+	}
+	sampleSize := 0
+	for _, field := range fields {
+		sampleSize += field.Size()
+	}
+	budget := max(targetTileBytes/max(sampleSize, 1), 1)
+
+	tileSizes := make([]int, len(dims))
+	switch access {
+	case AccessSequential:
+		for i, dim := range dims {
+			if dim.Size <= budget {
+				tileSizes[i] = dim.Size
+			} else {
+				tileSizes[i] = max(floorPowerOfTwo(budget), 1)
+			}
+			budget = max(budget/tileSizes[i], 1)
+		}
+	default:
+		// share the budget out evenly, starting with the smallest dimensions so that any budget they
+		// cannot use passes on to the larger ones
+		order := make([]int, len(dims))
+		for i := range order {
+			order[i] = i
+		}
+		slices.SortStableFunc(order, func(a, b int) int {
+			return cmp.Compare(dims[a].Size, dims[b].Size)
+		})
+		for i, d := range order {
+			share := int(math.Pow(float64(budget), 1/float64(len(order)-i)) + 1e-9)
+			if dims[d].Size <= share {
+				tileSizes[d] = dims[d].Size
+			} else {
+				tileSizes[d] = max(floorPowerOfTwo(share), 1)
+			}
+			budget = max(budget/tileSizes[d], 1)
+		}
+	}
+	return tileSizes
+}
+
+func floorPowerOfTwo(n int) int {
+	if n < 1 {
+		return 0
+	}
+	p := 1
+	for p*2 <= n {
+		p *= 2
+	}
+	return p
+}
+
+// Limits beyond which CheckTiling reports the tiles of a layer as too small or too many to read efficiently.
+const (
+	MinTileSamples = 64      // The fewest samples a tile should hold, unless the whole layer holds fewer.
+	MaxLayerTiles  = 1 << 20 // The most tiles a layer should have, past which its tile offsets alone take megabytes.
+)
+
+// Returned by CheckTiling for tile sizes known to make a layer unusably slow to read or write.
+var ErrSlowTiling = errors.New("pixi: tiling would make the layer very slow")
+
+// Checks the tile sizes of the dimensions for configurations known to perform terribly: tiles larger than
+// their dimension, tiles of fewer than MinTileSamples samples, for which per-tile overhead dwarfs the data,
+// and more than MaxLayerTiles tiles, which bloat the layer header and defeat caching. Returns an error
+// wrapping ErrSlowTiling describing every problem found, or nil if there are none. Writers creating new
+// layers check this unless told to allow slow tiling.
+func (d DimensionSet) CheckTiling() error {
+	problems := []string{}
+	for _, dim := range d {
+		if dim.TileSize > dim.Size {
+			problems = append(problems, fmt.Sprintf("tile size %d of dimension '%s' is larger than its size %d", dim.TileSize, dim.Name, dim.Size))
+		}
+	}
+	if tileSamples := d.TileSamples(); tileSamples < MinTileSamples && tileSamples < d.Samples() {
+		problems = append(problems, fmt.Sprintf("tiles of %d samples are fewer than %d", tileSamples, MinTileSamples))
+	}
+	if tiles := d.Tiles(); tiles > MaxLayerTiles {
+		problems = append(problems, fmt.Sprintf("%d tiles are more than %d", tiles, MaxLayerTiles))
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrSlowTiling, strings.Join(problems, "; "))
+}
@@ -0,0 +1,51 @@
+package pixi
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestSuggestTileSize(t *testing.T) {
+	rgba := FieldSet{{Name: "r", Type: FieldUint8}, {Name: "g", Type: FieldUint8}, {Name: "b", Type: FieldUint8}, {Name: "a", Type: FieldUint8}}
+	tests := []struct {
+		name   string
+		dims   DimensionSet
+		target int
+		access AccessPattern
+		expect []int
+	}{
+		{"large image square tiles", DimensionSet{{Size: 20000}, {Size: 10000}}, 0, AccessRandom, []int{256, 256}},
+		{"small image single tile", DimensionSet{{Size: 100}, {Size: 80}}, 0, AccessRandom, []int{100, 80}},
+		{"narrow image", DimensionSet{{Size: 40}, {Size: 100000}}, 0, AccessRandom, []int{40, 1024}},
+		{"three dimensions", DimensionSet{{Size: 1000}, {Size: 1000}, {Size: 3}}, 1 << 20, AccessRandom, []int{256, 256, 3}},
+		{"sequential rows", DimensionSet{{Size: 1000}, {Size: 100000}}, 0, AccessSequential, []int{1000, 64}},
+		{"sequential wide rows", DimensionSet{{Size: 1000000}, {Size: 1000}}, 0, AccessSequential, []int{65536, 1}},
+	}
+	for _, test := range tests {
+		actual := SuggestTileSize(test.dims, rgba, test.target, test.access)
+		if !slices.Equal(actual, test.expect) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expect, actual)
+		}
+	}
+}
+
+func TestCheckTiling(t *testing.T) {
+	tests := []struct {
+		name string
+		dims DimensionSet
+		slow bool
+	}{
+		{"reasonable tiles", DimensionSet{{Size: 1000, TileSize: 256}, {Size: 1000, TileSize: 256}}, false},
+		{"tiny layer in one tile", DimensionSet{{Size: 4, TileSize: 4}, {Size: 4, TileSize: 4}}, false},
+		{"single sample tiles", DimensionSet{{Size: 100, TileSize: 1}, {Size: 100, TileSize: 1}}, true},
+		{"millions of tiles", DimensionSet{{Size: 1 << 16, TileSize: 16}, {Size: 1 << 16, TileSize: 16}}, true},
+		{"tile larger than dimension", DimensionSet{{Size: 100, TileSize: 200}}, true},
+	}
+	for _, test := range tests {
+		err := test.dims.CheckTiling()
+		if test.slow != errors.Is(err, ErrSlowTiling) {
+			t.Errorf("%s: expected slow %v, got %v", test.name, test.slow, err)
+		}
+	}
+}
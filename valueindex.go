@@ -0,0 +1,319 @@
+package pixi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"slices"
+
+	"github.com/owlpinetech/pixi/internal/xxhash"
+)
+
+// The prefix of the keys of the binary layer tags holding value indices, followed by the name of the
+// indexed field.
+const ValueIndexTagPrefix = "value-index:"
+
+// Returns the key of the binary layer tag holding the value index of the named field.
+func ValueIndexTag(fieldName string) string {
+	return ValueIndexTagPrefix + fieldName
+}
+
+// How a ValueIndex summarizes the values of a field in each tile.
+type ValueIndexKind uint8
+
+const (
+	// The minimum and maximum of each tile, for range queries on continuous fields, such as skipping
+	// tiles entirely below a threshold.
+	ValueIndexMinMax ValueIndexKind = 1
+	// A bloom filter of the values in each tile, for existence queries on categorical fields, such as
+	// finding the tiles that contain a class. Bloom filters can report values a tile does not contain,
+	// but never miss values it does.
+	ValueIndexBloom ValueIndexKind = 2
+)
+
+func (k ValueIndexKind) String() string {
+	switch k {
+	case ValueIndexMinMax:
+		return "minmax"
+	case ValueIndexBloom:
+		return "bloom"
+	default:
+		return "unknown"
+	}
+}
+
+// The size of the bloom filter of each tile and the number of bits each value sets in it. With these,
+// a tile with a hundred distinct values reports a value it does not contain about one time in two
+// hundred.
+const (
+	tileBloomBytes  = 256
+	tileBloomHashes = 3
+)
+
+// A summary of the values of one field in each tile of a layer, stored in a binary layer tag (see
+// ValueIndexTag), so that queries can find the tiles that may hold values of interest without reading
+// or decoding any tile. Tiles that were never written, and the padding of partial tiles at the edges
+// of the layer, hold no values.
+type ValueIndex struct {
+	Kind  ValueIndexKind
+	Field Field
+	// For ValueIndexMinMax, the smallest and largest value of each tile, or nil for tiles without values.
+	// NaN values are ignored.
+	Min []any
+	Max []any
+	// For ValueIndexBloom, the bloom filter of each tile.
+	Blooms [][]byte
+	hashes int
+}
+
+// Builds an index of the field with the given index in the layer, reading and decoding every written
+// tile holding the field.
+func BuildValueIndex(r io.ReadSeeker, h PixiHeader, layer *Layer, fieldIndex int, kind ValueIndexKind) (*ValueIndex, error) {
+	if kind != ValueIndexMinMax && kind != ValueIndexBloom {
+		return nil, UnsupportedError("unknown value index kind")
+	}
+	field := layer.Fields[fieldIndex]
+	tiles := layer.Dimensions.Tiles()
+	index := newValueIndex(kind, field, tiles)
+
+	offset, stride := 0, field.Size()
+	if !layer.Separated {
+		stride = layer.SampleSize()
+		for _, f := range layer.Fields[:fieldIndex] {
+			offset += f.Size()
+		}
+	}
+	for tile := range tiles {
+		diskTile := tile
+		if layer.Separated {
+			diskTile += fieldIndex * tiles
+		}
+		if layer.TileBytes[diskTile] == 0 {
+			continue
+		}
+		data := make([]byte, layer.DiskTileSize(diskTile))
+		err := layer.ReadTile(r, h, diskTile, data)
+		if err != nil {
+			return nil, err
+		}
+
+		minMax := NewMinMax(field.Type, NaNIgnore)
+		for inTile := range layer.Dimensions.TileSamples() {
+			coord := TileSelector{Tile: tile, InTile: inTile}.ToTileCoordinate(layer.Dimensions).ToSampleCoordinate(layer.Dimensions)
+			if !inBounds(layer.Dimensions, coord) {
+				continue
+			}
+			value := field.BytesToValue(data[offset+inTile*stride:], h.ByteOrder)
+			if kind == ValueIndexMinMax {
+				minMax.Update(value)
+			} else {
+				index.addToBloom(tile, value)
+			}
+		}
+		if kind == ValueIndexMinMax {
+			index.Min[tile], index.Max[tile] = minMax.Min, minMax.Max
+		}
+	}
+	return index, nil
+}
+
+func newValueIndex(kind ValueIndexKind, field Field, tiles int) *ValueIndex {
+	index := &ValueIndex{Kind: kind, Field: field, hashes: tileBloomHashes}
+	if kind == ValueIndexMinMax {
+		index.Min = make([]any, tiles)
+		index.Max = make([]any, tiles)
+	} else {
+		index.Blooms = make([][]byte, tiles)
+		for tile := range index.Blooms {
+			index.Blooms[tile] = make([]byte, tileBloomBytes)
+		}
+	}
+	return index
+}
+
+func inBounds(dims DimensionSet, coord SampleCoordinate) bool {
+	for i, dim := range dims {
+		if coord[i] >= dim.Size {
+			return false
+		}
+	}
+	return true
+}
+
+// The bits of a tile's bloom filter set by a value, found by double hashing its big endian bytes.
+func (x *ValueIndex) bloomBits(tile int, value any) []int {
+	raw := make([]byte, x.Field.Size())
+	x.Field.ValueToBytes(value, raw, binary.BigEndian)
+	sum := xxhash.Sum64(raw)
+	first, second := uint32(sum), uint32(sum>>32)|1
+	size := uint32(len(x.Blooms[tile]) * 8)
+	bits := make([]int, x.hashes)
+	for i := range bits {
+		bits[i] = int((first + uint32(i)*second) % size)
+	}
+	return bits
+}
+
+func (x *ValueIndex) addToBloom(tile int, value any) {
+	for _, bit := range x.bloomBits(tile, value) {
+		x.Blooms[tile][bit/8] |= 1 << (bit % 8)
+	}
+}
+
+// The number of tiles in the index.
+func (x *ValueIndex) Tiles() int {
+	if x.Kind == ValueIndexMinMax {
+		return len(x.Min)
+	}
+	return len(x.Blooms)
+}
+
+// Reports whether the tile may contain the value, which must be of the Go type of the indexed field. A
+// false result is certain; a true result may not be, since a minimum and maximum only bound the values of
+// a tile, and a bloom filter can match values it was never given.
+func (x *ValueIndex) MayContain(tile int, value any) bool {
+	if x.Kind == ValueIndexMinMax {
+		return x.MayContainRange(tile, value, value)
+	}
+	for _, bit := range x.bloomBits(tile, value) {
+		if x.Blooms[tile][bit/8]&(1<<(bit%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Reports whether the tile may contain a value from low to high inclusive, which must be of the Go type of
+// the indexed field. Bloom filters cannot answer range queries, so with them this only rules out tiles
+// without values.
+func (x *ValueIndex) MayContainRange(tile int, low any, high any) bool {
+	if x.Kind == ValueIndexBloom {
+		return slices.ContainsFunc(x.Blooms[tile], func(b byte) bool { return b != 0 })
+	}
+	if x.Min[tile] == nil {
+		return false
+	}
+	return x.Field.Type.CompareValues(x.Min[tile], high) <= 0 && x.Field.Type.CompareValues(x.Max[tile], low) >= 0
+}
+
+// Returns the indices of the tiles that may contain the value, as with MayContain.
+func (x *ValueIndex) TilesContaining(value any) []int {
+	tiles := []int{}
+	for tile := range x.Tiles() {
+		if x.MayContain(tile, value) {
+			tiles = append(tiles, tile)
+		}
+	}
+	return tiles
+}
+
+// Returns the indices of the tiles that may contain a value from low to high inclusive, as with
+// MayContainRange.
+func (x *ValueIndex) TilesInRange(low any, high any) []int {
+	tiles := []int{}
+	for tile := range x.Tiles() {
+		if x.MayContainRange(tile, low, high) {
+			tiles = append(tiles, tile)
+		}
+	}
+	return tiles
+}
+
+// Encodes the index as the payload of its binary layer tag, in the byte order of the header: the kind,
+// the number of tiles, and then for a minimum and maximum index a presence byte and the minimum and
+// maximum values of each tile, or for a bloom filter index the size of each filter in bytes, the number
+// of hashes, and each filter in turn.
+func (x *ValueIndex) Encode(h PixiHeader) []byte {
+	buf := &bytes.Buffer{}
+	buf.WriteByte(byte(x.Kind))
+	count := make([]byte, 4)
+	h.ByteOrder.PutUint32(count, uint32(x.Tiles()))
+	buf.Write(count)
+	if x.Kind == ValueIndexMinMax {
+		value := make([]byte, x.Field.Size())
+		for tile := range x.Min {
+			if x.Min[tile] == nil {
+				buf.WriteByte(0)
+				buf.Write(make([]byte, 2*len(value)))
+				continue
+			}
+			buf.WriteByte(1)
+			x.Field.ValueToBytes(x.Min[tile], value, h.ByteOrder)
+			buf.Write(value)
+			x.Field.ValueToBytes(x.Max[tile], value, h.ByteOrder)
+			buf.Write(value)
+		}
+	} else {
+		bloomBytes := tileBloomBytes
+		if len(x.Blooms) > 0 {
+			bloomBytes = len(x.Blooms[0])
+		}
+		h.ByteOrder.PutUint32(count, uint32(bloomBytes))
+		buf.Write(count)
+		buf.WriteByte(byte(x.hashes))
+		for _, bloom := range x.Blooms {
+			buf.Write(bloom)
+		}
+	}
+	return buf.Bytes()
+}
+
+// Decodes a value index of the field from the payload of its binary layer tag, as written by Encode.
+func DecodeValueIndex(payload []byte, h PixiHeader, field Field) (*ValueIndex, error) {
+	if len(payload) < 5 {
+		return nil, FormatError("value index is truncated")
+	}
+	kind := ValueIndexKind(payload[0])
+	tiles := int(h.ByteOrder.Uint32(payload[1:]))
+	payload = payload[5:]
+	switch kind {
+	case ValueIndexMinMax:
+		size := field.Size()
+		if len(payload) != tiles*(1+2*size) {
+			return nil, FormatError("value index has the wrong size for its tiles")
+		}
+		index := newValueIndex(kind, field, tiles)
+		for tile := range tiles {
+			entry := payload[tile*(1+2*size):]
+			if entry[0] != 0 {
+				index.Min[tile] = field.BytesToValue(entry[1:], h.ByteOrder)
+				index.Max[tile] = field.BytesToValue(entry[1+size:], h.ByteOrder)
+			}
+		}
+		return index, nil
+	case ValueIndexBloom:
+		if len(payload) < 5 {
+			return nil, FormatError("value index is truncated")
+		}
+		bloomBytes := int(h.ByteOrder.Uint32(payload))
+		hashes := int(payload[4])
+		payload = payload[5:]
+		if bloomBytes <= 0 || hashes <= 0 || len(payload) != tiles*bloomBytes {
+			return nil, FormatError("value index has the wrong size for its tiles")
+		}
+		index := &ValueIndex{Kind: kind, Field: field, hashes: hashes, Blooms: make([][]byte, tiles)}
+		for tile := range tiles {
+			index.Blooms[tile] = payload[tile*bloomBytes : (tile+1)*bloomBytes]
+		}
+		return index, nil
+	default:
+		return nil, UnsupportedError("unknown value index kind")
+	}
+}
+
+// Reads the value index of the named field from the layer's tags, reporting whether the layer has one.
+func (d *Layer) ReadValueIndex(r io.ReadSeeker, h PixiHeader, fieldName string) (*ValueIndex, bool, error) {
+	fieldIndex, found := d.Fields.ByName(fieldName)
+	if !found {
+		return nil, false, FormatError("layer '" + d.Name + "' has no field '" + fieldName + "'")
+	}
+	payload, found, err := d.LookupBinaryTag(r, h, ValueIndexTag(d.Fields[fieldIndex].Name))
+	if err != nil || !found {
+		return nil, false, err
+	}
+	index, err := DecodeValueIndex(payload, h, d.Fields[fieldIndex])
+	if err != nil {
+		return nil, false, err
+	}
+	return index, true, nil
+}
@@ -0,0 +1,77 @@
+package pixi
+
+import (
+	"encoding/binary"
+	"slices"
+	"testing"
+
+	"github.com/owlpinetech/pixi/internal/buffer"
+)
+
+func TestValueIndex(t *testing.T) {
+	header := PixiHeader{Version: Version, OffsetSize: 4, ByteOrder: binary.LittleEndian, Checksum: ChecksumCrc32}
+	layer := NewLayer("landcover", true, CompressionFlate,
+		DimensionSet{{Name: "x", Size: 6, TileSize: 4}, {Name: "y", Size: 6, TileSize: 4}},
+		[]Field{{Name: "class", Type: FieldUint8}, {Name: "height", Type: FieldFloat32}})
+
+	// classes are ten times the tile plus 0 to 2, heights a hundred times the tile plus the sample in the
+	// tile, and the padding of partial tiles holds values that must not be indexed
+	tiles := make([][]byte, layer.DiskTiles())
+	for tile := range layer.Dimensions.Tiles() {
+		classes := make([]byte, layer.DiskTileSize(tile))
+		heights := make([]byte, layer.DiskTileSize(tile+layer.Dimensions.Tiles()))
+		for inTile := range layer.Dimensions.TileSamples() {
+			coord := TileSelector{Tile: tile, InTile: inTile}.ToTileCoordinate(layer.Dimensions).ToSampleCoordinate(layer.Dimensions)
+			class, height := uint8(tile*10+inTile%3), float32(tile*100+inTile)
+			if coord[0] >= 6 || coord[1] >= 6 {
+				class, height = 255, -1
+			}
+			classes[inTile] = class
+			layer.Fields[1].ValueToBytes(height, heights[inTile*4:], header.ByteOrder)
+		}
+		tiles[tile], tiles[tile+layer.Dimensions.Tiles()] = classes, heights
+	}
+	buf := buffer.NewBuffer(10)
+	writeSingleLayerPixi(t, buf, header, nil, layer, tiles)
+	rdr := buffer.NewBufferFrom(buf.Bytes())
+
+	bloom, err := BuildValueIndex(rdr, header, layer, 0, ValueIndexBloom)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found := bloom.TilesContaining(uint8(21)); !slices.Contains(found, 2) {
+		t.Errorf("expected tile 2 to contain class 21, got %v", found)
+	}
+	if found := bloom.TilesContaining(uint8(255)); len(found) > 1 {
+		t.Errorf("expected padding values not to be indexed, got tiles %v", found)
+	}
+
+	minMax, err := BuildValueIndex(rdr, header, layer, 1, ValueIndexMinMax)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if minMax.Min[1] != float32(100) || minMax.Max[3] != float32(305) {
+		t.Errorf("unexpected ranges, tile 1 from %v, tile 3 to %v", minMax.Min[1], minMax.Max[3])
+	}
+	if found := minMax.TilesInRange(float32(150), float32(250)); !slices.Equal(found, []int{2}) {
+		t.Errorf("expected only tile 2 to hold heights from 150 to 250, got %v", found)
+	}
+
+	for _, index := range []*ValueIndex{bloom, minMax} {
+		decoded, err := DecodeValueIndex(index.Encode(header), header, index.Field)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for tile := range index.Tiles() {
+			if decoded.MayContain(tile, index.Field.Type.Float64ToValue(21)) != index.MayContain(tile, index.Field.Type.Float64ToValue(21)) {
+				t.Errorf("%s index of tile %d changed when decoded", index.Kind, tile)
+			}
+		}
+		if decoded.Kind == ValueIndexMinMax && !slices.Equal(decoded.Max, index.Max) {
+			t.Errorf("expected decoded maximums %v, got %v", index.Max, decoded.Max)
+		}
+	}
+	if _, err := DecodeValueIndex([]byte{1, 2}, header, layer.Fields[0]); err == nil {
+		t.Error("expected an error for a truncated index")
+	}
+}
@@ -0,0 +1,13 @@
+package pixi
+
+import "runtime"
+
+// Returns the number of goroutines to use for work that can run in parallel, such as encoding tiles:
+// n if it is positive, otherwise GOMAXPROCS. Options that take a worker count pass it through here, so
+// leaving the count at zero always means "as many as the process can run at once".
+func Workers(n int) int {
+	if n > 0 {
+		return n
+	}
+	return runtime.GOMAXPROCS(0)
+}